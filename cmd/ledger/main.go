@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"go-api/config"
+	"go-api/services"
+)
+
+// Kiểm tra bất biến sổ cái:
+//
+//	go run ./cmd/ledger                  # kiểm tra tất cả nhà hàng
+//	go run ./cmd/ledger -restaurant 12   # một nhà hàng
+//	go run ./cmd/ledger -backfill        # ghi sổ đơn / hoàn tiền có từ trước rồi kiểm tra
+//
+// Thoát với mã 1 khi có vi phạm (dùng được trong cron / CI)
+func main() {
+	restaurantID := flag.Uint("restaurant", 0, "Restaurant ID (0 = tất cả)")
+	backfill := flag.Bool("backfill", false, "Ghi sổ cho đơn đã thanh toán và hoàn tiền chưa có bút toán")
+	flag.Parse()
+
+	fmt.Println("📒 Checking ledger...")
+
+	config.ConnectDatabase()
+	db := config.GetDB()
+
+	if *backfill {
+		orders, refunds, err := services.BackfillLedger(db, *restaurantID)
+		if err != nil {
+			fmt.Printf("❌ Backfill failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Backfilled %d orders, %d refunds\n", orders, refunds)
+	}
+
+	violations, err := services.CheckLedgerInvariants(db, *restaurantID)
+	if err != nil {
+		fmt.Printf("❌ Check failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(violations) == 0 {
+		fmt.Println("✅ Ledger is balanced, all payments and refunds are posted")
+		return
+	}
+
+	for _, v := range violations {
+		fmt.Printf("❌ [%s] restaurant=%d %s: %s\n", v.Check, v.RestaurantID, v.Reference, v.Detail)
+	}
+	fmt.Printf("❌ %d violation(s)\n", len(violations))
+	os.Exit(1)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"go-api/models"
+	"go-api/services"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Thêm mẫu nội dung chuyển khoản thật vào bộ mẫu của bộ phân tích mã thanh toán:
+//
+//	DATABASE_URL=postgres://... go run ./cmd/memocorpus              # ghi vào services/testdata/payment_memos.json
+//	DATABASE_URL=postgres://... go run ./cmd/memocorpus -limit 2000
+//
+// Đọc payment_transactions.raw_webhook_data, che dãy số dài (số tài khoản, số điện thoại), bỏ mẫu trùng.
+// Mẫu lấy từ giao dịch đã hoàn tất (kỳ vọng đúng mã đã khớp), đã được gán tay (kỳ vọng mã được gán,
+// chưa khớp được thì test chỉ ghi log) và đã bỏ qua (kỳ vọng không có mã). Kiểm tra lại file trước khi commit.
+// Chạy kiểm tra: go test ./services -run TestPaymentMemoCorpus
+func main() {
+	limit := flag.Int("limit", 1000, "Số giao dịch tối đa đọc")
+	out := flag.String("out", "services/testdata/payment_memos.json", "File bộ mẫu")
+	flag.Parse()
+
+	// Bắt buộc đặt DATABASE_URL: không dùng DSN mặc định trong config
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		fmt.Println("❌ DATABASE_URL is not set")
+		os.Exit(1)
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		fmt.Printf("❌ Connect failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	samples, err := loadMemoSamples(*out)
+	if err != nil {
+		fmt.Printf("❌ Read corpus failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	added, err := exportMemoSamples(db, &samples, *limit)
+	if err != nil {
+		fmt.Printf("❌ Export failed: %v\n", err)
+		os.Exit(1)
+	}
+	if err := saveMemoSamples(*out, samples); err != nil {
+		fmt.Printf("❌ Write corpus failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ Added %d memo(s), corpus has %d\n", added, len(samples))
+}
+
+// memoSample một mẫu nội dung chuyển khoản (cùng định dạng với bộ mẫu trong services/testdata)
+type memoSample struct {
+	Memo     string `json:"memo"`
+	Type     string `json:"type,omitempty"`
+	Code     string `json:"code,omitempty"`
+	Verified bool   `json:"verified,omitempty"`
+	Gap      bool   `json:"gap,omitempty"`
+	Source   string `json:"source,omitempty"` // synthetic, transaction:<id>
+}
+
+// exportMemoSamples thêm nội dung chuyển khoản chưa có trong bộ mẫu, trả về số mẫu đã thêm
+func exportMemoSamples(db *gorm.DB, samples *[]memoSample, limit int) (int, error) {
+	existing := map[string]bool{}
+	for _, sample := range *samples {
+		existing[sample.Memo] = true
+	}
+
+	var transactions []models.PaymentTransaction
+	if err := db.Where("raw_webhook_data IS NOT NULL AND status IN ?", []string{"completed", services.TransactionAssigned, services.TransactionIgnored}).
+		Order("id DESC").
+		Limit(limit).
+		Find(&transactions).Error; err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, tx := range transactions {
+		memo := rawMemo(*tx.RawWebhookData)
+		if memo == "" {
+			continue
+		}
+
+		sample := memoSample{Source: fmt.Sprintf("transaction:%d", tx.ID)}
+		if tx.Status != services.TransactionIgnored {
+			sample.Type = tx.TransactionType
+			sample.Code = tx.ReferenceCode
+			sample.Gap = tx.Status == services.TransactionAssigned
+		}
+		sample.Memo = maskLongNumbers(memo, sample.Code)
+		if sample.Code != "" {
+			sample.Verified = verifiedInMemo(sample.Memo, sample.Code)
+		}
+
+		if existing[sample.Memo] {
+			continue
+		}
+		existing[sample.Memo] = true
+		*samples = append(*samples, sample)
+		added++
+	}
+	return added, nil
+}
+
+// verifiedInMemo nội dung có mã kèm ký tự kiểm tra hợp lệ
+func verifiedInMemo(memo, code string) bool {
+	variants := services.PaymentCodeVariants(code)
+	for _, m := range services.FindPaymentCodes(memo) {
+		if !m.Verified {
+			continue
+		}
+		for _, variant := range variants {
+			if variant == m.Code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rawMemo nội dung chuyển khoản trong payload webhook đã lưu
+// (webhook lưu trường "content", luồng hoàn tất thanh toán lưu "transactionContent")
+func rawMemo(raw string) string {
+	var payload struct {
+		Content            string `json:"content"`
+		TransactionContent string `json:"transactionContent"`
+	}
+	if err := json.Unmarshal([]byte(raw), &payload); err != nil {
+		return ""
+	}
+	if payload.Content != "" {
+		return payload.Content
+	}
+	return payload.TransactionContent
+}
+
+// maskLongNumbers thay dãy từ 9 chữ số trở lên (số tài khoản, số điện thoại) bằng 9, giữ nguyên phần số của mã
+func maskLongNumbers(memo, code string) string {
+	keep := ""
+	if len(code) > 3 {
+		keep = strings.TrimRight(code[3:], "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(memo); {
+		j := i
+		for j < len(memo) && memo[j] >= '0' && memo[j] <= '9' {
+			j++
+		}
+		if j == i {
+			b.WriteByte(memo[i])
+			i++
+			continue
+		}
+		run := memo[i:j]
+		if len(run) >= 9 && (keep == "" || !strings.Contains(run, keep)) {
+			run = strings.Repeat("9", len(run))
+		}
+		b.WriteString(run)
+		i = j
+	}
+	return b.String()
+}
+
+func loadMemoSamples(file string) ([]memoSample, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var samples []memoSample
+	if err := json.Unmarshal(data, &samples); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+func saveMemoSamples(file string, samples []memoSample) error {
+	data, err := json.MarshalIndent(samples, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestMaskLongNumbers(t *testing.T) {
+	tests := []struct {
+		memo, code, want string
+	}{
+		{"MBVCB.1234567890.ORD20260015D", "ORD20260015D", "MBVCB.9999999999.ORD20260015D"},
+		{"ORD20260015D0987654321", "ORD20260015D", "ORD20260015D9999999999"},
+		{"ORD202600151234567", "ORD20260015D", "ORD202600151234567"},
+		{"CT tu 123456789 toi 12345678", "", "CT tu 999999999 toi 12345678"},
+	}
+	for _, tt := range tests {
+		if got := maskLongNumbers(tt.memo, tt.code); got != tt.want {
+			t.Errorf("maskLongNumbers(%q) = %q, want %q", tt.memo, got, tt.want)
+		}
+	}
+}
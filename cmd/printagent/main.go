@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Print agent chạy trên máy trong mạng LAN của nhà hàng: lấy lệnh in từ server (long-poll) bằng API key scope
+// print.agent, gửi tới máy in rồi báo kết quả. Lệnh lỗi được server hẹn in lại, hết lượt thì báo lên dashboard.
+//
+//	go run ./cmd/printagent -server https://api.example.com -key rk_... \
+//	    -device "Thu ngân=tcp://192.168.1.50:9100" \
+//	    -device "3=/dev/usb/lp0" \
+//	    -default dir:./prints
+//
+// Máy in được chọn theo tên hoặc ID (GET /restaurants/{id}/printers). Thiết bị:
+//
+//	tcp://host:9100   máy in mạng (RAW / JetDirect)
+//	lp:queue          gửi qua lệnh lp tới hàng đợi CUPS
+//	dir:./prints      ghi mỗi lệnh một file (kiểm tra / máy in PDF)
+//	/dev/usb/lp0      thiết bị hoặc file, ghi nối tiếp
+//
+// API key có thể đặt qua biến môi trường PRINT_AGENT_KEY
+
+// deviceFlag -device lặp lại được, dạng "tên hoặc ID=thiết bị"
+type deviceFlag map[string]string
+
+func (d deviceFlag) String() string {
+	return fmt.Sprint(map[string]string(d))
+}
+
+func (d deviceFlag) Set(value string) error {
+	name, target, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(name) == "" || strings.TrimSpace(target) == "" {
+		return errors.New("dạng đúng: tên hoặc ID=thiết bị")
+	}
+	d[strings.TrimSpace(name)] = strings.TrimSpace(target)
+	return nil
+}
+
+// agentJob lệnh in server trả về (data là base64, json tự giải mã vào []byte)
+type agentJob struct {
+	ID          uint   `json:"id"`
+	PrinterID   uint   `json:"printer_id"`
+	PrinterName string `json:"printer_name"`
+	OrderID     *uint  `json:"order_id"`
+	Kind        string `json:"kind"`
+	Format      string `json:"format"`
+	Attempts    int    `json:"attempts"`
+	Data        []byte `json:"data"`
+}
+
+type agentResponse struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+	Error   *struct {
+		Code    string `json:"code"`
+		Details string `json:"details"`
+	} `json:"error"`
+}
+
+type agent struct {
+	server        string
+	key           string
+	devices       deviceFlag
+	defaultDevice string
+	wait          int
+	client        *http.Client
+}
+
+func main() {
+	devices := deviceFlag{}
+	server := flag.String("server", envOrDefault("PRINT_AGENT_SERVER", "http://localhost:8080"), "Địa chỉ server")
+	key := flag.String("key", os.Getenv("PRINT_AGENT_KEY"), "API key nhà hàng (scope print.agent)")
+	flag.Var(devices, "device", "Thiết bị cho máy in: tên hoặc ID=thiết bị (lặp lại được)")
+	defaultDevice := flag.String("default", "", "Thiết bị cho máy in chưa khai báo (bỏ trống = chỉ lấy lệnh của máy in đã khai báo)")
+	wait := flag.Int("wait", 25, "Số giây long-poll mỗi lượt (0-60)")
+	flag.Parse()
+
+	if *key == "" {
+		fmt.Println("❌ Thiếu API key (-key hoặc PRINT_AGENT_KEY)")
+		os.Exit(1)
+	}
+	if len(devices) == 0 && *defaultDevice == "" {
+		fmt.Println("❌ Chưa khai báo thiết bị (-device hoặc -default)")
+		os.Exit(1)
+	}
+
+	a := &agent{
+		server:        strings.TrimRight(*server, "/") + "/api/v1/print-agent",
+		key:           *key,
+		devices:       devices,
+		defaultDevice: *defaultDevice,
+		wait:          min(max(*wait, 0), 60),
+		client:        &http.Client{Timeout: time.Duration(*wait+30) * time.Second},
+	}
+
+	fmt.Println("🖨️  Print agent starting...")
+	printerIDs, err := a.resolvePrinters()
+	if err != nil {
+		fmt.Printf("❌ Cannot load printers: %v\n", err)
+		os.Exit(1)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	backoff := time.Second
+	for {
+		select {
+		case <-stop:
+			fmt.Println("👋 Print agent stopped")
+			return
+		default:
+		}
+
+		jobs, err := a.poll(printerIDs)
+		if err != nil {
+			fmt.Printf("⚠️  Poll failed: %v (retry in %s)\n", err, backoff)
+			select {
+			case <-stop:
+				fmt.Println("👋 Print agent stopped")
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, time.Minute)
+			continue
+		}
+		backoff = time.Second
+
+		for _, job := range jobs {
+			a.handle(job)
+		}
+	}
+}
+
+// resolvePrinters đối chiếu máy in của nhà hàng với -device, trả về ID cần lấy lệnh (nil = tất cả, khi có -default)
+func (a *agent) resolvePrinters() ([]uint, error) {
+	var data struct {
+		Printers []struct {
+			ID     uint   `json:"id"`
+			Name   string `json:"name"`
+			Role   string `json:"role"`
+			Format string `json:"format"`
+		} `json:"printers"`
+	}
+	if err := a.request(http.MethodGet, "/printers", nil, &data); err != nil {
+		return nil, err
+	}
+
+	var ids []uint
+	matched := map[string]bool{}
+	for _, printer := range data.Printers {
+		target, key := a.deviceFor(printer.ID, printer.Name)
+		if key != "" {
+			matched[key] = true
+			ids = append(ids, printer.ID)
+		}
+		if target == "" {
+			target = "(bỏ qua)"
+		}
+		fmt.Printf("   #%d %s [%s, %s] → %s\n", printer.ID, printer.Name, printer.Role, printer.Format, target)
+	}
+	for key := range a.devices {
+		if !matched[key] {
+			fmt.Printf("⚠️  -device %q không khớp máy in nào đang bật\n", key)
+		}
+	}
+
+	if a.defaultDevice != "" {
+		return nil, nil
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("không có máy in nào khớp -device")
+	}
+	return ids, nil
+}
+
+// deviceFor thiết bị của máy in và khóa -device đã khớp (rỗng nếu dùng -default)
+func (a *agent) deviceFor(printerID uint, printerName string) (string, string) {
+	if target, ok := a.devices[strconv.FormatUint(uint64(printerID), 10)]; ok {
+		return target, strconv.FormatUint(uint64(printerID), 10)
+	}
+	if target, ok := a.devices[printerName]; ok {
+		return target, printerName
+	}
+	return a.defaultDevice, ""
+}
+
+func (a *agent) poll(printerIDs []uint) ([]agentJob, error) {
+	query := url.Values{}
+	query.Set("wait", strconv.Itoa(a.wait))
+	if len(printerIDs) > 0 {
+		ids := make([]string, 0, len(printerIDs))
+		for _, id := range printerIDs {
+			ids = append(ids, strconv.FormatUint(uint64(id), 10))
+		}
+		query.Set("printers", strings.Join(ids, ","))
+	}
+
+	var data struct {
+		Jobs []agentJob `json:"jobs"`
+	}
+	if err := a.request(http.MethodGet, "/jobs?"+query.Encode(), nil, &data); err != nil {
+		return nil, err
+	}
+	return data.Jobs, nil
+}
+
+// handle in một lệnh và báo kết quả (lỗi báo về server để hẹn in lại)
+func (a *agent) handle(job agentJob) {
+	target, _ := a.deviceFor(job.PrinterID, job.PrinterName)
+	err := printTo(target, job)
+
+	ack := map[string]interface{}{"success": err == nil}
+	if err != nil {
+		ack["error"] = err.Error()
+		fmt.Printf("❌ Job #%d (%s → %s) failed: %v\n", job.ID, job.Kind, job.PrinterName, err)
+	} else {
+		fmt.Printf("✅ Job #%d (%s → %s) printed\n", job.ID, job.Kind, job.PrinterName)
+	}
+
+	if ackErr := a.request(http.MethodPost, "/jobs/"+strconv.FormatUint(uint64(job.ID), 10)+"/ack", ack, nil); ackErr != nil {
+		// Server sẽ giao lại lệnh khi hết thời gian giữ
+		fmt.Printf("⚠️  Ack job #%d failed: %v\n", job.ID, ackErr)
+	}
+}
+
+func (a *agent) request(method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, a.server+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-API-Key", a.key)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var envelope agentResponse
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("HTTP %d: %w", resp.StatusCode, err)
+	}
+	if !envelope.Success {
+		if envelope.Error != nil {
+			return fmt.Errorf("HTTP %d %s: %s", resp.StatusCode, envelope.Error.Code, envelope.Message)
+		}
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, envelope.Message)
+	}
+	if out != nil && len(envelope.Data) > 0 {
+		return json.Unmarshal(envelope.Data, out)
+	}
+	return nil
+}
+
+// ===============================
+// THIẾT BỊ IN
+// ===============================
+
+func printTo(target string, job agentJob) error {
+	switch {
+	case target == "":
+		return errors.New("máy in chưa được gán thiết bị trên agent")
+	case strings.HasPrefix(target, "tcp://"):
+		conn, err := net.DialTimeout("tcp", strings.TrimPrefix(target, "tcp://"), 5*time.Second)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+		_, err = conn.Write(job.Data)
+		return err
+	case strings.HasPrefix(target, "lp:"):
+		cmd := exec.Command("lp", "-d", strings.TrimPrefix(target, "lp:"), "-o", "raw")
+		if job.Format == "pdf" {
+			cmd = exec.Command("lp", "-d", strings.TrimPrefix(target, "lp:"))
+		}
+		cmd.Stdin = bytes.NewReader(job.Data)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("lp: %v %s", err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	case strings.HasPrefix(target, "dir:"):
+		dir := strings.TrimPrefix(target, "dir:")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		ext := ".bin"
+		if job.Format == "pdf" {
+			ext = ".pdf"
+		}
+		name := fmt.Sprintf("%s-%d-%s%s", time.Now().Format("20060102-150405"), job.ID, job.Kind, ext)
+		return os.WriteFile(filepath.Join(dir, name), job.Data, 0o644)
+	default:
+		file, err := os.OpenFile(target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(job.Data); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	}
+}
+
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
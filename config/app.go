@@ -0,0 +1,63 @@
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// DefaultFrontendBaseURL URL frontend mặc định khi chưa cấu hình FRONTEND_BASE_URL
+const DefaultFrontendBaseURL = "http://localhost:3000"
+
+// FrontendBaseURL trả về URL gốc của frontend (dùng để tạo link QR gọi món, link tracking...)
+func FrontendBaseURL() string {
+	baseURL := strings.TrimRight(os.Getenv("FRONTEND_BASE_URL"), "/")
+	if baseURL == "" {
+		return DefaultFrontendBaseURL
+	}
+	return baseURL
+}
+
+// tableQRKeyLabel nhãn dẫn xuất khóa QR bàn từ JWT_SECRET (token QR không ký bằng chính khóa JWT)
+const tableQRKeyLabel = "table-qr-token"
+
+// devTableQRSecret khóa chỉ dùng ở chế độ dev (GIN_MODE=debug/test) khi chưa cấu hình secret nào
+const devTableQRSecret = "dev-only-table-qr-secret"
+
+var warnTableQRSecret sync.Once
+
+// TableQRSecret trả về khóa ký token QR bàn (TABLE_QR_SECRET)
+// Chưa cấu hình thì dùng khóa dẫn xuất HMAC-SHA256(JWT_SECRET, "table-qr-token"), không dùng lại chính JWT_SECRET
+func TableQRSecret() []byte {
+	if secret := os.Getenv("TABLE_QR_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	if jwtSecret := os.Getenv("JWT_SECRET"); jwtSecret != "" {
+		mac := hmac.New(sha256.New, []byte(jwtSecret))
+		mac.Write([]byte(tableQRKeyLabel))
+		return mac.Sum(nil)
+	}
+	return []byte(devTableQRSecret)
+}
+
+// ValidateTableQRSecret kiểm tra khóa QR bàn khi khởi động: ngoài chế độ dev phải có TABLE_QR_SECRET hoặc JWT_SECRET
+func ValidateTableQRSecret() error {
+	if os.Getenv("TABLE_QR_SECRET") != "" {
+		return nil
+	}
+	if os.Getenv("JWT_SECRET") != "" {
+		warnTableQRSecret.Do(func() {
+			log.Println("⚠️ TABLE_QR_SECRET not set, using a key derived from JWT_SECRET")
+		})
+		return nil
+	}
+	if mode := os.Getenv("GIN_MODE"); mode == "debug" || mode == "test" {
+		log.Println("⚠️ TABLE_QR_SECRET and JWT_SECRET not set, using the development table QR key")
+		return nil
+	}
+	return fmt.Errorf("TABLE_QR_SECRET (hoặc JWT_SECRET) chưa được cấu hình")
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+)
+
+// MailConfig chứa cấu hình gửi email
+type MailConfig struct {
+	Driver    string // smtp, file, console
+	Host      string // SMTP host
+	Port      int    // SMTP port (587 STARTTLS, 465 TLS)
+	Username  string // SMTP username
+	Password  string // SMTP password
+	FromEmail string // Địa chỉ người gửi
+	FromName  string // Tên người gửi
+	OutputDir string // Thư mục lưu email khi dùng driver file
+}
+
+var mailConfig *MailConfig
+
+// GetMailConfig trả về cấu hình email
+func GetMailConfig() *MailConfig {
+	if mailConfig == nil {
+		LoadMailConfig()
+	}
+	return mailConfig
+}
+
+// LoadMailConfig load cấu hình email từ environment.
+// Chưa cấu hình SMTP thì mặc định in email ra console (môi trường dev)
+func LoadMailConfig() {
+	port, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
+	if port == 0 {
+		port = 587
+	}
+
+	mailConfig = &MailConfig{
+		Driver:    os.Getenv("MAIL_DRIVER"),
+		Host:      os.Getenv("SMTP_HOST"),
+		Port:      port,
+		Username:  os.Getenv("SMTP_USERNAME"),
+		Password:  os.Getenv("SMTP_PASSWORD"),
+		FromEmail: os.Getenv("MAIL_FROM_EMAIL"),
+		FromName:  os.Getenv("MAIL_FROM_NAME"),
+		OutputDir: os.Getenv("MAIL_OUTPUT_DIR"),
+	}
+
+	if mailConfig.Driver == "" {
+		if mailConfig.Host != "" {
+			mailConfig.Driver = "smtp"
+		} else {
+			mailConfig.Driver = "console"
+		}
+	}
+	if mailConfig.FromEmail == "" {
+		mailConfig.FromEmail = "no-reply@localhost"
+	}
+	if mailConfig.FromName == "" {
+		mailConfig.FromName = "Restaurant Manager"
+	}
+	if mailConfig.OutputDir == "" {
+		mailConfig.OutputDir = "tmp/mails"
+	}
+
+	switch mailConfig.Driver {
+	case "smtp":
+		log.Printf("✅ Mail configured: SMTP %s:%d", mailConfig.Host, mailConfig.Port)
+	case "file":
+		log.Printf("⚠️ Mail driver=file, emails are written to %s", mailConfig.OutputDir)
+	default:
+		log.Println("⚠️ Mail not configured (SMTP_HOST not set), emails are printed to console")
+	}
+}
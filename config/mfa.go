@@ -0,0 +1,60 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// DefaultMFAIssuer tên hiển thị trong ứng dụng xác thực khi chưa cấu hình MFA_ISSUER
+const DefaultMFAIssuer = "Restaurant Manager"
+
+// MFAIssuer tên dịch vụ hiển thị trong Google Authenticator / Authy...
+func MFAIssuer() string {
+	if issuer := os.Getenv("MFA_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return DefaultMFAIssuer
+}
+
+// MFARequiredRoles các role bắt buộc bật xác thực 2 bước (MFA_REQUIRED_ROLES, phân cách bằng dấu phẩy).
+// admin luôn bắt buộc
+func MFARequiredRoles() []string {
+	roles := []string{"admin"}
+	for _, r := range strings.Split(os.Getenv("MFA_REQUIRED_ROLES"), ",") {
+		r = strings.TrimSpace(r)
+		if r != "" && r != "admin" {
+			roles = append(roles, r)
+		}
+	}
+	return roles
+}
+
+// IsMFARequired kiểm tra role có bắt buộc xác thực 2 bước không
+func IsMFARequired(role string) bool {
+	for _, r := range MFARequiredRoles() {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+var warnMFASecret sync.Once
+
+// MFAEncryptionKey khóa mã hóa secret TOTP trong DB (MFA_ENCRYPTION_KEY)
+// Chưa cấu hình thì dùng tạm JWT_SECRET; đổi khóa = mọi user phải thiết lập lại 2FA
+func MFAEncryptionKey() []byte {
+	key := os.Getenv("MFA_ENCRYPTION_KEY")
+	if key == "" {
+		warnMFASecret.Do(func() {
+			log.Println("⚠️ MFA_ENCRYPTION_KEY not set, falling back to JWT_SECRET")
+		})
+		key = os.Getenv("JWT_SECRET")
+	}
+	if key == "" {
+		key = "your-super-secret-key-change-in-production"
+	}
+	return []byte(key)
+}
@@ -29,6 +29,34 @@ func RunMigrations() error {
 		&models.PaymentTransaction{},  // 11. Payment Transactions (standalone)
 		&models.Notification{},        // 12. Notifications (depends on restaurants)
 		&models.ContactMessage{},      // 13. Contact Messages (standalone)
+		&models.Reservation{},         // 14. Reservations (depends on restaurants, tables)
+		&models.WaitlistEntry{},       // 15. Waitlist (depends on restaurants, tables)
+		&models.ServiceRequest{},      // 16. Service Requests (depends on restaurants, tables)
+		&models.OrderMove{},           // 17. Order Moves (depends on orders, tables)
+		&models.OrderItemChange{},     // 18. Order Item Changes (depends on orders, order items)
+		&models.DeliveryZone{},        // 19. Delivery Zones (depends on restaurants)
+		&models.TableZone{},           // 20. Table Zones (depends on restaurants; tables.zone_id)
+		&models.StaffMember{},         // 21. Staff Members (depends on restaurants, users)
+		&models.UserToken{},           // 22. User Tokens (depends on users)
+		&models.RefreshToken{},        // 23. Refresh Tokens (depends on users)
+		&models.UserMFA{},             // 24. User MFA (depends on users)
+		&models.MFARecoveryCode{},     // 25. MFA Recovery Codes (depends on users)
+		&models.APIKey{},              // 26. API Keys (depends on restaurants)
+		&models.WebhookEndpoint{},     // 27. Webhook Endpoints (depends on restaurants)
+		&models.WebhookDelivery{},     // 28. Webhook Deliveries (depends on webhook endpoints)
+		&models.OrderPayment{},        // 29. Order Payments (depends on orders)
+		&models.PaymentRefund{},       // 30. Payment Refunds (depends on order payments)
+		&models.LedgerAccount{},       // 31. Ledger Accounts (depends on restaurants)
+		&models.LedgerTransaction{},   // 32. Ledger Transactions (depends on restaurants)
+		&models.LedgerEntry{},         // 33. Ledger Entries (depends on ledger transactions, accounts)
+		&models.CashShift{},           // 34. Cash Shifts (depends on restaurants, users)
+		&models.CashMovement{},        // 35. Cash Movements (depends on cash shifts)
+		&models.DailyClosing{},        // 36. Daily Closings (depends on restaurants)
+		&models.EInvoiceSetting{},     // 37. E-invoice Settings (depends on restaurants)
+		&models.InvoiceSeries{},       // 38. Invoice Series (depends on restaurants)
+		&models.Invoice{},             // 39. Invoices (depends on orders, invoice series)
+		&models.Printer{},             // 40. Printers (depends on restaurants)
+		&models.PrintJob{},            // 41. Print Jobs (depends on printers, orders)
 	)
 
 	if err != nil {
@@ -36,6 +64,22 @@ func RunMigrations() error {
 		return err
 	}
 
+	// Đơn hủy trước khi có cancelled_at: lấy tạm updated_at
+	if err := db.Exec("UPDATE orders SET cancelled_at = updated_at WHERE status = ? AND cancelled_at IS NULL", "cancelled").Error; err != nil {
+		log.Printf("❌ Backfill orders.cancelled_at failed: %v", err)
+		return err
+	}
+
+	// Mỗi thu ngân chỉ có một ca đang mở tại mỗi nhà hàng (chặn mở ca đồng thời)
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_cash_shift_open ON cash_shifts (restaurant_id, cashier_id) WHERE status = 'open'").Error; err != nil {
+		log.Printf("⚠️ Cannot create idx_cash_shift_open (close duplicate open shifts first): %v", err)
+	}
+
+	// Mỗi đơn chỉ có một hóa đơn nháp hoặc đã phát hành (chặn phát hành trùng số cho cùng đơn)
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_invoice_active_order ON invoices (order_id) WHERE status IN ('draft', 'issued')").Error; err != nil {
+		log.Printf("⚠️ Cannot create idx_invoice_active_order (cancel duplicate invoices first): %v", err)
+	}
+
 	log.Println("✅ Database migrations completed successfully!")
 	return nil
 }
@@ -71,6 +115,7 @@ func ReseedPackages() error {
 		MaxMenuItems  int
 		MaxTables     int
 		MaxCategories int
+		MaxBranches   int
 		Features      string
 		IsPopular     bool
 		SortOrder     int
@@ -84,6 +129,7 @@ func ReseedPackages() error {
 			MaxMenuItems:  10,
 			MaxTables:     3,
 			MaxCategories: 3,
+			MaxBranches:   1,
 			Features:      `["Quản lý 10 món ăn", "Tối đa 3 bàn", "Đặt món qua QR", "Thanh toán tiền mặt"]`,
 			IsPopular:     false,
 			SortOrder:     0,
@@ -97,6 +143,7 @@ func ReseedPackages() error {
 			MaxMenuItems:  30,
 			MaxTables:     10,
 			MaxCategories: 3,
+			MaxBranches:   1,
 			Features:      `["Tạo thực đơn (tối đa 30 món)", "Gọi món bằng mã QR", "Thống kê doanh thu cơ bản", "Quản lý tối đa 10 bàn", "3 danh mục món ăn (Món chính - Đồ uống - Tráng miệng)", "Hỗ trợ qua email"]`,
 			IsPopular:     false,
 			SortOrder:     1,
@@ -110,6 +157,7 @@ func ReseedPackages() error {
 			MaxMenuItems:  80,
 			MaxTables:     25,
 			MaxCategories: 6,
+			MaxBranches:   1,
 			Features:      `["Bao gồm tất cả tính năng của Gói Cơ Bản", "Quản lý nhân viên phục vụ", "Lưu trữ đám mây", "Quản lý tối đa 25 bàn", "Tạo đến 80 món ăn/đồ uống", "6 danh mục món ăn (Món chính - Món phụ - Đồ nướng - Lẩu - Đồ uống - Tráng miệng)", "Báo cáo doanh thu chi tiết theo danh mục", "Hỗ trợ 24/7"]`,
 			IsPopular:     true,
 			SortOrder:     2,
@@ -123,6 +171,7 @@ func ReseedPackages() error {
 			MaxMenuItems:  -1,
 			MaxTables:     -1,
 			MaxCategories: -1,
+			MaxBranches:   -1,
 			Features:      `["Bao gồm tất cả tính năng của Gói Chuyên Nghiệp", "Hỗ trợ kỹ thuật ưu tiên", "Kết nối nhiều chi nhánh", "Đánh giá & đặt chỗ của khách hàng", "Quản lý không giới hạn số bàn và món ăn", "Tạo danh mục tùy chỉnh linh hoạt", "Tích hợp thực đơn số đồng bộ giữa các chi nhánh", "API tích hợp", "Hỗ trợ ưu tiên 24/7", "Tùy chỉnh theo yêu cầu"]`,
 			IsPopular:     false,
 			SortOrder:     3,
@@ -146,6 +195,7 @@ func ReseedPackages() error {
 				MaxMenuItems:  p.MaxMenuItems,
 				MaxTables:     p.MaxTables,
 				MaxCategories: p.MaxCategories,
+				MaxBranches:   p.MaxBranches,
 				Features:      &p.Features,
 				IsPopular:     p.IsPopular,
 				IsActive:      true,
@@ -166,6 +216,7 @@ func ReseedPackages() error {
 				"max_menu_items": p.MaxMenuItems,
 				"max_tables":     p.MaxTables,
 				"max_categories": p.MaxCategories,
+				"max_branches":   p.MaxBranches,
 				"features":       p.Features,
 				"is_popular":     p.IsPopular,
 				"sort_order":     p.SortOrder,
@@ -195,6 +246,7 @@ func createPackages(db *gorm.DB) error {
 			MaxMenuItems:  10,
 			MaxTables:     3,
 			MaxCategories: 3,
+			MaxBranches:   1,
 			Features:      stringPtr(`["Quản lý 10 món ăn", "Tối đa 3 bàn", "Đặt món qua QR", "Thanh toán tiền mặt"]`),
 			IsPopular:     false,
 			IsActive:      true,
@@ -209,6 +261,7 @@ func createPackages(db *gorm.DB) error {
 			MaxMenuItems:  30,
 			MaxTables:     10,
 			MaxCategories: 3,
+			MaxBranches:   1,
 			Features:      stringPtr(`["Tạo thực đơn (tối đa 30 món)", "Gọi món bằng mã QR", "Thống kê doanh thu cơ bản", "Quản lý tối đa 10 bàn", "3 danh mục món ăn (Món chính - Đồ uống - Tráng miệng)", "Hỗ trợ qua email"]`),
 			IsPopular:     false,
 			IsActive:      true,
@@ -223,6 +276,7 @@ func createPackages(db *gorm.DB) error {
 			MaxMenuItems:  80,
 			MaxTables:     25,
 			MaxCategories: 6,
+			MaxBranches:   1,
 			Features:      stringPtr(`["Bao gồm tất cả tính năng của Gói Cơ Bản", "Quản lý nhân viên phục vụ", "Lưu trữ đám mây", "Quản lý tối đa 25 bàn", "Tạo đến 80 món ăn/đồ uống", "6 danh mục món ăn (Món chính - Món phụ - Đồ nướng - Lẩu - Đồ uống - Tráng miệng)", "Báo cáo doanh thu chi tiết theo danh mục", "Hỗ trợ 24/7"]`),
 			IsPopular:     true,
 			IsActive:      true,
@@ -237,6 +291,7 @@ func createPackages(db *gorm.DB) error {
 			MaxMenuItems:  -1, // Unlimited
 			MaxTables:     -1, // Unlimited
 			MaxCategories: -1, // Unlimited
+			MaxBranches:   -1, // Unlimited
 			Features:      stringPtr(`["Bao gồm tất cả tính năng của Gói Chuyên Nghiệp", "Hỗ trợ kỹ thuật ưu tiên", "Kết nối nhiều chi nhánh", "Đánh giá & đặt chỗ của khách hàng", "Quản lý không giới hạn số bàn và món ăn", "Tạo danh mục tùy chỉnh linh hoạt", "Tích hợp thực đơn số đồng bộ giữa các chi nhánh", "API tích hợp", "Hỗ trợ ưu tiên 24/7", "Tùy chỉnh theo yêu cầu"]`),
 			IsPopular:     false,
 			IsActive:      true,
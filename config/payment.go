@@ -0,0 +1,54 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Địa chỉ sandbox mặc định của cổng thanh toán
+const (
+	DefaultMomoEndpoint    = "https://test-payment.momo.vn"
+	DefaultVNPayPaymentURL = "https://sandbox.vnpayment.vn/paymentv2/vpcpay.html"
+	DefaultVNPayAPIURL     = "https://sandbox.vnpayment.vn/merchant_webapi/api/transaction"
+	DefaultAPIBaseURL      = "http://localhost:8080"
+)
+
+// APIBaseURL URL gốc public của API (dùng tạo URL nhận IPN từ cổng thanh toán)
+func APIBaseURL() string {
+	baseURL := strings.TrimRight(os.Getenv("API_BASE_URL"), "/")
+	if baseURL == "" {
+		return DefaultAPIBaseURL
+	}
+	return baseURL
+}
+
+// MomoEndpoint địa chỉ API MoMo (MOMO_ENDPOINT, production: https://payment.momo.vn)
+func MomoEndpoint() string {
+	if endpoint := strings.TrimRight(os.Getenv("MOMO_ENDPOINT"), "/"); endpoint != "" {
+		return endpoint
+	}
+	return DefaultMomoEndpoint
+}
+
+// VNPayPaymentURL trang thanh toán VNPay (VNPAY_PAYMENT_URL)
+func VNPayPaymentURL() string {
+	if u := os.Getenv("VNPAY_PAYMENT_URL"); u != "" {
+		return u
+	}
+	return DefaultVNPayPaymentURL
+}
+
+// VNPayAPIURL API tra cứu / hoàn tiền VNPay (VNPAY_API_URL)
+func VNPayAPIURL() string {
+	if u := os.Getenv("VNPAY_API_URL"); u != "" {
+		return u
+	}
+	return DefaultVNPayAPIURL
+}
+
+// PaymentFakeProviderEnabled bật cổng thanh toán giả lập (PAYMENT_FAKE_PROVIDER=true), chỉ dùng khi phát triển / kiểm thử
+func PaymentFakeProviderEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("PAYMENT_FAKE_PROVIDER"))
+	return enabled
+}
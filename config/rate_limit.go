@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimitRule giới hạn số request trong một cửa sổ thời gian
+type RateLimitRule struct {
+	Limit  int
+	Window time.Duration
+}
+
+// Giới hạn mặc định theo nhóm route, ghi đè bằng RATE_LIMIT_<TÊN NHÓM> (vd RATE_LIMIT_LOGIN_IP=20/1m)
+var defaultRateLimits = map[string]RateLimitRule{
+	"login_ip":        {Limit: 20, Window: time.Minute},
+	"login_account":   {Limit: 10, Window: 15 * time.Minute},
+	"mfa_ip":          {Limit: 10, Window: time.Minute},
+	"auth_ip":         {Limit: 20, Window: time.Minute},
+	"auth_email":      {Limit: 5, Window: time.Hour},
+	"check_email_ip":  {Limit: 30, Window: time.Minute},
+	"register_ip":     {Limit: 10, Window: time.Hour},
+	"contact_ip":      {Limit: 5, Window: 10 * time.Minute},
+	"order_create_ip": {Limit: 30, Window: 10 * time.Minute},
+	"public_write_ip": {Limit: 30, Window: 10 * time.Minute},
+	"payment_poll_ip": {Limit: 120, Window: time.Minute},
+	"payment_qr_ip":   {Limit: 20, Window: time.Minute},
+}
+
+// TrustedProxies danh sách proxy / load balancer được tin header X-Forwarded-For (TRUSTED_PROXIES, IP hoặc CIDR,
+// phân cách bằng dấu phẩy). Mặc định nil: IP client là địa chỉ kết nối thật, header do client gửi bị bỏ qua
+func TrustedProxies() []string {
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
+
+// RateLimitFor trả về giới hạn của nhóm route (Limit <= 0 = tắt giới hạn)
+func RateLimitFor(name string) RateLimitRule {
+	rule, ok := defaultRateLimits[name]
+	if !ok {
+		rule = RateLimitRule{Limit: 60, Window: time.Minute}
+	}
+
+	env := os.Getenv("RATE_LIMIT_" + strings.ToUpper(name))
+	if env == "" {
+		return rule
+	}
+	parsed, err := ParseRateLimitRule(env)
+	if err != nil {
+		log.Printf("⚠️ Invalid RATE_LIMIT_%s=%q: %v", strings.ToUpper(name), env, err)
+		return rule
+	}
+	return parsed
+}
+
+// ParseRateLimitRule đọc giới hạn dạng "số_request/thời_gian", vd "10/1m", "100/1h"; "off" = tắt
+func ParseRateLimitRule(s string) (RateLimitRule, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, "off") {
+		return RateLimitRule{}, nil
+	}
+
+	countStr, windowStr, found := strings.Cut(s, "/")
+	if !found {
+		return RateLimitRule{}, fmt.Errorf("expected format <count>/<duration>")
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(countStr))
+	if err != nil {
+		return RateLimitRule{}, err
+	}
+	window, err := time.ParseDuration(strings.TrimSpace(windowStr))
+	if err != nil {
+		return RateLimitRule{}, err
+	}
+	if window <= 0 {
+		return RateLimitRule{}, fmt.Errorf("window must be positive")
+	}
+	return RateLimitRule{Limit: limit, Window: window}, nil
+}
+
+// RateLimitBackend nơi lưu bộ đếm: redis (mặc định khi có REDIS_HOST) hoặc memory (RATE_LIMIT_BACKEND)
+func RateLimitBackend() string {
+	backend := strings.ToLower(os.Getenv("RATE_LIMIT_BACKEND"))
+	if backend == "" {
+		if os.Getenv("REDIS_HOST") != "" {
+			return "redis"
+		}
+		return "memory"
+	}
+	return backend
+}
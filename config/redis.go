@@ -0,0 +1,56 @@
+package config
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	redisOnce   sync.Once
+	redisClient *redis.Client
+)
+
+// GetRedis trả về Redis client (nil nếu chưa cấu hình REDIS_HOST hoặc không kết nối được)
+func GetRedis() *redis.Client {
+	redisOnce.Do(connectRedis)
+	return redisClient
+}
+
+// connectRedis kết nối Redis từ REDIS_HOST / REDIS_PORT / REDIS_PASSWORD / REDIS_DB
+func connectRedis() {
+	host := os.Getenv("REDIS_HOST")
+	if host == "" {
+		log.Println("⚠️ Redis not configured (REDIS_HOST not set)")
+		return
+	}
+
+	port := os.Getenv("REDIS_PORT")
+	if port == "" {
+		port = "6379"
+	}
+	db, _ := strconv.Atoi(os.Getenv("REDIS_DB"))
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     net.JoinHostPort(host, port),
+		Password: os.Getenv("REDIS_PASSWORD"),
+		DB:       db,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		log.Printf("❌ Failed to connect to Redis %s:%s: %v", host, port, err)
+		client.Close()
+		return
+	}
+
+	log.Printf("✅ Redis connected: %s:%s (db %d)", host, port, db)
+	redisClient = client
+}
@@ -0,0 +1,13 @@
+package config
+
+import (
+	"os"
+	"strconv"
+)
+
+// WebhookAllowPrivateTargets cho phép gửi webhook tới địa chỉ nội bộ (localhost, 10.x, 192.168.x...).
+// Mặc định tắt để không thể dùng webhook dò mạng nội bộ của server; bật khi phát triển (WEBHOOK_ALLOW_PRIVATE_TARGETS=true)
+func WebhookAllowPrivateTargets() bool {
+	allow, _ := strconv.ParseBool(os.Getenv("WEBHOOK_ALLOW_PRIVATE_TARGETS"))
+	return allow
+}
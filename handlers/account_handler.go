@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-api/config"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ===============================
+// REQUEST STRUCTS
+// ===============================
+
+// ForgotPasswordInput request body cho quên mật khẩu
+type ForgotPasswordInput struct {
+	Email string `json:"email" binding:"required,email"`
+	Lang  string `json:"lang"` // vi (mặc định), en
+}
+
+// ResetPasswordInput request body cho đặt lại mật khẩu
+type ResetPasswordInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+// VerifyEmailInput request body cho xác thực email
+type VerifyEmailInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ResendVerificationInput request body cho gửi lại email xác thực
+type ResendVerificationInput struct {
+	Lang string `json:"lang"` // vi (mặc định), en
+}
+
+// ===============================
+// HANDLERS
+// ===============================
+
+// ForgotPassword gửi link đặt lại mật khẩu qua email
+// @Summary Quên mật khẩu
+// @Description Gửi link đặt lại mật khẩu (hiệu lực 60 phút, dùng một lần). Luôn trả về thành công để không lộ email nào đã đăng ký
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body ForgotPasswordInput true "Email tài khoản"
+// @Success 200 {object} map[string]interface{}
+// @Router /auth/forgot-password [post]
+func ForgotPassword(c *gin.Context) {
+	var input ForgotPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	db := config.GetDB()
+
+	var user models.User
+	if err := db.Where("email = ?", strings.TrimSpace(input.Email)).First(&user).Error; err == nil && user.IsActive {
+		if err := services.SendPasswordResetEmail(db, user, mailLocale(c, input.Lang)); err != nil {
+			log.Printf("❌ Failed to send password reset email to user %d: %v", user.ID, err)
+		}
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, nil, "Nếu email đã đăng ký, bạn sẽ nhận được link đặt lại mật khẩu")
+}
+
+// ResetPassword đặt lại mật khẩu bằng token trong email
+// @Summary Đặt lại mật khẩu
+// @Description Đổi mật khẩu bằng token trong email và đăng xuất tài khoản khỏi mọi thiết bị
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body ResetPasswordInput true "Token và mật khẩu mới"
+// @Success 200 {object} map[string]interface{}
+// @Router /auth/reset-password [post]
+func ResetPassword(c *gin.Context) {
+	var input ResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi hệ thống", "HASH_ERROR", err.Error())
+		return
+	}
+
+	err = config.GetDB().Transaction(func(tx *gorm.DB) error {
+		token, err := services.ConsumeUserToken(tx, services.UserTokenPasswordReset, input.Token)
+		if err != nil {
+			return err
+		}
+
+		var user models.User
+		if err := tx.First(&user, token.UserID).Error; err != nil || !user.IsActive {
+			return fmt.Errorf("ACCOUNT_DISABLED: tài khoản không còn hoạt động")
+		}
+
+		// Nhận được email đặt lại mật khẩu cũng là xác thực email
+		updates := map[string]interface{}{
+			"password":           string(hashedPassword),
+			"failed_login_count": 0,
+			"locked_until":       nil,
+		}
+		if user.EmailVerifiedAt == nil {
+			updates["email_verified_at"] = time.Now()
+		}
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		_, err = services.RevokeUserRefreshTokens(tx, user.ID, services.RevokeReasonPasswordReset)
+		return err
+	})
+	if err != nil {
+		respondAccountTokenError(c, err, "Không thể đặt lại mật khẩu")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, nil, "Đặt lại mật khẩu thành công, vui lòng đăng nhập lại")
+}
+
+// VerifyEmail xác thực email bằng token trong email
+// @Summary Xác thực email
+// @Description Xác nhận địa chỉ email bằng token trong email xác thực
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body VerifyEmailInput true "Token xác thực"
+// @Success 200 {object} map[string]interface{}
+// @Router /auth/verify-email [post]
+func VerifyEmail(c *gin.Context) {
+	var input VerifyEmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	var verifiedAt time.Time
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		token, err := services.ConsumeUserToken(tx, services.UserTokenEmailVerify, input.Token)
+		if err != nil {
+			return err
+		}
+
+		verifiedAt = time.Now()
+		return tx.Model(&models.User{}).
+			Where("id = ? AND email_verified_at IS NULL", token.UserID).
+			Update("email_verified_at", verifiedAt).Error
+	})
+	if err != nil {
+		respondAccountTokenError(c, err, "Không thể xác thực email")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"email_verified":    true,
+		"email_verified_at": verifiedAt,
+	}, "Xác thực email thành công")
+}
+
+// ResendVerificationEmail gửi lại email xác thực
+// @Summary Gửi lại email xác thực
+// @Description Gửi lại link xác thực email (hiệu lực 24 giờ); link cũ mất hiệu lực
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body ResendVerificationInput false "Ngôn ngữ email"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /auth/resend-verification [post]
+func ResendVerificationEmail(c *gin.Context) {
+	var input ResendVerificationInput
+	_ = c.ShouldBindJSON(&input)
+
+	db := config.GetDB()
+
+	var user models.User
+	if err := db.First(&user, currentUserID(c)).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy người dùng", "USER_NOT_FOUND", "")
+		return
+	}
+
+	if user.EmailVerifiedAt != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Email đã được xác thực", "EMAIL_ALREADY_VERIFIED", "")
+		return
+	}
+
+	if err := services.SendVerificationEmail(db, user, mailLocale(c, input.Lang)); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể gửi email xác thực", "MAIL_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, nil, "Đã gửi lại email xác thực")
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// mailLocale ngôn ngữ email: ưu tiên tham số lang, sau đó header Accept-Language
+func mailLocale(c *gin.Context, lang string) string {
+	if lang == "" {
+		lang = c.GetHeader("Accept-Language")
+	}
+	return services.NormalizeMailLocale(lang)
+}
+
+// respondAccountTokenError trả lỗi token (hết hạn, đã dùng...) hoặc lỗi hệ thống
+func respondAccountTokenError(c *gin.Context, err error, message string) {
+	code, msg, _ := strings.Cut(err.Error(), ": ")
+	switch code {
+	case "INVALID_TOKEN", "TOKEN_USED", "TOKEN_EXPIRED":
+		utils.ErrorResponse(c, http.StatusBadRequest, "Link không hợp lệ hoặc đã hết hạn", code, msg)
+	case "ACCOUNT_DISABLED":
+		utils.ErrorResponse(c, http.StatusForbidden, "Tài khoản đã bị vô hiệu hóa", code, msg)
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, message, "UPDATE_ERROR", err.Error())
+	}
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/config"
+	"go-api/middleware"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===============================
+// REQUEST STRUCTS
+// ===============================
+
+// CreateAPIKeyInput request body cho tạo API key
+type CreateAPIKeyInput struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"` // menu.read, menu.write, tables.read, orders.read, orders.write, payments.write, stats.read, print.agent
+	ExpiresInDays *int     `json:"expires_in_days"`                 // Không truyền = không hết hạn
+}
+
+// ===============================
+// API KEY HANDLERS
+// ===============================
+
+// GetAPIKeys lấy danh sách API key của nhà hàng
+// @Summary Danh sách API key
+// @Description Lấy các API key của nhà hàng (chỉ hiển thị prefix) và danh sách scope có thể cấp
+// @Tags API Keys
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/api-keys [get]
+func GetAPIKeys(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem API key của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var keys []models.APIKey
+	if err := config.GetDB().Where("restaurant_id = ?", restaurantID).
+		Order("created_at DESC").
+		Find(&keys).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy API key", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	items := make([]gin.H, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, apiKeyResponse(key))
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"api_keys":         items,
+		"available_scopes": availableAPIKeyScopes(),
+	}, "")
+}
+
+// CreateAPIKey tạo API key mới cho nhà hàng
+// @Summary Tạo API key
+// @Description Tạo API key có phạm vi giới hạn cho POS / tích hợp. Key gốc chỉ trả về một lần, hệ thống chỉ lưu hash
+// @Tags API Keys
+// @Accept json
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param body body CreateAPIKeyInput true "Thông tin API key"
+// @Success 201 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/api-keys [post]
+func CreateAPIKey(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền tạo API key cho nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var input CreateAPIKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	// Chuẩn hóa và loại trùng scope
+	scopes := []string{}
+	seen := map[string]bool{}
+	for _, scope := range input.Scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !middleware.IsValidAPIKeyScope(scope) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Scope không hợp lệ", "INVALID_SCOPE", scope)
+			return
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	var expiresAt *time.Time
+	if input.ExpiresInDays != nil {
+		if *input.ExpiresInDays < 1 || *input.ExpiresInDays > 3650 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Thời hạn phải từ 1 đến 3650 ngày", "VALIDATION_ERROR", "")
+			return
+		}
+		t := time.Now().AddDate(0, 0, *input.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	raw, prefix, hash, err := services.GenerateAPIKey()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo API key", "KEY_ERROR", err.Error())
+		return
+	}
+
+	createdBy := currentUserID(c)
+	key := models.APIKey{
+		RestaurantID: uint(restaurantID),
+		Name:         strings.TrimSpace(input.Name),
+		Prefix:       prefix,
+		KeyHash:      hash,
+		Scopes:       strings.Join(scopes, ","),
+		CreatedBy:    &createdBy,
+		ExpiresAt:    expiresAt,
+	}
+	if err := config.GetDB().Create(&key).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo API key", "CREATE_ERROR", err.Error())
+		return
+	}
+
+	response := apiKeyResponse(key)
+	response["key"] = raw
+
+	utils.SuccessResponse(c, http.StatusCreated, response, "Tạo API key thành công, hãy lưu lại key vì sẽ không hiển thị lại")
+}
+
+// RevokeAPIKey thu hồi API key
+// @Summary Thu hồi API key
+// @Description Thu hồi API key, các request dùng key này sẽ bị từ chối ngay
+// @Tags API Keys
+// @Produce json
+// @Param id path int true "API Key ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /api-keys/{id} [delete]
+func RevokeAPIKey(c *gin.Context) {
+	keyID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	db := config.GetDB()
+
+	var key models.APIKey
+	if err := db.First(&key, keyID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy API key", "API_KEY_NOT_FOUND", "")
+		return
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || key.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền thu hồi API key này", "FORBIDDEN", "")
+		return
+	}
+
+	if key.RevokedAt != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "API key đã bị thu hồi", "API_KEY_REVOKED", "")
+		return
+	}
+
+	now := time.Now()
+	if err := db.Model(&key).Update("revoked_at", now).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể thu hồi API key", "UPDATE_ERROR", err.Error())
+		return
+	}
+	key.RevokedAt = &now
+
+	utils.SuccessResponse(c, http.StatusOK, apiKeyResponse(key), "Thu hồi API key thành công")
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// apiKeyResponse thông tin API key trả về client (không bao giờ kèm hash)
+func apiKeyResponse(key models.APIKey) gin.H {
+	status := "active"
+	switch {
+	case key.RevokedAt != nil:
+		status = "revoked"
+	case key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt):
+		status = "expired"
+	}
+
+	return gin.H{
+		"id":           key.ID,
+		"name":         key.Name,
+		"prefix":       key.Prefix,
+		"scopes":       services.APIKeyScopes(key),
+		"status":       status,
+		"created_by":   key.CreatedBy,
+		"last_used_at": key.LastUsedAt,
+		"last_used_ip": key.LastUsedIP,
+		"expires_at":   key.ExpiresAt,
+		"revoked_at":   key.RevokedAt,
+		"created_at":   key.CreatedAt,
+	}
+}
+
+// availableAPIKeyScopes danh sách scope có thể cấp (sắp xếp cố định)
+func availableAPIKeyScopes() []string {
+	scopes := make([]string, 0, len(middleware.APIKeyScopePermissions))
+	for scope := range middleware.APIKeyScopePermissions {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
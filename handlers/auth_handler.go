@@ -2,12 +2,16 @@ package handlers
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"go-api/config"
 	"go-api/middleware"
 	"go-api/models"
+	"go-api/services"
 	"go-api/utils"
 
 	"github.com/gin-gonic/gin"
@@ -32,6 +36,17 @@ type RegisterInput struct {
 	Phone          string `json:"phone"`
 	RestaurantName string `json:"restaurant_name" binding:"required"`
 	PackageID      uint   `json:"package_id" binding:"required"`
+	Lang           string `json:"lang"` // Ngôn ngữ email xác thực: vi (mặc định), en
+}
+
+// RefreshTokenInput request body cho làm mới token
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// LogoutInput request body cho đăng xuất
+type LogoutInput struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
 // ===============================
@@ -40,7 +55,7 @@ type RegisterInput struct {
 
 // Login đăng nhập
 // @Summary Đăng nhập
-// @Description Đăng nhập bằng email và password để lấy JWT token
+// @Description Đăng nhập bằng email và password để lấy JWT token. Tài khoản bật xác thực 2 bước nhận mfa_token để gọi /auth/mfa/verify
 // @Tags Auth
 // @Accept json
 // @Produce json
@@ -67,44 +82,41 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// Kiểm tra password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-		utils.ErrorResponse(c, http.StatusUnauthorized, "Email hoặc mật khẩu không đúng", "INVALID_CREDENTIALS", "")
+	// Đang bị khóa tạm thời do sai nhiều lần
+	if remaining := services.LoginLockRemaining(user); remaining > 0 {
+		respondAccountLocked(c, remaining)
 		return
 	}
 
-	// Lấy restaurant_id nếu là restaurant
-	var restaurantID *uint
-	if user.Role == "restaurant" {
-		var restaurant models.Restaurant
-		if err := config.GetDB().Where("owner_id = ?", user.ID).First(&restaurant).Error; err == nil {
-			restaurantID = &restaurant.ID
+	// Kiểm tra password
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		if lock, _ := services.RecordFailedLogin(config.GetDB(), user.ID); lock > 0 {
+			respondAccountLocked(c, lock)
+			return
 		}
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Email hoặc mật khẩu không đúng", "INVALID_CREDENTIALS", "")
+		return
 	}
 
-	// Tạo JWT token
-	token, err := middleware.GenerateToken(user.ID, user.Email, user.Role, restaurantID)
+	// Xác định nhà hàng (chủ: nhà hàng chính, nhân viên: nhà hàng được mời vào)
+	restaurantID, staffRole, err := resolveSessionRestaurant(user, nil)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo token", "TOKEN_ERROR", err.Error())
+		code, msg, _ := strings.Cut(err.Error(), ": ")
+		utils.ErrorResponse(c, http.StatusUnauthorized, msg, code, "")
 		return
 	}
 
-	// Cập nhật last_login
-	now := time.Now()
-	config.GetDB().Model(&user).Update("last_login", now)
+	// Xác thực 2 bước: đã bật thì chờ nhập mã, role bắt buộc mà chưa bật thì chờ thiết lập
+	if services.IsMFAEnabled(config.GetDB(), user.ID) {
+		respondMFAChallenge(c, user, middleware.MFAPurposeVerify)
+		return
+	}
+	if config.IsMFARequired(user.Role) {
+		respondMFAChallenge(c, user, middleware.MFAPurposeEnroll)
+		return
+	}
 
-	utils.SuccessResponse(c, http.StatusOK, gin.H{
-		"user": gin.H{
-			"id":     user.ID,
-			"email":  user.Email,
-			"name":   user.Name,
-			"role":   user.Role,
-			"avatar": user.Avatar,
-		},
-		"restaurant_id": restaurantID,
-		"access_token":  token,
-		"expires_in":    86400,
-	}, "Đăng nhập thành công")
+	completeLogin(c, user, restaurantID, staffRole, nil)
 }
 
 // Register đăng ký nhà hàng mới
@@ -199,12 +211,18 @@ func Register(c *gin.Context) {
 	// Commit transaction
 	tx.Commit()
 
+	// Gửi email xác thực
+	if err := services.SendVerificationEmail(db, user, mailLocale(c, input.Lang)); err != nil {
+		log.Printf("❌ Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
 	utils.SuccessResponse(c, http.StatusCreated, gin.H{
 		"user": gin.H{
-			"id":    user.ID,
-			"email": user.Email,
-			"name":  user.Name,
-			"role":  user.Role,
+			"id":             user.ID,
+			"email":          user.Email,
+			"name":           user.Name,
+			"role":           user.Role,
+			"email_verified": false,
 		},
 		"restaurant": gin.H{
 			"id":   restaurant.ID,
@@ -216,19 +234,128 @@ func Register(c *gin.Context) {
 
 // Logout đăng xuất
 // @Summary Đăng xuất
-// @Description Đăng xuất khỏi hệ thống
+// @Description Thu hồi refresh token của phiên hiện tại (access token hết hạn sau tối đa 15 phút)
 // @Tags Auth
 // @Accept json
 // @Produce json
+// @Param body body LogoutInput false "Refresh token của phiên (không bắt buộc)"
 // @Success 200 {object} map[string]interface{}
 // @Security BearerAuth
 // @Router /auth/logout [post]
 func Logout(c *gin.Context) {
-	// Với JWT stateless, logout chỉ cần xóa token ở client
-	// Có thể implement blacklist token nếu cần
+	var input LogoutInput
+	_ = c.ShouldBindJSON(&input)
+
+	db := config.GetDB()
+	userID := currentUserID(c)
+
+	familyID := ""
+	if claims, exists := c.Get("claims"); exists {
+		familyID = claims.(*middleware.Claims).SessionID
+	}
+	if input.RefreshToken != "" {
+		if token, err := services.FindRefreshToken(db, input.RefreshToken); err == nil && token.UserID == userID {
+			familyID = token.FamilyID
+		}
+	}
+
+	if familyID != "" {
+		if _, err := services.RevokeRefreshFamily(db, familyID, services.RevokeReasonLogout); err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể đăng xuất", "REVOKE_ERROR", err.Error())
+			return
+		}
+	}
+
 	utils.SuccessResponse(c, http.StatusOK, nil, "Đăng xuất thành công")
 }
 
+// LogoutAll đăng xuất khỏi tất cả thiết bị
+// @Summary Đăng xuất tất cả thiết bị
+// @Description Thu hồi mọi refresh token của tài khoản
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /auth/logout-all [post]
+func LogoutAll(c *gin.Context) {
+	revoked, err := services.RevokeUserRefreshTokens(config.GetDB(), currentUserID(c), services.RevokeReasonLogoutAll)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể đăng xuất", "REVOKE_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"revoked_sessions": revoked,
+	}, "Đã đăng xuất khỏi tất cả thiết bị")
+}
+
+// GetSessions danh sách phiên đăng nhập đang hoạt động
+// @Summary Phiên đăng nhập
+// @Description Các thiết bị đang đăng nhập (refresh token còn hiệu lực) của tài khoản
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /auth/sessions [get]
+func GetSessions(c *gin.Context) {
+	currentFamilyID := ""
+	if claims, exists := c.Get("claims"); exists {
+		currentFamilyID = claims.(*middleware.Claims).SessionID
+	}
+
+	var tokens []models.RefreshToken
+	if err := config.GetDB().
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", currentUserID(c), time.Now()).
+		Order("created_at DESC").
+		Find(&tokens).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy phiên đăng nhập", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	result := make([]gin.H, 0, len(tokens))
+	for _, t := range tokens {
+		result = append(result, gin.H{
+			"session_id":    t.FamilyID,
+			"restaurant_id": t.RestaurantID,
+			"user_agent":    t.UserAgent,
+			"ip_address":    t.IPAddress,
+			"last_used_at":  t.CreatedAt,
+			"expires_at":    t.ExpiresAt,
+			"is_current":    t.FamilyID == currentFamilyID,
+		})
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, result, "")
+}
+
+// RevokeSession đăng xuất một thiết bị
+// @Summary Thu hồi phiên đăng nhập
+// @Description Đăng xuất một thiết bị cụ thể theo session_id
+// @Tags Auth
+// @Produce json
+// @Param sessionId path string true "Session ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /auth/sessions/{sessionId} [delete]
+func RevokeSession(c *gin.Context) {
+	db := config.GetDB()
+	familyID := c.Param("sessionId")
+
+	var count int64
+	db.Model(&models.RefreshToken{}).Where("family_id = ? AND user_id = ?", familyID, currentUserID(c)).Count(&count)
+	if count == 0 {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy phiên đăng nhập", "SESSION_NOT_FOUND", "")
+		return
+	}
+
+	if _, err := services.RevokeRefreshFamily(db, familyID, services.RevokeReasonLogout); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể thu hồi phiên đăng nhập", "REVOKE_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, nil, "Đã đăng xuất thiết bị")
+}
+
 // GetMe lấy thông tin user hiện tại
 // @Summary Lấy thông tin user
 // @Description Lấy thông tin user đang đăng nhập
@@ -254,19 +381,54 @@ func GetMe(c *gin.Context) {
 		"role":   user.Role,
 		"avatar": user.Avatar,
 		"phone":  user.Phone,
+
+		"email_verified":    user.EmailVerifiedAt != nil,
+		"email_verified_at": user.EmailVerifiedAt,
 	}
 
-	// Nếu là restaurant, thêm thông tin nhà hàng
+	// Nếu là restaurant, thêm thông tin nhà hàng đang làm việc và danh sách chi nhánh
 	if user.Role == "restaurant" {
-		var restaurant models.Restaurant
-		if err := config.GetDB().Where("owner_id = ?", user.ID).First(&restaurant).Error; err == nil {
-			response["restaurant"] = gin.H{
-				"id":   restaurant.ID,
-				"name": restaurant.Name,
-				"slug": restaurant.Slug,
+		currentRestaurantID, _ := c.Get("restaurant_id")
+
+		var restaurants []models.Restaurant
+		config.GetDB().Where("owner_id = ?", user.ID).Order("parent_id IS NOT NULL, id ASC").Find(&restaurants)
+
+		branches := make([]gin.H, 0, len(restaurants))
+		for _, r := range restaurants {
+			branches = append(branches, gin.H{
+				"id":           r.ID,
+				"display_name": restaurantDisplayName(r),
+				"slug":         r.Slug,
+				"is_main":      r.ParentID == nil,
+			})
+			if currentRestaurantID != nil && currentRestaurantID.(*uint) != nil && *currentRestaurantID.(*uint) == r.ID {
+				response["restaurant"] = gin.H{
+					"id":          r.ID,
+					"name":        r.Name,
+					"slug":        r.Slug,
+					"parent_id":   r.ParentID,
+					"branch_name": r.BranchName,
+				}
+			}
+		}
+		response["branches"] = branches
+	}
+
+	// Nếu là nhân viên, thêm nhà hàng, vai trò và quyền
+	if user.Role == "staff" {
+		var staff models.StaffMember
+		if err := config.GetDB().Preload("Restaurant").Where("user_id = ?", user.ID).First(&staff).Error; err == nil {
+			response["staff_role"] = staff.Role
+			if staff.Restaurant != nil {
+				response["restaurant"] = gin.H{
+					"id":   staff.Restaurant.ID,
+					"name": staff.Restaurant.Name,
+					"slug": staff.Restaurant.Slug,
+				}
 			}
 		}
 	}
+	response["permissions"] = middleware.PermissionsOf(c)
 
 	utils.SuccessResponse(c, http.StatusOK, response, "")
 }
@@ -316,31 +478,176 @@ func CheckEmail(c *gin.Context) {
 
 // RefreshToken làm mới token
 // @Summary Làm mới token
-// @Description Lấy token mới từ token hiện tại
+// @Description Đổi refresh token lấy access token mới. Refresh token được xoay mỗi lần dùng; dùng lại token cũ sẽ thu hồi cả phiên đăng nhập
 // @Tags Auth
 // @Accept json
 // @Produce json
+// @Param body body RefreshTokenInput true "Refresh token"
 // @Success 200 {object} map[string]interface{}
-// @Security BearerAuth
 // @Router /auth/refresh [post]
 func RefreshToken(c *gin.Context) {
-	claims, exists := c.Get("claims")
-	if !exists {
-		utils.ErrorResponse(c, http.StatusUnauthorized, "Token không hợp lệ", "INVALID_TOKEN", "")
+	var input RefreshTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
 		return
 	}
 
-	claimsData := claims.(*middleware.Claims)
+	db := config.GetDB()
 
-	// Tạo token mới
-	token, err := middleware.GenerateToken(claimsData.UserID, claimsData.Email, claimsData.Role, claimsData.RestaurantID)
+	rawToken, token, err := services.RotateRefreshToken(db, input.RefreshToken, refreshClient(c))
+	if err != nil {
+		code, msg, found := strings.Cut(err.Error(), ": ")
+		if !found {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể làm mới token", "TOKEN_ERROR", err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Phiên đăng nhập không hợp lệ, vui lòng đăng nhập lại", code, msg)
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, token.UserID).Error; err != nil || !user.IsActive {
+		services.RevokeRefreshFamily(db, token.FamilyID, services.RevokeReasonLogout)
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Tài khoản đã bị vô hiệu hóa", "ACCOUNT_DISABLED", "")
+		return
+	}
+
+	// Role bắt buộc 2FA (vd admin) phải thiết lập xong mới được tiếp tục phiên cũ
+	if config.IsMFARequired(user.Role) && !services.IsMFAEnabled(db, user.ID) {
+		services.RevokeRefreshFamily(db, token.FamilyID, services.RevokeReasonLogout)
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Vui lòng đăng nhập lại để thiết lập xác thực 2 bước", "MFA_ENROLLMENT_REQUIRED", "")
+		return
+	}
+
+	// Giữ nguyên chi nhánh đang làm việc của phiên (nếu vẫn còn quyền)
+	restaurantID, staffRole, err := resolveSessionRestaurant(user, token.RestaurantID)
+	if err != nil {
+		services.RevokeRefreshFamily(db, token.FamilyID, services.RevokeReasonLogout)
+		code, msg, _ := strings.Cut(err.Error(), ": ")
+		utils.ErrorResponse(c, http.StatusUnauthorized, msg, code, "")
+		return
+	}
+
+	accessToken, err := middleware.GenerateToken(user.ID, user.Email, user.Role, restaurantID, staffRole, token.FamilyID)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo token", "TOKEN_ERROR", err.Error())
 		return
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, gin.H{
-		"access_token": token,
-		"expires_in":   86400,
+		"access_token":       accessToken,
+		"expires_in":         int(middleware.AccessTokenTTL.Seconds()),
+		"refresh_token":      rawToken,
+		"refresh_expires_in": int(services.RefreshTokenTTL.Seconds()),
+		"restaurant_id":      restaurantID,
+		"staff_role":         staffRole,
 	}, "Token đã được làm mới")
 }
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// resolveSessionRestaurant xác định nhà hàng và vai trò nhân viên cho phiên đăng nhập.
+// preferred: chi nhánh phiên đang dùng (chỉ áp dụng cho chủ nhà hàng nếu vẫn sở hữu)
+func resolveSessionRestaurant(user models.User, preferred *uint) (*uint, string, error) {
+	db := config.GetDB()
+
+	switch user.Role {
+	case "restaurant":
+		var restaurant models.Restaurant
+		if preferred != nil {
+			if err := db.Where("id = ? AND owner_id = ?", *preferred, user.ID).First(&restaurant).Error; err == nil {
+				return &restaurant.ID, "", nil
+			}
+		}
+		// Mặc định vào nhà hàng chính của chuỗi
+		if err := db.Where("owner_id = ?", user.ID).Order("parent_id IS NOT NULL, id ASC").First(&restaurant).Error; err == nil {
+			return &restaurant.ID, "", nil
+		}
+		return nil, "", nil
+
+	case "staff":
+		// Nhân viên: lấy nhà hàng và vai trò từ staff_members
+		var staff models.StaffMember
+		if err := db.Where("user_id = ?", user.ID).First(&staff).Error; err != nil {
+			return nil, "", fmt.Errorf("ACCOUNT_DISABLED: Tài khoản nhân viên không thuộc nhà hàng nào")
+		}
+		switch staff.Status {
+		case "invited":
+			return nil, "", fmt.Errorf("INVITE_PENDING: Vui lòng chấp nhận lời mời trước khi đăng nhập")
+		case "disabled":
+			return nil, "", fmt.Errorf("ACCOUNT_DISABLED: Tài khoản đã bị vô hiệu hóa")
+		}
+		return &staff.RestaurantID, staff.Role, nil
+	}
+
+	return nil, "", nil
+}
+
+// completeLogin tạo phiên đăng nhập và trả về token (sau mật khẩu / sau xác thực 2 bước)
+func completeLogin(c *gin.Context, user models.User, restaurantID *uint, staffRole string, extra gin.H) {
+	// Tạo access token + refresh token (phiên đăng nhập mới)
+	session, err := startSession(c, user, restaurantID, staffRole)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo token", "TOKEN_ERROR", err.Error())
+		return
+	}
+
+	// Cập nhật last_login, xóa bộ đếm đăng nhập sai
+	now := time.Now()
+	config.GetDB().Model(&user).Update("last_login", now)
+	services.ResetFailedLogins(config.GetDB(), user)
+
+	session["user"] = gin.H{
+		"id":     user.ID,
+		"email":  user.Email,
+		"name":   user.Name,
+		"role":   user.Role,
+		"avatar": user.Avatar,
+	}
+	session["restaurant_id"] = restaurantID
+	session["staff_role"] = staffRole
+	for k, v := range extra {
+		session[k] = v
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, session, "Đăng nhập thành công")
+}
+
+// respondAccountLocked trả 429 kèm Retry-After khi tài khoản bị khóa tạm thời
+func respondAccountLocked(c *gin.Context, remaining time.Duration) {
+	retryAfter := middleware.RetryAfterSeconds(remaining)
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	utils.ErrorResponse(c, http.StatusTooManyRequests,
+		fmt.Sprintf("Đăng nhập sai quá nhiều lần, vui lòng thử lại sau %d giây", retryAfter),
+		"ACCOUNT_LOCKED", "")
+}
+
+// startSession tạo phiên đăng nhập mới: access token + refresh token (family mới)
+func startSession(c *gin.Context, user models.User, restaurantID *uint, staffRole string) (gin.H, error) {
+	rawToken, token, err := services.IssueRefreshToken(config.GetDB(), user.ID, restaurantID, "", refreshClient(c))
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := middleware.GenerateToken(user.ID, user.Email, user.Role, restaurantID, staffRole, token.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"access_token":       accessToken,
+		"expires_in":         int(middleware.AccessTokenTTL.Seconds()),
+		"refresh_token":      rawToken,
+		"refresh_expires_in": int(services.RefreshTokenTTL.Seconds()),
+	}, nil
+}
+
+// refreshClient thông tin thiết bị từ request
+func refreshClient(c *gin.Context) services.RefreshClient {
+	return services.RefreshClient{
+		UserAgent: c.GetHeader("User-Agent"),
+		IPAddress: c.ClientIP(),
+	}
+}
@@ -0,0 +1,514 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-api/config"
+	"go-api/middleware"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ===============================
+// REQUEST STRUCTS
+// ===============================
+
+// CreateBranchInput request body cho tạo chi nhánh
+type CreateBranchInput struct {
+	BranchName string `json:"branch_name" binding:"required"`
+	Address    string `json:"address"`
+	Phone      string `json:"phone"`
+	CopyMenu   *bool  `json:"copy_menu"` // Mặc định true: sao chép thực đơn từ nhà hàng chính
+}
+
+// SwitchRestaurantInput request body cho đổi chi nhánh đang làm việc
+type SwitchRestaurantInput struct {
+	RestaurantID uint `json:"restaurant_id" binding:"required"`
+}
+
+// ===============================
+// HANDLERS
+// ===============================
+
+// GetBranches lấy danh sách chi nhánh của chuỗi
+// @Summary Danh sách chi nhánh
+// @Description Lấy nhà hàng chính và các chi nhánh của chủ nhà hàng đang đăng nhập
+// @Tags Branches
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/branches [get]
+func GetBranches(c *gin.Context) {
+	main, ok := loadOwnerChain(c)
+	if !ok {
+		return
+	}
+
+	branches, err := chainRestaurants(config.GetDB(), main.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy danh sách chi nhánh", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	result := make([]gin.H, 0, len(branches))
+	for _, b := range branches {
+		item := branchResponse(b)
+		item["is_current"] = currentRestaurantID != nil && *currentRestaurantID.(*uint) == b.ID
+		result = append(result, item)
+	}
+
+	maxBranches := 1
+	if main.Package != nil {
+		maxBranches = main.Package.MaxBranches
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"main_restaurant_id": main.ID,
+		"max_branches":       maxBranches,
+		"branches":           result,
+	}, "")
+}
+
+// CreateBranch tạo chi nhánh mới
+// @Summary Tạo chi nhánh
+// @Description Tạo chi nhánh dùng chung gói dịch vụ với nhà hàng chính; bàn, giá bán, cài đặt thanh toán và thống kê tách riêng
+// @Tags Branches
+// @Accept json
+// @Produce json
+// @Param body body CreateBranchInput true "Thông tin chi nhánh"
+// @Success 201 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/branches [post]
+func CreateBranch(c *gin.Context) {
+	var input CreateBranchInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	main, ok := loadOwnerChain(c)
+	if !ok {
+		return
+	}
+
+	db := config.GetDB()
+
+	// Kiểm tra giới hạn chi nhánh theo package (tính cả nhà hàng chính)
+	var branchCount int64
+	db.Model(&models.Restaurant{}).Where("id = ? OR parent_id = ?", main.ID, main.ID).Count(&branchCount)
+	if main.Package != nil && main.Package.MaxBranches != -1 && int(branchCount) >= main.Package.MaxBranches {
+		utils.ErrorResponse(c, http.StatusForbidden, "Đã đạt giới hạn số chi nhánh của gói dịch vụ", "BRANCH_LIMIT_EXCEEDED", "")
+		return
+	}
+
+	// Slug = tên nhà hàng + tên chi nhánh, thêm số nếu trùng
+	slug := utils.GenerateSlug(main.Name + " " + input.BranchName)
+	var count int64
+	db.Model(&models.Restaurant{}).Where("slug LIKE ?", slug+"%").Count(&count)
+	if count > 0 {
+		slug = fmt.Sprintf("%s-%d", slug, count+1)
+	}
+
+	branch := models.Restaurant{
+		OwnerID:          main.OwnerID,
+		PackageID:        main.PackageID,
+		ParentID:         &main.ID,
+		BranchName:       &input.BranchName,
+		Name:             main.Name,
+		Slug:             slug,
+		Description:      main.Description,
+		Logo:             main.Logo,
+		Email:            main.Email,
+		IsOpen:           true,
+		TaxRate:          main.TaxRate,
+		ServiceCharge:    main.ServiceCharge,
+		Currency:         main.Currency,
+		PackageStartDate: main.PackageStartDate,
+		PackageEndDate:   main.PackageEndDate,
+		PackageStatus:    main.PackageStatus,
+		Status:           "active",
+	}
+	if input.Address != "" {
+		branch.Address = &input.Address
+	}
+	if input.Phone != "" {
+		branch.Phone = &input.Phone
+	} else {
+		branch.Phone = main.Phone
+	}
+
+	copyMenu := input.CopyMenu == nil || *input.CopyMenu
+	var syncResult services.MenuSyncResult
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&branch).Error; err != nil {
+			return err
+		}
+		if !copyMenu {
+			return nil
+		}
+		var err error
+		syncResult, err = services.SyncBranchMenu(tx, main.ID, branch.ID)
+		return err
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo chi nhánh", "CREATE_ERROR", err.Error())
+		return
+	}
+
+	response := branchResponse(branch)
+	if copyMenu {
+		response["menu_sync"] = syncResult
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, response, "Tạo chi nhánh thành công")
+}
+
+// SyncBranchMenu đồng bộ thực đơn từ nhà hàng chính xuống chi nhánh
+// @Summary Đồng bộ thực đơn chi nhánh
+// @Description Thêm danh mục / món mới và cập nhật tên, mô tả, ảnh, tùy chọn theo nhà hàng chính. Giá bán và trạng thái món của chi nhánh được giữ nguyên
+// @Tags Branches
+// @Produce json
+// @Param id path int true "Restaurant ID (chi nhánh)"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/menu/sync-template [post]
+func SyncBranchMenu(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền cập nhật thực đơn của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	db := config.GetDB()
+
+	var branch models.Restaurant
+	if err := db.First(&branch, restaurantID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy nhà hàng", "RESTAURANT_NOT_FOUND", "")
+		return
+	}
+
+	if branch.ParentID == nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Nhà hàng chính không có thực đơn mẫu để đồng bộ", "NOT_A_BRANCH", "")
+		return
+	}
+
+	var result services.MenuSyncResult
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = services.SyncBranchMenu(tx, *branch.ParentID, branch.ID)
+		return err
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể đồng bộ thực đơn", "SYNC_ERROR", err.Error())
+		return
+	}
+
+	services.PublishMenuUpdated(branch.ID, "synced", nil)
+
+	utils.SuccessResponse(c, http.StatusOK, result, "Đã đồng bộ thực đơn từ nhà hàng chính")
+}
+
+// SwitchRestaurant đổi chi nhánh đang làm việc (cấp lại token)
+// @Summary Đổi chi nhánh
+// @Description Cấp token mới gắn với chi nhánh được chọn; các API theo nhà hàng sẽ dùng chi nhánh này
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body SwitchRestaurantInput true "Chi nhánh cần chuyển tới"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /auth/switch-restaurant [post]
+func SwitchRestaurant(c *gin.Context) {
+	var input SwitchRestaurantInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	claims, exists := c.Get("claims")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Token không hợp lệ", "INVALID_TOKEN", "")
+		return
+	}
+	claimsData := claims.(*middleware.Claims)
+
+	// Chỉ chủ chuỗi được đổi chi nhánh, nhân viên gắn cố định với một nhà hàng
+	if claimsData.Role != "restaurant" {
+		utils.ErrorResponse(c, http.StatusForbidden, "Chỉ chủ nhà hàng mới được đổi chi nhánh", "FORBIDDEN", "")
+		return
+	}
+
+	var restaurant models.Restaurant
+	if err := config.GetDB().First(&restaurant, input.RestaurantID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy nhà hàng", "RESTAURANT_NOT_FOUND", "")
+		return
+	}
+
+	if restaurant.OwnerID != claimsData.UserID {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không sở hữu chi nhánh này", "FORBIDDEN", "")
+		return
+	}
+
+	// Lần refresh sau của phiên vẫn giữ chi nhánh vừa chọn
+	if claimsData.SessionID != "" {
+		config.GetDB().Model(&models.RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL", claimsData.SessionID).
+			Update("restaurant_id", restaurant.ID)
+	}
+
+	token, err := middleware.GenerateToken(claimsData.UserID, claimsData.Email, claimsData.Role, &restaurant.ID, "", claimsData.SessionID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo token", "TOKEN_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"restaurant":    branchResponse(restaurant),
+		"restaurant_id": restaurant.ID,
+		"access_token":  token,
+		"expires_in":    int(middleware.AccessTokenTTL.Seconds()),
+	}, "Đã chuyển sang "+restaurantDisplayName(restaurant))
+}
+
+// GetBranchesDashboard thống kê tổng hợp tất cả chi nhánh
+// @Summary Dashboard chuỗi nhà hàng
+// @Description Doanh thu, số đơn, đơn đang mở và bàn đang phục vụ của từng chi nhánh cùng tổng của cả chuỗi
+// @Tags Branches
+// @Produce json
+// @Param start_date query string false "Ngày bắt đầu (YYYY-MM-DD), mặc định hôm nay"
+// @Param end_date query string false "Ngày kết thúc (YYYY-MM-DD), mặc định hôm nay"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/branches/dashboard [get]
+func GetBranchesDashboard(c *gin.Context) {
+	main, ok := loadOwnerChain(c)
+	if !ok {
+		return
+	}
+
+	db := config.GetDB()
+
+	startDate := c.Query("start_date")
+	endDate := c.Query("end_date")
+	if startDate == "" {
+		startDate = time.Now().Format("2006-01-02")
+	}
+	if endDate == "" {
+		endDate = time.Now().Format("2006-01-02")
+	}
+
+	branches, err := chainRestaurants(db, main.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy danh sách chi nhánh", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	ids := make([]uint, 0, len(branches))
+	for _, b := range branches {
+		ids = append(ids, b.ID)
+	}
+
+	// Doanh thu & số đơn đã thanh toán theo chi nhánh
+	var revenueRows []struct {
+		RestaurantID uint
+		Revenue      float64
+		Orders       int64
+	}
+	db.Model(&models.Order{}).
+		Select("restaurant_id, COALESCE(SUM(total_amount), 0) as revenue, COUNT(*) as orders").
+		Where("restaurant_id IN ? AND DATE(created_at) >= ? AND DATE(created_at) <= ? AND payment_status = ?", ids, startDate, endDate, "paid").
+		Group("restaurant_id").
+		Scan(&revenueRows)
+
+	// Đơn đang mở theo chi nhánh
+	var openRows []struct {
+		RestaurantID uint
+		Count        int64
+	}
+	db.Model(&models.Order{}).
+		Select("restaurant_id, COUNT(*) as count").
+		Where("restaurant_id IN ? AND status IN ?", ids, openOrderStatuses).
+		Group("restaurant_id").
+		Scan(&openRows)
+
+	// Bàn đang có khách theo chi nhánh
+	var tableRows []struct {
+		RestaurantID uint
+		Total        int64
+		Occupied     int64
+	}
+	db.Model(&models.Table{}).
+		Select("restaurant_id, COUNT(*) as total, COUNT(*) FILTER (WHERE status = 'occupied') as occupied").
+		Where("restaurant_id IN ? AND is_active = ?", ids, true).
+		Group("restaurant_id").
+		Scan(&tableRows)
+
+	type branchStats struct {
+		revenue  float64
+		orders   int64
+		open     int64
+		tables   int64
+		occupied int64
+	}
+	stats := make(map[uint]*branchStats, len(ids))
+	for _, id := range ids {
+		stats[id] = &branchStats{}
+	}
+	for _, r := range revenueRows {
+		if s, ok := stats[r.RestaurantID]; ok {
+			s.revenue, s.orders = r.Revenue, r.Orders
+		}
+	}
+	for _, r := range openRows {
+		if s, ok := stats[r.RestaurantID]; ok {
+			s.open = r.Count
+		}
+	}
+	for _, r := range tableRows {
+		if s, ok := stats[r.RestaurantID]; ok {
+			s.tables, s.occupied = r.Total, r.Occupied
+		}
+	}
+
+	var totalRevenue float64
+	var totalOrders, totalOpen, totalTables, totalOccupied int64
+	result := make([]gin.H, 0, len(branches))
+	for _, b := range branches {
+		s := stats[b.ID]
+		avgOrderValue := float64(0)
+		if s.orders > 0 {
+			avgOrderValue = s.revenue / float64(s.orders)
+		}
+
+		item := branchResponse(b)
+		item["revenue"] = s.revenue
+		item["orders"] = s.orders
+		item["avg_order_value"] = avgOrderValue
+		item["open_orders"] = s.open
+		item["tables"] = gin.H{
+			"total":    s.tables,
+			"occupied": s.occupied,
+		}
+		result = append(result, item)
+
+		totalRevenue += s.revenue
+		totalOrders += s.orders
+		totalOpen += s.open
+		totalTables += s.tables
+		totalOccupied += s.occupied
+	}
+
+	totalAvg := float64(0)
+	if totalOrders > 0 {
+		totalAvg = totalRevenue / float64(totalOrders)
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"start_date": startDate,
+		"end_date":   endDate,
+		"totals": gin.H{
+			"revenue":         totalRevenue,
+			"orders":          totalOrders,
+			"avg_order_value": totalAvg,
+			"open_orders":     totalOpen,
+			"tables": gin.H{
+				"total":    totalTables,
+				"occupied": totalOccupied,
+			},
+		},
+		"branches": result,
+	}, "")
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// loadOwnerChain lấy nhà hàng chính của chuỗi mà chủ nhà hàng đang đăng nhập sở hữu
+func loadOwnerChain(c *gin.Context) (models.Restaurant, bool) {
+	var main models.Restaurant
+
+	role, _ := c.Get("role")
+	if role != "restaurant" {
+		utils.ErrorResponse(c, http.StatusForbidden, "Chỉ chủ nhà hàng mới quản lý được chi nhánh", "FORBIDDEN", "")
+		return main, false
+	}
+
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	if currentRestaurantID == nil || currentRestaurantID.(*uint) == nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Bạn chưa có nhà hàng", "NO_RESTAURANT", "")
+		return main, false
+	}
+
+	db := config.GetDB()
+
+	var current models.Restaurant
+	if err := db.First(&current, *currentRestaurantID.(*uint)).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy nhà hàng", "RESTAURANT_NOT_FOUND", "")
+		return main, false
+	}
+
+	mainID := current.ID
+	if current.ParentID != nil {
+		mainID = *current.ParentID
+	}
+
+	if err := db.Preload("Package").First(&main, mainID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy nhà hàng chính", "RESTAURANT_NOT_FOUND", "")
+		return main, false
+	}
+
+	if main.OwnerID != currentUserID(c) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không sở hữu chuỗi nhà hàng này", "FORBIDDEN", "")
+		return main, false
+	}
+
+	return main, true
+}
+
+// chainRestaurants nhà hàng chính + các chi nhánh (nhà hàng chính đứng đầu)
+func chainRestaurants(db *gorm.DB, mainID uint) ([]models.Restaurant, error) {
+	var restaurants []models.Restaurant
+	err := db.Where("id = ? OR parent_id = ?", mainID, mainID).
+		Order("parent_id IS NOT NULL, id ASC").
+		Find(&restaurants).Error
+	return restaurants, err
+}
+
+// restaurantDisplayName tên hiển thị kèm tên chi nhánh
+func restaurantDisplayName(r models.Restaurant) string {
+	if r.BranchName != nil && *r.BranchName != "" {
+		return r.Name + " - " + *r.BranchName
+	}
+	return r.Name
+}
+
+func branchResponse(r models.Restaurant) gin.H {
+	return gin.H{
+		"id":           r.ID,
+		"parent_id":    r.ParentID,
+		"is_main":      r.ParentID == nil,
+		"name":         r.Name,
+		"branch_name":  r.BranchName,
+		"display_name": restaurantDisplayName(r),
+		"slug":         r.Slug,
+		"address":      r.Address,
+		"phone":        r.Phone,
+		"is_open":      r.IsOpen,
+		"status":       r.Status,
+	}
+}
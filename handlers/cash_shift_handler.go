@@ -0,0 +1,512 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/config"
+	"go-api/middleware"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===============================
+// REQUEST STRUCTS
+// ===============================
+
+// OpenCashShiftInput request body mở ca thu ngân
+type OpenCashShiftInput struct {
+	OpeningFloat float64 `json:"opening_float" binding:"min=0"` // Tiền đầu ca trong két
+	Notes        string  `json:"notes" binding:"max=500"`
+}
+
+// CashMovementInput request body nộp / rút tiền két
+type CashMovementInput struct {
+	Type   string  `json:"type" binding:"required,oneof=in out"`
+	Amount float64 `json:"amount" binding:"required,gt=0"`
+	Reason string  `json:"reason" binding:"required,max=255"`
+}
+
+// CloseCashShiftInput request body đóng ca
+type CloseCashShiftInput struct {
+	CountedAmount *float64 `json:"counted_amount" binding:"required,min=0"` // Tiền đếm thực tế trong két
+	Notes         string   `json:"notes" binding:"max=500"`
+}
+
+// CloseBusinessDayInput request body chốt sổ cuối ngày
+type CloseBusinessDayInput struct {
+	Date  string `json:"date"` // YYYY-MM-DD, mặc định hôm qua (chỉ chốt được ngày đã kết thúc)
+	Notes string `json:"notes" binding:"max=500"`
+}
+
+// ===============================
+// CASH SHIFT HANDLERS
+// ===============================
+
+// OpenCashShift mở ca thu ngân
+// @Summary Mở ca thu ngân
+// @Description Thu ngân mở ca với tiền đầu ca; mỗi người chỉ có một ca đang mở. Đơn thu tiền mặt do người này xác nhận sẽ được tính vào ca
+// @Tags Cash Shifts
+// @Accept json
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param body body OpenCashShiftInput true "Tiền đầu ca"
+// @Success 201 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/cash-shifts [post]
+func OpenCashShift(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền mở ca tại nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	userID := currentUserID(c)
+	if userID == 0 {
+		utils.ErrorResponse(c, http.StatusForbidden, "Ca thu ngân cần đăng nhập bằng tài khoản nhân viên", "USER_REQUIRED", "")
+		return
+	}
+
+	var input OpenCashShiftInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	shift, err := services.OpenCashShift(config.GetDB(), uint(restaurantID), userID, input.OpeningFloat, strings.TrimSpace(input.Notes))
+	if err != nil {
+		code, msg, _ := strings.Cut(err.Error(), ": ")
+		switch code {
+		case "SHIFT_ALREADY_OPEN", "DAY_CLOSED":
+			utils.ErrorResponse(c, http.StatusConflict, msg, code, "")
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể mở ca", "CREATE_ERROR", err.Error())
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, shift, "Mở ca thành công")
+}
+
+// GetCurrentCashShift ca đang mở của người dùng hiện tại
+// @Summary Ca thu ngân hiện tại
+// @Description Ca đang mở của người đăng nhập kèm tiền mặt dự kiến trong két
+// @Tags Cash Shifts
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/cash-shifts/current [get]
+func GetCurrentCashShift(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem ca của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	db := config.GetDB()
+	shift, err := services.CurrentCashShift(db, uint(restaurantID), currentUserID(c))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy ca thu ngân", "QUERY_ERROR", err.Error())
+		return
+	}
+	if shift == nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Bạn chưa mở ca thu ngân", "SHIFT_NOT_FOUND", "")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"shift":   shift,
+		"summary": services.ComputeCashShiftSummary(db, *shift),
+	}, "")
+}
+
+// GetCashShifts danh sách ca thu ngân
+// @Summary Danh sách ca thu ngân
+// @Description Lịch sử ca thu ngân của nhà hàng, mới nhất trước
+// @Tags Cash Shifts
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param status query string false "Trạng thái" Enums(open, closed)
+// @Param date query string false "Ngày mở ca (YYYY-MM-DD)"
+// @Param page query int false "Trang" default(1)
+// @Param limit query int false "Số bản ghi mỗi trang" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/cash-shifts [get]
+func GetCashShifts(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem ca của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	query := config.GetDB().Model(&models.CashShift{}).Where("restaurant_id = ?", restaurantID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if date := c.Query("date"); date != "" {
+		start, end, err := services.BusinessDayRange(date)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Ngày không hợp lệ (YYYY-MM-DD)", "INVALID_DATE", "")
+			return
+		}
+		query = query.Where("opened_at >= ? AND opened_at < ?", start, end)
+	}
+
+	// Pagination
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	var total int64
+	query.Count(&total)
+
+	var shifts []models.CashShift
+	if err := query.Preload("Cashier").
+		Order("opened_at DESC").
+		Offset(offset).Limit(limit).
+		Find(&shifts).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy ca thu ngân", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	totalPages := int(total) / limit
+	if int(total)%limit > 0 {
+		totalPages++
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"shifts": shifts,
+		"pagination": gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": totalPages,
+		},
+	}, "")
+}
+
+// GetCashShift chi tiết ca thu ngân
+// @Summary Chi tiết ca thu ngân
+// @Description Ca thu ngân kèm các lần nộp / rút tiền và tiền mặt dự kiến
+// @Tags Cash Shifts
+// @Produce json
+// @Param id path int true "Cash Shift ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /cash-shifts/{id} [get]
+func GetCashShift(c *gin.Context) {
+	shift, ok := loadCashShift(c, false)
+	if !ok {
+		return
+	}
+
+	db := config.GetDB()
+	db.Where("shift_id = ?", shift.ID).Order("created_at ASC").Find(&shift.Movements)
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"shift":   shift,
+		"summary": services.ComputeCashShiftSummary(db, shift),
+	}, "")
+}
+
+// AddCashMovement nộp / rút tiền két
+// @Summary Nộp / rút tiền két
+// @Description Ghi nhận tiền mặt đưa vào (in) hoặc lấy ra (out) khỏi két ngoài bán hàng (đổi tiền lẻ, chi vặt, nộp ngân hàng...)
+// @Tags Cash Shifts
+// @Accept json
+// @Produce json
+// @Param id path int true "Cash Shift ID"
+// @Param body body CashMovementInput true "Nộp / rút tiền"
+// @Success 201 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /cash-shifts/{id}/movements [post]
+func AddCashMovement(c *gin.Context) {
+	shift, ok := loadCashShift(c, true)
+	if !ok {
+		return
+	}
+
+	var input CashMovementInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	movement, err := services.AddCashMovement(config.GetDB(), &shift, input.Type, input.Amount, strings.TrimSpace(input.Reason), currentUserID(c))
+	if err != nil {
+		code, msg, _ := strings.Cut(err.Error(), ": ")
+		switch code {
+		case "SHIFT_CLOSED", "DAY_CLOSED":
+			utils.ErrorResponse(c, http.StatusConflict, msg, code, "")
+		case "INVALID_TYPE", "INVALID_AMOUNT":
+			utils.ErrorResponse(c, http.StatusBadRequest, msg, code, "")
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể ghi nhận tiền két", "CREATE_ERROR", err.Error())
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, movement, "Ghi nhận thành công")
+}
+
+// CloseCashShift đóng ca thu ngân
+// @Summary Đóng ca thu ngân
+// @Description Đóng ca với số tiền đếm thực tế; hệ thống tính tiền dự kiến (đầu ca + bán tiền mặt - hoàn tiền mặt + nộp - rút) và chênh lệch
+// @Tags Cash Shifts
+// @Accept json
+// @Produce json
+// @Param id path int true "Cash Shift ID"
+// @Param body body CloseCashShiftInput true "Tiền đếm thực tế"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /cash-shifts/{id}/close [post]
+func CloseCashShift(c *gin.Context) {
+	shift, ok := loadCashShift(c, true)
+	if !ok {
+		return
+	}
+
+	var input CloseCashShiftInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	summary, err := services.CloseCashShift(config.GetDB(), &shift, *input.CountedAmount, currentUserID(c), strings.TrimSpace(input.Notes))
+	if err != nil {
+		code, msg, _ := strings.Cut(err.Error(), ": ")
+		if code == "SHIFT_CLOSED" {
+			utils.ErrorResponse(c, http.StatusConflict, msg, code, "")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể đóng ca", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"shift":   shift,
+		"summary": summary,
+	}, "Đóng ca thành công")
+}
+
+// ===============================
+// Z REPORT HANDLERS
+// ===============================
+
+// GetZReport báo cáo cuối ngày
+// @Summary Z report
+// @Description Báo cáo cuối ngày theo phương thức thanh toán, thuế, phí phục vụ, giảm giá, hoàn tiền, hủy món và chênh lệch két. Ngày đã chốt trả về bản lưu lúc chốt
+// @Tags Cash Shifts
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param date query string false "Ngày (YYYY-MM-DD), mặc định hôm nay"
+// @Success 200 {object} services.ZReport
+// @Security BearerAuth
+// @Router /restaurants/{id}/z-report [get]
+func GetZReport(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem báo cáo của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	date := c.DefaultQuery("date", services.BusinessDate(time.Now()))
+	report, err := services.GetZReport(config.GetDB(), uint(restaurantID), date)
+	if err != nil {
+		code, msg, _ := strings.Cut(err.Error(), ": ")
+		if code == "INVALID_DATE" {
+			utils.ErrorResponse(c, http.StatusBadRequest, msg, code, "")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lập Z report", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, report, "")
+}
+
+// CloseBusinessDay chốt sổ cuối ngày
+// @Summary Chốt sổ cuối ngày
+// @Description Lưu Z report và khóa ngày: sau khi chốt không thể thanh toán, hoàn tiền, sửa / hủy món của đơn thuộc ngày đó hay ghi bút toán vào ngày đó. Chỉ chốt được ngày đã kết thúc (giờ Việt Nam), mọi ca thu ngân phải đóng trước
+// @Tags Cash Shifts
+// @Accept json
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param body body CloseBusinessDayInput false "Ngày chốt sổ"
+// @Success 201 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/z-report/close [post]
+func CloseBusinessDay(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền chốt sổ nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var input CloseBusinessDayInput
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+	if input.Date == "" {
+		input.Date = services.BusinessDate(time.Now().AddDate(0, 0, -1))
+	}
+
+	closing, report, err := services.CloseBusinessDay(config.GetDB(), uint(restaurantID), input.Date, currentUserID(c), strings.TrimSpace(input.Notes))
+	if err != nil {
+		code, msg, _ := strings.Cut(err.Error(), ": ")
+		switch code {
+		case "INVALID_DATE", "DAY_NOT_ENDED":
+			utils.ErrorResponse(c, http.StatusBadRequest, msg, code, "")
+		case "DAY_ALREADY_CLOSED", "OPEN_SHIFTS":
+			utils.ErrorResponse(c, http.StatusConflict, msg, code, "")
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể chốt sổ", "CREATE_ERROR", err.Error())
+		}
+		return
+	}
+
+	services.PublishEvent("day.closed", closing.RestaurantID, map[string]interface{}{
+		"business_date": closing.BusinessDate,
+		"net_sales":     closing.NetSales,
+		"refunds":       closing.Refunds,
+		"cash_variance": closing.CashVariance,
+	})
+
+	utils.SuccessResponse(c, http.StatusCreated, gin.H{
+		"closing": closing,
+		"report":  report,
+	}, "Chốt sổ thành công, ngày "+closing.BusinessDate+" đã được khóa")
+}
+
+// GetDailyClosings danh sách ngày đã chốt sổ
+// @Summary Lịch sử chốt sổ
+// @Description Các ngày đã chốt sổ kèm số liệu tổng hợp, mới nhất trước
+// @Tags Cash Shifts
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param page query int false "Trang" default(1)
+// @Param limit query int false "Số bản ghi mỗi trang" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/daily-closings [get]
+func GetDailyClosings(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem báo cáo của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	query := config.GetDB().Model(&models.DailyClosing{}).Where("restaurant_id = ?", restaurantID)
+
+	// Pagination
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	var total int64
+	query.Count(&total)
+
+	var closings []models.DailyClosing
+	if err := query.Order("business_date DESC").Offset(offset).Limit(limit).Find(&closings).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy lịch sử chốt sổ", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	totalPages := int(total) / limit
+	if int(total)%limit > 0 {
+		totalPages++
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"closings": closings,
+		"pagination": gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": totalPages,
+		},
+	}, "")
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// loadCashShift lấy ca thu ngân theo :id và kiểm tra quyền; thao tác trên ca chỉ dành cho thu ngân của ca hoặc quản lý
+func loadCashShift(c *gin.Context, operate bool) (models.CashShift, bool) {
+	shiftID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	var shift models.CashShift
+	if err := config.GetDB().Preload("Cashier").First(&shift, shiftID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy ca thu ngân", "SHIFT_NOT_FOUND", "")
+		return shift, false
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || shift.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền với ca thu ngân này", "FORBIDDEN", "")
+		return shift, false
+	}
+
+	if operate && shift.CashierID != currentUserID(c) && !middleware.HasPermission(c, middleware.PermDayClose) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Chỉ thu ngân của ca hoặc quản lý mới được thao tác", "FORBIDDEN", "")
+		return shift, false
+	}
+
+	return shift, true
+}
@@ -6,6 +6,7 @@ import (
 
 	"go-api/config"
 	"go-api/models"
+	"go-api/services"
 	"go-api/utils"
 
 	"github.com/gin-gonic/gin"
@@ -141,6 +142,11 @@ func CreateCategory(c *gin.Context) {
 		return
 	}
 
+	services.PublishMenuUpdated(category.RestaurantID, "category_created", map[string]interface{}{
+		"category_id": category.ID,
+		"name":        category.Name,
+	})
+
 	utils.SuccessResponse(c, http.StatusCreated, gin.H{
 		"id":          category.ID,
 		"name":        category.Name,
@@ -214,6 +220,12 @@ func UpdateCategory(c *gin.Context) {
 
 	config.GetDB().First(&category, categoryID)
 
+	services.PublishMenuUpdated(category.RestaurantID, "category_updated", map[string]interface{}{
+		"category_id": category.ID,
+		"name":        category.Name,
+		"status":      category.Status,
+	})
+
 	utils.SuccessResponse(c, http.StatusOK, gin.H{
 		"id":          category.ID,
 		"name":        category.Name,
@@ -265,6 +277,10 @@ func DeleteCategory(c *gin.Context) {
 		return
 	}
 
+	services.PublishMenuUpdated(category.RestaurantID, "category_deleted", map[string]interface{}{
+		"category_id": category.ID,
+	})
+
 	utils.SuccessResponse(c, http.StatusOK, nil, "Xóa danh mục thành công")
 }
 
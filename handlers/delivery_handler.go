@@ -0,0 +1,527 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/config"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===============================
+// REQUEST STRUCTS
+// ===============================
+
+// DeliveryZoneInput request body cho tạo / cập nhật vùng giao hàng
+type DeliveryZoneInput struct {
+	Name           string   `json:"name" binding:"required"`
+	ZoneType       string   `json:"zone_type" binding:"required,oneof=distance district"`
+	MaxDistanceKm  *float64 `json:"max_distance_km"` // Bắt buộc với zone_type = distance
+	District       *string  `json:"district"`        // Bắt buộc với zone_type = district
+	Fee            float64  `json:"fee" binding:"min=0"`
+	MinOrderAmount float64  `json:"min_order_amount" binding:"min=0"`
+	IsActive       *bool    `json:"is_active"`
+	SortOrder      int      `json:"sort_order"`
+}
+
+// DeliveryQuoteInput request body cho báo giá phí giao hàng
+type DeliveryQuoteInput struct {
+	District  string           `json:"district"`
+	Latitude  *float64         `json:"latitude"`
+	Longitude *float64         `json:"longitude"`
+	Items     []OrderItemInput `json:"items"` // Không bắt buộc, dùng để kiểm tra đơn tối thiểu
+}
+
+// CreateDeliveryOrderInput request body cho đơn giao hàng
+type CreateDeliveryOrderInput struct {
+	CustomerName    string             `json:"customer_name" binding:"required"`
+	CustomerPhone   string             `json:"customer_phone" binding:"required"`
+	DeliveryAddress string             `json:"delivery_address" binding:"required"`
+	District        string             `json:"district"`
+	Latitude        *float64           `json:"latitude"`
+	Longitude       *float64           `json:"longitude"`
+	PaymentMethod   string             `json:"payment_method" binding:"required,oneof=qr cash"` // qr = trả trước, cash = thu tiền khi giao
+	Notes           string             `json:"notes"`
+	Items           []OrderItemInput   `json:"items" binding:"required,min=1"`
+	Invoice         *InvoiceBuyerInput `json:"invoice"` // Thông tin xuất hóa đơn điện tử, bỏ trống = không lấy hóa đơn
+}
+
+// ===============================
+// DELIVERY ZONE HANDLERS
+// ===============================
+
+// GetDeliveryZones lấy danh sách vùng giao hàng của nhà hàng
+// @Summary Danh sách vùng giao hàng
+// @Description Lấy các vùng giao hàng (theo bán kính / quận huyện) của nhà hàng
+// @Tags Delivery
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/delivery-zones [get]
+func GetDeliveryZones(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem vùng giao hàng của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var zones []models.DeliveryZone
+	if err := config.GetDB().Where("restaurant_id = ?", restaurantID).
+		Order("sort_order ASC, id ASC").
+		Find(&zones).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy vùng giao hàng", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, zones, "")
+}
+
+// CreateDeliveryZone tạo vùng giao hàng
+// @Summary Tạo vùng giao hàng
+// @Description Tạo vùng giao hàng theo bán kính (km) hoặc theo quận/huyện, kèm phí và đơn tối thiểu
+// @Tags Delivery
+// @Accept json
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param zone body DeliveryZoneInput true "Thông tin vùng giao hàng"
+// @Success 201 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/delivery-zones [post]
+func CreateDeliveryZone(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền tạo vùng giao hàng cho nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var input DeliveryZoneInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	if msg := validateDeliveryZoneInput(input); msg != "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, msg, "INVALID_ZONE", "")
+		return
+	}
+
+	zone := models.DeliveryZone{RestaurantID: uint(restaurantID), IsActive: true}
+	applyDeliveryZoneInput(&zone, input)
+
+	if err := config.GetDB().Create(&zone).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo vùng giao hàng", "CREATE_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, zone, "Tạo vùng giao hàng thành công")
+}
+
+// UpdateDeliveryZone cập nhật vùng giao hàng
+// @Summary Cập nhật vùng giao hàng
+// @Tags Delivery
+// @Accept json
+// @Produce json
+// @Param id path int true "Delivery Zone ID"
+// @Param zone body DeliveryZoneInput true "Thông tin vùng giao hàng"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /delivery-zones/{id} [put]
+func UpdateDeliveryZone(c *gin.Context) {
+	zoneID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	db := config.GetDB()
+
+	var zone models.DeliveryZone
+	if err := db.First(&zone, zoneID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy vùng giao hàng", "ZONE_NOT_FOUND", "")
+		return
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || zone.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền chỉnh sửa vùng giao hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var input DeliveryZoneInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	if msg := validateDeliveryZoneInput(input); msg != "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, msg, "INVALID_ZONE", "")
+		return
+	}
+
+	applyDeliveryZoneInput(&zone, input)
+
+	if err := db.Save(&zone).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể cập nhật vùng giao hàng", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, zone, "Cập nhật vùng giao hàng thành công")
+}
+
+// DeleteDeliveryZone xóa vùng giao hàng
+// @Summary Xóa vùng giao hàng
+// @Tags Delivery
+// @Produce json
+// @Param id path int true "Delivery Zone ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /delivery-zones/{id} [delete]
+func DeleteDeliveryZone(c *gin.Context) {
+	zoneID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	db := config.GetDB()
+
+	var zone models.DeliveryZone
+	if err := db.First(&zone, zoneID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy vùng giao hàng", "ZONE_NOT_FOUND", "")
+		return
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || zone.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xóa vùng giao hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	// Đơn cũ vẫn giữ phí giao đã tính, chỉ bỏ liên kết tới vùng
+	db.Model(&models.Order{}).Where("delivery_zone_id = ?", zone.ID).Update("delivery_zone_id", nil)
+
+	if err := db.Delete(&zone).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể xóa vùng giao hàng", "DELETE_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, nil, "Xóa vùng giao hàng thành công")
+}
+
+// ===============================
+// PUBLIC DELIVERY HANDLERS
+// ===============================
+
+// QuoteDelivery báo giá phí giao hàng cho địa chỉ (Public)
+// @Summary Báo giá phí giao hàng
+// @Description Tìm vùng giao hàng phù hợp theo tọa độ hoặc quận/huyện và trả về phí giao, đơn tối thiểu
+// @Tags Public
+// @Accept json
+// @Produce json
+// @Param slug path string true "Restaurant Slug"
+// @Param quote body DeliveryQuoteInput true "Địa chỉ giao hàng"
+// @Success 200 {object} map[string]interface{}
+// @Router /public/restaurants/{slug}/delivery/quote [post]
+func QuoteDelivery(c *gin.Context) {
+	slug := c.Param("slug")
+	db := config.GetDB()
+
+	var restaurant models.Restaurant
+	if err := db.Where("slug = ? AND status = ?", slug, "active").First(&restaurant).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy nhà hàng", "RESTAURANT_NOT_FOUND", "")
+		return
+	}
+
+	var input DeliveryQuoteInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	subtotal := 0.0
+	if len(input.Items) > 0 {
+		menuItemMap, _, err := loadOrderMenuItems(db, restaurant.ID, input.Items)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi kiểm tra món ăn", "DB_ERROR", err.Error())
+			return
+		}
+		subtotal = itemsSubtotal(input.Items, menuItemMap)
+	}
+
+	quote, err := services.QuoteDelivery(restaurant, services.DeliveryDestination{
+		District:  input.District,
+		Latitude:  input.Latitude,
+		Longitude: input.Longitude,
+	}, subtotal)
+	if err != nil {
+		respondDeliveryQuoteError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"zone_id":          quote.Zone.ID,
+		"zone_name":        quote.Zone.Name,
+		"distance_km":      quote.DistanceKm,
+		"fee":              quote.Fee,
+		"min_order_amount": quote.MinOrderAmount,
+	}, "")
+}
+
+// CreateDeliveryOrder khách đặt đơn giao hàng (Public)
+// @Summary Đặt đơn giao hàng
+// @Description Khách đặt món giao tận nơi. Phí giao tính theo vùng giao hàng của nhà hàng.
+// @Description payment_method = qr: chuyển khoản trước, đơn tự xác nhận khi thanh toán; cash: thu tiền khi giao, nhà hàng xác nhận thủ công
+// @Tags Public
+// @Accept json
+// @Produce json
+// @Param slug path string true "Restaurant Slug"
+// @Param order body CreateDeliveryOrderInput true "Thông tin đơn giao hàng"
+// @Success 201 {object} map[string]interface{}
+// @Router /public/restaurants/{slug}/delivery-orders [post]
+func CreateDeliveryOrder(c *gin.Context) {
+	slug := c.Param("slug")
+	db := config.GetDB()
+
+	var restaurant models.Restaurant
+	if err := db.Where("slug = ? AND status = ?", slug, "active").First(&restaurant).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy nhà hàng", "RESTAURANT_NOT_FOUND", "")
+		return
+	}
+
+	if !restaurant.IsOpen {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Nhà hàng hiện đang đóng cửa", "RESTAURANT_CLOSED", "")
+		return
+	}
+
+	var input CreateDeliveryOrderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	invoiceBuyer, ok := checkoutInvoiceBuyer(c, input.Invoice)
+	if !ok {
+		return
+	}
+
+	// Trả trước qua QR -> nhà hàng phải cấu hình tài khoản nhận tiền
+	if input.PaymentMethod == "qr" {
+		var settings models.PaymentSetting
+		if err := db.Where("restaurant_id = ?", restaurant.ID).First(&settings).Error; err != nil ||
+			settings.BankCode == nil || settings.AccountNumber == nil || settings.AccountName == nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Nhà hàng chưa hỗ trợ chuyển khoản, vui lòng chọn thanh toán khi nhận hàng", "QR_UNAVAILABLE", "")
+			return
+		}
+	}
+
+	menuItemMap, _, err := loadOrderMenuItems(db, restaurant.ID, input.Items)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi kiểm tra món ăn", "DB_ERROR", err.Error())
+		return
+	}
+
+	// Tính phí giao theo vùng (kiểm tra luôn đơn tối thiểu)
+	quote, err := services.QuoteDelivery(restaurant, services.DeliveryDestination{
+		District:  input.District,
+		Latitude:  input.Latitude,
+		Longitude: input.Longitude,
+	}, itemsSubtotal(input.Items, menuItemMap))
+	if err != nil {
+		respondDeliveryQuoteError(c, err)
+		return
+	}
+
+	var district *string
+	if d := strings.TrimSpace(input.District); d != "" {
+		district = &d
+	}
+	paymentMethod := input.PaymentMethod
+	paymentTiming := "after" // Thu tiền khi giao
+	if paymentMethod == "qr" {
+		paymentTiming = "before"
+	}
+
+	tx := db.Begin()
+
+	order := models.Order{
+		RestaurantID:       restaurant.ID,
+		OrderNumber:        generateOrderNumber(tx),
+		OrderType:          "delivery",
+		CustomerName:       &input.CustomerName,
+		CustomerPhone:      &input.CustomerPhone,
+		Status:             "pending",
+		PaymentTiming:      paymentTiming,
+		PaymentStatus:      "unpaid",
+		PaymentMethod:      &paymentMethod,
+		DeliveryAddress:    &input.DeliveryAddress,
+		DeliveryDistrict:   district,
+		DeliveryLatitude:   input.Latitude,
+		DeliveryLongitude:  input.Longitude,
+		DeliveryDistanceKm: quote.DistanceKm,
+		DeliveryZoneID:     &quote.Zone.ID,
+		DeliveryFee:        quote.Fee,
+		Notes:              &input.Notes,
+	}
+
+	if err := tx.Create(&order).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo đơn hàng", "CREATE_ERROR", err.Error())
+		return
+	}
+
+	orderItems, ok := buildOrderItems(order.ID, input.Items, menuItemMap, "pending")
+	if !ok {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusBadRequest, "Món không tồn tại hoặc đã ngừng bán", "INVALID_MENU_ITEM", "")
+		return
+	}
+
+	if err := tx.Create(&orderItems).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo chi tiết đơn hàng", "CREATE_ITEM_ERROR", err.Error())
+		return
+	}
+
+	if err := recalculateOrderTotals(tx, &order); err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tính tổng tiền", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	// Khách yêu cầu xuất hóa đơn: lưu thông tin người mua vào hóa đơn nháp
+	if invoiceBuyer != nil {
+		if _, err := services.SaveInvoiceBuyer(tx, order, *invoiceBuyer); err != nil {
+			tx.Rollback()
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể lưu thông tin xuất hóa đơn", "CREATE_ERROR", err.Error())
+			return
+		}
+	}
+
+	tx.Commit()
+
+	response := gin.H{
+		"id":               order.ID,
+		"order_number":     order.OrderNumber,
+		"order_type":       order.OrderType,
+		"status":           order.Status,
+		"delivery_address": order.DeliveryAddress,
+		"distance_km":      order.DeliveryDistanceKm,
+		"zone_name":        quote.Zone.Name,
+		"subtotal":         order.Subtotal,
+		"delivery_fee":     order.DeliveryFee,
+		"total_amount":     order.TotalAmount,
+		"payment_method":   paymentMethod,
+		"tracking_url":     "/" + slug + "/order/" + strconv.Itoa(int(order.ID)),
+	}
+
+	// Thu tiền khi giao: báo nhà hàng xác nhận ngay
+	if paymentMethod == "cash" {
+		CreateDeliveryOrderNotification(order)
+		services.PublishOrderEvent(services.WebhookEventOrderCreated, order)
+		utils.SuccessResponse(c, http.StatusCreated, response, "Đặt đơn giao hàng thành công. Nhà hàng sẽ sớm xác nhận!")
+		return
+	}
+
+	// Trả trước: tạo QR thanh toán
+	qr, err := services.CreateOrderPaymentQR(order.ID)
+	if err != nil {
+		db.Model(&order).Updates(map[string]interface{}{
+			"status":        "cancelled",
+			"cancel_reason": "Không tạo được QR thanh toán",
+			"cancelled_at":  time.Now(),
+		})
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), "QR_ERROR", "")
+		return
+	}
+	db.First(&order, order.ID)
+
+	services.PublishOrderEvent(services.WebhookEventOrderCreated, order)
+
+	response["payment"] = gin.H{
+		"payment_code": order.PaymentCode,
+		"qr_url":       qr.QRURL,
+		"bank_info": gin.H{
+			"bank_name":      qr.BankName,
+			"account_number": qr.AccountNo,
+			"account_name":   qr.AccountName,
+		},
+		"expires_at": order.PaymentExpiresAt,
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, response, "Đơn giao hàng đã được tạo. Vui lòng chuyển khoản để hoàn tất!")
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// validateDeliveryZoneInput kiểm tra dữ liệu vùng giao theo loại vùng
+func validateDeliveryZoneInput(input DeliveryZoneInput) string {
+	switch input.ZoneType {
+	case "distance":
+		if input.MaxDistanceKm == nil || *input.MaxDistanceKm <= 0 {
+			return "Vùng theo bán kính cần max_distance_km > 0"
+		}
+	case "district":
+		if input.District == nil || strings.TrimSpace(*input.District) == "" {
+			return "Vùng theo quận/huyện cần nhập district"
+		}
+	}
+	return ""
+}
+
+// applyDeliveryZoneInput gán dữ liệu input vào vùng giao hàng
+func applyDeliveryZoneInput(zone *models.DeliveryZone, input DeliveryZoneInput) {
+	zone.Name = input.Name
+	zone.ZoneType = input.ZoneType
+	zone.Fee = input.Fee
+	zone.MinOrderAmount = input.MinOrderAmount
+	zone.SortOrder = input.SortOrder
+	if input.IsActive != nil {
+		zone.IsActive = *input.IsActive
+	}
+
+	// Chỉ giữ trường tương ứng với loại vùng
+	zone.MaxDistanceKm = nil
+	zone.District = nil
+	if input.ZoneType == "distance" {
+		zone.MaxDistanceKm = input.MaxDistanceKm
+	} else {
+		district := strings.TrimSpace(*input.District)
+		zone.District = &district
+	}
+}
+
+// itemsSubtotal tính tạm tiền món (chưa thuế/phí) từ input
+func itemsSubtotal(inputs []OrderItemInput, menuItemMap map[uint]models.MenuItem) float64 {
+	subtotal := 0.0
+	for _, itemInput := range inputs {
+		if menuItem, ok := menuItemMap[itemInput.MenuItemID]; ok {
+			subtotal += menuItem.Price * float64(itemInput.Quantity)
+		}
+	}
+	return subtotal
+}
+
+// respondDeliveryQuoteError trả lỗi dạng "CODE: message" từ services.QuoteDelivery
+func respondDeliveryQuoteError(c *gin.Context, err error) {
+	code, message, found := strings.Cut(err.Error(), ": ")
+	if !found || strings.ContainsAny(code, " abcdefghijklmnopqrstuvwxyz") {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tính phí giao hàng", "QUOTE_ERROR", err.Error())
+		return
+	}
+	utils.ErrorResponse(c, http.StatusBadRequest, message, code, "")
+}
@@ -0,0 +1,607 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-api/config"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ===============================
+// REQUEST STRUCTS
+// ===============================
+
+// InvoiceBuyerInput thông tin người mua lấy hóa đơn điện tử (nhập khi đặt món hoặc sau khi thanh toán)
+type InvoiceBuyerInput struct {
+	BuyerName   string `json:"buyer_name" binding:"max=255"`   // Họ tên người mua hàng
+	CompanyName string `json:"company_name" binding:"max=255"` // Tên đơn vị, bắt buộc kèm mã số thuế và địa chỉ
+	TaxCode     string `json:"tax_code" binding:"max=20"`
+	Address     string `json:"address" binding:"max=500"`
+	Email       string `json:"email" binding:"omitempty,email,max=255"` // Email nhận hóa đơn
+}
+
+// IssueInvoiceInput request body phát hành hóa đơn (bỏ trống = dùng thông tin người mua đã lưu)
+type IssueInvoiceInput struct {
+	Buyer *InvoiceBuyerInput `json:"buyer"`
+}
+
+// CreateInvoiceSeriesInput request body tạo ký hiệu hóa đơn
+type CreateInvoiceSeriesInput struct {
+	TemplateCode string `json:"template_code" binding:"required,oneof=1 2"` // 1 = HĐ GTGT, 2 = HĐ bán hàng
+	Symbol       string `json:"symbol" binding:"required,len=6"`            // VD: C26MAA
+	StartNumber  int    `json:"start_number" binding:"omitempty,min=1"`     // Mặc định 1
+}
+
+// CancelInvoiceInput request body hủy hóa đơn
+type CancelInvoiceInput struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// ===============================
+// E-INVOICE SETTINGS HANDLERS
+// ===============================
+
+// GetEInvoiceSettings lấy cấu hình hóa đơn điện tử
+// @Summary Lấy cấu hình hóa đơn điện tử
+// @Description Thông tin người bán trên hóa đơn và nhà cung cấp hóa đơn điện tử (mặc định local: chỉ lưu XML, không gửi cơ quan thuế)
+// @Tags E-Invoices
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/einvoice-settings [get]
+func GetEInvoiceSettings(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem cấu hình hóa đơn của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	settings, err := loadEInvoiceSettings(uint(restaurantID))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy nhà hàng", "RESTAURANT_NOT_FOUND", "")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"settings":            settings,
+		"provider_configured": settings.ProviderPassword != nil,
+		"providers":           services.EInvoiceProviderNames(),
+	}, "")
+}
+
+// UpdateEInvoiceSettings cập nhật cấu hình hóa đơn điện tử
+// @Summary Cập nhật cấu hình hóa đơn điện tử
+// @Description Cập nhật thông tin người bán và tài khoản nhà cung cấp hóa đơn điện tử
+// @Tags E-Invoices
+// @Accept json
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/einvoice-settings [put]
+func UpdateEInvoiceSettings(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền cập nhật cấu hình hóa đơn của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var input struct {
+		Provider          string `json:"provider"`
+		SellerName        string `json:"seller_name" binding:"max=255"`
+		SellerTaxCode     string `json:"seller_tax_code" binding:"max=20"`
+		SellerAddress     string `json:"seller_address" binding:"max=500"`
+		SellerPhone       string `json:"seller_phone" binding:"max=20"`
+		SellerEmail       string `json:"seller_email" binding:"omitempty,email"`
+		SellerBankAccount string `json:"seller_bank_account" binding:"max=50"`
+		SellerBankName    string `json:"seller_bank_name" binding:"max=255"`
+		// Tài khoản nhà cung cấp hóa đơn điện tử
+		ProviderURL      string `json:"provider_url" binding:"omitempty,url"`
+		ProviderUsername string `json:"provider_username" binding:"max=100"`
+		ProviderPassword string `json:"provider_password" binding:"max=255"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	settings, err := loadEInvoiceSettings(uint(restaurantID))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy nhà hàng", "RESTAURANT_NOT_FOUND", "")
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if input.Provider != "" {
+		if _, err := services.NewEInvoiceProvider(input.Provider, *settings); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Nhà cung cấp hóa đơn điện tử không được hỗ trợ", "PROVIDER_NOT_SUPPORTED", "")
+			return
+		}
+		updates["provider"] = input.Provider
+	}
+	if input.SellerName != "" {
+		updates["seller_name"] = strings.TrimSpace(input.SellerName)
+	}
+	if input.SellerTaxCode != "" {
+		taxCode := strings.ReplaceAll(strings.TrimSpace(input.SellerTaxCode), " ", "")
+		if !services.ValidTaxCode(taxCode) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Mã số thuế không hợp lệ", "INVALID_TAX_CODE", "")
+			return
+		}
+		updates["seller_tax_code"] = taxCode
+	}
+	if input.SellerAddress != "" {
+		updates["seller_address"] = strings.TrimSpace(input.SellerAddress)
+	}
+	if input.SellerPhone != "" {
+		updates["seller_phone"] = input.SellerPhone
+	}
+	if input.SellerEmail != "" {
+		updates["seller_email"] = input.SellerEmail
+	}
+	if input.SellerBankAccount != "" {
+		updates["seller_bank_account"] = input.SellerBankAccount
+	}
+	if input.SellerBankName != "" {
+		updates["seller_bank_name"] = input.SellerBankName
+	}
+	if input.ProviderURL != "" {
+		updates["provider_url"] = input.ProviderURL
+	}
+	if input.ProviderUsername != "" {
+		updates["provider_username"] = input.ProviderUsername
+	}
+	if input.ProviderPassword != "" {
+		updates["provider_password"] = input.ProviderPassword
+	}
+
+	if len(updates) > 0 {
+		if err := config.GetDB().Model(settings).Updates(updates).Error; err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể cập nhật cấu hình hóa đơn", "UPDATE_ERROR", err.Error())
+			return
+		}
+	}
+
+	config.GetDB().First(settings, settings.ID)
+	utils.SuccessResponse(c, http.StatusOK, settings, "Cập nhật cấu hình hóa đơn thành công")
+}
+
+// ===============================
+// INVOICE SERIES HANDLERS
+// ===============================
+
+// GetInvoiceSeries danh sách ký hiệu hóa đơn
+// @Summary Danh sách ký hiệu hóa đơn
+// @Description Các ký hiệu hóa đơn của nhà hàng và số hóa đơn tiếp theo, dãy đang dùng đứng đầu
+// @Tags E-Invoices
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/invoice-series [get]
+func GetInvoiceSeries(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem ký hiệu hóa đơn của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var series []models.InvoiceSeries
+	if err := config.GetDB().Where("restaurant_id = ?", restaurantID).
+		Order("is_active DESC, id DESC").
+		Find(&series).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy ký hiệu hóa đơn", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, series, "")
+}
+
+// CreateInvoiceSeries tạo ký hiệu hóa đơn
+// @Summary Tạo ký hiệu hóa đơn
+// @Description Đăng ký ký hiệu hóa đơn mới (VD: mẫu 1, ký hiệu C26MAA), dãy mới thay dãy đang dùng. Ký hiệu chứa năm phát hành nên cần tạo dãy mới mỗi năm
+// @Tags E-Invoices
+// @Accept json
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param body body CreateInvoiceSeriesInput true "Ký hiệu hóa đơn"
+// @Success 201 {object} models.InvoiceSeries
+// @Security BearerAuth
+// @Router /restaurants/{id}/invoice-series [post]
+func CreateInvoiceSeries(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền tạo ký hiệu hóa đơn cho nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var input CreateInvoiceSeriesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	series, err := services.CreateInvoiceSeries(config.GetDB(), uint(restaurantID), input.TemplateCode, input.Symbol, input.StartNumber)
+	if err != nil {
+		code, msg, _ := strings.Cut(err.Error(), ": ")
+		switch code {
+		case "INVALID_TEMPLATE", "INVALID_SYMBOL":
+			utils.ErrorResponse(c, http.StatusBadRequest, msg, code, "")
+		case "SERIES_EXISTS":
+			utils.ErrorResponse(c, http.StatusConflict, msg, code, "")
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo ký hiệu hóa đơn", "CREATE_ERROR", err.Error())
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, series, "Tạo ký hiệu hóa đơn thành công")
+}
+
+// ===============================
+// INVOICE HANDLERS
+// ===============================
+
+// GetInvoices danh sách hóa đơn điện tử của nhà hàng
+// @Summary Danh sách hóa đơn điện tử
+// @Description Hóa đơn của nhà hàng theo trạng thái (draft = khách đã gửi thông tin nhưng chưa phát hành)
+// @Tags E-Invoices
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param status query string false "Trạng thái" Enums(draft, issued, cancelled)
+// @Param page query int false "Trang" default(1)
+// @Param limit query int false "Số bản ghi mỗi trang" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/invoices [get]
+func GetInvoices(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem hóa đơn của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	query := config.GetDB().Model(&models.Invoice{}).Where("restaurant_id = ?", restaurantID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	// Pagination
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	var total int64
+	query.Count(&total)
+
+	var invoices []models.Invoice
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&invoices).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy hóa đơn", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	totalPages := int(total) / limit
+	if int(total)%limit > 0 {
+		totalPages++
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"invoices": invoices,
+		"pagination": gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": totalPages,
+		},
+	}, "")
+}
+
+// GetOrderInvoice hóa đơn điện tử của đơn hàng
+// @Summary Hóa đơn của đơn hàng
+// @Description Hóa đơn đang hiệu lực (nháp hoặc đã phát hành) của đơn, null nếu khách chưa yêu cầu
+// @Tags E-Invoices
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /orders/{id}/invoice [get]
+func GetOrderInvoice(c *gin.Context) {
+	order, ok := loadInvoiceOrder(c)
+	if !ok {
+		return
+	}
+
+	invoice, err := services.CurrentInvoice(config.GetDB(), order.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy hóa đơn", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"invoice": invoice,
+	}, "")
+}
+
+// UpdateOrderInvoiceBuyer lưu thông tin người mua lấy hóa đơn
+// @Summary Thông tin người mua lấy hóa đơn
+// @Description Lưu / sửa thông tin người mua (tên đơn vị, mã số thuế, địa chỉ, email) sau khi đặt món. Hóa đơn đã phát hành cần hủy trước khi sửa
+// @Tags E-Invoices
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param body body InvoiceBuyerInput true "Thông tin người mua"
+// @Success 200 {object} models.Invoice
+// @Security BearerAuth
+// @Router /orders/{id}/invoice/buyer [put]
+func UpdateOrderInvoiceBuyer(c *gin.Context) {
+	order, ok := loadInvoiceOrder(c)
+	if !ok {
+		return
+	}
+
+	var input InvoiceBuyerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	var invoice *models.Invoice
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		invoice, err = services.SaveInvoiceBuyer(tx, *order, input.toBuyer())
+		return err
+	})
+	if err != nil {
+		respondInvoiceError(c, err, "Không thể lưu thông tin người mua")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, invoice, "Đã lưu thông tin xuất hóa đơn")
+}
+
+// IssueOrderInvoice phát hành hóa đơn điện tử cho đơn hàng
+// @Summary Phát hành hóa đơn điện tử
+// @Description Cấp số hóa đơn tiếp theo của ký hiệu đang dùng, dựng XML và gửi nhà cung cấp. Chỉ với đơn đã thanh toán
+// @Tags E-Invoices
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param body body IssueInvoiceInput false "Thông tin người mua (bỏ trống = dùng thông tin đã lưu)"
+// @Success 201 {object} models.Invoice
+// @Security BearerAuth
+// @Router /orders/{id}/invoice [post]
+func IssueOrderInvoice(c *gin.Context) {
+	order, ok := loadInvoiceOrder(c)
+	if !ok {
+		return
+	}
+
+	var input IssueInvoiceInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+			return
+		}
+	}
+
+	var buyer *services.InvoiceBuyer
+	if input.Buyer != nil {
+		b := input.Buyer.toBuyer()
+		buyer = &b
+	}
+
+	invoice, err := services.IssueInvoice(config.GetDB(), order.ID, buyer, currentUserID(c))
+	if err != nil {
+		respondInvoiceError(c, err, "Không thể phát hành hóa đơn")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, invoice, "Phát hành hóa đơn thành công")
+}
+
+// GetInvoiceXML tải XML hóa đơn đã phát hành
+// @Summary Tải XML hóa đơn
+// @Description File XML hóa đơn điện tử theo định dạng Thông tư 78 (HDon / DLHDon) để nhập vào phần mềm của nhà cung cấp
+// @Tags E-Invoices
+// @Produce xml
+// @Param id path int true "Invoice ID"
+// @Success 200 {file} file
+// @Security BearerAuth
+// @Router /invoices/{id}/xml [get]
+func GetInvoiceXML(c *gin.Context) {
+	invoiceID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	invoice, err := services.FindInvoice(config.GetDB(), uint(invoiceID), invoiceScope(c))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy hóa đơn", "INVOICE_NOT_FOUND", "")
+		return
+	}
+	if invoice.XML == "" {
+		utils.ErrorResponse(c, http.StatusConflict, "Hóa đơn chưa phát hành", "NOT_ISSUED", "")
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+services.InvoiceFileName(*invoice)+`"`)
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", []byte(invoice.XML))
+}
+
+// CancelInvoice hủy hóa đơn điện tử
+// @Summary Hủy hóa đơn
+// @Description Hủy hóa đơn nháp hoặc đã phát hành (hủy cả bên nhà cung cấp). Số hóa đơn không được cấp lại, đơn có thể phát hành hóa đơn thay thế
+// @Tags E-Invoices
+// @Accept json
+// @Produce json
+// @Param id path int true "Invoice ID"
+// @Param body body CancelInvoiceInput true "Lý do hủy"
+// @Success 200 {object} models.Invoice
+// @Security BearerAuth
+// @Router /invoices/{id}/cancel [post]
+func CancelInvoice(c *gin.Context) {
+	invoiceID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	var input CancelInvoiceInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	invoice, err := services.CancelInvoice(config.GetDB(), uint(invoiceID), invoiceScope(c), currentUserID(c), strings.TrimSpace(input.Reason))
+	if err != nil {
+		respondInvoiceError(c, err, "Không thể hủy hóa đơn")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, invoice, "Đã hủy hóa đơn")
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// toBuyer chuyển input sang thông tin người mua của service
+func (input InvoiceBuyerInput) toBuyer() services.InvoiceBuyer {
+	return services.InvoiceBuyer{
+		Name:    input.BuyerName,
+		Company: input.CompanyName,
+		TaxCode: input.TaxCode,
+		Address: input.Address,
+		Email:   input.Email,
+	}
+}
+
+// checkoutInvoiceBuyer kiểm tra thông tin xuất hóa đơn gửi kèm khi đặt món (nil = khách không lấy hóa đơn).
+// Trả về ok = false nếu đã trả lỗi
+func checkoutInvoiceBuyer(c *gin.Context, input *InvoiceBuyerInput) (*services.InvoiceBuyer, bool) {
+	if input == nil {
+		return nil, true
+	}
+	buyer := input.toBuyer()
+	if err := buyer.Normalize(); err != nil {
+		code, msg, _ := strings.Cut(err.Error(), ": ")
+		utils.ErrorResponse(c, http.StatusBadRequest, msg, code, "")
+		return nil, false
+	}
+	return &buyer, true
+}
+
+// loadEInvoiceSettings cấu hình hóa đơn của nhà hàng, chưa có thì tạo từ thông tin nhà hàng
+func loadEInvoiceSettings(restaurantID uint) (*models.EInvoiceSetting, error) {
+	db := config.GetDB()
+
+	var settings models.EInvoiceSetting
+	if err := db.Where("restaurant_id = ?", restaurantID).First(&settings).Error; err == nil {
+		return &settings, nil
+	}
+
+	var restaurant models.Restaurant
+	if err := db.First(&restaurant, restaurantID).Error; err != nil {
+		return nil, err
+	}
+	settings = models.EInvoiceSetting{
+		RestaurantID: restaurantID,
+		Provider:     services.EInvoiceProviderLocal,
+		SellerName:   restaurant.Name,
+		SellerPhone:  restaurant.Phone,
+		SellerEmail:  restaurant.Email,
+	}
+	if restaurant.Address != nil {
+		settings.SellerAddress = *restaurant.Address
+	}
+	if err := db.Create(&settings).Error; err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// loadInvoiceOrder tải đơn theo :id và kiểm tra quyền; trả về ok = false nếu đã trả lỗi
+func loadInvoiceOrder(c *gin.Context) (*models.Order, bool) {
+	orderID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	var order models.Order
+	if err := config.GetDB().First(&order, orderID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy đơn hàng", "ORDER_NOT_FOUND", "")
+		return nil, false
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || order.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xuất hóa đơn cho đơn hàng này", "FORBIDDEN", "")
+		return nil, false
+	}
+	return &order, true
+}
+
+// invoiceScope nhà hàng được xem hóa đơn (nil = admin xem tất cả)
+func invoiceScope(c *gin.Context) *uint {
+	role, _ := c.Get("role")
+	if role == "admin" {
+		return nil
+	}
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	if currentRestaurantID == nil {
+		none := uint(0)
+		return &none
+	}
+	return currentRestaurantID.(*uint)
+}
+
+// respondInvoiceError trả lỗi nghiệp vụ hóa đơn theo mã lỗi của service
+func respondInvoiceError(c *gin.Context, err error, message string) {
+	code, msg, _ := strings.Cut(err.Error(), ": ")
+	switch code {
+	case "ORDER_NOT_FOUND", "INVOICE_NOT_FOUND":
+		utils.ErrorResponse(c, http.StatusNotFound, msg, code, "")
+	case "INVALID_BUYER", "INVALID_TAX_CODE":
+		utils.ErrorResponse(c, http.StatusBadRequest, msg, code, "")
+	case "ORDER_NOT_PAID", "ORDER_CLOSED", "ALREADY_ISSUED", "ALREADY_CANCELLED",
+		"EINVOICE_NOT_CONFIGURED", "NO_INVOICE_SERIES", "SERIES_EXPIRED", "PROVIDER_NOT_SUPPORTED":
+		utils.ErrorResponse(c, http.StatusConflict, msg, code, "")
+	case "PROVIDER_ERROR":
+		utils.ErrorResponse(c, http.StatusBadGateway, "Nhà cung cấp hóa đơn điện tử từ chối yêu cầu", code, msg)
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, message, "INVOICE_ERROR", err.Error())
+	}
+}
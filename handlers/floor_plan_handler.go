@@ -0,0 +1,544 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-api/config"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// validTableShapes các hình dạng bàn trên sơ đồ
+var validTableShapes = []string{"square", "rectangle", "round"}
+
+// ===============================
+// REQUEST STRUCTS
+// ===============================
+
+// TableZoneInput request body cho tạo / cập nhật khu vực bàn
+type TableZoneInput struct {
+	Name        string   `json:"name" binding:"required"`
+	Description *string  `json:"description"`
+	SortOrder   int      `json:"sort_order"`
+	Width       *float64 `json:"width"`
+	Height      *float64 `json:"height"`
+	IsActive    *bool    `json:"is_active"`
+}
+
+// TableLayoutItem vị trí của một bàn trên sơ đồ
+type TableLayoutItem struct {
+	TableID  uint     `json:"table_id" binding:"required"`
+	ZoneID   *uint    `json:"zone_id"` // null = chưa xếp khu vực
+	PosX     float64  `json:"pos_x"`
+	PosY     float64  `json:"pos_y"`
+	Width    *float64 `json:"width"`
+	Height   *float64 `json:"height"`
+	Shape    string   `json:"shape"` // square, rectangle, round
+	Rotation int      `json:"rotation"`
+}
+
+// UpdateTableLayoutInput request body cho lưu sơ đồ bàn
+type UpdateTableLayoutInput struct {
+	Tables []TableLayoutItem `json:"tables" binding:"required,min=1,dive"`
+}
+
+// ===============================
+// TABLE ZONE HANDLERS
+// ===============================
+
+// GetTableZones lấy danh sách khu vực bàn
+// @Summary Danh sách khu vực bàn
+// @Tags Tables
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/table-zones [get]
+func GetTableZones(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem khu vực của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	type zoneRow struct {
+		models.TableZone
+		TablesCount int64 `json:"tables_count"`
+	}
+
+	var zones []zoneRow
+	if err := config.GetDB().Model(&models.TableZone{}).
+		Select("table_zones.*, (SELECT COUNT(*) FROM tables WHERE tables.zone_id = table_zones.id) AS tables_count").
+		Where("restaurant_id = ?", restaurantID).
+		Order("sort_order ASC, id ASC").
+		Scan(&zones).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy khu vực bàn", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, zones, "")
+}
+
+// CreateTableZone tạo khu vực bàn
+// @Summary Tạo khu vực bàn
+// @Description Tạo khu vực (trong nhà, sân thượng, tầng 2...) để xếp bàn trên sơ đồ
+// @Tags Tables
+// @Accept json
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param zone body TableZoneInput true "Thông tin khu vực"
+// @Success 201 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/table-zones [post]
+func CreateTableZone(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền tạo khu vực cho nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var input TableZoneInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	zone := models.TableZone{
+		RestaurantID: uint(restaurantID),
+		Name:         input.Name,
+		Description:  input.Description,
+		SortOrder:    input.SortOrder,
+		Width:        1000,
+		Height:       700,
+		IsActive:     true,
+	}
+	if input.Width != nil && *input.Width > 0 {
+		zone.Width = *input.Width
+	}
+	if input.Height != nil && *input.Height > 0 {
+		zone.Height = *input.Height
+	}
+	if input.IsActive != nil {
+		zone.IsActive = *input.IsActive
+	}
+
+	if err := config.GetDB().Create(&zone).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo khu vực", "CREATE_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, zone, "Tạo khu vực thành công")
+}
+
+// UpdateTableZone cập nhật khu vực bàn
+// @Summary Cập nhật khu vực bàn
+// @Tags Tables
+// @Accept json
+// @Produce json
+// @Param id path int true "Zone ID"
+// @Param zone body TableZoneInput true "Thông tin khu vực"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /table-zones/{id} [put]
+func UpdateTableZone(c *gin.Context) {
+	zoneID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	db := config.GetDB()
+
+	var zone models.TableZone
+	if err := db.First(&zone, zoneID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy khu vực", "ZONE_NOT_FOUND", "")
+		return
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || zone.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền chỉnh sửa khu vực này", "FORBIDDEN", "")
+		return
+	}
+
+	var input TableZoneInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	updates := map[string]interface{}{
+		"name":        input.Name,
+		"description": input.Description,
+		"sort_order":  input.SortOrder,
+	}
+	if input.Width != nil && *input.Width > 0 {
+		updates["width"] = *input.Width
+	}
+	if input.Height != nil && *input.Height > 0 {
+		updates["height"] = *input.Height
+	}
+	if input.IsActive != nil {
+		updates["is_active"] = *input.IsActive
+	}
+
+	if err := db.Model(&zone).Updates(updates).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể cập nhật khu vực", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	db.First(&zone, zoneID)
+	utils.SuccessResponse(c, http.StatusOK, zone, "Cập nhật khu vực thành công")
+}
+
+// DeleteTableZone xóa khu vực bàn (các bàn trong khu vực chuyển về "chưa xếp")
+// @Summary Xóa khu vực bàn
+// @Tags Tables
+// @Produce json
+// @Param id path int true "Zone ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /table-zones/{id} [delete]
+func DeleteTableZone(c *gin.Context) {
+	zoneID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	db := config.GetDB()
+
+	var zone models.TableZone
+	if err := db.First(&zone, zoneID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy khu vực", "ZONE_NOT_FOUND", "")
+		return
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || zone.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xóa khu vực này", "FORBIDDEN", "")
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Table{}).Where("zone_id = ?", zone.ID).Update("zone_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&zone).Error
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể xóa khu vực", "DELETE_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, nil, "Xóa khu vực thành công")
+}
+
+// ===============================
+// LAYOUT HANDLERS
+// ===============================
+
+// UpdateTableLayout lưu vị trí / khu vực / hình dạng của nhiều bàn cùng lúc
+// @Summary Lưu sơ đồ bàn
+// @Description Cập nhật khu vực, tọa độ x/y, kích thước, hình dạng và góc xoay của các bàn
+// @Tags Tables
+// @Accept json
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param layout body UpdateTableLayoutInput true "Sơ đồ bàn"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/tables/layout [put]
+func UpdateTableLayout(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền chỉnh sơ đồ bàn của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var input UpdateTableLayoutInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	db := config.GetDB()
+
+	// Bàn và khu vực phải thuộc nhà hàng
+	tableIDs := make([]uint, 0, len(input.Tables))
+	zoneIDs := make([]uint, 0)
+	for _, item := range input.Tables {
+		tableIDs = append(tableIDs, item.TableID)
+		if item.ZoneID != nil {
+			zoneIDs = append(zoneIDs, *item.ZoneID)
+		}
+		if item.Shape != "" && !containsString(validTableShapes, item.Shape) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Hình dạng bàn không hợp lệ", "INVALID_SHAPE", item.Shape)
+			return
+		}
+	}
+
+	var tableCount int64
+	db.Model(&models.Table{}).Where("id IN ? AND restaurant_id = ?", tableIDs, restaurantID).Count(&tableCount)
+	if int(tableCount) != len(uniqueUints(tableIDs)) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Có bàn không thuộc nhà hàng", "TABLE_NOT_FOUND", "")
+		return
+	}
+
+	if len(zoneIDs) > 0 {
+		var zoneCount int64
+		db.Model(&models.TableZone{}).Where("id IN ? AND restaurant_id = ?", zoneIDs, restaurantID).Count(&zoneCount)
+		if int(zoneCount) != len(uniqueUints(zoneIDs)) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Có khu vực không thuộc nhà hàng", "ZONE_NOT_FOUND", "")
+			return
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, item := range input.Tables {
+			updates := map[string]interface{}{
+				"zone_id":  item.ZoneID,
+				"pos_x":    item.PosX,
+				"pos_y":    item.PosY,
+				"rotation": ((item.Rotation % 360) + 360) % 360,
+			}
+			if item.Width != nil && *item.Width > 0 {
+				updates["width"] = *item.Width
+			}
+			if item.Height != nil && *item.Height > 0 {
+				updates["height"] = *item.Height
+			}
+			if item.Shape != "" {
+				updates["shape"] = item.Shape
+			}
+			if err := tx.Model(&models.Table{}).Where("id = ?", item.TableID).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể lưu sơ đồ bàn", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	services.PublishEvent("table.layout_updated", uint(restaurantID), map[string]interface{}{
+		"table_ids": tableIDs,
+	})
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"updated": len(input.Tables),
+	}, "Lưu sơ đồ bàn thành công")
+}
+
+// getFloorPlan trả về sơ đồ bàn nhóm theo khu vực kèm trạng thái live (GetTables?view=floor_plan)
+func getFloorPlan(c *gin.Context, restaurant models.Restaurant, tables []models.Table) {
+	var zones []models.TableZone
+	if err := config.GetDB().Where("restaurant_id = ? AND is_active = ?", restaurant.ID, true).
+		Order("sort_order ASC, id ASC").
+		Find(&zones).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy khu vực bàn", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	states := loadTableLiveStates(restaurant.ID, tables)
+	summary := map[string]int{
+		"available":         0,
+		"reserved":          0,
+		"occupied":          0,
+		"waiting_payment":   0,
+		"service_requested": 0,
+	}
+
+	tablesByZone := make(map[uint][]gin.H)
+	unzoned := []gin.H{}
+	for _, t := range tables {
+		item := tableLayoutResponse(restaurant, t)
+		state := states[t.ID]
+		item["live"] = state
+		if t.IsActive {
+			summary[state.Status]++
+		}
+
+		if t.ZoneID == nil {
+			unzoned = append(unzoned, item)
+			continue
+		}
+		tablesByZone[*t.ZoneID] = append(tablesByZone[*t.ZoneID], item)
+	}
+
+	zoneData := make([]gin.H, 0, len(zones))
+	for _, z := range zones {
+		zoneTables := tablesByZone[z.ID]
+		if zoneTables == nil {
+			zoneTables = []gin.H{}
+		}
+		delete(tablesByZone, z.ID)
+		zoneData = append(zoneData, gin.H{
+			"id":          z.ID,
+			"name":        z.Name,
+			"description": z.Description,
+			"sort_order":  z.SortOrder,
+			"width":       z.Width,
+			"height":      z.Height,
+			"tables":      zoneTables,
+		})
+	}
+
+	// Bàn thuộc khu vực đã tắt -> hiển thị chung nhóm chưa xếp
+	for _, rest := range tablesByZone {
+		unzoned = append(unzoned, rest...)
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"zones":   zoneData,
+		"unzoned": unzoned,
+		"summary": summary,
+	}, "")
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// tableLiveState trạng thái thực tế của bàn tổng hợp từ đơn đang mở và yêu cầu phục vụ
+type tableLiveState struct {
+	Status          string     `json:"live_status"` // available, reserved, occupied, waiting_payment, service_requested
+	OpenOrders      int        `json:"open_orders"`
+	UnpaidAmount    float64    `json:"unpaid_amount"`
+	PendingRequests int        `json:"pending_requests"`
+	SeatedSince     *time.Time `json:"seated_since"`
+}
+
+// loadTableLiveStates tính trạng thái live cho các bàn của nhà hàng
+// Ưu tiên: service_requested > waiting_payment > occupied > reserved > available
+func loadTableLiveStates(restaurantID uint, tables []models.Table) map[uint]*tableLiveState {
+	db := config.GetDB()
+	states := make(map[uint]*tableLiveState, len(tables))
+	for _, t := range tables {
+		states[t.ID] = &tableLiveState{}
+	}
+
+	// Đơn đang mở theo bàn
+	var orderRows []struct {
+		TableID      uint
+		OpenOrders   int
+		UnpaidOrders int
+		UnpaidAmount float64
+		FirstOrderAt time.Time
+	}
+	db.Model(&models.Order{}).
+		Select(`table_id, COUNT(*) AS open_orders,
+			SUM(CASE WHEN payment_status <> 'paid' THEN 1 ELSE 0 END) AS unpaid_orders,
+			COALESCE(SUM(CASE WHEN payment_status <> 'paid' THEN total_amount ELSE 0 END), 0) AS unpaid_amount,
+			MIN(created_at) AS first_order_at`).
+		Where("restaurant_id = ? AND table_id IS NOT NULL AND status IN ?", restaurantID, openOrderStatuses).
+		Group("table_id").
+		Scan(&orderRows)
+
+	unpaidByTable := make(map[uint]int)
+	for _, row := range orderRows {
+		state, ok := states[row.TableID]
+		if !ok {
+			continue
+		}
+		firstOrderAt := row.FirstOrderAt
+		state.OpenOrders = row.OpenOrders
+		state.UnpaidAmount = row.UnpaidAmount
+		state.SeatedSince = &firstOrderAt
+		unpaidByTable[row.TableID] = row.UnpaidOrders
+	}
+
+	// Yêu cầu phục vụ chưa xử lý (xin thanh toán = đang chờ thanh toán)
+	var requestRows []struct {
+		TableID      uint
+		Pending      int
+		BillRequests int
+	}
+	db.Model(&models.ServiceRequest{}).
+		Select(`table_id, COUNT(*) AS pending,
+			SUM(CASE WHEN type = 'request_bill' THEN 1 ELSE 0 END) AS bill_requests`).
+		Where("restaurant_id = ? AND status IN ?", restaurantID, []string{"pending", "acknowledged"}).
+		Group("table_id").
+		Scan(&requestRows)
+
+	billRequested := make(map[uint]bool)
+	for _, row := range requestRows {
+		if state, ok := states[row.TableID]; ok {
+			state.PendingRequests = row.Pending - row.BillRequests
+			billRequested[row.TableID] = row.BillRequests > 0
+		}
+	}
+
+	for _, t := range tables {
+		state := states[t.ID]
+		switch {
+		case state.PendingRequests > 0:
+			state.Status = "service_requested"
+		case unpaidByTable[t.ID] > 0 || billRequested[t.ID]:
+			state.Status = "waiting_payment"
+		case state.OpenOrders > 0 || t.Status == "occupied":
+			state.Status = "occupied"
+		case t.Status == "reserved":
+			state.Status = "reserved"
+		default:
+			state.Status = "available"
+		}
+	}
+
+	return states
+}
+
+// tableLayoutResponse dữ liệu bàn kèm thông tin sơ đồ
+func tableLayoutResponse(restaurant models.Restaurant, t models.Table) gin.H {
+	return gin.H{
+		"id":           t.ID,
+		"table_number": t.TableNumber,
+		"name":         t.Name,
+		"capacity":     t.Capacity,
+		"status":       t.Status,
+		"is_active":    t.IsActive,
+		"zone_id":      t.ZoneID,
+		"layout": gin.H{
+			"pos_x":    t.PosX,
+			"pos_y":    t.PosY,
+			"width":    t.Width,
+			"height":   t.Height,
+			"shape":    t.Shape,
+			"rotation": t.Rotation,
+		},
+		"qr_url":     services.TableQRURL(restaurant.Slug, t),
+		"qr_png_url": tableQRImagePath(t.ID, "png"),
+		"qr_svg_url": tableQRImagePath(t.ID, "svg"),
+	}
+}
+
+// uniqueUints loại bỏ ID trùng
+func uniqueUints(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	result := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/config"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===============================
+// REQUEST STRUCTS
+// ===============================
+
+// CreateLedgerAdjustmentInput request body cho bút toán điều chỉnh
+type CreateLedgerAdjustmentInput struct {
+	Description string                `json:"description" binding:"required,max=500"`
+	PostedAt    *time.Time            `json:"posted_at"` // Mặc định: hiện tại
+	Lines       []services.LedgerLine `json:"lines" binding:"required,min=2,dive"`
+}
+
+// ===============================
+// LEDGER HANDLERS
+// ===============================
+
+// GetLedgerBalances số dư các tài khoản sổ cái
+// @Summary Số dư sổ cái
+// @Description Số dư từng tài khoản (phải thu, tiền mặt, ngân hàng, doanh thu, tip, hoàn tiền, phí nền tảng) và doanh thu thuần trong khoảng thời gian
+// @Tags Ledger
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param from query string false "Từ ngày (YYYY-MM-DD)"
+// @Param to query string false "Đến ngày (YYYY-MM-DD, bao gồm)"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/ledger [get]
+func GetLedgerBalances(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem sổ cái của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	from, to, ok := parseLedgerRange(c)
+	if !ok {
+		return
+	}
+
+	balances, err := services.GetLedgerBalances(config.GetDB(), uint(restaurantID), from, to)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy sổ cái", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	var totalDebit, totalCredit, grossRevenue, refunds float64
+	for _, b := range balances {
+		totalDebit += b.Debit
+		totalCredit += b.Credit
+		switch b.Code {
+		case services.LedgerRevenue:
+			grossRevenue = b.Balance
+		case services.LedgerRefunds:
+			refunds = b.Balance
+		}
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"accounts":      balances,
+		"total_debit":   totalDebit,
+		"total_credit":  totalCredit,
+		"balanced":      totalDebit == totalCredit,
+		"gross_revenue": grossRevenue,
+		"refunds":       refunds,
+		"net_revenue":   grossRevenue - refunds,
+	}, "")
+}
+
+// GetLedgerTransactions danh sách bút toán
+// @Summary Danh sách bút toán
+// @Description Các bút toán sổ cái kèm dòng ghi Nợ / Có, mới nhất trước
+// @Tags Ledger
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param kind query string false "Loại bút toán" Enums(order_payment, refund, adjustment, overpayment, platform_fee)
+// @Param order_id query int false "Lọc theo đơn hàng"
+// @Param from query string false "Từ ngày (YYYY-MM-DD)"
+// @Param to query string false "Đến ngày (YYYY-MM-DD, bao gồm)"
+// @Param page query int false "Trang" default(1)
+// @Param limit query int false "Số bản ghi mỗi trang" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/ledger/transactions [get]
+func GetLedgerTransactions(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem sổ cái của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	from, to, ok := parseLedgerRange(c)
+	if !ok {
+		return
+	}
+
+	query := config.GetDB().Model(&models.LedgerTransaction{}).Where("restaurant_id = ?", restaurantID)
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if orderID := c.Query("order_id"); orderID != "" {
+		query = query.Where("reference_type = ? AND reference_id = ?", "order", orderID)
+	}
+	if from != nil {
+		query = query.Where("posted_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("posted_at < ?", *to)
+	}
+
+	// Pagination
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	var total int64
+	query.Count(&total)
+
+	var transactions []models.LedgerTransaction
+	if err := query.Preload("Entries.Account").
+		Order("posted_at DESC, id DESC").
+		Offset(offset).Limit(limit).
+		Find(&transactions).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy bút toán", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	totalPages := int(total) / limit
+	if int(total)%limit > 0 {
+		totalPages++
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"transactions": transactions,
+		"pagination": gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": totalPages,
+		},
+	}, "")
+}
+
+// CreateLedgerAdjustment ghi bút toán điều chỉnh
+// @Summary Bút toán điều chỉnh
+// @Description Ghi bút toán điều chỉnh cân bằng (tip, phí cổng thanh toán, sửa sai...). Sổ cái chỉ ghi thêm, sửa sai bằng bút toán đảo
+// @Tags Ledger
+// @Accept json
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param body body CreateLedgerAdjustmentInput true "Nội dung bút toán"
+// @Success 201 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/ledger/adjustments [post]
+func CreateLedgerAdjustment(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền ghi sổ cái của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var input CreateLedgerAdjustmentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	createdBy := currentUserID(c)
+	posting := services.LedgerPosting{
+		RestaurantID: uint(restaurantID),
+		Kind:         services.LedgerKindAdjustment,
+		Description:  strings.TrimSpace(input.Description),
+		CreatedBy:    &createdBy,
+		Lines:        input.Lines,
+	}
+	if input.PostedAt != nil {
+		posting.PostedAt = *input.PostedAt
+	}
+
+	// Không ghi bút toán vào ngày đã chốt sổ
+	postedAt := time.Now()
+	if input.PostedAt != nil {
+		postedAt = *input.PostedAt
+	}
+	if err := services.EnsureDayOpen(config.GetDB(), uint(restaurantID), postedAt); err != nil {
+		_, msg, _ := strings.Cut(err.Error(), ": ")
+		utils.ErrorResponse(c, http.StatusConflict, msg, "DAY_CLOSED", "")
+		return
+	}
+
+	transaction, err := services.PostLedgerTransaction(config.GetDB(), posting)
+	if err != nil {
+		code, msg, _ := strings.Cut(err.Error(), ": ")
+		switch code {
+		case "LEDGER_UNBALANCED", "LEDGER_INVALID_LINE", "INVALID_ACCOUNT":
+			utils.ErrorResponse(c, http.StatusBadRequest, msg, code, "")
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể ghi sổ cái", "CREATE_ERROR", err.Error())
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, transaction, "Ghi bút toán điều chỉnh thành công")
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// parseLedgerRange đọc from / to (YYYY-MM-DD); to tính hết ngày. Trả về ok = false nếu đã trả lỗi
+func parseLedgerRange(c *gin.Context) (from, to *time.Time, ok bool) {
+	if s := c.Query("from"); s != "" {
+		t, err := time.ParseInLocation(services.BusinessDateLayout, s, services.BusinessLocation)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Ngày bắt đầu không hợp lệ (YYYY-MM-DD)", "INVALID_DATE", "")
+			return nil, nil, false
+		}
+		from = &t
+	}
+	if s := c.Query("to"); s != "" {
+		t, err := time.ParseInLocation(services.BusinessDateLayout, s, services.BusinessLocation)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Ngày kết thúc không hợp lệ (YYYY-MM-DD)", "INVALID_DATE", "")
+			return nil, nil, false
+		}
+		t = t.AddDate(0, 0, 1)
+		to = &t
+	}
+	return from, to, true
+}
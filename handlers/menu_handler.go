@@ -6,6 +6,7 @@ import (
 
 	"go-api/config"
 	"go-api/models"
+	"go-api/services"
 	"go-api/utils"
 
 	"github.com/gin-gonic/gin"
@@ -316,6 +317,14 @@ func CreateMenuItem(c *gin.Context) {
 		return
 	}
 
+	services.PublishMenuUpdated(item.RestaurantID, "item_created", map[string]interface{}{
+		"menu_item_id": item.ID,
+		"category_id":  item.CategoryID,
+		"name":         item.Name,
+		"price":        item.Price,
+		"status":       item.Status,
+	})
+
 	utils.SuccessResponse(c, http.StatusCreated, gin.H{
 		"id":            item.ID,
 		"name":          item.Name,
@@ -427,6 +436,14 @@ func UpdateMenuItem(c *gin.Context) {
 
 	config.GetDB().First(&item, itemID)
 
+	services.PublishMenuUpdated(item.RestaurantID, "item_updated", map[string]interface{}{
+		"menu_item_id": item.ID,
+		"category_id":  item.CategoryID,
+		"name":         item.Name,
+		"price":        item.Price,
+		"status":       item.Status,
+	})
+
 	utils.SuccessResponse(c, http.StatusOK, gin.H{
 		"id":            item.ID,
 		"name":          item.Name,
@@ -476,5 +493,10 @@ func DeleteMenuItem(c *gin.Context) {
 		return
 	}
 
+	services.PublishMenuUpdated(item.RestaurantID, "item_deleted", map[string]interface{}{
+		"menu_item_id": item.ID,
+		"category_id":  item.CategoryID,
+	})
+
 	utils.SuccessResponse(c, http.StatusOK, nil, "Xóa món thành công")
 }
@@ -0,0 +1,424 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"go-api/config"
+	"go-api/middleware"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ===============================
+// REQUEST STRUCTS
+// ===============================
+
+// MFAVerifyLoginInput request body cho bước 2 đăng nhập
+type MFAVerifyLoginInput struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`          // Mã 6 số từ ứng dụng xác thực
+	RecoveryCode string `json:"recovery_code"` // Hoặc mã khôi phục
+}
+
+// MFAEnrollLoginInput request body cho thiết lập 2FA khi đăng nhập (role bắt buộc 2FA)
+type MFAEnrollLoginInput struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+// MFAEnrollConfirmLoginInput request body cho xác nhận thiết lập 2FA khi đăng nhập
+type MFAEnrollConfirmLoginInput struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// MFACodeInput request body chứa mã xác thực
+type MFACodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// DisableMFAInput request body cho tắt 2FA
+type DisableMFAInput struct {
+	Password     string `json:"password" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// ===============================
+// LOGIN STEP 2 (public)
+// ===============================
+
+// VerifyMFALogin bước 2 đăng nhập: nhập mã xác thực
+// @Summary Xác thực 2 bước khi đăng nhập
+// @Description Dùng mfa_token nhận từ /auth/login cùng mã 6 số (hoặc mã khôi phục) để nhận access token
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body MFAVerifyLoginInput true "MFA token và mã xác thực"
+// @Success 200 {object} map[string]interface{}
+// @Router /auth/mfa/verify [post]
+func VerifyMFALogin(c *gin.Context) {
+	var input MFAVerifyLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+	if input.Code == "" && input.RecoveryCode == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Vui lòng nhập mã xác thực hoặc mã khôi phục", "VALIDATION_ERROR", "")
+		return
+	}
+
+	user, ok := loadMFAPendingUser(c, input.MFAToken, middleware.MFAPurposeVerify)
+	if !ok {
+		return
+	}
+
+	if remaining := services.LoginLockRemaining(user); remaining > 0 {
+		respondAccountLocked(c, remaining)
+		return
+	}
+
+	if err := services.VerifyMFA(config.GetDB(), user.ID, input.Code, input.RecoveryCode); err != nil {
+		// Mã sai cũng tính vào số lần đăng nhập sai (chặn dò mã 6 số)
+		code, _, _ := strings.Cut(err.Error(), ": ")
+		if code == "INVALID_MFA_CODE" || code == "INVALID_RECOVERY_CODE" {
+			if lock, _ := services.RecordFailedLogin(config.GetDB(), user.ID); lock > 0 {
+				respondAccountLocked(c, lock)
+				return
+			}
+		}
+		respondMFAError(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	restaurantID, staffRole, ok := resolveMFALoginRestaurant(c, user)
+	if !ok {
+		return
+	}
+
+	var extra gin.H
+	if input.RecoveryCode != "" {
+		extra = gin.H{"recovery_codes_remaining": services.RemainingRecoveryCodes(config.GetDB(), user.ID)}
+	}
+	completeLogin(c, user, restaurantID, staffRole, extra)
+}
+
+// EnrollMFALogin thiết lập 2FA trong lúc đăng nhập (role bắt buộc 2FA chưa thiết lập)
+// @Summary Thiết lập 2FA khi đăng nhập
+// @Description Trả về secret, otpauth URI và QR để quét bằng ứng dụng xác thực
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body MFAEnrollLoginInput true "MFA token"
+// @Success 200 {object} map[string]interface{}
+// @Router /auth/mfa/enroll [post]
+func EnrollMFALogin(c *gin.Context) {
+	var input MFAEnrollLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	user, ok := loadMFAPendingUser(c, input.MFAToken, middleware.MFAPurposeEnroll)
+	if !ok {
+		return
+	}
+
+	setup, err := services.BeginMFASetup(config.GetDB(), user)
+	if err != nil {
+		respondMFAError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, setup, "Quét mã QR bằng ứng dụng xác thực rồi nhập mã 6 số")
+}
+
+// ConfirmMFAEnrollLogin xác nhận thiết lập 2FA và hoàn tất đăng nhập
+// @Summary Xác nhận thiết lập 2FA khi đăng nhập
+// @Description Bật 2FA bằng mã đầu tiên, trả về access token và bộ mã khôi phục (chỉ hiển thị một lần)
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body MFAEnrollConfirmLoginInput true "MFA token và mã xác thực"
+// @Success 200 {object} map[string]interface{}
+// @Router /auth/mfa/enroll/confirm [post]
+func ConfirmMFAEnrollLogin(c *gin.Context) {
+	var input MFAEnrollConfirmLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	user, ok := loadMFAPendingUser(c, input.MFAToken, middleware.MFAPurposeEnroll)
+	if !ok {
+		return
+	}
+
+	var recoveryCodes []string
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		recoveryCodes, err = services.ConfirmMFASetup(tx, user.ID, input.Code)
+		return err
+	})
+	if err != nil {
+		respondMFAError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	restaurantID, staffRole, ok := resolveMFALoginRestaurant(c, user)
+	if !ok {
+		return
+	}
+
+	completeLogin(c, user, restaurantID, staffRole, gin.H{"recovery_codes": recoveryCodes})
+}
+
+// ===============================
+// MFA SETTINGS (đã đăng nhập)
+// ===============================
+
+// GetMFAStatus trạng thái xác thực 2 bước của tài khoản
+// @Summary Trạng thái 2FA
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /auth/mfa [get]
+func GetMFAStatus(c *gin.Context) {
+	db := config.GetDB()
+	userID := currentUserID(c)
+	role, _ := c.Get("role")
+
+	var mfa models.UserMFA
+	enabled := db.Where("user_id = ? AND enabled_at IS NOT NULL", userID).First(&mfa).Error == nil
+
+	response := gin.H{
+		"enabled":  enabled,
+		"required": config.IsMFARequired(role.(string)),
+	}
+	if enabled {
+		response["enabled_at"] = mfa.EnabledAt
+		response["recovery_codes_remaining"] = services.RemainingRecoveryCodes(db, userID)
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, response, "")
+}
+
+// SetupMFA bắt đầu thiết lập xác thực 2 bước
+// @Summary Thiết lập 2FA
+// @Description Trả về secret, otpauth URI và QR. 2FA chỉ bật sau khi xác nhận mã ở /auth/mfa/enable
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /auth/mfa/setup [post]
+func SetupMFA(c *gin.Context) {
+	db := config.GetDB()
+
+	var user models.User
+	if err := db.First(&user, currentUserID(c)).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy người dùng", "USER_NOT_FOUND", "")
+		return
+	}
+
+	setup, err := services.BeginMFASetup(db, user)
+	if err != nil {
+		respondMFAError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, setup, "Quét mã QR bằng ứng dụng xác thực rồi nhập mã 6 số")
+}
+
+// EnableMFA xác nhận mã đầu tiên và bật xác thực 2 bước
+// @Summary Bật 2FA
+// @Description Trả về bộ mã khôi phục (chỉ hiển thị một lần)
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body MFACodeInput true "Mã 6 số"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /auth/mfa/enable [post]
+func EnableMFA(c *gin.Context) {
+	var input MFACodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	var recoveryCodes []string
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		recoveryCodes, err = services.ConfirmMFASetup(tx, currentUserID(c), input.Code)
+		return err
+	})
+	if err != nil {
+		respondMFAError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"enabled":        true,
+		"recovery_codes": recoveryCodes,
+	}, "Đã bật xác thực 2 bước. Hãy lưu mã khôi phục ở nơi an toàn")
+}
+
+// DisableMFA tắt xác thực 2 bước
+// @Summary Tắt 2FA
+// @Description Cần mật khẩu và mã xác thực (hoặc mã khôi phục). Không áp dụng cho role bắt buộc 2FA
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body DisableMFAInput true "Mật khẩu và mã xác thực"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /auth/mfa/disable [post]
+func DisableMFA(c *gin.Context) {
+	var input DisableMFAInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	db := config.GetDB()
+
+	var user models.User
+	if err := db.First(&user, currentUserID(c)).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy người dùng", "USER_NOT_FOUND", "")
+		return
+	}
+
+	if config.IsMFARequired(user.Role) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Tài khoản bắt buộc bật xác thực 2 bước", "MFA_REQUIRED", "")
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Mật khẩu không đúng", "INVALID_CREDENTIALS", "")
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := services.VerifyMFA(tx, user.ID, input.Code, input.RecoveryCode); err != nil {
+			return err
+		}
+		return services.DisableMFA(tx, user.ID)
+	})
+	if err != nil {
+		respondMFAError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"enabled": false}, "Đã tắt xác thực 2 bước")
+}
+
+// RegenerateMFARecoveryCodes tạo lại bộ mã khôi phục
+// @Summary Tạo lại mã khôi phục
+// @Description Bộ mã cũ mất hiệu lực
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body MFACodeInput true "Mã 6 số"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /auth/mfa/recovery-codes [post]
+func RegenerateMFARecoveryCodes(c *gin.Context) {
+	var input MFACodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	userID := currentUserID(c)
+
+	var recoveryCodes []string
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := services.VerifyMFA(tx, userID, input.Code, ""); err != nil {
+			return err
+		}
+		var err error
+		recoveryCodes, err = services.RegenerateRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		respondMFAError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"recovery_codes": recoveryCodes,
+	}, "Đã tạo bộ mã khôi phục mới")
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// respondMFAChallenge trả về mfa_token thay cho access token (bước 1 đăng nhập thành công)
+func respondMFAChallenge(c *gin.Context, user models.User, purpose string) {
+	token, err := middleware.GenerateMFAToken(user.ID, purpose)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo token", "TOKEN_ERROR", err.Error())
+		return
+	}
+
+	message := "Vui lòng nhập mã xác thực 2 bước"
+	if purpose == middleware.MFAPurposeEnroll {
+		message = "Tài khoản bắt buộc xác thực 2 bước, vui lòng thiết lập ứng dụng xác thực"
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"mfa_required":            true,
+		"mfa_enrollment_required": purpose == middleware.MFAPurposeEnroll,
+		"mfa_token":               token,
+		"expires_in":              int(middleware.MFATokenTTL.Seconds()),
+	}, message)
+}
+
+// loadMFAPendingUser xác thực mfa_token và lấy user còn hoạt động
+func loadMFAPendingUser(c *gin.Context, mfaToken, purpose string) (models.User, bool) {
+	var user models.User
+
+	claims, err := middleware.ValidateMFAToken(mfaToken, purpose)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Phiên xác thực đã hết hạn, vui lòng đăng nhập lại", "INVALID_MFA_TOKEN", err.Error())
+		return user, false
+	}
+
+	if err := config.GetDB().First(&user, claims.UserID).Error; err != nil || !user.IsActive {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Tài khoản đã bị vô hiệu hóa", "ACCOUNT_DISABLED", "")
+		return user, false
+	}
+
+	return user, true
+}
+
+// resolveMFALoginRestaurant xác định lại nhà hàng sau bước 2 (trạng thái nhân viên có thể đã đổi)
+func resolveMFALoginRestaurant(c *gin.Context, user models.User) (*uint, string, bool) {
+	restaurantID, staffRole, err := resolveSessionRestaurant(user, nil)
+	if err != nil {
+		code, msg, _ := strings.Cut(err.Error(), ": ")
+		utils.ErrorResponse(c, http.StatusUnauthorized, msg, code, "")
+		return nil, "", false
+	}
+	return restaurantID, staffRole, true
+}
+
+// respondMFAError trả lỗi mã xác thực sai / đã dùng... hoặc lỗi hệ thống
+func respondMFAError(c *gin.Context, status int, err error) {
+	code, msg, _ := strings.Cut(err.Error(), ": ")
+	switch code {
+	case "INVALID_MFA_CODE", "MFA_CODE_USED", "INVALID_RECOVERY_CODE":
+		utils.ErrorResponse(c, status, msg, code, "")
+	case "MFA_ALREADY_ENABLED", "MFA_NOT_SETUP", "MFA_NOT_ENABLED", "MFA_SECRET_INVALID":
+		utils.ErrorResponse(c, http.StatusBadRequest, msg, code, "")
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi hệ thống", "MFA_ERROR", err.Error())
+	}
+}
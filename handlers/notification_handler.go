@@ -293,6 +293,59 @@ func CreateOrderNotification(restaurantID uint, orderID uint, orderNumber string
 	)
 }
 
+// CreateTakeawayOrderNotification tạo thông báo đơn mang về đã thanh toán
+func CreateTakeawayOrderNotification(order models.Order) error {
+	pickup := "Lấy ngay"
+	if order.PickupTime != nil {
+		pickup = "Lấy lúc " + order.PickupTime.Format("15:04 02/01")
+	}
+	pickupNumber := ""
+	if order.PickupNumber != nil {
+		pickupNumber = *order.PickupNumber
+	}
+
+	return CreateNotification(
+		order.RestaurantID,
+		"new_takeaway_order",
+		"Đơn mang về "+pickupNumber+" #"+order.OrderNumber,
+		pickup+" • "+formatCurrency(order.TotalAmount),
+		map[string]interface{}{
+			"order_id":      order.ID,
+			"order_number":  order.OrderNumber,
+			"pickup_number": pickupNumber,
+			"pickup_time":   order.PickupTime,
+			"total_amount":  order.TotalAmount,
+		},
+	)
+}
+
+// CreateDeliveryOrderNotification tạo thông báo đơn giao hàng mới
+func CreateDeliveryOrderNotification(order models.Order) error {
+	address := ""
+	if order.DeliveryAddress != nil {
+		address = *order.DeliveryAddress
+	}
+	payment := "Đã thanh toán"
+	if order.PaymentStatus != "paid" {
+		payment = "Thu tiền khi giao"
+	}
+
+	return CreateNotification(
+		order.RestaurantID,
+		"new_delivery_order",
+		"Đơn giao hàng #"+order.OrderNumber,
+		address+" • "+formatCurrency(order.TotalAmount)+" • "+payment,
+		map[string]interface{}{
+			"order_id":         order.ID,
+			"order_number":     order.OrderNumber,
+			"delivery_address": address,
+			"delivery_fee":     order.DeliveryFee,
+			"total_amount":     order.TotalAmount,
+			"payment_status":   order.PaymentStatus,
+		},
+	)
+}
+
 // CreatePaymentPendingNotification tạo thông báo chờ thanh toán
 func CreatePaymentPendingNotification(restaurantID uint, orderID uint, orderNumber string, totalAmount float64) error {
 	return CreateNotification(
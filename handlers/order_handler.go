@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"go-api/config"
@@ -12,6 +14,8 @@ import (
 	"go-api/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ===============================
@@ -29,12 +33,14 @@ type OrderItemInput struct {
 // CreateOrderInput request body cho tạo đơn hàng
 // Khách order = thanh toán luôn
 type CreateOrderInput struct {
-	TableNumber   int              `json:"table_number" binding:"required"`
-	PaymentMethod string           `json:"payment_method" binding:"required"` // cash, qr, momo, vnpay
-	CustomerName  string           `json:"customer_name"`
-	CustomerPhone string           `json:"customer_phone"`
-	Notes         string           `json:"notes"`
-	Items         []OrderItemInput `json:"items" binding:"required,min=1"`
+	TableNumber   int                `json:"table_number" binding:"required"`
+	TableToken    string             `json:"table_token"`                       // Token trong QR bàn (hoặc ?t= / X-Table-Token)
+	PaymentMethod string             `json:"payment_method" binding:"required"` // cash, qr, momo, vnpay
+	CustomerName  string             `json:"customer_name"`
+	CustomerPhone string             `json:"customer_phone"`
+	Notes         string             `json:"notes"`
+	Items         []OrderItemInput   `json:"items" binding:"required,min=1"`
+	Invoice       *InvoiceBuyerInput `json:"invoice"` // Thông tin xuất hóa đơn điện tử, bỏ trống = không lấy hóa đơn
 }
 
 // UpdateOrderStatusInput request body cho cập nhật trạng thái
@@ -50,7 +56,8 @@ type PayOrderInput struct {
 
 // AddOrderItemsInput request body cho thêm món
 type AddOrderItemsInput struct {
-	Items []OrderItemInput `json:"items" binding:"required,min=1"`
+	TableToken string           `json:"table_token"` // Bắt buộc với đơn tại bàn (hoặc ?t= / X-Table-Token)
+	Items      []OrderItemInput `json:"items" binding:"required,min=1"`
 }
 
 // ===============================
@@ -64,9 +71,10 @@ type AddOrderItemsInput struct {
 // @Accept json
 // @Produce json
 // @Param id path int true "Restaurant ID"
-// @Param status query string false "Filter theo status" Enums(pending, confirmed, serving, completed, cancelled)
+// @Param status query string false "Filter theo status" Enums(pending, confirmed, serving, ready_for_pickup, out_for_delivery, delivered, completed, cancelled, merged)
 // @Param date query string false "Filter theo ngày (YYYY-MM-DD)"
 // @Param table_id query int false "Filter theo bàn"
+// @Param order_type query string false "Loại đơn" Enums(dine_in, takeaway, delivery)
 // @Param page query int false "Trang" default(1)
 // @Param limit query int false "Số lượng/trang" default(20)
 // @Success 200 {object} map[string]interface{}
@@ -104,6 +112,12 @@ func GetOrders(c *gin.Context) {
 		query = query.Where("table_id = ?", tableID)
 	}
 
+	// Filter by order type (dine_in, takeaway)
+	orderType := c.Query("order_type")
+	if orderType != "" {
+		query = query.Where("order_type = ?", orderType)
+	}
+
 	// Pagination
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
@@ -156,20 +170,25 @@ func GetOrders(c *gin.Context) {
 		}
 
 		data = append(data, gin.H{
-			"id":             order.ID,
-			"order_number":   order.OrderNumber,
-			"table_id":       order.TableID,
-			"table_number":   tableNumber,
-			"table_name":     tableName,
-			"status":         order.Status,
-			"payment_status": order.PaymentStatus,
-			"payment_timing": order.PaymentTiming,
-			"subtotal":       order.Subtotal,
-			"tax_amount":     order.TaxAmount,
-			"service_charge": order.ServiceCharge,
-			"total_amount":   order.TotalAmount,
-			"items_count":    itemsCount,
-			"created_at":     order.CreatedAt,
+			"id":               order.ID,
+			"order_number":     order.OrderNumber,
+			"order_type":       order.OrderType,
+			"table_id":         order.TableID,
+			"table_number":     tableNumber,
+			"table_name":       tableName,
+			"pickup_number":    order.PickupNumber,
+			"pickup_time":      order.PickupTime,
+			"status":           order.Status,
+			"payment_status":   order.PaymentStatus,
+			"payment_timing":   order.PaymentTiming,
+			"delivery_address": order.DeliveryAddress,
+			"subtotal":         order.Subtotal,
+			"tax_amount":       order.TaxAmount,
+			"service_charge":   order.ServiceCharge,
+			"delivery_fee":     order.DeliveryFee,
+			"total_amount":     order.TotalAmount,
+			"items_count":      itemsCount,
+			"created_at":       order.CreatedAt,
 		})
 	}
 
@@ -232,10 +251,24 @@ func GetOrder(c *gin.Context) {
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, gin.H{
-		"id":              order.ID,
-		"order_number":    order.OrderNumber,
-		"table_id":        order.TableID,
-		"table_name":      tableName,
+		"id":            order.ID,
+		"order_number":  order.OrderNumber,
+		"order_type":    order.OrderType,
+		"table_id":      order.TableID,
+		"table_name":    tableName,
+		"pickup_number": order.PickupNumber,
+		"pickup_time":   order.PickupTime,
+		"ready_at":      order.ReadyAt,
+		"delivery": gin.H{
+			"address":             order.DeliveryAddress,
+			"district":            order.DeliveryDistrict,
+			"latitude":            order.DeliveryLatitude,
+			"longitude":           order.DeliveryLongitude,
+			"distance_km":         order.DeliveryDistanceKm,
+			"zone_id":             order.DeliveryZoneID,
+			"out_for_delivery_at": order.OutForDeliveryAt,
+			"delivered_at":        order.DeliveredAt,
+		},
 		"customer_name":   order.CustomerName,
 		"customer_phone":  order.CustomerPhone,
 		"status":          order.Status,
@@ -245,6 +278,7 @@ func GetOrder(c *gin.Context) {
 		"subtotal":        order.Subtotal,
 		"tax_amount":      order.TaxAmount,
 		"service_charge":  order.ServiceCharge,
+		"delivery_fee":    order.DeliveryFee,
 		"discount_amount": order.DiscountAmount,
 		"total_amount":    order.TotalAmount,
 		"notes":           order.Notes,
@@ -311,8 +345,13 @@ func TrackOrder(c *gin.Context) {
 		"payment_status": order.PaymentStatus,
 		"payment_method": order.PaymentMethod,
 		"total_amount":   order.TotalAmount,
+		"order_type":     order.OrderType,
 		"table_name":     tableName,
 		"table_number":   tableNumber,
+		"pickup_number":  order.PickupNumber,
+		"pickup_time":    order.PickupTime,
+		"delivery_fee":   order.DeliveryFee,
+		"delivered_at":   order.DeliveredAt,
 		"items":          items,
 		"created_at":     order.CreatedAt,
 		"restaurant": gin.H{
@@ -354,6 +393,11 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
+	invoiceBuyer, ok := checkoutInvoiceBuyer(c, input.Invoice)
+	if !ok {
+		return
+	}
+
 	// Tìm bàn theo table_number
 	var table models.Table
 	if err := config.GetDB().Where("restaurant_id = ? AND table_number = ? AND is_active = ?", restaurant.ID, input.TableNumber, true).First(&table).Error; err != nil {
@@ -361,27 +405,20 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
+	// Xác thực token QR của bàn (chống đặt món hộ bàn khác)
+	tableToken := input.TableToken
+	if tableToken == "" {
+		tableToken = publicTableToken(c)
+	}
+	if !authorizePublicTable(c, restaurant, table, tableToken) {
+		return
+	}
+
 	db := config.GetDB()
 	tx := db.Begin()
 
 	// Tạo order number unique (global, không theo restaurant)
-	yearPrefix := fmt.Sprintf("ORD-%d-", time.Now().Year())
-	var maxOrderNum string
-	tx.Model(&models.Order{}).
-		Where("order_number LIKE ?", yearPrefix+"%").
-		Order("order_number DESC").
-		Limit(1).
-		Pluck("order_number", &maxOrderNum)
-
-	nextSeq := 1
-	if maxOrderNum != "" {
-		// VD: "ORD-2026-0015" → lấy "0015" → parse thành 15
-		seqStr := maxOrderNum[len(yearPrefix):]
-		if parsed, err := strconv.Atoi(seqStr); err == nil {
-			nextSeq = parsed + 1
-		}
-	}
-	orderNumber := fmt.Sprintf("%s%04d", yearPrefix, nextSeq)
+	orderNumber := generateOrderNumber(tx)
 
 	// Validate payment method
 	validMethods := []string{"cash", "qr", "momo", "vnpay"}
@@ -405,8 +442,9 @@ func CreateOrder(c *gin.Context) {
 	paymentMethod := input.PaymentMethod
 	order := models.Order{
 		RestaurantID:  restaurant.ID,
-		TableID:       table.ID,
+		TableID:       &table.ID,
 		OrderNumber:   orderNumber,
+		OrderType:     "dine_in",
 		CustomerName:  &input.CustomerName,
 		CustomerPhone: &input.CustomerPhone,
 		Status:        "pending", // Chờ xác nhận
@@ -494,6 +532,15 @@ func CreateOrder(c *gin.Context) {
 		"total_amount":   totalAmount,
 	})
 
+	// Khách yêu cầu xuất hóa đơn: lưu thông tin người mua vào hóa đơn nháp
+	if invoiceBuyer != nil {
+		if _, err := services.SaveInvoiceBuyer(tx, order, *invoiceBuyer); err != nil {
+			tx.Rollback()
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể lưu thông tin xuất hóa đơn", "CREATE_ERROR", err.Error())
+			return
+		}
+	}
+
 	// KHÔNG cập nhật trạng thái bàn - bàn vẫn trống cho đến khi xác nhận thanh toán
 	// tx.Model(&table).Update("status", "occupied") -- BỎ DÒNG NÀY
 
@@ -506,6 +553,9 @@ func CreateOrder(c *gin.Context) {
 	}
 	CreateOrderNotification(restaurant.ID, order.ID, orderNumber, tableName, totalAmount)
 
+	order.TotalAmount = totalAmount
+	services.PublishOrderEvent(services.WebhookEventOrderCreated, order)
+
 	utils.SuccessResponse(c, http.StatusCreated, gin.H{
 		"id":             order.ID,
 		"order_number":   orderNumber,
@@ -519,7 +569,7 @@ func CreateOrder(c *gin.Context) {
 
 // UpdateOrderStatus cập nhật trạng thái đơn hàng
 // @Summary Cập nhật trạng thái đơn hàng
-// @Description Nhà hàng cập nhật trạng thái: confirmed -> serving -> completed
+// @Description Nhà hàng cập nhật trạng thái: confirmed -> serving -> completed. Đơn mang về và đơn giao hàng trả trước chỉ chuyển pending -> confirmed khi đã thanh toán
 // @Tags Orders
 // @Accept json
 // @Produce json
@@ -552,15 +602,8 @@ func UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	// Validate status transitions - Đơn giản hóa: không có bếp
-	// Flow: confirmed -> serving -> completed
-	validTransitions := map[string][]string{
-		"pending":   {"confirmed", "cancelled"},
-		"confirmed": {"serving", "cancelled"},
-		"serving":   {"completed", "cancelled"},
-	}
-
-	allowed, exists := validTransitions[order.Status]
+	// Validate status transitions theo loại đơn
+	allowed, exists := orderStatusTransitions(order.OrderType)[order.Status]
 	if !exists {
 		utils.ErrorResponse(c, http.StatusBadRequest, "Không thể thay đổi trạng thái từ trạng thái hiện tại", "INVALID_TRANSITION", "")
 		return
@@ -579,17 +622,47 @@ func UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
+	// Đơn trả trước chỉ được xác nhận sau khi đã thanh toán (xác nhận tiền mặt/chuyển khoản qua confirm-payment)
+	if order.Status == "pending" && input.Status == "confirmed" && requiresPrepayment(order) && order.PaymentStatus != "paid" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Đơn hàng phải được thanh toán trước khi xác nhận", "ORDER_NOT_PAID", "")
+		return
+	}
+
+	// Đơn đã thanh toán thuộc ngày đã chốt sổ thì không được hủy
+	if input.Status == "cancelled" {
+		if err := services.EnsureOrderDayOpen(config.GetDB(), order); err != nil {
+			_, msg, _ := strings.Cut(err.Error(), ": ")
+			utils.ErrorResponse(c, http.StatusConflict, msg, "DAY_CLOSED", "")
+			return
+		}
+	}
+
 	updates := map[string]interface{}{
 		"status": input.Status,
 	}
 
-	if input.Status == "completed" {
+	if input.Status == "completed" || input.Status == "delivered" {
 		now := time.Now()
 		updates["completed_at"] = now
 	}
 
-	if input.Status == "cancelled" && input.Note != "" {
-		updates["cancel_reason"] = input.Note
+	if input.Status == "out_for_delivery" {
+		updates["out_for_delivery_at"] = time.Now()
+	}
+
+	if input.Status == "delivered" {
+		updates["delivered_at"] = time.Now()
+	}
+
+	if input.Status == "ready_for_pickup" {
+		updates["ready_at"] = time.Now()
+	}
+
+	if input.Status == "cancelled" {
+		updates["cancelled_at"] = time.Now()
+		if input.Note != "" {
+			updates["cancel_reason"] = input.Note
+		}
 	}
 
 	if err := config.GetDB().Model(&order).Updates(updates).Error; err != nil {
@@ -598,10 +671,19 @@ func UpdateOrderStatus(c *gin.Context) {
 	}
 
 	// Nếu completed hoặc cancelled, giải phóng bàn
-	if input.Status == "completed" || input.Status == "cancelled" {
-		config.GetDB().Model(&models.Table{}).Where("id = ?", order.TableID).Update("status", "available")
+	if order.TableID != nil && (input.Status == "completed" || input.Status == "cancelled") {
+		config.GetDB().Model(&models.Table{}).Where("id = ?", *order.TableID).Update("status", "available")
 	}
 
+	services.PublishEvent("order.status_changed", order.RestaurantID, map[string]interface{}{
+		"order_id":      order.ID,
+		"order_number":  order.OrderNumber,
+		"order_type":    order.OrderType,
+		"pickup_number": order.PickupNumber,
+		"from_status":   order.Status,
+		"status":        input.Status,
+	})
+
 	utils.SuccessResponse(c, http.StatusOK, gin.H{
 		"id":     order.ID,
 		"status": input.Status,
@@ -663,15 +745,49 @@ func PayOrder(c *gin.Context) {
 	}
 
 	now := time.Now()
-	if err := config.GetDB().Model(&order).Updates(map[string]interface{}{
-		"payment_status": "paid",
-		"payment_method": input.PaymentMethod,
-		"paid_at":        now,
-	}).Error; err != nil {
+	if err := services.EnsureDayOpen(config.GetDB(), order.RestaurantID, now); err != nil {
+		_, msg, _ := strings.Cut(err.Error(), ": ")
+		utils.ErrorResponse(c, http.StatusConflict, msg, "DAY_CLOSED", "")
+		return
+	}
+
+	userID := currentUserID(c)
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Khóa đơn: chuyển khoản / cổng thanh toán về cùng lúc thì chỉ một bên được ghi nhận
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, order.ID).Error; err != nil {
+			return err
+		}
+		if order.PaymentStatus == "paid" {
+			return errOrderAlreadyPaid
+		}
+
+		if err := tx.Model(&order).Updates(map[string]interface{}{
+			"payment_status": "paid",
+			"payment_method": input.PaymentMethod,
+			"paid_at":        now,
+		}).Error; err != nil {
+			return err
+		}
+
+		order.PaymentStatus = "paid"
+		order.PaymentMethod = &input.PaymentMethod
+		order.PaidAt = &now
+		if err := services.AssignCashShift(tx, &order, userID); err != nil {
+			return err
+		}
+		return services.PostOrderPaymentLedger(tx, order)
+	})
+	if errors.Is(err, errOrderAlreadyPaid) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Đơn hàng đã được thanh toán", "ALREADY_PAID", "")
+		return
+	}
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể cập nhật thanh toán", "UPDATE_ERROR", err.Error())
 		return
 	}
 
+	services.PublishOrderEvent(services.WebhookEventOrderPaid, order)
+
 	utils.SuccessResponse(c, http.StatusOK, gin.H{
 		"order_id":       order.ID,
 		"payment_status": "paid",
@@ -715,27 +831,76 @@ func ConfirmOrderPayment(c *gin.Context) {
 	}
 
 	db := config.GetDB()
+	now := time.Now()
+	wasPaid := order.PaymentStatus == "paid"
+
+	if !wasPaid {
+		if err := services.EnsureDayOpen(db, order.RestaurantID, now); err != nil {
+			_, msg, _ := strings.Cut(err.Error(), ": ")
+			utils.ErrorResponse(c, http.StatusConflict, msg, "DAY_CLOSED", "")
+			return
+		}
+	}
+
 	tx := db.Begin()
 
-	now := time.Now()
+	// Khóa đơn rồi kiểm tra lại: chuyển khoản / cổng thanh toán về cùng lúc không được ghi nhận hai lần
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, order.ID).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể xác nhận thanh toán", "UPDATE_ERROR", err.Error())
+		return
+	}
+	if order.PaymentStatus == "paid" && order.Status != "pending" {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusBadRequest, "Đơn hàng đã được xác nhận thanh toán", "ALREADY_CONFIRMED", "")
+		return
+	}
+	wasPaid = order.PaymentStatus == "paid"
 
 	// Cập nhật order: payment_status = paid, status = confirmed
-	if err := tx.Model(&order).Updates(map[string]interface{}{
+	updates := map[string]interface{}{
 		"payment_status": "paid",
 		"status":         "confirmed",
-		"paid_at":        now,
-	}).Error; err != nil {
+	}
+	if !wasPaid {
+		updates["paid_at"] = now
+	}
+	if err := tx.Model(&order).Updates(updates).Error; err != nil {
 		tx.Rollback()
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể xác nhận thanh toán", "UPDATE_ERROR", err.Error())
 		return
 	}
 
-	// Cập nhật trạng thái order items
-	tx.Model(&models.OrderItem{}).Where("order_id = ?", order.ID).Update("prep_status", "confirmed")
+	// Ghi sổ cái khi đơn chưa được ghi nhận thanh toán trước đó; tiền mặt thì gắn vào ca thu ngân
+	if !wasPaid {
+		paidOrder := order
+		paidOrder.PaidAt = &now
+		if err := services.AssignCashShift(tx, &paidOrder, currentUserID(c)); err != nil {
+			tx.Rollback()
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể xác nhận thanh toán", "UPDATE_ERROR", err.Error())
+			return
+		}
+		if err := services.PostOrderPaymentLedger(tx, paidOrder); err != nil {
+			tx.Rollback()
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể xác nhận thanh toán", "LEDGER_ERROR", err.Error())
+			return
+		}
+	}
 
-	// Cập nhật trạng thái bàn thành occupied
-	if order.Table != nil {
-		tx.Model(&models.Table{}).Where("id = ?", order.TableID).Update("status", "occupied")
+	// Cập nhật trạng thái order items (món đã hủy giữ nguyên, không gửi lại bếp)
+	if err := tx.Model(&models.OrderItem{}).
+		Where("order_id = ? AND prep_status = ?", order.ID, "pending").
+		Update("prep_status", "confirmed").Error; err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể xác nhận thanh toán", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	// Cập nhật trạng thái bàn thành occupied (đơn mang về không có bàn)
+	tableStatus := ""
+	if order.TableID != nil {
+		tx.Model(&models.Table{}).Where("id = ?", *order.TableID).Update("status", "occupied")
+		tableStatus = "occupied"
 	}
 
 	tx.Commit()
@@ -743,6 +908,25 @@ func ConfirmOrderPayment(c *gin.Context) {
 	// Tạo thông báo thành công
 	CreateSystemNotification(order.RestaurantID, "system_success", "Thanh toán đã xác nhận", "Đơn #"+order.OrderNumber+" đã được xác nhận thanh toán")
 
+	// Đơn đã thanh toán qua QR trước đó thì chỉ là xác nhận, không phát lại order.paid
+	fromStatus := order.Status
+	order.Status = "confirmed"
+	if !wasPaid {
+		order.PaymentStatus = "paid"
+		order.PaidAt = &now
+		services.PublishOrderEvent(services.WebhookEventOrderPaid, order)
+	}
+	if fromStatus != order.Status {
+		services.PublishEvent("order.status_changed", order.RestaurantID, map[string]interface{}{
+			"order_id":      order.ID,
+			"order_number":  order.OrderNumber,
+			"order_type":    order.OrderType,
+			"pickup_number": order.PickupNumber,
+			"from_status":   fromStatus,
+			"status":        order.Status,
+		})
+	}
+
 	utils.SuccessResponse(c, http.StatusOK, gin.H{
 		"order_id":       order.ID,
 		"order_number":   order.OrderNumber,
@@ -750,13 +934,13 @@ func ConfirmOrderPayment(c *gin.Context) {
 		"payment_status": "paid",
 		"paid_at":        now,
 		"total_amount":   order.TotalAmount,
-		"table_status":   "occupied",
+		"table_status":   tableStatus,
 	}, "Xác nhận thanh toán thành công! Đơn hàng đã được xác nhận.")
 }
 
 // AddOrderItems thêm món vào đơn hàng hiện tại
 // @Summary Thêm món vào đơn hàng
-// @Description Khách thêm món vào đơn hàng đang phục vụ (Public)
+// @Description Khách thêm món vào đơn tại bàn đang phục vụ, chưa thanh toán (Public, cần token QR của bàn)
 // @Tags Orders
 // @Accept json
 // @Produce json
@@ -774,8 +958,8 @@ func AddOrderItems(c *gin.Context) {
 	}
 
 	// Kiểm tra đơn hàng còn có thể thêm món không
-	if order.Status == "completed" || order.Status == "cancelled" {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Không thể thêm món vào đơn hàng đã hoàn thành hoặc đã hủy", "ORDER_CLOSED", "")
+	if err := checkPublicAddItems(config.GetDB(), order); err != nil {
+		respondPublicAddItemsError(c, err)
 		return
 	}
 
@@ -785,14 +969,42 @@ func AddOrderItems(c *gin.Context) {
 		return
 	}
 
-	// Lấy thông tin nhà hàng
+	db := config.GetDB()
+
+	// Đơn tại bàn: phải có token QR của đúng bàn đó
 	var restaurant models.Restaurant
-	config.GetDB().First(&restaurant, order.RestaurantID)
+	var table models.Table
+	if err := db.First(&restaurant, order.RestaurantID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy nhà hàng", "RESTAURANT_NOT_FOUND", "")
+		return
+	}
+	if err := db.First(&table, *order.TableID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy bàn", "TABLE_NOT_FOUND", "")
+		return
+	}
+
+	tableToken := input.TableToken
+	if tableToken == "" {
+		tableToken = publicTableToken(c)
+	}
+	if !authorizePublicTable(c, restaurant, table, tableToken) {
+		return
+	}
 
-	db := config.GetDB()
 	tx := db.Begin()
 
-	var addedSubtotal float64 = 0
+	// Khóa đơn rồi kiểm tra lại: thanh toán / gộp / đóng đơn đồng thời không lọt giữa lúc kiểm tra và lúc thêm
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, order.ID).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy đơn hàng", "ORDER_NOT_FOUND", "")
+		return
+	}
+	if err := checkPublicAddItems(tx, order); err != nil {
+		tx.Rollback()
+		respondPublicAddItemsError(c, err)
+		return
+	}
+
 	var orderItems []models.OrderItem
 
 	// Lấy tất cả menu item IDs
@@ -822,7 +1034,6 @@ func AddOrderItems(c *gin.Context) {
 		}
 
 		lineTotal := menuItem.Price * float64(itemInput.Quantity)
-		addedSubtotal += lineTotal
 
 		opts := itemInput.SelectedOptions
 		notes := itemInput.Notes
@@ -851,27 +1062,63 @@ func AddOrderItems(c *gin.Context) {
 	}
 
 	// Cập nhật tổng tiền
-	newSubtotal := order.Subtotal + addedSubtotal
-	taxAmount := newSubtotal * restaurant.TaxRate / 100
-	serviceCharge := newSubtotal * restaurant.ServiceCharge / 100
-	totalAmount := newSubtotal + taxAmount + serviceCharge
+	if err := recalculateOrderTotals(tx, &order); err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể cập nhật tổng tiền", "UPDATE_ERROR", err.Error())
+		return
+	}
 
-	tx.Model(&order).Updates(map[string]interface{}{
-		"subtotal":       newSubtotal,
-		"tax_amount":     taxAmount,
-		"service_charge": serviceCharge,
-		"total_amount":   totalAmount,
-	})
+	// Tổng tiền đổi: mã thanh toán đang chờ theo số tiền cũ hết hiệu lực
+	if err := expirePendingPayment(tx, order.ID); err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể thêm món", "UPDATE_ERROR", err.Error())
+		return
+	}
 
-	tx.Commit()
+	if err := tx.Commit().Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể thêm món", "CREATE_ITEM_ERROR", err.Error())
+		return
+	}
 
 	utils.SuccessResponse(c, http.StatusOK, gin.H{
 		"order_id":     order.ID,
-		"total_amount": totalAmount,
+		"total_amount": order.TotalAmount,
 		"items_added":  len(input.Items),
 	}, "Thêm món thành công!")
 }
 
+// checkPublicAddItems khách chỉ được tự thêm món vào đơn tại bàn còn mở và chưa thanh toán
+// (đơn mang về / giao hàng không có token bàn, đơn trả trước đã thu tiền không thu thêm được)
+func checkPublicAddItems(db *gorm.DB, order models.Order) error {
+	if order.OrderType != "dine_in" || order.TableID == nil {
+		return fmt.Errorf("ORDER_NOT_DINE_IN: chỉ đơn tại bàn mới được thêm món")
+	}
+	if !containsString(openOrderStatuses, order.Status) {
+		return fmt.Errorf("ORDER_CLOSED: đơn hàng đã đóng")
+	}
+	if isOrderPaymentSettled(order) {
+		return errOrderAlreadyPaid
+	}
+	// Món thêm được ghi vào ngày hôm nay
+	return services.EnsureDayOpen(db, order.RestaurantID, time.Now())
+}
+
+func respondPublicAddItemsError(c *gin.Context, err error) {
+	code, msg, _ := strings.Cut(err.Error(), ": ")
+	switch code {
+	case "ORDER_NOT_DINE_IN":
+		utils.ErrorResponse(c, http.StatusForbidden, "Chỉ đơn tại bàn mới được thêm món, vui lòng liên hệ nhà hàng", code, "")
+	case "ORDER_CLOSED":
+		utils.ErrorResponse(c, http.StatusBadRequest, "Không thể thêm món vào đơn hàng đã đóng", code, "")
+	case "ORDER_ALREADY_PAID":
+		utils.ErrorResponse(c, http.StatusBadRequest, "Đơn đã thanh toán, vui lòng gọi đơn mới", code, "")
+	case "DAY_CLOSED":
+		utils.ErrorResponse(c, http.StatusConflict, msg, code, "")
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể thêm món", "UPDATE_ERROR", err.Error())
+	}
+}
+
 // GetOrderBill lấy thông tin in bill
 // @Summary Lấy thông tin hóa đơn
 // @Description Lấy thông tin để in bill cho đơn hàng
@@ -1032,3 +1279,105 @@ func GetOrderPaymentQR(c *gin.Context) {
 		"description":    description,
 	}, "")
 }
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// generateOrderNumber tạo order number unique (global, không theo restaurant)
+// VD: ORD-2026-0015
+func generateOrderNumber(tx *gorm.DB) string {
+	yearPrefix := fmt.Sprintf("ORD-%d-", time.Now().Year())
+	var maxOrderNum string
+	tx.Model(&models.Order{}).
+		Where("order_number LIKE ?", yearPrefix+"%").
+		Order("order_number DESC").
+		Limit(1).
+		Pluck("order_number", &maxOrderNum)
+
+	nextSeq := 1
+	if maxOrderNum != "" {
+		// VD: "ORD-2026-0015" → lấy "0015" → parse thành 15
+		seqStr := maxOrderNum[len(yearPrefix):]
+		if parsed, err := strconv.Atoi(seqStr); err == nil {
+			nextSeq = parsed + 1
+		}
+	}
+	return fmt.Sprintf("%s%04d", yearPrefix, nextSeq)
+}
+
+// orderStatusTransitions các bước chuyển trạng thái hợp lệ theo loại đơn
+func orderStatusTransitions(orderType string) map[string][]string {
+	switch orderType {
+	case "takeaway":
+		// Flow: pending (chờ thanh toán) -> confirmed -> ready_for_pickup -> completed (khách đã lấy)
+		return map[string][]string{
+			"pending":          {"confirmed", "cancelled"},
+			"confirmed":        {"ready_for_pickup", "cancelled"},
+			"ready_for_pickup": {"completed"},
+		}
+	case "delivery":
+		// Flow: pending -> confirmed -> out_for_delivery (shipper đã nhận) -> delivered (giao xong)
+		return map[string][]string{
+			"pending":          {"confirmed", "cancelled"},
+			"confirmed":        {"out_for_delivery", "cancelled"},
+			"out_for_delivery": {"delivered", "cancelled"},
+		}
+	default:
+		// Đơn giản hóa: không có bếp
+		// Flow: confirmed -> serving -> completed
+		return map[string][]string{
+			"pending":   {"confirmed", "cancelled"},
+			"confirmed": {"serving", "cancelled"},
+			"serving":   {"completed", "cancelled"},
+		}
+	}
+}
+
+// requiresPrepayment đơn bắt buộc trả trước: mang về luôn trả trước, giao hàng khi khách chọn trả qua QR
+func requiresPrepayment(order models.Order) bool {
+	switch order.OrderType {
+	case "takeaway":
+		return true
+	case "delivery":
+		return order.PaymentTiming == "before"
+	}
+	return false
+}
+
+// recalculateOrderTotals tính lại subtotal/thuế/phí dịch vụ/tổng tiền từ các món trong đơn
+// Món đã hủy không được tính, phí giao hàng cộng thẳng vào tổng (không tính thuế)
+func recalculateOrderTotals(tx *gorm.DB, order *models.Order) error {
+	var restaurant models.Restaurant
+	if err := tx.First(&restaurant, order.RestaurantID).Error; err != nil {
+		return err
+	}
+
+	var subtotal float64
+	if err := tx.Model(&models.OrderItem{}).
+		Where("order_id = ? AND prep_status <> ?", order.ID, "cancelled").
+		Select("COALESCE(SUM(line_total), 0)").
+		Scan(&subtotal).Error; err != nil {
+		return err
+	}
+
+	order.Subtotal = subtotal
+	order.TaxAmount = subtotal * restaurant.TaxRate / 100
+	order.ServiceCharge = subtotal * restaurant.ServiceCharge / 100
+	order.TotalAmount = subtotal + order.TaxAmount + order.ServiceCharge + order.DeliveryFee - order.DiscountAmount
+	if order.TotalAmount < 0 {
+		order.TotalAmount = 0
+	}
+
+	if err := tx.Model(&models.Order{}).Where("id = ?", order.ID).Updates(map[string]interface{}{
+		"subtotal":       order.Subtotal,
+		"tax_amount":     order.TaxAmount,
+		"service_charge": order.ServiceCharge,
+		"total_amount":   order.TotalAmount,
+	}).Error; err != nil {
+		return err
+	}
+
+	// Đơn đã ghi doanh thu: ghi bút toán điều chỉnh phần chênh lệch
+	return services.PostOrderAdjustmentLedger(tx, *order, "tính lại tổng tiền")
+}
@@ -0,0 +1,507 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/config"
+	"go-api/middleware"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Quy tắc sửa / hủy món theo trạng thái chế biến:
+//   - pending, confirmed: sửa tự do
+//   - preparing, ready, served: cần quản lý xác nhận (manager_override)
+//   - cancelled: không thể thay đổi
+var (
+	freeEditPrepStatuses     = []string{"pending", "confirmed"}
+	overrideEditPrepStatuses = []string{"preparing", "ready", "served"}
+)
+
+// Chuyển trạng thái chế biến của món (bếp / bar / phục vụ)
+var prepStatusTransitions = map[string][]string{
+	"confirmed": {"preparing", "ready"},
+	"preparing": {"ready"},
+	"ready":     {"served"},
+}
+
+// ===============================
+// REQUEST STRUCTS
+// ===============================
+
+// UpdateOrderItemInput request body cho sửa món trong đơn
+type UpdateOrderItemInput struct {
+	Quantity        int     `json:"quantity" binding:"omitempty,min=1"`
+	Notes           *string `json:"notes"`
+	Reason          string  `json:"reason" binding:"required"`
+	ManagerOverride bool    `json:"manager_override"`
+}
+
+// UpdatePrepStatusInput request body cho cập nhật trạng thái chế biến món
+type UpdatePrepStatusInput struct {
+	PrepStatus string `json:"prep_status" binding:"required,oneof=preparing ready served"`
+}
+
+// CancelOrderItemInput request body cho hủy món trong đơn
+type CancelOrderItemInput struct {
+	Reason          string `json:"reason" binding:"required"`
+	ManagerOverride bool   `json:"manager_override"`
+}
+
+// ===============================
+// HANDLERS
+// ===============================
+
+// UpdateOrderItem sửa số lượng / ghi chú của một món trong đơn
+// @Summary Sửa món trong đơn
+// @Description Sửa tự do khi món chưa chế biến; món đang làm / đã xong cần manager_override. Đơn đã thanh toán chỉ sửa được ghi chú
+// @Tags Orders
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param itemId path int true "Order Item ID"
+// @Param body body UpdateOrderItemInput true "Thông tin sửa"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /orders/{id}/items/{itemId} [put]
+func UpdateOrderItem(c *gin.Context) {
+	var input UpdateOrderItemInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+	if input.Quantity == 0 && input.Notes == nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Không có thay đổi nào", "NO_CHANGES", "")
+		return
+	}
+
+	order, item, ok := loadEditableOrderItem(c, input.ManagerOverride)
+	if !ok {
+		return
+	}
+
+	// Đơn đã thanh toán không được đổi số lượng (giảm tiền phải hoàn qua /orders/{id}/refund)
+	if isOrderPaymentSettled(order) && input.Quantity > 0 && input.Quantity != item.Quantity {
+		respondOrderAlreadyPaid(c)
+		return
+	}
+
+	change := models.OrderItemChange{
+		RestaurantID:    order.RestaurantID,
+		OrderID:         order.ID,
+		OrderItemID:     item.ID,
+		Action:          "update",
+		PrepStatus:      item.PrepStatus,
+		OldQuantity:     item.Quantity,
+		NewQuantity:     item.Quantity,
+		OldLineTotal:    item.LineTotal,
+		NewLineTotal:    item.LineTotal,
+		OldNotes:        item.Notes,
+		NewNotes:        item.Notes,
+		Reason:          input.Reason,
+		ManagerOverride: input.ManagerOverride && !containsString(freeEditPrepStatuses, item.PrepStatus),
+		ChangedBy:       currentUserID(c),
+	}
+
+	updates := map[string]interface{}{}
+	if input.Quantity > 0 && input.Quantity != item.Quantity {
+		unitTotal := item.LineTotal / float64(item.Quantity)
+		change.NewQuantity = input.Quantity
+		change.NewLineTotal = unitTotal * float64(input.Quantity)
+		updates["quantity"] = change.NewQuantity
+		updates["line_total"] = change.NewLineTotal
+	}
+	if input.Notes != nil {
+		change.NewNotes = input.Notes
+		updates["notes"] = *input.Notes
+	}
+
+	if len(updates) == 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Không có thay đổi nào", "NO_CHANGES", "")
+		return
+	}
+
+	if err := applyOrderItemChange(&order, &item, updates, &change); err != nil {
+		if errors.Is(err, errOrderAlreadyPaid) {
+			respondOrderAlreadyPaid(c)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể sửa món", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	notifyOrderItemChange(order, item, change)
+
+	utils.SuccessResponse(c, http.StatusOK, orderItemChangeResponse(order, item, change), "Đã cập nhật món")
+}
+
+// CancelOrderItem hủy một món trong đơn
+// @Summary Hủy món trong đơn
+// @Description Hủy tự do khi món chưa chế biến; món đang làm / đã xong cần manager_override. Đơn đã thanh toán không hủy được món (hoàn tiền qua /orders/{id}/refund)
+// @Tags Orders
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param itemId path int true "Order Item ID"
+// @Param body body CancelOrderItemInput true "Lý do hủy"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /orders/{id}/items/{itemId}/cancel [put]
+func CancelOrderItem(c *gin.Context) {
+	var input CancelOrderItemInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	order, item, ok := loadEditableOrderItem(c, input.ManagerOverride)
+	if !ok {
+		return
+	}
+
+	// Đơn đã thanh toán không được hủy món (hoàn tiền qua /orders/{id}/refund)
+	if isOrderPaymentSettled(order) {
+		respondOrderAlreadyPaid(c)
+		return
+	}
+
+	change := models.OrderItemChange{
+		RestaurantID:    order.RestaurantID,
+		OrderID:         order.ID,
+		OrderItemID:     item.ID,
+		Action:          "cancel",
+		PrepStatus:      item.PrepStatus,
+		OldQuantity:     item.Quantity,
+		NewQuantity:     0,
+		OldLineTotal:    item.LineTotal,
+		NewLineTotal:    0,
+		OldNotes:        item.Notes,
+		NewNotes:        item.Notes,
+		Reason:          input.Reason,
+		ManagerOverride: input.ManagerOverride && !containsString(freeEditPrepStatuses, item.PrepStatus),
+		ChangedBy:       currentUserID(c),
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"prep_status":   "cancelled",
+		"cancel_reason": input.Reason,
+		"cancelled_at":  now,
+	}
+
+	if err := applyOrderItemChange(&order, &item, updates, &change); err != nil {
+		if errors.Is(err, errOrderAlreadyPaid) {
+			respondOrderAlreadyPaid(c)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể hủy món", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	notifyOrderItemChange(order, item, change)
+
+	utils.SuccessResponse(c, http.StatusOK, orderItemChangeResponse(order, item, change), "Đã hủy món")
+}
+
+// UpdateOrderItemPrepStatus cập nhật trạng thái chế biến của một món
+// @Summary Cập nhật trạng thái chế biến món
+// @Description Bếp / bar / phục vụ chuyển món: confirmed → preparing → ready → served
+// @Tags Orders
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param itemId path int true "Order Item ID"
+// @Param body body UpdatePrepStatusInput true "Trạng thái mới"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /orders/{id}/items/{itemId}/prep-status [put]
+func UpdateOrderItemPrepStatus(c *gin.Context) {
+	var input UpdatePrepStatusInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	orderID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	itemID, _ := strconv.ParseUint(c.Param("itemId"), 10, 32)
+	db := config.GetDB()
+
+	var order models.Order
+	if err := db.First(&order, orderID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy đơn hàng", "ORDER_NOT_FOUND", "")
+		return
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || order.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền cập nhật đơn hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	if !containsString(openOrderStatuses, order.Status) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Đơn hàng đã đóng", "ORDER_CLOSED", "")
+		return
+	}
+
+	var item models.OrderItem
+	if err := db.Where("id = ? AND order_id = ?", itemID, order.ID).First(&item).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy món trong đơn", "ORDER_ITEM_NOT_FOUND", "")
+		return
+	}
+
+	if !containsString(prepStatusTransitions[item.PrepStatus], input.PrepStatus) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Không thể chuyển trạng thái món", "INVALID_PREP_STATUS_TRANSITION", item.PrepStatus+" → "+input.PrepStatus)
+		return
+	}
+
+	oldStatus := item.PrepStatus
+	if err := db.Model(&item).Update("prep_status", input.PrepStatus).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể cập nhật món", "UPDATE_ERROR", err.Error())
+		return
+	}
+	item.PrepStatus = input.PrepStatus
+
+	services.PublishEvent("order_item.prep_status_changed", order.RestaurantID, map[string]interface{}{
+		"order_id":      order.ID,
+		"order_number":  order.OrderNumber,
+		"table_id":      order.TableID,
+		"order_item_id": item.ID,
+		"item_name":     item.ItemName,
+		"station":       item.PrepLocation,
+		"old_status":    oldStatus,
+		"prep_status":   item.PrepStatus,
+		"updated_by":    currentUserID(c),
+	})
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"id":            item.ID,
+		"order_id":      order.ID,
+		"name":          item.ItemName,
+		"quantity":      item.Quantity,
+		"prep_status":   item.PrepStatus,
+		"prep_location": item.PrepLocation,
+	}, "Đã cập nhật trạng thái món")
+}
+
+// GetOrderItemChanges lấy lịch sử sửa / hủy món của đơn hàng
+// @Summary Lịch sử sửa món
+// @Description Lấy các lần sửa số lượng, ghi chú hoặc hủy món của đơn hàng
+// @Tags Orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /orders/{id}/item-changes [get]
+func GetOrderItemChanges(c *gin.Context) {
+	orderID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	db := config.GetDB()
+
+	var order models.Order
+	if err := db.First(&order, orderID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy đơn hàng", "ORDER_NOT_FOUND", "")
+		return
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || order.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem đơn hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var changes []models.OrderItemChange
+	db.Where("order_id = ?", order.ID).Order("created_at ASC").Find(&changes)
+
+	utils.SuccessResponse(c, http.StatusOK, changes, "")
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// loadEditableOrderItem lấy đơn + món từ URL và kiểm tra quyền sửa theo trạng thái chế biến
+func loadEditableOrderItem(c *gin.Context, managerOverride bool) (models.Order, models.OrderItem, bool) {
+	orderID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	itemID, _ := strconv.ParseUint(c.Param("itemId"), 10, 32)
+	db := config.GetDB()
+
+	var order models.Order
+	var item models.OrderItem
+
+	if err := db.First(&order, orderID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy đơn hàng", "ORDER_NOT_FOUND", "")
+		return order, item, false
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || order.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền sửa đơn hàng này", "FORBIDDEN", "")
+		return order, item, false
+	}
+
+	if !containsString(openOrderStatuses, order.Status) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Đơn hàng đã đóng, không thể sửa món", "ORDER_CLOSED", "")
+		return order, item, false
+	}
+
+	// Đơn đã thanh toán thuộc ngày đã chốt sổ thì không được sửa
+	if err := services.EnsureOrderDayOpen(db, order); err != nil {
+		_, msg, _ := strings.Cut(err.Error(), ": ")
+		utils.ErrorResponse(c, http.StatusConflict, msg, "DAY_CLOSED", "")
+		return order, item, false
+	}
+
+	if err := db.Where("id = ? AND order_id = ?", itemID, order.ID).First(&item).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy món trong đơn", "ORDER_ITEM_NOT_FOUND", "")
+		return order, item, false
+	}
+
+	switch {
+	case containsString(freeEditPrepStatuses, item.PrepStatus):
+		// Chưa chế biến -> sửa tự do
+	case containsString(overrideEditPrepStatuses, item.PrepStatus):
+		if !managerOverride {
+			utils.ErrorResponse(c, http.StatusConflict, "Món đã được chế biến, cần quản lý xác nhận", "MANAGER_OVERRIDE_REQUIRED", item.PrepStatus)
+			return order, item, false
+		}
+		if !canOverridePreparedItems(c) {
+			utils.ErrorResponse(c, http.StatusForbidden, "Chỉ quản lý mới được sửa món đã chế biến", "FORBIDDEN", "")
+			return order, item, false
+		}
+	default:
+		utils.ErrorResponse(c, http.StatusBadRequest, "Món đã hủy, không thể thay đổi", "ORDER_ITEM_LOCKED", item.PrepStatus)
+		return order, item, false
+	}
+
+	return order, item, true
+}
+
+// canOverridePreparedItems kiểm tra người dùng có quyền quản lý để sửa món đã chế biến
+func canOverridePreparedItems(c *gin.Context) bool {
+	return middleware.HasPermission(c, middleware.PermOrdersOverride)
+}
+
+// currentUserID lấy user_id của người đang đăng nhập
+func currentUserID(c *gin.Context) uint {
+	userID, _ := c.Get("user_id")
+	id, _ := userID.(uint)
+	return id
+}
+
+// errOrderAlreadyPaid đơn vừa được thanh toán trong lúc sửa món
+var errOrderAlreadyPaid = errors.New("ORDER_ALREADY_PAID: đơn đã thanh toán")
+
+// isOrderPaymentSettled đơn đã thanh toán (hoặc đã hoàn tiền): tổng tiền đã ghi sổ, không được đổi
+func isOrderPaymentSettled(order models.Order) bool {
+	return order.PaymentStatus == "paid" || order.PaymentStatus == "refunded"
+}
+
+func respondOrderAlreadyPaid(c *gin.Context) {
+	utils.ErrorResponse(c, http.StatusBadRequest, "Đơn đã thanh toán, không thể đổi số lượng hoặc hủy món. Vui lòng hoàn tiền cho khách", "ORDER_ALREADY_PAID", "")
+}
+
+// applyOrderItemChange cập nhật món, tính lại tổng tiền và ghi lịch sử trong một transaction
+func applyOrderItemChange(order *models.Order, item *models.OrderItem, updates map[string]interface{}, change *models.OrderItemChange) error {
+	return config.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Khóa đơn để thanh toán đồng thời không lọt giữa lúc kiểm tra và lúc sửa
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(order, order.ID).Error; err != nil {
+			return err
+		}
+		if change.NewLineTotal != change.OldLineTotal && isOrderPaymentSettled(*order) {
+			return errOrderAlreadyPaid
+		}
+
+		if err := tx.Model(item).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.First(item, item.ID).Error; err != nil {
+			return err
+		}
+
+		if err := recalculateOrderTotals(tx, order); err != nil {
+			return err
+		}
+
+		// Tổng tiền thay đổi -> mã QR cũ không còn đúng số tiền
+		if err := expirePendingPayment(tx, order.ID); err != nil {
+			return err
+		}
+
+		return tx.Create(change).Error
+	})
+}
+
+// notifyOrderItemChange báo cho quầy chế biến (bếp / bar) về món bị sửa hoặc hủy
+func notifyOrderItemChange(order models.Order, item models.OrderItem, change models.OrderItemChange) {
+	eventData := map[string]interface{}{
+		"order_id":      order.ID,
+		"order_number":  order.OrderNumber,
+		"order_item_id": item.ID,
+		"item_name":     item.ItemName,
+		"station":       item.PrepLocation,
+		"action":        change.Action,
+		"old_quantity":  change.OldQuantity,
+		"new_quantity":  change.NewQuantity,
+		"reason":        change.Reason,
+	}
+	eventType := "order_item.updated"
+	if change.Action == "cancel" {
+		eventType = "order_item.cancelled"
+	}
+	services.PublishEvent(eventType, order.RestaurantID, eventData)
+
+	// Món chưa được gửi xuống quầy thì không cần thông báo
+	if change.PrepStatus == "pending" {
+		return
+	}
+
+	title := fmt.Sprintf("[%s] Sửa món đơn #%s", stationLabel(item.PrepLocation), order.OrderNumber)
+	message := fmt.Sprintf("%s: %d → %d • %s", item.ItemName, change.OldQuantity, change.NewQuantity, change.Reason)
+	if change.Action == "cancel" {
+		title = fmt.Sprintf("[%s] Hủy món đơn #%s", stationLabel(item.PrepLocation), order.OrderNumber)
+		message = fmt.Sprintf("%s x%d • %s", item.ItemName, change.OldQuantity, change.Reason)
+	}
+
+	CreateNotification(order.RestaurantID, "order_item_"+change.Action, title, message, eventData)
+}
+
+// stationLabel tên hiển thị của quầy chế biến
+func stationLabel(prepLocation string) string {
+	return services.PrepStationLabel(prepLocation)
+}
+
+func orderItemChangeResponse(order models.Order, item models.OrderItem, change models.OrderItemChange) gin.H {
+	return gin.H{
+		"change_id": change.ID,
+		"action":    change.Action,
+		"item": gin.H{
+			"id":            item.ID,
+			"name":          item.ItemName,
+			"quantity":      item.Quantity,
+			"line_total":    item.LineTotal,
+			"notes":         item.Notes,
+			"prep_status":   item.PrepStatus,
+			"prep_location": item.PrepLocation,
+		},
+		"order":            orderTotalsResponse(order),
+		"manager_override": change.ManagerOverride,
+	}
+}
@@ -0,0 +1,612 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-api/config"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// openOrderStatuses các trạng thái đơn hàng còn đang phục vụ
+var openOrderStatuses = []string{"pending", "confirmed", "serving", "ready_for_pickup", "out_for_delivery"}
+
+// ===============================
+// REQUEST STRUCTS
+// ===============================
+
+// MoveOrderItemInput món cần chuyển (bỏ trống quantity = chuyển toàn bộ số lượng)
+type MoveOrderItemInput struct {
+	OrderItemID uint `json:"order_item_id" binding:"required"`
+	Quantity    int  `json:"quantity"`
+}
+
+// TransferOrderInput request body cho chuyển bàn
+// Không truyền items = chuyển cả đơn sang bàn mới
+type TransferOrderInput struct {
+	TableID uint                 `json:"table_id" binding:"required"`
+	Items   []MoveOrderItemInput `json:"items"`
+	Reason  string               `json:"reason"`
+}
+
+// MergeOrderInput request body cho gộp đơn
+type MergeOrderInput struct {
+	SourceOrderID uint   `json:"source_order_id" binding:"required"`
+	Reason        string `json:"reason"`
+}
+
+// ===============================
+// HANDLERS
+// ===============================
+
+// TransferOrder chuyển đơn hàng (hoặc một số món) sang bàn khác
+// @Summary Chuyển bàn
+// @Description Chuyển cả đơn sang bàn trống, hoặc chuyển một số món sang bàn khác (gộp vào đơn đang mở của bàn đó hoặc tách thành đơn mới)
+// @Tags Orders
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param body body TransferOrderInput true "Bàn đích và danh sách món"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /orders/{id}/transfer [put]
+func TransferOrder(c *gin.Context) {
+	orderID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	db := config.GetDB()
+
+	var order models.Order
+	if err := db.First(&order, orderID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy đơn hàng", "ORDER_NOT_FOUND", "")
+		return
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || order.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền chuyển đơn hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	if !containsString(openOrderStatuses, order.Status) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Đơn hàng đã đóng, không thể chuyển bàn", "ORDER_CLOSED", "")
+		return
+	}
+
+	if order.TableID == nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Chỉ chuyển bàn được với đơn tại bàn", "NOT_DINE_IN_ORDER", order.OrderType)
+		return
+	}
+
+	var input TransferOrderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	if input.TableID == *order.TableID {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Bàn đích trùng với bàn hiện tại", "SAME_TABLE", "")
+		return
+	}
+
+	var targetTable models.Table
+	if err := db.Where("id = ? AND restaurant_id = ? AND is_active = ?", input.TableID, order.RestaurantID, true).First(&targetTable).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Bàn đích không tồn tại", "TABLE_NOT_FOUND", "")
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	movedBy, _ := userID.(uint)
+
+	tx := db.Begin()
+
+	// Khóa đơn nguồn và kiểm tra lại: đơn có thể vừa được thanh toán / đóng sau bước kiểm tra ở trên
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, order.ID).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể chuyển bàn", "UPDATE_ERROR", err.Error())
+		return
+	}
+	if !containsString(openOrderStatuses, order.Status) || order.TableID == nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusBadRequest, "Đơn hàng đã đóng, không thể chuyển bàn", "ORDER_CLOSED", "")
+		return
+	}
+
+	var move *models.OrderMove
+	var targetOrder models.Order
+	var err error
+
+	if len(input.Items) == 0 {
+		move, err = transferWholeOrder(tx, &order, targetTable)
+		targetOrder = order
+	} else {
+		move, targetOrder, err = moveOrderItems(tx, &order, targetTable, input.Items)
+	}
+	if err != nil {
+		tx.Rollback()
+		respondOrderMoveError(c, err)
+		return
+	}
+
+	move.MovedBy = movedBy
+	if input.Reason != "" {
+		move.Reason = &input.Reason
+	}
+	if err := tx.Create(move).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể lưu lịch sử chuyển bàn", "CREATE_ERROR", err.Error())
+		return
+	}
+
+	syncTableStatus(tx, move.FromTableID)
+	syncTableStatus(tx, move.ToTableID)
+
+	if err := tx.Commit().Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể chuyển bàn", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	CreateSystemNotification(order.RestaurantID, "order_moved", "Chuyển bàn đơn #"+order.OrderNumber,
+		fmt.Sprintf("Đã chuyển sang %s (đơn #%s)", tableDisplayName(targetTable), targetOrder.OrderNumber))
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"move_id":       move.ID,
+		"type":          move.Type,
+		"source_order":  orderTotalsResponse(order),
+		"target_order":  orderTotalsResponse(targetOrder),
+		"from_table_id": move.FromTableID,
+		"to_table_id":   move.ToTableID,
+	}, "Chuyển bàn thành công")
+}
+
+// MergeOrders gộp một đơn hàng khác vào đơn hiện tại
+// @Summary Gộp đơn
+// @Description Chuyển toàn bộ món của đơn nguồn vào đơn hiện tại, đơn nguồn chuyển sang trạng thái merged. Chỉ gộp các đơn chưa thanh toán
+// @Tags Orders
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID (đơn đích)"
+// @Param body body MergeOrderInput true "Đơn nguồn"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /orders/{id}/merge [post]
+func MergeOrders(c *gin.Context) {
+	orderID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	db := config.GetDB()
+
+	var target models.Order
+	if err := db.First(&target, orderID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy đơn hàng", "ORDER_NOT_FOUND", "")
+		return
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || target.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền gộp đơn hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var input MergeOrderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	if input.SourceOrderID == target.ID {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Không thể gộp đơn với chính nó", "SAME_ORDER", "")
+		return
+	}
+
+	var source models.Order
+	if err := db.Where("id = ? AND restaurant_id = ?", input.SourceOrderID, target.RestaurantID).First(&source).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy đơn cần gộp", "ORDER_NOT_FOUND", "")
+		return
+	}
+
+	if !containsString(openOrderStatuses, target.Status) || !containsString(openOrderStatuses, source.Status) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Chỉ gộp được các đơn đang phục vụ", "ORDER_CLOSED", "")
+		return
+	}
+
+	if target.TableID == nil || source.TableID == nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Chỉ gộp được các đơn tại bàn", "NOT_DINE_IN_ORDER", "")
+		return
+	}
+
+	// Tổng tiền đơn đã thanh toán đã ghi sổ, gộp sẽ làm lệch doanh thu giữa hai đơn
+	if err := checkMergeablePayment(source, target); err != nil {
+		respondOrderMoveError(c, err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	movedBy, _ := userID.(uint)
+
+	tx := db.Begin()
+
+	// Khóa hai đơn và kiểm tra lại: đơn có thể vừa được thanh toán sau bước kiểm tra ở trên
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&source, source.ID).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể gộp đơn", "UPDATE_ERROR", err.Error())
+		return
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&target, target.ID).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể gộp đơn", "UPDATE_ERROR", err.Error())
+		return
+	}
+	if err := checkMergeablePayment(source, target); err != nil {
+		tx.Rollback()
+		respondOrderMoveError(c, err)
+		return
+	}
+
+	var items []models.OrderItem
+	tx.Where("order_id = ?", source.ID).Find(&items)
+
+	var movedItems []MoveOrderItemInput
+	for _, item := range items {
+		movedItems = append(movedItems, MoveOrderItemInput{OrderItemID: item.ID, Quantity: item.Quantity})
+	}
+
+	if err := tx.Model(&models.OrderItem{}).Where("order_id = ?", source.ID).Update("order_id", target.ID).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể gộp đơn", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	mergedAmount := source.TotalAmount
+	if err := closeMergedOrder(tx, &source, target.OrderNumber); err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể gộp đơn", "UPDATE_ERROR", err.Error())
+		return
+	}
+	if err := recalculateOrderTotals(tx, &target); err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể cập nhật tổng tiền", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	// Tổng tiền thay đổi -> mã QR cũ không còn đúng số tiền
+	if err := expirePendingPayment(tx, target.ID); err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể gộp đơn", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	itemsJSON, _ := json.Marshal(movedItems)
+	move := models.OrderMove{
+		RestaurantID:  target.RestaurantID,
+		Type:          "merge",
+		SourceOrderID: source.ID,
+		TargetOrderID: target.ID,
+		FromTableID:   *source.TableID,
+		ToTableID:     *target.TableID,
+		Items:         stringPtr(string(itemsJSON)),
+		Amount:        mergedAmount,
+		MovedBy:       movedBy,
+	}
+	if input.Reason != "" {
+		move.Reason = &input.Reason
+	}
+	if err := tx.Create(&move).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể lưu lịch sử gộp đơn", "CREATE_ERROR", err.Error())
+		return
+	}
+
+	syncTableStatus(tx, *source.TableID)
+	syncTableStatus(tx, *target.TableID)
+
+	if err := tx.Commit().Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể gộp đơn", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	CreateSystemNotification(target.RestaurantID, "order_moved", "Gộp đơn #"+source.OrderNumber,
+		"Đã gộp vào đơn #"+target.OrderNumber+" • "+formatCurrency(target.TotalAmount))
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"move_id":      move.ID,
+		"type":         move.Type,
+		"source_order": orderTotalsResponse(source),
+		"target_order": orderTotalsResponse(target),
+		"items_moved":  len(items),
+	}, "Gộp đơn thành công")
+}
+
+// GetOrderMoves lấy lịch sử chuyển bàn / gộp đơn của đơn hàng
+// @Summary Lịch sử chuyển bàn
+// @Description Lấy các lần chuyển bàn, chuyển món, gộp đơn liên quan tới đơn hàng
+// @Tags Orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /orders/{id}/moves [get]
+func GetOrderMoves(c *gin.Context) {
+	orderID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	db := config.GetDB()
+
+	var order models.Order
+	if err := db.First(&order, orderID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy đơn hàng", "ORDER_NOT_FOUND", "")
+		return
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || order.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem đơn hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var moves []models.OrderMove
+	db.Where("source_order_id = ? OR target_order_id = ?", order.ID, order.ID).
+		Order("created_at ASC").
+		Find(&moves)
+
+	utils.SuccessResponse(c, http.StatusOK, moves, "")
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// errOrderMove lỗi nghiệp vụ khi chuyển bàn (trả về 4xx thay vì 500)
+type errOrderMove struct {
+	status  int
+	message string
+	code    string
+	details string
+}
+
+func (e *errOrderMove) Error() string {
+	return e.code + ": " + e.message
+}
+
+func respondOrderMoveError(c *gin.Context, err error) {
+	var moveErr *errOrderMove
+	if errors.As(err, &moveErr) {
+		utils.ErrorResponse(c, moveErr.status, moveErr.message, moveErr.code, moveErr.details)
+		return
+	}
+	utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể chuyển bàn", "UPDATE_ERROR", err.Error())
+}
+
+// transferWholeOrder chuyển cả đơn sang bàn khác (bàn đích không được có đơn đang mở)
+func transferWholeOrder(tx *gorm.DB, order *models.Order, targetTable models.Table) (*models.OrderMove, error) {
+	var openCount int64
+	tx.Model(&models.Order{}).
+		Where("table_id = ? AND status IN ? AND id <> ?", targetTable.ID, openOrderStatuses, order.ID).
+		Count(&openCount)
+	if openCount > 0 {
+		return nil, &errOrderMove{http.StatusConflict, "Bàn đích đang có đơn, vui lòng dùng chức năng gộp đơn", "TARGET_TABLE_OCCUPIED", ""}
+	}
+
+	fromTableID := *order.TableID
+	if err := tx.Model(order).Update("table_id", targetTable.ID).Error; err != nil {
+		return nil, err
+	}
+	order.TableID = &targetTable.ID
+
+	return &models.OrderMove{
+		RestaurantID:  order.RestaurantID,
+		Type:          "transfer",
+		SourceOrderID: order.ID,
+		TargetOrderID: order.ID,
+		FromTableID:   fromTableID,
+		ToTableID:     targetTable.ID,
+		Amount:        order.TotalAmount,
+	}, nil
+}
+
+// moveOrderItems chuyển một số món sang bàn khác
+// Bàn đích có đơn đang mở thì gộp vào đơn đó, nếu không thì tách thành đơn mới
+func moveOrderItems(tx *gorm.DB, source *models.Order, targetTable models.Table, inputs []MoveOrderItemInput) (*models.OrderMove, models.Order, error) {
+	var target models.Order
+
+	// Đổi món giữa các đơn làm thay đổi số tiền, chỉ áp dụng cho đơn chưa thanh toán
+	if isOrderPaymentSettled(*source) {
+		return nil, target, &errOrderMove{http.StatusBadRequest, "Đơn đã thanh toán, chỉ có thể chuyển cả đơn", "ORDER_ALREADY_PAID", ""}
+	}
+
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("table_id = ? AND status IN ?", targetTable.ID, openOrderStatuses).
+		Order("created_at DESC").
+		First(&target).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, target, err
+	}
+
+	if target.ID > 0 {
+		if isOrderPaymentSettled(target) {
+			return nil, target, &errOrderMove{http.StatusBadRequest, "Đơn của bàn đích đã thanh toán", "TARGET_ORDER_PAID", target.OrderNumber}
+		}
+	} else {
+		target = models.Order{
+			RestaurantID:  source.RestaurantID,
+			TableID:       &targetTable.ID,
+			OrderNumber:   generateOrderNumber(tx),
+			OrderType:     "dine_in",
+			CustomerName:  source.CustomerName,
+			CustomerPhone: source.CustomerPhone,
+			Status:        source.Status,
+			PaymentTiming: source.PaymentTiming,
+			PaymentStatus: "unpaid",
+			PaymentMethod: source.PaymentMethod,
+		}
+		if err := tx.Create(&target).Error; err != nil {
+			return nil, target, err
+		}
+	}
+
+	var movedAmount float64
+	var moved []MoveOrderItemInput
+
+	for _, in := range inputs {
+		var item models.OrderItem
+		if err := tx.Where("id = ? AND order_id = ?", in.OrderItemID, source.ID).First(&item).Error; err != nil {
+			return nil, target, &errOrderMove{http.StatusBadRequest, "Món không thuộc đơn hàng này", "ORDER_ITEM_NOT_FOUND", strconv.Itoa(int(in.OrderItemID))}
+		}
+		if item.PrepStatus == "cancelled" {
+			return nil, target, &errOrderMove{http.StatusBadRequest, "Món đã hủy, không thể chuyển", "ORDER_ITEM_CANCELLED", item.ItemName}
+		}
+
+		qty := in.Quantity
+		if qty <= 0 {
+			qty = item.Quantity
+		}
+		if qty > item.Quantity {
+			return nil, target, &errOrderMove{http.StatusBadRequest, "Số lượng chuyển vượt quá số lượng món", "INVALID_QUANTITY",
+				fmt.Sprintf("%s: %d > %d", item.ItemName, qty, item.Quantity)}
+		}
+
+		if qty == item.Quantity {
+			// Chuyển nguyên dòng món
+			if err := tx.Model(&item).Update("order_id", target.ID).Error; err != nil {
+				return nil, target, err
+			}
+			movedAmount += item.LineTotal
+		} else {
+			// Tách dòng món: giảm số lượng ở đơn nguồn, tạo dòng mới ở đơn đích
+			unitTotal := item.LineTotal / float64(item.Quantity)
+			if err := tx.Model(&item).Updates(map[string]interface{}{
+				"quantity":   item.Quantity - qty,
+				"line_total": unitTotal * float64(item.Quantity-qty),
+			}).Error; err != nil {
+				return nil, target, err
+			}
+
+			split := item
+			split.ID = 0
+			split.OrderID = target.ID
+			split.Quantity = qty
+			split.LineTotal = unitTotal * float64(qty)
+			split.CreatedAt = item.CreatedAt
+			if err := tx.Create(&split).Error; err != nil {
+				return nil, target, err
+			}
+			movedAmount += split.LineTotal
+		}
+
+		moved = append(moved, MoveOrderItemInput{OrderItemID: item.ID, Quantity: qty})
+	}
+
+	// Đơn nguồn hết món -> đóng lại
+	var remaining int64
+	tx.Model(&models.OrderItem{}).Where("order_id = ? AND prep_status <> ?", source.ID, "cancelled").Count(&remaining)
+	if remaining == 0 {
+		if err := closeMergedOrder(tx, source, target.OrderNumber); err != nil {
+			return nil, target, err
+		}
+	} else if err := recalculateOrderTotals(tx, source); err != nil {
+		return nil, target, err
+	}
+
+	if err := recalculateOrderTotals(tx, &target); err != nil {
+		return nil, target, err
+	}
+
+	// Tổng tiền thay đổi -> mã QR cũ không còn đúng số tiền
+	if err := expirePendingPayment(tx, source.ID, target.ID); err != nil {
+		return nil, target, err
+	}
+
+	itemsJSON, _ := json.Marshal(moved)
+	return &models.OrderMove{
+		RestaurantID:  source.RestaurantID,
+		Type:          "move_items",
+		SourceOrderID: source.ID,
+		TargetOrderID: target.ID,
+		FromTableID:   *source.TableID,
+		ToTableID:     targetTable.ID,
+		Items:         stringPtr(string(itemsJSON)),
+		Amount:        movedAmount,
+	}, target, nil
+}
+
+// closeMergedOrder đóng đơn đã được gộp hết món sang đơn khác
+func closeMergedOrder(tx *gorm.DB, order *models.Order, intoOrderNumber string) error {
+	order.Status = "merged"
+	if err := tx.Model(&models.Order{}).Where("id = ?", order.ID).Updates(map[string]interface{}{
+		"status":             "merged",
+		"cancel_reason":      "Đã gộp vào đơn #" + intoOrderNumber,
+		"payment_code":       nil,
+		"payment_expires_at": nil,
+	}).Error; err != nil {
+		return err
+	}
+	return recalculateOrderTotals(tx, order)
+}
+
+// checkMergeablePayment chỉ gộp các đơn chưa thanh toán; đơn nguồn đang chờ chuyển khoản thì chưa gộp
+// (đơn nguồn bị đóng, tiền khách chuyển theo mã của nó sẽ không khớp được đơn nào)
+func checkMergeablePayment(source, target models.Order) error {
+	for _, order := range []models.Order{source, target} {
+		if isOrderPaymentSettled(order) {
+			return &errOrderMove{http.StatusBadRequest, "Không thể gộp đơn đã thanh toán", "ORDER_ALREADY_PAID", order.OrderNumber}
+		}
+	}
+	if source.PaymentStatus == "pending" && source.PaymentExpiresAt != nil && source.PaymentExpiresAt.After(time.Now()) {
+		return &errOrderMove{http.StatusConflict, "Đơn cần gộp đang chờ khách thanh toán, vui lòng thử lại sau", "SOURCE_PAYMENT_PENDING", source.OrderNumber}
+	}
+	return nil
+}
+
+// expirePendingPayment cho mã QR đang chờ của đơn hết hạn để khách quét lại mã đúng số tiền mới.
+// Giữ nguyên mã thanh toán và trạng thái pending: khoản chuyển khoản đang thực hiện vẫn khớp được đơn
+// (số tiền được đối chiếu với tổng mới lúc nhận webhook). Thanh toán MoMo / VNPay đang chờ bị hủy
+func expirePendingPayment(tx *gorm.DB, orderIDs ...uint) error {
+	now := time.Now()
+	if err := tx.Model(&models.Order{}).
+		Where("id IN ? AND payment_status = ? AND payment_expires_at > ?", orderIDs, "pending", now).
+		Update("payment_expires_at", now).Error; err != nil {
+		return err
+	}
+	return services.CancelPendingOrderPayments(tx, orderIDs...)
+}
+
+// syncTableStatus cập nhật trạng thái bàn theo các đơn đang mở trên bàn (kể cả đơn chờ thanh toán)
+func syncTableStatus(tx *gorm.DB, tableID uint) {
+	var serving int64
+	tx.Model(&models.Order{}).
+		Where("table_id = ? AND status IN ?", tableID, openOrderStatuses).
+		Count(&serving)
+
+	if serving > 0 {
+		tx.Model(&models.Table{}).Where("id = ?", tableID).Update("status", "occupied")
+		return
+	}
+	tx.Model(&models.Table{}).Where("id = ? AND status = ?", tableID, "occupied").Update("status", "available")
+}
+
+func orderTotalsResponse(order models.Order) gin.H {
+	return gin.H{
+		"id":             order.ID,
+		"order_number":   order.OrderNumber,
+		"table_id":       order.TableID,
+		"status":         order.Status,
+		"payment_status": order.PaymentStatus,
+		"subtotal":       order.Subtotal,
+		"tax_amount":     order.TaxAmount,
+		"service_charge": order.ServiceCharge,
+		"total_amount":   order.TotalAmount,
+	}
+}
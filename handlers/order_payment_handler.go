@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-api/config"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===============================
+// REQUEST STRUCTS
+// ===============================
+
+// StartOrderPaymentInput request body cho thanh toán online
+type StartOrderPaymentInput struct {
+	Method string `json:"method" binding:"required"` // qr, momo, vnpay
+}
+
+// RefundOrderInput request body cho hoàn tiền
+type RefundOrderInput struct {
+	Amount float64 `json:"amount" binding:"omitempty,gt=0"` // Không truyền = hoàn toàn bộ số tiền còn lại
+	Reason string  `json:"reason" binding:"max=255"`
+}
+
+// ===============================
+// ORDER PAYMENT HANDLERS
+// ===============================
+
+// StartOrderPayment khởi tạo thanh toán online cho đơn hàng
+// @Summary Thanh toán online đơn hàng
+// @Description Tạo thanh toán qua chuyển khoản VietQR (qr), ví MoMo (momo) hoặc VNPay (vnpay). Trả về URL cổng thanh toán hoặc QR chuyển khoản
+// @Tags Payment
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param body body StartOrderPaymentInput true "Phương thức thanh toán"
+// @Success 200 {object} map[string]interface{}
+// @Router /payment/orders/{id}/pay [post]
+func StartOrderPayment(c *gin.Context) {
+	var orderID uint
+	if _, err := parseUint(c.Param("id"), &orderID); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Order ID không hợp lệ", "INVALID_ID", "")
+		return
+	}
+
+	var input StartOrderPaymentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	result, err := services.StartOrderPayment(config.GetDB(), orderID, input.Method, c.ClientIP())
+	if err != nil {
+		code, msg, _ := strings.Cut(err.Error(), ": ")
+		status := http.StatusBadRequest
+		switch code {
+		case "ORDER_NOT_FOUND":
+			status = http.StatusNotFound
+		case "PROVIDER_ERROR":
+			status = http.StatusBadGateway
+		}
+		utils.ErrorResponse(c, status, msg, code, "")
+		return
+	}
+
+	response := gin.H{
+		"order_id":   orderID,
+		"provider":   result.Payment.Provider,
+		"ref":        result.Payment.ProviderRef,
+		"amount":     result.Payment.Amount,
+		"pay_url":    result.PayURL,
+		"deeplink":   result.Deeplink,
+		"expires_at": result.Payment.ExpiresAt,
+	}
+	if result.QR != nil {
+		response["qr_url"] = result.QR.QRURL
+		response["payment_code"] = result.Payment.ProviderRef
+		response["bank_info"] = gin.H{
+			"bank_name":      result.QR.BankName,
+			"account_number": result.QR.AccountNo,
+			"account_name":   result.QR.AccountName,
+		}
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, response, "")
+}
+
+// HandleMomoIPN nhận kết quả thanh toán từ MoMo
+// @Summary IPN MoMo
+// @Description Nhận thông báo kết quả thanh toán từ MoMo (xác thực chữ ký HMAC-SHA256), trả 204 khi đã xử lý
+// @Tags Webhooks
+// @Accept json
+// @Success 204
+// @Router /webhooks/momo [post]
+func HandleMomoIPN(c *gin.Context) {
+	params, err := bindCallbackParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid payload"})
+		return
+	}
+
+	_, err = handleProviderCallback(services.PaymentProviderMomo, params)
+	if err != nil {
+		code, _, _ := strings.Cut(err.Error(), ": ")
+		switch code {
+		case "INVALID_SIGNATURE", "PAYMENT_NOT_FOUND", "INVALID_CALLBACK":
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": code})
+			return
+		case "ALREADY_CONFIRMED", "AMOUNT_MISMATCH":
+			// Đã ghi nhận, MoMo không cần gửi lại
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": code})
+			return
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// HandleVNPayIPN nhận kết quả thanh toán từ VNPay
+// @Summary IPN VNPay
+// @Description Nhận thông báo kết quả thanh toán từ VNPay (xác thực chữ ký HMAC-SHA512), trả RspCode theo đặc tả VNPay
+// @Tags Webhooks
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /webhooks/vnpay [get]
+func HandleVNPayIPN(c *gin.Context) {
+	params := map[string]string{}
+	for key, values := range c.Request.URL.Query() {
+		if len(values) > 0 {
+			params[key] = values[0]
+		}
+	}
+
+	_, err := handleProviderCallback(services.PaymentProviderVNPay, params)
+	if err != nil {
+		code, _, _ := strings.Cut(err.Error(), ": ")
+		switch code {
+		case "INVALID_SIGNATURE":
+			c.JSON(http.StatusOK, gin.H{"RspCode": "97", "Message": "Invalid Checksum"})
+		case "PAYMENT_NOT_FOUND":
+			c.JSON(http.StatusOK, gin.H{"RspCode": "01", "Message": "Order not found"})
+		case "ALREADY_CONFIRMED":
+			c.JSON(http.StatusOK, gin.H{"RspCode": "02", "Message": "Order already confirmed"})
+		case "AMOUNT_MISMATCH", "INVALID_CALLBACK":
+			c.JSON(http.StatusOK, gin.H{"RspCode": "04", "Message": "Invalid amount"})
+		default:
+			c.JSON(http.StatusOK, gin.H{"RspCode": "99", "Message": "Unknown error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"RspCode": "00", "Message": "Confirm Success"})
+}
+
+// HandleFakePaymentCallback nhận callback từ cổng giả lập (chỉ khi PAYMENT_FAKE_PROVIDER=true)
+// @Summary Callback cổng giả lập
+// @Description Callback ký bằng services.SignFakePaymentCallback, dùng cho phát triển / kiểm thử
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /webhooks/fake [post]
+func HandleFakePaymentCallback(c *gin.Context) {
+	params, err := bindCallbackParams(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	payment, err := handleProviderCallback(services.PaymentProviderFake, params)
+	if err != nil {
+		code, msg, _ := strings.Cut(err.Error(), ": ")
+		utils.ErrorResponse(c, http.StatusBadRequest, msg, code, "")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"order_id": payment.OrderID,
+		"status":   payment.Status,
+	}, "")
+}
+
+// GetOrderPayments lịch sử thanh toán và hoàn tiền của đơn
+// @Summary Lịch sử thanh toán đơn hàng
+// @Description Các lần thanh toán qua cổng và các lần hoàn tiền của đơn
+// @Tags Orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /orders/{id}/payments [get]
+func GetOrderPayments(c *gin.Context) {
+	orderID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	db := config.GetDB()
+
+	var order models.Order
+	if err := db.First(&order, orderID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy đơn hàng", "ORDER_NOT_FOUND", "")
+		return
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || order.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem đơn hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var payments []models.OrderPayment
+	db.Where("order_id = ?", order.ID).Order("created_at DESC").Find(&payments)
+
+	var refunds []models.PaymentRefund
+	db.Where("order_id = ?", order.ID).Order("created_at DESC").Find(&refunds)
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"order_id":       order.ID,
+		"payment_status": order.PaymentStatus,
+		"payment_method": order.PaymentMethod,
+		"total_amount":   order.TotalAmount,
+		"payments":       payments,
+		"refunds":        refunds,
+	}, "")
+}
+
+// RefundOrder hoàn tiền đơn hàng
+// @Summary Hoàn tiền đơn hàng
+// @Description Hoàn toàn bộ hoặc một phần. Đơn thanh toán qua MoMo / VNPay được hoàn qua cổng; chuyển khoản, tiền mặt được ghi nhận để nhân viên tự hoàn (status manual)
+// @Tags Orders
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param body body RefundOrderInput true "Số tiền và lý do"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /orders/{id}/refund [post]
+func RefundOrder(c *gin.Context) {
+	orderID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	db := config.GetDB()
+
+	var order models.Order
+	if err := db.First(&order, orderID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy đơn hàng", "ORDER_NOT_FOUND", "")
+		return
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || order.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền hoàn tiền đơn hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var input RefundOrderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	refund, err := services.RefundOrderPayment(db, order.ID, input.Amount, strings.TrimSpace(input.Reason), currentUserID(c), c.ClientIP())
+	if err != nil {
+		code, msg, _ := strings.Cut(err.Error(), ": ")
+		status := http.StatusBadRequest
+		switch code {
+		case "REFUND_FAILED":
+			status = http.StatusBadGateway
+		case "REFUND_NOT_RECORDED":
+			status = http.StatusInternalServerError
+		case "DAY_CLOSED":
+			status = http.StatusConflict
+		}
+		utils.ErrorResponse(c, status, "Hoàn tiền thất bại", code, msg)
+		return
+	}
+
+	message := "Hoàn tiền thành công"
+	if refund.Status == services.RefundManual {
+		message = "Đã ghi nhận hoàn tiền, vui lòng hoàn trực tiếp cho khách"
+	}
+	utils.SuccessResponse(c, http.StatusOK, refund, message)
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// handleProviderCallback xử lý IPN và báo cho nhà hàng đơn mang về / giao hàng vừa được thanh toán
+func handleProviderCallback(provider string, params map[string]string) (*models.OrderPayment, error) {
+	payment, err := services.HandlePaymentCallback(config.GetDB(), provider, params)
+	if err != nil {
+		log.Printf("❌ %s callback error: %v", provider, err)
+		return payment, err
+	}
+
+	log.Printf("📥 %s callback processed: Ref=%s, Status=%s", provider, payment.ProviderRef, payment.Status)
+	if payment.Status == services.OrderPaymentPaid {
+		notifyPrepaidOrderPaid(payment.OrderID)
+	}
+	return payment, nil
+}
+
+// notifyPrepaidOrderPaid đơn mang về / giao hàng trả trước chỉ được báo cho nhà hàng khi đã thanh toán
+func notifyPrepaidOrderPaid(orderID uint) {
+	var order models.Order
+	if err := config.GetDB().First(&order, orderID).Error; err != nil {
+		return
+	}
+	switch order.OrderType {
+	case "takeaway":
+		CreateTakeawayOrderNotification(order)
+	case "delivery":
+		CreateDeliveryOrderNotification(order)
+	}
+}
+
+// bindCallbackParams đọc body JSON của IPN thành map chuỗi (giữ nguyên số để tính chữ ký)
+func bindCallbackParams(c *gin.Context) (map[string]string, error) {
+	var raw map[string]interface{}
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	params := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch v := value.(type) {
+		case nil:
+			params[key] = ""
+		case string:
+			params[key] = v
+		case json.Number:
+			params[key] = v.String()
+		default:
+			data, _ := json.Marshal(v)
+			params[key] = string(bytes.TrimSpace(data))
+		}
+	}
+	return params, nil
+}
+
+// orderPaymentSummary lần thanh toán qua cổng gần nhất trả về cho client
+func orderPaymentSummary(payment *models.OrderPayment) gin.H {
+	if payment == nil {
+		return nil
+	}
+	return gin.H{
+		"provider":       payment.Provider,
+		"ref":            payment.ProviderRef,
+		"status":         payment.Status,
+		"pay_url":        payment.PayURL,
+		"expires_at":     payment.ExpiresAt,
+		"failure_reason": payment.FailureReason,
+		"amount":         payment.Amount,
+	}
+}
@@ -44,6 +44,7 @@ func GetPackages(c *gin.Context) {
 			"max_menu_items": pkg.MaxMenuItems,
 			"max_tables":     pkg.MaxTables,
 			"max_categories": pkg.MaxCategories,
+			"max_branches":   pkg.MaxBranches,
 			"features":       pkg.Features,
 			"is_popular":     pkg.IsPopular,
 		})
@@ -71,6 +72,7 @@ func CreatePackage(c *gin.Context) {
 		MaxMenuItems  int     `json:"max_menu_items"`
 		MaxTables     int     `json:"max_tables"`
 		MaxCategories int     `json:"max_categories"`
+		MaxBranches   int     `json:"max_branches"`
 		Features      string  `json:"features"`
 		IsPopular     bool    `json:"is_popular"`
 		SortOrder     int     `json:"sort_order"`
@@ -90,6 +92,7 @@ func CreatePackage(c *gin.Context) {
 		MaxMenuItems:  input.MaxMenuItems,
 		MaxTables:     input.MaxTables,
 		MaxCategories: input.MaxCategories,
+		MaxBranches:   input.MaxBranches,
 		Features:      &input.Features,
 		IsPopular:     input.IsPopular,
 		IsActive:      true,
@@ -135,6 +138,7 @@ func UpdatePackage(c *gin.Context) {
 		MaxMenuItems  int     `json:"max_menu_items"`
 		MaxTables     int     `json:"max_tables"`
 		MaxCategories int     `json:"max_categories"`
+		MaxBranches   int     `json:"max_branches"`
 		Features      string  `json:"features"`
 		IsPopular     *bool   `json:"is_popular"`
 		IsActive      *bool   `json:"is_active"`
@@ -168,6 +172,9 @@ func UpdatePackage(c *gin.Context) {
 	if input.MaxCategories != 0 {
 		updates["max_categories"] = input.MaxCategories
 	}
+	if input.MaxBranches != 0 {
+		updates["max_branches"] = input.MaxBranches
+	}
 	if input.Features != "" {
 		updates["features"] = input.Features
 	}
@@ -223,6 +230,7 @@ func ReseedPackages(c *gin.Context) {
 			"max_menu_items": pkg.MaxMenuItems,
 			"max_tables":     pkg.MaxTables,
 			"max_categories": pkg.MaxCategories,
+			"max_branches":   pkg.MaxBranches,
 		})
 	}
 
@@ -278,6 +286,11 @@ func GetPaymentSettings(c *gin.Context) {
 		"accept_qr":      settings.AcceptQR,
 		"accept_momo":    settings.AcceptMomo,
 		"accept_vnpay":   settings.AcceptVNPay,
+		// Tài khoản merchant: chỉ trả mã định danh, không trả secret
+		"momo_partner_code": settings.MomoPartnerCode,
+		"momo_configured":   momoConfigured(settings),
+		"vnpay_tmn_code":    settings.VNPayTmnCode,
+		"vnpay_configured":  vnpayConfigured(settings),
 	}, "")
 }
 
@@ -312,6 +325,12 @@ func UpdatePaymentSettings(c *gin.Context) {
 		AcceptQR      *bool  `json:"accept_qr"`
 		AcceptMomo    *bool  `json:"accept_momo"`
 		AcceptVNPay   *bool  `json:"accept_vnpay"`
+		// Tài khoản merchant MoMo / VNPay
+		MomoPartnerCode string `json:"momo_partner_code"`
+		MomoAccessKey   string `json:"momo_access_key"`
+		MomoSecretKey   string `json:"momo_secret_key"`
+		VNPayTmnCode    string `json:"vnpay_tmn_code"`
+		VNPayHashSecret string `json:"vnpay_hash_secret"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -351,7 +370,37 @@ func UpdatePaymentSettings(c *gin.Context) {
 		updates["accept_momo"] = *input.AcceptMomo
 	}
 	if input.AcceptVNPay != nil {
-		updates["accept_vnpay"] = *input.AcceptVNPay
+		updates["accept_vn_pay"] = *input.AcceptVNPay
+	}
+	if input.MomoPartnerCode != "" {
+		updates["momo_partner_code"] = input.MomoPartnerCode
+		settings.MomoPartnerCode = &input.MomoPartnerCode
+	}
+	if input.MomoAccessKey != "" {
+		updates["momo_access_key"] = input.MomoAccessKey
+		settings.MomoAccessKey = &input.MomoAccessKey
+	}
+	if input.MomoSecretKey != "" {
+		updates["momo_secret_key"] = input.MomoSecretKey
+		settings.MomoSecretKey = &input.MomoSecretKey
+	}
+	if input.VNPayTmnCode != "" {
+		updates["vnpay_tmn_code"] = input.VNPayTmnCode
+		settings.VNPayTmnCode = &input.VNPayTmnCode
+	}
+	if input.VNPayHashSecret != "" {
+		updates["vnpay_hash_secret"] = input.VNPayHashSecret
+		settings.VNPayHashSecret = &input.VNPayHashSecret
+	}
+
+	// Chỉ bật MoMo / VNPay khi đã có đủ tài khoản merchant
+	if input.AcceptMomo != nil && *input.AcceptMomo && !momoConfigured(settings) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Cần nhập partner code, access key và secret key MoMo trước khi bật", "MOMO_NOT_CONFIGURED", "")
+		return
+	}
+	if input.AcceptVNPay != nil && *input.AcceptVNPay && !vnpayConfigured(settings) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Cần nhập TMN code và hash secret VNPay trước khi bật", "VNPAY_NOT_CONFIGURED", "")
+		return
 	}
 
 	if err := config.GetDB().Model(&settings).Updates(updates).Error; err != nil {
@@ -364,6 +413,19 @@ func UpdatePaymentSettings(c *gin.Context) {
 	}, "Cập nhật thành công")
 }
 
+// momoConfigured nhà hàng đã nhập đủ tài khoản merchant MoMo
+func momoConfigured(settings models.PaymentSetting) bool {
+	return settings.MomoPartnerCode != nil && *settings.MomoPartnerCode != "" &&
+		settings.MomoAccessKey != nil && *settings.MomoAccessKey != "" &&
+		settings.MomoSecretKey != nil && *settings.MomoSecretKey != ""
+}
+
+// vnpayConfigured nhà hàng đã nhập đủ tài khoản merchant VNPay
+func vnpayConfigured(settings models.PaymentSetting) bool {
+	return settings.VNPayTmnCode != nil && *settings.VNPayTmnCode != "" &&
+		settings.VNPayHashSecret != nil && *settings.VNPayHashSecret != ""
+}
+
 // ===============================
 // ADMIN STATS HANDLERS
 // ===============================
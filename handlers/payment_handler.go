@@ -73,16 +73,17 @@ func HandleSepayWebhook(c *gin.Context) {
 	}
 
 	// Parse payment code từ nội dung chuyển khoản
-	transactionType, code, found := services.ParsePaymentCode(payload.TransactionContent)
-	if !found {
-		log.Printf("⚠️ No payment code found in: %s", payload.TransactionContent)
-		// Vẫn lưu transaction để tracking
-		saveUnmatchedTransaction(&payload)
+	match, err := services.ResolvePaymentCode(services.FindPaymentCodes(payload.TransactionContent))
+	if err != nil {
+		log.Printf("⚠️ %v in: %s", err, payload.TransactionContent)
+		// Vẫn lưu transaction để đối soát thủ công
+		saveUnmatchedTransaction(&payload, err.Error())
 		c.JSON(http.StatusOK, gin.H{"success": true, "message": "No payment code found"})
 		return
 	}
+	transactionType, code := match.Type, match.Code
 
-	log.Printf("🔍 Found payment code: type=%s, code=%s", transactionType, code)
+	log.Printf("🔍 Found payment code: type=%s, code=%s, verified=%t", transactionType, code, match.Verified)
 
 	// Chuyển đổi payload sang service format
 	servicePayload := &services.SepayWebhookPayload{
@@ -101,7 +102,6 @@ func HandleSepayWebhook(c *gin.Context) {
 	}
 
 	// Xử lý theo loại giao dịch
-	var err error
 	switch transactionType {
 	case "package":
 		err = handlePackagePayment(code, servicePayload)
@@ -126,7 +126,7 @@ func handlePackagePayment(paymentCode string, payload *services.SepayWebhookPayl
 
 	// Tìm subscription
 	var subscription models.PackageSubscription
-	if err := db.Where("payment_code = ?", paymentCode).First(&subscription).Error; err != nil {
+	if err := db.Where("payment_code IN ?", services.PaymentCodeVariants(paymentCode)).First(&subscription).Error; err != nil {
 		log.Printf("❌ Subscription not found: %s", paymentCode)
 		return err
 	}
@@ -149,11 +149,25 @@ func handlePackagePayment(paymentCode string, payload *services.SepayWebhookPayl
 
 // handleOrderPayment xử lý thanh toán đơn hàng
 func handleOrderPayment(paymentCode string, payload *services.SepayWebhookPayload) error {
-	return services.CompleteOrderPayment(paymentCode, payload)
+	if err := services.CompleteOrderPayment(paymentCode, payload); err != nil {
+		return err
+	}
+
+	// Đơn mang về / giao hàng trả trước chỉ được báo cho nhà hàng khi đã thanh toán
+	var order models.Order
+	if err := config.GetDB().Where("payment_code IN ?", services.PaymentCodeVariants(paymentCode)).First(&order).Error; err == nil {
+		switch order.OrderType {
+		case "takeaway":
+			CreateTakeawayOrderNotification(order)
+		case "delivery":
+			CreateDeliveryOrderNotification(order)
+		}
+	}
+	return nil
 }
 
-// saveUnmatchedTransaction lưu giao dịch không khớp code
-func saveUnmatchedTransaction(payload *SepayWebhookPayload) {
+// saveUnmatchedTransaction lưu giao dịch không khớp code (reason: không có mã / nhiều mã)
+func saveUnmatchedTransaction(payload *SepayWebhookPayload, reason string) {
 	db := config.GetDB()
 
 	rawJSON, _ := json.Marshal(payload)
@@ -163,6 +177,7 @@ func saveUnmatchedTransaction(payload *SepayWebhookPayload) {
 		ReferenceCode:      "UNMATCHED",
 		SepayTransactionID: &payload.ID,
 		Gateway:            &payload.Gateway,
+		TransactionDate:    services.ParseSepayTransactionDate(payload.TransactionDate),
 		AccountNumber:      &payload.AccountNumber,
 		TransferType:       &payload.TransferType,
 		TransferAmount:     payload.TransferAmount,
@@ -171,11 +186,22 @@ func saveUnmatchedTransaction(payload *SepayWebhookPayload) {
 		TransactionContent: &payload.TransactionContent,
 		ReferenceNumber:    &payload.ReferenceNumber,
 		Description:        &payload.Description,
-		Status:             "unmatched",
+		Status:             services.TransactionUnmatched,
+		ErrorMessage:       &reason,
 		RawWebhookData:     stringPtr(string(rawJSON)),
+		RestaurantID:       services.TransferAccountRestaurantID(db, payload.AccountNumber),
 	}
 
-	db.Create(&tx)
+	if err := db.Create(&tx).Error; err != nil {
+		log.Printf("❌ Failed to save unmatched transaction %d: %v", payload.ID, err)
+		return
+	}
+
+	// Báo nhà hàng có tiền vào tài khoản nhưng không khớp đơn nào để đối soát
+	if tx.RestaurantID != nil {
+		CreateSystemNotification(*tx.RestaurantID, "payment_unmatched", "Giao dịch chưa khớp đơn",
+			"Nhận "+formatCurrency(payload.TransferAmount)+" với nội dung \""+payload.TransactionContent+"\" nhưng không tự khớp được đơn nào, vui lòng đối soát")
+	}
 }
 
 // ===============================
@@ -389,6 +415,7 @@ func CreateOrderPaymentQR(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path int true "Order ID"
+// @Param refresh query bool false "Tra cứu trạng thái trên cổng thanh toán"
 // @Success 200 {object} map[string]interface{}
 // @Router /payment/orders/{id}/status [get]
 func GetOrderPaymentStatus(c *gin.Context) {
@@ -405,12 +432,24 @@ func GetOrderPaymentStatus(c *gin.Context) {
 		return
 	}
 
+	// Lần thanh toán qua cổng gần nhất; refresh=true tra cứu trực tiếp trên cổng (khi khách quay về từ MoMo / VNPay)
+	payment, _ := services.LatestOrderPayment(db, order.ID)
+	if payment != nil && c.Query("refresh") == "true" && payment.Status == services.OrderPaymentPending {
+		if err := services.RefreshOrderPayment(db, payment); err != nil {
+			log.Printf("⚠️ Refresh order payment %d failed: %v", payment.ID, err)
+		} else if payment.Status == services.OrderPaymentPaid {
+			notifyPrepaidOrderPaid(order.ID)
+		}
+		db.First(&order, orderID)
+	}
+
 	utils.SuccessResponse(c, http.StatusOK, gin.H{
 		"order_id":       orderID,
 		"payment_status": order.PaymentStatus,
 		"payment_method": order.PaymentMethod,
 		"paid_at":        order.PaidAt,
 		"total_amount":   order.TotalAmount,
+		"payment":        orderPaymentSummary(payment),
 	}, "")
 }
 
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"go-api/config"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===============================
+// HANDLERS
+// ===============================
+
+// GetOrderBillPDF in hóa đơn / phiếu tạm tính dạng PDF
+// @Summary In hóa đơn (PDF)
+// @Description Hóa đơn khổ A5 hoặc cuộn 80mm. Đơn chưa thanh toán in kèm VietQR chuyển khoản với nội dung là mã thanh toán ORD để hệ thống tự đối soát
+// @Tags Orders
+// @Produce application/pdf
+// @Param id path int true "Order ID"
+// @Param layout query string false "Khổ giấy: a5 (mặc định), 80mm"
+// @Param transliterate query bool false "In chữ không dấu"
+// @Param qr query bool false "In QR thanh toán (mặc định true)"
+// @Success 200 {file} binary
+// @Security BearerAuth
+// @Router /orders/{id}/bill.pdf [get]
+func GetOrderBillPDF(c *gin.Context) {
+	order, ok := loadPrintOrder(c, true)
+	if !ok {
+		return
+	}
+
+	opts := printOptionsFromQuery(c, services.PrintLayoutA5)
+	pdfBytes, err := services.RenderPrintPDF([]services.PrintDocument{buildBillDocument(c, &order)}, opts)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo file PDF", "PDF_ERROR", err.Error())
+		return
+	}
+
+	setQRFileHeader(c, "bill-"+order.OrderNumber+".pdf")
+	c.Data(http.StatusOK, "application/pdf", pdfBytes)
+}
+
+// GetOrderBillESCPOS in hóa đơn / phiếu tạm tính dạng lệnh ESC/POS
+// @Summary In hóa đơn (ESC/POS)
+// @Description Lệnh ESC/POS cho máy in nhiệt 80mm (576 dot), gửi thẳng tới máy in (cổng 9100). Chữ tiếng Việt in dạng ảnh, transliterate=true để in chữ không dấu bằng font máy in
+// @Tags Orders
+// @Produce application/octet-stream
+// @Param id path int true "Order ID"
+// @Param transliterate query bool false "In chữ không dấu"
+// @Param qr query bool false "In QR thanh toán (mặc định true)"
+// @Success 200 {file} binary
+// @Security BearerAuth
+// @Router /orders/{id}/bill.escpos [get]
+func GetOrderBillESCPOS(c *gin.Context) {
+	order, ok := loadPrintOrder(c, true)
+	if !ok {
+		return
+	}
+
+	opts := printOptionsFromQuery(c, services.PrintLayoutRoll)
+	data, err := services.RenderPrintESCPOS([]services.PrintDocument{buildBillDocument(c, &order)}, opts)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo lệnh in", "PRINT_ERROR", err.Error())
+		return
+	}
+
+	setQRFileHeader(c, "bill-"+order.OrderNumber+".bin")
+	c.Data(http.StatusOK, "application/octet-stream", data)
+}
+
+// GetKitchenTicketsPDF in phiếu bếp theo khu vực chế biến dạng PDF
+// @Summary In phiếu bếp (PDF)
+// @Description Mỗi khu vực chế biến (bếp, bar, phục vụ) một trang, chỉ gồm món chưa hủy / chưa phục vụ
+// @Tags Orders
+// @Produce application/pdf
+// @Param id path int true "Order ID"
+// @Param station query string false "Chỉ in một khu vực: kitchen, bar, service"
+// @Param layout query string false "Khổ giấy: 80mm (mặc định), a5"
+// @Param transliterate query bool false "In chữ không dấu"
+// @Success 200 {file} binary
+// @Security BearerAuth
+// @Router /orders/{id}/kitchen-tickets.pdf [get]
+func GetKitchenTicketsPDF(c *gin.Context) {
+	order, docs, ok := loadKitchenTickets(c)
+	if !ok {
+		return
+	}
+
+	pdfBytes, err := services.RenderPrintPDF(docs, printOptionsFromQuery(c, services.PrintLayoutRoll))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo file PDF", "PDF_ERROR", err.Error())
+		return
+	}
+
+	setQRFileHeader(c, "kitchen-"+order.OrderNumber+".pdf")
+	c.Data(http.StatusOK, "application/pdf", pdfBytes)
+}
+
+// GetKitchenTicketsESCPOS in phiếu bếp theo khu vực chế biến dạng lệnh ESC/POS
+// @Summary In phiếu bếp (ESC/POS)
+// @Description Lệnh ESC/POS cho máy in nhiệt 80mm, cắt giấy sau phiếu của mỗi khu vực
+// @Tags Orders
+// @Produce application/octet-stream
+// @Param id path int true "Order ID"
+// @Param station query string false "Chỉ in một khu vực: kitchen, bar, service"
+// @Param transliterate query bool false "In chữ không dấu"
+// @Success 200 {file} binary
+// @Security BearerAuth
+// @Router /orders/{id}/kitchen-tickets.escpos [get]
+func GetKitchenTicketsESCPOS(c *gin.Context) {
+	order, docs, ok := loadKitchenTickets(c)
+	if !ok {
+		return
+	}
+
+	data, err := services.RenderPrintESCPOS(docs, printOptionsFromQuery(c, services.PrintLayoutRoll))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo lệnh in", "PRINT_ERROR", err.Error())
+		return
+	}
+
+	setQRFileHeader(c, "kitchen-"+order.OrderNumber+".bin")
+	c.Data(http.StatusOK, "application/octet-stream", data)
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// loadPrintOrder lấy đơn kèm món, bàn, nhà hàng và kiểm tra quyền
+func loadPrintOrder(c *gin.Context, withPaymentSetting bool) (models.Order, bool) {
+	orderID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	query := config.GetDB().
+		Preload("Table").
+		Preload("OrderItems").
+		Preload("Restaurant")
+	if withPaymentSetting {
+		query = query.Preload("Restaurant.PaymentSetting")
+	}
+
+	var order models.Order
+	if err := query.First(&order, orderID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy đơn hàng", "ORDER_NOT_FOUND", "")
+		return order, false
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || order.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền in đơn hàng này", "FORBIDDEN", "")
+		return order, false
+	}
+	return order, true
+}
+
+// loadKitchenTickets lấy đơn và dựng phiếu bếp theo ?station=
+func loadKitchenTickets(c *gin.Context) (models.Order, []services.PrintDocument, bool) {
+	order, ok := loadPrintOrder(c, false)
+	if !ok {
+		return order, nil, false
+	}
+
+	docs := services.BuildKitchenTickets(order, c.Query("station"))
+	if len(docs) == 0 {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không có món cần in", "NO_ITEMS_TO_PRINT", "")
+		return order, nil, false
+	}
+	return order, docs, true
+}
+
+// buildBillDocument dựng hóa đơn, in VietQR cho đơn chưa trả (tắt bằng ?qr=false)
+func buildBillDocument(c *gin.Context, order *models.Order) services.PrintDocument {
+	return services.BuildOrderBill(config.GetDB(), order, c.Query("qr") != "false")
+}
+
+// printOptionsFromQuery đọc ?layout= và ?transliterate=
+func printOptionsFromQuery(c *gin.Context, defaultLayout string) services.PrintOptions {
+	layout := c.DefaultQuery("layout", defaultLayout)
+	if layout != services.PrintLayoutA5 && layout != services.PrintLayoutRoll {
+		layout = defaultLayout
+	}
+	return services.PrintOptions{
+		Layout:        layout,
+		Transliterate: c.Query("transliterate") == "true",
+	}
+}
@@ -0,0 +1,755 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/config"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreatePrinterInput request body cho thêm máy in
+type CreatePrinterInput struct {
+	Name          string  `json:"name" binding:"required,max=100"`
+	Role          string  `json:"role" binding:"required"` // receipt, kitchen
+	Station       *string `json:"station"`                 // kitchen, bar, service (máy in phiếu bếp), bỏ trống = mọi khu vực
+	Format        string  `json:"format"`                  // escpos (mặc định), pdf
+	Layout        string  `json:"layout"`                  // 80mm (mặc định), a5
+	Transliterate bool    `json:"transliterate"`
+}
+
+// UpdatePrinterInput request body cho cập nhật máy in
+type UpdatePrinterInput struct {
+	Name          *string `json:"name"`
+	Role          *string `json:"role"`
+	Station       *string `json:"station"` // Chuỗi rỗng = mọi khu vực
+	Format        *string `json:"format"`
+	Layout        *string `json:"layout"`
+	Transliterate *bool   `json:"transliterate"`
+	IsActive      *bool   `json:"is_active"`
+}
+
+// PrintOrderInput request body cho gửi lệnh in đơn hàng
+type PrintOrderInput struct {
+	Type string `json:"type" binding:"required"` // bill, kitchen
+}
+
+// AckPrintJobInput request body agent báo kết quả in
+type AckPrintJobInput struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+}
+
+const (
+	printPollDefaultWait = 25 * time.Second
+	printPollMaxWait     = 60 * time.Second
+	printPollRecheck     = 5 * time.Second // Kiểm tra lại lệnh đến hạn thử lại / lệnh tạo ở instance khác
+)
+
+// ===============================
+// PRINTER HANDLERS
+// ===============================
+
+// GetPrinters lấy danh sách máy in của nhà hàng
+// @Summary Danh sách máy in
+// @Description Máy in hóa đơn / phiếu bếp nhận lệnh qua print agent, kèm số lệnh đang chờ và lỗi của từng máy
+// @Tags Printing
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/printers [get]
+func GetPrinters(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem máy in của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	printers, err := listPrinters(uint(restaurantID), false)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy danh sách máy in", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"printers": printers,
+	}, "")
+}
+
+// CreatePrinter thêm máy in
+// @Summary Thêm máy in
+// @Description Khai báo máy in hóa đơn hoặc phiếu bếp (theo khu vực). Print agent ánh xạ tên / ID máy in sang thiết bị trong mạng LAN
+// @Tags Printing
+// @Accept json
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param body body CreatePrinterInput true "Thông tin máy in"
+// @Success 201 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/printers [post]
+func CreatePrinter(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền thêm máy in cho nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var input CreatePrinterInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	printer := models.Printer{
+		RestaurantID:  uint(restaurantID),
+		Name:          strings.TrimSpace(input.Name),
+		Role:          input.Role,
+		Station:       normalizePrinterStation(input.Station),
+		Format:        input.Format,
+		Layout:        input.Layout,
+		Transliterate: input.Transliterate,
+		IsActive:      true,
+	}
+	if printer.Format == "" {
+		printer.Format = services.PrintFormatESCPOS
+	}
+	if printer.Layout == "" {
+		printer.Layout = services.PrintLayoutRoll
+	}
+	if !validatePrinter(c, printer) {
+		return
+	}
+
+	if err := config.GetDB().Create(&printer).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể thêm máy in", "CREATE_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, printer, "Thêm máy in thành công")
+}
+
+// UpdatePrinter cập nhật máy in
+// @Summary Cập nhật máy in
+// @Description Đổi tên, vai trò, khu vực, định dạng in hoặc bật / tắt máy in. Lệnh đã xếp hàng giữ nguyên định dạng cũ
+// @Tags Printing
+// @Accept json
+// @Produce json
+// @Param id path int true "Printer ID"
+// @Param body body UpdatePrinterInput true "Thông tin cập nhật"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /printers/{id} [put]
+func UpdatePrinter(c *gin.Context) {
+	printer, ok := loadPrinterForManage(c)
+	if !ok {
+		return
+	}
+
+	var input UpdatePrinterInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	if input.Name != nil {
+		printer.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.Role != nil {
+		printer.Role = *input.Role
+	}
+	if input.Station != nil {
+		printer.Station = normalizePrinterStation(input.Station)
+	}
+	if input.Format != nil {
+		printer.Format = *input.Format
+	}
+	if input.Layout != nil {
+		printer.Layout = *input.Layout
+	}
+	if input.Transliterate != nil {
+		printer.Transliterate = *input.Transliterate
+	}
+	if input.IsActive != nil {
+		printer.IsActive = *input.IsActive
+	}
+	if !validatePrinter(c, printer) {
+		return
+	}
+
+	if err := config.GetDB().Model(&printer).Updates(map[string]interface{}{
+		"name":          printer.Name,
+		"role":          printer.Role,
+		"station":       printer.Station,
+		"format":        printer.Format,
+		"layout":        printer.Layout,
+		"transliterate": printer.Transliterate,
+		"is_active":     printer.IsActive,
+	}).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể cập nhật máy in", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, printer, "Cập nhật máy in thành công")
+}
+
+// DeletePrinter xóa máy in
+// @Summary Xóa máy in
+// @Description Xóa máy in cùng các lệnh in của máy
+// @Tags Printing
+// @Produce json
+// @Param id path int true "Printer ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /printers/{id} [delete]
+func DeletePrinter(c *gin.Context) {
+	printer, ok := loadPrinterForManage(c)
+	if !ok {
+		return
+	}
+
+	db := config.GetDB()
+	db.Where("printer_id = ?", printer.ID).Delete(&models.PrintJob{})
+
+	if err := db.Delete(&printer).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể xóa máy in", "DELETE_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, nil, "Xóa máy in thành công")
+}
+
+// TestPrinter gửi lệnh in thử
+// @Summary In thử
+// @Description Xếp một trang in thử cho máy in để kiểm tra print agent và kết nối máy in
+// @Tags Printing
+// @Produce json
+// @Param id path int true "Printer ID"
+// @Success 201 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /printers/{id}/test [post]
+func TestPrinter(c *gin.Context) {
+	printer, ok := loadPrinterForManage(c)
+	if !ok {
+		return
+	}
+
+	job, err := services.EnqueueTestPage(config.GetDB(), printer)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo lệnh in", "PRINT_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, job, "Đã gửi lệnh in thử")
+}
+
+// ===============================
+// PRINT JOB HANDLERS
+// ===============================
+
+// GetPrintJobs lấy nhật ký lệnh in của nhà hàng
+// @Summary Danh sách lệnh in
+// @Description Lệnh in mới nhất trước, kèm số lệnh theo trạng thái (failed = hết lượt thử lại, cần in lại thủ công)
+// @Tags Printing
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param status query string false "pending, printing, retrying, printed, failed"
+// @Param printer_id query int false "Lọc theo máy in"
+// @Param order_id query int false "Lọc theo đơn hàng"
+// @Param page query int false "Trang" default(1)
+// @Param limit query int false "Số lượng/trang" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/print-jobs [get]
+func GetPrintJobs(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem lệnh in của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	db := config.GetDB()
+	query := db.Model(&models.PrintJob{}).Where("restaurant_id = ?", restaurantID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if printerID := c.Query("printer_id"); printerID != "" {
+		query = query.Where("printer_id = ?", printerID)
+	}
+	if orderID := c.Query("order_id"); orderID != "" {
+		query = query.Where("order_id = ?", orderID)
+	}
+
+	// Pagination
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	var total int64
+	query.Count(&total)
+
+	// Danh sách không kèm dữ liệu in cho nhẹ
+	var jobs []models.PrintJob
+	if err := query.Omit("data").Preload("Printer").Order("created_at DESC").Offset(offset).Limit(limit).Find(&jobs).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy danh sách lệnh in", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	totalPages := int(total) / limit
+	if int(total)%limit > 0 {
+		totalPages++
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"jobs":      jobs,
+		"by_status": printJobCounts(uint(restaurantID)),
+		"pagination": gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": totalPages,
+		},
+	}, "")
+}
+
+// RetryPrintJob in lại lệnh in
+// @Summary In lại
+// @Description Đưa lệnh in (đã in hoặc failed) về hàng đợi, agent sẽ in lại ngay
+// @Tags Printing
+// @Produce json
+// @Param id path int true "Print Job ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /print-jobs/{id}/retry [post]
+func RetryPrintJob(c *gin.Context) {
+	jobID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	db := config.GetDB()
+	var job models.PrintJob
+	if err := db.Omit("data").First(&job, jobID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy lệnh in", "PRINT_JOB_NOT_FOUND", "")
+		return
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || job.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền in lại lệnh này", "FORBIDDEN", "")
+		return
+	}
+
+	if job.Status != services.PrintJobPrinted && job.Status != services.PrintJobFailed {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Lệnh in đang chờ in", "PRINT_JOB_PENDING", "")
+		return
+	}
+
+	if err := services.RequeuePrintJob(db, &job); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể in lại", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"id":              job.ID,
+		"status":          job.Status,
+		"next_attempt_at": job.NextAttemptAt,
+	}, "Đã đưa lệnh vào hàng đợi in lại")
+}
+
+// PrintOrder gửi hóa đơn / phiếu bếp của đơn tới máy in
+// @Summary In đơn hàng
+// @Description Xếp lệnh in hóa đơn (type=bill, in VietQR nếu chưa thanh toán) hoặc phiếu bếp (type=kitchen) tới các máy in đang bật
+// @Tags Printing
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param body body PrintOrderInput true "Loại phiếu"
+// @Success 201 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /orders/{id}/print [post]
+func PrintOrder(c *gin.Context) {
+	var input PrintOrderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+	if input.Type != "bill" && input.Type != "kitchen" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Loại phiếu phải là bill hoặc kitchen", "INVALID_TYPE", "")
+		return
+	}
+
+	order, ok := loadPrintOrder(c, false)
+	if !ok {
+		return
+	}
+
+	db := config.GetDB()
+	var count int
+	var err error
+	if input.Type == "bill" {
+		count, err = services.EnqueueOrderBill(db, order.ID)
+	} else {
+		count, err = services.EnqueueKitchenTickets(db, order.ID)
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo lệnh in", "PRINT_ERROR", err.Error())
+		return
+	}
+	if count == 0 {
+		utils.ErrorResponse(c, http.StatusConflict, "Chưa có máy in phù hợp hoặc không có món cần in", "NO_PRINTER", "")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, gin.H{
+		"order_id": order.ID,
+		"type":     input.Type,
+		"jobs":     count,
+	}, "Đã gửi lệnh in")
+}
+
+// ===============================
+// PRINT AGENT HANDLERS
+// ===============================
+
+// GetAgentPrinters print agent lấy danh sách máy in đang bật của nhà hàng
+// @Summary Máy in của agent
+// @Description Dùng API key scope print.agent. Agent đối chiếu với cấu hình thiết bị khi khởi động
+// @Tags Print Agent
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Security ApiKeyAuth
+// @Router /print-agent/printers [get]
+func GetAgentPrinters(c *gin.Context) {
+	restaurantID, ok := agentRestaurantID(c)
+	if !ok {
+		return
+	}
+
+	printers, err := listPrinters(restaurantID, true)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy danh sách máy in", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"printers": printers,
+	}, "")
+}
+
+// PollPrintJobs print agent lấy lệnh in (long-poll)
+// @Summary Lấy lệnh in
+// @Description Trả về ngay khi có lệnh đến hạn, nếu không thì giữ kết nối tối đa wait giây. Lệnh trả về được giữ cho agent 2 phút, agent phải báo kết quả qua /ack; data là nội dung in (base64) đúng định dạng của máy in
+// @Tags Print Agent
+// @Produce json
+// @Param wait query int false "Số giây chờ tối đa (0-60)" default(25)
+// @Param printers query string false "Chỉ lấy lệnh của các máy in (ID, phân cách dấu phẩy)"
+// @Param limit query int false "Số lệnh tối đa" default(10)
+// @Success 200 {object} map[string]interface{}
+// @Security ApiKeyAuth
+// @Router /print-agent/jobs [get]
+func PollPrintJobs(c *gin.Context) {
+	restaurantID, ok := agentRestaurantID(c)
+	if !ok {
+		return
+	}
+
+	wait := printPollDefaultWait
+	if raw := c.Query("wait"); raw != "" {
+		seconds, _ := strconv.Atoi(raw)
+		wait = min(max(time.Duration(seconds)*time.Second, 0), printPollMaxWait)
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if limit < 1 || limit > 50 {
+		limit = 10
+	}
+	var printerIDs []uint
+	for _, raw := range strings.Split(c.Query("printers"), ",") {
+		if id, err := strconv.ParseUint(strings.TrimSpace(raw), 10, 32); err == nil {
+			printerIDs = append(printerIDs, uint(id))
+		}
+	}
+
+	var apiKeyID uint
+	if value, exists := c.Get("api_key_id"); exists {
+		apiKeyID, _ = value.(uint)
+	}
+
+	// Đăng ký nhận sự kiện trước khi kiểm tra để không lỡ lệnh tạo giữa hai bước
+	events, unsubscribe := services.SubscribeRestaurantEvents(restaurantID)
+	defer unsubscribe()
+
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	recheck := time.NewTicker(printPollRecheck)
+	defer recheck.Stop()
+
+	db := config.GetDB()
+	for {
+		jobs, err := services.ClaimPrintJobs(db, restaurantID, apiKeyID, printerIDs, limit)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy lệnh in", "QUERY_ERROR", err.Error())
+			return
+		}
+		if len(jobs) > 0 || wait == 0 {
+			respondPrintJobs(c, jobs)
+			return
+		}
+
+		if !waitForPrintJob(c, events, deadline.C, recheck.C) {
+			if c.Request.Context().Err() == nil {
+				respondPrintJobs(c, nil)
+			}
+			return
+		}
+	}
+}
+
+// AckPrintJob print agent báo kết quả in
+// @Summary Báo kết quả in
+// @Description success=false kèm error để hẹn in lại (10s, 20s, 40s... tối đa 5 phút); sau 5 lần lỗi lệnh chuyển failed và báo lên dashboard
+// @Tags Print Agent
+// @Accept json
+// @Produce json
+// @Param id path int true "Print Job ID"
+// @Param body body AckPrintJobInput true "Kết quả in"
+// @Success 200 {object} map[string]interface{}
+// @Security ApiKeyAuth
+// @Router /print-agent/jobs/{id}/ack [post]
+func AckPrintJob(c *gin.Context) {
+	restaurantID, ok := agentRestaurantID(c)
+	if !ok {
+		return
+	}
+
+	jobID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	var input AckPrintJobInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	job, err := services.AckPrintJob(config.GetDB(), restaurantID, uint(jobID), input.Success, strings.TrimSpace(input.Error))
+	if err != nil {
+		code, msg, _ := strings.Cut(err.Error(), ": ")
+		switch code {
+		case "PRINT_JOB_NOT_FOUND":
+			utils.ErrorResponse(c, http.StatusNotFound, msg, code, "")
+		case "PRINT_JOB_NOT_CLAIMED":
+			utils.ErrorResponse(c, http.StatusConflict, msg, code, "")
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể cập nhật lệnh in", "UPDATE_ERROR", err.Error())
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"id":              job.ID,
+		"status":          job.Status,
+		"attempts":        job.Attempts,
+		"next_attempt_at": job.NextAttemptAt,
+	}, "")
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+func loadPrinterForManage(c *gin.Context) (models.Printer, bool) {
+	printerID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	var printer models.Printer
+	if err := config.GetDB().First(&printer, printerID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy máy in", "PRINTER_NOT_FOUND", "")
+		return printer, false
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || printer.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền quản lý máy in này", "FORBIDDEN", "")
+		return printer, false
+	}
+
+	return printer, true
+}
+
+// validatePrinter kiểm tra cấu hình máy in, trả false nếu đã trả lỗi
+func validatePrinter(c *gin.Context, printer models.Printer) bool {
+	switch {
+	case printer.Name == "":
+		utils.ErrorResponse(c, http.StatusBadRequest, "Tên máy in không được để trống", "VALIDATION_ERROR", "")
+	case !services.IsValidPrinterRole(printer.Role):
+		utils.ErrorResponse(c, http.StatusBadRequest, "Vai trò máy in phải là receipt hoặc kitchen", "INVALID_ROLE", "")
+	case !services.IsValidPrintFormat(printer.Format):
+		utils.ErrorResponse(c, http.StatusBadRequest, "Định dạng in phải là escpos hoặc pdf", "INVALID_FORMAT", "")
+	case printer.Layout != services.PrintLayoutRoll && printer.Layout != services.PrintLayoutA5:
+		utils.ErrorResponse(c, http.StatusBadRequest, "Khổ giấy phải là 80mm hoặc a5", "INVALID_LAYOUT", "")
+	case printer.Station != nil && printer.Role != services.PrinterRoleKitchen:
+		utils.ErrorResponse(c, http.StatusBadRequest, "Chỉ máy in phiếu bếp mới chọn khu vực", "INVALID_STATION", "")
+	default:
+		return true
+	}
+	return false
+}
+
+// normalizePrinterStation chuỗi rỗng = mọi khu vực
+func normalizePrinterStation(station *string) *string {
+	if station == nil || strings.TrimSpace(*station) == "" {
+		return nil
+	}
+	value := strings.TrimSpace(*station)
+	return &value
+}
+
+// listPrinters máy in của nhà hàng kèm số lệnh đang chờ / failed
+func listPrinters(restaurantID uint, activeOnly bool) ([]gin.H, error) {
+	db := config.GetDB()
+	query := db.Where("restaurant_id = ?", restaurantID)
+	if activeOnly {
+		query = query.Where("is_active = ?", true)
+	}
+
+	var printers []models.Printer
+	if err := query.Order("id ASC").Find(&printers).Error; err != nil {
+		return nil, err
+	}
+
+	type printerCount struct {
+		PrinterID uint
+		Status    string
+		Count     int64
+	}
+	var counts []printerCount
+	db.Model(&models.PrintJob{}).
+		Select("printer_id, status, COUNT(*) AS count").
+		Where("restaurant_id = ? AND status IN ?", restaurantID,
+			[]string{services.PrintJobPending, services.PrintJobPrinting, services.PrintJobRetrying, services.PrintJobFailed}).
+		Group("printer_id, status").
+		Scan(&counts)
+
+	queued := map[uint]int64{}
+	failed := map[uint]int64{}
+	for _, row := range counts {
+		if row.Status == services.PrintJobFailed {
+			failed[row.PrinterID] += row.Count
+		} else {
+			queued[row.PrinterID] += row.Count
+		}
+	}
+
+	result := make([]gin.H, 0, len(printers))
+	for _, printer := range printers {
+		result = append(result, gin.H{
+			"id":            printer.ID,
+			"name":          printer.Name,
+			"role":          printer.Role,
+			"station":       printer.Station,
+			"format":        printer.Format,
+			"layout":        printer.Layout,
+			"transliterate": printer.Transliterate,
+			"is_active":     printer.IsActive,
+			"queued_jobs":   queued[printer.ID],
+			"failed_jobs":   failed[printer.ID],
+			"created_at":    printer.CreatedAt,
+		})
+	}
+	return result, nil
+}
+
+// printJobCounts số lệnh in của nhà hàng theo trạng thái chưa hoàn tất (cho dashboard)
+func printJobCounts(restaurantID uint) gin.H {
+	counts := gin.H{}
+	for _, status := range []string{services.PrintJobPending, services.PrintJobPrinting, services.PrintJobRetrying, services.PrintJobFailed} {
+		var count int64
+		config.GetDB().Model(&models.PrintJob{}).Where("restaurant_id = ? AND status = ?", restaurantID, status).Count(&count)
+		counts[status] = count
+	}
+	return counts
+}
+
+// agentRestaurantID nhà hàng của print agent (theo API key)
+func agentRestaurantID(c *gin.Context) (uint, bool) {
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	if rid, ok := currentRestaurantID.(*uint); ok && rid != nil {
+		return *rid, true
+	}
+	utils.ErrorResponse(c, http.StatusForbidden, "Print agent phải dùng API key của nhà hàng", "FORBIDDEN", "")
+	return 0, false
+}
+
+// waitForPrintJob chờ tới khi có lệnh in mới, tới lượt kiểm tra lại hoặc hết thời gian chờ (false)
+func waitForPrintJob(c *gin.Context, events <-chan services.Event, deadline, recheck <-chan time.Time) bool {
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-deadline:
+			return false
+		case <-recheck:
+			return true
+		case e, ok := <-events:
+			if !ok {
+				return false
+			}
+			if e.Type == services.EventPrintJobCreated {
+				return true
+			}
+		}
+	}
+}
+
+func respondPrintJobs(c *gin.Context, jobs []models.PrintJob) {
+	result := make([]gin.H, 0, len(jobs))
+	for _, job := range jobs {
+		printerName := ""
+		if job.Printer != nil {
+			printerName = job.Printer.Name
+		}
+		result = append(result, gin.H{
+			"id":           job.ID,
+			"printer_id":   job.PrinterID,
+			"printer_name": printerName,
+			"order_id":     job.OrderID,
+			"kind":         job.Kind,
+			"format":       job.Format,
+			"attempts":     job.Attempts,
+			"lease_until":  job.NextAttemptAt,
+			"data":         job.Data,
+		})
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"jobs": result,
+	}, "")
+}
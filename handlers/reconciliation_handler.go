@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-api/config"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===============================
+// REQUEST STRUCTS
+// ===============================
+
+// AssignTransactionInput request body gán giao dịch vào đơn / đăng ký gói
+type AssignTransactionInput struct {
+	TargetType string `json:"target_type" binding:"required,oneof=order package"`
+	TargetID   uint   `json:"target_id" binding:"required"`
+	Note       string `json:"note" binding:"max=300"`
+}
+
+// IgnoreTransactionInput request body bỏ qua giao dịch
+type IgnoreTransactionInput struct {
+	Note string `json:"note" binding:"required,max=300"` // Lý do (chuyển nhầm, giao dịch cá nhân...)
+}
+
+// ===============================
+// RECONCILIATION HANDLERS
+// ===============================
+
+// GetUnmatchedTransactions danh sách giao dịch chuyển khoản không khớp mã
+// @Summary Giao dịch chưa khớp
+// @Description Chuyển khoản vào tài khoản mà nội dung không có mã PKG / ORD (khách ghi sai nội dung). Nhà hàng chỉ thấy giao dịch vào tài khoản của mình
+// @Tags Reconciliation
+// @Produce json
+// @Param id path int true "Restaurant ID (route nhà hàng)"
+// @Param status query string false "Trạng thái" Enums(unmatched, assigned, ignored) default(unmatched)
+// @Param page query int false "Trang" default(1)
+// @Param limit query int false "Số bản ghi mỗi trang" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/unmatched-transactions [get]
+// @Router /admin/unmatched-transactions [get]
+func GetUnmatchedTransactions(c *gin.Context) {
+	restaurantID, ok := reconcileScope(c)
+	if !ok {
+		return
+	}
+
+	status := c.DefaultQuery("status", services.TransactionUnmatched)
+	if status != services.TransactionUnmatched && status != services.TransactionAssigned && status != services.TransactionIgnored {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Trạng thái không hợp lệ", "INVALID_STATUS", "")
+		return
+	}
+
+	query := services.ReconcileTransactionsQuery(config.GetDB(), restaurantID, status)
+
+	// Pagination
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	var total int64
+	query.Count(&total)
+
+	var transactions []models.PaymentTransaction
+	if err := query.Omit("raw_webhook_data").
+		Order("created_at DESC").
+		Offset(offset).Limit(limit).
+		Find(&transactions).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy giao dịch", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	totalPages := int(total) / limit
+	if int(total)%limit > 0 {
+		totalPages++
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"transactions": transactions,
+		"pagination": gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": totalPages,
+		},
+	}, "")
+}
+
+// GetTransactionSuggestions gợi ý đơn / đăng ký khớp với giao dịch
+// @Summary Gợi ý đối soát
+// @Description Đơn chưa thanh toán (và đăng ký gói với admin) có số tiền gần đúng, tạo quanh thời điểm chuyển khoản, xếp theo độ khớp số tiền, mã gần giống nội dung và thời gian
+// @Tags Reconciliation
+// @Produce json
+// @Param id path int true "Restaurant ID (route nhà hàng)"
+// @Param transactionId path int true "Transaction ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/unmatched-transactions/{transactionId}/suggestions [get]
+// @Router /admin/unmatched-transactions/{transactionId}/suggestions [get]
+func GetTransactionSuggestions(c *gin.Context) {
+	restaurantID, ok := reconcileScope(c)
+	if !ok {
+		return
+	}
+
+	db := config.GetDB()
+	transactionID, _ := strconv.ParseUint(c.Param("transactionId"), 10, 32)
+	transaction, err := services.FindReconcileTransaction(db, uint(transactionID), restaurantID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy giao dịch", "TRANSACTION_NOT_FOUND", "")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"transaction": transaction,
+		"candidates":  services.SuggestReconcileCandidates(db, *transaction, restaurantID, restaurantID == nil),
+	}, "")
+}
+
+// AssignTransaction gán giao dịch vào đơn / đăng ký gói
+// @Summary Gán giao dịch
+// @Description Gán thủ công giao dịch chưa khớp vào đơn (hoặc đăng ký gói với admin): chạy luồng hoàn tất thanh toán như khi nhận webhook và ghi lại người gán kèm ghi chú
+// @Tags Reconciliation
+// @Accept json
+// @Produce json
+// @Param id path int true "Restaurant ID (route nhà hàng)"
+// @Param transactionId path int true "Transaction ID"
+// @Param body body AssignTransactionInput true "Đơn / đăng ký cần gán"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/unmatched-transactions/{transactionId}/assign [post]
+// @Router /admin/unmatched-transactions/{transactionId}/assign [post]
+func AssignTransaction(c *gin.Context) {
+	restaurantID, ok := reconcileScope(c)
+	if !ok {
+		return
+	}
+
+	var input AssignTransactionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	db := config.GetDB()
+	transactionID, _ := strconv.ParseUint(c.Param("transactionId"), 10, 32)
+	transaction, err := services.AssignUnmatchedTransaction(db, uint(transactionID), input.TargetType, input.TargetID,
+		restaurantID, currentUserID(c), strings.TrimSpace(input.Note))
+	if err != nil {
+		code, msg, _ := strings.Cut(err.Error(), ": ")
+		switch code {
+		case "TRANSACTION_NOT_FOUND", "ORDER_NOT_FOUND", "SUBSCRIPTION_NOT_FOUND", "NOT_FOUND":
+			utils.ErrorResponse(c, http.StatusNotFound, msg, code, "")
+		case "FORBIDDEN":
+			utils.ErrorResponse(c, http.StatusForbidden, msg, code, "")
+		case "ALREADY_RESOLVED", "ALREADY_PAID", "DAY_CLOSED":
+			utils.ErrorResponse(c, http.StatusConflict, msg, code, "")
+		case "AMOUNT_MISMATCH", "ACCOUNT_MISMATCH", "INVALID_TARGET":
+			utils.ErrorResponse(c, http.StatusBadRequest, msg, code, "")
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể gán giao dịch", "ASSIGN_ERROR", err.Error())
+		}
+		return
+	}
+
+	// Đơn trả trước (mang về / giao hàng) chỉ báo bếp khi đã thanh toán
+	if input.TargetType == services.ReconcileTargetOrder {
+		notifyPrepaidOrderPaid(input.TargetID)
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, transaction, "Gán giao dịch thành công")
+}
+
+// IgnoreTransaction bỏ qua giao dịch
+// @Summary Bỏ qua giao dịch
+// @Description Đánh dấu giao dịch không thuộc đơn / đăng ký nào (chuyển nhầm, giao dịch cá nhân...) kèm lý do
+// @Tags Reconciliation
+// @Accept json
+// @Produce json
+// @Param id path int true "Restaurant ID (route nhà hàng)"
+// @Param transactionId path int true "Transaction ID"
+// @Param body body IgnoreTransactionInput true "Lý do"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/unmatched-transactions/{transactionId}/ignore [post]
+// @Router /admin/unmatched-transactions/{transactionId}/ignore [post]
+func IgnoreTransaction(c *gin.Context) {
+	restaurantID, ok := reconcileScope(c)
+	if !ok {
+		return
+	}
+
+	var input IgnoreTransactionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	transactionID, _ := strconv.ParseUint(c.Param("transactionId"), 10, 32)
+	transaction, err := services.IgnoreUnmatchedTransaction(config.GetDB(), uint(transactionID), restaurantID, currentUserID(c), strings.TrimSpace(input.Note))
+	if err != nil {
+		code, msg, _ := strings.Cut(err.Error(), ": ")
+		switch code {
+		case "TRANSACTION_NOT_FOUND":
+			utils.ErrorResponse(c, http.StatusNotFound, msg, code, "")
+		case "ALREADY_RESOLVED":
+			utils.ErrorResponse(c, http.StatusConflict, msg, code, "")
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể cập nhật giao dịch", "UPDATE_ERROR", err.Error())
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, transaction, "Đã bỏ qua giao dịch")
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// reconcileScope phạm vi đối soát: route nhà hàng (/restaurants/:id) chỉ thấy tài khoản nhận của nhà hàng,
+// route admin (không có :id) thấy toàn bộ kể cả tài khoản nền tảng. Trả về ok = false nếu đã trả lỗi
+func reconcileScope(c *gin.Context) (*uint, bool) {
+	if c.Param("id") == "" {
+		return nil, true
+	}
+
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền đối soát giao dịch của nhà hàng này", "FORBIDDEN", "")
+		return nil, false
+	}
+
+	id := uint(restaurantID)
+	return &id, true
+}
@@ -0,0 +1,969 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/config"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ===============================
+// REQUEST STRUCTS
+// ===============================
+
+// CreateReservationInput request body cho khách đặt bàn
+type CreateReservationInput struct {
+	CustomerName  string    `json:"customer_name" binding:"required"`
+	CustomerPhone string    `json:"customer_phone" binding:"required"`
+	CustomerEmail string    `json:"customer_email"`
+	PartySize     int       `json:"party_size" binding:"required,min=1"`
+	ReservedAt    time.Time `json:"reserved_at" binding:"required"` // RFC3339
+	Notes         string    `json:"notes"`
+}
+
+// ConfirmReservationInput request body cho nhân viên xác nhận đặt bàn
+type ConfirmReservationInput struct {
+	TableID         uint `json:"table_id"` // Bỏ trống để hệ thống tự chọn bàn phù hợp
+	DurationMinutes int  `json:"duration_minutes"`
+}
+
+// UpdateReservationStatusInput request body cho cập nhật trạng thái đặt bàn
+type UpdateReservationStatusInput struct {
+	Status string `json:"status" binding:"required"` // seated, completed, cancelled, no_show
+	Note   string `json:"note"`
+}
+
+// JoinWaitlistInput request body cho khách vào danh sách chờ
+type JoinWaitlistInput struct {
+	CustomerName  string `json:"customer_name" binding:"required"`
+	CustomerPhone string `json:"customer_phone"`
+	PartySize     int    `json:"party_size" binding:"required,min=1"`
+	Notes         string `json:"notes"`
+}
+
+// UpdateWaitlistStatusInput request body cho cập nhật danh sách chờ
+type UpdateWaitlistStatusInput struct {
+	Status  string `json:"status" binding:"required"` // notified, seated, cancelled
+	TableID uint   `json:"table_id"`
+}
+
+// ===============================
+// PUBLIC HANDLERS
+// ===============================
+
+// CreateReservation khách gửi yêu cầu đặt bàn (Public)
+// @Summary Đặt bàn trước
+// @Description Khách gửi yêu cầu đặt bàn theo số khách và giờ đến, nhà hàng sẽ xác nhận sau
+// @Tags Public
+// @Accept json
+// @Produce json
+// @Param slug path string true "Restaurant Slug"
+// @Param reservation body CreateReservationInput true "Thông tin đặt bàn"
+// @Success 201 {object} map[string]interface{}
+// @Router /public/restaurants/{slug}/reservations [post]
+func CreateReservation(c *gin.Context) {
+	slug := c.Param("slug")
+
+	var restaurant models.Restaurant
+	if err := config.GetDB().Where("slug = ? AND status = ?", slug, "active").First(&restaurant).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy nhà hàng", "RESTAURANT_NOT_FOUND", "")
+		return
+	}
+
+	if !restaurant.AcceptReservations {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Nhà hàng hiện không nhận đặt bàn", "RESERVATIONS_DISABLED", "")
+		return
+	}
+
+	var input CreateReservationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	now := time.Now()
+	if input.ReservedAt.Before(now.Add(15 * time.Minute)) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Vui lòng đặt bàn trước ít nhất 15 phút", "INVALID_RESERVATION_TIME", "")
+		return
+	}
+	if input.ReservedAt.After(now.AddDate(0, 0, 60)) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Chỉ nhận đặt bàn trong vòng 60 ngày", "INVALID_RESERVATION_TIME", "")
+		return
+	}
+
+	duration := restaurant.ReservationDurationMinutes
+	if duration <= 0 {
+		duration = 90
+	}
+
+	// Kiểm tra còn bàn phù hợp trong khung giờ này không
+	available, err := services.FindAvailableTables(restaurant, input.PartySize, input.ReservedAt, duration)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi kiểm tra bàn trống", "QUERY_ERROR", err.Error())
+		return
+	}
+	if len(available) == 0 {
+		utils.ErrorResponse(c, http.StatusConflict, "Không còn bàn phù hợp vào thời gian này", "NO_AVAILABILITY", "")
+		return
+	}
+
+	reservation := models.Reservation{
+		RestaurantID:    restaurant.ID,
+		Code:            "RSV" + utils.GenerateRandomCode(7),
+		CustomerName:    input.CustomerName,
+		CustomerPhone:   input.CustomerPhone,
+		PartySize:       input.PartySize,
+		ReservedAt:      input.ReservedAt,
+		DurationMinutes: duration,
+		Status:          "pending",
+	}
+	if input.CustomerEmail != "" {
+		reservation.CustomerEmail = &input.CustomerEmail
+	}
+	if input.Notes != "" {
+		reservation.Notes = &input.Notes
+	}
+
+	// Giữ tạm bàn vừa nhất còn trống: khóa dòng bàn rồi kiểm tra lại trùng lịch,
+	// hai yêu cầu đặt đồng thời không lấy cùng một khung giờ
+	end := input.ReservedAt.Add(time.Duration(duration) * time.Minute)
+	err = config.GetDB().Transaction(func(tx *gorm.DB) error {
+		for _, candidate := range available {
+			var table models.Table
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&table, candidate.ID).Error; err != nil {
+				continue
+			}
+			conflicts, err := services.FindReservationConflicts(tx, table.ID, input.ReservedAt, end, 0)
+			if err != nil {
+				return err
+			}
+			if len(conflicts) == 0 {
+				reservation.TableID = &table.ID
+				return tx.Create(&reservation).Error
+			}
+		}
+		return errNoAvailability
+	})
+	if errors.Is(err, errNoAvailability) {
+		utils.ErrorResponse(c, http.StatusConflict, "Không còn bàn phù hợp vào thời gian này", "NO_AVAILABILITY", "")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo đặt bàn", "CREATE_ERROR", err.Error())
+		return
+	}
+
+	CreateReservationNotification(reservation)
+
+	utils.SuccessResponse(c, http.StatusCreated, publicReservationResponse(reservation), "Đã gửi yêu cầu đặt bàn. Nhà hàng sẽ xác nhận sớm!")
+}
+
+// GetReservationByCode khách xem trạng thái đặt bàn (Public)
+// @Summary Xem đặt bàn
+// @Description Khách xem trạng thái đặt bàn theo mã (số điện thoại, email được che một phần)
+// @Tags Public
+// @Produce json
+// @Param code path string true "Mã đặt bàn"
+// @Success 200 {object} map[string]interface{}
+// @Router /public/reservations/{code} [get]
+func GetReservationByCode(c *gin.Context) {
+	var reservation models.Reservation
+	if err := config.GetDB().Preload("Table").Where("code = ?", c.Param("code")).First(&reservation).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy đặt bàn", "RESERVATION_NOT_FOUND", "")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, publicReservationResponse(reservation), "")
+}
+
+// CancelReservationByCode khách tự hủy đặt bàn (Public)
+// @Summary Hủy đặt bàn
+// @Description Khách hủy đặt bàn theo mã
+// @Tags Public
+// @Produce json
+// @Param code path string true "Mã đặt bàn"
+// @Success 200 {object} map[string]interface{}
+// @Router /public/reservations/{code}/cancel [put]
+func CancelReservationByCode(c *gin.Context) {
+	db := config.GetDB()
+
+	var reservation models.Reservation
+	if err := db.Where("code = ?", c.Param("code")).First(&reservation).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy đặt bàn", "RESERVATION_NOT_FOUND", "")
+		return
+	}
+
+	if reservation.Status != "pending" && reservation.Status != "confirmed" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Không thể hủy đặt bàn ở trạng thái hiện tại", "INVALID_TRANSITION", "")
+		return
+	}
+
+	now := time.Now()
+	db.Model(&reservation).Updates(map[string]interface{}{
+		"status":        "cancelled",
+		"cancelled_at":  now,
+		"cancel_reason": "Khách hủy",
+	})
+	if reservation.TableID != nil {
+		services.ReleaseReservedTable(db, *reservation.TableID)
+	}
+
+	CreateSystemNotification(reservation.RestaurantID, "reservation_cancelled", "Khách hủy đặt bàn "+reservation.Code,
+		reservation.CustomerName+" • "+reservation.ReservedAt.Format("15:04 02/01"))
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"code":   reservation.Code,
+		"status": "cancelled",
+	}, "Đã hủy đặt bàn")
+}
+
+// JoinWaitlist khách vãng lai vào danh sách chờ (Public)
+// @Summary Vào danh sách chờ
+// @Description Khách vãng lai đăng ký chờ bàn, hệ thống ước tính thời gian chờ
+// @Tags Public
+// @Accept json
+// @Produce json
+// @Param slug path string true "Restaurant Slug"
+// @Param entry body JoinWaitlistInput true "Thông tin khách"
+// @Success 201 {object} map[string]interface{}
+// @Router /public/restaurants/{slug}/waitlist [post]
+func JoinWaitlist(c *gin.Context) {
+	var restaurant models.Restaurant
+	if err := config.GetDB().Where("slug = ? AND status = ?", c.Param("slug"), "active").First(&restaurant).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy nhà hàng", "RESTAURANT_NOT_FOUND", "")
+		return
+	}
+
+	if !restaurant.IsOpen {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Nhà hàng hiện đang đóng cửa", "RESTAURANT_CLOSED", "")
+		return
+	}
+
+	var input JoinWaitlistInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	entry, estimate, err := addWaitlistEntry(restaurant.ID, input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể thêm vào danh sách chờ", "CREATE_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, waitlistResponse(*entry, estimate), "Đã vào danh sách chờ")
+}
+
+// GetWaitlistEntryByCode khách xem vị trí trong danh sách chờ (Public)
+// @Summary Xem vị trí chờ
+// @Description Khách xem vị trí và thời gian chờ ước tính
+// @Tags Public
+// @Produce json
+// @Param code path string true "Mã chờ"
+// @Success 200 {object} map[string]interface{}
+// @Router /public/waitlist/{code} [get]
+func GetWaitlistEntryByCode(c *gin.Context) {
+	var entry models.WaitlistEntry
+	if err := config.GetDB().Where("code = ?", c.Param("code")).First(&entry).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy lượt chờ", "WAITLIST_NOT_FOUND", "")
+		return
+	}
+
+	var estimate *services.WaitEstimate
+	if entry.Status == "waiting" || entry.Status == "notified" {
+		estimate, _ = services.EstimateWaitMinutes(entry.RestaurantID, entry.PartySize, countPartiesAhead(entry))
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, waitlistResponse(entry, estimate), "")
+}
+
+// ===============================
+// STAFF HANDLERS - RESERVATIONS
+// ===============================
+
+// GetReservations lấy danh sách đặt bàn của nhà hàng
+// @Summary Lấy danh sách đặt bàn
+// @Description Lấy danh sách đặt bàn theo ngày và trạng thái
+// @Tags Reservations
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param date query string false "Ngày (YYYY-MM-DD)"
+// @Param status query string false "Trạng thái" Enums(pending, confirmed, seated, completed, cancelled, no_show)
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/reservations [get]
+func GetReservations(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem đặt bàn của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	query := config.GetDB().Preload("Table").Where("restaurant_id = ?", restaurantID)
+
+	if date := c.Query("date"); date != "" {
+		query = query.Where("DATE(reserved_at) = ?", date)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var reservations []models.Reservation
+	if err := query.Order("reserved_at ASC").Find(&reservations).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy danh sách đặt bàn", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	var data []gin.H
+	for _, r := range reservations {
+		data = append(data, reservationResponse(r))
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, data, "")
+}
+
+// CheckReservationAvailability kiểm tra bàn trống cho một khung giờ
+// @Summary Kiểm tra bàn trống
+// @Description Liệt kê các bàn còn trống cho số khách và giờ đến
+// @Tags Reservations
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param party_size query int true "Số khách"
+// @Param reserved_at query string true "Giờ đến (RFC3339)"
+// @Param duration_minutes query int false "Thời lượng (phút)"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/reservations/availability [get]
+func CheckReservationAvailability(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem đặt bàn của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	partySize, _ := strconv.Atoi(c.Query("party_size"))
+	if partySize <= 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Số khách không hợp lệ", "INVALID_PARTY_SIZE", "")
+		return
+	}
+
+	reservedAt, err := time.Parse(time.RFC3339, c.Query("reserved_at"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Thời gian không hợp lệ", "INVALID_RESERVATION_TIME", err.Error())
+		return
+	}
+
+	var restaurant models.Restaurant
+	if err := config.GetDB().First(&restaurant, restaurantID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy nhà hàng", "RESTAURANT_NOT_FOUND", "")
+		return
+	}
+
+	duration, _ := strconv.Atoi(c.Query("duration_minutes"))
+	if duration <= 0 {
+		duration = restaurant.ReservationDurationMinutes
+	}
+
+	tables, err := services.FindAvailableTables(restaurant, partySize, reservedAt, duration)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi kiểm tra bàn trống", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	var data []gin.H
+	for _, t := range tables {
+		data = append(data, gin.H{
+			"id":           t.ID,
+			"table_number": t.TableNumber,
+			"name":         t.Name,
+			"capacity":     t.Capacity,
+			"status":       t.Status,
+		})
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"party_size":       partySize,
+		"reserved_at":      reservedAt,
+		"duration_minutes": duration,
+		"available_tables": data,
+	}, "")
+}
+
+// ConfirmReservation nhân viên xác nhận và gán bàn cho đặt bàn
+// @Summary Xác nhận đặt bàn
+// @Description Xác nhận đặt bàn và gán bàn, kiểm tra trùng lịch với các lượt đặt khác
+// @Tags Reservations
+// @Accept json
+// @Produce json
+// @Param id path int true "Reservation ID"
+// @Param body body ConfirmReservationInput false "Bàn được gán"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /reservations/{id}/confirm [put]
+func ConfirmReservation(c *gin.Context) {
+	reservationID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	db := config.GetDB()
+
+	var reservation models.Reservation
+	if err := db.First(&reservation, reservationID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy đặt bàn", "RESERVATION_NOT_FOUND", "")
+		return
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || reservation.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xác nhận đặt bàn này", "FORBIDDEN", "")
+		return
+	}
+
+	if reservation.Status != "pending" && reservation.Status != "confirmed" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Không thể xác nhận đặt bàn ở trạng thái hiện tại", "INVALID_TRANSITION", "")
+		return
+	}
+
+	var input ConfirmReservationInput
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	var restaurant models.Restaurant
+	db.First(&restaurant, reservation.RestaurantID)
+
+	duration := reservation.DurationMinutes
+	if input.DurationMinutes > 0 {
+		duration = input.DurationMinutes
+	}
+	start := reservation.ReservedAt
+	end := start.Add(time.Duration(duration) * time.Minute)
+
+	// Bàn ứng viên theo thứ tự ưu tiên, được kiểm tra lại trong transaction
+	var candidates []uint
+	if input.TableID > 0 {
+		var table models.Table
+		if err := db.Where("id = ? AND restaurant_id = ? AND is_active = ?", input.TableID, reservation.RestaurantID, true).First(&table).Error; err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Bàn không tồn tại", "TABLE_NOT_FOUND", "")
+			return
+		}
+		if table.Capacity < reservation.PartySize {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Bàn không đủ chỗ cho số khách", "TABLE_TOO_SMALL",
+				fmt.Sprintf("capacity %d < party size %d", table.Capacity, reservation.PartySize))
+			return
+		}
+		candidates = []uint{table.ID}
+	} else {
+		available, err := services.FindAvailableTables(restaurant, reservation.PartySize, start, duration)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi kiểm tra bàn trống", "QUERY_ERROR", err.Error())
+			return
+		}
+
+		// Ưu tiên bàn đã gán (lượt pending giữ tạm bàn từ lúc đặt), sau đó bàn vừa nhất (vẫn phải không trùng lịch)
+		if reservation.TableID != nil {
+			candidates = append(candidates, *reservation.TableID)
+		}
+		for _, t := range available {
+			candidates = append(candidates, t.ID)
+		}
+	}
+
+	// Khóa dòng bàn rồi mới kiểm tra trùng lịch và gán: các lượt xác nhận đồng thời trên cùng bàn chạy tuần tự
+	tx := db.Begin()
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&reservation, reservation.ID).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể xác nhận đặt bàn", "UPDATE_ERROR", err.Error())
+		return
+	}
+	if reservation.Status != "pending" && reservation.Status != "confirmed" {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusBadRequest, "Không thể xác nhận đặt bàn ở trạng thái hiện tại", "INVALID_TRANSITION", "")
+		return
+	}
+
+	var table models.Table
+	var conflicts []models.Reservation
+	for _, tableID := range candidates {
+		var candidate models.Table
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND restaurant_id = ? AND is_active = ?", tableID, reservation.RestaurantID, true).
+			First(&candidate).Error; err != nil {
+			continue
+		}
+
+		found, err := services.FindReservationConflicts(tx, candidate.ID, start, end, reservation.ID)
+		if err != nil {
+			tx.Rollback()
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi kiểm tra trùng lịch", "QUERY_ERROR", err.Error())
+			return
+		}
+		if len(found) == 0 {
+			table = candidate
+			break
+		}
+		conflicts = found
+	}
+
+	if table.ID == 0 {
+		tx.Rollback()
+		if input.TableID > 0 && len(conflicts) > 0 {
+			var codes []string
+			for _, r := range conflicts {
+				codes = append(codes, r.Code+" ("+r.ReservedAt.Format("15:04")+")")
+			}
+			utils.ErrorResponse(c, http.StatusConflict, "Bàn đã có lượt đặt trùng giờ", "RESERVATION_CONFLICT", fmt.Sprintf("%v", codes))
+			return
+		}
+		utils.ErrorResponse(c, http.StatusConflict, "Không còn bàn phù hợp vào thời gian này", "NO_AVAILABILITY", "")
+		return
+	}
+
+	// Bàn cũ (nếu đổi bàn) được trả lại
+	previousTableID := reservation.TableID
+
+	now := time.Now()
+	if err := tx.Model(&reservation).Updates(map[string]interface{}{
+		"table_id":         table.ID,
+		"duration_minutes": duration,
+		"status":           "confirmed",
+		"confirmed_at":     now,
+	}).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể xác nhận đặt bàn", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể xác nhận đặt bàn", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	if previousTableID != nil && *previousTableID != table.ID {
+		services.ReleaseReservedTable(db, *previousTableID)
+	}
+
+	// Nếu đã vào thời gian giữ bàn thì giữ bàn ngay
+	services.SyncReservationHolds()
+
+	db.Preload("Table").First(&reservation, reservation.ID)
+
+	utils.SuccessResponse(c, http.StatusOK, reservationResponse(reservation), "Đã xác nhận đặt bàn")
+}
+
+// UpdateReservationStatus cập nhật trạng thái đặt bàn
+// @Summary Cập nhật trạng thái đặt bàn
+// @Description confirmed -> seated -> completed, hoặc hủy / no_show
+// @Tags Reservations
+// @Accept json
+// @Produce json
+// @Param id path int true "Reservation ID"
+// @Param status body UpdateReservationStatusInput true "Trạng thái mới"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /reservations/{id}/status [put]
+func UpdateReservationStatus(c *gin.Context) {
+	reservationID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	db := config.GetDB()
+
+	var reservation models.Reservation
+	if err := db.First(&reservation, reservationID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy đặt bàn", "RESERVATION_NOT_FOUND", "")
+		return
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || reservation.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền cập nhật đặt bàn này", "FORBIDDEN", "")
+		return
+	}
+
+	var input UpdateReservationStatusInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	validTransitions := map[string][]string{
+		"pending":   {"cancelled"},
+		"confirmed": {"seated", "cancelled", "no_show"},
+		"seated":    {"completed"},
+	}
+
+	allowed, exists := validTransitions[reservation.Status]
+	if !exists || !containsString(allowed, input.Status) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Chuyển trạng thái không hợp lệ", "INVALID_TRANSITION",
+			fmt.Sprintf("Cannot transition from %s to %s", reservation.Status, input.Status))
+		return
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"status": input.Status}
+
+	switch input.Status {
+	case "seated":
+		updates["seated_at"] = now
+		if reservation.TableID != nil {
+			db.Model(&models.Table{}).Where("id = ?", *reservation.TableID).Update("status", "occupied")
+		}
+	case "cancelled":
+		updates["cancelled_at"] = now
+		if input.Note != "" {
+			updates["cancel_reason"] = input.Note
+		}
+	}
+
+	if err := db.Model(&reservation).Updates(updates).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể cập nhật trạng thái", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	if (input.Status == "cancelled" || input.Status == "no_show") && reservation.TableID != nil {
+		services.ReleaseReservedTable(db, *reservation.TableID)
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"id":     reservation.ID,
+		"code":   reservation.Code,
+		"status": input.Status,
+	}, "Cập nhật trạng thái thành công")
+}
+
+// ===============================
+// STAFF HANDLERS - WAITLIST
+// ===============================
+
+// GetWaitlist lấy danh sách chờ hiện tại của nhà hàng
+// @Summary Lấy danh sách chờ
+// @Description Lấy các nhóm khách đang chờ bàn kèm thời gian chờ ước tính
+// @Tags Reservations
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/waitlist [get]
+func GetWaitlist(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem danh sách chờ này", "FORBIDDEN", "")
+		return
+	}
+
+	var entries []models.WaitlistEntry
+	if err := config.GetDB().
+		Where("restaurant_id = ? AND status IN ?", restaurantID, []string{"waiting", "notified"}).
+		Order("created_at ASC").
+		Find(&entries).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy danh sách chờ", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	var data []gin.H
+	for i, e := range entries {
+		estimate, _ := services.EstimateWaitMinutes(e.RestaurantID, e.PartySize, i)
+		data = append(data, waitlistResponse(e, estimate))
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, data, "")
+}
+
+// AddWaitlistEntry nhân viên thêm khách vãng lai vào danh sách chờ
+// @Summary Thêm khách vào danh sách chờ
+// @Description Nhân viên thêm nhóm khách vãng lai vào danh sách chờ
+// @Tags Reservations
+// @Accept json
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param entry body JoinWaitlistInput true "Thông tin khách"
+// @Success 201 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/waitlist [post]
+func AddWaitlistEntry(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền cập nhật danh sách chờ này", "FORBIDDEN", "")
+		return
+	}
+
+	var input JoinWaitlistInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	entry, estimate, err := addWaitlistEntry(uint(restaurantID), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể thêm vào danh sách chờ", "CREATE_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, waitlistResponse(*entry, estimate), "Đã thêm vào danh sách chờ")
+}
+
+// UpdateWaitlistStatus cập nhật trạng thái lượt chờ
+// @Summary Cập nhật lượt chờ
+// @Description Báo khách (notified), xếp bàn (seated) hoặc hủy lượt chờ
+// @Tags Reservations
+// @Accept json
+// @Produce json
+// @Param id path int true "Waitlist Entry ID"
+// @Param status body UpdateWaitlistStatusInput true "Trạng thái mới"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /waitlist/{id}/status [put]
+func UpdateWaitlistStatus(c *gin.Context) {
+	entryID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	db := config.GetDB()
+
+	var entry models.WaitlistEntry
+	if err := db.First(&entry, entryID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy lượt chờ", "WAITLIST_NOT_FOUND", "")
+		return
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || entry.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền cập nhật lượt chờ này", "FORBIDDEN", "")
+		return
+	}
+
+	var input UpdateWaitlistStatusInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	validTransitions := map[string][]string{
+		"waiting":  {"notified", "seated", "cancelled"},
+		"notified": {"seated", "cancelled"},
+	}
+
+	allowed, exists := validTransitions[entry.Status]
+	if !exists || !containsString(allowed, input.Status) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Chuyển trạng thái không hợp lệ", "INVALID_TRANSITION",
+			fmt.Sprintf("Cannot transition from %s to %s", entry.Status, input.Status))
+		return
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"status": input.Status}
+
+	switch input.Status {
+	case "notified":
+		updates["notified_at"] = now
+	case "seated":
+		if input.TableID == 0 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Vui lòng chọn bàn", "TABLE_REQUIRED", "")
+			return
+		}
+		var table models.Table
+		if err := db.Where("id = ? AND restaurant_id = ? AND is_active = ?", input.TableID, entry.RestaurantID, true).First(&table).Error; err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Bàn không tồn tại", "TABLE_NOT_FOUND", "")
+			return
+		}
+		if table.Status != "available" {
+			utils.ErrorResponse(c, http.StatusConflict, "Bàn đang không trống", "TABLE_NOT_AVAILABLE", table.Status)
+			return
+		}
+		updates["seated_at"] = now
+		updates["table_id"] = table.ID
+		db.Model(&table).Update("status", "occupied")
+	}
+
+	if err := db.Model(&entry).Updates(updates).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể cập nhật lượt chờ", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"id":     entry.ID,
+		"code":   entry.Code,
+		"status": input.Status,
+	}, "Cập nhật lượt chờ thành công")
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// addWaitlistEntry tạo lượt chờ mới và ước tính thời gian chờ
+func addWaitlistEntry(restaurantID uint, input JoinWaitlistInput) (*models.WaitlistEntry, *services.WaitEstimate, error) {
+	entry := models.WaitlistEntry{
+		RestaurantID: restaurantID,
+		Code:         "WL" + utils.GenerateRandomCode(6),
+		CustomerName: input.CustomerName,
+		PartySize:    input.PartySize,
+		Status:       "waiting",
+	}
+	if input.CustomerPhone != "" {
+		entry.CustomerPhone = &input.CustomerPhone
+	}
+	if input.Notes != "" {
+		entry.Notes = &input.Notes
+	}
+
+	estimate, err := services.EstimateWaitMinutes(restaurantID, input.PartySize, countPartiesAhead(entry))
+	if err != nil {
+		return nil, nil, err
+	}
+	entry.QuotedWaitMinutes = estimate.WaitMinutes
+
+	if err := config.GetDB().Create(&entry).Error; err != nil {
+		return nil, nil, err
+	}
+
+	CreateNotification(restaurantID, "waitlist_joined", "Khách chờ bàn: "+entry.CustomerName,
+		fmt.Sprintf("%d khách • chờ khoảng %d phút", entry.PartySize, entry.QuotedWaitMinutes),
+		map[string]interface{}{
+			"waitlist_id": entry.ID,
+			"party_size":  entry.PartySize,
+		})
+
+	return &entry, estimate, nil
+}
+
+// countPartiesAhead đếm số nhóm khách đang chờ phía trước
+func countPartiesAhead(entry models.WaitlistEntry) int {
+	var count int64
+	query := config.GetDB().Model(&models.WaitlistEntry{}).
+		Where("restaurant_id = ? AND status IN ?", entry.RestaurantID, []string{"waiting", "notified"})
+	if entry.ID > 0 {
+		query = query.Where("created_at < ?", entry.CreatedAt)
+	}
+	query.Count(&count)
+	return int(count)
+}
+
+// CreateReservationNotification tạo thông báo đặt bàn mới
+func CreateReservationNotification(r models.Reservation) error {
+	return CreateNotification(
+		r.RestaurantID,
+		"new_reservation",
+		"Đặt bàn mới "+r.Code,
+		fmt.Sprintf("%s • %d khách • %s", r.CustomerName, r.PartySize, r.ReservedAt.Format("15:04 02/01")),
+		map[string]interface{}{
+			"reservation_id": r.ID,
+			"code":           r.Code,
+			"party_size":     r.PartySize,
+			"reserved_at":    r.ReservedAt,
+		},
+	)
+}
+
+func reservationResponse(r models.Reservation) gin.H {
+	response := gin.H{
+		"id":               r.ID,
+		"code":             r.Code,
+		"customer_name":    r.CustomerName,
+		"customer_phone":   r.CustomerPhone,
+		"customer_email":   r.CustomerEmail,
+		"party_size":       r.PartySize,
+		"reserved_at":      r.ReservedAt,
+		"ends_at":          r.EndsAt(),
+		"duration_minutes": r.DurationMinutes,
+		"status":           r.Status,
+		"notes":            r.Notes,
+		"table_id":         r.TableID,
+		"confirmed_at":     r.ConfirmedAt,
+		"created_at":       r.CreatedAt,
+	}
+	if r.Table != nil {
+		response["table"] = gin.H{
+			"id":           r.Table.ID,
+			"table_number": r.Table.TableNumber,
+			"name":         r.Table.Name,
+		}
+	}
+	return response
+}
+
+// errNoAvailability các bàn còn trống vừa bị lượt đặt khác lấy mất
+var errNoAvailability = errors.New("NO_AVAILABILITY: không còn bàn phù hợp")
+
+// publicReservationResponse dữ liệu đặt bàn trả cho khách qua mã đặt bàn: che số điện thoại và email
+// vì ai có mã cũng xem được
+func publicReservationResponse(r models.Reservation) gin.H {
+	response := reservationResponse(r)
+	response["customer_phone"] = maskAccountNumber(r.CustomerPhone)
+	if r.CustomerEmail != nil {
+		response["customer_email"] = maskEmail(*r.CustomerEmail)
+	}
+	return response
+}
+
+// maskEmail che bớt email: nguyenvana@gmail.com -> n***@gmail.com
+func maskEmail(email string) string {
+	name, domain, ok := strings.Cut(email, "@")
+	if !ok || name == "" {
+		return "***"
+	}
+	return name[:1] + "***@" + domain
+}
+
+func waitlistResponse(e models.WaitlistEntry, estimate *services.WaitEstimate) gin.H {
+	response := gin.H{
+		"id":                  e.ID,
+		"code":                e.Code,
+		"customer_name":       e.CustomerName,
+		"customer_phone":      e.CustomerPhone,
+		"party_size":          e.PartySize,
+		"status":              e.Status,
+		"quoted_wait_minutes": e.QuotedWaitMinutes,
+		"table_id":            e.TableID,
+		"created_at":          e.CreatedAt,
+	}
+	if estimate != nil {
+		response["estimated_wait_minutes"] = estimate.WaitMinutes
+		response["parties_ahead"] = estimate.PartiesAhead
+	}
+	return response
+}
+
+// containsString kiểm tra slice có chứa giá trị
+func containsString(list []string, value string) bool {
+	for _, s := range list {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
@@ -17,15 +17,19 @@ import (
 
 // UpdateRestaurantInput request body cho update restaurant
 type UpdateRestaurantInput struct {
-	Name          string  `json:"name"`
-	Description   string  `json:"description"`
-	Logo          string  `json:"logo"`
-	Phone         string  `json:"phone"`
-	Email         string  `json:"email"`
-	Address       string  `json:"address"`
-	IsOpen        *bool   `json:"is_open"`
-	TaxRate       float64 `json:"tax_rate"`
-	ServiceCharge float64 `json:"service_charge"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Logo        string   `json:"logo"`
+	Phone       string   `json:"phone"`
+	Email       string   `json:"email"`
+	Address     string   `json:"address"`
+	Latitude    *float64 `json:"latitude"`
+	Longitude   *float64 `json:"longitude"`
+	IsOpen      *bool    `json:"is_open"`
+	// Bật: QR bàn chỉ gọi món được khi bàn đang có khách
+	TableSessionMode *bool   `json:"table_session_mode"`
+	TaxRate          float64 `json:"tax_rate"`
+	ServiceCharge    float64 `json:"service_charge"`
 }
 
 // ===============================
@@ -58,6 +62,8 @@ func GetRestaurantBySlug(c *gin.Context) {
 		"logo":           restaurant.Logo,
 		"phone":          restaurant.Phone,
 		"address":        restaurant.Address,
+		"latitude":       restaurant.Latitude,
+		"longitude":      restaurant.Longitude,
 		"is_open":        restaurant.IsOpen,
 		"tax_rate":       restaurant.TaxRate,
 		"service_charge": restaurant.ServiceCharge,
@@ -94,25 +100,30 @@ func GetMyRestaurant(c *gin.Context) {
 	config.GetDB().First(&owner, userID)
 
 	utils.SuccessResponse(c, http.StatusOK, gin.H{
-		"id":               restaurant.ID,
-		"name":             owner.Name,
-		"email":            owner.Email,
-		"phone":            owner.Phone,
-		"avatar":           owner.Avatar,
-		"role":             owner.Role,
-		"restaurantId":     restaurant.ID,
-		"restaurantName":   restaurant.Name,
-		"slug":             restaurant.Slug,
-		"description":      restaurant.Description,
-		"logo":             restaurant.Logo,
-		"address":          restaurant.Address,
-		"is_open":          restaurant.IsOpen,
-		"tax_rate":         restaurant.TaxRate,
-		"service_charge":   restaurant.ServiceCharge,
-		"currency":         restaurant.Currency,
-		"package_status":   restaurant.PackageStatus,
-		"package_end_date": restaurant.PackageEndDate,
-		"status":           restaurant.Status,
+		"id":                 restaurant.ID,
+		"name":               owner.Name,
+		"email":              owner.Email,
+		"phone":              owner.Phone,
+		"avatar":             owner.Avatar,
+		"role":               owner.Role,
+		"restaurantId":       restaurant.ID,
+		"restaurantName":     restaurant.Name,
+		"parent_id":          restaurant.ParentID,
+		"branch_name":        restaurant.BranchName,
+		"slug":               restaurant.Slug,
+		"description":        restaurant.Description,
+		"logo":               restaurant.Logo,
+		"address":            restaurant.Address,
+		"latitude":           restaurant.Latitude,
+		"longitude":          restaurant.Longitude,
+		"is_open":            restaurant.IsOpen,
+		"tax_rate":           restaurant.TaxRate,
+		"service_charge":     restaurant.ServiceCharge,
+		"currency":           restaurant.Currency,
+		"table_session_mode": restaurant.TableSessionMode,
+		"package_status":     restaurant.PackageStatus,
+		"package_end_date":   restaurant.PackageEndDate,
+		"status":             restaurant.Status,
 		"package": gin.H{
 			"id":           restaurant.Package.ID,
 			"name":         restaurant.Package.Name,
@@ -176,9 +187,16 @@ func UpdateRestaurant(c *gin.Context) {
 	if input.Address != "" {
 		updates["address"] = input.Address
 	}
+	if input.Latitude != nil && input.Longitude != nil {
+		updates["latitude"] = *input.Latitude
+		updates["longitude"] = *input.Longitude
+	}
 	if input.IsOpen != nil {
 		updates["is_open"] = *input.IsOpen
 	}
+	if input.TableSessionMode != nil {
+		updates["table_session_mode"] = *input.TableSessionMode
+	}
 	if input.TaxRate > 0 {
 		updates["tax_rate"] = input.TaxRate
 	}
@@ -195,17 +213,20 @@ func UpdateRestaurant(c *gin.Context) {
 	config.GetDB().First(&restaurant, restaurantID)
 
 	utils.SuccessResponse(c, http.StatusOK, gin.H{
-		"id":             restaurant.ID,
-		"name":           restaurant.Name,
-		"slug":           restaurant.Slug,
-		"description":    restaurant.Description,
-		"logo":           restaurant.Logo,
-		"phone":          restaurant.Phone,
-		"email":          restaurant.Email,
-		"address":        restaurant.Address,
-		"is_open":        restaurant.IsOpen,
-		"tax_rate":       restaurant.TaxRate,
-		"service_charge": restaurant.ServiceCharge,
+		"id":                 restaurant.ID,
+		"name":               restaurant.Name,
+		"slug":               restaurant.Slug,
+		"description":        restaurant.Description,
+		"logo":               restaurant.Logo,
+		"phone":              restaurant.Phone,
+		"email":              restaurant.Email,
+		"address":            restaurant.Address,
+		"latitude":           restaurant.Latitude,
+		"longitude":          restaurant.Longitude,
+		"is_open":            restaurant.IsOpen,
+		"tax_rate":           restaurant.TaxRate,
+		"service_charge":     restaurant.ServiceCharge,
+		"table_session_mode": restaurant.TableSessionMode,
 	}, "Cập nhật nhà hàng thành công")
 }
 
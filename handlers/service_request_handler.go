@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-api/config"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serviceRequestTitles tiêu đề thông báo theo loại yêu cầu
+var serviceRequestTitles = map[string]string{
+	"call_staff":   "Gọi nhân viên",
+	"request_bill": "Yêu cầu thanh toán",
+	"water":        "Xin thêm nước",
+	"cutlery":      "Xin thêm dụng cụ ăn",
+}
+
+// ===============================
+// REQUEST STRUCTS
+// ===============================
+
+// CreateServiceRequestInput request body cho khách gửi yêu cầu phục vụ
+type CreateServiceRequestInput struct {
+	Type string `json:"type" binding:"required"` // call_staff, request_bill, water, cutlery
+	Note string `json:"note"`
+}
+
+// ===============================
+// PUBLIC HANDLERS
+// ===============================
+
+// CreateServiceRequest khách gửi yêu cầu phục vụ từ trang QR của bàn (Public)
+// @Summary Gửi yêu cầu phục vụ
+// @Description Gọi nhân viên, xin thanh toán, xin nước hoặc dụng cụ ăn. Yêu cầu cùng loại đang chờ sẽ không bị tạo trùng
+// @Tags Public
+// @Accept json
+// @Produce json
+// @Param slug path string true "Restaurant Slug"
+// @Param tableNumber path int true "Số bàn"
+// @Param t query string true "Token trong QR của bàn (hoặc header X-Table-Token)"
+// @Param request body CreateServiceRequestInput true "Loại yêu cầu"
+// @Success 201 {object} map[string]interface{}
+// @Router /public/restaurants/{slug}/tables/{tableNumber}/service-requests [post]
+func CreateServiceRequest(c *gin.Context) {
+	restaurant, table, ok := findPublicTable(c)
+	if !ok {
+		return
+	}
+
+	var input CreateServiceRequestInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	title, valid := serviceRequestTitles[input.Type]
+	if !valid {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Loại yêu cầu không hợp lệ", "INVALID_REQUEST_TYPE", input.Type)
+		return
+	}
+
+	db := config.GetDB()
+
+	// Khách bấm nhiều lần thì trả lại yêu cầu đang chờ
+	var existing models.ServiceRequest
+	if err := db.Where("table_id = ? AND type = ? AND status IN ?", table.ID, input.Type, []string{"pending", "acknowledged"}).
+		First(&existing).Error; err == nil {
+		utils.SuccessResponse(c, http.StatusOK, serviceRequestResponse(existing, &table), "Yêu cầu đã được gửi, nhân viên sẽ đến ngay")
+		return
+	}
+
+	request := models.ServiceRequest{
+		RestaurantID: restaurant.ID,
+		TableID:      table.ID,
+		Type:         input.Type,
+		Status:       "pending",
+	}
+	if input.Note != "" {
+		request.Note = &input.Note
+	}
+
+	if err := db.Create(&request).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể gửi yêu cầu", "CREATE_ERROR", err.Error())
+		return
+	}
+
+	name := tableDisplayName(table)
+	message := name
+	if request.Note != nil {
+		message += " • " + *request.Note
+	}
+	CreateNotification(restaurant.ID, "service_"+request.Type, title+" - "+name, message, map[string]interface{}{
+		"service_request_id": request.ID,
+		"table_id":           table.ID,
+		"table_number":       table.TableNumber,
+	})
+	services.PublishEvent("service_request.created", restaurant.ID, serviceRequestEventData(request, table))
+
+	utils.SuccessResponse(c, http.StatusCreated, serviceRequestResponse(request, &table), "Đã gửi yêu cầu, nhân viên sẽ đến ngay")
+}
+
+// GetTableServiceRequests khách xem các yêu cầu đang xử lý của bàn (Public)
+// @Summary Xem yêu cầu phục vụ của bàn
+// @Description Lấy các yêu cầu chưa hoàn tất của bàn
+// @Tags Public
+// @Produce json
+// @Param slug path string true "Restaurant Slug"
+// @Param tableNumber path int true "Số bàn"
+// @Param t query string true "Token trong QR của bàn (hoặc header X-Table-Token)"
+// @Success 200 {object} map[string]interface{}
+// @Router /public/restaurants/{slug}/tables/{tableNumber}/service-requests [get]
+func GetTableServiceRequests(c *gin.Context) {
+	_, table, ok := findPublicTable(c)
+	if !ok {
+		return
+	}
+
+	var requests []models.ServiceRequest
+	config.GetDB().
+		Where("table_id = ? AND status IN ?", table.ID, []string{"pending", "acknowledged"}).
+		Order("created_at ASC").
+		Find(&requests)
+
+	var data []gin.H
+	for _, r := range requests {
+		data = append(data, serviceRequestResponse(r, &table))
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, data, "")
+}
+
+// ===============================
+// STAFF HANDLERS
+// ===============================
+
+// GetServiceRequests lấy danh sách yêu cầu phục vụ của nhà hàng
+// @Summary Lấy danh sách yêu cầu phục vụ
+// @Description Mặc định lấy các yêu cầu chưa hoàn tất, cũ nhất trước
+// @Tags Service Requests
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param status query string false "Trạng thái" Enums(pending, acknowledged, resolved)
+// @Param type query string false "Loại" Enums(call_staff, request_bill, water, cutlery)
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/service-requests [get]
+func GetServiceRequests(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem yêu cầu của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	query := config.GetDB().Preload("Table").Where("restaurant_id = ?", restaurantID)
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	} else {
+		query = query.Where("status IN ?", []string{"pending", "acknowledged"})
+	}
+	if reqType := c.Query("type"); reqType != "" {
+		query = query.Where("type = ?", reqType)
+	}
+
+	var requests []models.ServiceRequest
+	if err := query.Order("created_at ASC").Limit(100).Find(&requests).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy danh sách yêu cầu", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	var data []gin.H
+	for _, r := range requests {
+		data = append(data, serviceRequestResponse(r, r.Table))
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, data, "")
+}
+
+// AcknowledgeServiceRequest nhân viên nhận xử lý yêu cầu
+// @Summary Nhận yêu cầu phục vụ
+// @Description Đánh dấu nhân viên đã nhận yêu cầu (pending -> acknowledged)
+// @Tags Service Requests
+// @Produce json
+// @Param id path int true "Service Request ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /service-requests/{id}/acknowledge [put]
+func AcknowledgeServiceRequest(c *gin.Context) {
+	updateServiceRequestStatus(c, "acknowledged")
+}
+
+// ResolveServiceRequest nhân viên hoàn tất yêu cầu
+// @Summary Hoàn tất yêu cầu phục vụ
+// @Description Đánh dấu yêu cầu đã được xử lý xong
+// @Tags Service Requests
+// @Produce json
+// @Param id path int true "Service Request ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /service-requests/{id}/resolve [put]
+func ResolveServiceRequest(c *gin.Context) {
+	updateServiceRequestStatus(c, "resolved")
+}
+
+// StreamRestaurantEvents stream sự kiện realtime cho màn hình nhân viên (Server-Sent Events)
+// @Summary Stream sự kiện realtime
+// @Description Nhận sự kiện yêu cầu phục vụ, đơn hàng... qua Server-Sent Events
+// @Tags Service Requests
+// @Produce text/event-stream
+// @Param id path int true "Restaurant ID"
+// @Security BearerAuth
+// @Router /restaurants/{id}/events [get]
+func StreamRestaurantEvents(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem sự kiện của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	events, unsubscribe := services.SubscribeRestaurantEvents(uint(restaurantID))
+	defer unsubscribe()
+
+	heartbeat := time.NewTicker(25 * time.Second)
+	defer heartbeat.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case e, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(e.Type, e)
+			return true
+		case <-heartbeat.C:
+			c.SSEvent("ping", gin.H{"time": time.Now()})
+			return true
+		}
+	})
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// findPublicTable tìm nhà hàng và bàn theo slug + số bàn trên URL public
+func findPublicTable(c *gin.Context) (models.Restaurant, models.Table, bool) {
+	var restaurant models.Restaurant
+	var table models.Table
+
+	tableNumber, err := strconv.Atoi(c.Param("tableNumber"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Số bàn không hợp lệ", "INVALID_TABLE_NUMBER", "")
+		return restaurant, table, false
+	}
+
+	db := config.GetDB()
+	if err := db.Where("slug = ? AND status = ?", c.Param("slug"), "active").First(&restaurant).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy nhà hàng", "RESTAURANT_NOT_FOUND", "")
+		return restaurant, table, false
+	}
+
+	if err := db.Where("restaurant_id = ? AND table_number = ? AND is_active = ?", restaurant.ID, tableNumber, true).First(&table).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy bàn", "TABLE_NOT_FOUND", "")
+		return restaurant, table, false
+	}
+
+	if !authorizePublicTable(c, restaurant, table, publicTableToken(c)) {
+		return restaurant, table, false
+	}
+
+	return restaurant, table, true
+}
+
+// tableDisplayName tên hiển thị của bàn, mặc định "Bàn <số>"
+func tableDisplayName(table models.Table) string {
+	if table.Name != nil && *table.Name != "" {
+		return *table.Name
+	}
+	return fmt.Sprintf("Bàn %d", table.TableNumber)
+}
+
+// updateServiceRequestStatus chuyển trạng thái yêu cầu phục vụ và ghi nhận nhân viên xử lý
+func updateServiceRequestStatus(c *gin.Context, status string) {
+	requestID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	db := config.GetDB()
+
+	var request models.ServiceRequest
+	if err := db.Preload("Table").First(&request, requestID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy yêu cầu", "SERVICE_REQUEST_NOT_FOUND", "")
+		return
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || request.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xử lý yêu cầu này", "FORBIDDEN", "")
+		return
+	}
+
+	validTransitions := map[string][]string{
+		"pending":      {"acknowledged", "resolved"},
+		"acknowledged": {"resolved"},
+	}
+
+	allowed, exists := validTransitions[request.Status]
+	if !exists || !containsString(allowed, status) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Chuyển trạng thái không hợp lệ", "INVALID_TRANSITION",
+			fmt.Sprintf("Cannot transition from %s to %s", request.Status, status))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	staffID, _ := userID.(uint)
+	now := time.Now()
+
+	updates := map[string]interface{}{"status": status}
+	if status == "acknowledged" || request.AcknowledgedAt == nil {
+		// Hoàn tất thẳng từ pending thì thời điểm nhận cũng là lúc hoàn tất
+		updates["acknowledged_at"] = now
+		updates["acknowledged_by"] = staffID
+	}
+	if status == "resolved" {
+		updates["resolved_at"] = now
+		updates["resolved_by"] = staffID
+	}
+
+	if err := db.Model(&request).Updates(updates).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể cập nhật yêu cầu", "UPDATE_ERROR", err.Error())
+		return
+	}
+	db.Preload("Table").First(&request, request.ID)
+
+	if request.Table != nil {
+		services.PublishEvent("service_request."+status, request.RestaurantID, serviceRequestEventData(request, *request.Table))
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, serviceRequestResponse(request, request.Table), "Cập nhật yêu cầu thành công")
+}
+
+func serviceRequestEventData(r models.ServiceRequest, table models.Table) map[string]interface{} {
+	return map[string]interface{}{
+		"service_request_id": r.ID,
+		"type":               r.Type,
+		"status":             r.Status,
+		"table_id":           table.ID,
+		"table_number":       table.TableNumber,
+		"table_name":         table.Name,
+	}
+}
+
+func serviceRequestResponse(r models.ServiceRequest, table *models.Table) gin.H {
+	response := gin.H{
+		"id":              r.ID,
+		"type":            r.Type,
+		"title":           serviceRequestTitles[r.Type],
+		"status":          r.Status,
+		"note":            r.Note,
+		"table_id":        r.TableID,
+		"acknowledged_at": r.AcknowledgedAt,
+		"resolved_at":     r.ResolvedAt,
+		"created_at":      r.CreatedAt,
+	}
+	if table != nil {
+		response["table"] = gin.H{
+			"id":           table.ID,
+			"table_number": table.TableNumber,
+			"name":         table.Name,
+		}
+	}
+	return response
+}
@@ -0,0 +1,512 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/config"
+	"go-api/middleware"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Link mời nhân viên có hiệu lực 72 giờ
+const staffInviteTTL = 72 * time.Hour
+
+// ===============================
+// REQUEST STRUCTS
+// ===============================
+
+// InviteStaffInput request body cho mời nhân viên
+type InviteStaffInput struct {
+	Email string `json:"email" binding:"required,email"`
+	Name  string `json:"name" binding:"required"`
+	Phone string `json:"phone"`
+	Role  string `json:"role" binding:"required,oneof=manager cashier waiter kitchen"`
+}
+
+// UpdateStaffInput request body cho đổi vai trò nhân viên
+type UpdateStaffInput struct {
+	Role string `json:"role" binding:"required,oneof=manager cashier waiter kitchen"`
+}
+
+// AcceptStaffInviteInput request body cho nhân viên nhận lời mời
+type AcceptStaffInviteInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+	Name     string `json:"name"`
+	Phone    string `json:"phone"`
+}
+
+// ===============================
+// HANDLERS
+// ===============================
+
+// GetStaff lấy danh sách nhân viên của nhà hàng
+// @Summary Danh sách nhân viên
+// @Description Lấy nhân viên (đã mời, đang làm, đã khóa) của nhà hàng
+// @Tags Staff
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param status query string false "Lọc theo trạng thái (invited, active, disabled)"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/staff [get]
+func GetStaff(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem nhân viên của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	query := config.GetDB().Preload("User").Where("restaurant_id = ?", restaurantID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var staff []models.StaffMember
+	if err := query.Order("created_at ASC").Find(&staff).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy danh sách nhân viên", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	result := make([]gin.H, 0, len(staff))
+	for _, s := range staff {
+		result = append(result, staffResponse(s))
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, result, "")
+}
+
+// InviteStaff mời nhân viên mới vào nhà hàng
+// @Summary Mời nhân viên
+// @Description Tạo tài khoản nhân viên ở trạng thái chờ và trả về link mời (hiệu lực 72 giờ) để nhân viên tự đặt mật khẩu
+// @Tags Staff
+// @Accept json
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param body body InviteStaffInput true "Thông tin nhân viên"
+// @Success 201 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/staff/invite [post]
+func InviteStaff(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền mời nhân viên cho nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var input InviteStaffInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+	input.Email = strings.ToLower(strings.TrimSpace(input.Email))
+
+	db := config.GetDB()
+
+	var restaurant models.Restaurant
+	if err := db.First(&restaurant, restaurantID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy nhà hàng", "RESTAURANT_NOT_FOUND", "")
+		return
+	}
+
+	// Mỗi email chỉ gắn với một tài khoản
+	var existingUser models.User
+	if err := db.Where("email = ?", input.Email).First(&existingUser).Error; err == nil {
+		utils.ErrorResponse(c, http.StatusConflict, "Email đã được sử dụng", "EMAIL_EXISTS", "")
+		return
+	}
+
+	// Mật khẩu ngẫu nhiên, nhân viên sẽ đặt lại khi nhận lời mời
+	hashedPassword, err := randomPasswordHash()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi hệ thống", "HASH_ERROR", err.Error())
+		return
+	}
+
+	user := models.User{
+		Email:    input.Email,
+		Password: hashedPassword,
+		Name:     input.Name,
+		Role:     "staff",
+		IsActive: true,
+	}
+	if input.Phone != "" {
+		user.Phone = &input.Phone
+	}
+
+	inviterID := currentUserID(c)
+	staff := models.StaffMember{
+		RestaurantID: restaurant.ID,
+		Role:         input.Role,
+		Status:       "invited",
+		InvitedBy:    &inviterID,
+		InvitedAt:    time.Now(),
+	}
+
+	var rawToken string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		staff.UserID = user.ID
+		if err := tx.Create(&staff).Error; err != nil {
+			return err
+		}
+		token, err := services.IssueUserToken(tx, user.ID, services.UserTokenStaffInvite, staffInviteTTL)
+		rawToken = token
+		return err
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể mời nhân viên", "CREATE_ERROR", err.Error())
+		return
+	}
+
+	staff.User = &user
+	response := staffResponse(staff)
+	response["invite_url"] = staffInviteURL(rawToken)
+	response["invite_expires_at"] = staff.InvitedAt.Add(staffInviteTTL)
+
+	utils.SuccessResponse(c, http.StatusCreated, response, "Đã tạo lời mời nhân viên")
+}
+
+// ResendStaffInvite tạo lại link mời cho nhân viên chưa nhận lời mời
+// @Summary Gửi lại lời mời
+// @Description Link mời cũ mất hiệu lực, link mới có hiệu lực 72 giờ
+// @Tags Staff
+// @Produce json
+// @Param id path int true "Staff ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /staff/{id}/resend-invite [post]
+func ResendStaffInvite(c *gin.Context) {
+	staff, ok := loadStaffForManage(c)
+	if !ok {
+		return
+	}
+
+	if staff.Status != "invited" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Nhân viên đã nhận lời mời", "INVITE_ALREADY_ACCEPTED", staff.Status)
+		return
+	}
+
+	now := time.Now()
+	var rawToken string
+	err := config.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&staff).Update("invited_at", now).Error; err != nil {
+			return err
+		}
+		staff.InvitedAt = now
+		token, err := services.IssueUserToken(tx, staff.UserID, services.UserTokenStaffInvite, staffInviteTTL)
+		rawToken = token
+		return err
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo lại lời mời", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	response := staffResponse(staff)
+	response["invite_url"] = staffInviteURL(rawToken)
+	response["invite_expires_at"] = now.Add(staffInviteTTL)
+
+	utils.SuccessResponse(c, http.StatusOK, response, "Đã tạo lại lời mời")
+}
+
+// UpdateStaff đổi vai trò nhân viên
+// @Summary Đổi vai trò nhân viên
+// @Description Vai trò mới có hiệu lực ngay ở request tiếp theo của nhân viên
+// @Tags Staff
+// @Accept json
+// @Produce json
+// @Param id path int true "Staff ID"
+// @Param body body UpdateStaffInput true "Vai trò mới"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /staff/{id} [put]
+func UpdateStaff(c *gin.Context) {
+	var input UpdateStaffInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	staff, ok := loadStaffForManage(c)
+	if !ok {
+		return
+	}
+
+	if err := config.GetDB().Model(&staff).Update("role", input.Role).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể cập nhật nhân viên", "UPDATE_ERROR", err.Error())
+		return
+	}
+	staff.Role = input.Role
+
+	utils.SuccessResponse(c, http.StatusOK, staffResponse(staff), "Đã cập nhật vai trò nhân viên")
+}
+
+// DisableStaff khóa tài khoản nhân viên
+// @Summary Khóa nhân viên
+// @Description Nhân viên bị đăng xuất ngay (token hiện tại không còn dùng được) và không thể đăng nhập lại
+// @Tags Staff
+// @Produce json
+// @Param id path int true "Staff ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /staff/{id}/disable [put]
+func DisableStaff(c *gin.Context) {
+	staff, ok := loadStaffForManage(c)
+	if !ok {
+		return
+	}
+
+	if staff.Status == "disabled" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Nhân viên đã bị khóa", "STAFF_ALREADY_DISABLED", "")
+		return
+	}
+
+	now := time.Now()
+	if err := config.GetDB().Model(&staff).Updates(map[string]interface{}{
+		"status":      "disabled",
+		"disabled_at": now,
+	}).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể khóa nhân viên", "UPDATE_ERROR", err.Error())
+		return
+	}
+	staff.Status = "disabled"
+	staff.DisabledAt = &now
+
+	// Đăng xuất nhân viên khỏi mọi thiết bị
+	services.RevokeUserRefreshTokens(config.GetDB(), staff.UserID, services.RevokeReasonStaffDisabled)
+
+	utils.SuccessResponse(c, http.StatusOK, staffResponse(staff), "Đã khóa nhân viên")
+}
+
+// EnableStaff mở khóa tài khoản nhân viên
+// @Summary Mở khóa nhân viên
+// @Description Nhân viên chưa từng nhận lời mời sẽ quay lại trạng thái chờ nhận lời mời
+// @Tags Staff
+// @Produce json
+// @Param id path int true "Staff ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /staff/{id}/enable [put]
+func EnableStaff(c *gin.Context) {
+	staff, ok := loadStaffForManage(c)
+	if !ok {
+		return
+	}
+
+	if staff.Status != "disabled" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Nhân viên không bị khóa", "STAFF_NOT_DISABLED", staff.Status)
+		return
+	}
+
+	status := "active"
+	if staff.JoinedAt == nil {
+		status = "invited"
+	}
+
+	if err := config.GetDB().Model(&staff).Updates(map[string]interface{}{
+		"status":      status,
+		"disabled_at": nil,
+	}).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể mở khóa nhân viên", "UPDATE_ERROR", err.Error())
+		return
+	}
+	staff.Status = status
+	staff.DisabledAt = nil
+
+	utils.SuccessResponse(c, http.StatusOK, staffResponse(staff), "Đã mở khóa nhân viên")
+}
+
+// RevokeStaffSessions đăng xuất nhân viên khỏi tất cả thiết bị
+// @Summary Đăng xuất nhân viên khỏi mọi thiết bị
+// @Description Thu hồi mọi refresh token của nhân viên (access token hiện tại hết hạn sau tối đa 15 phút)
+// @Tags Staff
+// @Produce json
+// @Param id path int true "Staff ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /staff/{id}/revoke-sessions [post]
+func RevokeStaffSessions(c *gin.Context) {
+	staff, ok := loadStaffForManage(c)
+	if !ok {
+		return
+	}
+
+	revoked, err := services.RevokeUserRefreshTokens(config.GetDB(), staff.UserID, services.RevokeReasonLogoutAll)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể đăng xuất nhân viên", "REVOKE_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"staff_id":         staff.ID,
+		"revoked_sessions": revoked,
+	}, "Đã đăng xuất nhân viên khỏi tất cả thiết bị")
+}
+
+// AcceptStaffInvite nhân viên nhận lời mời và đặt mật khẩu
+// @Summary Nhận lời mời nhân viên
+// @Description Dùng token trong link mời để kích hoạt tài khoản, sau đó đăng nhập bằng email + mật khẩu vừa đặt
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body AcceptStaffInviteInput true "Token mời và mật khẩu"
+// @Success 200 {object} map[string]interface{}
+// @Router /auth/staff/accept-invite [post]
+func AcceptStaffInvite(c *gin.Context) {
+	var input AcceptStaffInviteInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi hệ thống", "HASH_ERROR", err.Error())
+		return
+	}
+
+	var staff models.StaffMember
+	err = config.GetDB().Transaction(func(tx *gorm.DB) error {
+		token, err := services.ConsumeUserToken(tx, services.UserTokenStaffInvite, input.Token)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ? AND status = ?", token.UserID, "invited").First(&staff).Error; err != nil {
+			// Lời mời đã được nhận hoặc nhân viên đã bị khóa
+			return fmt.Errorf("INVITE_INVALID: lời mời không còn hiệu lực")
+		}
+
+		userUpdates := map[string]interface{}{"password": string(hashedPassword)}
+		if input.Name != "" {
+			userUpdates["name"] = input.Name
+		}
+		if input.Phone != "" {
+			userUpdates["phone"] = input.Phone
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", token.UserID).Updates(userUpdates).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		staff.Status = "active"
+		staff.JoinedAt = &now
+		return tx.Model(&staff).Updates(map[string]interface{}{
+			"status":    staff.Status,
+			"joined_at": now,
+		}).Error
+	})
+	if err != nil {
+		code, msg, _ := strings.Cut(err.Error(), ": ")
+		switch code {
+		case "INVALID_TOKEN", "TOKEN_USED", "TOKEN_EXPIRED", "INVITE_INVALID":
+			utils.ErrorResponse(c, http.StatusBadRequest, "Link mời không hợp lệ hoặc đã hết hạn", code, msg)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể kích hoạt tài khoản", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	config.GetDB().Preload("User").Preload("Restaurant").First(&staff, staff.ID)
+
+	response := staffResponse(staff)
+	if staff.Restaurant != nil {
+		response["restaurant"] = gin.H{
+			"id":   staff.Restaurant.ID,
+			"name": staff.Restaurant.Name,
+			"slug": staff.Restaurant.Slug,
+		}
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, response, "Đã kích hoạt tài khoản, vui lòng đăng nhập")
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// loadStaffForManage lấy nhân viên theo :id và kiểm tra quyền quản lý
+func loadStaffForManage(c *gin.Context) (models.StaffMember, bool) {
+	staffID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	var staff models.StaffMember
+	if err := config.GetDB().Preload("User").First(&staff, staffID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy nhân viên", "STAFF_NOT_FOUND", "")
+		return staff, false
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || staff.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền quản lý nhân viên này", "FORBIDDEN", "")
+		return staff, false
+	}
+
+	return staff, true
+}
+
+// staffInviteURL link nhận lời mời trên frontend
+func staffInviteURL(rawToken string) string {
+	return config.FrontendBaseURL() + "/staff/accept-invite?token=" + url.QueryEscape(rawToken)
+}
+
+// randomPasswordHash tạo mật khẩu ngẫu nhiên (đã hash) cho tài khoản chưa kích hoạt
+func randomPasswordHash() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(base64.RawURLEncoding.EncodeToString(buf)), bcrypt.DefaultCost)
+	return string(hashed), err
+}
+
+func staffResponse(staff models.StaffMember) gin.H {
+	response := gin.H{
+		"id":            staff.ID,
+		"restaurant_id": staff.RestaurantID,
+		"user_id":       staff.UserID,
+		"role":          staff.Role,
+		"status":        staff.Status,
+		"permissions":   middleware.StaffRolePermissions[staff.Role],
+		"invited_by":    staff.InvitedBy,
+		"invited_at":    staff.InvitedAt,
+		"joined_at":     staff.JoinedAt,
+		"disabled_at":   staff.DisabledAt,
+		"created_at":    staff.CreatedAt,
+	}
+	if staff.User != nil {
+		response["email"] = staff.User.Email
+		response["name"] = staff.User.Name
+		response["phone"] = staff.User.Phone
+		response["avatar"] = staff.User.Avatar
+	}
+	return response
+}
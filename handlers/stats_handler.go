@@ -7,9 +7,11 @@ import (
 
 	"go-api/config"
 	"go-api/models"
+	"go-api/services"
 	"go-api/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // ===============================
@@ -41,15 +43,16 @@ func GetStatsOverview(c *gin.Context) {
 	db := config.GetDB()
 	today := time.Now().Format("2006-01-02")
 
-	// Thống kê hôm nay
+	// Thống kê hôm nay (doanh thu thuần đọc từ sổ cái, theo thời điểm ghi sổ)
 	var todayOrders int64
 	var todayRevenue float64
-	db.Model(&models.Order{}).
-		Where("restaurant_id = ? AND DATE(created_at) = ? AND payment_status = ?", restaurantID, today, "paid").
-		Count(&todayOrders)
-	db.Model(&models.Order{}).
-		Where("restaurant_id = ? AND DATE(created_at) = ? AND payment_status = ?", restaurantID, today, "paid").
-		Select("COALESCE(SUM(total_amount), 0)").
+	services.LedgerRevenueQuery(db, uint(restaurantID)).
+		Where("DATE(t.posted_at) = ?", today).
+		Select(services.LedgerPaidOrdersSQL).
+		Scan(&todayOrders)
+	services.LedgerRevenueQuery(db, uint(restaurantID)).
+		Where("DATE(t.posted_at) = ?", today).
+		Select(services.LedgerNetRevenueSQL).
 		Scan(&todayRevenue)
 
 	avgTodayOrder := float64(0)
@@ -60,12 +63,13 @@ func GetStatsOverview(c *gin.Context) {
 	// Thống kê tháng này
 	var monthOrders int64
 	var monthRevenue float64
-	db.Model(&models.Order{}).
-		Where("restaurant_id = ? AND EXTRACT(MONTH FROM created_at) = EXTRACT(MONTH FROM NOW()) AND EXTRACT(YEAR FROM created_at) = EXTRACT(YEAR FROM NOW()) AND payment_status = ?", restaurantID, "paid").
-		Count(&monthOrders)
-	db.Model(&models.Order{}).
-		Where("restaurant_id = ? AND EXTRACT(MONTH FROM created_at) = EXTRACT(MONTH FROM NOW()) AND EXTRACT(YEAR FROM created_at) = EXTRACT(YEAR FROM NOW()) AND payment_status = ?", restaurantID, "paid").
-		Select("COALESCE(SUM(total_amount), 0)").
+	services.LedgerRevenueQuery(db, uint(restaurantID)).
+		Where("EXTRACT(MONTH FROM t.posted_at) = EXTRACT(MONTH FROM NOW()) AND EXTRACT(YEAR FROM t.posted_at) = EXTRACT(YEAR FROM NOW())").
+		Select(services.LedgerPaidOrdersSQL).
+		Scan(&monthOrders)
+	services.LedgerRevenueQuery(db, uint(restaurantID)).
+		Where("EXTRACT(MONTH FROM t.posted_at) = EXTRACT(MONTH FROM NOW()) AND EXTRACT(YEAR FROM t.posted_at) = EXTRACT(YEAR FROM NOW())").
+		Select(services.LedgerNetRevenueSQL).
 		Scan(&monthRevenue)
 
 	avgMonthOrder := float64(0)
@@ -81,9 +85,13 @@ func GetStatsOverview(c *gin.Context) {
 	db.Model(&models.Table{}).Where("restaurant_id = ? AND is_active = ? AND status = ?", restaurantID, true, "available").Count(&availableTables)
 	db.Model(&models.Table{}).Where("restaurant_id = ? AND is_active = ? AND status = ?", restaurantID, true, "occupied").Count(&occupiedTables)
 
+	// Doanh thu hôm nay theo loại đơn
+	todayByOrderType := revenueByOrderType(services.LedgerRevenueQuery(db, uint(restaurantID)).
+		Where("DATE(t.posted_at) = ?", today))
+
 	// Thống kê đơn hàng theo trạng thái
 	ordersByStatus := make(map[string]int64)
-	statuses := []string{"pending", "confirmed", "preparing", "ready", "serving"}
+	statuses := []string{"pending", "confirmed", "preparing", "ready", "serving", "ready_for_pickup", "out_for_delivery"}
 	for _, status := range statuses {
 		var count int64
 		db.Model(&models.Order{}).Where("restaurant_id = ? AND status = ?", restaurantID, status).Count(&count)
@@ -95,6 +103,7 @@ func GetStatsOverview(c *gin.Context) {
 			"orders":          todayOrders,
 			"revenue":         todayRevenue,
 			"avg_order_value": avgTodayOrder,
+			"by_order_type":   todayByOrderType,
 		},
 		"this_month": gin.H{
 			"orders":          monthOrders,
@@ -107,6 +116,7 @@ func GetStatsOverview(c *gin.Context) {
 			"occupied":  occupiedTables,
 		},
 		"orders_by_status": ordersByStatus,
+		"print_jobs":       printJobCounts(uint(restaurantID)),
 	}, "")
 }
 
@@ -120,6 +130,7 @@ func GetStatsOverview(c *gin.Context) {
 // @Param period query string false "Kỳ thống kê" default(day) Enums(day, week, month)
 // @Param start_date query string false "Ngày bắt đầu (YYYY-MM-DD)"
 // @Param end_date query string false "Ngày kết thúc (YYYY-MM-DD)"
+// @Param order_type query string false "Loại đơn" Enums(dine_in, takeaway)
 // @Success 200 {object} map[string]interface{}
 // @Security BearerAuth
 // @Router /restaurants/{id}/stats/revenue [get]
@@ -150,17 +161,23 @@ func GetStatsRevenue(c *gin.Context) {
 		endDate = time.Now().Format("2006-01-02")
 	}
 
+	// Doanh thu thuần trong khoảng thời gian đọc từ sổ cái (lọc theo loại đơn nếu có)
+	orderType := c.Query("order_type")
+	revenueEntries := func() *gorm.DB {
+		query := services.LedgerRevenueQuery(db, uint(restaurantID)).
+			Where("DATE(t.posted_at) >= ? AND DATE(t.posted_at) <= ?", startDate, endDate)
+		if orderType != "" {
+			query = query.Where("o.order_type = ?", orderType)
+		}
+		return query
+	}
+
 	// Tổng doanh thu và đơn hàng trong khoảng thời gian
 	var totalRevenue float64
 	var totalOrders int64
-	db.Model(&models.Order{}).
-		Where("restaurant_id = ? AND DATE(created_at) >= ? AND DATE(created_at) <= ? AND payment_status = ?",
-			restaurantID, startDate, endDate, "paid").
-		Count(&totalOrders)
-	db.Model(&models.Order{}).
-		Where("restaurant_id = ? AND DATE(created_at) >= ? AND DATE(created_at) <= ? AND payment_status = ?",
-			restaurantID, startDate, endDate, "paid").
-		Select("COALESCE(SUM(total_amount), 0)").
+	revenueEntries().Select(services.LedgerPaidOrdersSQL).Scan(&totalOrders)
+	revenueEntries().
+		Select(services.LedgerNetRevenueSQL).
 		Scan(&totalRevenue)
 
 	avgOrderValue := float64(0)
@@ -177,11 +194,9 @@ func GetStatsRevenue(c *gin.Context) {
 			Revenue float64
 			Orders  int64
 		}
-		db.Model(&models.Order{}).
-			Select("DATE(created_at) as date, COALESCE(SUM(total_amount), 0) as revenue, COUNT(*) as orders").
-			Where("restaurant_id = ? AND DATE(created_at) >= ? AND DATE(created_at) <= ? AND payment_status = ?",
-				restaurantID, startDate, endDate, "paid").
-			Group("DATE(created_at)").
+		revenueEntries().
+			Select("TO_CHAR(DATE(t.posted_at), 'YYYY-MM-DD') as date, " + services.LedgerNetRevenueSQL + " as revenue, " + services.LedgerPaidOrdersSQL + " as orders").
+			Group("DATE(t.posted_at)").
 			Order("date ASC").
 			Scan(&results)
 
@@ -199,6 +214,7 @@ func GetStatsRevenue(c *gin.Context) {
 		"total_orders":    totalOrders,
 		"avg_order_value": avgOrderValue,
 		"chart_data":      chartData,
+		"by_order_type":   revenueByOrderType(revenueEntries()),
 	}, "")
 }
 
@@ -237,7 +253,7 @@ func GetStatsMenu(c *gin.Context) {
 		Select("menu_items.id, menu_items.name, SUM(order_items.quantity) as quantity_sold, SUM(order_items.line_total) as revenue").
 		Joins("JOIN menu_items ON menu_items.id = order_items.menu_item_id").
 		Joins("JOIN orders ON orders.id = order_items.order_id").
-		Where("orders.restaurant_id = ? AND orders.payment_status = ?", restaurantID, "paid").
+		Where("orders.restaurant_id = ? AND orders.payment_status = ? AND order_items.prep_status <> ?", restaurantID, "paid", "cancelled").
 		Group("menu_items.id, menu_items.name").
 		Order("quantity_sold DESC").
 		Limit(10).
@@ -264,7 +280,7 @@ func GetStatsMenu(c *gin.Context) {
 		Joins("JOIN menu_items ON menu_items.id = order_items.menu_item_id").
 		Joins("JOIN categories ON categories.id = menu_items.category_id").
 		Joins("JOIN orders ON orders.id = order_items.order_id").
-		Where("orders.restaurant_id = ? AND orders.payment_status = ?", restaurantID, "paid").
+		Where("orders.restaurant_id = ? AND orders.payment_status = ? AND order_items.prep_status <> ?", restaurantID, "paid", "cancelled").
 		Group("categories.name").
 		Order("revenue DESC").
 		Scan(&byCategory)
@@ -283,3 +299,119 @@ func GetStatsMenu(c *gin.Context) {
 		"by_category": byCategoryData,
 	}, "")
 }
+
+// GetStatsService thống kê yêu cầu phục vụ và thời gian phản hồi
+// @Summary Thống kê yêu cầu phục vụ
+// @Description Số yêu cầu theo loại, thời gian phản hồi (tạo -> nhận) và xử lý (tạo -> hoàn tất) trung bình
+// @Tags Statistics
+// @Accept json
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param start_date query string false "Ngày bắt đầu (YYYY-MM-DD)"
+// @Param end_date query string false "Ngày kết thúc (YYYY-MM-DD)"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/stats/service [get]
+func GetStatsService(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem thống kê này", "FORBIDDEN", "")
+		return
+	}
+
+	db := config.GetDB()
+
+	// Mặc định 30 ngày gần nhất
+	startDate := c.Query("start_date")
+	endDate := c.Query("end_date")
+	if startDate == "" {
+		startDate = time.Now().AddDate(0, 0, -30).Format("2006-01-02")
+	}
+	if endDate == "" {
+		endDate = time.Now().Format("2006-01-02")
+	}
+
+	var byType []struct {
+		Type              string
+		Total             int64
+		Pending           int64
+		AvgResponseSecond float64
+		AvgResolveSecond  float64
+	}
+	db.Model(&models.ServiceRequest{}).
+		Select(`type, COUNT(*) as total,
+			COUNT(*) FILTER (WHERE status = 'pending') as pending,
+			COALESCE(AVG(EXTRACT(EPOCH FROM (acknowledged_at - created_at))), 0) as avg_response_second,
+			COALESCE(AVG(EXTRACT(EPOCH FROM (resolved_at - created_at))), 0) as avg_resolve_second`).
+		Where("restaurant_id = ? AND DATE(created_at) >= ? AND DATE(created_at) <= ?", restaurantID, startDate, endDate).
+		Group("type").
+		Order("total DESC").
+		Scan(&byType)
+
+	var overall struct {
+		Total             int64
+		AvgResponseSecond float64
+		AvgResolveSecond  float64
+		MaxResponseSecond float64
+	}
+	db.Model(&models.ServiceRequest{}).
+		Select(`COUNT(*) as total,
+			COALESCE(AVG(EXTRACT(EPOCH FROM (acknowledged_at - created_at))), 0) as avg_response_second,
+			COALESCE(AVG(EXTRACT(EPOCH FROM (resolved_at - created_at))), 0) as avg_resolve_second,
+			COALESCE(MAX(EXTRACT(EPOCH FROM (acknowledged_at - created_at))), 0) as max_response_second`).
+		Where("restaurant_id = ? AND DATE(created_at) >= ? AND DATE(created_at) <= ?", restaurantID, startDate, endDate).
+		Scan(&overall)
+
+	var openRequests int64
+	db.Model(&models.ServiceRequest{}).
+		Where("restaurant_id = ? AND status IN ?", restaurantID, []string{"pending", "acknowledged"}).
+		Count(&openRequests)
+
+	var typeStats []gin.H
+	for _, t := range byType {
+		typeStats = append(typeStats, gin.H{
+			"type":                 t.Type,
+			"total":                t.Total,
+			"pending":              t.Pending,
+			"avg_response_seconds": int(t.AvgResponseSecond),
+			"avg_resolve_seconds":  int(t.AvgResolveSecond),
+		})
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"total_requests":       overall.Total,
+		"open_requests":        openRequests,
+		"avg_response_seconds": int(overall.AvgResponseSecond),
+		"avg_resolve_seconds":  int(overall.AvgResolveSecond),
+		"max_response_seconds": int(overall.MaxResponseSecond),
+		"by_type":              typeStats,
+	}, "")
+}
+
+// revenueByOrderType gom doanh thu thuần / số đơn theo loại đơn (dine_in, takeaway...) từ services.LedgerRevenueQuery
+func revenueByOrderType(query *gorm.DB) []gin.H {
+	var results []struct {
+		OrderType string
+		Revenue   float64
+		Orders    int64
+	}
+	query.Select("COALESCE(o.order_type, 'other') as order_type, " + services.LedgerNetRevenueSQL + " as revenue, " + services.LedgerPaidOrdersSQL + " as orders").
+		Group("COALESCE(o.order_type, 'other')").
+		Order("revenue DESC").
+		Scan(&results)
+
+	var data []gin.H
+	for _, r := range results {
+		data = append(data, gin.H{
+			"order_type": r.OrderType,
+			"revenue":    r.Revenue,
+			"orders":     r.Orders,
+		})
+	}
+	return data
+}
@@ -5,6 +5,7 @@ import (
 	"strconv"
 
 	"go-api/config"
+	"go-api/middleware"
 	"go-api/models"
 	"go-api/utils"
 
@@ -43,6 +44,8 @@ type UpdateTableInput struct {
 // @Param id path int true "Restaurant ID"
 // @Param status query string false "Filter theo status" Enums(available, occupied, reserved)
 // @Param is_active query bool false "Filter theo is_active"
+// @Param zone_id query int false "Filter theo khu vực"
+// @Param view query string false "floor_plan = trả về sơ đồ theo khu vực kèm trạng thái live" Enums(floor_plan)
 // @Success 200 {object} map[string]interface{}
 // @Security BearerAuth
 // @Router /restaurants/{id}/tables [get]
@@ -75,6 +78,11 @@ func GetTables(c *gin.Context) {
 		query = query.Where("is_active = ?", false)
 	}
 
+	// Filter by zone
+	if zoneID := c.Query("zone_id"); zoneID != "" {
+		query = query.Where("zone_id = ?", zoneID)
+	}
+
 	if err := query.Order("table_number ASC").Find(&tables).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy danh sách bàn", "QUERY_ERROR", err.Error())
 		return
@@ -84,17 +92,14 @@ func GetTables(c *gin.Context) {
 	var restaurant models.Restaurant
 	config.GetDB().First(&restaurant, restaurantID)
 
+	if c.Query("view") == "floor_plan" {
+		getFloorPlan(c, restaurant, tables)
+		return
+	}
+
 	var data []gin.H
 	for _, t := range tables {
-		data = append(data, gin.H{
-			"id":           t.ID,
-			"table_number": t.TableNumber,
-			"name":         t.Name,
-			"capacity":     t.Capacity,
-			"status":       t.Status,
-			"is_active":    t.IsActive,
-			"qr_url":       "/" + restaurant.Slug + "/menu/" + strconv.Itoa(t.TableNumber),
-		})
+		data = append(data, tableLayoutResponse(restaurant, t))
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, data, "")
@@ -158,12 +163,13 @@ func CreateTable(c *gin.Context) {
 	}
 
 	table := models.Table{
-		RestaurantID: uint(restaurantID),
-		TableNumber:  input.TableNumber,
-		Name:         &input.Name,
-		Capacity:     capacity,
-		Status:       "available",
-		IsActive:     true,
+		RestaurantID:   uint(restaurantID),
+		TableNumber:    input.TableNumber,
+		Name:           &input.Name,
+		Capacity:       capacity,
+		QRTokenVersion: 1,
+		Status:         "available",
+		IsActive:       true,
 	}
 
 	if err := config.GetDB().Create(&table).Error; err != nil {
@@ -171,13 +177,18 @@ func CreateTable(c *gin.Context) {
 		return
 	}
 
+	// Token QR ký theo ID bàn nên chỉ tạo được sau khi lưu
+	orderURL := syncTableQRCode(restaurant, &table)
+
 	utils.SuccessResponse(c, http.StatusCreated, gin.H{
 		"id":           table.ID,
 		"table_number": table.TableNumber,
 		"name":         table.Name,
 		"capacity":     table.Capacity,
 		"status":       table.Status,
-		"qr_url":       "/" + restaurant.Slug + "/menu/" + strconv.Itoa(table.TableNumber),
+		"qr_url":       orderURL,
+		"qr_png_url":   tableQRImagePath(table.ID, "png"),
+		"qr_svg_url":   tableQRImagePath(table.ID, "svg"),
 	}, "Tạo bàn thành công")
 }
 
@@ -216,6 +227,12 @@ func UpdateTable(c *gin.Context) {
 		return
 	}
 
+	// Nhân viên phục vụ / thu ngân chỉ được mở / đóng bàn, sửa thông tin bàn cần quyền quản lý bàn
+	if (input.Name != "" || input.Capacity > 0 || input.IsActive != nil) && !middleware.HasPermission(c, middleware.PermTablesManage) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn chỉ được đổi trạng thái bàn", "FORBIDDEN", "Missing permission: "+middleware.PermTablesManage)
+		return
+	}
+
 	updates := make(map[string]interface{})
 	if input.Name != "" {
 		updates["name"] = input.Name
@@ -448,6 +465,7 @@ func GetTableDetail(c *gin.Context) {
 // @Produce json
 // @Param slug path string true "Restaurant Slug"
 // @Param tableNumber path int true "Table Number"
+// @Param t query string true "Token trong QR của bàn (hoặc header X-Table-Token)"
 // @Success 200 {object} map[string]interface{}
 // @Router /public/restaurants/{slug}/tables/{tableNumber} [get]
 func GetTableBySlugAndNumber(c *gin.Context) {
@@ -473,6 +491,11 @@ func GetTableBySlugAndNumber(c *gin.Context) {
 		return
 	}
 
+	// Chỉ khách quét QR thật của bàn mới xem được (chống gọi món giả mạo)
+	if !authorizePublicTable(c, restaurant, table, publicTableToken(c)) {
+		return
+	}
+
 	utils.SuccessResponse(c, http.StatusOK, gin.H{
 		"id":            table.ID,
 		"table_number":  table.TableNumber,
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"image"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-api/config"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===============================
+// HANDLERS
+// ===============================
+
+// GetTableQRPNG tải ảnh QR gọi món của bàn (PNG)
+// @Summary Ảnh QR của bàn (PNG)
+// @Description Render QR trỏ tới trang gọi món của bàn, có logo nhà hàng ở giữa và tên bàn phía dưới
+// @Tags Tables
+// @Produce png
+// @Param id path int true "Table ID"
+// @Param size query int false "Cạnh QR (px), mặc định 512, tối đa 2048"
+// @Param download query bool false "Tải về dạng file đính kèm"
+// @Success 200 {file} binary
+// @Security BearerAuth
+// @Router /tables/{id}/qr.png [get]
+func GetTableQRPNG(c *gin.Context) {
+	restaurant, table, ok := loadTableForQR(c)
+	if !ok {
+		return
+	}
+
+	pngBytes, err := services.RenderTableQRPNG(services.TableQROptions{
+		URL:   syncTableQRCode(restaurant, &table),
+		Label: tableDisplayName(table),
+		Logo:  restaurantLogoImage(restaurant),
+		Size:  queryQRSize(c),
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo QR", "QR_ERROR", err.Error())
+		return
+	}
+
+	setQRFileHeader(c, "ban-"+strconv.Itoa(table.TableNumber)+".png")
+	c.Data(http.StatusOK, "image/png", pngBytes)
+}
+
+// GetTableQRSVG tải QR gọi món của bàn (SVG)
+// @Summary Ảnh QR của bàn (SVG)
+// @Description Render QR dạng vector để in khổ lớn, logo nhúng theo link và tên bàn dạng text
+// @Tags Tables
+// @Produce image/svg+xml
+// @Param id path int true "Table ID"
+// @Param size query int false "Cạnh QR (px), mặc định 512, tối đa 2048"
+// @Param download query bool false "Tải về dạng file đính kèm"
+// @Success 200 {string} string
+// @Security BearerAuth
+// @Router /tables/{id}/qr.svg [get]
+func GetTableQRSVG(c *gin.Context) {
+	restaurant, table, ok := loadTableForQR(c)
+	if !ok {
+		return
+	}
+
+	logoURL := ""
+	if restaurant.Logo != nil {
+		logoURL = *restaurant.Logo
+	}
+
+	svg, err := services.RenderTableQRSVG(services.TableQROptions{
+		URL:   syncTableQRCode(restaurant, &table),
+		Label: tableDisplayName(table),
+		Size:  queryQRSize(c),
+	}, logoURL)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo QR", "QR_ERROR", err.Error())
+		return
+	}
+
+	setQRFileHeader(c, "ban-"+strconv.Itoa(table.TableNumber)+".svg")
+	c.Data(http.StatusOK, "image/svg+xml; charset=utf-8", []byte(svg))
+}
+
+// GetTablesQRSheet xuất file PDF A4 chứa QR của tất cả bàn để in
+// @Summary Tờ in QR tất cả bàn (PDF)
+// @Description Xếp QR các bàn đang hoạt động lên khổ A4 (12 bàn/trang) kèm khung cắt
+// @Tags Tables
+// @Produce application/pdf
+// @Param id path int true "Restaurant ID"
+// @Success 200 {file} binary
+// @Security BearerAuth
+// @Router /restaurants/{id}/tables/qr-sheet.pdf [get]
+func GetTablesQRSheet(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền in QR của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	db := config.GetDB()
+
+	var restaurant models.Restaurant
+	if err := db.First(&restaurant, restaurantID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy nhà hàng", "RESTAURANT_NOT_FOUND", "")
+		return
+	}
+
+	var tables []models.Table
+	if err := db.Where("restaurant_id = ? AND is_active = ?", restaurant.ID, true).
+		Order("table_number ASC").
+		Find(&tables).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy danh sách bàn", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	if len(tables) == 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Nhà hàng chưa có bàn nào", "NO_TABLES", "")
+		return
+	}
+
+	// Tải logo một lần cho cả tờ in
+	logo := restaurantLogoImage(restaurant)
+
+	items := make([]services.TableQROptions, 0, len(tables))
+	for i := range tables {
+		items = append(items, services.TableQROptions{
+			URL:   syncTableQRCode(restaurant, &tables[i]),
+			Label: tableDisplayName(tables[i]),
+			Logo:  logo,
+			Size:  services.DefaultTableQRSize,
+		})
+	}
+
+	pdfBytes, err := services.RenderTableQRSheetPDF(restaurant.Name, items)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo file PDF", "PDF_ERROR", err.Error())
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="qr-`+restaurant.Slug+`.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", pdfBytes)
+}
+
+// RotateTableQRToken đổi token QR của bàn (QR cũ mất hiệu lực ngay)
+// @Summary Đổi QR của bàn
+// @Description Dùng khi QR bàn bị chụp lại / lộ. Token mới được ký lại, cần in lại QR cho bàn
+// @Tags Tables
+// @Produce json
+// @Param id path int true "Table ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /tables/{id}/qr-token/rotate [put]
+func RotateTableQRToken(c *gin.Context) {
+	restaurant, table, ok := loadTableForQR(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	table.QRTokenVersion++
+	table.QRRotatedAt = &now
+	orderURL := services.TableQRURL(restaurant.Slug, table)
+
+	if err := config.GetDB().Model(&models.Table{}).Where("id = ?", table.ID).Updates(map[string]interface{}{
+		"qr_token_version": table.QRTokenVersion,
+		"qr_rotated_at":    now,
+		"qr_code":          orderURL,
+	}).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể đổi QR", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"id":               table.ID,
+		"table_number":     table.TableNumber,
+		"qr_token_version": table.QRTokenVersion,
+		"qr_rotated_at":    now,
+		"qr_url":           orderURL,
+		"qr_png_url":       tableQRImagePath(table.ID, "png"),
+		"qr_svg_url":       tableQRImagePath(table.ID, "svg"),
+	}, "Đã đổi QR của bàn, vui lòng in lại QR mới")
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// publicTableToken đọc token QR bàn từ query (?t=) hoặc header X-Table-Token
+func publicTableToken(c *gin.Context) string {
+	if token := c.Query("t"); token != "" {
+		return token
+	}
+	return c.GetHeader("X-Table-Token")
+}
+
+// authorizePublicTable kiểm tra token QR của bàn (và phiên phục vụ nếu nhà hàng bật session mode)
+func authorizePublicTable(c *gin.Context, restaurant models.Restaurant, table models.Table, token string) bool {
+	if !services.VerifyTableQRToken(table, token) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Mã QR không hợp lệ hoặc đã hết hạn, vui lòng quét lại QR tại bàn", "INVALID_TABLE_TOKEN", "")
+		return false
+	}
+
+	if restaurant.TableSessionMode && table.Status != "occupied" {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bàn chưa được mở phục vụ, vui lòng liên hệ nhân viên", "TABLE_NOT_SEATED", "")
+		return false
+	}
+
+	return true
+}
+
+// loadTableForQR lấy bàn theo :id và kiểm tra quyền
+func loadTableForQR(c *gin.Context) (models.Restaurant, models.Table, bool) {
+	tableID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	db := config.GetDB()
+
+	var table models.Table
+	if err := db.First(&table, tableID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy bàn", "TABLE_NOT_FOUND", "")
+		return models.Restaurant{}, models.Table{}, false
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || table.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem QR của bàn này", "FORBIDDEN", "")
+		return models.Restaurant{}, models.Table{}, false
+	}
+
+	var restaurant models.Restaurant
+	if err := db.First(&restaurant, table.RestaurantID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy nhà hàng", "RESTAURANT_NOT_FOUND", "")
+		return models.Restaurant{}, models.Table{}, false
+	}
+
+	return restaurant, table, true
+}
+
+// syncTableQRCode trả về link gọi món (kèm token) của bàn, đồng thời lưu vào tables.qr_code nếu khác
+func syncTableQRCode(restaurant models.Restaurant, table *models.Table) string {
+	orderURL := services.TableQRURL(restaurant.Slug, *table)
+	if table.QRCode == nil || *table.QRCode != orderURL {
+		config.GetDB().Model(&models.Table{}).Where("id = ?", table.ID).Update("qr_code", orderURL)
+		table.QRCode = &orderURL
+	}
+	return orderURL
+}
+
+// restaurantLogoImage tải logo nhà hàng, lỗi thì bỏ qua logo (QR vẫn dùng được)
+func restaurantLogoImage(restaurant models.Restaurant) image.Image {
+	if restaurant.Logo == nil || *restaurant.Logo == "" {
+		return nil
+	}
+	logo, err := services.FetchLogoImage(*restaurant.Logo)
+	if err != nil {
+		log.Printf("⚠️ Cannot load logo for restaurant %d: %v", restaurant.ID, err)
+		return nil
+	}
+	return logo
+}
+
+// tableQRImagePath đường dẫn API tải ảnh QR của bàn (format: png, svg)
+func tableQRImagePath(tableID uint, format string) string {
+	return "/api/v1/tables/" + strconv.Itoa(int(tableID)) + "/qr." + format
+}
+
+// queryQRSize đọc kích thước QR từ query (?size=)
+func queryQRSize(c *gin.Context) int {
+	size, _ := strconv.Atoi(c.Query("size"))
+	return size
+}
+
+// setQRFileHeader đặt Content-Disposition (inline hoặc tải về)
+func setQRFileHeader(c *gin.Context, filename string) {
+	disposition := "inline"
+	if c.Query("download") == "true" {
+		disposition = "attachment"
+	}
+	c.Header("Content-Disposition", disposition+`; filename="`+filename+`"`)
+}
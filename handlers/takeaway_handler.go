@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/config"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Giới hạn đặt trước cho đơn mang về
+const takeawayMaxAdvanceDays = 7
+
+// ===============================
+// REQUEST STRUCTS
+// ===============================
+
+// CreateTakeawayOrderInput request body cho đơn mang về
+type CreateTakeawayOrderInput struct {
+	CustomerName  string             `json:"customer_name" binding:"required"`
+	CustomerPhone string             `json:"customer_phone" binding:"required"`
+	PickupTime    *time.Time         `json:"pickup_time"` // RFC3339, bỏ trống = lấy sớm nhất có thể
+	Notes         string             `json:"notes"`
+	Items         []OrderItemInput   `json:"items" binding:"required,min=1"`
+	Invoice       *InvoiceBuyerInput `json:"invoice"` // Thông tin xuất hóa đơn điện tử, bỏ trống = không lấy hóa đơn
+}
+
+// ===============================
+// HANDLERS
+// ===============================
+
+// CreateTakeawayOrder khách đặt đơn mang về từ trang nhà hàng (Public)
+// @Summary Đặt đơn mang về
+// @Description Khách đặt món mang về, bắt buộc chuyển khoản trước qua VietQR. Đơn tự xác nhận khi thanh toán thành công
+// @Tags Public
+// @Accept json
+// @Produce json
+// @Param slug path string true "Restaurant Slug"
+// @Param order body CreateTakeawayOrderInput true "Thông tin đơn mang về"
+// @Success 201 {object} map[string]interface{}
+// @Router /public/restaurants/{slug}/takeaway-orders [post]
+func CreateTakeawayOrder(c *gin.Context) {
+	slug := c.Param("slug")
+	db := config.GetDB()
+
+	var restaurant models.Restaurant
+	if err := db.Where("slug = ? AND status = ?", slug, "active").First(&restaurant).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy nhà hàng", "RESTAURANT_NOT_FOUND", "")
+		return
+	}
+
+	if !restaurant.IsOpen {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Nhà hàng hiện đang đóng cửa", "RESTAURANT_CLOSED", "")
+		return
+	}
+
+	// Đơn mang về bắt buộc trả trước -> nhà hàng phải cấu hình tài khoản nhận tiền
+	var settings models.PaymentSetting
+	if err := db.Where("restaurant_id = ?", restaurant.ID).First(&settings).Error; err != nil ||
+		settings.BankCode == nil || settings.AccountNumber == nil || settings.AccountName == nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Nhà hàng chưa hỗ trợ đặt mang về", "TAKEAWAY_UNAVAILABLE", "Chưa cấu hình tài khoản ngân hàng")
+		return
+	}
+
+	var input CreateTakeawayOrderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	invoiceBuyer, ok := checkoutInvoiceBuyer(c, input.Invoice)
+	if !ok {
+		return
+	}
+
+	// Lấy món và thời gian chế biến lâu nhất
+	menuItemMap, maxPrepTime, err := loadOrderMenuItems(db, restaurant.ID, input.Items)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi kiểm tra món ăn", "DB_ERROR", err.Error())
+		return
+	}
+
+	// Giờ lấy hàng: sớm nhất là sau thời gian chế biến
+	now := time.Now()
+	earliest := now.Add(time.Duration(maxPrepTime) * time.Minute)
+	pickupTime := earliest
+	if input.PickupTime != nil {
+		if input.PickupTime.Before(earliest) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Giờ lấy hàng quá sớm so với thời gian chế biến", "PICKUP_TOO_EARLY",
+				earliest.Format(time.RFC3339))
+			return
+		}
+		if input.PickupTime.After(now.AddDate(0, 0, takeawayMaxAdvanceDays)) {
+			utils.ErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("Chỉ nhận đặt trước trong vòng %d ngày", takeawayMaxAdvanceDays), "PICKUP_TOO_LATE", "")
+			return
+		}
+		pickupTime = *input.PickupTime
+	}
+
+	tx := db.Begin()
+
+	pickupNumber, err := generatePickupNumber(tx, restaurant.ID)
+	if err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo đơn hàng", "CREATE_ERROR", err.Error())
+		return
+	}
+	paymentMethod := "qr"
+	order := models.Order{
+		RestaurantID:  restaurant.ID,
+		OrderNumber:   generateOrderNumber(tx),
+		OrderType:     "takeaway",
+		CustomerName:  &input.CustomerName,
+		CustomerPhone: &input.CustomerPhone,
+		Status:        "pending", // Chờ thanh toán
+		PaymentTiming: "before",  // Bắt buộc trả trước
+		PaymentStatus: "unpaid",
+		PaymentMethod: &paymentMethod,
+		PickupTime:    &pickupTime,
+		PickupNumber:  &pickupNumber,
+		Notes:         &input.Notes,
+	}
+
+	if err := tx.Create(&order).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo đơn hàng", "CREATE_ERROR", err.Error())
+		return
+	}
+
+	orderItems, ok := buildOrderItems(order.ID, input.Items, menuItemMap, "pending") // Chờ thanh toán
+	if !ok {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusBadRequest, "Món không tồn tại hoặc đã ngừng bán", "INVALID_MENU_ITEM", "")
+		return
+	}
+
+	if err := tx.Create(&orderItems).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo chi tiết đơn hàng", "CREATE_ITEM_ERROR", err.Error())
+		return
+	}
+
+	if err := recalculateOrderTotals(tx, &order); err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tính tổng tiền", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	// Khách yêu cầu xuất hóa đơn: lưu thông tin người mua vào hóa đơn nháp
+	if invoiceBuyer != nil {
+		if _, err := services.SaveInvoiceBuyer(tx, order, *invoiceBuyer); err != nil {
+			tx.Rollback()
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể lưu thông tin xuất hóa đơn", "CREATE_ERROR", err.Error())
+			return
+		}
+	}
+
+	tx.Commit()
+
+	// Tạo QR thanh toán ngay
+	qr, err := services.CreateOrderPaymentQR(order.ID)
+	if err != nil {
+		db.Model(&order).Updates(map[string]interface{}{
+			"status":        "cancelled",
+			"cancel_reason": "Không tạo được QR thanh toán",
+			"cancelled_at":  time.Now(),
+		})
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), "QR_ERROR", "")
+		return
+	}
+	db.First(&order, order.ID)
+
+	services.PublishOrderEvent(services.WebhookEventOrderCreated, order)
+
+	utils.SuccessResponse(c, http.StatusCreated, gin.H{
+		"id":            order.ID,
+		"order_number":  order.OrderNumber,
+		"order_type":    order.OrderType,
+		"pickup_number": pickupNumber,
+		"pickup_time":   pickupTime,
+		"status":        order.Status,
+		"total_amount":  order.TotalAmount,
+		"payment": gin.H{
+			"payment_code": order.PaymentCode,
+			"qr_url":       qr.QRURL,
+			"bank_info": gin.H{
+				"bank_name":      qr.BankName,
+				"account_number": qr.AccountNo,
+				"account_name":   qr.AccountName,
+			},
+			"expires_at": order.PaymentExpiresAt,
+		},
+		"tracking_url": "/" + slug + "/order/" + strconv.Itoa(int(order.ID)),
+	}, "Đơn mang về đã được tạo. Vui lòng chuyển khoản để hoàn tất!")
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// generatePickupNumber tạo số thứ tự lấy hàng trong ngày của nhà hàng (VD: T007)
+// Khóa dòng nhà hàng đến hết transaction để các đơn tạo đồng thời nhận số liên tiếp, không trùng
+func generatePickupNumber(tx *gorm.DB, restaurantID uint) (string, error) {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Restaurant{}, restaurantID).Error; err != nil {
+		return "", err
+	}
+
+	start, end, _ := services.BusinessDayRange(services.BusinessDate(time.Now()))
+	var lastNumber string
+	if err := tx.Model(&models.Order{}).
+		Where("restaurant_id = ? AND order_type = ? AND pickup_number IS NOT NULL AND created_at >= ? AND created_at < ?",
+			restaurantID, "takeaway", start, end).
+		Order("id DESC").
+		Limit(1).
+		Pluck("pickup_number", &lastNumber).Error; err != nil {
+		return "", err
+	}
+
+	next := 1
+	if parsed, err := strconv.Atoi(strings.TrimPrefix(lastNumber, "T")); err == nil {
+		next = parsed + 1
+	}
+	return fmt.Sprintf("T%03d", next), nil
+}
+
+// loadOrderMenuItems lấy các món đang bán theo input, kèm thời gian chế biến lâu nhất (phút)
+func loadOrderMenuItems(db *gorm.DB, restaurantID uint, inputs []OrderItemInput) (map[uint]models.MenuItem, int, error) {
+	menuItemIDs := make([]uint, 0, len(inputs))
+	for _, itemInput := range inputs {
+		menuItemIDs = append(menuItemIDs, itemInput.MenuItemID)
+	}
+
+	var menuItems []models.MenuItem
+	if err := db.Where("id IN ? AND restaurant_id = ? AND status = ?", menuItemIDs, restaurantID, "active").Find(&menuItems).Error; err != nil {
+		return nil, 0, err
+	}
+
+	menuItemMap := make(map[uint]models.MenuItem)
+	maxPrepTime := 0
+	for _, item := range menuItems {
+		menuItemMap[item.ID] = item
+		if item.PrepTime > maxPrepTime {
+			maxPrepTime = item.PrepTime
+		}
+	}
+	return menuItemMap, maxPrepTime, nil
+}
+
+// buildOrderItems dựng chi tiết đơn từ input; trả về false nếu có món không hợp lệ
+func buildOrderItems(orderID uint, inputs []OrderItemInput, menuItemMap map[uint]models.MenuItem, prepStatus string) ([]models.OrderItem, bool) {
+	var orderItems []models.OrderItem
+	for _, itemInput := range inputs {
+		menuItem, exists := menuItemMap[itemInput.MenuItemID]
+		if !exists {
+			return nil, false
+		}
+
+		opts := itemInput.SelectedOptions
+		notes := itemInput.Notes
+		orderItems = append(orderItems, models.OrderItem{
+			OrderID:         orderID,
+			MenuItemID:      menuItem.ID,
+			ItemName:        menuItem.Name,
+			ItemPrice:       menuItem.Price,
+			Quantity:        itemInput.Quantity,
+			SelectedOptions: &opts,
+			Notes:           &notes,
+			PrepStatus:      prepStatus,
+			PrepLocation:    menuItem.PrepLocation,
+			LineTotal:       menuItem.Price * float64(itemInput.Quantity),
+		})
+	}
+	return orderItems, true
+}
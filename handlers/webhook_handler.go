@@ -0,0 +1,500 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-api/config"
+	"go-api/models"
+	"go-api/services"
+	"go-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===============================
+// REQUEST STRUCTS
+// ===============================
+
+// CreateWebhookInput request body cho tạo webhook
+type CreateWebhookInput struct {
+	URL         string   `json:"url" binding:"required,max=500"`
+	Events      []string `json:"events" binding:"required,min=1"` // order.created, order.paid, order.status_changed, menu.updated
+	Description *string  `json:"description"`
+}
+
+// UpdateWebhookInput request body cho cập nhật webhook
+type UpdateWebhookInput struct {
+	URL         *string  `json:"url"`
+	Events      []string `json:"events"`
+	Description *string  `json:"description"`
+	IsActive    *bool    `json:"is_active"`
+}
+
+// ===============================
+// WEBHOOK ENDPOINT HANDLERS
+// ===============================
+
+// GetWebhooks lấy danh sách webhook của nhà hàng
+// @Summary Danh sách webhook
+// @Description Lấy các địa chỉ nhận webhook của nhà hàng và danh sách sự kiện có thể đăng ký
+// @Tags Webhooks
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/webhooks [get]
+func GetWebhooks(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem webhook của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var endpoints []models.WebhookEndpoint
+	if err := config.GetDB().Where("restaurant_id = ?", restaurantID).
+		Order("created_at DESC").
+		Find(&endpoints).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy webhook", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	items := make([]gin.H, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		items = append(items, webhookResponse(endpoint))
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"webhooks":         items,
+		"available_events": services.WebhookEventTypes,
+	}, "")
+}
+
+// CreateWebhook đăng ký địa chỉ nhận webhook
+// @Summary Tạo webhook
+// @Description Đăng ký URL nhận sự kiện. Payload được ký HMAC-SHA256 bằng secret (header X-Webhook-Signature: t=<unix>,v1=<hex>), secret chỉ trả về một lần
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param body body CreateWebhookInput true "Thông tin webhook"
+// @Success 201 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/webhooks [post]
+func CreateWebhook(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền tạo webhook cho nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	var input CreateWebhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	if err := services.ValidateWebhookURL(input.URL); err != nil {
+		_, msg, _ := strings.Cut(err.Error(), ": ")
+		utils.ErrorResponse(c, http.StatusBadRequest, "URL không hợp lệ", "INVALID_URL", msg)
+		return
+	}
+
+	events, ok := normalizeWebhookEvents(c, input.Events)
+	if !ok {
+		return
+	}
+
+	secret, err := services.GenerateWebhookSecret()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo webhook", "KEY_ERROR", err.Error())
+		return
+	}
+
+	createdBy := currentUserID(c)
+	endpoint := models.WebhookEndpoint{
+		RestaurantID: uint(restaurantID),
+		URL:          strings.TrimSpace(input.URL),
+		Description:  input.Description,
+		Events:       events,
+		Secret:       secret,
+		IsActive:     true,
+		CreatedBy:    &createdBy,
+	}
+	if err := config.GetDB().Create(&endpoint).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo webhook", "CREATE_ERROR", err.Error())
+		return
+	}
+
+	response := webhookResponse(endpoint)
+	response["secret"] = secret
+
+	utils.SuccessResponse(c, http.StatusCreated, response, "Tạo webhook thành công, hãy lưu lại secret để xác thực chữ ký")
+}
+
+// UpdateWebhook cập nhật webhook
+// @Summary Cập nhật webhook
+// @Description Đổi URL, sự kiện đăng ký, mô tả hoặc bật / tắt webhook
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param body body UpdateWebhookInput true "Thông tin cập nhật"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /webhook-endpoints/{id} [put]
+func UpdateWebhook(c *gin.Context) {
+	endpoint, ok := loadWebhookForManage(c)
+	if !ok {
+		return
+	}
+
+	var input UpdateWebhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Dữ liệu không hợp lệ", "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if input.URL != nil {
+		if err := services.ValidateWebhookURL(*input.URL); err != nil {
+			_, msg, _ := strings.Cut(err.Error(), ": ")
+			utils.ErrorResponse(c, http.StatusBadRequest, "URL không hợp lệ", "INVALID_URL", msg)
+			return
+		}
+		updates["url"] = strings.TrimSpace(*input.URL)
+	}
+	if input.Events != nil {
+		events, ok := normalizeWebhookEvents(c, input.Events)
+		if !ok {
+			return
+		}
+		updates["events"] = events
+	}
+	if input.Description != nil {
+		updates["description"] = *input.Description
+	}
+	if input.IsActive != nil {
+		updates["is_active"] = *input.IsActive
+	}
+
+	db := config.GetDB()
+	if len(updates) > 0 {
+		if err := db.Model(&endpoint).Updates(updates).Error; err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể cập nhật webhook", "UPDATE_ERROR", err.Error())
+			return
+		}
+	}
+	db.First(&endpoint, endpoint.ID)
+
+	utils.SuccessResponse(c, http.StatusOK, webhookResponse(endpoint), "Cập nhật webhook thành công")
+}
+
+// DeleteWebhook xóa webhook
+// @Summary Xóa webhook
+// @Description Xóa webhook cùng nhật ký gửi, các lượt đang chờ gửi bị hủy
+// @Tags Webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /webhook-endpoints/{id} [delete]
+func DeleteWebhook(c *gin.Context) {
+	endpoint, ok := loadWebhookForManage(c)
+	if !ok {
+		return
+	}
+
+	db := config.GetDB()
+	db.Where("endpoint_id = ?", endpoint.ID).Delete(&models.WebhookDelivery{})
+
+	if err := db.Delete(&endpoint).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể xóa webhook", "DELETE_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, nil, "Xóa webhook thành công")
+}
+
+// RotateWebhookSecret đổi secret ký payload
+// @Summary Đổi secret webhook
+// @Description Tạo secret mới, secret cũ hết hiệu lực ngay (kể cả với các lượt đang chờ thử lại)
+// @Tags Webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /webhook-endpoints/{id}/rotate-secret [post]
+func RotateWebhookSecret(c *gin.Context) {
+	endpoint, ok := loadWebhookForManage(c)
+	if !ok {
+		return
+	}
+
+	secret, err := services.GenerateWebhookSecret()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể tạo secret", "KEY_ERROR", err.Error())
+		return
+	}
+
+	if err := config.GetDB().Model(&endpoint).Update("secret", secret).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể đổi secret", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	response := webhookResponse(endpoint)
+	response["secret"] = secret
+
+	utils.SuccessResponse(c, http.StatusOK, response, "Đổi secret thành công")
+}
+
+// PingWebhook gửi thử sự kiện tới webhook
+// @Summary Gửi thử webhook
+// @Description Gửi sự kiện webhook.ping (đã ký) tới URL và trả về phản hồi, không thử lại
+// @Tags Webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /webhook-endpoints/{id}/ping [post]
+func PingWebhook(c *gin.Context) {
+	endpoint, ok := loadWebhookForManage(c)
+	if !ok {
+		return
+	}
+
+	status, body, err := services.PingWebhookEndpoint(endpoint)
+	result := gin.H{
+		"success":         err == nil,
+		"response_status": status,
+		"response_body":   body,
+	}
+	if err != nil {
+		result["error"] = err.Error()
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, result, "")
+}
+
+// ===============================
+// WEBHOOK DELIVERY HANDLERS
+// ===============================
+
+// GetWebhookDeliveries nhật ký gửi webhook của nhà hàng
+// @Summary Nhật ký gửi webhook
+// @Description Lịch sử gửi webhook; lọc status=dead để xem danh sách dead-letter (hết lượt thử lại)
+// @Tags Webhooks
+// @Produce json
+// @Param id path int true "Restaurant ID"
+// @Param webhook_id query int false "Lọc theo webhook"
+// @Param status query string false "pending, retrying, succeeded, dead"
+// @Param event_type query string false "Loại sự kiện"
+// @Param page query int false "Trang" default(1)
+// @Param limit query int false "Số lượng/trang" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /restaurants/{id}/webhook-deliveries [get]
+func GetWebhookDeliveries(c *gin.Context) {
+	restaurantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || uint(restaurantID) != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem webhook của nhà hàng này", "FORBIDDEN", "")
+		return
+	}
+
+	query := config.GetDB().Model(&models.WebhookDelivery{}).Where("restaurant_id = ?", restaurantID)
+	if webhookID := c.Query("webhook_id"); webhookID != "" {
+		query = query.Where("endpoint_id = ?", webhookID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if eventType := c.Query("event_type"); eventType != "" {
+		query = query.Where("event_type = ?", eventType)
+	}
+
+	// Pagination
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	var total int64
+	query.Count(&total)
+
+	// Danh sách không kèm payload cho nhẹ, xem chi tiết từng lượt để lấy payload
+	var deliveries []models.WebhookDelivery
+	if err := query.Omit("payload").Order("created_at DESC").Offset(offset).Limit(limit).Find(&deliveries).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Lỗi khi lấy nhật ký webhook", "QUERY_ERROR", err.Error())
+		return
+	}
+
+	totalPages := int(total) / limit
+	if int(total)%limit > 0 {
+		totalPages++
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"pagination": gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": totalPages,
+		},
+	}, "")
+}
+
+// GetWebhookDelivery chi tiết một lượt gửi webhook
+// @Summary Chi tiết lượt gửi webhook
+// @Description Xem payload, số lần thử, phản hồi và lỗi gần nhất của một lượt gửi
+// @Tags Webhooks
+// @Produce json
+// @Param id path int true "Delivery ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /webhook-deliveries/{id} [get]
+func GetWebhookDelivery(c *gin.Context) {
+	delivery, ok := loadWebhookDeliveryForManage(c)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, delivery, "")
+}
+
+// RedeliverWebhook gửi lại một lượt webhook
+// @Summary Gửi lại webhook
+// @Description Đưa lượt gửi (thường là dead-letter) về hàng đợi để gửi lại ngay với cùng payload, chữ ký tạo mới
+// @Tags Webhooks
+// @Produce json
+// @Param id path int true "Delivery ID"
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /webhook-deliveries/{id}/redeliver [post]
+func RedeliverWebhook(c *gin.Context) {
+	delivery, ok := loadWebhookDeliveryForManage(c)
+	if !ok {
+		return
+	}
+
+	if delivery.Status == services.WebhookDeliveryPending {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Lượt gửi đang chờ gửi", "DELIVERY_PENDING", "")
+		return
+	}
+
+	if err := services.RequeueWebhookDelivery(config.GetDB(), &delivery); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Không thể gửi lại webhook", "UPDATE_ERROR", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"id":              delivery.ID,
+		"status":          delivery.Status,
+		"next_attempt_at": delivery.NextAttemptAt,
+	}, "Đã đưa webhook vào hàng đợi gửi lại")
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// loadWebhookForManage lấy webhook theo :id và kiểm tra quyền quản lý
+func loadWebhookForManage(c *gin.Context) (models.WebhookEndpoint, bool) {
+	endpointID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	var endpoint models.WebhookEndpoint
+	if err := config.GetDB().First(&endpoint, endpointID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy webhook", "WEBHOOK_NOT_FOUND", "")
+		return endpoint, false
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || endpoint.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền quản lý webhook này", "FORBIDDEN", "")
+		return endpoint, false
+	}
+
+	return endpoint, true
+}
+
+// loadWebhookDeliveryForManage lấy lượt gửi webhook theo :id và kiểm tra quyền
+func loadWebhookDeliveryForManage(c *gin.Context) (models.WebhookDelivery, bool) {
+	deliveryID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	var delivery models.WebhookDelivery
+	if err := config.GetDB().First(&delivery, deliveryID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Không tìm thấy lượt gửi webhook", "DELIVERY_NOT_FOUND", "")
+		return delivery, false
+	}
+
+	// Kiểm tra quyền
+	currentRestaurantID, _ := c.Get("restaurant_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && (currentRestaurantID == nil || delivery.RestaurantID != *currentRestaurantID.(*uint)) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Bạn không có quyền xem lượt gửi webhook này", "FORBIDDEN", "")
+		return delivery, false
+	}
+
+	return delivery, true
+}
+
+// normalizeWebhookEvents kiểm tra, loại trùng danh sách sự kiện và nối thành chuỗi lưu DB
+func normalizeWebhookEvents(c *gin.Context, events []string) (string, bool) {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, event := range events {
+		event = strings.ToLower(strings.TrimSpace(event))
+		if !services.IsValidWebhookEvent(event) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Sự kiện không hợp lệ", "INVALID_EVENT", event)
+			return "", false
+		}
+		if !seen[event] {
+			seen[event] = true
+			result = append(result, event)
+		}
+	}
+	if len(result) == 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Cần chọn ít nhất một sự kiện", "VALIDATION_ERROR", "")
+		return "", false
+	}
+	return strings.Join(result, ","), true
+}
+
+// webhookResponse thông tin webhook trả về client (không kèm secret)
+func webhookResponse(endpoint models.WebhookEndpoint) gin.H {
+	return gin.H{
+		"id":          endpoint.ID,
+		"url":         endpoint.URL,
+		"description": endpoint.Description,
+		"events":      services.WebhookEndpointEvents(endpoint),
+		"is_active":   endpoint.IsActive,
+		"created_by":  endpoint.CreatedBy,
+		"created_at":  endpoint.CreatedAt,
+		"updated_at":  endpoint.UpdatedAt,
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"os"
+	"time"
 
 	"go-api/config"
 	_ "go-api/docs" // Swagger docs
@@ -40,12 +41,20 @@ func main() {
 	}
 	gin.SetMode(mode)
 
+	// Không khởi động khi chưa có khóa ký QR bàn (token QR giả mạo được nếu dùng khóa mặc định)
+	if err := config.ValidateTableQRSecret(); err != nil {
+		log.Fatal("Invalid table QR configuration:", err)
+	}
+
 	// Kết nối database
 	config.ConnectDatabase()
 
 	// Load SePay config
 	config.LoadSepayConfig()
 
+	// Load cấu hình gửi email
+	config.LoadMailConfig()
+
 	// Initialize Cloudinary
 	cloudName := os.Getenv("CLOUDINARY_CLOUD_NAME")
 	apiKey := os.Getenv("CLOUDINARY_API_KEY")
@@ -74,9 +83,23 @@ func main() {
 		log.Fatal("Failed to run seeds:", err)
 	}
 
+	// Giữ bàn / giải phóng bàn cho các lượt đặt trước
+	services.StartReservationScheduler(time.Minute)
+
+	// Gửi webhook sự kiện tới hệ thống của nhà hàng (thử lại các lượt lỗi)
+	services.StartWebhookDispatcher(15 * time.Second)
+
+	// Tự xếp lệnh in phiếu bếp khi xác nhận đơn, in hóa đơn khi khách gọi thanh toán
+	services.StartPrintJobTriggers()
+
 	// Khởi tạo Gin router
 	router := gin.Default()
 
+	// Chỉ tin X-Forwarded-For từ proxy đã khai báo, client không tự đổi IP để lách giới hạn theo IP
+	if err := router.SetTrustedProxies(config.TrustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
 	// Serve static files (ảnh upload)
 	router.Static("/assets", "./assets")
 
@@ -2,71 +2,64 @@ package middleware
 
 import (
 	"net/http"
-	"os"
+	"strings"
+
+	"go-api/config"
+	"go-api/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-// APIKeyMiddleware middleware xác thực API Key
-func APIKeyMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		apiKey := c.GetHeader("X-API-Key")
-		expectedAPIKey := os.Getenv("API_KEY")
-
-		// Nếu không cấu hình API_KEY, bỏ qua kiểm tra
-		if expectedAPIKey == "" {
-			c.Next()
-			return
-		}
+// AuthOrAPIKeyMiddleware xác thực bằng JWT hoặc API key nhà hàng (X-API-Key: rk_... hoặc Bearer rk_...).
+// API key được gán role "api_key" và restaurant_id của nhà hàng, quyền lấy theo scope (xem RequirePermission)
+func AuthOrAPIKeyMiddleware() gin.HandlerFunc {
+	jwtAuth := AuthMiddleware()
 
-		if apiKey == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"success": false,
-				"message": "API Key không được cung cấp",
-				"error": gin.H{
-					"code":    "MISSING_API_KEY",
-					"details": "X-API-Key header is required",
-				},
-			})
-			c.Abort()
-			return
+	return func(c *gin.Context) {
+		raw := c.GetHeader("X-API-Key")
+		if !services.IsRestaurantAPIKey(raw) {
+			raw = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if !services.IsRestaurantAPIKey(raw) {
+				jwtAuth(c)
+				return
+			}
 		}
 
-		if apiKey != expectedAPIKey {
-			c.JSON(http.StatusUnauthorized, gin.H{
+		db := config.GetDB()
+		key, err := services.AuthenticateAPIKey(db, raw)
+		if err != nil {
+			code, msg, _ := strings.Cut(err.Error(), ": ")
+			status := http.StatusUnauthorized
+			if code == "RESTAURANT_INACTIVE" {
+				status = http.StatusForbidden
+			}
+			c.JSON(status, gin.H{
 				"success": false,
-				"message": "API Key không hợp lệ",
+				"message": msg,
 				"error": gin.H{
-					"code":    "INVALID_API_KEY",
-					"details": "The provided API Key is invalid",
+					"code":    code,
+					"details": "",
 				},
 			})
 			c.Abort()
 			return
 		}
 
-		c.Next()
-	}
-}
+		services.TouchAPIKey(db, key, c.ClientIP())
 
-// OptionalAPIKeyMiddleware middleware kiểm tra API Key nếu có
-func OptionalAPIKeyMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		apiKey := c.GetHeader("X-API-Key")
-		expectedAPIKey := os.Getenv("API_KEY")
-
-		if apiKey != "" && expectedAPIKey != "" && apiKey != expectedAPIKey {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"success": false,
-				"message": "API Key không hợp lệ",
-				"error": gin.H{
-					"code":    "INVALID_API_KEY",
-					"details": "The provided API Key is invalid",
-				},
-			})
-			c.Abort()
-			return
+		// Thao tác qua API key được ghi nhận cho người tạo key (hoặc chủ nhà hàng)
+		userID := key.Restaurant.OwnerID
+		if key.CreatedBy != nil {
+			userID = *key.CreatedBy
 		}
+		restaurantID := key.RestaurantID
+
+		// Cùng các giá trị context như AuthMiddleware để handler dùng chung
+		c.Set("user_id", userID)
+		c.Set("role", "api_key")
+		c.Set("restaurant_id", &restaurantID)
+		c.Set("api_key_id", key.ID)
+		c.Set("api_scopes", services.APIKeyScopes(*key))
 
 		c.Next()
 	}
@@ -6,6 +6,9 @@ import (
 	"strings"
 	"time"
 
+	"go-api/config"
+	"go-api/models"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -19,24 +22,31 @@ func getJWTSecret() []byte {
 	return []byte(secret)
 }
 
+// AccessTokenTTL thời hạn access token, hết hạn thì dùng refresh token để lấy token mới
+const AccessTokenTTL = 15 * time.Minute
+
 // Claims cấu trúc JWT claims
 type Claims struct {
 	UserID       uint   `json:"user_id"`
 	Email        string `json:"email"`
 	Role         string `json:"role"`
 	RestaurantID *uint  `json:"restaurant_id,omitempty"`
+	StaffRole    string `json:"staff_role,omitempty"` // manager, cashier, waiter, kitchen (chỉ với role staff)
+	SessionID    string `json:"sid,omitempty"`        // Family của refresh token (phiên đăng nhập)
 	jwt.RegisteredClaims
 }
 
 // GenerateToken tạo JWT token
-func GenerateToken(userID uint, email, role string, restaurantID *uint) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+func GenerateToken(userID uint, email, role string, restaurantID *uint, staffRole, sessionID string) (string, error) {
+	expirationTime := time.Now().Add(AccessTokenTTL)
 
 	claims := &Claims{
 		UserID:       userID,
 		Email:        email,
 		Role:         role,
 		RestaurantID: restaurantID,
+		StaffRole:    staffRole,
+		SessionID:    sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -113,6 +123,27 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Nhân viên: kiểm tra lại trạng thái và vai trò trong DB để khóa / đổi vai trò có hiệu lực ngay
+		if claims.Role == "staff" {
+			var staff models.StaffMember
+			if claims.RestaurantID == nil || config.GetDB().
+				Where("user_id = ? AND restaurant_id = ? AND status = ?", claims.UserID, *claims.RestaurantID, "active").
+				First(&staff).Error != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"success": false,
+					"message": "Tài khoản nhân viên đã bị vô hiệu hóa",
+					"error": gin.H{
+						"code":    "ACCOUNT_DISABLED",
+						"details": "Staff account is not active",
+					},
+				})
+				c.Abort()
+				return
+			}
+			claims.StaffRole = staff.Role
+			c.Set("staff_role", staff.Role)
+		}
+
 		// Lưu thông tin user vào context
 		c.Set("user_id", claims.UserID)
 		c.Set("email", claims.Email)
@@ -176,7 +207,7 @@ func RestaurantOnly() gin.HandlerFunc {
 	return RoleMiddleware("restaurant")
 }
 
-// RestaurantOrAdmin middleware cho phép restaurant hoặc admin
+// RestaurantOrAdmin middleware cho phép restaurant hoặc admin (nhân viên dùng RequirePermission)
 func RestaurantOrAdmin() gin.HandlerFunc {
 	return RoleMiddleware("restaurant", "admin")
 }
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// MFATokenTTL thời hạn token chờ xác thực 2 bước sau khi nhập đúng mật khẩu
+const MFATokenTTL = 5 * time.Minute
+
+// Mục đích của MFA token
+const (
+	MFAPurposeVerify = "mfa_verify" // Đã bật 2FA: chờ nhập mã
+	MFAPurposeEnroll = "mfa_enroll" // Role bắt buộc 2FA nhưng chưa thiết lập: chờ thiết lập
+)
+
+// MFAClaims claims của token "mfa pending" (không dùng được như access token)
+type MFAClaims struct {
+	UserID  uint   `json:"user_id"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// mfaSigningKey khóa ký riêng cho MFA token để AuthMiddleware không chấp nhận nhầm
+func mfaSigningKey() []byte {
+	return append(getJWTSecret(), []byte(":mfa")...)
+}
+
+// GenerateMFAToken tạo token chờ xác thực 2 bước
+func GenerateMFAToken(userID uint, purpose string) (string, error) {
+	now := time.Now()
+	claims := &MFAClaims{
+		UserID:  userID,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(MFATokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "go-api",
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(mfaSigningKey())
+}
+
+// ValidateMFAToken xác thực token chờ xác thực 2 bước với mục đích tương ứng
+func ValidateMFAToken(tokenString, purpose string) (*MFAClaims, error) {
+	claims := &MFAClaims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return mfaSigningKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid || claims.Purpose != purpose {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===============================
+// PERMISSIONS
+// ===============================
+
+// Quyền thao tác trong nhà hàng
+const (
+	PermRestaurantSettings = "restaurant.settings"     // Thông tin nhà hàng, thanh toán, gói dịch vụ, vùng giao hàng
+	PermStaffManage        = "staff.manage"            // Mời / khóa nhân viên
+	PermMenuManage         = "menu.manage"             // Danh mục & món ăn
+	PermTablesView         = "tables.view"             // Xem bàn, sơ đồ, QR
+	PermTablesStatus       = "tables.status"           // Mở / đóng bàn (đổi trạng thái)
+	PermTablesManage       = "tables.manage"           // Thêm / sửa / xóa bàn, khu vực, đổi QR
+	PermOrdersView         = "orders.view"             // Xem đơn hàng
+	PermOrdersManage       = "orders.manage"           // Đổi trạng thái đơn, sửa / hủy món, chuyển bàn
+	PermOrdersOverride     = "orders.override"         // Sửa / hủy món đã chế biến
+	PermKitchenPrep        = "kitchen.prep"            // Cập nhật trạng thái chế biến món
+	PermPaymentsConfirm    = "payments.confirm"        // Thu tiền, xác nhận thanh toán
+	PermPaymentsRefund     = "payments.refund"         // Hoàn tiền
+	PermReservationsManage = "reservations.manage"     // Đặt bàn & danh sách chờ
+	PermServiceRequests    = "service_requests.handle" // Xử lý yêu cầu gọi nhân viên
+	PermStatsView          = "stats.view"              // Xem thống kê
+	PermCashDrawer         = "cash.drawer"             // Mở / đóng ca thu ngân, nộp / rút tiền két
+	PermDayClose           = "reports.close_day"       // Chốt sổ cuối ngày (Z report)
+	PermNotificationsView  = "notifications.view"      // Xem thông báo
+	PermPrintAgent         = "print.agent"             // Print agent lấy lệnh in và báo kết quả (chỉ cấp cho API key)
+)
+
+// Vai trò nhân viên
+const (
+	StaffRoleManager = "manager"
+	StaffRoleCashier = "cashier"
+	StaffRoleWaiter  = "waiter"
+	StaffRoleKitchen = "kitchen"
+)
+
+// StaffRolePermissions quyền theo vai trò nhân viên.
+// Chủ nhà hàng (role restaurant) và admin có toàn quyền.
+var StaffRolePermissions = map[string][]string{
+	StaffRoleManager: {
+		PermMenuManage, PermTablesView, PermTablesStatus, PermTablesManage,
+		PermOrdersView, PermOrdersManage, PermOrdersOverride, PermKitchenPrep,
+		PermPaymentsConfirm, PermPaymentsRefund, PermReservationsManage,
+		PermServiceRequests, PermStatsView, PermNotificationsView,
+		PermCashDrawer, PermDayClose,
+	},
+	StaffRoleCashier: {
+		PermTablesView, PermTablesStatus, PermOrdersView, PermOrdersManage,
+		PermPaymentsConfirm, PermPaymentsRefund, PermServiceRequests, PermNotificationsView,
+		PermCashDrawer,
+	},
+	StaffRoleWaiter: {
+		PermTablesView, PermTablesStatus, PermOrdersView, PermOrdersManage,
+		PermKitchenPrep, PermReservationsManage, PermServiceRequests, PermNotificationsView,
+	},
+	StaffRoleKitchen: {
+		PermOrdersView, PermKitchenPrep, PermNotificationsView,
+	},
+}
+
+// Phạm vi (scope) của API key nhà hàng
+const (
+	APIScopeMenuRead      = "menu.read"
+	APIScopeMenuWrite     = "menu.write"
+	APIScopeTablesRead    = "tables.read"
+	APIScopeOrdersRead    = "orders.read"
+	APIScopeOrdersWrite   = "orders.write"
+	APIScopePaymentsWrite = "payments.write"
+	APIScopeStatsRead     = "stats.read"
+	APIScopePrintAgent    = "print.agent"
+)
+
+// APIKeyScopePermissions quyền tương ứng với từng scope của API key.
+// Menu đã xem được qua API công khai, menu.read chỉ cho phép key dùng các API đọc chung của nhà hàng
+var APIKeyScopePermissions = map[string][]string{
+	APIScopeMenuRead:      {},
+	APIScopeMenuWrite:     {PermMenuManage},
+	APIScopeTablesRead:    {PermTablesView},
+	APIScopeOrdersRead:    {PermOrdersView},
+	APIScopeOrdersWrite:   {PermOrdersView, PermOrdersManage, PermKitchenPrep},
+	APIScopePaymentsWrite: {PermPaymentsConfirm},
+	APIScopeStatsRead:     {PermStatsView},
+	APIScopePrintAgent:    {PermPrintAgent},
+}
+
+// IsValidAPIKeyScope kiểm tra scope API key hợp lệ
+func IsValidAPIKeyScope(scope string) bool {
+	_, ok := APIKeyScopePermissions[scope]
+	return ok
+}
+
+// apiKeyPermissions quyền của API key đang gọi (theo scope lưu trong context)
+func apiKeyPermissions(c *gin.Context) []string {
+	scopes, _ := c.Get("api_scopes")
+	list, _ := scopes.([]string)
+
+	perms := []string{}
+	for _, scope := range list {
+		perms = append(perms, APIKeyScopePermissions[scope]...)
+	}
+	return perms
+}
+
+// IsValidStaffRole kiểm tra vai trò nhân viên hợp lệ
+func IsValidStaffRole(staffRole string) bool {
+	_, ok := StaffRolePermissions[staffRole]
+	return ok
+}
+
+// HasPermission kiểm tra người dùng hiện tại có quyền perm không
+func HasPermission(c *gin.Context, perm string) bool {
+	role, _ := c.Get("role")
+	switch role {
+	case "admin", "restaurant":
+		return true
+	case "staff":
+		staffRole, _ := c.Get("staff_role")
+		roleStr, _ := staffRole.(string)
+		for _, p := range StaffRolePermissions[roleStr] {
+			if p == perm {
+				return true
+			}
+		}
+	case "api_key":
+		for _, p := range apiKeyPermissions(c) {
+			if p == perm {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PermissionsOf danh sách quyền của người dùng hiện tại (cho frontend ẩn / hiện chức năng)
+func PermissionsOf(c *gin.Context) []string {
+	role, _ := c.Get("role")
+	if role == "staff" {
+		staffRole, _ := c.Get("staff_role")
+		roleStr, _ := staffRole.(string)
+		return StaffRolePermissions[roleStr]
+	}
+	if role == "api_key" {
+		return apiKeyPermissions(c)
+	}
+	if role == "admin" || role == "restaurant" {
+		return []string{"*"}
+	}
+	return []string{}
+}
+
+// RequirePermission middleware cho phép admin, chủ nhà hàng, nhân viên và API key có đủ các quyền yêu cầu.
+// Không truyền quyền nào = mọi thành viên của nhà hàng (thay cho RestaurantOrAdmin).
+func RequirePermission(perms ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, exists := c.Get("role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "Vui lòng đăng nhập",
+				"error": gin.H{
+					"code": "UNAUTHORIZED",
+				},
+			})
+			c.Abort()
+			return
+		}
+
+		if role != "admin" && role != "restaurant" && role != "staff" && role != "api_key" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "Bạn không có quyền truy cập",
+				"error": gin.H{
+					"code":    "FORBIDDEN",
+					"details": "Role not allowed",
+				},
+			})
+			c.Abort()
+			return
+		}
+
+		for _, perm := range perms {
+			if !HasPermission(c, perm) {
+				c.JSON(http.StatusForbidden, gin.H{
+					"success": false,
+					"message": "Bạn không có quyền thực hiện thao tác này",
+					"error": gin.H{
+						"code":    "FORBIDDEN",
+						"details": "Missing permission: " + perm,
+					},
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,236 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// ===============================
+// RATE LIMIT STORE
+// ===============================
+
+// RateLimitResult kết quả đếm request trong cửa sổ hiện tại
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration // Thời gian đến khi cửa sổ mới bắt đầu
+}
+
+// RateLimitStore nơi lưu bộ đếm (memory cho 1 instance, Redis cho nhiều instance)
+type RateLimitStore interface {
+	Allow(ctx context.Context, key string, rule config.RateLimitRule) (RateLimitResult, error)
+}
+
+var (
+	rateLimitStoreOnce sync.Once
+	rateLimitStore     RateLimitStore
+)
+
+// getRateLimitStore chọn store theo RATE_LIMIT_BACKEND, Redis lỗi thì dùng memory
+func getRateLimitStore() RateLimitStore {
+	rateLimitStoreOnce.Do(func() {
+		if config.RateLimitBackend() == "redis" {
+			if client := config.GetRedis(); client != nil {
+				rateLimitStore = &redisRateLimitStore{client: client}
+				log.Println("✅ Rate limiter using Redis")
+				return
+			}
+			log.Println("⚠️ Redis unavailable, rate limiter falling back to memory")
+		}
+		rateLimitStore = newMemoryRateLimitStore()
+	})
+	return rateLimitStore
+}
+
+// memoryRateLimitStore bộ đếm fixed window trong bộ nhớ
+type memoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	sweepAt time.Time
+}
+
+type memoryBucket struct {
+	count   int
+	resetAt time.Time
+}
+
+func newMemoryRateLimitStore() *memoryRateLimitStore {
+	return &memoryRateLimitStore{buckets: map[string]*memoryBucket{}}
+}
+
+// Allow tăng bộ đếm của key và kiểm tra giới hạn
+func (s *memoryRateLimitStore) Allow(_ context.Context, key string, rule config.RateLimitRule) (RateLimitResult, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Dọn bucket hết hạn định kỳ để map không phình mãi
+	if now.After(s.sweepAt) {
+		for k, b := range s.buckets {
+			if now.After(b.resetAt) {
+				delete(s.buckets, k)
+			}
+		}
+		s.sweepAt = now.Add(time.Minute)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok || now.After(b.resetAt) {
+		b = &memoryBucket{resetAt: now.Add(rule.Window)}
+		s.buckets[key] = b
+	}
+	b.count++
+
+	return RateLimitResult{
+		Allowed:    b.count <= rule.Limit,
+		Remaining:  max(rule.Limit-b.count, 0),
+		RetryAfter: b.resetAt.Sub(now),
+	}, nil
+}
+
+// redisRateLimitStore bộ đếm fixed window dùng chung giữa các instance
+type redisRateLimitStore struct {
+	client *redis.Client
+}
+
+// INCR + đặt TTL ở lần đầu, trả về {count, ttl_ms}
+var redisRateLimitScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+  redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl < 0 then
+  redis.call("PEXPIRE", KEYS[1], ARGV[1])
+  ttl = tonumber(ARGV[1])
+end
+return {count, ttl}
+`)
+
+// Allow tăng bộ đếm của key trên Redis và kiểm tra giới hạn
+func (s *redisRateLimitStore) Allow(ctx context.Context, key string, rule config.RateLimitRule) (RateLimitResult, error) {
+	values, err := redisRateLimitScript.Run(ctx, s.client, []string{"ratelimit:" + key}, rule.Window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return RateLimitResult{Allowed: true}, err
+	}
+
+	count := int(values[0])
+	return RateLimitResult{
+		Allowed:    count <= rule.Limit,
+		Remaining:  max(rule.Limit-count, 0),
+		RetryAfter: time.Duration(values[1]) * time.Millisecond,
+	}, nil
+}
+
+// ===============================
+// MIDDLEWARE
+// ===============================
+
+// RateKeyFunc lấy khóa bucket từ request; trả về "" = không giới hạn request này
+type RateKeyFunc func(c *gin.Context) string
+
+// RateKeyIP bucket theo IP client
+func RateKeyIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// RateKeyParam bucket theo path param (vd mã thanh toán)
+func RateKeyParam(name string) RateKeyFunc {
+	return func(c *gin.Context) string {
+		return c.Param(name)
+	}
+}
+
+// RateKeyJSONField bucket theo một trường trong JSON body (vd email đăng nhập).
+// Body được đọc rồi trả lại để handler vẫn bind được
+func RateKeyJSONField(field string) RateKeyFunc {
+	return func(c *gin.Context) string {
+		if c.Request.Body == nil {
+			return ""
+		}
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+		c.Request.Body.Close()
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return ""
+		}
+
+		var payload map[string]interface{}
+		if json.Unmarshal(body, &payload) != nil {
+			return ""
+		}
+		value, _ := payload[field].(string)
+		return strings.ToLower(strings.TrimSpace(value))
+	}
+}
+
+// RateLimit giới hạn request theo nhóm route (cấu hình config.RateLimitFor(name)) và khóa bucket.
+// Gắn nhiều lần để giới hạn đồng thời theo IP và theo khóa khác (email, mã thanh toán...)
+func RateLimit(name string, keyFunc RateKeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rule := config.RateLimitFor(name)
+		if rule.Limit <= 0 {
+			c.Next()
+			return
+		}
+
+		key := keyFunc(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		result, err := getRateLimitStore().Allow(c.Request.Context(), name+":"+key, rule)
+		if err != nil {
+			// Lỗi store: cho qua thay vì chặn toàn bộ người dùng
+			log.Printf("❌ Rate limiter error (%s): %v", name, err)
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(rule.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+
+		if !result.Allowed {
+			retryAfter := RetryAfterSeconds(result.RetryAfter)
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"success": false,
+				"message": "Bạn thao tác quá nhanh, vui lòng thử lại sau",
+				"error": gin.H{
+					"code":        "RATE_LIMITED",
+					"details":     name,
+					"retry_after": retryAfter,
+				},
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RetryAfterSeconds làm tròn lên số giây cho header Retry-After (tối thiểu 1)
+func RetryAfterSeconds(d time.Duration) int {
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
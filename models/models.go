@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
@@ -12,7 +13,7 @@ type User struct {
 	Email     string         `json:"email" gorm:"size:255;uniqueIndex;not null"`
 	Password  string         `json:"-" gorm:"size:255;not null"`
 	Name      string         `json:"name" gorm:"size:255;not null"`
-	Role      string         `json:"role" gorm:"size:20;default:'restaurant';not null"`
+	Role      string         `json:"role" gorm:"size:20;default:'restaurant';not null"` // admin, restaurant, staff
 	Avatar    *string        `json:"avatar" gorm:"type:text"`
 	Phone     *string        `json:"phone" gorm:"size:20"`
 	IsActive  bool           `json:"is_active" gorm:"default:true"`
@@ -21,6 +22,13 @@ type User struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
+	// Xác thực email (nil = chưa xác thực)
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+
+	// Chống dò mật khẩu: số lần sai liên tiếp và thời điểm hết khóa
+	FailedLoginCount int        `json:"-" gorm:"default:0"`
+	LockedUntil      *time.Time `json:"-"`
+
 	// Relationships
 	Restaurant *Restaurant `json:"restaurant,omitempty" gorm:"foreignKey:OwnerID"`
 }
@@ -40,7 +48,8 @@ type Package struct {
 	MaxMenuItems  int       `json:"max_menu_items" gorm:"default:30"`
 	MaxTables     int       `json:"max_tables" gorm:"default:10"`
 	MaxCategories int       `json:"max_categories" gorm:"default:5"`
-	Features      *string   `json:"features" gorm:"type:text"` // JSON array
+	MaxBranches   int       `json:"max_branches" gorm:"default:1"` // Số nhà hàng (kể cả nhà hàng chính), -1 = không giới hạn
+	Features      *string   `json:"features" gorm:"type:text"`     // JSON array
 	IsPopular     bool      `json:"is_popular" gorm:"default:false"`
 	IsActive      bool      `json:"is_active" gorm:"default:true"`
 	SortOrder     int       `json:"sort_order" gorm:"default:0"`
@@ -59,6 +68,8 @@ type Restaurant struct {
 	ID          uint    `json:"id" gorm:"primaryKey"`
 	OwnerID     uint    `json:"owner_id" gorm:"not null;index"`
 	PackageID   uint    `json:"package_id" gorm:"not null;index"`
+	ParentID    *uint   `json:"parent_id" gorm:"index"` // Nhà hàng chính của chuỗi, nil = nhà hàng chính
+	BranchName  *string `json:"branch_name" gorm:"size:255"`
 	Name        string  `json:"name" gorm:"size:255;not null"`
 	Slug        string  `json:"slug" gorm:"size:100;uniqueIndex;not null"`
 	Description *string `json:"description" gorm:"size:1000"`
@@ -67,11 +78,23 @@ type Restaurant struct {
 	Email       *string `json:"email" gorm:"size:255"`
 	Address     *string `json:"address" gorm:"size:500"`
 
+	// Tọa độ nhà hàng (tính khoảng cách giao hàng)
+	Latitude  *float64 `json:"latitude" gorm:"type:decimal(10,7)"`
+	Longitude *float64 `json:"longitude" gorm:"type:decimal(10,7)"`
+
 	IsOpen        bool    `json:"is_open" gorm:"default:true"`
 	TaxRate       float64 `json:"tax_rate" gorm:"type:decimal(5,2);default:10.00"`
 	ServiceCharge float64 `json:"service_charge" gorm:"type:decimal(5,2);default:5.00"`
 	Currency      string  `json:"currency" gorm:"size:10;default:'VND'"`
 
+	// QR gọi món theo phiên: token bàn chỉ hợp lệ khi bàn đang có khách (occupied)
+	TableSessionMode bool `json:"table_session_mode" gorm:"default:false"`
+
+	// Đặt bàn
+	AcceptReservations         bool `json:"accept_reservations" gorm:"default:true"`
+	ReservationHoldMinutes     int  `json:"reservation_hold_minutes" gorm:"default:30"`     // Giữ bàn trước giờ đặt N phút
+	ReservationDurationMinutes int  `json:"reservation_duration_minutes" gorm:"default:90"` // Thời lượng mặc định mỗi lượt
+
 	PackageStartDate time.Time `json:"package_start_date" gorm:"type:date;not null"`
 	PackageEndDate   time.Time `json:"package_end_date" gorm:"type:date;not null"`
 	PackageStatus    string    `json:"package_status" gorm:"size:20;default:'active'"`
@@ -83,6 +106,7 @@ type Restaurant struct {
 
 	// Relationships
 	Owner          *User           `json:"owner,omitempty" gorm:"foreignKey:OwnerID"`
+	Parent         *Restaurant     `json:"parent,omitempty" gorm:"foreignKey:ParentID"`
 	Package        *Package        `json:"package,omitempty" gorm:"foreignKey:PackageID"`
 	PaymentSetting *PaymentSetting `json:"payment_setting,omitempty" gorm:"foreignKey:RestaurantID"`
 	Tables         []Table         `json:"tables,omitempty" gorm:"foreignKey:RestaurantID"`
@@ -114,6 +138,13 @@ type PaymentSetting struct {
 	SepayBankAccountID *string    `json:"sepay_bank_account_id" gorm:"size:100"`
 	SepayLinkedAt      *time.Time `json:"sepay_linked_at"`
 
+	// Tài khoản merchant MoMo / VNPay của nhà hàng (secret không trả về client)
+	MomoPartnerCode *string `json:"momo_partner_code" gorm:"size:50"`
+	MomoAccessKey   *string `json:"-" gorm:"size:100"`
+	MomoSecretKey   *string `json:"-" gorm:"size:100"`
+	VNPayTmnCode    *string `json:"vnpay_tmn_code" gorm:"column:vnpay_tmn_code;size:20"`
+	VNPayHashSecret *string `json:"-" gorm:"column:vnpay_hash_secret;size:100"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
@@ -127,20 +158,56 @@ func (PaymentSetting) TableName() string {
 
 // Table model - Bàn ăn
 type Table struct {
+	ID           uint    `json:"id" gorm:"primaryKey"`
+	RestaurantID uint    `json:"restaurant_id" gorm:"not null;index"`
+	TableNumber  int     `json:"table_number" gorm:"not null"`
+	Name         *string `json:"name" gorm:"size:50"`
+	Capacity     int     `json:"capacity" gorm:"default:4"`
+	Status       string  `json:"status" gorm:"size:20;default:'available'"`
+	QRCode       *string `json:"qr_code" gorm:"type:text"`
+	// Phiên bản token QR, tăng khi đổi QR (QR cũ mất hiệu lực)
+	QRTokenVersion int        `json:"qr_token_version" gorm:"default:1"`
+	QRRotatedAt    *time.Time `json:"qr_rotated_at"`
+	IsActive       bool       `json:"is_active" gorm:"default:true"`
+
+	// Sơ đồ bàn (floor plan)
+	ZoneID   *uint   `json:"zone_id" gorm:"index"`
+	PosX     float64 `json:"pos_x" gorm:"default:0"`
+	PosY     float64 `json:"pos_y" gorm:"default:0"`
+	Width    float64 `json:"width" gorm:"default:80"`
+	Height   float64 `json:"height" gorm:"default:80"`
+	Shape    string  `json:"shape" gorm:"size:20;default:'square'"` // square, rectangle, round
+	Rotation int     `json:"rotation" gorm:"default:0"`             // Góc xoay (độ)
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Relationships
+	Restaurant *Restaurant `json:"restaurant,omitempty" gorm:"foreignKey:RestaurantID"`
+	Zone       *TableZone  `json:"zone,omitempty" gorm:"foreignKey:ZoneID"`
+	Orders     []Order     `json:"orders,omitempty" gorm:"foreignKey:TableID"`
+}
+
+// TableZone model - Khu vực bàn (trong nhà, sân thượng, tầng 2...)
+type TableZone struct {
 	ID           uint      `json:"id" gorm:"primaryKey"`
 	RestaurantID uint      `json:"restaurant_id" gorm:"not null;index"`
-	TableNumber  int       `json:"table_number" gorm:"not null"`
-	Name         *string   `json:"name" gorm:"size:50"`
-	Capacity     int       `json:"capacity" gorm:"default:4"`
-	Status       string    `json:"status" gorm:"size:20;default:'available'"`
-	QRCode       *string   `json:"qr_code" gorm:"type:text"`
+	Name         string    `json:"name" gorm:"size:100;not null"`
+	Description  *string   `json:"description" gorm:"size:500"`
+	SortOrder    int       `json:"sort_order" gorm:"default:0"`
+	Width        float64   `json:"width" gorm:"default:1000"` // Kích thước khung vẽ sơ đồ
+	Height       float64   `json:"height" gorm:"default:700"`
 	IsActive     bool      `json:"is_active" gorm:"default:true"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 
 	// Relationships
 	Restaurant *Restaurant `json:"restaurant,omitempty" gorm:"foreignKey:RestaurantID"`
-	Orders     []Order     `json:"orders,omitempty" gorm:"foreignKey:TableID"`
+	Tables     []Table     `json:"tables,omitempty" gorm:"foreignKey:ZoneID"`
+}
+
+func (TableZone) TableName() string {
+	return "table_zones"
 }
 
 func (Table) TableName() string {
@@ -151,6 +218,7 @@ func (Table) TableName() string {
 type Category struct {
 	ID           uint      `json:"id" gorm:"primaryKey"`
 	RestaurantID uint      `json:"restaurant_id" gorm:"not null;index"`
+	TemplateID   *uint     `json:"template_id" gorm:"index"` // Danh mục gốc ở nhà hàng chính (chi nhánh đồng bộ thực đơn)
 	Name         string    `json:"name" gorm:"size:100;not null"`
 	Description  *string   `json:"description" gorm:"size:500"`
 	Image        *string   `json:"image" gorm:"type:text"`
@@ -173,6 +241,7 @@ type MenuItem struct {
 	ID           uint      `json:"id" gorm:"primaryKey"`
 	RestaurantID uint      `json:"restaurant_id" gorm:"not null;index"`
 	CategoryID   uint      `json:"category_id" gorm:"not null;index"`
+	TemplateID   *uint     `json:"template_id" gorm:"index"` // Món gốc ở nhà hàng chính, giá bán do chi nhánh tự đặt
 	Name         string    `json:"name" gorm:"size:255;not null"`
 	Description  *string   `json:"description" gorm:"size:1000"`
 	Price        float64   `json:"price" gorm:"type:decimal(12,0);not null"`
@@ -200,11 +269,12 @@ func (MenuItem) TableName() string {
 type Order struct {
 	ID            uint       `json:"id" gorm:"primaryKey"`
 	RestaurantID  uint       `json:"restaurant_id" gorm:"not null;index"`
-	TableID       uint       `json:"table_id" gorm:"not null;index"`
+	TableID       *uint      `json:"table_id" gorm:"index"` // NULL với đơn mang về
 	OrderNumber   string     `json:"order_number" gorm:"size:50;not null;index"`
+	OrderType     string     `json:"order_type" gorm:"size:20;default:'dine_in';index"` // dine_in, takeaway, delivery
 	CustomerName  *string    `json:"customer_name" gorm:"size:255"`
 	CustomerPhone *string    `json:"customer_phone" gorm:"size:20"`
-	Status        string     `json:"status" gorm:"size:20;default:'pending'"`
+	Status        string     `json:"status" gorm:"size:20;default:'pending'"` // pending, confirmed, serving, ready_for_pickup, out_for_delivery, delivered, completed, cancelled, merged
 	PaymentTiming string     `json:"payment_timing" gorm:"size:10;default:'after'"`
 	PaymentMethod *string    `json:"payment_method" gorm:"size:20"`
 	PaymentStatus string     `json:"payment_status" gorm:"size:20;default:'unpaid'"`
@@ -214,6 +284,25 @@ type Order struct {
 	PaymentCode      *string    `json:"payment_code" gorm:"size:50;index"`
 	PaymentExpiresAt *time.Time `json:"payment_expires_at"`
 
+	// Ca thu ngân nhận tiền mặt (đơn trả tiền mặt)
+	CashShiftID *uint `json:"cash_shift_id" gorm:"index"`
+
+	// Đơn mang về (takeaway)
+	PickupTime   *time.Time `json:"pickup_time"`
+	PickupNumber *string    `json:"pickup_number" gorm:"size:10"`
+	ReadyAt      *time.Time `json:"ready_at"`
+
+	// Đơn giao hàng (delivery)
+	DeliveryAddress    *string    `json:"delivery_address" gorm:"size:500"`
+	DeliveryDistrict   *string    `json:"delivery_district" gorm:"size:100"`
+	DeliveryLatitude   *float64   `json:"delivery_latitude" gorm:"type:decimal(10,7)"`
+	DeliveryLongitude  *float64   `json:"delivery_longitude" gorm:"type:decimal(10,7)"`
+	DeliveryDistanceKm *float64   `json:"delivery_distance_km" gorm:"type:decimal(6,2)"`
+	DeliveryZoneID     *uint      `json:"delivery_zone_id"`
+	DeliveryFee        float64    `json:"delivery_fee" gorm:"type:decimal(12,0);default:0"`
+	OutForDeliveryAt   *time.Time `json:"out_for_delivery_at"`
+	DeliveredAt        *time.Time `json:"delivered_at"`
+
 	Subtotal       float64    `json:"subtotal" gorm:"type:decimal(12,0);default:0"`
 	TaxAmount      float64    `json:"tax_amount" gorm:"type:decimal(12,0);default:0"`
 	ServiceCharge  float64    `json:"service_charge" gorm:"type:decimal(12,0);default:0"`
@@ -224,6 +313,7 @@ type Order struct {
 	CreatedAt      time.Time  `json:"created_at"`
 	UpdatedAt      time.Time  `json:"updated_at"`
 	CompletedAt    *time.Time `json:"completed_at"`
+	CancelledAt    *time.Time `json:"cancelled_at" gorm:"index"` // Thời điểm hủy đơn (Z report tính đơn hủy theo ngày này)
 
 	// Relationships
 	Restaurant *Restaurant `json:"restaurant,omitempty" gorm:"foreignKey:RestaurantID"`
@@ -237,18 +327,20 @@ func (Order) TableName() string {
 
 // OrderItem model - Chi tiết đơn hàng
 type OrderItem struct {
-	ID              uint      `json:"id" gorm:"primaryKey"`
-	OrderID         uint      `json:"order_id" gorm:"not null;index"`
-	MenuItemID      uint      `json:"menu_item_id" gorm:"not null;index"`
-	ItemName        string    `json:"item_name" gorm:"size:255;not null"`
-	ItemPrice       float64   `json:"item_price" gorm:"type:decimal(12,0);not null"`
-	Quantity        int       `json:"quantity" gorm:"default:1;not null"`
-	SelectedOptions *string   `json:"selected_options" gorm:"type:text"` // JSON
-	Notes           *string   `json:"notes" gorm:"size:500"`
-	PrepStatus      string    `json:"prep_status" gorm:"size:20;default:'pending'"`
-	PrepLocation    string    `json:"prep_location" gorm:"size:20;default:'kitchen'"`
-	LineTotal       float64   `json:"line_total" gorm:"type:decimal(12,0);not null"`
-	CreatedAt       time.Time `json:"created_at"`
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	OrderID         uint       `json:"order_id" gorm:"not null;index"`
+	MenuItemID      uint       `json:"menu_item_id" gorm:"not null;index"`
+	ItemName        string     `json:"item_name" gorm:"size:255;not null"`
+	ItemPrice       float64    `json:"item_price" gorm:"type:decimal(12,0);not null"`
+	Quantity        int        `json:"quantity" gorm:"default:1;not null"`
+	SelectedOptions *string    `json:"selected_options" gorm:"type:text"` // JSON
+	Notes           *string    `json:"notes" gorm:"size:500"`
+	PrepStatus      string     `json:"prep_status" gorm:"size:20;default:'pending'"` // pending, confirmed, preparing, ready, served, cancelled
+	PrepLocation    string     `json:"prep_location" gorm:"size:20;default:'kitchen'"`
+	LineTotal       float64    `json:"line_total" gorm:"type:decimal(12,0);not null"`
+	CancelReason    *string    `json:"cancel_reason" gorm:"size:500"`
+	CancelledAt     *time.Time `json:"cancelled_at"`
+	CreatedAt       time.Time  `json:"created_at"`
 
 	// Relationships
 	Order    *Order    `json:"order,omitempty" gorm:"foreignKey:OrderID"`
@@ -259,6 +351,50 @@ func (OrderItem) TableName() string {
 	return "order_items"
 }
 
+// OrderMove model - Lịch sử chuyển bàn / tách / gộp đơn hàng
+type OrderMove struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	RestaurantID  uint      `json:"restaurant_id" gorm:"not null;index"`
+	Type          string    `json:"type" gorm:"size:20;not null"` // transfer, move_items, merge
+	SourceOrderID uint      `json:"source_order_id" gorm:"not null;index"`
+	TargetOrderID uint      `json:"target_order_id" gorm:"not null;index"`
+	FromTableID   uint      `json:"from_table_id"`
+	ToTableID     uint      `json:"to_table_id"`
+	Items         *string   `json:"items" gorm:"type:text"` // JSON: [{order_item_id, quantity}]
+	Amount        float64   `json:"amount" gorm:"type:decimal(12,0);default:0"`
+	Reason        *string   `json:"reason" gorm:"size:500"`
+	MovedBy       uint      `json:"moved_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (OrderMove) TableName() string {
+	return "order_moves"
+}
+
+// OrderItemChange model - Lịch sử sửa / hủy từng món trong đơn
+type OrderItemChange struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	RestaurantID    uint      `json:"restaurant_id" gorm:"not null;index"`
+	OrderID         uint      `json:"order_id" gorm:"not null;index"`
+	OrderItemID     uint      `json:"order_item_id" gorm:"not null;index"`
+	Action          string    `json:"action" gorm:"size:20;not null"` // update, cancel
+	PrepStatus      string    `json:"prep_status" gorm:"size:20"`     // Trạng thái món lúc thay đổi
+	OldQuantity     int       `json:"old_quantity"`
+	NewQuantity     int       `json:"new_quantity"`
+	OldLineTotal    float64   `json:"old_line_total" gorm:"type:decimal(12,0)"`
+	NewLineTotal    float64   `json:"new_line_total" gorm:"type:decimal(12,0)"`
+	OldNotes        *string   `json:"old_notes" gorm:"size:500"`
+	NewNotes        *string   `json:"new_notes" gorm:"size:500"`
+	Reason          string    `json:"reason" gorm:"size:500;not null"`
+	ManagerOverride bool      `json:"manager_override" gorm:"default:false"`
+	ChangedBy       uint      `json:"changed_by"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+func (OrderItemChange) TableName() string {
+	return "order_item_changes"
+}
+
 // ===============================
 // PAYMENT MODELS
 // ===============================
@@ -310,12 +446,19 @@ type PaymentTransaction struct {
 	TransactionContent *string    `json:"transaction_content" gorm:"size:500"`
 	ReferenceNumber    *string    `json:"reference_number" gorm:"size:100"`
 	Description        *string    `json:"description" gorm:"size:1000"`
-	Status             string     `json:"status" gorm:"size:20;default:'pending'"` // pending, completed, failed, duplicate
+	Status             string     `json:"status" gorm:"size:20;default:'pending';index"` // pending, completed, failed, duplicate, unmatched, assigned, ignored
 	VerifiedAt         *time.Time `json:"verified_at"`
 	ErrorMessage       *string    `json:"error_message" gorm:"size:500"`
 	RawWebhookData     *string    `json:"raw_webhook_data" gorm:"type:text"`
-	CreatedAt          time.Time  `json:"created_at"`
-	UpdatedAt          time.Time  `json:"updated_at"`
+
+	// Đối soát giao dịch không khớp mã (nhà hàng sở hữu tài khoản nhận; nil = tài khoản nền tảng)
+	RestaurantID   *uint      `json:"restaurant_id" gorm:"index"`
+	ResolvedBy     *uint      `json:"resolved_by"`
+	ResolvedAt     *time.Time `json:"resolved_at"`
+	ResolutionNote *string    `json:"resolution_note" gorm:"size:500"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 func (PaymentTransaction) TableName() string {
@@ -330,7 +473,7 @@ func (PaymentTransaction) TableName() string {
 type Notification struct {
 	ID           uint       `json:"id" gorm:"primaryKey"`
 	RestaurantID uint       `json:"restaurant_id" gorm:"not null;index"`
-	Type         string     `json:"type" gorm:"size:50;not null"` // new_order, payment_pending, order_cancelled, system_error, system_success
+	Type         string     `json:"type" gorm:"size:50;not null"` // new_order, new_takeaway_order, new_delivery_order, payment_pending, order_cancelled, new_reservation, service_*, print_failed, system_error, system_success
 	Title        string     `json:"title" gorm:"size:255;not null"`
 	Message      string     `json:"message" gorm:"size:1000;not null"`
 	Data         *string    `json:"data" gorm:"type:text"` // JSON data (order_id, table_id, etc.)
@@ -368,3 +511,624 @@ type ContactMessage struct {
 func (ContactMessage) TableName() string {
 	return "contact_messages"
 }
+
+// ===============================
+// RESERVATION MODELS
+// ===============================
+
+// Reservation model - Đặt bàn trước
+type Reservation struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	RestaurantID    uint       `json:"restaurant_id" gorm:"not null;index"`
+	TableID         *uint      `json:"table_id" gorm:"index"`
+	Code            string     `json:"code" gorm:"size:20;uniqueIndex;not null"`
+	CustomerName    string     `json:"customer_name" gorm:"size:255;not null"`
+	CustomerPhone   string     `json:"customer_phone" gorm:"size:20;not null"`
+	CustomerEmail   *string    `json:"customer_email" gorm:"size:255"`
+	PartySize       int        `json:"party_size" gorm:"not null"`
+	ReservedAt      time.Time  `json:"reserved_at" gorm:"not null;index"`
+	DurationMinutes int        `json:"duration_minutes" gorm:"default:90"`
+	Status          string     `json:"status" gorm:"size:20;default:'pending';index"` // pending, confirmed, seated, completed, cancelled, no_show
+	Notes           *string    `json:"notes" gorm:"size:1000"`
+	CancelReason    *string    `json:"cancel_reason" gorm:"size:500"`
+	ConfirmedAt     *time.Time `json:"confirmed_at"`
+	SeatedAt        *time.Time `json:"seated_at"`
+	CancelledAt     *time.Time `json:"cancelled_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	// Relationships
+	Restaurant *Restaurant `json:"restaurant,omitempty" gorm:"foreignKey:RestaurantID"`
+	Table      *Table      `json:"table,omitempty" gorm:"foreignKey:TableID"`
+}
+
+func (Reservation) TableName() string {
+	return "reservations"
+}
+
+// EndsAt thời điểm kết thúc dự kiến của lượt đặt bàn
+func (r Reservation) EndsAt() time.Time {
+	return r.ReservedAt.Add(time.Duration(r.DurationMinutes) * time.Minute)
+}
+
+// WaitlistEntry model - Danh sách chờ cho khách vãng lai
+type WaitlistEntry struct {
+	ID                uint       `json:"id" gorm:"primaryKey"`
+	RestaurantID      uint       `json:"restaurant_id" gorm:"not null;index"`
+	Code              string     `json:"code" gorm:"size:20;uniqueIndex;not null"`
+	CustomerName      string     `json:"customer_name" gorm:"size:255;not null"`
+	CustomerPhone     *string    `json:"customer_phone" gorm:"size:20"`
+	PartySize         int        `json:"party_size" gorm:"not null"`
+	Status            string     `json:"status" gorm:"size:20;default:'waiting';index"` // waiting, notified, seated, cancelled
+	QuotedWaitMinutes int        `json:"quoted_wait_minutes" gorm:"default:0"`
+	TableID           *uint      `json:"table_id"`
+	Notes             *string    `json:"notes" gorm:"size:500"`
+	NotifiedAt        *time.Time `json:"notified_at"`
+	SeatedAt          *time.Time `json:"seated_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+
+	// Relationships
+	Restaurant *Restaurant `json:"restaurant,omitempty" gorm:"foreignKey:RestaurantID"`
+	Table      *Table      `json:"table,omitempty" gorm:"foreignKey:TableID"`
+}
+
+func (WaitlistEntry) TableName() string {
+	return "waitlist_entries"
+}
+
+// ===============================
+// SERVICE REQUEST MODEL
+// ===============================
+
+// ServiceRequest model - Yêu cầu phục vụ từ khách tại bàn (gọi nhân viên, xin thanh toán...)
+type ServiceRequest struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	RestaurantID   uint       `json:"restaurant_id" gorm:"not null;index"`
+	TableID        uint       `json:"table_id" gorm:"not null;index"`
+	Type           string     `json:"type" gorm:"size:20;not null"`                  // call_staff, request_bill, water, cutlery
+	Status         string     `json:"status" gorm:"size:20;default:'pending';index"` // pending, acknowledged, resolved
+	Note           *string    `json:"note" gorm:"size:500"`
+	AcknowledgedBy *uint      `json:"acknowledged_by"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at"`
+	ResolvedBy     *uint      `json:"resolved_by"`
+	ResolvedAt     *time.Time `json:"resolved_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Relationships
+	Restaurant *Restaurant `json:"restaurant,omitempty" gorm:"foreignKey:RestaurantID"`
+	Table      *Table      `json:"table,omitempty" gorm:"foreignKey:TableID"`
+}
+
+func (ServiceRequest) TableName() string {
+	return "service_requests"
+}
+
+// ===============================
+// DELIVERY MODELS
+// ===============================
+
+// DeliveryZone model - Vùng giao hàng của nhà hàng (theo bán kính hoặc theo quận/huyện)
+type DeliveryZone struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	RestaurantID   uint      `json:"restaurant_id" gorm:"not null;index"`
+	Name           string    `json:"name" gorm:"size:100;not null"`
+	ZoneType       string    `json:"zone_type" gorm:"size:20;not null"` // distance, district
+	MaxDistanceKm  *float64  `json:"max_distance_km" gorm:"type:decimal(6,2)"`
+	District       *string   `json:"district" gorm:"size:100"`
+	Fee            float64   `json:"fee" gorm:"type:decimal(12,0);default:0"`
+	MinOrderAmount float64   `json:"min_order_amount" gorm:"type:decimal(12,0);default:0"`
+	IsActive       bool      `json:"is_active" gorm:"default:true"`
+	SortOrder      int       `json:"sort_order" gorm:"default:0"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// Relationships
+	Restaurant *Restaurant `json:"restaurant,omitempty" gorm:"foreignKey:RestaurantID"`
+}
+
+func (DeliveryZone) TableName() string {
+	return "delivery_zones"
+}
+
+// ===============================
+// STAFF MODELS
+// ===============================
+
+// StaffMember model - Nhân viên của nhà hàng (mỗi tài khoản staff thuộc đúng một nhà hàng)
+type StaffMember struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	RestaurantID uint       `json:"restaurant_id" gorm:"not null;index"`
+	UserID       uint       `json:"user_id" gorm:"not null;uniqueIndex"`
+	Role         string     `json:"role" gorm:"size:20;not null"`                  // manager, cashier, waiter, kitchen
+	Status       string     `json:"status" gorm:"size:20;default:'invited';index"` // invited, active, disabled
+	InvitedBy    *uint      `json:"invited_by"`
+	InvitedAt    time.Time  `json:"invited_at"`
+	JoinedAt     *time.Time `json:"joined_at"`
+	DisabledAt   *time.Time `json:"disabled_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	// Relationships
+	Restaurant *Restaurant `json:"restaurant,omitempty" gorm:"foreignKey:RestaurantID"`
+	User       *User       `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+func (StaffMember) TableName() string {
+	return "staff_members"
+}
+
+// UserToken model - Token dùng một lần gửi qua link (mời nhân viên...), chỉ lưu hash
+type UserToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	Type      string     `json:"type" gorm:"size:30;not null;index"` // staff_invite, password_reset, email_verify
+	TokenHash string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Relationships
+	User *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+func (UserToken) TableName() string {
+	return "user_tokens"
+}
+
+// RefreshToken model - Refresh token (opaque, chỉ lưu hash). Mỗi lần đăng nhập tạo một family,
+// mỗi lần refresh xoay sang token mới trong cùng family
+type RefreshToken struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	UserID        uint       `json:"user_id" gorm:"not null;index"`
+	RestaurantID  *uint      `json:"restaurant_id"`                           // Nhà hàng / chi nhánh đang làm việc của phiên
+	FamilyID      string     `json:"family_id" gorm:"size:36;not null;index"` // Phiên đăng nhập (một thiết bị)
+	TokenHash     string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+	RevokedReason *string    `json:"revoked_reason" gorm:"size:30"` // rotated, logout, logout_all, reuse_detected, staff_disabled
+	ReplacedByID  *uint      `json:"replaced_by_id"`
+	UserAgent     *string    `json:"user_agent" gorm:"size:500"`
+	IPAddress     *string    `json:"ip_address" gorm:"size:64"`
+	CreatedAt     time.Time  `json:"created_at"`
+
+	// Relationships
+	User *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// UserMFA model - Xác thực 2 bước (TOTP) của user
+type UserMFA struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       uint       `json:"user_id" gorm:"uniqueIndex;not null"`
+	Secret       string     `json:"-" gorm:"type:text;not null"` // Secret TOTP đã mã hóa (AES-GCM)
+	EnabledAt    *time.Time `json:"enabled_at"`                  // nil = đang thiết lập, chưa xác nhận mã
+	LastUsedStep int64      `json:"-"`                           // Bước thời gian của mã đã dùng gần nhất (chặn dùng lại mã)
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	// Relationships
+	User *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+func (UserMFA) TableName() string {
+	return "user_mfa"
+}
+
+// MFARecoveryCode model - Mã khôi phục dùng một lần khi mất thiết bị xác thực, chỉ lưu hash
+type MFARecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"size:64;not null;index"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (MFARecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+// APIKey model - API key của nhà hàng cho POS / tích hợp bên ngoài, chỉ lưu hash
+type APIKey struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	RestaurantID uint       `json:"restaurant_id" gorm:"not null;index"`
+	Name         string     `json:"name" gorm:"size:100;not null"`
+	Prefix       string     `json:"prefix" gorm:"size:20;not null"` // Vài ký tự đầu để nhận diện key, vd rk_a1b2c3d4
+	KeyHash      string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	Scopes       string     `json:"scopes" gorm:"size:255;not null"` // Phân cách bằng dấu phẩy: menu.read, orders.write, stats.read...
+	CreatedBy    *uint      `json:"created_by"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	LastUsedIP   *string    `json:"last_used_ip" gorm:"size:64"`
+	ExpiresAt    *time.Time `json:"expires_at"` // nil = không hết hạn
+	RevokedAt    *time.Time `json:"revoked_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	// Relationships
+	Restaurant *Restaurant `json:"restaurant,omitempty" gorm:"foreignKey:RestaurantID"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// WebhookEndpoint model - Địa chỉ nhận webhook của nhà hàng (POS, kế toán...)
+type WebhookEndpoint struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	RestaurantID uint      `json:"restaurant_id" gorm:"not null;index"`
+	URL          string    `json:"url" gorm:"size:500;not null"`
+	Description  *string   `json:"description" gorm:"size:255"`
+	Events       string    `json:"events" gorm:"size:255;not null"` // Phân cách bằng dấu phẩy: order.created, order.paid, order.status_changed, menu.updated
+	Secret       string    `json:"-" gorm:"size:100;not null"`      // Khóa ký HMAC-SHA256 payload
+	IsActive     bool      `json:"is_active" gorm:"default:true"`
+	CreatedBy    *uint     `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	// Relationships
+	Restaurant *Restaurant `json:"restaurant,omitempty" gorm:"foreignKey:RestaurantID"`
+}
+
+func (WebhookEndpoint) TableName() string {
+	return "webhook_endpoints"
+}
+
+// WebhookDelivery model - Một lần gửi sự kiện tới một endpoint (nhật ký gửi + hàng đợi thử lại)
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	EndpointID     uint       `json:"endpoint_id" gorm:"not null;index"`
+	RestaurantID   uint       `json:"restaurant_id" gorm:"not null;index"`
+	EventID        string     `json:"event_id" gorm:"size:36;not null;index"` // Giống nhau giữa các endpoint nhận cùng sự kiện
+	EventType      string     `json:"event_type" gorm:"size:50;not null"`
+	Payload        string     `json:"payload" gorm:"type:text;not null"`
+	Status         string     `json:"status" gorm:"size:20;default:'pending';index"` // pending, retrying, succeeded, dead
+	Attempts       int        `json:"attempts" gorm:"default:0"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at" gorm:"index"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at"`
+	ResponseStatus *int       `json:"response_status"`
+	ResponseBody   *string    `json:"response_body" gorm:"type:text"` // Cắt ngắn tối đa 2KB
+	LastError      *string    `json:"last_error" gorm:"type:text"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Relationships
+	Endpoint *WebhookEndpoint `json:"endpoint,omitempty" gorm:"foreignKey:EndpointID"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// OrderPayment model - Một lần khởi tạo thanh toán đơn hàng qua cổng thanh toán (SePay/VietQR, MoMo, VNPay)
+type OrderPayment struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	OrderID         uint       `json:"order_id" gorm:"not null;index"`
+	RestaurantID    uint       `json:"restaurant_id" gorm:"not null;index"`
+	Provider        string     `json:"provider" gorm:"size:20;not null;uniqueIndex:idx_order_payment_provider_ref"`     // sepay, momo, vnpay, fake
+	ProviderRef     string     `json:"provider_ref" gorm:"size:64;not null;uniqueIndex:idx_order_payment_provider_ref"` // Mã giao dịch phía mình gửi sang cổng (orderId MoMo, vnp_TxnRef, mã chuyển khoản)
+	ProviderTransID *string    `json:"provider_trans_id" gorm:"size:64"`                                                // Mã giao dịch phía cổng (transId MoMo, vnp_TransactionNo)
+	Amount          float64    `json:"amount" gorm:"type:decimal(12,0);not null"`
+	RefundedAmount  float64    `json:"refunded_amount" gorm:"type:decimal(12,0);default:0"`
+	Status          string     `json:"status" gorm:"size:20;default:'pending';index"` // pending, paid, failed, cancelled, refunded, partially_refunded
+	PayURL          *string    `json:"pay_url" gorm:"type:text"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+	PaidAt          *time.Time `json:"paid_at"`
+	FailureReason   *string    `json:"failure_reason" gorm:"size:500"`
+	RawCallback     *string    `json:"-" gorm:"type:text"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	// Relationships
+	Order *Order `json:"order,omitempty" gorm:"foreignKey:OrderID"`
+}
+
+func (OrderPayment) TableName() string {
+	return "order_payments"
+}
+
+// PaymentRefund model - Yêu cầu hoàn tiền cho một lần thanh toán đơn hàng
+type PaymentRefund struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	OrderID          uint      `json:"order_id" gorm:"not null;index"`
+	RestaurantID     uint      `json:"restaurant_id" gorm:"not null;index"`
+	OrderPaymentID   *uint     `json:"order_payment_id" gorm:"index"` // nil = hoàn tiền mặt (đơn thu tiền mặt / xác nhận tay)
+	CashShiftID      *uint     `json:"cash_shift_id" gorm:"index"`    // Ca thu ngân chi tiền hoàn (hoàn tiền mặt)
+	Provider         string    `json:"provider" gorm:"size:20;not null"`
+	Amount           float64   `json:"amount" gorm:"type:decimal(12,0);not null"`
+	Reason           *string   `json:"reason" gorm:"size:500"`
+	Status           string    `json:"status" gorm:"size:20;default:'pending';index"` // pending, succeeded, failed, manual (chuyển khoản / tiền mặt, nhân viên tự hoàn)
+	ProviderRefundID *string   `json:"provider_refund_id" gorm:"size:64"`
+	ErrorMessage     *string   `json:"error_message" gorm:"size:500"`
+	CreatedBy        *uint     `json:"created_by"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+func (PaymentRefund) TableName() string {
+	return "payment_refunds"
+}
+
+// LedgerAccount model - Tài khoản sổ cái của nhà hàng (kế toán kép)
+type LedgerAccount struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	RestaurantID uint      `json:"restaurant_id" gorm:"not null;uniqueIndex:idx_ledger_account_code"`
+	Code         string    `json:"code" gorm:"size:30;not null;uniqueIndex:idx_ledger_account_code"` // receivable, cash, bank, revenue, tips, refunds, platform_fees
+	Name         string    `json:"name" gorm:"size:100;not null"`
+	Type         string    `json:"type" gorm:"size:20;not null"` // asset, liability, revenue, contra_revenue, expense
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (LedgerAccount) TableName() string {
+	return "ledger_accounts"
+}
+
+// LedgerTransaction model - Bút toán sổ cái (chỉ ghi thêm, sửa sai bằng bút toán điều chỉnh)
+type LedgerTransaction struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	RestaurantID   uint      `json:"restaurant_id" gorm:"not null;index"`
+	Kind           string    `json:"kind" gorm:"size:30;not null;index"`                       // order_payment, refund, adjustment, overpayment, platform_fee
+	ReferenceType  *string   `json:"reference_type" gorm:"size:30;index:idx_ledger_reference"` // order, package_subscription
+	ReferenceID    *uint     `json:"reference_id" gorm:"index:idx_ledger_reference"`
+	IdempotencyKey string    `json:"idempotency_key" gorm:"size:100;uniqueIndex;not null"` // Chống ghi trùng (vd: order:12:paid, refund:5)
+	Description    *string   `json:"description" gorm:"size:500"`
+	CreatedBy      *uint     `json:"created_by"`
+	PostedAt       time.Time `json:"posted_at" gorm:"not null;index"`
+	CreatedAt      time.Time `json:"created_at"`
+
+	// Relationships
+	Entries []LedgerEntry `json:"entries,omitempty" gorm:"foreignKey:TransactionID"`
+}
+
+func (LedgerTransaction) TableName() string {
+	return "ledger_transactions"
+}
+
+// BeforeUpdate sổ cái chỉ ghi thêm
+func (LedgerTransaction) BeforeUpdate(tx *gorm.DB) error {
+	return ErrLedgerAppendOnly
+}
+
+// BeforeDelete sổ cái chỉ ghi thêm
+func (LedgerTransaction) BeforeDelete(tx *gorm.DB) error {
+	return ErrLedgerAppendOnly
+}
+
+// LedgerEntry model - Dòng ghi Nợ / Có của bút toán
+type LedgerEntry struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	TransactionID uint      `json:"transaction_id" gorm:"not null;index"`
+	RestaurantID  uint      `json:"restaurant_id" gorm:"not null;index"`
+	AccountID     uint      `json:"account_id" gorm:"not null;index"`
+	Debit         float64   `json:"debit" gorm:"type:decimal(14,0);not null;default:0"`
+	Credit        float64   `json:"credit" gorm:"type:decimal(14,0);not null;default:0"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	// Relationships
+	Account *LedgerAccount `json:"account,omitempty" gorm:"foreignKey:AccountID"`
+}
+
+func (LedgerEntry) TableName() string {
+	return "ledger_entries"
+}
+
+// BeforeUpdate sổ cái chỉ ghi thêm
+func (LedgerEntry) BeforeUpdate(tx *gorm.DB) error {
+	return ErrLedgerAppendOnly
+}
+
+// BeforeDelete sổ cái chỉ ghi thêm
+func (LedgerEntry) BeforeDelete(tx *gorm.DB) error {
+	return ErrLedgerAppendOnly
+}
+
+// ErrLedgerAppendOnly lỗi khi sửa / xóa dữ liệu sổ cái
+var ErrLedgerAppendOnly = errors.New("LEDGER_APPEND_ONLY: sổ cái chỉ cho phép ghi thêm")
+
+// CashShift model - Ca thu ngân (két tiền mặt)
+type CashShift struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	RestaurantID   uint       `json:"restaurant_id" gorm:"not null;index"`
+	CashierID      uint       `json:"cashier_id" gorm:"not null;index"`
+	Status         string     `json:"status" gorm:"size:20;default:'open';index"` // open, closed
+	OpeningFloat   float64    `json:"opening_float" gorm:"type:decimal(12,0);not null;default:0"`
+	OpenedAt       time.Time  `json:"opened_at" gorm:"not null"`
+	ClosedAt       *time.Time `json:"closed_at"`
+	ClosedBy       *uint      `json:"closed_by"`
+	CashSales      float64    `json:"cash_sales" gorm:"type:decimal(12,0);default:0"`   // Chốt khi đóng ca
+	CashRefunds    float64    `json:"cash_refunds" gorm:"type:decimal(12,0);default:0"` // Chốt khi đóng ca
+	CashIn         float64    `json:"cash_in" gorm:"type:decimal(12,0);default:0"`      // Chốt khi đóng ca
+	CashOut        float64    `json:"cash_out" gorm:"type:decimal(12,0);default:0"`     // Chốt khi đóng ca
+	ExpectedAmount *float64   `json:"expected_amount" gorm:"type:decimal(12,0)"`
+	CountedAmount  *float64   `json:"counted_amount" gorm:"type:decimal(12,0)"`
+	Variance       *float64   `json:"variance" gorm:"type:decimal(12,0)"` // Đếm thực tế - dự kiến (âm = thiếu)
+	Notes          *string    `json:"notes" gorm:"size:500"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Relationships
+	Cashier   *User          `json:"cashier,omitempty" gorm:"foreignKey:CashierID"`
+	Movements []CashMovement `json:"movements,omitempty" gorm:"foreignKey:ShiftID"`
+}
+
+func (CashShift) TableName() string {
+	return "cash_shifts"
+}
+
+// CashMovement model - Nộp / rút tiền mặt khỏi két trong ca (không phải bán hàng)
+type CashMovement struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	ShiftID      uint      `json:"shift_id" gorm:"not null;index"`
+	RestaurantID uint      `json:"restaurant_id" gorm:"not null;index"`
+	Type         string    `json:"type" gorm:"size:10;not null"` // in, out
+	Amount       float64   `json:"amount" gorm:"type:decimal(12,0);not null"`
+	Reason       string    `json:"reason" gorm:"size:255;not null"`
+	CreatedBy    uint      `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (CashMovement) TableName() string {
+	return "cash_movements"
+}
+
+// DailyClosing model - Chốt sổ cuối ngày (Z report), ngày đã chốt không thể thay đổi
+type DailyClosing struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	RestaurantID  uint      `json:"restaurant_id" gorm:"not null;uniqueIndex:idx_daily_closing_date"`
+	BusinessDate  string    `json:"business_date" gorm:"size:10;not null;uniqueIndex:idx_daily_closing_date"` // YYYY-MM-DD
+	OrdersCount   int64     `json:"orders_count"`
+	GrossSales    float64   `json:"gross_sales" gorm:"type:decimal(14,0)"` // Tổng tiền món trước giảm giá
+	Discounts     float64   `json:"discounts" gorm:"type:decimal(14,0)"`
+	Tax           float64   `json:"tax" gorm:"type:decimal(14,0)"`
+	ServiceCharge float64   `json:"service_charge" gorm:"type:decimal(14,0)"`
+	DeliveryFees  float64   `json:"delivery_fees" gorm:"type:decimal(14,0)"`
+	NetSales      float64   `json:"net_sales" gorm:"type:decimal(14,0)"` // Tổng thu của đơn đã thanh toán
+	Refunds       float64   `json:"refunds" gorm:"type:decimal(14,0)"`
+	Voids         float64   `json:"voids" gorm:"type:decimal(14,0)"` // Đơn / món bị hủy
+	CashVariance  float64   `json:"cash_variance" gorm:"type:decimal(14,0)"`
+	Report        string    `json:"-" gorm:"type:text"` // Z report đầy đủ (JSON) tại thời điểm chốt
+	Notes         *string   `json:"notes" gorm:"size:500"`
+	ClosedBy      uint      `json:"closed_by"`
+	ClosedAt      time.Time `json:"closed_at"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (DailyClosing) TableName() string {
+	return "daily_closings"
+}
+
+// EInvoiceSetting model - Cấu hình hóa đơn điện tử (thông tin người bán, nhà cung cấp HĐĐT)
+type EInvoiceSetting struct {
+	ID                uint    `json:"id" gorm:"primaryKey"`
+	RestaurantID      uint    `json:"restaurant_id" gorm:"uniqueIndex;not null"`
+	Provider          string  `json:"provider" gorm:"size:30;default:'local'"` // Nhà cung cấp hóa đơn điện tử, local = chỉ lưu trên hệ thống
+	SellerName        string  `json:"seller_name" gorm:"size:255;not null"`    // Tên pháp nhân / hộ kinh doanh trên hóa đơn
+	SellerTaxCode     string  `json:"seller_tax_code" gorm:"size:20"`
+	SellerAddress     string  `json:"seller_address" gorm:"size:500"`
+	SellerPhone       *string `json:"seller_phone" gorm:"size:20"`
+	SellerEmail       *string `json:"seller_email" gorm:"size:255"`
+	SellerBankAccount *string `json:"seller_bank_account" gorm:"size:50"`
+	SellerBankName    *string `json:"seller_bank_name" gorm:"size:255"`
+
+	// Tài khoản nhà cung cấp hóa đơn điện tử (mật khẩu không trả về client)
+	ProviderURL      *string `json:"provider_url" gorm:"size:255"`
+	ProviderUsername *string `json:"provider_username" gorm:"size:100"`
+	ProviderPassword *string `json:"-" gorm:"size:255"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (EInvoiceSetting) TableName() string {
+	return "einvoice_settings"
+}
+
+// InvoiceSeries model - Ký hiệu hóa đơn và dãy số hóa đơn của nhà hàng
+type InvoiceSeries struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	RestaurantID uint      `json:"restaurant_id" gorm:"not null;uniqueIndex:idx_invoice_series"`
+	TemplateCode string    `json:"template_code" gorm:"size:1;not null;default:'1';uniqueIndex:idx_invoice_series"` // Ký hiệu mẫu số: 1 = HĐ GTGT, 2 = HĐ bán hàng
+	Symbol       string    `json:"symbol" gorm:"size:6;not null;uniqueIndex:idx_invoice_series"`                    // Ký hiệu hóa đơn, VD: C26MAA
+	NextNumber   int       `json:"next_number" gorm:"not null;default:1"`
+	IsActive     bool      `json:"is_active" gorm:"default:true;index"` // Mỗi nhà hàng chỉ dùng một dãy tại một thời điểm
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func (InvoiceSeries) TableName() string {
+	return "invoice_series"
+}
+
+// Invoice model - Hóa đơn điện tử của đơn hàng
+type Invoice struct {
+	ID           uint   `json:"id" gorm:"primaryKey"`
+	RestaurantID uint   `json:"restaurant_id" gorm:"not null;index"`
+	OrderID      uint   `json:"order_id" gorm:"not null;index"`
+	Status       string `json:"status" gorm:"size:20;default:'draft';index"` // draft (đã nhận thông tin người mua), issued, cancelled
+
+	// Người mua (nhập khi đặt món hoặc sau khi thanh toán)
+	BuyerName    *string `json:"buyer_name" gorm:"size:255"`    // Họ tên người mua hàng
+	BuyerCompany *string `json:"buyer_company" gorm:"size:255"` // Tên đơn vị
+	BuyerTaxCode *string `json:"buyer_tax_code" gorm:"size:20"`
+	BuyerAddress *string `json:"buyer_address" gorm:"size:500"`
+	BuyerEmail   *string `json:"buyer_email" gorm:"size:255"`
+
+	// Số hóa đơn, cấp khi phát hành
+	SeriesID     *uint      `json:"series_id" gorm:"index"`
+	TemplateCode *string    `json:"template_code" gorm:"size:1"`
+	Symbol       *string    `json:"symbol" gorm:"size:6"`
+	Number       *int       `json:"number"`
+	IssuedAt     *time.Time `json:"issued_at"`
+	IssuedBy     *uint      `json:"issued_by"`
+
+	// Số tiền chốt khi phát hành
+	AmountBeforeTax float64 `json:"amount_before_tax" gorm:"type:decimal(12,0);default:0"`
+	TaxAmount       float64 `json:"tax_amount" gorm:"type:decimal(12,0);default:0"`
+	TotalAmount     float64 `json:"total_amount" gorm:"type:decimal(12,0);default:0"`
+
+	Provider    *string `json:"provider" gorm:"size:30"`
+	ProviderRef *string `json:"provider_ref" gorm:"size:100"`
+	LookupCode  *string `json:"lookup_code" gorm:"size:50"` // Mã tra cứu hóa đơn
+	XML         string  `json:"-" gorm:"column:xml;type:text"`
+
+	CancelReason *string    `json:"cancel_reason" gorm:"size:500"`
+	CancelledAt  *time.Time `json:"cancelled_at"`
+	CancelledBy  *uint      `json:"cancelled_by"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Invoice) TableName() string {
+	return "invoices"
+}
+
+// Printer model - Máy in tại nhà hàng, nhận lệnh in qua print agent chạy trong mạng LAN của nhà hàng
+type Printer struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	RestaurantID  uint      `json:"restaurant_id" gorm:"not null;index"`
+	Name          string    `json:"name" gorm:"size:100;not null"`          // Agent ánh xạ tên (hoặc ID) máy in sang thiết bị thật
+	Role          string    `json:"role" gorm:"size:20;not null"`           // receipt (hóa đơn), kitchen (phiếu bếp)
+	Station       *string   `json:"station" gorm:"size:20"`                 // Máy in phiếu bếp: chỉ in khu vực kitchen / bar / service, NULL = mọi khu vực
+	Format        string    `json:"format" gorm:"size:10;default:'escpos'"` // escpos, pdf
+	Layout        string    `json:"layout" gorm:"size:10;default:'80mm'"`   // a5, 80mm (khổ PDF)
+	Transliterate bool      `json:"transliterate" gorm:"default:false"`     // In chữ không dấu
+	IsActive      bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (Printer) TableName() string {
+	return "printers"
+}
+
+// PrintJob model - Lệnh in trong hàng đợi, print agent lấy về (long-poll), in rồi báo kết quả
+type PrintJob struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	RestaurantID  uint       `json:"restaurant_id" gorm:"not null;index"`
+	PrinterID     uint       `json:"printer_id" gorm:"not null;index"`
+	OrderID       *uint      `json:"order_id" gorm:"index"`
+	Kind          string     `json:"kind" gorm:"size:20;not null"`                  // bill, kitchen_ticket, test
+	Format        string     `json:"format" gorm:"size:10;not null"`                // escpos, pdf
+	Data          []byte     `json:"-" gorm:"type:bytea"`                           // Nội dung đã render sẵn theo cấu hình máy in
+	Status        string     `json:"status" gorm:"size:20;default:'pending';index"` // pending, printing, retrying, printed, failed
+	Attempts      int        `json:"attempts" gorm:"default:0"`
+	NextAttemptAt *time.Time `json:"next_attempt_at" gorm:"index"` // Đang in: hạn giữ lệnh của agent, quá hạn thì agent khác lấy lại
+	ClaimedBy     *uint      `json:"claimed_by"`                   // API key của agent đang / đã in
+	LastError     *string    `json:"last_error" gorm:"type:text"`
+	PrintedAt     *time.Time `json:"printed_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// Relationships
+	Printer *Printer `json:"printer,omitempty" gorm:"foreignKey:PrinterID"`
+	Order   *Order   `json:"order,omitempty" gorm:"foreignKey:OrderID"`
+}
+
+func (PrintJob) TableName() string {
+	return "print_jobs"
+}
@@ -15,9 +15,6 @@ func SetupRoutes(router *gin.Engine) {
 	// API versioning
 	api := router.Group("/api/v1")
 
-	// API Key middleware (tùy chọn - kiểm tra nếu có)
-	api.Use(middleware.OptionalAPIKeyMiddleware())
-
 	{
 		// ================================
 		// Health check
@@ -35,18 +32,48 @@ func SetupRoutes(router *gin.Engine) {
 		// ================================
 		auth := api.Group("/auth")
 		{
-			auth.POST("/login", handlers.Login)
-			auth.POST("/register", handlers.Register)
-			auth.POST("/check-email", handlers.CheckEmail)
+			// Giới hạn theo IP và theo email để chống dò mật khẩu
+			auth.POST("/login",
+				middleware.RateLimit("login_ip", middleware.RateKeyIP),
+				middleware.RateLimit("login_account", middleware.RateKeyJSONField("email")),
+				handlers.Login)
+			auth.POST("/register", middleware.RateLimit("register_ip", middleware.RateKeyIP), handlers.Register)
+			auth.POST("/check-email", middleware.RateLimit("check_email_ip", middleware.RateKeyIP), handlers.CheckEmail)
+			// Đổi refresh token lấy access token mới (access token có thể đã hết hạn)
+			auth.POST("/refresh", middleware.RateLimit("auth_ip", middleware.RateKeyIP), handlers.RefreshToken)
+			auth.POST("/forgot-password",
+				middleware.RateLimit("auth_ip", middleware.RateKeyIP),
+				middleware.RateLimit("auth_email", middleware.RateKeyJSONField("email")),
+				handlers.ForgotPassword)
+			auth.POST("/reset-password", middleware.RateLimit("auth_ip", middleware.RateKeyIP), handlers.ResetPassword)
+			auth.POST("/verify-email", middleware.RateLimit("auth_ip", middleware.RateKeyIP), handlers.VerifyEmail)
+			// Bước 2 đăng nhập (xác thực 2 bước)
+			auth.POST("/mfa/verify", middleware.RateLimit("mfa_ip", middleware.RateKeyIP), handlers.VerifyMFALogin)
+			auth.POST("/mfa/enroll", middleware.RateLimit("mfa_ip", middleware.RateKeyIP), handlers.EnrollMFALogin)
+			auth.POST("/mfa/enroll/confirm", middleware.RateLimit("mfa_ip", middleware.RateKeyIP), handlers.ConfirmMFAEnrollLogin)
 
 			// Protected auth routes
 			authProtected := auth.Group("")
 			authProtected.Use(middleware.AuthMiddleware())
 			{
 				authProtected.POST("/logout", handlers.Logout)
+				authProtected.POST("/logout-all", handlers.LogoutAll)
+				authProtected.GET("/sessions", handlers.GetSessions)
+				authProtected.DELETE("/sessions/:sessionId", handlers.RevokeSession)
 				authProtected.GET("/me", handlers.GetMe)
-				authProtected.POST("/refresh", handlers.RefreshToken)
+				authProtected.POST("/resend-verification", handlers.ResendVerificationEmail)
+				authProtected.POST("/switch-restaurant", handlers.SwitchRestaurant)
+
+				// Xác thực 2 bước (TOTP)
+				authProtected.GET("/mfa", handlers.GetMFAStatus)
+				authProtected.POST("/mfa/setup", handlers.SetupMFA)
+				authProtected.POST("/mfa/enable", handlers.EnableMFA)
+				authProtected.POST("/mfa/disable", handlers.DisableMFA)
+				authProtected.POST("/mfa/recovery-codes", handlers.RegenerateMFARecoveryCodes)
 			}
+
+			// Nhân viên nhận lời mời
+			auth.POST("/staff/accept-invite", middleware.RateLimit("auth_ip", middleware.RateKeyIP), handlers.AcceptStaffInvite)
 		}
 
 		// ================================
@@ -60,6 +87,10 @@ func SetupRoutes(router *gin.Engine) {
 		webhooks := api.Group("/webhooks")
 		{
 			webhooks.POST("/sepay", handlers.HandleSepayWebhook)
+			webhooks.POST("/momo", handlers.HandleMomoIPN)
+			webhooks.GET("/vnpay", handlers.HandleVNPayIPN)
+			// Cổng giả lập, từ chối khi PAYMENT_FAKE_PROVIDER chưa bật
+			webhooks.POST("/fake", handlers.HandleFakePaymentCallback)
 		}
 
 		// ================================
@@ -68,15 +99,17 @@ func SetupRoutes(router *gin.Engine) {
 		payment := api.Group("/payment")
 		{
 			// Đăng ký gói mới + nhận QR thanh toán
-			payment.POST("/subscribe", handlers.CreateSubscription)
-			// Kiểm tra trạng thái đăng ký
-			payment.GET("/subscribe/:code/status", handlers.GetSubscriptionStatus)
+			payment.POST("/subscribe", middleware.RateLimit("register_ip", middleware.RateKeyIP), handlers.CreateSubscription)
+			// Kiểm tra trạng thái đăng ký (frontend polling)
+			payment.GET("/subscribe/:code/status", middleware.RateLimit("payment_poll_ip", middleware.RateKeyIP), handlers.GetSubscriptionStatus)
 			// Lấy lại QR code
-			payment.GET("/subscribe/:code/qr", handlers.GetSubscriptionQR)
+			payment.GET("/subscribe/:code/qr", middleware.RateLimit("payment_qr_ip", middleware.RateKeyIP), handlers.GetSubscriptionQR)
 			// Tạo QR thanh toán đơn hàng
-			payment.POST("/orders/:id/qr", handlers.CreateOrderPaymentQR)
-			// Kiểm tra trạng thái thanh toán đơn hàng
-			payment.GET("/orders/:id/status", handlers.GetOrderPaymentStatus)
+			payment.POST("/orders/:id/qr", middleware.RateLimit("payment_qr_ip", middleware.RateKeyIP), handlers.CreateOrderPaymentQR)
+			// Thanh toán online đơn hàng (qr, momo, vnpay)
+			payment.POST("/orders/:id/pay", middleware.RateLimit("payment_qr_ip", middleware.RateKeyIP), handlers.StartOrderPayment)
+			// Kiểm tra trạng thái thanh toán đơn hàng (frontend polling)
+			payment.GET("/orders/:id/status", middleware.RateLimit("payment_poll_ip", middleware.RateKeyIP), handlers.GetOrderPaymentStatus)
 		}
 
 		// ================================
@@ -92,10 +125,25 @@ func SetupRoutes(router *gin.Engine) {
 			public.GET("/restaurants/:slug/menu-items/:itemId", handlers.GetMenuItemBySlug)
 			// Xem bàn theo slug + số bàn (cho khách quét QR)
 			public.GET("/restaurants/:slug/tables/:tableNumber", handlers.GetTableBySlugAndNumber)
+			// Khách gọi nhân viên / xin thanh toán từ bàn
+			public.POST("/restaurants/:slug/tables/:tableNumber/service-requests", middleware.RateLimit("public_write_ip", middleware.RateKeyIP), handlers.CreateServiceRequest)
+			public.GET("/restaurants/:slug/tables/:tableNumber/service-requests", handlers.GetTableServiceRequests)
 			// Customer tạo đơn hàng
-			public.POST("/restaurants/:slug/orders", handlers.CreateOrder)
+			public.POST("/restaurants/:slug/orders", middleware.RateLimit("order_create_ip", middleware.RateKeyIP), handlers.CreateOrder)
+			// Customer đặt đơn mang về (bắt buộc trả trước)
+			public.POST("/restaurants/:slug/takeaway-orders", middleware.RateLimit("order_create_ip", middleware.RateKeyIP), handlers.CreateTakeawayOrder)
+			// Customer báo giá phí giao & đặt đơn giao hàng
+			public.POST("/restaurants/:slug/delivery/quote", handlers.QuoteDelivery)
+			public.POST("/restaurants/:slug/delivery-orders", middleware.RateLimit("order_create_ip", middleware.RateKeyIP), handlers.CreateDeliveryOrder)
 			// Customer tracking đơn hàng (by order number)
 			public.GET("/orders/:orderNumber/track", handlers.TrackOrder)
+			// Customer đặt bàn trước
+			public.POST("/restaurants/:slug/reservations", middleware.RateLimit("public_write_ip", middleware.RateKeyIP), handlers.CreateReservation)
+			public.GET("/reservations/:code", handlers.GetReservationByCode)
+			public.PUT("/reservations/:code/cancel", handlers.CancelReservationByCode)
+			// Khách vãng lai vào danh sách chờ
+			public.POST("/restaurants/:slug/waitlist", middleware.RateLimit("public_write_ip", middleware.RateKeyIP), handlers.JoinWaitlist)
+			public.GET("/waitlist/:code", handlers.GetWaitlistEntryByCode)
 		}
 
 		// ================================
@@ -111,65 +159,137 @@ func SetupRoutes(router *gin.Engine) {
 
 			// Protected routes
 			restaurantsProtected := restaurants.Group("")
-			restaurantsProtected.Use(middleware.AuthMiddleware())
-			restaurantsProtected.Use(middleware.RestaurantOrAdmin())
+			restaurantsProtected.Use(middleware.AuthOrAPIKeyMiddleware())
+			restaurantsProtected.Use(middleware.RequirePermission())
 			{
 				// Restaurant info
 				restaurantsProtected.GET("/me", handlers.GetMyRestaurant)
-				restaurantsProtected.PUT("/:id", handlers.UpdateRestaurant)
+
+				// Branches (chuỗi nhà hàng)
+				restaurantsProtected.GET("/branches", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.GetBranches)
+				restaurantsProtected.POST("/branches", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.CreateBranch)
+				restaurantsProtected.GET("/branches/dashboard", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.GetBranchesDashboard)
+				restaurantsProtected.PUT("/:id", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.UpdateRestaurant)
 
 				// Tables
-				restaurantsProtected.GET("/:id/tables", handlers.GetTables)
-				restaurantsProtected.POST("/:id/tables", handlers.CreateTable)
+				restaurantsProtected.GET("/:id/tables", middleware.RequirePermission(middleware.PermTablesView), handlers.GetTables)
+				restaurantsProtected.POST("/:id/tables", middleware.RequirePermission(middleware.PermTablesManage), handlers.CreateTable)
+				restaurantsProtected.GET("/:id/tables/qr-sheet.pdf", middleware.RequirePermission(middleware.PermTablesView), handlers.GetTablesQRSheet)
+				restaurantsProtected.PUT("/:id/tables/layout", middleware.RequirePermission(middleware.PermTablesManage), handlers.UpdateTableLayout)
+				restaurantsProtected.GET("/:id/table-zones", middleware.RequirePermission(middleware.PermTablesView), handlers.GetTableZones)
+				restaurantsProtected.POST("/:id/table-zones", middleware.RequirePermission(middleware.PermTablesManage), handlers.CreateTableZone)
 
 				// Categories
-				restaurantsProtected.POST("/:id/categories", handlers.CreateCategory)
+				restaurantsProtected.POST("/:id/categories", middleware.RequirePermission(middleware.PermMenuManage), handlers.CreateCategory)
 
 				// Menu
-				restaurantsProtected.POST("/:id/menu", handlers.CreateMenuItem)
+				restaurantsProtected.POST("/:id/menu", middleware.RequirePermission(middleware.PermMenuManage), handlers.CreateMenuItem)
+				restaurantsProtected.POST("/:id/menu/sync-template", middleware.RequirePermission(middleware.PermMenuManage), handlers.SyncBranchMenu)
 
 				// Orders
-				restaurantsProtected.GET("/:id/orders", handlers.GetOrders)
+				restaurantsProtected.GET("/:id/orders", middleware.RequirePermission(middleware.PermOrdersView), handlers.GetOrders)
+
+				// Reservations & Waitlist
+				restaurantsProtected.GET("/:id/reservations", middleware.RequirePermission(middleware.PermReservationsManage), handlers.GetReservations)
+				restaurantsProtected.GET("/:id/reservations/availability", middleware.RequirePermission(middleware.PermReservationsManage), handlers.CheckReservationAvailability)
+				restaurantsProtected.GET("/:id/waitlist", middleware.RequirePermission(middleware.PermReservationsManage), handlers.GetWaitlist)
+				restaurantsProtected.POST("/:id/waitlist", middleware.RequirePermission(middleware.PermReservationsManage), handlers.AddWaitlistEntry)
 
 				// Payment Settings
-				restaurantsProtected.GET("/:id/payment-settings", handlers.GetPaymentSettings)
-				restaurantsProtected.PUT("/:id/payment-settings", handlers.UpdatePaymentSettings)
+				restaurantsProtected.GET("/:id/payment-settings", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.GetPaymentSettings)
+				restaurantsProtected.PUT("/:id/payment-settings", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.UpdatePaymentSettings)
+
+				// Hóa đơn điện tử
+				restaurantsProtected.GET("/:id/einvoice-settings", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.GetEInvoiceSettings)
+				restaurantsProtected.PUT("/:id/einvoice-settings", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.UpdateEInvoiceSettings)
+				restaurantsProtected.GET("/:id/invoice-series", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.GetInvoiceSeries)
+				restaurantsProtected.POST("/:id/invoice-series", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.CreateInvoiceSeries)
+				restaurantsProtected.GET("/:id/invoices", middleware.RequirePermission(middleware.PermPaymentsConfirm), handlers.GetInvoices)
 
 				// SePay Linking (Restaurant nhận tiền từ khách)
-				restaurantsProtected.POST("/:id/sepay/link", handlers.LinkSepayAccount)
-				restaurantsProtected.GET("/:id/sepay/link/check", handlers.CheckSepayLinkingSession)
-				restaurantsProtected.GET("/:id/sepay/status", handlers.GetSepayStatus)
-				restaurantsProtected.DELETE("/:id/sepay/unlink", handlers.UnlinkSepayAccount)
+				restaurantsProtected.POST("/:id/sepay/link", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.LinkSepayAccount)
+				restaurantsProtected.GET("/:id/sepay/link/check", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.CheckSepayLinkingSession)
+				restaurantsProtected.GET("/:id/sepay/status", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.GetSepayStatus)
+				restaurantsProtected.DELETE("/:id/sepay/unlink", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.UnlinkSepayAccount)
 
 				// Statistics
-				restaurantsProtected.GET("/:id/stats/overview", handlers.GetStatsOverview)
-				restaurantsProtected.GET("/:id/stats/revenue", handlers.GetStatsRevenue)
-				restaurantsProtected.GET("/:id/stats/menu", handlers.GetStatsMenu)
+				restaurantsProtected.GET("/:id/stats/overview", middleware.RequirePermission(middleware.PermStatsView), handlers.GetStatsOverview)
+				restaurantsProtected.GET("/:id/stats/revenue", middleware.RequirePermission(middleware.PermStatsView), handlers.GetStatsRevenue)
+				restaurantsProtected.GET("/:id/stats/menu", middleware.RequirePermission(middleware.PermStatsView), handlers.GetStatsMenu)
+				restaurantsProtected.GET("/:id/stats/service", middleware.RequirePermission(middleware.PermStatsView), handlers.GetStatsService)
+
+				// Sổ cái (kế toán kép)
+				restaurantsProtected.GET("/:id/ledger", middleware.RequirePermission(middleware.PermStatsView), handlers.GetLedgerBalances)
+				restaurantsProtected.GET("/:id/ledger/transactions", middleware.RequirePermission(middleware.PermStatsView), handlers.GetLedgerTransactions)
+				restaurantsProtected.POST("/:id/ledger/adjustments", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.CreateLedgerAdjustment)
+
+				// Ca thu ngân & chốt sổ cuối ngày
+				restaurantsProtected.GET("/:id/cash-shifts", middleware.RequirePermission(middleware.PermCashDrawer), handlers.GetCashShifts)
+				restaurantsProtected.POST("/:id/cash-shifts", middleware.RequirePermission(middleware.PermCashDrawer), handlers.OpenCashShift)
+				restaurantsProtected.GET("/:id/cash-shifts/current", middleware.RequirePermission(middleware.PermCashDrawer), handlers.GetCurrentCashShift)
+				restaurantsProtected.GET("/:id/z-report", middleware.RequirePermission(middleware.PermStatsView), handlers.GetZReport)
+				restaurantsProtected.POST("/:id/z-report/close", middleware.RequirePermission(middleware.PermDayClose), handlers.CloseBusinessDay)
+				restaurantsProtected.GET("/:id/daily-closings", middleware.RequirePermission(middleware.PermStatsView), handlers.GetDailyClosings)
+
+				// Đối soát chuyển khoản không khớp mã
+				restaurantsProtected.GET("/:id/unmatched-transactions", middleware.RequirePermission(middleware.PermPaymentsConfirm), handlers.GetUnmatchedTransactions)
+				restaurantsProtected.GET("/:id/unmatched-transactions/:transactionId/suggestions", middleware.RequirePermission(middleware.PermPaymentsConfirm), handlers.GetTransactionSuggestions)
+				restaurantsProtected.POST("/:id/unmatched-transactions/:transactionId/assign", middleware.RequirePermission(middleware.PermPaymentsConfirm), handlers.AssignTransaction)
+				restaurantsProtected.POST("/:id/unmatched-transactions/:transactionId/ignore", middleware.RequirePermission(middleware.PermPaymentsConfirm), handlers.IgnoreTransaction)
+
+				// Delivery Zones
+				restaurantsProtected.GET("/:id/delivery-zones", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.GetDeliveryZones)
+				restaurantsProtected.POST("/:id/delivery-zones", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.CreateDeliveryZone)
+
+				// Service Requests & realtime events
+				restaurantsProtected.GET("/:id/service-requests", middleware.RequirePermission(middleware.PermServiceRequests), handlers.GetServiceRequests)
+				restaurantsProtected.GET("/:id/events", middleware.RequirePermission(middleware.PermOrdersView), handlers.StreamRestaurantEvents)
 
 				// Notifications
-				restaurantsProtected.GET("/:id/notifications", handlers.GetNotifications)
-				restaurantsProtected.GET("/:id/notifications/unread-count", handlers.GetUnreadNotificationCount)
+				restaurantsProtected.GET("/:id/notifications", middleware.RequirePermission(middleware.PermNotificationsView), handlers.GetNotifications)
+				restaurantsProtected.GET("/:id/notifications/unread-count", middleware.RequirePermission(middleware.PermNotificationsView), handlers.GetUnreadNotificationCount)
 
 				// Package Upgrade
-				restaurantsProtected.POST("/:id/upgrade", handlers.CreateUpgradeSubscription)
+				restaurantsProtected.POST("/:id/upgrade", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.CreateUpgradeSubscription)
+
+				// Staff
+				restaurantsProtected.GET("/:id/staff", middleware.RequirePermission(middleware.PermStaffManage), handlers.GetStaff)
+				restaurantsProtected.POST("/:id/staff/invite", middleware.RequirePermission(middleware.PermStaffManage), handlers.InviteStaff)
+
+				// API key cho POS / tích hợp
+				restaurantsProtected.GET("/:id/api-keys", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.GetAPIKeys)
+				restaurantsProtected.POST("/:id/api-keys", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.CreateAPIKey)
+
+				// Webhook gửi sự kiện tới hệ thống của nhà hàng
+				restaurantsProtected.GET("/:id/webhooks", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.GetWebhooks)
+				restaurantsProtected.POST("/:id/webhooks", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.CreateWebhook)
+				restaurantsProtected.GET("/:id/webhook-deliveries", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.GetWebhookDeliveries)
+
+				// Máy in và hàng đợi lệnh in (print agent)
+				restaurantsProtected.GET("/:id/printers", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.GetPrinters)
+				restaurantsProtected.POST("/:id/printers", middleware.RequirePermission(middleware.PermRestaurantSettings), handlers.CreatePrinter)
+				restaurantsProtected.GET("/:id/print-jobs", middleware.RequirePermission(middleware.PermOrdersView), handlers.GetPrintJobs)
 			}
 		}
 
 		// ================================
 		// UPGRADE STATUS - Public (check payment status)
 		// ================================
-		api.GET("/upgrade/:code/status", handlers.GetUpgradeStatus)
+		api.GET("/upgrade/:code/status", middleware.RateLimit("payment_poll_ip", middleware.RateKeyIP), handlers.GetUpgradeStatus)
 
 		// ================================
 		// TABLES - Protected
 		// ================================
 		tables := api.Group("/tables")
-		tables.Use(middleware.AuthMiddleware())
-		tables.Use(middleware.RestaurantOrAdmin())
+		tables.Use(middleware.AuthOrAPIKeyMiddleware())
+		tables.Use(middleware.RequirePermission())
 		{
-			tables.GET("/:id/detail", handlers.GetTableDetail)
-			tables.PUT("/:id", handlers.UpdateTable)
-			tables.DELETE("/:id", handlers.DeleteTable)
+			tables.GET("/:id/detail", middleware.RequirePermission(middleware.PermTablesView), handlers.GetTableDetail)
+			tables.GET("/:id/qr.png", middleware.RequirePermission(middleware.PermTablesView), handlers.GetTableQRPNG)
+			tables.GET("/:id/qr.svg", middleware.RequirePermission(middleware.PermTablesView), handlers.GetTableQRSVG)
+			tables.PUT("/:id/qr-token/rotate", middleware.RequirePermission(middleware.PermTablesManage), handlers.RotateTableQRToken)
+			tables.PUT("/:id", middleware.RequirePermission(middleware.PermTablesStatus), handlers.UpdateTable)
+			tables.DELETE("/:id", middleware.RequirePermission(middleware.PermTablesManage), handlers.DeleteTable)
 		}
 
 		// ================================
@@ -182,8 +302,8 @@ func SetupRoutes(router *gin.Engine) {
 
 			// Protected
 			categoriesProtected := categories.Group("")
-			categoriesProtected.Use(middleware.AuthMiddleware())
-			categoriesProtected.Use(middleware.RestaurantOrAdmin())
+			categoriesProtected.Use(middleware.AuthOrAPIKeyMiddleware())
+			categoriesProtected.Use(middleware.RequirePermission(middleware.PermMenuManage))
 			{
 				categoriesProtected.PUT("/:id", handlers.UpdateCategory)
 				categoriesProtected.DELETE("/:id", handlers.DeleteCategory)
@@ -194,8 +314,8 @@ func SetupRoutes(router *gin.Engine) {
 		// MENU - Protected
 		// ================================
 		menu := api.Group("/menu")
-		menu.Use(middleware.AuthMiddleware())
-		menu.Use(middleware.RestaurantOrAdmin())
+		menu.Use(middleware.AuthOrAPIKeyMiddleware())
+		menu.Use(middleware.RequirePermission(middleware.PermMenuManage))
 		{
 			menu.PUT("/:id", handlers.UpdateMenuItem)
 			menu.DELETE("/:id", handlers.DeleteMenuItem)
@@ -217,23 +337,198 @@ func SetupRoutes(router *gin.Engine) {
 
 			// Protected
 			ordersProtected := orders.Group("")
-			ordersProtected.Use(middleware.AuthMiddleware())
-			ordersProtected.Use(middleware.RestaurantOrAdmin())
+			ordersProtected.Use(middleware.AuthOrAPIKeyMiddleware())
+			ordersProtected.Use(middleware.RequirePermission())
 			{
-				ordersProtected.PUT("/:id/status", handlers.UpdateOrderStatus)
-				ordersProtected.PUT("/:id/pay", handlers.PayOrder)
-				ordersProtected.GET("/:id/bill", handlers.GetOrderBill)
+				ordersProtected.PUT("/:id/status", middleware.RequirePermission(middleware.PermOrdersManage), handlers.UpdateOrderStatus)
+				ordersProtected.PUT("/:id/pay", middleware.RequirePermission(middleware.PermPaymentsConfirm), handlers.PayOrder)
+				ordersProtected.GET("/:id/bill", middleware.RequirePermission(middleware.PermOrdersView), handlers.GetOrderBill)
+				// In hóa đơn / phiếu bếp (PDF, ESC/POS máy in nhiệt)
+				ordersProtected.GET("/:id/bill.pdf", middleware.RequirePermission(middleware.PermOrdersView), handlers.GetOrderBillPDF)
+				ordersProtected.GET("/:id/bill.escpos", middleware.RequirePermission(middleware.PermOrdersView), handlers.GetOrderBillESCPOS)
+				ordersProtected.GET("/:id/kitchen-tickets.pdf", middleware.RequirePermission(middleware.PermOrdersView), handlers.GetKitchenTicketsPDF)
+				ordersProtected.GET("/:id/kitchen-tickets.escpos", middleware.RequirePermission(middleware.PermOrdersView), handlers.GetKitchenTicketsESCPOS)
+				ordersProtected.POST("/:id/print", middleware.RequirePermission(middleware.PermOrdersView), handlers.PrintOrder)
 				// Xác nhận đã thanh toán (nhà hàng bấm xác nhận)
-				ordersProtected.PUT("/:id/confirm-payment", handlers.ConfirmOrderPayment)
+				ordersProtected.PUT("/:id/confirm-payment", middleware.RequirePermission(middleware.PermPaymentsConfirm), handlers.ConfirmOrderPayment)
+				ordersProtected.POST("/:id/refund", middleware.RequirePermission(middleware.PermPaymentsRefund), handlers.RefundOrder)
+				ordersProtected.GET("/:id/payments", middleware.RequirePermission(middleware.PermOrdersView), handlers.GetOrderPayments)
+				// Hóa đơn điện tử
+				ordersProtected.GET("/:id/invoice", middleware.RequirePermission(middleware.PermOrdersView), handlers.GetOrderInvoice)
+				ordersProtected.POST("/:id/invoice", middleware.RequirePermission(middleware.PermPaymentsConfirm), handlers.IssueOrderInvoice)
+				ordersProtected.PUT("/:id/invoice/buyer", middleware.RequirePermission(middleware.PermPaymentsConfirm), handlers.UpdateOrderInvoiceBuyer)
+				// Chuyển bàn / tách món / gộp đơn
+				ordersProtected.PUT("/:id/transfer", middleware.RequirePermission(middleware.PermOrdersManage), handlers.TransferOrder)
+				ordersProtected.POST("/:id/merge", middleware.RequirePermission(middleware.PermOrdersManage), handlers.MergeOrders)
+				ordersProtected.GET("/:id/moves", middleware.RequirePermission(middleware.PermOrdersView), handlers.GetOrderMoves)
+				// Sửa / hủy từng món
+				ordersProtected.PUT("/:id/items/:itemId", middleware.RequirePermission(middleware.PermOrdersManage), handlers.UpdateOrderItem)
+				ordersProtected.PUT("/:id/items/:itemId/cancel", middleware.RequirePermission(middleware.PermOrdersManage), handlers.CancelOrderItem)
+				ordersProtected.GET("/:id/item-changes", middleware.RequirePermission(middleware.PermOrdersView), handlers.GetOrderItemChanges)
+				// Bếp / bar cập nhật trạng thái chế biến món
+				ordersProtected.PUT("/:id/items/:itemId/prep-status", middleware.RequirePermission(middleware.PermKitchenPrep), handlers.UpdateOrderItemPrepStatus)
 			}
 		}
 
+		// ================================
+		// RESERVATIONS - Protected
+		// ================================
+		reservations := api.Group("/reservations")
+		reservations.Use(middleware.AuthOrAPIKeyMiddleware())
+		reservations.Use(middleware.RequirePermission(middleware.PermReservationsManage))
+		{
+			reservations.PUT("/:id/confirm", handlers.ConfirmReservation)
+			reservations.PUT("/:id/status", handlers.UpdateReservationStatus)
+		}
+
+		// ================================
+		// WAITLIST - Protected
+		// ================================
+		waitlist := api.Group("/waitlist")
+		waitlist.Use(middleware.AuthOrAPIKeyMiddleware())
+		waitlist.Use(middleware.RequirePermission(middleware.PermReservationsManage))
+		{
+			waitlist.PUT("/:id/status", handlers.UpdateWaitlistStatus)
+		}
+
+		// ================================
+		// SERVICE REQUESTS - Protected
+		// ================================
+		serviceRequests := api.Group("/service-requests")
+		serviceRequests.Use(middleware.AuthOrAPIKeyMiddleware())
+		serviceRequests.Use(middleware.RequirePermission(middleware.PermServiceRequests))
+		{
+			serviceRequests.PUT("/:id/acknowledge", handlers.AcknowledgeServiceRequest)
+			serviceRequests.PUT("/:id/resolve", handlers.ResolveServiceRequest)
+		}
+
+		// ================================
+		// TABLE ZONES - Protected
+		// ================================
+		tableZones := api.Group("/table-zones")
+		tableZones.Use(middleware.AuthOrAPIKeyMiddleware())
+		tableZones.Use(middleware.RequirePermission(middleware.PermTablesManage))
+		{
+			tableZones.PUT("/:id", handlers.UpdateTableZone)
+			tableZones.DELETE("/:id", handlers.DeleteTableZone)
+		}
+
+		// ================================
+		// DELIVERY ZONES - Protected
+		// ================================
+		deliveryZones := api.Group("/delivery-zones")
+		deliveryZones.Use(middleware.AuthOrAPIKeyMiddleware())
+		deliveryZones.Use(middleware.RequirePermission(middleware.PermRestaurantSettings))
+		{
+			deliveryZones.PUT("/:id", handlers.UpdateDeliveryZone)
+			deliveryZones.DELETE("/:id", handlers.DeleteDeliveryZone)
+		}
+
+		// ================================
+		// STAFF - Protected (chủ nhà hàng quản lý nhân viên)
+		// ================================
+		staff := api.Group("/staff")
+		staff.Use(middleware.AuthMiddleware())
+		staff.Use(middleware.RequirePermission(middleware.PermStaffManage))
+		{
+			staff.PUT("/:id", handlers.UpdateStaff)
+			staff.PUT("/:id/disable", handlers.DisableStaff)
+			staff.PUT("/:id/enable", handlers.EnableStaff)
+			staff.POST("/:id/resend-invite", handlers.ResendStaffInvite)
+			staff.POST("/:id/revoke-sessions", handlers.RevokeStaffSessions)
+		}
+
+		// ================================
+		// API KEYS - Protected (chỉ đăng nhập bằng tài khoản, không dùng API key)
+		// ================================
+		apiKeys := api.Group("/api-keys")
+		apiKeys.Use(middleware.AuthMiddleware())
+		apiKeys.Use(middleware.RequirePermission(middleware.PermRestaurantSettings))
+		{
+			apiKeys.DELETE("/:id", handlers.RevokeAPIKey)
+		}
+
+		// ================================
+		// WEBHOOK ENDPOINTS - Protected (webhook gửi đi của nhà hàng)
+		// ================================
+		webhookEndpoints := api.Group("/webhook-endpoints")
+		webhookEndpoints.Use(middleware.AuthMiddleware())
+		webhookEndpoints.Use(middleware.RequirePermission(middleware.PermRestaurantSettings))
+		{
+			webhookEndpoints.PUT("/:id", handlers.UpdateWebhook)
+			webhookEndpoints.DELETE("/:id", handlers.DeleteWebhook)
+			webhookEndpoints.POST("/:id/rotate-secret", handlers.RotateWebhookSecret)
+			webhookEndpoints.POST("/:id/ping", handlers.PingWebhook)
+		}
+
+		webhookDeliveries := api.Group("/webhook-deliveries")
+		webhookDeliveries.Use(middleware.AuthMiddleware())
+		webhookDeliveries.Use(middleware.RequirePermission(middleware.PermRestaurantSettings))
+		{
+			webhookDeliveries.GET("/:id", handlers.GetWebhookDelivery)
+			webhookDeliveries.POST("/:id/redeliver", handlers.RedeliverWebhook)
+		}
+
+		// ================================
+		// PRINTERS - Protected (máy in và lệnh in)
+		// ================================
+		printers := api.Group("/printers")
+		printers.Use(middleware.AuthMiddleware())
+		printers.Use(middleware.RequirePermission(middleware.PermRestaurantSettings))
+		{
+			printers.PUT("/:id", handlers.UpdatePrinter)
+			printers.DELETE("/:id", handlers.DeletePrinter)
+			printers.POST("/:id/test", handlers.TestPrinter)
+		}
+
+		printJobs := api.Group("/print-jobs")
+		printJobs.Use(middleware.AuthOrAPIKeyMiddleware())
+		printJobs.Use(middleware.RequirePermission(middleware.PermOrdersManage))
+		{
+			printJobs.POST("/:id/retry", handlers.RetryPrintJob)
+		}
+
+		// ================================
+		// PRINT AGENT - API key scope print.agent (agent in tại nhà hàng)
+		// ================================
+		printAgent := api.Group("/print-agent")
+		printAgent.Use(middleware.AuthOrAPIKeyMiddleware())
+		printAgent.Use(middleware.RequirePermission(middleware.PermPrintAgent))
+		{
+			printAgent.GET("/printers", handlers.GetAgentPrinters)
+			printAgent.GET("/jobs", handlers.PollPrintJobs)
+			printAgent.POST("/jobs/:id/ack", handlers.AckPrintJob)
+		}
+
+		// ================================
+		// CASH SHIFTS - Protected (ca thu ngân)
+		// ================================
+		cashShifts := api.Group("/cash-shifts")
+		cashShifts.Use(middleware.AuthMiddleware())
+		cashShifts.Use(middleware.RequirePermission(middleware.PermCashDrawer))
+		{
+			cashShifts.GET("/:id", handlers.GetCashShift)
+			cashShifts.POST("/:id/movements", handlers.AddCashMovement)
+			cashShifts.POST("/:id/close", handlers.CloseCashShift)
+		}
+
+		// ================================
+		// INVOICES - Protected (hóa đơn điện tử)
+		// ================================
+		invoices := api.Group("/invoices")
+		invoices.Use(middleware.AuthOrAPIKeyMiddleware())
+		invoices.Use(middleware.RequirePermission())
+		{
+			invoices.GET("/:id/xml", middleware.RequirePermission(middleware.PermPaymentsConfirm), handlers.GetInvoiceXML)
+			invoices.POST("/:id/cancel", middleware.RequirePermission(middleware.PermPaymentsRefund), handlers.CancelInvoice)
+		}
+
 		// ================================
 		// NOTIFICATIONS - Protected
 		// ================================
 		notifications := api.Group("/notifications")
-		notifications.Use(middleware.AuthMiddleware())
-		notifications.Use(middleware.RestaurantOrAdmin())
+		notifications.Use(middleware.AuthOrAPIKeyMiddleware())
+		notifications.Use(middleware.RequirePermission(middleware.PermNotificationsView))
 		{
 			notifications.PUT("/:id/read", handlers.MarkNotificationRead)
 			notifications.PUT("/read-all", handlers.MarkAllNotificationsRead)
@@ -244,7 +539,7 @@ func SetupRoutes(router *gin.Engine) {
 		// ================================
 		// CONTACT - Public
 		// ================================
-		api.POST("/contact", handlers.CreateContactMessage)
+		api.POST("/contact", middleware.RateLimit("contact_ip", middleware.RateKeyIP), handlers.CreateContactMessage)
 
 		// ================================
 		// ADMIN - Admin only
@@ -269,6 +564,12 @@ func SetupRoutes(router *gin.Engine) {
 			admin.GET("/contacts", handlers.GetContactMessages)
 			admin.PUT("/contacts/:id", handlers.UpdateContactMessageStatus)
 			admin.DELETE("/contacts/:id", handlers.DeleteContactMessage)
+
+			// Đối soát chuyển khoản không khớp mã (kể cả tài khoản nền tảng)
+			admin.GET("/unmatched-transactions", handlers.GetUnmatchedTransactions)
+			admin.GET("/unmatched-transactions/:transactionId/suggestions", handlers.GetTransactionSuggestions)
+			admin.POST("/unmatched-transactions/:transactionId/assign", handlers.AssignTransaction)
+			admin.POST("/unmatched-transactions/:transactionId/ignore", handlers.IgnoreTransaction)
 		}
 
 		// ================================
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"time"
+
+	"go-api/config"
+	"go-api/models"
+
+	"gorm.io/gorm"
+)
+
+// ===============================
+// ACCOUNT EMAILS (đặt lại mật khẩu, xác thực email)
+// ===============================
+
+// Thời hạn link trong email
+const (
+	PasswordResetTTL = time.Hour
+	EmailVerifyTTL   = 24 * time.Hour
+)
+
+// SendPasswordResetEmail tạo token đặt lại mật khẩu và gửi link qua email
+func SendPasswordResetEmail(db *gorm.DB, user models.User, locale string) error {
+	raw, err := IssueUserToken(db, user.ID, UserTokenPasswordReset, PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	msg, err := RenderMail(MailTemplatePasswordReset, locale, user.Email, user.Name, MailTemplateData{
+		Name:      user.Name,
+		ActionURL: config.FrontendBaseURL() + "/reset-password?token=" + raw,
+		ExpiresIn: FormatMailDuration(int(PasswordResetTTL.Minutes()), locale),
+	})
+	if err != nil {
+		return err
+	}
+
+	SendMailAsync(msg)
+	return nil
+}
+
+// SendVerificationEmail tạo token xác thực email và gửi link cho user
+func SendVerificationEmail(db *gorm.DB, user models.User, locale string) error {
+	raw, err := IssueUserToken(db, user.ID, UserTokenEmailVerify, EmailVerifyTTL)
+	if err != nil {
+		return err
+	}
+
+	msg, err := RenderMail(MailTemplateEmailVerify, locale, user.Email, user.Name, MailTemplateData{
+		Name:      user.Name,
+		ActionURL: config.FrontendBaseURL() + "/verify-email?token=" + raw,
+		ExpiresIn: FormatMailDuration(int(EmailVerifyTTL.Minutes()), locale),
+	})
+	if err != nil {
+		return err
+	}
+
+	SendMailAsync(msg)
+	return nil
+}
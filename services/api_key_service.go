@@ -0,0 +1,82 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-api/models"
+
+	"gorm.io/gorm"
+)
+
+// ===============================
+// API KEY SERVICE
+// ===============================
+
+// APIKeyPrefix tiền tố nhận diện API key nhà hàng (phân biệt với JWT)
+const APIKeyPrefix = "rk_"
+
+// apiKeyTouchInterval chỉ ghi last_used_at tối đa mỗi phút một lần (tránh ghi DB mỗi request)
+const apiKeyTouchInterval = time.Minute
+
+// IsRestaurantAPIKey kiểm tra chuỗi có phải API key nhà hàng không
+func IsRestaurantAPIKey(raw string) bool {
+	return strings.HasPrefix(raw, APIKeyPrefix)
+}
+
+// GenerateAPIKey tạo API key mới, trả về key gốc (chỉ hiển thị một lần), prefix hiển thị và hash lưu DB
+func GenerateAPIKey() (raw, prefix, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+	raw = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	prefix = raw[:len(APIKeyPrefix)+8]
+	return raw, prefix, hashUserToken(raw), nil
+}
+
+// AuthenticateAPIKey tìm API key còn hiệu lực theo key gốc
+func AuthenticateAPIKey(db *gorm.DB, raw string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := db.Preload("Restaurant").Where("key_hash = ?", hashUserToken(raw)).First(&key).Error; err != nil {
+		return nil, fmt.Errorf("INVALID_API_KEY: API key không hợp lệ")
+	}
+	if key.RevokedAt != nil {
+		return nil, fmt.Errorf("API_KEY_REVOKED: API key đã bị thu hồi")
+	}
+	if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+		return nil, fmt.Errorf("API_KEY_EXPIRED: API key đã hết hạn")
+	}
+	if key.Restaurant == nil || key.Restaurant.Status != "active" {
+		return nil, fmt.Errorf("RESTAURANT_INACTIVE: nhà hàng không còn hoạt động")
+	}
+	return &key, nil
+}
+
+// TouchAPIKey cập nhật thời điểm và IP dùng gần nhất
+func TouchAPIKey(db *gorm.DB, key *models.APIKey, ip string) {
+	now := time.Now()
+	if key.LastUsedAt != nil && now.Sub(*key.LastUsedAt) < apiKeyTouchInterval {
+		return
+	}
+	db.Model(&models.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", key.ID, now.Add(-apiKeyTouchInterval)).
+		Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": ip,
+		})
+}
+
+// APIKeyScopes tách danh sách scope lưu trong DB
+func APIKeyScopes(key models.APIKey) []string {
+	scopes := []string{}
+	for _, s := range strings.Split(key.Scopes, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
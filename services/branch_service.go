@@ -0,0 +1,126 @@
+package services
+
+import (
+	"go-api/models"
+
+	"gorm.io/gorm"
+)
+
+// ===============================
+// BRANCH SERVICE
+// ===============================
+
+// MenuSyncResult kết quả đồng bộ thực đơn từ nhà hàng chính xuống chi nhánh
+type MenuSyncResult struct {
+	CategoriesCreated int `json:"categories_created"`
+	CategoriesUpdated int `json:"categories_updated"`
+	ItemsCreated      int `json:"items_created"`
+	ItemsUpdated      int `json:"items_updated"`
+}
+
+// SyncBranchMenu đồng bộ danh mục & món từ nhà hàng chính (template) xuống chi nhánh.
+// Món mới được tạo với giá gốc; món đã có chỉ cập nhật tên, mô tả, ảnh, tùy chọn —
+// giá bán và trạng thái còn / hết món do chi nhánh tự quản lý.
+func SyncBranchMenu(tx *gorm.DB, templateID, branchID uint) (MenuSyncResult, error) {
+	var result MenuSyncResult
+
+	var templateCategories []models.Category
+	if err := tx.Where("restaurant_id = ?", templateID).Order("sort_order ASC, id ASC").Find(&templateCategories).Error; err != nil {
+		return result, err
+	}
+
+	// Danh mục gốc -> danh mục của chi nhánh
+	categoryMap := make(map[uint]uint, len(templateCategories))
+	for _, tc := range templateCategories {
+		templateCategoryID := tc.ID
+
+		var branchCategory models.Category
+		err := tx.Where("restaurant_id = ? AND template_id = ?", branchID, templateCategoryID).First(&branchCategory).Error
+		switch err {
+		case nil:
+			if err := tx.Model(&branchCategory).Updates(map[string]interface{}{
+				"name":        tc.Name,
+				"description": tc.Description,
+				"image":       tc.Image,
+				"sort_order":  tc.SortOrder,
+			}).Error; err != nil {
+				return result, err
+			}
+			result.CategoriesUpdated++
+		case gorm.ErrRecordNotFound:
+			branchCategory = models.Category{
+				RestaurantID: branchID,
+				TemplateID:   &templateCategoryID,
+				Name:         tc.Name,
+				Description:  tc.Description,
+				Image:        tc.Image,
+				SortOrder:    tc.SortOrder,
+				Status:       tc.Status,
+			}
+			if err := tx.Create(&branchCategory).Error; err != nil {
+				return result, err
+			}
+			result.CategoriesCreated++
+		default:
+			return result, err
+		}
+		categoryMap[tc.ID] = branchCategory.ID
+	}
+
+	var templateItems []models.MenuItem
+	if err := tx.Where("restaurant_id = ?", templateID).Order("sort_order ASC, id ASC").Find(&templateItems).Error; err != nil {
+		return result, err
+	}
+
+	for _, ti := range templateItems {
+		templateItemID := ti.ID
+		branchCategoryID, ok := categoryMap[ti.CategoryID]
+		if !ok {
+			continue
+		}
+
+		var branchItem models.MenuItem
+		err := tx.Where("restaurant_id = ? AND template_id = ?", branchID, templateItemID).First(&branchItem).Error
+		switch err {
+		case nil:
+			if err := tx.Model(&branchItem).Updates(map[string]interface{}{
+				"category_id":   branchCategoryID,
+				"name":          ti.Name,
+				"description":   ti.Description,
+				"image":         ti.Image,
+				"options":       ti.Options,
+				"tags":          ti.Tags,
+				"prep_location": ti.PrepLocation,
+				"prep_time":     ti.PrepTime,
+				"sort_order":    ti.SortOrder,
+			}).Error; err != nil {
+				return result, err
+			}
+			result.ItemsUpdated++
+		case gorm.ErrRecordNotFound:
+			branchItem = models.MenuItem{
+				RestaurantID: branchID,
+				CategoryID:   branchCategoryID,
+				TemplateID:   &templateItemID,
+				Name:         ti.Name,
+				Description:  ti.Description,
+				Price:        ti.Price,
+				Image:        ti.Image,
+				Options:      ti.Options,
+				Tags:         ti.Tags,
+				PrepLocation: ti.PrepLocation,
+				PrepTime:     ti.PrepTime,
+				SortOrder:    ti.SortOrder,
+				Status:       ti.Status,
+			}
+			if err := tx.Create(&branchItem).Error; err != nil {
+				return result, err
+			}
+			result.ItemsCreated++
+		default:
+			return result, err
+		}
+	}
+
+	return result, nil
+}
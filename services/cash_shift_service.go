@@ -0,0 +1,522 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"go-api/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ===============================
+// CASH SHIFTS
+// ===============================
+
+// Trạng thái ca thu ngân
+const (
+	CashShiftOpen   = "open"
+	CashShiftClosed = "closed"
+)
+
+// Loại nộp / rút tiền két
+const (
+	CashMovementIn  = "in"
+	CashMovementOut = "out"
+)
+
+// CashShiftSummary tiền mặt dự kiến trong két của một ca
+type CashShiftSummary struct {
+	OpeningFloat float64 `json:"opening_float"`
+	CashSales    float64 `json:"cash_sales"`
+	CashOrders   int64   `json:"cash_orders"`
+	CashRefunds  float64 `json:"cash_refunds"`
+	CashIn       float64 `json:"cash_in"`
+	CashOut      float64 `json:"cash_out"`
+	Expected     float64 `json:"expected"` // Tiền đầu ca + bán tiền mặt - hoàn tiền mặt + nộp - rút
+}
+
+// OpenCashShift mở ca thu ngân với tiền đầu ca; mỗi thu ngân chỉ có một ca đang mở tại mỗi nhà hàng
+func OpenCashShift(db *gorm.DB, restaurantID, cashierID uint, openingFloat float64, notes string) (*models.CashShift, error) {
+	now := time.Now()
+	if err := EnsureDayOpen(db, restaurantID, now); err != nil {
+		return nil, err
+	}
+
+	shift := models.CashShift{
+		RestaurantID: restaurantID,
+		CashierID:    cashierID,
+		Status:       CashShiftOpen,
+		OpeningFloat: math.Round(openingFloat),
+		OpenedAt:     now,
+	}
+	if notes != "" {
+		shift.Notes = &notes
+	}
+
+	var current *models.CashShift
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Khóa thu ngân: hai yêu cầu mở ca đồng thời chạy tuần tự, yêu cầu sau thấy ca vừa mở
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.User{}, cashierID).Error; err != nil {
+			return err
+		}
+		var err error
+		if current, err = CurrentCashShift(tx, restaurantID, cashierID); err != nil {
+			return err
+		}
+		if current != nil {
+			return fmt.Errorf("SHIFT_ALREADY_OPEN: bạn đang có ca thu ngân chưa đóng")
+		}
+		return tx.Create(&shift).Error
+	})
+	if err != nil {
+		return current, err
+	}
+	return &shift, nil
+}
+
+// CurrentCashShift ca đang mở của thu ngân tại nhà hàng (nil nếu không có)
+func CurrentCashShift(db *gorm.DB, restaurantID, cashierID uint) (*models.CashShift, error) {
+	var shift models.CashShift
+	err := db.Where("restaurant_id = ? AND cashier_id = ? AND status = ?", restaurantID, cashierID, CashShiftOpen).
+		Order("opened_at DESC").
+		First(&shift).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &shift, nil
+}
+
+// AssignCashShift gắn đơn thu tiền mặt vào ca đang mở của người thu tiền (không có ca thì bỏ qua)
+func AssignCashShift(db *gorm.DB, order *models.Order, userID uint) error {
+	if order.PaymentMethod != nil && *order.PaymentMethod != "cash" {
+		return nil
+	}
+	shift, err := CurrentCashShift(db, order.RestaurantID, userID)
+	if err != nil || shift == nil {
+		return err
+	}
+	if err := db.Model(&models.Order{}).Where("id = ?", order.ID).Update("cash_shift_id", shift.ID).Error; err != nil {
+		return err
+	}
+	order.CashShiftID = &shift.ID
+	return nil
+}
+
+// AddCashMovement nộp thêm / rút tiền khỏi két trong ca
+func AddCashMovement(db *gorm.DB, shift *models.CashShift, movementType string, amount float64, reason string, userID uint) (*models.CashMovement, error) {
+	if shift.Status != CashShiftOpen {
+		return nil, fmt.Errorf("SHIFT_CLOSED: ca thu ngân đã đóng")
+	}
+	if movementType != CashMovementIn && movementType != CashMovementOut {
+		return nil, fmt.Errorf("INVALID_TYPE: loại phải là in hoặc out")
+	}
+	amount = math.Round(amount)
+	if amount <= 0 {
+		return nil, fmt.Errorf("INVALID_AMOUNT: số tiền phải lớn hơn 0")
+	}
+	if err := EnsureDayOpen(db, shift.RestaurantID, time.Now()); err != nil {
+		return nil, err
+	}
+
+	movement := models.CashMovement{
+		ShiftID:      shift.ID,
+		RestaurantID: shift.RestaurantID,
+		Type:         movementType,
+		Amount:       amount,
+		Reason:       reason,
+		CreatedBy:    userID,
+	}
+	if err := db.Create(&movement).Error; err != nil {
+		return nil, err
+	}
+	return &movement, nil
+}
+
+// ComputeCashShiftSummary tính tiền mặt dự kiến của ca từ đơn, hoàn tiền và nộp / rút tiền gắn với ca.
+// Tiền bán lấy từ sổ cái (Nợ tiền mặt lúc thu) chứ không từ tổng tiền hiện tại của đơn, vốn có thể đổi sau khi thu
+func ComputeCashShiftSummary(db *gorm.DB, shift models.CashShift) CashShiftSummary {
+	summary := CashShiftSummary{OpeningFloat: shift.OpeningFloat}
+
+	shiftOrders := db.Model(&models.Order{}).
+		Select("id").
+		Where("cash_shift_id = ? AND payment_status IN ?", shift.ID, []string{"paid", "refunded"})
+	db.Model(&models.Order{}).
+		Where("cash_shift_id = ? AND payment_status IN ?", shift.ID, []string{"paid", "refunded"}).
+		Count(&summary.CashOrders)
+
+	// Hoàn tiền mặt ghi Có tiền mặt, được tính riêng ở CashRefunds
+	db.Model(&models.LedgerEntry{}).
+		Joins("JOIN ledger_transactions ON ledger_transactions.id = ledger_entries.transaction_id").
+		Joins("JOIN ledger_accounts ON ledger_accounts.id = ledger_entries.account_id").
+		Where("ledger_entries.restaurant_id = ? AND ledger_accounts.code = ?", shift.RestaurantID, LedgerCash).
+		Where("ledger_transactions.reference_type = ? AND ledger_transactions.reference_id IN (?)", "order", shiftOrders).
+		Select("COALESCE(SUM(ledger_entries.debit), 0)").
+		Scan(&summary.CashSales)
+
+	db.Model(&models.PaymentRefund{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("cash_shift_id = ? AND status <> ?", shift.ID, RefundFailed).
+		Scan(&summary.CashRefunds)
+
+	var movements []struct {
+		Type   string
+		Amount float64
+	}
+	db.Model(&models.CashMovement{}).
+		Select("type, COALESCE(SUM(amount), 0) as amount").
+		Where("shift_id = ?", shift.ID).
+		Group("type").
+		Scan(&movements)
+	for _, m := range movements {
+		switch m.Type {
+		case CashMovementIn:
+			summary.CashIn = m.Amount
+		case CashMovementOut:
+			summary.CashOut = m.Amount
+		}
+	}
+
+	summary.Expected = summary.OpeningFloat + summary.CashSales - summary.CashRefunds + summary.CashIn - summary.CashOut
+	return summary
+}
+
+// CloseCashShift đóng ca với số tiền đếm thực tế, chốt số liệu và chênh lệch
+func CloseCashShift(db *gorm.DB, shift *models.CashShift, counted float64, userID uint, notes string) (*CashShiftSummary, error) {
+	if shift.Status != CashShiftOpen {
+		return nil, fmt.Errorf("SHIFT_CLOSED: ca thu ngân đã đóng")
+	}
+
+	counted = math.Round(counted)
+	summary := ComputeCashShiftSummary(db, *shift)
+	variance := counted - summary.Expected
+	now := time.Now()
+
+	updates := map[string]interface{}{
+		"status":          CashShiftClosed,
+		"closed_at":       now,
+		"closed_by":       userID,
+		"cash_sales":      summary.CashSales,
+		"cash_refunds":    summary.CashRefunds,
+		"cash_in":         summary.CashIn,
+		"cash_out":        summary.CashOut,
+		"expected_amount": summary.Expected,
+		"counted_amount":  counted,
+		"variance":        variance,
+	}
+	if notes != "" {
+		updates["notes"] = notes
+	}
+
+	result := db.Model(&models.CashShift{}).Where("id = ? AND status = ?", shift.ID, CashShiftOpen).Updates(updates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("SHIFT_CLOSED: ca thu ngân đã đóng")
+	}
+
+	shift.Status = CashShiftClosed
+	shift.ClosedAt = &now
+	shift.ClosedBy = &userID
+	shift.CashSales = summary.CashSales
+	shift.CashRefunds = summary.CashRefunds
+	shift.CashIn = summary.CashIn
+	shift.CashOut = summary.CashOut
+	shift.ExpectedAmount = &summary.Expected
+	shift.CountedAmount = &counted
+	shift.Variance = &variance
+	if notes != "" {
+		shift.Notes = &notes
+	}
+	return &summary, nil
+}
+
+// ===============================
+// DAY CLOSE (Z REPORT)
+// ===============================
+
+// BusinessDateLayout định dạng ngày kinh doanh
+const BusinessDateLayout = "2006-01-02"
+
+// BusinessLocation múi giờ của ngày kinh doanh (giờ Việt Nam), không phụ thuộc múi giờ của server hay database
+var BusinessLocation = time.FixedZone("GMT+7", 7*60*60)
+
+// BusinessDate ngày kinh doanh của thời điểm t
+func BusinessDate(t time.Time) string {
+	return t.In(BusinessLocation).Format(BusinessDateLayout)
+}
+
+// BusinessDayRange khoảng thời gian [start, end) của ngày kinh doanh (YYYY-MM-DD)
+func BusinessDayRange(date string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(BusinessDateLayout, date, BusinessLocation)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("INVALID_DATE: ngày không hợp lệ (YYYY-MM-DD)")
+	}
+	return start, start.AddDate(0, 0, 1), nil
+}
+
+// IsDayClosed ngày đã chốt sổ chưa
+func IsDayClosed(db *gorm.DB, restaurantID uint, date string) bool {
+	var count int64
+	db.Model(&models.DailyClosing{}).Where("restaurant_id = ? AND business_date = ?", restaurantID, date).Count(&count)
+	return count > 0
+}
+
+// EnsureDayOpen trả lỗi DAY_CLOSED nếu ngày của thời điểm t đã chốt sổ
+func EnsureDayOpen(db *gorm.DB, restaurantID uint, t time.Time) error {
+	date := BusinessDate(t)
+	if IsDayClosed(db, restaurantID, date) {
+		return fmt.Errorf("DAY_CLOSED: ngày %s đã chốt sổ, không thể thay đổi", date)
+	}
+	return nil
+}
+
+// NextOpenBusinessTime thời điểm ghi nhận cho giao dịch đến muộn: t nếu ngày của t chưa chốt sổ,
+// ngược lại là đầu ngày kinh doanh tiếp theo chưa chốt (tiền đã nhận thật, không thể từ chối)
+func NextOpenBusinessTime(db *gorm.DB, restaurantID uint, t time.Time) time.Time {
+	for IsDayClosed(db, restaurantID, BusinessDate(t)) {
+		_, end, _ := BusinessDayRange(BusinessDate(t))
+		t = end
+	}
+	return t
+}
+
+// EnsureOrderDayOpen đơn đã thanh toán thuộc ngày đã chốt sổ thì không được sửa
+func EnsureOrderDayOpen(db *gorm.DB, order models.Order) error {
+	if order.PaidAt == nil {
+		return nil
+	}
+	return EnsureDayOpen(db, order.RestaurantID, *order.PaidAt)
+}
+
+// ZReportLine một dòng gom nhóm trong Z report
+type ZReportLine struct {
+	Key    string  `json:"key"`
+	Count  int64   `json:"count"`
+	Amount float64 `json:"amount"`
+}
+
+// ZReport báo cáo cuối ngày
+type ZReport struct {
+	RestaurantID    uint          `json:"restaurant_id"`
+	BusinessDate    string        `json:"business_date"`
+	Closed          bool          `json:"closed"`
+	ClosedAt        *time.Time    `json:"closed_at,omitempty"`
+	ClosedBy        *uint         `json:"closed_by,omitempty"`
+	Orders          int64         `json:"orders"`
+	GrossSales      float64       `json:"gross_sales"` // Tổng tiền món
+	Discounts       float64       `json:"discounts"`
+	Tax             float64       `json:"tax"`
+	ServiceCharge   float64       `json:"service_charge"`
+	DeliveryFees    float64       `json:"delivery_fees"`
+	NetSales        float64       `json:"net_sales"` // Tổng thu = món - giảm giá + thuế + phí phục vụ + phí giao hàng
+	ByPaymentMethod []ZReportLine `json:"by_payment_method"`
+	ByOrderType     []ZReportLine `json:"by_order_type"`
+	Refunds         float64       `json:"refunds"`
+	RefundsCount    int64         `json:"refunds_count"`
+	RefundsByMethod []ZReportLine `json:"refunds_by_method"`
+	VoidedOrders    ZReportLine   `json:"voided_orders"` // Đơn bị hủy trong ngày
+	VoidedItems     ZReportLine   `json:"voided_items"`  // Món bị hủy trong ngày (đơn không bị hủy)
+	Voids           float64       `json:"voids"`
+	Cash            struct {
+		Shifts     int64   `json:"shifts"`
+		OpenShifts int64   `json:"open_shifts"`
+		Expected   float64 `json:"expected"`
+		Counted    float64 `json:"counted"`
+		Variance   float64 `json:"variance"`
+	} `json:"cash"`
+	LedgerNetRevenue float64   `json:"ledger_net_revenue"` // Đối chiếu: doanh thu thuần theo sổ cái
+	GeneratedAt      time.Time `json:"generated_at"`
+}
+
+// BuildZReport lập Z report cho ngày kinh doanh (YYYY-MM-DD) từ dữ liệu hiện tại
+func BuildZReport(db *gorm.DB, restaurantID uint, date string) (*ZReport, error) {
+	start, end, err := BusinessDayRange(date)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ZReport{RestaurantID: restaurantID, BusinessDate: date, GeneratedAt: time.Now()}
+	paidOrders := func() *gorm.DB {
+		return db.Model(&models.Order{}).
+			Where("restaurant_id = ? AND paid_at >= ? AND paid_at < ? AND payment_status IN ?", restaurantID, start, end, []string{"paid", "refunded"})
+	}
+
+	var totals struct {
+		Orders        int64
+		Subtotal      float64
+		Discount      float64
+		Tax           float64
+		ServiceCharge float64
+		DeliveryFee   float64
+		Total         float64
+	}
+	if err := paidOrders().
+		Select("COUNT(*) as orders, COALESCE(SUM(subtotal), 0) as subtotal, COALESCE(SUM(discount_amount), 0) as discount, " +
+			"COALESCE(SUM(tax_amount), 0) as tax, COALESCE(SUM(service_charge), 0) as service_charge, " +
+			"COALESCE(SUM(delivery_fee), 0) as delivery_fee, COALESCE(SUM(total_amount), 0) as total").
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+	report.Orders = totals.Orders
+	report.GrossSales = totals.Subtotal
+	report.Discounts = totals.Discount
+	report.Tax = totals.Tax
+	report.ServiceCharge = totals.ServiceCharge
+	report.DeliveryFees = totals.DeliveryFee
+	report.NetSales = totals.Total
+
+	report.ByPaymentMethod = []ZReportLine{}
+	paidOrders().
+		Select("COALESCE(payment_method, 'cash') as key, COUNT(*) as count, COALESCE(SUM(total_amount), 0) as amount").
+		Group("COALESCE(payment_method, 'cash')").
+		Order("amount DESC").
+		Scan(&report.ByPaymentMethod)
+
+	report.ByOrderType = []ZReportLine{}
+	paidOrders().
+		Select("order_type as key, COUNT(*) as count, COALESCE(SUM(total_amount), 0) as amount").
+		Group("order_type").
+		Order("amount DESC").
+		Scan(&report.ByOrderType)
+
+	// Hoàn tiền ghi nhận trong ngày
+	report.RefundsByMethod = []ZReportLine{}
+	db.Model(&models.PaymentRefund{}).
+		Select("provider as key, COUNT(*) as count, COALESCE(SUM(amount), 0) as amount").
+		Where("restaurant_id = ? AND created_at >= ? AND created_at < ? AND status <> ?", restaurantID, start, end, RefundFailed).
+		Group("provider").
+		Scan(&report.RefundsByMethod)
+	for _, r := range report.RefundsByMethod {
+		report.Refunds += r.Amount
+		report.RefundsCount += r.Count
+	}
+
+	// Hủy đơn / hủy món trong ngày
+	report.VoidedOrders.Key = "orders"
+	db.Model(&models.Order{}).
+		Select("COUNT(*) as count, COALESCE(SUM(total_amount), 0) as amount").
+		Where("restaurant_id = ? AND status = ? AND cancelled_at >= ? AND cancelled_at < ?", restaurantID, "cancelled", start, end).
+		Scan(&report.VoidedOrders)
+	report.VoidedItems.Key = "items"
+	db.Model(&models.OrderItem{}).
+		Select("COALESCE(SUM(order_items.quantity), 0) as count, COALESCE(SUM(order_items.line_total), 0) as amount").
+		Joins("JOIN orders ON orders.id = order_items.order_id").
+		Where("orders.restaurant_id = ? AND orders.status <> ? AND order_items.prep_status = ? AND order_items.cancelled_at >= ? AND order_items.cancelled_at < ?",
+			restaurantID, "cancelled", "cancelled", start, end).
+		Scan(&report.VoidedItems)
+	report.Voids = report.VoidedOrders.Amount + report.VoidedItems.Amount
+
+	// Két tiền mặt: ca mở trong ngày
+	var cash struct {
+		Shifts     int64
+		OpenShifts int64
+		Expected   float64
+		Counted    float64
+		Variance   float64
+	}
+	db.Model(&models.CashShift{}).
+		Select("COUNT(*) as shifts, COUNT(*) FILTER (WHERE status = 'open') as open_shifts, "+
+			"COALESCE(SUM(expected_amount), 0) as expected, COALESCE(SUM(counted_amount), 0) as counted, COALESCE(SUM(variance), 0) as variance").
+		Where("restaurant_id = ? AND opened_at >= ? AND opened_at < ?", restaurantID, start, end).
+		Scan(&cash)
+	report.Cash.Shifts = cash.Shifts
+	report.Cash.OpenShifts = cash.OpenShifts
+	report.Cash.Expected = cash.Expected
+	report.Cash.Counted = cash.Counted
+	report.Cash.Variance = cash.Variance
+
+	LedgerRevenueQuery(db, restaurantID).
+		Where("t.posted_at >= ? AND t.posted_at < ?", start, end).
+		Select(LedgerNetRevenueSQL).
+		Scan(&report.LedgerNetRevenue)
+
+	return report, nil
+}
+
+// GetZReport Z report của ngày: ngày đã chốt trả về bản lưu lúc chốt, chưa chốt thì lập từ dữ liệu hiện tại
+func GetZReport(db *gorm.DB, restaurantID uint, date string) (*ZReport, error) {
+	var closing models.DailyClosing
+	if err := db.Where("restaurant_id = ? AND business_date = ?", restaurantID, date).First(&closing).Error; err == nil {
+		var report ZReport
+		if err := json.Unmarshal([]byte(closing.Report), &report); err != nil {
+			return nil, err
+		}
+		return &report, nil
+	}
+	return BuildZReport(db, restaurantID, date)
+}
+
+// CloseBusinessDay chốt sổ ngày kinh doanh đã kết thúc: lưu Z report và khóa ngày, mọi ca tiền mặt trong ngày phải đóng trước
+func CloseBusinessDay(db *gorm.DB, restaurantID uint, date string, userID uint, notes string) (*models.DailyClosing, *ZReport, error) {
+	_, end, err := BusinessDayRange(date)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Ngày chưa kết thúc vẫn còn đơn / thanh toán phát sinh
+	if time.Now().Before(end) {
+		return nil, nil, fmt.Errorf("DAY_NOT_ENDED: chỉ chốt sổ được ngày đã kết thúc")
+	}
+	if IsDayClosed(db, restaurantID, date) {
+		return nil, nil, fmt.Errorf("DAY_ALREADY_CLOSED: ngày %s đã chốt sổ", date)
+	}
+
+	var openShifts int64
+	db.Model(&models.CashShift{}).
+		Where("restaurant_id = ? AND status = ? AND opened_at < ?", restaurantID, CashShiftOpen, end).
+		Count(&openShifts)
+	if openShifts > 0 {
+		return nil, nil, fmt.Errorf("OPEN_SHIFTS: còn %d ca thu ngân chưa đóng", openShifts)
+	}
+
+	report, err := BuildZReport(db, restaurantID, date)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	report.Closed = true
+	report.ClosedAt = &now
+	report.ClosedBy = &userID
+	data, err := json.Marshal(report)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	closing := models.DailyClosing{
+		RestaurantID:  restaurantID,
+		BusinessDate:  date,
+		OrdersCount:   report.Orders,
+		GrossSales:    report.GrossSales,
+		Discounts:     report.Discounts,
+		Tax:           report.Tax,
+		ServiceCharge: report.ServiceCharge,
+		DeliveryFees:  report.DeliveryFees,
+		NetSales:      report.NetSales,
+		Refunds:       report.Refunds,
+		Voids:         report.Voids,
+		CashVariance:  report.Cash.Variance,
+		Report:        string(data),
+		ClosedBy:      userID,
+		ClosedAt:      now,
+	}
+	if notes != "" {
+		closing.Notes = &notes
+	}
+	if err := db.Create(&closing).Error; err != nil {
+		// Unique (restaurant_id, business_date): request khác vừa chốt
+		if IsDayClosed(db, restaurantID, date) {
+			return nil, nil, fmt.Errorf("DAY_ALREADY_CLOSED: ngày %s đã chốt sổ", date)
+		}
+		return nil, nil, err
+	}
+
+	return &closing, report, nil
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"go-api/models"
+)
+
+func TestCashShiftSalesFollowLedgerNotOrderTotal(t *testing.T) {
+	db := newTestDB(t)
+	order := createTestOrder(t, db, 100000)
+
+	cashier := models.User{Email: "cashier@test.local", Password: "x", Name: "Cashier", Role: "staff"}
+	if err := db.Create(&cashier).Error; err != nil {
+		t.Fatalf("create cashier: %v", err)
+	}
+	shift, err := OpenCashShift(db, order.RestaurantID, cashier.ID, 500000, "")
+	if err != nil {
+		t.Fatalf("OpenCashShift: %v", err)
+	}
+	if _, err := OpenCashShift(db, order.RestaurantID, cashier.ID, 0, ""); errorCode(err) != "SHIFT_ALREADY_OPEN" {
+		t.Fatalf("second OpenCashShift err = %v, want SHIFT_ALREADY_OPEN", err)
+	}
+
+	// Thu tiền mặt 100.000 trong ca
+	now := time.Now()
+	order.PaymentStatus = "paid"
+	method := "cash"
+	order.PaymentMethod = &method
+	order.PaidAt = &now
+	order.CashShiftID = &shift.ID
+	if err := db.Save(&order).Error; err != nil {
+		t.Fatalf("save order: %v", err)
+	}
+	if err := PostOrderPaymentLedger(db, order); err != nil {
+		t.Fatalf("PostOrderPaymentLedger: %v", err)
+	}
+
+	// Tổng đơn đổi sau khi thu không làm lệch tiền mặt dự kiến
+	db.Model(&models.Order{}).Where("id = ?", order.ID).Update("total_amount", 150000)
+
+	summary := ComputeCashShiftSummary(db, *shift)
+	if summary.CashOrders != 1 || summary.CashSales != 100000 {
+		t.Errorf("cash orders = %d, sales = %.0f, want 1 and 100000", summary.CashOrders, summary.CashSales)
+	}
+	if summary.Expected != 600000 {
+		t.Errorf("expected cash = %.0f, want 600000", summary.Expected)
+	}
+}
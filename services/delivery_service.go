@@ -0,0 +1,104 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"go-api/config"
+	"go-api/models"
+)
+
+// ===============================
+// DELIVERY SERVICE
+// ===============================
+
+const earthRadiusKm = 6371.0
+
+// DeliveryQuote kết quả tính phí giao hàng
+type DeliveryQuote struct {
+	Zone           models.DeliveryZone `json:"zone"`
+	DistanceKm     *float64            `json:"distance_km"`
+	Fee            float64             `json:"fee"`
+	MinOrderAmount float64             `json:"min_order_amount"`
+}
+
+// DeliveryDestination địa chỉ giao hàng dùng để tìm vùng giao
+type DeliveryDestination struct {
+	District  string
+	Latitude  *float64
+	Longitude *float64
+}
+
+// HaversineKm tính khoảng cách đường chim bay (km) giữa hai tọa độ
+func HaversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLng := toRad(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return earthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// QuoteDelivery tìm vùng giao hàng phù hợp và tính phí
+// Ưu tiên vùng theo bán kính (khi có tọa độ), sau đó mới tới vùng theo quận/huyện
+// subtotal dùng để kiểm tra giá trị đơn tối thiểu của vùng (truyền 0 để bỏ qua)
+func QuoteDelivery(restaurant models.Restaurant, dest DeliveryDestination, subtotal float64) (*DeliveryQuote, error) {
+	var zones []models.DeliveryZone
+	if err := config.GetDB().Where("restaurant_id = ? AND is_active = ?", restaurant.ID, true).
+		Order("sort_order ASC, id ASC").
+		Find(&zones).Error; err != nil {
+		return nil, err
+	}
+	if len(zones) == 0 {
+		return nil, fmt.Errorf("DELIVERY_UNAVAILABLE: Nhà hàng chưa hỗ trợ giao hàng")
+	}
+
+	var distance *float64
+	if restaurant.Latitude != nil && restaurant.Longitude != nil && dest.Latitude != nil && dest.Longitude != nil {
+		d := math.Round(HaversineKm(*restaurant.Latitude, *restaurant.Longitude, *dest.Latitude, *dest.Longitude)*100) / 100
+		distance = &d
+	}
+
+	var matched *models.DeliveryZone
+
+	// 1. Vùng theo bán kính: chọn vùng nhỏ nhất chứa điểm giao
+	if distance != nil {
+		for i := range zones {
+			z := zones[i]
+			if z.ZoneType != "distance" || z.MaxDistanceKm == nil || *distance > *z.MaxDistanceKm {
+				continue
+			}
+			if matched == nil || *z.MaxDistanceKm < *matched.MaxDistanceKm {
+				matched = &zones[i]
+			}
+		}
+	}
+
+	// 2. Vùng theo quận/huyện
+	district := strings.TrimSpace(dest.District)
+	if matched == nil && district != "" {
+		for i := range zones {
+			z := zones[i]
+			if z.ZoneType == "district" && z.District != nil && strings.EqualFold(strings.TrimSpace(*z.District), district) {
+				matched = &zones[i]
+				break
+			}
+		}
+	}
+
+	if matched == nil {
+		return nil, fmt.Errorf("OUT_OF_DELIVERY_AREA: Địa chỉ nằm ngoài khu vực giao hàng")
+	}
+
+	if subtotal > 0 && subtotal < matched.MinOrderAmount {
+		return nil, fmt.Errorf("BELOW_MIN_ORDER: Đơn tối thiểu cho khu vực %s là %.0fđ", matched.Name, matched.MinOrderAmount)
+	}
+
+	return &DeliveryQuote{
+		Zone:           *matched,
+		DistanceKm:     distance,
+		Fee:            matched.Fee,
+		MinOrderAmount: matched.MinOrderAmount,
+	}, nil
+}
@@ -0,0 +1,732 @@
+package services
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"go-api/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ===============================
+// E-INVOICE PROVIDERS
+// ===============================
+
+// Trạng thái hóa đơn điện tử
+const (
+	InvoiceDraft     = "draft"
+	InvoiceIssued    = "issued"
+	InvoiceCancelled = "cancelled"
+)
+
+// Ký hiệu mẫu số hóa đơn
+const (
+	InvoiceTemplateVAT   = "1" // Hóa đơn giá trị gia tăng
+	InvoiceTemplateSales = "2" // Hóa đơn bán hàng
+)
+
+// invoiceSymbolPattern ký hiệu hóa đơn: C/K (có / không có mã CQT) + 2 số cuối năm + loại hóa đơn + 2 ký tự do người bán tự đặt
+var invoiceSymbolPattern = regexp.MustCompile(`^[CK][0-9]{2}[TDLMNBGH][A-Z]{2}$`)
+
+// taxCodePattern mã số thuế doanh nghiệp (10 số, chi nhánh thêm -3 số) hoặc số định danh cá nhân 12 số
+var taxCodePattern = regexp.MustCompile(`^([0-9]{10}(-[0-9]{3})?|[0-9]{12})$`)
+
+// EInvoiceRequest hóa đơn gửi sang nhà cung cấp
+type EInvoiceRequest struct {
+	Invoice models.Invoice
+	XML     []byte
+}
+
+// EInvoiceResult kết quả phát hành từ nhà cung cấp
+type EInvoiceResult struct {
+	ProviderRef string
+	LookupCode  string // Mã tra cứu hóa đơn cho người mua
+	XML         []byte // XML đã ký / có mã CQT do nhà cung cấp trả về, rỗng = giữ bản đã gửi
+}
+
+// EInvoiceProvider nhà cung cấp hóa đơn điện tử: phát hành và hủy hóa đơn
+type EInvoiceProvider interface {
+	Name() string
+	Issue(req EInvoiceRequest) (*EInvoiceResult, error)
+	Cancel(invoice models.Invoice, reason string) error
+}
+
+// EInvoiceProviderFactory tạo nhà cung cấp với tài khoản của nhà hàng
+type EInvoiceProviderFactory func(settings models.EInvoiceSetting) (EInvoiceProvider, error)
+
+var eInvoiceProviders = map[string]EInvoiceProviderFactory{}
+
+// RegisterEInvoiceProvider đăng ký nhà cung cấp hóa đơn điện tử
+func RegisterEInvoiceProvider(name string, factory EInvoiceProviderFactory) {
+	eInvoiceProviders[name] = factory
+}
+
+func init() {
+	RegisterEInvoiceProvider(EInvoiceProviderLocal, newLocalEInvoiceProvider)
+}
+
+// NewEInvoiceProvider tạo nhà cung cấp theo tên với cấu hình của nhà hàng
+func NewEInvoiceProvider(name string, settings models.EInvoiceSetting) (EInvoiceProvider, error) {
+	factory, ok := eInvoiceProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("PROVIDER_NOT_SUPPORTED: nhà cung cấp hóa đơn điện tử %s không được hỗ trợ", name)
+	}
+	return factory(settings)
+}
+
+// EInvoiceProviderNames danh sách nhà cung cấp đã đăng ký
+func EInvoiceProviderNames() []string {
+	names := make([]string, 0, len(eInvoiceProviders))
+	for name := range eInvoiceProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ===============================
+// BUYER & SERIES
+// ===============================
+
+// InvoiceBuyer thông tin người mua trên hóa đơn
+type InvoiceBuyer struct {
+	Name    string // Họ tên người mua hàng
+	Company string // Tên đơn vị
+	TaxCode string
+	Address string
+	Email   string
+}
+
+// Normalize chuẩn hóa và kiểm tra thông tin người mua: xuất cho đơn vị thì cần đủ tên đơn vị, mã số thuế, địa chỉ
+func (b *InvoiceBuyer) Normalize() error {
+	b.Name = strings.TrimSpace(b.Name)
+	b.Company = strings.TrimSpace(b.Company)
+	b.TaxCode = strings.ReplaceAll(strings.TrimSpace(b.TaxCode), " ", "")
+	b.Address = strings.TrimSpace(b.Address)
+	b.Email = strings.TrimSpace(b.Email)
+
+	if b.Name == "" && b.Company == "" && b.TaxCode == "" {
+		return fmt.Errorf("INVALID_BUYER: cần họ tên người mua hoặc thông tin đơn vị")
+	}
+	if b.TaxCode != "" && !ValidTaxCode(b.TaxCode) {
+		return fmt.Errorf("INVALID_TAX_CODE: mã số thuế không hợp lệ")
+	}
+	if b.Company != "" && (b.TaxCode == "" || b.Address == "") {
+		return fmt.Errorf("INVALID_BUYER: hóa đơn cho đơn vị cần mã số thuế và địa chỉ")
+	}
+	return nil
+}
+
+// ValidTaxCode mã số thuế đúng định dạng
+func ValidTaxCode(taxCode string) bool {
+	return taxCodePattern.MatchString(taxCode)
+}
+
+// applyInvoiceBuyer ghi thông tin người mua vào hóa đơn
+func applyInvoiceBuyer(invoice *models.Invoice, buyer InvoiceBuyer) {
+	optional := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+		return &s
+	}
+	invoice.BuyerName = optional(buyer.Name)
+	invoice.BuyerCompany = optional(buyer.Company)
+	invoice.BuyerTaxCode = optional(buyer.TaxCode)
+	invoice.BuyerAddress = optional(buyer.Address)
+	invoice.BuyerEmail = optional(buyer.Email)
+}
+
+// CurrentInvoice hóa đơn đang hiệu lực (nháp hoặc đã phát hành) của đơn, nil nếu chưa có
+func CurrentInvoice(db *gorm.DB, orderID uint) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := db.Where("order_id = ? AND status IN ?", orderID, []string{InvoiceDraft, InvoiceIssued}).
+		Order("id DESC").
+		First(&invoice).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// SaveInvoiceBuyer lưu thông tin người mua vào hóa đơn nháp của đơn (tạo mới nếu chưa có).
+// Hóa đơn đã phát hành không sửa được, cần hủy rồi phát hành lại
+func SaveInvoiceBuyer(db *gorm.DB, order models.Order, buyer InvoiceBuyer) (*models.Invoice, error) {
+	if err := buyer.Normalize(); err != nil {
+		return nil, err
+	}
+	if order.Status == "cancelled" || order.Status == "merged" {
+		return nil, fmt.Errorf("ORDER_CLOSED: đơn hàng đã đóng")
+	}
+
+	// Khóa dòng đơn: khi chưa có hóa đơn, khóa ở CurrentInvoice không chặn được hai yêu cầu cùng tạo nháp
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Order{}, order.ID).Error; err != nil {
+		return nil, fmt.Errorf("ORDER_NOT_FOUND: không tìm thấy đơn hàng")
+	}
+	invoice, err := CurrentInvoice(db.Clauses(clause.Locking{Strength: "UPDATE"}), order.ID)
+	if err != nil {
+		return nil, err
+	}
+	if invoice == nil {
+		invoice = &models.Invoice{RestaurantID: order.RestaurantID, OrderID: order.ID, Status: InvoiceDraft}
+	} else if invoice.Status == InvoiceIssued {
+		return nil, fmt.Errorf("ALREADY_ISSUED: hóa đơn đã phát hành, cần hủy trước khi sửa thông tin người mua")
+	}
+
+	applyInvoiceBuyer(invoice, buyer)
+	if err := db.Save(invoice).Error; err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// CreateInvoiceSeries tạo ký hiệu hóa đơn mới cho nhà hàng, dãy mới thay dãy đang dùng
+func CreateInvoiceSeries(db *gorm.DB, restaurantID uint, templateCode, symbol string, startNumber int) (*models.InvoiceSeries, error) {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	if templateCode != InvoiceTemplateVAT && templateCode != InvoiceTemplateSales {
+		return nil, fmt.Errorf("INVALID_TEMPLATE: ký hiệu mẫu số phải là 1 (GTGT) hoặc 2 (bán hàng)")
+	}
+	if !invoiceSymbolPattern.MatchString(symbol) {
+		return nil, fmt.Errorf("INVALID_SYMBOL: ký hiệu hóa đơn không hợp lệ (VD: C26MAA)")
+	}
+	if startNumber < 1 {
+		startNumber = 1
+	}
+
+	series := models.InvoiceSeries{
+		RestaurantID: restaurantID,
+		TemplateCode: templateCode,
+		Symbol:       symbol,
+		NextNumber:   startNumber,
+		IsActive:     true,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		tx.Model(&models.InvoiceSeries{}).
+			Where("restaurant_id = ? AND template_code = ? AND symbol = ?", restaurantID, templateCode, symbol).
+			Count(&count)
+		if count > 0 {
+			return fmt.Errorf("SERIES_EXISTS: ký hiệu %s%s đã tồn tại", templateCode, symbol)
+		}
+		if err := tx.Model(&models.InvoiceSeries{}).
+			Where("restaurant_id = ? AND is_active = ?", restaurantID, true).
+			Update("is_active", false).Error; err != nil {
+			return err
+		}
+		return tx.Create(&series).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &series, nil
+}
+
+// ===============================
+// ISSUE & CANCEL
+// ===============================
+
+// IssueInvoice phát hành hóa đơn điện tử cho đơn đã thanh toán: cấp số tiếp theo của ký hiệu đang dùng,
+// dựng XML và gửi nhà cung cấp. buyer nil = dùng thông tin người mua đã lưu (hoặc người mua không lấy hóa đơn).
+// Nhà cung cấp được gọi trong transaction đang khóa dãy số: lỗi thì số không bị dùng, dãy số không bị nhảy
+func IssueInvoice(db *gorm.DB, orderID uint, buyer *InvoiceBuyer, userID uint) (*models.Invoice, error) {
+	if buyer != nil {
+		if err := buyer.Normalize(); err != nil {
+			return nil, err
+		}
+	}
+
+	var invoice models.Invoice
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Khóa dòng đơn trước: hai yêu cầu phát hành cùng đơn chạy tuần tự, yêu cầu sau thấy ALREADY_ISSUED
+		// (khi chưa có hóa đơn nháp, khóa ở CurrentInvoice không khóa được dòng nào)
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("OrderItems", "prep_status <> ?", "cancelled").
+			First(&order, orderID).Error; err != nil {
+			return fmt.Errorf("ORDER_NOT_FOUND: không tìm thấy đơn hàng")
+		}
+		if order.PaymentStatus != "paid" {
+			return fmt.Errorf("ORDER_NOT_PAID: chỉ xuất hóa đơn cho đơn đã thanh toán")
+		}
+
+		current, err := CurrentInvoice(tx.Clauses(clause.Locking{Strength: "UPDATE"}), order.ID)
+		if err != nil {
+			return err
+		}
+		if current != nil && current.Status == InvoiceIssued {
+			return fmt.Errorf("ALREADY_ISSUED: đơn hàng đã có hóa đơn số %d", *current.Number)
+		}
+		if current != nil {
+			invoice = *current
+		} else {
+			invoice = models.Invoice{RestaurantID: order.RestaurantID, OrderID: order.ID, Status: InvoiceDraft}
+		}
+		if buyer != nil {
+			applyInvoiceBuyer(&invoice, *buyer)
+		}
+
+		var settings models.EInvoiceSetting
+		if err := tx.Where("restaurant_id = ?", order.RestaurantID).First(&settings).Error; err != nil ||
+			settings.SellerName == "" || settings.SellerTaxCode == "" {
+			return fmt.Errorf("EINVOICE_NOT_CONFIGURED: nhà hàng chưa cấu hình thông tin người bán trên hóa đơn")
+		}
+		provider, err := NewEInvoiceProvider(settings.Provider, settings)
+		if err != nil {
+			return err
+		}
+
+		var series models.InvoiceSeries
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("restaurant_id = ? AND is_active = ?", order.RestaurantID, true).
+			First(&series).Error; err != nil {
+			return fmt.Errorf("NO_INVOICE_SERIES: nhà hàng chưa tạo ký hiệu hóa đơn")
+		}
+
+		now := time.Now()
+		issueDate := BusinessDate(now)
+		if series.Symbol[1:3] != issueDate[2:4] {
+			return fmt.Errorf("SERIES_EXPIRED: ký hiệu %s dùng cho năm 20%s, cần tạo ký hiệu cho năm nay", series.Symbol, series.Symbol[1:3])
+		}
+
+		number := series.NextNumber
+		if err := tx.Model(&series).Update("next_number", number+1).Error; err != nil {
+			return err
+		}
+
+		providerName := provider.Name()
+		invoice.SeriesID = &series.ID
+		invoice.TemplateCode = &series.TemplateCode
+		invoice.Symbol = &series.Symbol
+		invoice.Number = &number
+		invoice.IssuedAt = &now
+		invoice.IssuedBy = nil
+		if userID > 0 {
+			invoice.IssuedBy = &userID
+		}
+		invoice.Provider = &providerName
+
+		document := buildInvoiceDocument(invoice, order, settings, issueDate)
+		invoice.AmountBeforeTax = float64(document.Data.Content.Totals.AmountBeforeTax)
+		invoice.TaxAmount = float64(document.Data.Content.Totals.TaxAmount)
+		invoice.TotalAmount = float64(document.Data.Content.Totals.Total)
+
+		xmlData, err := marshalInvoiceXML(document)
+		if err != nil {
+			return err
+		}
+
+		result, err := provider.Issue(EInvoiceRequest{Invoice: invoice, XML: xmlData})
+		if err != nil {
+			return fmt.Errorf("PROVIDER_ERROR: %v", err)
+		}
+		if len(result.XML) > 0 {
+			xmlData = result.XML
+		}
+
+		invoice.Status = InvoiceIssued
+		invoice.XML = string(xmlData)
+		if result.ProviderRef != "" {
+			invoice.ProviderRef = &result.ProviderRef
+		}
+		if result.LookupCode != "" {
+			invoice.LookupCode = &result.LookupCode
+		}
+		return tx.Save(&invoice).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// CancelInvoice hủy hóa đơn (restaurantID nil = admin). Hóa đơn đã phát hành được hủy cả bên nhà cung cấp,
+// số hóa đơn giữ nguyên không cấp lại; đơn hàng có thể phát hành hóa đơn thay thế
+func CancelInvoice(db *gorm.DB, invoiceID uint, restaurantID *uint, userID uint, reason string) (*models.Invoice, error) {
+	invoice, err := FindInvoice(db, invoiceID, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	if invoice.Status == InvoiceCancelled {
+		return nil, fmt.Errorf("ALREADY_CANCELLED: hóa đơn đã bị hủy")
+	}
+
+	if invoice.Status == InvoiceIssued {
+		var settings models.EInvoiceSetting
+		if err := db.Where("restaurant_id = ?", invoice.RestaurantID).First(&settings).Error; err != nil {
+			return nil, fmt.Errorf("EINVOICE_NOT_CONFIGURED: nhà hàng chưa cấu hình hóa đơn điện tử")
+		}
+		providerName := settings.Provider
+		if invoice.Provider != nil {
+			providerName = *invoice.Provider
+		}
+		provider, err := NewEInvoiceProvider(providerName, settings)
+		if err != nil {
+			return nil, err
+		}
+		if err := provider.Cancel(*invoice, reason); err != nil {
+			return nil, fmt.Errorf("PROVIDER_ERROR: %v", err)
+		}
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":        InvoiceCancelled,
+		"cancel_reason": reason,
+		"cancelled_at":  now,
+	}
+	if userID > 0 {
+		updates["cancelled_by"] = userID
+	}
+	result := db.Model(&models.Invoice{}).
+		Where("id = ? AND status = ?", invoice.ID, invoice.Status).
+		Updates(updates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("ALREADY_CANCELLED: hóa đơn vừa được cập nhật, vui lòng tải lại")
+	}
+
+	db.First(invoice, invoice.ID)
+	return invoice, nil
+}
+
+// FindInvoice tìm hóa đơn trong phạm vi nhà hàng (restaurantID nil = không giới hạn)
+func FindInvoice(db *gorm.DB, invoiceID uint, restaurantID *uint) (*models.Invoice, error) {
+	query := db.Where("id = ?", invoiceID)
+	if restaurantID != nil {
+		query = query.Where("restaurant_id = ?", *restaurantID)
+	}
+	var invoice models.Invoice
+	if err := query.First(&invoice).Error; err != nil {
+		return nil, fmt.Errorf("INVOICE_NOT_FOUND: không tìm thấy hóa đơn")
+	}
+	return &invoice, nil
+}
+
+// InvoiceFileName tên file XML của hóa đơn đã phát hành, VD: 1C26MAA_0000015.xml
+func InvoiceFileName(invoice models.Invoice) string {
+	if invoice.Number == nil || invoice.Symbol == nil || invoice.TemplateCode == nil {
+		return fmt.Sprintf("invoice_%d.xml", invoice.ID)
+	}
+	return fmt.Sprintf("%s%s_%07d.xml", *invoice.TemplateCode, *invoice.Symbol, *invoice.Number)
+}
+
+// ===============================
+// XML (định dạng hóa đơn điện tử theo Thông tư 78/2021/TT-BTC)
+// ===============================
+
+// Tính chất dòng hàng hóa, dịch vụ
+const (
+	invoiceLineGoods    = 1 // Hàng hóa, dịch vụ
+	invoiceLineDiscount = 3 // Chiết khấu thương mại
+)
+
+// invoiceNoTax dòng không chịu thuế
+const invoiceNoTax = "KCT"
+
+type invoiceXML struct {
+	XMLName    xml.Name        `xml:"HDon"`
+	Data       invoiceXMLData  `xml:"DLHDon"`
+	Signatures invoiceXMLEmpty `xml:"DSCKS"` // Chữ ký số do nhà cung cấp / người bán bổ sung
+}
+
+type invoiceXMLEmpty struct{}
+
+type invoiceXMLData struct {
+	ID      string            `xml:"Id,attr"`
+	General invoiceXMLGeneral `xml:"TTChung"`
+	Content invoiceXMLContent `xml:"NDHDon"`
+}
+
+type invoiceXMLGeneral struct {
+	Version       string `xml:"PBan"`
+	Name          string `xml:"THDon"`
+	TemplateCode  string `xml:"KHMSHDon"`
+	Symbol        string `xml:"KHHDon"`
+	Number        int    `xml:"SHDon"`
+	IssueDate     string `xml:"NLap"`
+	Currency      string `xml:"DVTTe"`
+	PaymentMethod string `xml:"HTTToan,omitempty"`
+}
+
+type invoiceXMLContent struct {
+	Seller invoiceXMLSeller `xml:"NBan"`
+	Buyer  invoiceXMLBuyer  `xml:"NMua"`
+	Lines  []invoiceXMLLine `xml:"DSHHDVu>HHDVu"`
+	Totals invoiceXMLTotals `xml:"TToan"`
+}
+
+type invoiceXMLSeller struct {
+	Name        string `xml:"Ten"`
+	TaxCode     string `xml:"MST"`
+	Address     string `xml:"DChi"`
+	Phone       string `xml:"SDThoai,omitempty"`
+	Email       string `xml:"DCTDTu,omitempty"`
+	BankAccount string `xml:"STKNHang,omitempty"`
+	BankName    string `xml:"TNHang,omitempty"`
+}
+
+type invoiceXMLBuyer struct {
+	Company   string `xml:"Ten,omitempty"`
+	TaxCode   string `xml:"MST,omitempty"`
+	Address   string `xml:"DChi,omitempty"`
+	BuyerName string `xml:"HVTNMHang,omitempty"`
+	Email     string `xml:"DCTDTu,omitempty"`
+}
+
+type invoiceXMLLine struct {
+	Kind      int    `xml:"TChat"`
+	Line      int    `xml:"STT"`
+	Name      string `xml:"THHDVu"`
+	Unit      string `xml:"DVTinh,omitempty"`
+	Quantity  int    `xml:"SLuong,omitempty"`
+	UnitPrice int64  `xml:"DGia,omitempty"`
+	Amount    int64  `xml:"ThTien"`
+	TaxRate   string `xml:"TSuat"`
+}
+
+type invoiceXMLTotals struct {
+	Rates           []invoiceXMLRate `xml:"THTTLTSuat>LTSuat"`
+	AmountBeforeTax int64            `xml:"TgTCThue"`
+	TaxAmount       int64            `xml:"TgTThue"`
+	Discount        int64            `xml:"TTCKTMai,omitempty"`
+	Total           int64            `xml:"TgTTTBSo"`
+	TotalInWords    string           `xml:"TgTTTBChu"`
+}
+
+type invoiceXMLRate struct {
+	Rate   string `xml:"TSuat"`
+	Amount int64  `xml:"ThTien"`
+	Tax    int64  `xml:"TThue"`
+}
+
+// buildInvoiceDocument dựng nội dung hóa đơn từ đơn hàng. Số tiền khớp với đơn: thuế tính trên tiền món
+// (Restaurant.TaxRate), phí phục vụ và phí giao hàng không tính thuế, giảm giá là dòng chiết khấu thương mại
+func buildInvoiceDocument(invoice models.Invoice, order models.Order, settings models.EInvoiceSetting, issueDate string) invoiceXML {
+	taxRate := invoiceTaxRate(order)
+
+	doc := invoiceXML{}
+	doc.Data.ID = "data"
+	doc.Data.General = invoiceXMLGeneral{
+		Version:       "2.1.0",
+		Name:          "Hóa đơn giá trị gia tăng",
+		TemplateCode:  *invoice.TemplateCode,
+		Symbol:        *invoice.Symbol,
+		Number:        *invoice.Number,
+		IssueDate:     issueDate,
+		Currency:      "VND",
+		PaymentMethod: invoicePaymentMethod(order.PaymentMethod),
+	}
+	if *invoice.TemplateCode == InvoiceTemplateSales {
+		doc.Data.General.Name = "Hóa đơn bán hàng"
+	}
+
+	content := &doc.Data.Content
+	content.Seller = invoiceXMLSeller{
+		Name:        settings.SellerName,
+		TaxCode:     settings.SellerTaxCode,
+		Address:     settings.SellerAddress,
+		Phone:       derefString(settings.SellerPhone),
+		Email:       derefString(settings.SellerEmail),
+		BankAccount: derefString(settings.SellerBankAccount),
+		BankName:    derefString(settings.SellerBankName),
+	}
+	content.Buyer = invoiceXMLBuyer{
+		Company:   derefString(invoice.BuyerCompany),
+		TaxCode:   derefString(invoice.BuyerTaxCode),
+		Address:   derefString(invoice.BuyerAddress),
+		BuyerName: derefString(invoice.BuyerName),
+		Email:     derefString(invoice.BuyerEmail),
+	}
+	if content.Buyer == (invoiceXMLBuyer{}) {
+		content.Buyer.BuyerName = "Người mua không lấy hóa đơn"
+	}
+
+	var itemsAmount int64
+	for _, item := range order.OrderItems {
+		amount := vndAmount(item.LineTotal)
+		line := invoiceXMLLine{
+			Kind:     invoiceLineGoods,
+			Line:     len(content.Lines) + 1,
+			Name:     item.ItemName,
+			Unit:     "Phần",
+			Quantity: item.Quantity,
+			Amount:   amount,
+			TaxRate:  taxRate,
+		}
+		if item.Quantity > 0 {
+			line.UnitPrice = vndAmount(item.LineTotal / float64(item.Quantity))
+		}
+		content.Lines = append(content.Lines, line)
+		itemsAmount += amount
+	}
+
+	var noTaxAmount int64
+	addNoTaxLine := func(name string, amount float64) {
+		if vndAmount(amount) <= 0 {
+			return
+		}
+		content.Lines = append(content.Lines, invoiceXMLLine{
+			Kind:    invoiceLineGoods,
+			Line:    len(content.Lines) + 1,
+			Name:    name,
+			Amount:  vndAmount(amount),
+			TaxRate: invoiceNoTax,
+		})
+		noTaxAmount += vndAmount(amount)
+	}
+	addNoTaxLine("Phí phục vụ", order.ServiceCharge)
+	addNoTaxLine("Phí giao hàng", order.DeliveryFee)
+
+	discount := vndAmount(order.DiscountAmount)
+	if discount > 0 {
+		content.Lines = append(content.Lines, invoiceXMLLine{
+			Kind:    invoiceLineDiscount,
+			Line:    len(content.Lines) + 1,
+			Name:    "Chiết khấu thương mại",
+			Amount:  discount,
+			TaxRate: taxRate,
+		})
+	}
+
+	// Tổng tiền lấy theo đơn đã thanh toán, chênh lệch làm tròn dồn vào tiền trước thuế
+	total := vndAmount(order.TotalAmount)
+	tax := vndAmount(order.TaxAmount)
+	totals := &content.Totals
+	totals.Rates = []invoiceXMLRate{{Rate: taxRate, Amount: itemsAmount - discount, Tax: tax}}
+	if noTaxAmount > 0 {
+		totals.Rates = append(totals.Rates, invoiceXMLRate{Rate: invoiceNoTax, Amount: noTaxAmount})
+	}
+	totals.AmountBeforeTax = total - tax
+	totals.TaxAmount = tax
+	totals.Discount = discount
+	totals.Total = total
+	totals.TotalInWords = VNDInWords(total)
+
+	return doc
+}
+
+// marshalInvoiceXML XML hóa đơn kèm khai báo encoding
+func marshalInvoiceXML(doc invoiceXML) ([]byte, error) {
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// invoiceTaxRate thuế suất của đơn dạng "10%" / "8%" (theo tiền thuế đã tính trên đơn)
+func invoiceTaxRate(order models.Order) string {
+	if order.Subtotal <= 0 || order.TaxAmount <= 0 {
+		return "0%"
+	}
+	rate := order.TaxAmount / order.Subtotal * 100
+	return strconv.FormatFloat(float64(int(rate*100+0.5))/100, 'f', -1, 64) + "%"
+}
+
+// invoicePaymentMethod hình thức thanh toán trên hóa đơn
+func invoicePaymentMethod(method *string) string {
+	if method == nil {
+		return ""
+	}
+	if *method == "cash" {
+		return "Tiền mặt"
+	}
+	return "Chuyển khoản"
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// ===============================
+// AMOUNT IN WORDS
+// ===============================
+
+var vietnameseDigits = []string{"không", "một", "hai", "ba", "bốn", "năm", "sáu", "bảy", "tám", "chín"}
+
+var vietnameseGroupUnits = []string{"", " nghìn", " triệu", " tỷ", " nghìn tỷ", " triệu tỷ", " tỷ tỷ"}
+
+// VNDInWords số tiền bằng chữ, VD: 1.005.000 -> "Một triệu không trăm linh năm nghìn đồng"
+func VNDInWords(amount int64) string {
+	if amount <= 0 {
+		return "Không đồng"
+	}
+
+	var groups []int
+	for n := amount; n > 0; n /= 1000 {
+		groups = append(groups, int(n%1000))
+	}
+
+	var parts []string
+	for i := len(groups) - 1; i >= 0; i-- {
+		if groups[i] == 0 {
+			continue
+		}
+		full := i < len(groups)-1 // Nhóm sau nhóm đầu đọc đủ "không trăm", "linh"
+		parts = append(parts, readThreeDigits(groups[i], full)+vietnameseGroupUnits[i])
+	}
+
+	words := strings.Join(parts, " ") + " đồng"
+	first, size := utf8.DecodeRuneInString(words)
+	return string(unicode.ToUpper(first)) + words[size:]
+}
+
+// readThreeDigits đọc nhóm 3 chữ số
+func readThreeDigits(n int, full bool) string {
+	hundreds, tens, units := n/100, n/10%10, n%10
+
+	var words []string
+	if full || hundreds > 0 {
+		words = append(words, vietnameseDigits[hundreds], "trăm")
+	}
+
+	switch {
+	case tens == 0:
+		if units > 0 {
+			if len(words) > 0 {
+				words = append(words, "linh")
+			}
+			words = append(words, vietnameseDigits[units])
+		}
+	case tens == 1:
+		words = append(words, "mười")
+		switch units {
+		case 0:
+		case 5:
+			words = append(words, "lăm")
+		default:
+			words = append(words, vietnameseDigits[units])
+		}
+	default:
+		words = append(words, vietnameseDigits[tens], "mươi")
+		switch units {
+		case 0:
+		case 1:
+			words = append(words, "mốt")
+		case 4:
+			words = append(words, "tư")
+		case 5:
+			words = append(words, "lăm")
+		default:
+			words = append(words, vietnameseDigits[units])
+		}
+	}
+	return strings.Join(words, " ")
+}
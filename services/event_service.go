@@ -0,0 +1,126 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"go-api/models"
+)
+
+// ===============================
+// EVENT BUS (in-process)
+// ===============================
+
+// Event sự kiện phát ra trong hệ thống (đơn hàng, yêu cầu phục vụ...)
+type Event struct {
+	Type         string                 `json:"type"`
+	RestaurantID uint                   `json:"restaurant_id"`
+	Data         map[string]interface{} `json:"data"`
+	CreatedAt    time.Time              `json:"created_at"`
+}
+
+// EventHandler hàm xử lý sự kiện
+type EventHandler func(Event)
+
+var (
+	eventMu         sync.RWMutex
+	eventHandlers   = map[int]EventHandler{}
+	nextHandlerID   int
+	eventBufferSize = 32
+)
+
+// SubscribeEvents đăng ký nhận sự kiện, trả về hàm hủy đăng ký
+func SubscribeEvents(handler EventHandler) func() {
+	eventMu.Lock()
+	id := nextHandlerID
+	nextHandlerID++
+	eventHandlers[id] = handler
+	eventMu.Unlock()
+
+	return func() {
+		eventMu.Lock()
+		delete(eventHandlers, id)
+		eventMu.Unlock()
+	}
+}
+
+// SubscribeRestaurantEvents nhận sự kiện của một nhà hàng qua channel (dùng cho stream realtime)
+// Sự kiện bị bỏ qua nếu người nhận không đọc kịp
+func SubscribeRestaurantEvents(restaurantID uint) (<-chan Event, func()) {
+	ch := make(chan Event, eventBufferSize)
+	var mu sync.Mutex
+	closed := false
+
+	unsubscribe := SubscribeEvents(func(e Event) {
+		if e.RestaurantID != restaurantID {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case ch <- e:
+		default:
+		}
+	})
+
+	return ch, func() {
+		unsubscribe()
+		mu.Lock()
+		defer mu.Unlock()
+		if !closed {
+			closed = true
+			close(ch)
+		}
+	}
+}
+
+// PublishEvent phát sự kiện tới tất cả người đăng ký
+func PublishEvent(eventType string, restaurantID uint, data map[string]interface{}) {
+	event := Event{
+		Type:         eventType,
+		RestaurantID: restaurantID,
+		Data:         data,
+		CreatedAt:    time.Now(),
+	}
+
+	eventMu.RLock()
+	handlers := make([]EventHandler, 0, len(eventHandlers))
+	for _, h := range eventHandlers {
+		handlers = append(handlers, h)
+	}
+	eventMu.RUnlock()
+
+	for _, h := range handlers {
+		h(event)
+	}
+}
+
+// PublishOrderEvent phát sự kiện đơn hàng (order.created, order.paid...) kèm thông tin cơ bản của đơn
+func PublishOrderEvent(eventType string, order models.Order) {
+	PublishEvent(eventType, order.RestaurantID, map[string]interface{}{
+		"order_id":       order.ID,
+		"order_number":   order.OrderNumber,
+		"order_type":     order.OrderType,
+		"table_id":       order.TableID,
+		"pickup_number":  order.PickupNumber,
+		"status":         order.Status,
+		"payment_status": order.PaymentStatus,
+		"payment_method": order.PaymentMethod,
+		"total_amount":   order.TotalAmount,
+		"paid_at":        order.PaidAt,
+		"created_at":     order.CreatedAt,
+	})
+}
+
+// PublishMenuUpdated phát sự kiện menu.updated khi món / danh mục thay đổi
+// action: item_created, item_updated, item_deleted, category_created, category_updated, category_deleted, synced
+func PublishMenuUpdated(restaurantID uint, action string, data map[string]interface{}) {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["action"] = action
+	PublishEvent("menu.updated", restaurantID, data)
+}
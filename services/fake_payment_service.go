@@ -0,0 +1,137 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"go-api/config"
+	"go-api/models"
+)
+
+// ===============================
+// FAKE PAYMENT PROVIDER
+// ===============================
+
+// Cổng giả lập cho phát triển / kiểm thử (PAYMENT_FAKE_PROVIDER=true).
+// Giao dịch lưu trong bộ nhớ, callback ký HMAC-SHA256 bằng FakePaymentSecret
+
+// FakePaymentSecret khóa ký callback của cổng giả lập
+const FakePaymentSecret = "fake-payment-secret"
+
+type fakePayment struct {
+	amount   int64
+	status   string
+	transID  string
+	refunded int64
+}
+
+var (
+	fakePaymentsMu sync.Mutex
+	fakePayments   = map[string]*fakePayment{}
+)
+
+type fakePaymentProvider struct{}
+
+func newFakePaymentProvider(settings models.PaymentSetting) (PaymentProvider, error) {
+	if !config.PaymentFakeProviderEnabled() {
+		return nil, fmt.Errorf("PROVIDER_NOT_SUPPORTED: cổng thanh toán giả lập chưa được bật")
+	}
+	return fakePaymentProvider{}, nil
+}
+
+func (fakePaymentProvider) Name() string {
+	return PaymentProviderFake
+}
+
+// CreatePayment lưu giao dịch chờ thanh toán
+func (fakePaymentProvider) CreatePayment(req PaymentRequest) (*PaymentResult, error) {
+	fakePaymentsMu.Lock()
+	fakePayments[req.Ref] = &fakePayment{amount: req.Amount, status: OrderPaymentPending}
+	fakePaymentsMu.Unlock()
+
+	return &PaymentResult{
+		Ref:    req.Ref,
+		PayURL: "fake://pay/" + url.PathEscape(req.Ref),
+	}, nil
+}
+
+// VerifyCallback kiểm tra chữ ký do SignFakePaymentCallback tạo
+func (fakePaymentProvider) VerifyCallback(params map[string]string) (*PaymentCallback, error) {
+	expected := fakePaymentSignature(params["ref"], params["amount"], params["status"], params["trans_id"])
+	if !hmac.Equal([]byte(expected), []byte(params["signature"])) {
+		return nil, fmt.Errorf("INVALID_SIGNATURE: chữ ký không hợp lệ")
+	}
+	amount, err := strconv.ParseInt(params["amount"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("INVALID_CALLBACK: số tiền không hợp lệ")
+	}
+	return &PaymentCallback{
+		Ref:     params["ref"],
+		TransID: params["trans_id"],
+		Amount:  amount,
+		Success: params["status"] == OrderPaymentPaid,
+		Message: params["status"],
+	}, nil
+}
+
+// QueryStatus đọc trạng thái giao dịch trong bộ nhớ
+func (fakePaymentProvider) QueryStatus(payment models.OrderPayment) (*PaymentStatusResult, error) {
+	fakePaymentsMu.Lock()
+	defer fakePaymentsMu.Unlock()
+
+	fp, ok := fakePayments[payment.ProviderRef]
+	if !ok {
+		return &PaymentStatusResult{Status: OrderPaymentPending}, nil
+	}
+	return &PaymentStatusResult{Status: fp.status, TransID: fp.transID, Amount: fp.amount}, nil
+}
+
+// Refund hoàn tiền trong bộ nhớ
+func (fakePaymentProvider) Refund(payment models.OrderPayment, req RefundRequest) (*RefundResult, error) {
+	fakePaymentsMu.Lock()
+	defer fakePaymentsMu.Unlock()
+
+	fp, ok := fakePayments[payment.ProviderRef]
+	if !ok || fp.status != OrderPaymentPaid {
+		return nil, fmt.Errorf("giao dịch chưa thanh toán")
+	}
+	if fp.refunded+req.Amount > fp.amount {
+		return nil, fmt.Errorf("số tiền hoàn vượt quá số tiền đã thanh toán")
+	}
+	fp.refunded += req.Amount
+	return &RefundResult{Status: RefundSucceeded, ProviderRefundID: "FAKE-" + req.RefundRef}, nil
+}
+
+// SetFakePaymentStatus giả lập khách thanh toán xong / thất bại trên cổng (dùng cho QueryStatus)
+func SetFakePaymentStatus(ref, status, transID string) {
+	fakePaymentsMu.Lock()
+	defer fakePaymentsMu.Unlock()
+
+	if fp, ok := fakePayments[ref]; ok {
+		fp.status = status
+		fp.transID = transID
+	}
+}
+
+// SignFakePaymentCallback tạo tham số callback hợp lệ gửi tới /webhooks/fake
+func SignFakePaymentCallback(ref string, amount int64, status, transID string) map[string]string {
+	amountStr := strconv.FormatInt(amount, 10)
+	return map[string]string{
+		"ref":       ref,
+		"amount":    amountStr,
+		"status":    status,
+		"trans_id":  transID,
+		"signature": fakePaymentSignature(ref, amountStr, status, transID),
+	}
+}
+
+func fakePaymentSignature(ref, amount, status, transID string) string {
+	mac := hmac.New(sha256.New, []byte(FakePaymentSecret))
+	mac.Write([]byte(ref + "|" + amount + "|" + status + "|" + transID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,700 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"go-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ===============================
+// LEDGER SERVICE
+// ===============================
+
+// Tài khoản sổ cái mặc định của mỗi nhà hàng
+const (
+	LedgerReceivable  = "receivable"    // Phải thu khách hàng
+	LedgerCash        = "cash"          // Tiền mặt tại quầy
+	LedgerBank        = "bank"          // Tiền gửi ngân hàng / ví điện tử (chuyển khoản, MoMo, VNPay)
+	LedgerRevenue     = "revenue"       // Doanh thu bán hàng
+	LedgerTips        = "tips"          // Tiền tip giữ hộ nhân viên (kể cả tiền khách chuyển dư)
+	LedgerRefunds     = "refunds"       // Hoàn tiền (giảm trừ doanh thu)
+	LedgerPlatformFee = "platform_fees" // Phí nền tảng (gói dịch vụ) / cổng thanh toán
+)
+
+// Loại bút toán
+const (
+	LedgerKindOrderPayment = "order_payment"
+	LedgerKindRefund       = "refund"
+	LedgerKindAdjustment   = "adjustment"
+	LedgerKindOverpayment  = "overpayment"
+	LedgerKindPlatformFee  = "platform_fee"
+)
+
+// LedgerAccountDefinition định nghĩa tài khoản mặc định
+type LedgerAccountDefinition struct {
+	Code string
+	Name string
+	Type string // asset, liability, revenue, contra_revenue, expense
+}
+
+// LedgerAccounts danh sách tài khoản mặc định (theo thứ tự hiển thị)
+var LedgerAccounts = []LedgerAccountDefinition{
+	{LedgerReceivable, "Phải thu khách hàng", "asset"},
+	{LedgerCash, "Tiền mặt", "asset"},
+	{LedgerBank, "Tiền gửi ngân hàng / ví điện tử", "asset"},
+	{LedgerRevenue, "Doanh thu bán hàng", "revenue"},
+	{LedgerTips, "Tiền tip", "liability"},
+	{LedgerRefunds, "Hoàn tiền cho khách", "contra_revenue"},
+	{LedgerPlatformFee, "Phí nền tảng / cổng thanh toán", "expense"},
+}
+
+// LedgerLine một dòng ghi Nợ hoặc Có
+type LedgerLine struct {
+	Account string  `json:"account" binding:"required"`
+	Debit   float64 `json:"debit" binding:"gte=0"`
+	Credit  float64 `json:"credit" binding:"gte=0"`
+}
+
+// LedgerPosting bút toán cần ghi
+type LedgerPosting struct {
+	RestaurantID   uint
+	Kind           string
+	ReferenceType  string
+	ReferenceID    uint
+	IdempotencyKey string
+	Description    string
+	CreatedBy      *uint
+	PostedAt       time.Time
+	Lines          []LedgerLine
+}
+
+// IsValidLedgerAccount kiểm tra mã tài khoản
+func IsValidLedgerAccount(code string) bool {
+	for _, def := range LedgerAccounts {
+		if def.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// EnsureLedgerAccounts tạo đủ tài khoản mặc định cho nhà hàng, trả về map theo mã
+func EnsureLedgerAccounts(db *gorm.DB, restaurantID uint) (map[string]models.LedgerAccount, error) {
+	var existing []models.LedgerAccount
+	if err := db.Where("restaurant_id = ?", restaurantID).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+
+	accounts := make(map[string]models.LedgerAccount, len(LedgerAccounts))
+	for _, account := range existing {
+		accounts[account.Code] = account
+	}
+
+	for _, def := range LedgerAccounts {
+		if _, ok := accounts[def.Code]; ok {
+			continue
+		}
+		account := models.LedgerAccount{
+			RestaurantID: restaurantID,
+			Code:         def.Code,
+			Name:         def.Name,
+			Type:         def.Type,
+		}
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&account).Error; err != nil {
+			return nil, err
+		}
+		if account.ID == 0 {
+			// Request khác vừa tạo cùng lúc
+			if err := db.Where("restaurant_id = ? AND code = ?", restaurantID, def.Code).First(&account).Error; err != nil {
+				return nil, err
+			}
+		}
+		accounts[def.Code] = account
+	}
+	return accounts, nil
+}
+
+// PostLedgerTransaction ghi bút toán cân bằng (tổng Nợ = tổng Có).
+// Bút toán trùng IdempotencyKey không được ghi lại, trả về bút toán đã có
+func PostLedgerTransaction(db *gorm.DB, posting LedgerPosting) (*models.LedgerTransaction, error) {
+	if len(posting.Lines) < 2 {
+		return nil, fmt.Errorf("LEDGER_UNBALANCED: bút toán cần ít nhất 2 dòng")
+	}
+
+	var totalDebit, totalCredit float64
+	for i, line := range posting.Lines {
+		line.Debit = math.Round(line.Debit)
+		line.Credit = math.Round(line.Credit)
+		if !IsValidLedgerAccount(line.Account) {
+			return nil, fmt.Errorf("INVALID_ACCOUNT: tài khoản %s không tồn tại", line.Account)
+		}
+		if line.Debit < 0 || line.Credit < 0 || (line.Debit > 0) == (line.Credit > 0) {
+			return nil, fmt.Errorf("LEDGER_INVALID_LINE: mỗi dòng chỉ ghi Nợ hoặc Có, số tiền dương")
+		}
+		posting.Lines[i] = line
+		totalDebit += line.Debit
+		totalCredit += line.Credit
+	}
+	if totalDebit != totalCredit {
+		return nil, fmt.Errorf("LEDGER_UNBALANCED: tổng Nợ %.0f khác tổng Có %.0f", totalDebit, totalCredit)
+	}
+
+	if posting.IdempotencyKey == "" {
+		posting.IdempotencyKey = posting.Kind + ":" + uuid.NewString()
+	}
+	if posting.PostedAt.IsZero() {
+		posting.PostedAt = time.Now()
+	}
+
+	var existing models.LedgerTransaction
+	if err := db.Where("idempotency_key = ?", posting.IdempotencyKey).First(&existing).Error; err == nil {
+		return &existing, nil
+	}
+
+	accounts, err := EnsureLedgerAccounts(db, posting.RestaurantID)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction := models.LedgerTransaction{
+		RestaurantID:   posting.RestaurantID,
+		Kind:           posting.Kind,
+		IdempotencyKey: posting.IdempotencyKey,
+		CreatedBy:      posting.CreatedBy,
+		PostedAt:       posting.PostedAt,
+	}
+	if posting.ReferenceType != "" {
+		transaction.ReferenceType = &posting.ReferenceType
+		transaction.ReferenceID = &posting.ReferenceID
+	}
+	if posting.Description != "" {
+		transaction.Description = &posting.Description
+	}
+	entries := make([]models.LedgerEntry, 0, len(posting.Lines))
+	for _, line := range posting.Lines {
+		entries = append(entries, models.LedgerEntry{
+			RestaurantID: posting.RestaurantID,
+			AccountID:    accounts[line.Account].ID,
+			Debit:        line.Debit,
+			Credit:       line.Credit,
+		})
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "idempotency_key"}}, DoNothing: true}).
+			Create(&transaction)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Request khác vừa ghi cùng bút toán
+			return tx.Where("idempotency_key = ?", posting.IdempotencyKey).First(&transaction).Error
+		}
+
+		for i := range entries {
+			entries[i].TransactionID = transaction.ID
+		}
+		if err := tx.Create(&entries).Error; err != nil {
+			return err
+		}
+		transaction.Entries = entries
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+// LedgerSettlementAccount tài khoản nhận tiền theo phương thức thanh toán
+func LedgerSettlementAccount(paymentMethod string) string {
+	if paymentMethod == "" || paymentMethod == "cash" {
+		return LedgerCash
+	}
+	return LedgerBank
+}
+
+// PostOrderPaymentLedger ghi nhận doanh thu và tiền thu của đơn đã thanh toán:
+// Nợ phải thu / Có doanh thu, Nợ tiền mặt|ngân hàng / Có phải thu
+func PostOrderPaymentLedger(db *gorm.DB, order models.Order) error {
+	if order.TotalAmount <= 0 {
+		return nil
+	}
+
+	method := ""
+	if order.PaymentMethod != nil {
+		method = *order.PaymentMethod
+	}
+	postedAt := time.Now()
+	if order.PaidAt != nil {
+		postedAt = *order.PaidAt
+	}
+
+	_, err := PostLedgerTransaction(db, LedgerPosting{
+		RestaurantID:   order.RestaurantID,
+		Kind:           LedgerKindOrderPayment,
+		ReferenceType:  "order",
+		ReferenceID:    order.ID,
+		IdempotencyKey: fmt.Sprintf("order:%d:paid", order.ID),
+		Description:    "Thanh toán đơn " + order.OrderNumber,
+		PostedAt:       postedAt,
+		Lines: []LedgerLine{
+			{Account: LedgerReceivable, Debit: order.TotalAmount},
+			{Account: LedgerRevenue, Credit: order.TotalAmount},
+			{Account: LedgerSettlementAccount(method), Debit: order.TotalAmount},
+			{Account: LedgerReceivable, Credit: order.TotalAmount},
+		},
+	})
+	return err
+}
+
+// PostOrderOverpaymentLedger ghi phần khách chuyển dư so với tổng tiền đơn vào tiền tip: Nợ tiền mặt|ngân hàng / Có tip
+func PostOrderOverpaymentLedger(db *gorm.DB, order models.Order, received float64) error {
+	excess := math.Round(received - order.TotalAmount)
+	if excess <= 0 {
+		return nil
+	}
+
+	method := ""
+	if order.PaymentMethod != nil {
+		method = *order.PaymentMethod
+	}
+	postedAt := time.Now()
+	if order.PaidAt != nil {
+		postedAt = *order.PaidAt
+	}
+
+	_, err := PostLedgerTransaction(db, LedgerPosting{
+		RestaurantID:   order.RestaurantID,
+		Kind:           LedgerKindOverpayment,
+		ReferenceType:  "order",
+		ReferenceID:    order.ID,
+		IdempotencyKey: fmt.Sprintf("order:%d:overpaid", order.ID),
+		Description:    "Khách chuyển dư đơn " + order.OrderNumber,
+		PostedAt:       postedAt,
+		Lines: []LedgerLine{
+			{Account: LedgerSettlementAccount(method), Debit: excess},
+			{Account: LedgerTips, Credit: excess},
+		},
+	})
+	return err
+}
+
+// PostOrderAdjustmentLedger ghi bút toán điều chỉnh khi tổng tiền của đơn đã ghi doanh thu thay đổi (sửa món, gộp đơn...):
+// tăng thì Nợ phải thu / Có doanh thu (khách còn nợ), giảm thì Nợ doanh thu / Có phải thu (còn nợ khách).
+// Đơn chưa ghi sổ thanh toán thì bỏ qua, doanh thu được ghi đúng tổng tiền lúc thanh toán
+func PostOrderAdjustmentLedger(db *gorm.DB, order models.Order, reason string) error {
+	if order.PaymentStatus != "paid" && order.PaymentStatus != "refunded" {
+		return nil
+	}
+
+	// Khóa đơn để hai lần điều chỉnh đồng thời không tính trên cùng số đã ghi
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Order{}, order.ID).Error; err != nil {
+		return err
+	}
+
+	posted, ok, err := OrderPostedRevenue(db, order.ID)
+	if err != nil || !ok {
+		return err
+	}
+	diff := math.Round(order.TotalAmount - posted)
+	if diff == 0 {
+		return nil
+	}
+
+	description := "Điều chỉnh đơn " + order.OrderNumber
+	if reason != "" {
+		description += ": " + reason
+	}
+	lines := []LedgerLine{
+		{Account: LedgerReceivable, Debit: diff},
+		{Account: LedgerRevenue, Credit: diff},
+	}
+	if diff < 0 {
+		lines = []LedgerLine{
+			{Account: LedgerRevenue, Debit: -diff},
+			{Account: LedgerReceivable, Credit: -diff},
+		}
+	}
+
+	_, err = PostLedgerTransaction(db, LedgerPosting{
+		RestaurantID:  order.RestaurantID,
+		Kind:          LedgerKindAdjustment,
+		ReferenceType: "order",
+		ReferenceID:   order.ID,
+		Description:   description,
+		Lines:         lines,
+	})
+	return err
+}
+
+// OrderPostedRevenue doanh thu đã ghi sổ cho đơn (thanh toán + điều chỉnh); ok = false nếu đơn chưa ghi sổ thanh toán
+func OrderPostedRevenue(db *gorm.DB, orderID uint) (float64, bool, error) {
+	var result struct {
+		Payments int64
+		Revenue  float64
+	}
+	err := db.Table("ledger_transactions t").
+		Select("COUNT(DISTINCT CASE WHEN t.kind = ? THEN t.id END) as payments, COALESCE(SUM(e.credit - e.debit), 0) as revenue", LedgerKindOrderPayment).
+		Joins("JOIN ledger_entries e ON e.transaction_id = t.id").
+		Joins("JOIN ledger_accounts a ON a.id = e.account_id").
+		Where("t.reference_type = 'order' AND t.reference_id = ? AND t.kind IN ? AND a.code = ?",
+			orderID, []string{LedgerKindOrderPayment, LedgerKindAdjustment}, LedgerRevenue).
+		Scan(&result).Error
+	return result.Revenue, result.Payments > 0, err
+}
+
+// PostPlatformFeeLedger ghi phí gói dịch vụ nhà hàng trả cho nền tảng: Nợ phí nền tảng / Có ngân hàng
+func PostPlatformFeeLedger(db *gorm.DB, restaurantID uint, subscription models.PackageSubscription, paidAt time.Time) error {
+	if subscription.Amount <= 0 {
+		return nil
+	}
+
+	_, err := PostLedgerTransaction(db, LedgerPosting{
+		RestaurantID:   restaurantID,
+		Kind:           LedgerKindPlatformFee,
+		ReferenceType:  "package_subscription",
+		ReferenceID:    subscription.ID,
+		IdempotencyKey: fmt.Sprintf("subscription:%d:paid", subscription.ID),
+		Description:    "Phí gói dịch vụ " + subscription.PaymentCode,
+		PostedAt:       paidAt,
+		Lines: []LedgerLine{
+			{Account: LedgerPlatformFee, Debit: subscription.Amount},
+			{Account: LedgerBank, Credit: subscription.Amount},
+		},
+	})
+	return err
+}
+
+// PostRefundLedger ghi nhận hoàn tiền: Nợ hoàn tiền / Có tiền mặt|ngân hàng
+func PostRefundLedger(db *gorm.DB, refund models.PaymentRefund, orderNumber string) error {
+	if refund.Status == RefundFailed || refund.Amount <= 0 {
+		return nil
+	}
+
+	method := refund.Provider
+	if method == PaymentProviderSepay {
+		method = "qr"
+	}
+
+	_, err := PostLedgerTransaction(db, LedgerPosting{
+		RestaurantID:   refund.RestaurantID,
+		Kind:           LedgerKindRefund,
+		ReferenceType:  "order",
+		ReferenceID:    refund.OrderID,
+		IdempotencyKey: fmt.Sprintf("refund:%d", refund.ID),
+		Description:    "Hoàn tiền đơn " + orderNumber,
+		CreatedBy:      refund.CreatedBy,
+		PostedAt:       refund.CreatedAt,
+		Lines: []LedgerLine{
+			{Account: LedgerRefunds, Debit: refund.Amount},
+			{Account: LedgerSettlementAccount(method), Credit: refund.Amount},
+		},
+	})
+	return err
+}
+
+// ===============================
+// LEDGER QUERIES
+// ===============================
+
+// LedgerAccountBalance số dư một tài khoản
+type LedgerAccountBalance struct {
+	Code    string  `json:"code"`
+	Name    string  `json:"name"`
+	Type    string  `json:"type"`
+	Debit   float64 `json:"debit"`
+	Credit  float64 `json:"credit"`
+	Balance float64 `json:"balance"` // Theo số dư thông thường: tài sản / chi phí / giảm trừ = Nợ - Có, còn lại = Có - Nợ
+}
+
+// GetLedgerBalances số dư các tài khoản của nhà hàng (from / to nil = không giới hạn)
+func GetLedgerBalances(db *gorm.DB, restaurantID uint, from, to *time.Time) ([]LedgerAccountBalance, error) {
+	query := db.Table("ledger_entries e").
+		Select("e.account_id, COALESCE(SUM(e.debit), 0) as debit, COALESCE(SUM(e.credit), 0) as credit").
+		Joins("JOIN ledger_transactions t ON t.id = e.transaction_id").
+		Where("e.restaurant_id = ?", restaurantID).
+		Group("e.account_id")
+	if from != nil {
+		query = query.Where("t.posted_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("t.posted_at < ?", *to)
+	}
+
+	var sums []struct {
+		AccountID uint
+		Debit     float64
+		Credit    float64
+	}
+	if err := query.Scan(&sums).Error; err != nil {
+		return nil, err
+	}
+	byAccount := make(map[uint]int, len(sums))
+	for i, s := range sums {
+		byAccount[s.AccountID] = i
+	}
+
+	var accounts []models.LedgerAccount
+	if err := db.Where("restaurant_id = ?", restaurantID).Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	accountByCode := make(map[string]models.LedgerAccount, len(accounts))
+	for _, account := range accounts {
+		accountByCode[account.Code] = account
+	}
+
+	balances := make([]LedgerAccountBalance, 0, len(LedgerAccounts))
+	for _, def := range LedgerAccounts {
+		balance := LedgerAccountBalance{Code: def.Code, Name: def.Name, Type: def.Type}
+		if account, ok := accountByCode[def.Code]; ok {
+			if i, ok := byAccount[account.ID]; ok {
+				balance.Debit = sums[i].Debit
+				balance.Credit = sums[i].Credit
+			}
+		}
+		if ledgerDebitNormal(def.Type) {
+			balance.Balance = balance.Debit - balance.Credit
+		} else {
+			balance.Balance = balance.Credit - balance.Debit
+		}
+		balances = append(balances, balance)
+	}
+	return balances, nil
+}
+
+// LedgerRevenueQuery dòng sổ cái của tài khoản doanh thu và hoàn tiền, kèm đơn hàng liên quan (alias e, t, o).
+// Doanh thu thuần = SUM(e.credit - e.debit), xem LedgerNetRevenueSQL
+func LedgerRevenueQuery(db *gorm.DB, restaurantID uint) *gorm.DB {
+	return db.Table("ledger_entries e").
+		Joins("JOIN ledger_accounts a ON a.id = e.account_id").
+		Joins("JOIN ledger_transactions t ON t.id = e.transaction_id").
+		Joins("LEFT JOIN orders o ON t.reference_type = 'order' AND o.id = t.reference_id").
+		Where("e.restaurant_id = ? AND a.code IN ?", restaurantID, []string{LedgerRevenue, LedgerRefunds})
+}
+
+// LedgerNetRevenueSQL biểu thức doanh thu thuần (doanh thu trừ hoàn tiền) dùng với LedgerRevenueQuery
+const LedgerNetRevenueSQL = "COALESCE(SUM(e.credit - e.debit), 0)"
+
+// LedgerPaidOrdersSQL số đơn được ghi nhận doanh thu, dùng với LedgerRevenueQuery
+const LedgerPaidOrdersSQL = "COUNT(DISTINCT CASE WHEN t.kind = 'order_payment' THEN t.reference_id END)"
+
+// ledgerDebitNormal tài khoản có số dư bên Nợ
+func ledgerDebitNormal(accountType string) bool {
+	return accountType == "asset" || accountType == "expense" || accountType == "contra_revenue"
+}
+
+// ===============================
+// LEDGER INVARIANTS
+// ===============================
+
+// LedgerViolation một vi phạm bất biến sổ cái
+type LedgerViolation struct {
+	RestaurantID uint   `json:"restaurant_id"`
+	Check        string `json:"check"`
+	Reference    string `json:"reference"`
+	Detail       string `json:"detail"`
+}
+
+// CheckLedgerInvariants kiểm tra sổ cái (restaurantID = 0: tất cả nhà hàng):
+// mọi bút toán cân bằng, tổng Nợ = tổng Có theo nhà hàng, dòng ghi đúng nhà hàng của bút toán,
+// đơn đã thanh toán có bút toán khớp số tiền, hoàn tiền đã ghi nhận có bút toán
+func CheckLedgerInvariants(db *gorm.DB, restaurantID uint) ([]LedgerViolation, error) {
+	violations := []LedgerViolation{}
+	scope := func(column string) func(*gorm.DB) *gorm.DB {
+		return func(q *gorm.DB) *gorm.DB {
+			if restaurantID != 0 {
+				return q.Where(column+" = ?", restaurantID)
+			}
+			return q
+		}
+	}
+
+	// 1. Bút toán cân bằng
+	var unbalanced []struct {
+		ID           uint
+		RestaurantID uint
+		Debit        float64
+		Credit       float64
+	}
+	if err := db.Table("ledger_transactions t").
+		Select("t.id, t.restaurant_id, COALESCE(SUM(e.debit), 0) as debit, COALESCE(SUM(e.credit), 0) as credit").
+		Joins("LEFT JOIN ledger_entries e ON e.transaction_id = t.id").
+		Scopes(scope("t.restaurant_id")).
+		Group("t.id, t.restaurant_id").
+		Having("COALESCE(SUM(e.debit), 0) <> COALESCE(SUM(e.credit), 0) OR COUNT(e.id) < 2").
+		Scan(&unbalanced).Error; err != nil {
+		return nil, err
+	}
+	for _, u := range unbalanced {
+		violations = append(violations, LedgerViolation{
+			RestaurantID: u.RestaurantID,
+			Check:        "transaction_balanced",
+			Reference:    fmt.Sprintf("ledger_transaction:%d", u.ID),
+			Detail:       fmt.Sprintf("Nợ %.0f, Có %.0f", u.Debit, u.Credit),
+		})
+	}
+
+	// 2. Tổng Nợ = tổng Có theo nhà hàng
+	var trial []struct {
+		RestaurantID uint
+		Debit        float64
+		Credit       float64
+	}
+	if err := db.Table("ledger_entries").
+		Select("restaurant_id, COALESCE(SUM(debit), 0) as debit, COALESCE(SUM(credit), 0) as credit").
+		Scopes(scope("restaurant_id")).
+		Group("restaurant_id").
+		Having("SUM(debit) <> SUM(credit)").
+		Scan(&trial).Error; err != nil {
+		return nil, err
+	}
+	for _, t := range trial {
+		violations = append(violations, LedgerViolation{
+			RestaurantID: t.RestaurantID,
+			Check:        "trial_balance",
+			Reference:    fmt.Sprintf("restaurant:%d", t.RestaurantID),
+			Detail:       fmt.Sprintf("Tổng Nợ %.0f, tổng Có %.0f", t.Debit, t.Credit),
+		})
+	}
+
+	// 3. Dòng ghi và tài khoản cùng nhà hàng với bút toán
+	var foreign []struct {
+		ID           uint
+		RestaurantID uint
+	}
+	if err := db.Table("ledger_entries e").
+		Select("e.id, t.restaurant_id").
+		Joins("JOIN ledger_transactions t ON t.id = e.transaction_id").
+		Joins("JOIN ledger_accounts a ON a.id = e.account_id").
+		Scopes(scope("t.restaurant_id")).
+		Where("e.restaurant_id <> t.restaurant_id OR a.restaurant_id <> t.restaurant_id").
+		Scan(&foreign).Error; err != nil {
+		return nil, err
+	}
+	for _, f := range foreign {
+		violations = append(violations, LedgerViolation{
+			RestaurantID: f.RestaurantID,
+			Check:        "entry_restaurant",
+			Reference:    fmt.Sprintf("ledger_entry:%d", f.ID),
+			Detail:       "Dòng ghi hoặc tài khoản thuộc nhà hàng khác",
+		})
+	}
+
+	// 4. Đơn đã thanh toán (hoặc đã hoàn) có bút toán doanh thu (thanh toán + điều chỉnh) khớp số tiền
+	var orders []struct {
+		ID           uint
+		RestaurantID uint
+		OrderNumber  string
+		TotalAmount  float64
+		Posted       *float64
+	}
+	if err := db.Table("orders o").
+		Select("o.id, o.restaurant_id, o.order_number, o.total_amount, "+
+			"(SELECT SUM(e.credit - e.debit) FROM ledger_transactions t JOIN ledger_entries e ON e.transaction_id = t.id JOIN ledger_accounts a ON a.id = e.account_id "+
+			"WHERE t.kind IN ? AND t.reference_type = 'order' AND t.reference_id = o.id AND a.code = ?) as posted",
+			[]string{LedgerKindOrderPayment, LedgerKindAdjustment}, LedgerRevenue).
+		Scopes(scope("o.restaurant_id")).
+		Where("o.payment_status IN ? AND o.total_amount > 0", []string{"paid", "refunded"}).
+		Scan(&orders).Error; err != nil {
+		return nil, err
+	}
+	for _, o := range orders {
+		switch {
+		case o.Posted == nil:
+			violations = append(violations, LedgerViolation{
+				RestaurantID: o.RestaurantID,
+				Check:        "order_posted",
+				Reference:    fmt.Sprintf("order:%d", o.ID),
+				Detail:       fmt.Sprintf("Đơn %s đã thanh toán nhưng chưa ghi sổ", o.OrderNumber),
+			})
+		case *o.Posted != o.TotalAmount:
+			violations = append(violations, LedgerViolation{
+				RestaurantID: o.RestaurantID,
+				Check:        "order_amount",
+				Reference:    fmt.Sprintf("order:%d", o.ID),
+				Detail:       fmt.Sprintf("Đơn %s: tổng tiền %.0f, ghi sổ %.0f", o.OrderNumber, o.TotalAmount, *o.Posted),
+			})
+		}
+	}
+
+	// 5. Hoàn tiền đã ghi nhận có bút toán
+	var refunds []struct {
+		ID           uint
+		RestaurantID uint
+		Amount       float64
+	}
+	if err := db.Table("payment_refunds r").
+		Select("r.id, r.restaurant_id, r.amount").
+		Scopes(scope("r.restaurant_id")).
+		Where("r.status <> ?", RefundFailed).
+		Where("NOT EXISTS (SELECT 1 FROM ledger_transactions t WHERE t.idempotency_key = 'refund:' || r.id)").
+		Scan(&refunds).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range refunds {
+		violations = append(violations, LedgerViolation{
+			RestaurantID: r.RestaurantID,
+			Check:        "refund_posted",
+			Reference:    fmt.Sprintf("payment_refund:%d", r.ID),
+			Detail:       fmt.Sprintf("Hoàn tiền %.0f chưa ghi sổ", r.Amount),
+		})
+	}
+
+	return violations, nil
+}
+
+// BackfillLedger ghi sổ cho đơn đã thanh toán và hoàn tiền có từ trước khi có sổ cái (an toàn khi chạy lại)
+func BackfillLedger(db *gorm.DB, restaurantID uint) (orders int, refunds int, err error) {
+	query := db.Model(&models.Order{}).
+		Where("payment_status IN ? AND total_amount > 0", []string{"paid", "refunded"}).
+		Where("NOT EXISTS (SELECT 1 FROM ledger_transactions t WHERE t.idempotency_key = 'order:' || orders.id || ':paid')")
+	if restaurantID != 0 {
+		query = query.Where("restaurant_id = ?", restaurantID)
+	}
+
+	var pending []models.Order
+	if err := query.Order("id").Find(&pending).Error; err != nil {
+		return 0, 0, err
+	}
+	for _, order := range pending {
+		if order.PaidAt == nil {
+			order.PaidAt = &order.UpdatedAt
+		}
+		if err := PostOrderPaymentLedger(db, order); err != nil {
+			return orders, refunds, fmt.Errorf("order %d: %w", order.ID, err)
+		}
+		orders++
+	}
+
+	refundQuery := db.Table("payment_refunds r").
+		Select("r.*, o.order_number").
+		Joins("JOIN orders o ON o.id = r.order_id").
+		Where("r.status <> ?", RefundFailed).
+		Where("NOT EXISTS (SELECT 1 FROM ledger_transactions t WHERE t.idempotency_key = 'refund:' || r.id)")
+	if restaurantID != 0 {
+		refundQuery = refundQuery.Where("r.restaurant_id = ?", restaurantID)
+	}
+
+	var pendingRefunds []struct {
+		models.PaymentRefund
+		OrderNumber string
+	}
+	if err := refundQuery.Order("r.id").Scan(&pendingRefunds).Error; err != nil {
+		return orders, refunds, err
+	}
+	for _, r := range pendingRefunds {
+		if err := PostRefundLedger(db, r.PaymentRefund, r.OrderNumber); err != nil {
+			return orders, refunds, fmt.Errorf("refund %d: %w", r.ID, err)
+		}
+		refunds++
+	}
+
+	return orders, refunds, nil
+}
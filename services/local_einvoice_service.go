@@ -0,0 +1,45 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"go-api/models"
+)
+
+// ===============================
+// LOCAL E-INVOICE PROVIDER
+// ===============================
+
+// Nhà cung cấp mặc định khi nhà hàng chưa kết nối nhà cung cấp hóa đơn điện tử: hóa đơn chỉ được đánh số,
+// lưu XML trên hệ thống và cấp mã tra cứu, KHÔNG gửi cơ quan thuế. Nhà hàng tải XML để nhập vào phần mềm
+// của nhà cung cấp cho tới khi đăng ký adapter riêng bằng RegisterEInvoiceProvider
+
+// EInvoiceProviderLocal tên nhà cung cấp lưu cục bộ
+const EInvoiceProviderLocal = "local"
+
+type localEInvoiceProvider struct{}
+
+func newLocalEInvoiceProvider(settings models.EInvoiceSetting) (EInvoiceProvider, error) {
+	return localEInvoiceProvider{}, nil
+}
+
+func (localEInvoiceProvider) Name() string {
+	return EInvoiceProviderLocal
+}
+
+func (localEInvoiceProvider) Issue(req EInvoiceRequest) (*EInvoiceResult, error) {
+	buf := make([]byte, 5)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	return &EInvoiceResult{
+		ProviderRef: strings.TrimSuffix(InvoiceFileName(req.Invoice), ".xml"),
+		LookupCode:  strings.ToUpper(hex.EncodeToString(buf)),
+	}, nil
+}
+
+func (localEInvoiceProvider) Cancel(invoice models.Invoice, reason string) error {
+	return nil
+}
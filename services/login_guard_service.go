@@ -0,0 +1,72 @@
+package services
+
+import (
+	"time"
+
+	"go-api/models"
+
+	"gorm.io/gorm"
+)
+
+// ===============================
+// LOGIN GUARD (khóa tạm thời khi sai nhiều lần)
+// ===============================
+
+const (
+	// loginLockThreshold số lần sai liên tiếp trước khi bắt đầu khóa
+	loginLockThreshold = 5
+	// loginLockBase thời gian khóa lần đầu, nhân đôi sau mỗi lần sai tiếp theo
+	loginLockBase = time.Minute
+	// loginLockMax thời gian khóa tối đa
+	loginLockMax = time.Hour
+)
+
+// LoginLockRemaining thời gian còn bị khóa (0 = không bị khóa)
+func LoginLockRemaining(user models.User) time.Duration {
+	if user.LockedUntil == nil {
+		return 0
+	}
+	remaining := time.Until(*user.LockedUntil)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// RecordFailedLogin ghi nhận một lần sai mật khẩu / mã 2FA, trả về thời gian bị khóa (0 = chưa khóa).
+// Từ lần sai thứ 5: khóa 1 phút, 2 phút, 4 phút... tối đa 1 giờ
+func RecordFailedLogin(db *gorm.DB, userID uint) (time.Duration, error) {
+	if err := db.Model(&models.User{}).Where("id = ?", userID).
+		Update("failed_login_count", gorm.Expr("failed_login_count + 1")).Error; err != nil {
+		return 0, err
+	}
+
+	var user models.User
+	if err := db.Select("id", "failed_login_count").First(&user, userID).Error; err != nil {
+		return 0, err
+	}
+	if user.FailedLoginCount < loginLockThreshold {
+		return 0, nil
+	}
+
+	lock := loginLockMax
+	if shift := user.FailedLoginCount - loginLockThreshold; shift < 6 {
+		lock = min(loginLockBase<<shift, loginLockMax)
+	}
+	if err := db.Model(&models.User{}).Where("id = ?", userID).
+		Update("locked_until", time.Now().Add(lock)).Error; err != nil {
+		return 0, err
+	}
+	return lock, nil
+}
+
+// ResetFailedLogins xóa bộ đếm sai sau khi đăng nhập thành công
+func ResetFailedLogins(db *gorm.DB, user models.User) error {
+	if user.FailedLoginCount == 0 && user.LockedUntil == nil {
+		return nil
+	}
+	return db.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"failed_login_count": 0,
+		"locked_until":       nil,
+	}).Error
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/config"
+)
+
+// ===============================
+// MAIL SERVICE
+// ===============================
+
+// MailMessage email cần gửi
+type MailMessage struct {
+	To      string
+	ToName  string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer giao diện gửi email (SMTP, ghi file, in console...)
+type Mailer interface {
+	Send(msg MailMessage) error
+}
+
+var (
+	mailerMu      sync.RWMutex
+	defaultMailer Mailer
+)
+
+// GetMailer trả về mailer theo cấu hình MAIL_DRIVER
+func GetMailer() Mailer {
+	mailerMu.RLock()
+	m := defaultMailer
+	mailerMu.RUnlock()
+	if m != nil {
+		return m
+	}
+
+	mailerMu.Lock()
+	defer mailerMu.Unlock()
+	if defaultMailer == nil {
+		defaultMailer = NewMailer(config.GetMailConfig())
+	}
+	return defaultMailer
+}
+
+// SetMailer thay mailer mặc định (dùng khi cần mailer riêng)
+func SetMailer(m Mailer) {
+	mailerMu.Lock()
+	defaultMailer = m
+	mailerMu.Unlock()
+}
+
+// NewMailer tạo mailer từ cấu hình
+func NewMailer(cfg *config.MailConfig) Mailer {
+	switch cfg.Driver {
+	case "smtp":
+		return &SMTPMailer{Config: cfg}
+	case "file":
+		return &FileMailer{Dir: cfg.OutputDir, FromEmail: cfg.FromEmail, FromName: cfg.FromName}
+	default:
+		return &ConsoleMailer{}
+	}
+}
+
+// SendMailAsync gửi email ở background, lỗi chỉ ghi log (không làm chậm request)
+func SendMailAsync(msg MailMessage) {
+	go func() {
+		if err := GetMailer().Send(msg); err != nil {
+			log.Printf("❌ Failed to send email to %s (%s): %v", msg.To, msg.Subject, err)
+		}
+	}()
+}
+
+// ===============================
+// SMTP
+// ===============================
+
+// SMTPMailer gửi email qua SMTP (587 STARTTLS, 465 TLS)
+type SMTPMailer struct {
+	Config *config.MailConfig
+}
+
+// Send gửi email qua SMTP
+func (m *SMTPMailer) Send(msg MailMessage) error {
+	cfg := m.Config
+	body, err := buildMIMEMessage(cfg.FromEmail, cfg.FromName, msg)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+
+	// Cổng 587/25: smtp.SendMail tự nâng cấp STARTTLS nếu server hỗ trợ
+	if cfg.Port != 465 {
+		return smtp.SendMail(addr, auth, cfg.FromEmail, []string{msg.To}, body)
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 15 * time.Second}, "tcp", addr, &tls.Config{ServerName: cfg.Host})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(cfg.FromEmail); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// ===============================
+// FILE / CONSOLE (dev)
+// ===============================
+
+// FileMailer ghi email ra file .eml (môi trường dev / staging)
+type FileMailer struct {
+	Dir       string
+	FromEmail string
+	FromName  string
+}
+
+// Send ghi email thành file .eml trong thư mục cấu hình
+func (m *FileMailer) Send(msg MailMessage) error {
+	body, err := buildMIMEMessage(m.FromEmail, m.FromName, msg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405"), hex.EncodeToString(suffix))
+	path := filepath.Join(m.Dir, name)
+	if err := os.WriteFile(path, body, 0o644); err != nil {
+		return err
+	}
+
+	log.Printf("📧 Email to %s saved: %s", msg.To, path)
+	return nil
+}
+
+// ConsoleMailer in email ra log (mặc định khi chưa cấu hình SMTP)
+type ConsoleMailer struct{}
+
+// Send in nội dung text của email ra log
+func (ConsoleMailer) Send(msg MailMessage) error {
+	log.Printf("📧 Email to %s\nSubject: %s\n\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// buildMIMEMessage tạo email multipart/alternative (text + HTML), tiêu đề mã hóa UTF-8
+func buildMIMEMessage(fromEmail, fromName string, msg MailMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	from := mail.Address{Name: fromName, Address: fromEmail}
+	to := mail.Address{Name: msg.ToName, Address: msg.To}
+
+	headers := []string{
+		"From: " + from.String(),
+		"To: " + to.String(),
+		"Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + writer.Boundary(),
+	}
+
+	var out bytes.Buffer
+	out.WriteString(strings.Join(headers, "\r\n"))
+	out.WriteString("\r\n\r\n")
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	}
+	for _, p := range parts {
+		if p.content == "" {
+			continue
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", p.contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		pw, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(pw)
+		if _, err := qp.Write([]byte(p.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	out.Write(buf.Bytes())
+	return out.Bytes(), nil
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// ===============================
+// MAIL TEMPLATES
+// ===============================
+
+// Mẫu email
+const (
+	MailTemplatePasswordReset = "password_reset"
+	MailTemplateEmailVerify   = "email_verify"
+)
+
+// Ngôn ngữ email
+const (
+	MailLocaleVI = "vi"
+	MailLocaleEN = "en"
+)
+
+// MailTemplateData dữ liệu điền vào mẫu email
+type MailTemplateData struct {
+	Name      string
+	ActionURL string
+	ExpiresIn string // Đã định dạng theo ngôn ngữ, vd "60 phút" / "60 minutes"
+}
+
+type mailTemplate struct {
+	Subject string
+	Heading string
+	Intro   string
+	Button  string
+	Outro   string
+}
+
+var mailTemplates = map[string]map[string]mailTemplate{
+	MailTemplatePasswordReset: {
+		MailLocaleVI: {
+			Subject: "Đặt lại mật khẩu",
+			Heading: "Xin chào {{.Name}},",
+			Intro:   "Chúng tôi nhận được yêu cầu đặt lại mật khẩu cho tài khoản của bạn. Liên kết có hiệu lực trong {{.ExpiresIn}} và chỉ dùng được một lần.",
+			Button:  "Đặt lại mật khẩu",
+			Outro:   "Nếu bạn không yêu cầu, hãy bỏ qua email này — mật khẩu của bạn sẽ không thay đổi.",
+		},
+		MailLocaleEN: {
+			Subject: "Reset your password",
+			Heading: "Hi {{.Name}},",
+			Intro:   "We received a request to reset the password for your account. The link is valid for {{.ExpiresIn}} and can only be used once.",
+			Button:  "Reset password",
+			Outro:   "If you didn't request this, you can ignore this email — your password will not change.",
+		},
+	},
+	MailTemplateEmailVerify: {
+		MailLocaleVI: {
+			Subject: "Xác thực địa chỉ email",
+			Heading: "Xin chào {{.Name}},",
+			Intro:   "Cảm ơn bạn đã đăng ký. Vui lòng xác thực địa chỉ email để hoàn tất tài khoản. Liên kết có hiệu lực trong {{.ExpiresIn}}.",
+			Button:  "Xác thực email",
+			Outro:   "Nếu bạn không tạo tài khoản, hãy bỏ qua email này.",
+		},
+		MailLocaleEN: {
+			Subject: "Verify your email address",
+			Heading: "Hi {{.Name}},",
+			Intro:   "Thanks for signing up. Please verify your email address to complete your account. The link is valid for {{.ExpiresIn}}.",
+			Button:  "Verify email",
+			Outro:   "If you didn't create an account, you can ignore this email.",
+		},
+	},
+}
+
+var mailHTMLLayout = htmltemplate.Must(htmltemplate.New("layout").Parse(`<!DOCTYPE html>
+<html>
+<body style="margin:0;padding:24px;background:#f5f5f5;font-family:Arial,Helvetica,sans-serif;color:#222">
+  <div style="max-width:520px;margin:0 auto;background:#fff;border-radius:8px;padding:32px">
+    <p style="font-size:16px;margin:0 0 16px">{{.Heading}}</p>
+    <p style="font-size:14px;line-height:1.6;margin:0 0 24px">{{.Intro}}</p>
+    <p style="text-align:center;margin:0 0 24px">
+      <a href="{{.ActionURL}}" style="display:inline-block;background:#e4572e;color:#fff;text-decoration:none;padding:12px 24px;border-radius:6px;font-weight:bold">{{.Button}}</a>
+    </p>
+    <p style="font-size:12px;color:#666;line-height:1.6;margin:0 0 8px">{{.ActionURL}}</p>
+    <p style="font-size:12px;color:#666;line-height:1.6;margin:0">{{.Outro}}</p>
+  </div>
+</body>
+</html>`))
+
+// NormalizeMailLocale chuẩn hóa ngôn ngữ (vd "en-US" -> "en"), mặc định tiếng Việt
+func NormalizeMailLocale(locale string) string {
+	if strings.HasPrefix(strings.ToLower(strings.TrimSpace(locale)), MailLocaleEN) {
+		return MailLocaleEN
+	}
+	return MailLocaleVI
+}
+
+// FormatMailDuration định dạng số phút theo ngôn ngữ email
+func FormatMailDuration(minutes int, locale string) string {
+	if NormalizeMailLocale(locale) == MailLocaleEN {
+		switch {
+		case minutes == 60:
+			return "1 hour"
+		case minutes%60 == 0:
+			return fmt.Sprintf("%d hours", minutes/60)
+		}
+		return fmt.Sprintf("%d minutes", minutes)
+	}
+	if minutes%60 == 0 {
+		return fmt.Sprintf("%d giờ", minutes/60)
+	}
+	return fmt.Sprintf("%d phút", minutes)
+}
+
+// RenderMail tạo email từ mẫu theo ngôn ngữ
+func RenderMail(templateName, locale string, to, toName string, data MailTemplateData) (MailMessage, error) {
+	locales, ok := mailTemplates[templateName]
+	if !ok {
+		return MailMessage{}, fmt.Errorf("unknown mail template %q", templateName)
+	}
+	tpl := locales[NormalizeMailLocale(locale)]
+
+	fill := func(s string) (string, error) {
+		t, err := texttemplate.New("").Parse(s)
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+
+	var filled [5]string
+	for i, s := range []string{tpl.Subject, tpl.Heading, tpl.Intro, tpl.Button, tpl.Outro} {
+		out, err := fill(s)
+		if err != nil {
+			return MailMessage{}, err
+		}
+		filled[i] = out
+	}
+	subject, heading, intro, button, outro := filled[0], filled[1], filled[2], filled[3], filled[4]
+
+	var html bytes.Buffer
+	if err := mailHTMLLayout.Execute(&html, map[string]string{
+		"Heading":   heading,
+		"Intro":     intro,
+		"Button":    button,
+		"Outro":     outro,
+		"ActionURL": data.ActionURL,
+	}); err != nil {
+		return MailMessage{}, err
+	}
+
+	text := strings.Join([]string{heading, intro, button + ": " + data.ActionURL, outro}, "\n\n")
+
+	return MailMessage{
+		To:      to,
+		ToName:  toName,
+		Subject: subject,
+		Text:    text,
+		HTML:    html.String(),
+	}, nil
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-api/config"
+	"go-api/models"
+
+	"github.com/skip2/go-qrcode"
+	"gorm.io/gorm"
+)
+
+// ===============================
+// MFA (TOTP - RFC 6238)
+// ===============================
+
+// Tham số TOTP tương thích Google Authenticator / Authy / 1Password
+const (
+	totpPeriod = 30 // giây
+	totpDigits = 6
+	totpSkew   = 1 // chấp nhận lệch ±1 bước (đồng hồ điện thoại lệch)
+
+	mfaRecoveryCodeCount = 10
+)
+
+// MFASetup thông tin thiết lập ứng dụng xác thực
+type MFASetup struct {
+	Secret     string `json:"secret"`      // Nhập tay nếu không quét được QR
+	OtpauthURI string `json:"otpauth_uri"` // otpauth://totp/...
+	QRCode     string `json:"qr_code"`     // data:image/png;base64,...
+}
+
+// BeginMFASetup tạo secret mới (chưa bật 2FA cho đến khi xác nhận mã đầu tiên)
+func BeginMFASetup(db *gorm.DB, user models.User) (*MFASetup, error) {
+	var existing models.UserMFA
+	db.Where("user_id = ?", user.ID).First(&existing)
+	if existing.EnabledAt != nil {
+		return nil, fmt.Errorf("MFA_ALREADY_ENABLED: xác thực 2 bước đã được bật")
+	}
+
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf)
+
+	encrypted, err := encryptMFASecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing.ID != 0 {
+		err = db.Model(&existing).Updates(map[string]interface{}{
+			"secret":         encrypted,
+			"last_used_step": 0,
+		}).Error
+	} else {
+		err = db.Create(&models.UserMFA{UserID: user.ID, Secret: encrypted}).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	uri := totpURI(config.MFAIssuer(), user.Email, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MFASetup{
+		Secret:     secret,
+		OtpauthURI: uri,
+		QRCode:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// ConfirmMFASetup xác nhận mã đầu tiên, bật 2FA và trả về bộ mã khôi phục (chỉ hiển thị một lần)
+func ConfirmMFASetup(tx *gorm.DB, userID uint, code string) ([]string, error) {
+	var mfa models.UserMFA
+	if err := tx.Where("user_id = ?", userID).First(&mfa).Error; err != nil {
+		return nil, fmt.Errorf("MFA_NOT_SETUP: chưa thiết lập ứng dụng xác thực")
+	}
+	if mfa.EnabledAt != nil {
+		return nil, fmt.Errorf("MFA_ALREADY_ENABLED: xác thực 2 bước đã được bật")
+	}
+
+	if err := checkTOTP(tx, &mfa, code); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Model(&mfa).Update("enabled_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+
+	return RegenerateRecoveryCodes(tx, userID)
+}
+
+// VerifyMFA kiểm tra mã TOTP hoặc mã khôi phục của user đã bật 2FA
+func VerifyMFA(tx *gorm.DB, userID uint, code, recoveryCode string) error {
+	var mfa models.UserMFA
+	if err := tx.Where("user_id = ? AND enabled_at IS NOT NULL", userID).First(&mfa).Error; err != nil {
+		return fmt.Errorf("MFA_NOT_ENABLED: chưa bật xác thực 2 bước")
+	}
+
+	if recoveryCode != "" {
+		return useRecoveryCode(tx, userID, recoveryCode)
+	}
+	return checkTOTP(tx, &mfa, code)
+}
+
+// IsMFAEnabled kiểm tra user đã bật 2FA chưa
+func IsMFAEnabled(db *gorm.DB, userID uint) bool {
+	var count int64
+	db.Model(&models.UserMFA{}).Where("user_id = ? AND enabled_at IS NOT NULL", userID).Count(&count)
+	return count > 0
+}
+
+// RemainingRecoveryCodes số mã khôi phục chưa dùng
+func RemainingRecoveryCodes(db *gorm.DB, userID uint) int64 {
+	var count int64
+	db.Model(&models.MFARecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count)
+	return count
+}
+
+// RegenerateRecoveryCodes tạo bộ mã khôi phục mới, bộ cũ mất hiệu lực
+func RegenerateRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, mfaRecoveryCodeCount)
+	records := make([]models.MFARecoveryCode, 0, mfaRecoveryCodeCount)
+	for i := 0; i < mfaRecoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(buf)) // 8 ký tự
+		code := raw[:4] + "-" + raw[4:]
+		codes = append(codes, code)
+		records = append(records, models.MFARecoveryCode{
+			UserID:   userID,
+			CodeHash: hashUserToken(normalizeRecoveryCode(code)),
+		})
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableMFA tắt 2FA và xóa mã khôi phục
+func DisableMFA(tx *gorm.DB, userID uint) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.UserMFA{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// checkTOTP kiểm tra mã TOTP và chặn dùng lại mã đã dùng
+func checkTOTP(tx *gorm.DB, mfa *models.UserMFA, code string) error {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return fmt.Errorf("INVALID_MFA_CODE: mã xác thực không đúng")
+	}
+
+	secret, err := decryptMFASecret(mfa.Secret)
+	if err != nil {
+		return fmt.Errorf("MFA_SECRET_INVALID: không đọc được secret, vui lòng thiết lập lại 2FA")
+	}
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return fmt.Errorf("MFA_SECRET_INVALID: không đọc được secret, vui lòng thiết lập lại 2FA")
+	}
+
+	current := time.Now().Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) != 1 {
+			continue
+		}
+		if step <= mfa.LastUsedStep {
+			return fmt.Errorf("MFA_CODE_USED: mã đã được sử dụng, vui lòng chờ mã mới")
+		}
+		result := tx.Model(&models.UserMFA{}).
+			Where("id = ? AND last_used_step < ?", mfa.ID, step).
+			Update("last_used_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("MFA_CODE_USED: mã đã được sử dụng, vui lòng chờ mã mới")
+		}
+		mfa.LastUsedStep = step
+		return nil
+	}
+
+	return fmt.Errorf("INVALID_MFA_CODE: mã xác thực không đúng")
+}
+
+// useRecoveryCode đánh dấu mã khôi phục đã dùng
+func useRecoveryCode(tx *gorm.DB, userID uint, code string) error {
+	result := tx.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashUserToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("INVALID_RECOVERY_CODE: mã khôi phục không đúng hoặc đã được sử dụng")
+	}
+	return nil
+}
+
+// normalizeRecoveryCode bỏ dấu gạch / khoảng trắng, chữ thường
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// totpCode tính mã TOTP (HMAC-SHA1, dynamic truncation) cho một bước thời gian
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// totpURI tạo otpauth URI cho ứng dụng xác thực
+func totpURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// mfaCipher AES-256-GCM với khóa dẫn xuất từ MFA_ENCRYPTION_KEY
+func mfaCipher() (cipher.AEAD, error) {
+	key := sha256.Sum256(config.MFAEncryptionKey())
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptMFASecret mã hóa secret TOTP trước khi lưu DB (nonce || ciphertext, base64)
+func encryptMFASecret(secret string) (string, error) {
+	gcm, err := mfaCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptMFASecret giải mã secret TOTP từ DB
+func decryptMFASecret(encrypted string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := mfaCipher()
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("ciphertext too short")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-api/config"
+	"go-api/models"
+)
+
+// MoMo Payment Gateway (API v2)
+// Documentation: https://developers.momo.vn/v3/docs/payment/api/wallet/onetime
+
+// Mã kết quả MoMo
+const (
+	momoResultSuccess    = 0
+	momoResultInitiated  = 1000 // Giao dịch đã khởi tạo, chờ người dùng xác nhận
+	momoResultProcessing = 7000
+	momoResultPending    = 7002
+	momoResultAuthorized = 9000 // Đã xác nhận, chờ capture (không dùng với captureWallet)
+)
+
+// momoPaymentProvider ví MoMo, ký HMAC-SHA256 bằng secret key của merchant
+type momoPaymentProvider struct {
+	partnerCode string
+	accessKey   string
+	secretKey   string
+	endpoint    string
+	client      *http.Client
+}
+
+func newMomoPaymentProvider(settings models.PaymentSetting) (PaymentProvider, error) {
+	if settings.MomoPartnerCode == nil || settings.MomoAccessKey == nil || settings.MomoSecretKey == nil ||
+		*settings.MomoPartnerCode == "" || *settings.MomoAccessKey == "" || *settings.MomoSecretKey == "" {
+		return nil, fmt.Errorf("MOMO_NOT_CONFIGURED: nhà hàng chưa cấu hình tài khoản MoMo")
+	}
+	return &momoPaymentProvider{
+		partnerCode: *settings.MomoPartnerCode,
+		accessKey:   *settings.MomoAccessKey,
+		secretKey:   *settings.MomoSecretKey,
+		endpoint:    config.MomoEndpoint(),
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (p *momoPaymentProvider) Name() string {
+	return PaymentProviderMomo
+}
+
+// momoCreateResponse response tạo thanh toán
+type momoCreateResponse struct {
+	PartnerCode  string `json:"partnerCode"`
+	OrderID      string `json:"orderId"`
+	RequestID    string `json:"requestId"`
+	Amount       int64  `json:"amount"`
+	ResponseTime int64  `json:"responseTime"`
+	Message      string `json:"message"`
+	ResultCode   int    `json:"resultCode"`
+	PayURL       string `json:"payUrl"`
+	Deeplink     string `json:"deeplink"`
+	QRCodeURL    string `json:"qrCodeUrl"`
+}
+
+// CreatePayment tạo giao dịch captureWallet, trả về trang thanh toán MoMo
+func (p *momoPaymentProvider) CreatePayment(req PaymentRequest) (*PaymentResult, error) {
+	amount := strconv.FormatInt(req.Amount, 10)
+	extraData := ""
+	requestType := "captureWallet"
+
+	raw := "accessKey=" + p.accessKey +
+		"&amount=" + amount +
+		"&extraData=" + extraData +
+		"&ipnUrl=" + req.NotifyURL +
+		"&orderId=" + req.Ref +
+		"&orderInfo=" + req.OrderInfo +
+		"&partnerCode=" + p.partnerCode +
+		"&redirectUrl=" + req.ReturnURL +
+		"&requestId=" + req.Ref +
+		"&requestType=" + requestType
+
+	body := map[string]interface{}{
+		"partnerCode":     p.partnerCode,
+		"requestId":       req.Ref,
+		"amount":          req.Amount,
+		"orderId":         req.Ref,
+		"orderInfo":       req.OrderInfo,
+		"redirectUrl":     req.ReturnURL,
+		"ipnUrl":          req.NotifyURL,
+		"requestType":     requestType,
+		"extraData":       extraData,
+		"lang":            "vi",
+		"orderExpireTime": int(OrderPaymentTTL / time.Minute),
+		"signature":       p.sign(raw),
+	}
+
+	var resp momoCreateResponse
+	if err := p.post("/v2/gateway/api/create", body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.ResultCode != momoResultSuccess {
+		return nil, fmt.Errorf("PROVIDER_ERROR: MoMo: %s (%d)", resp.Message, resp.ResultCode)
+	}
+
+	return &PaymentResult{
+		Ref:      req.Ref,
+		PayURL:   resp.PayURL,
+		Deeplink: resp.Deeplink,
+	}, nil
+}
+
+// VerifyCallback xác thực chữ ký IPN MoMo
+func (p *momoPaymentProvider) VerifyCallback(params map[string]string) (*PaymentCallback, error) {
+	raw := "accessKey=" + p.accessKey +
+		"&amount=" + params["amount"] +
+		"&extraData=" + params["extraData"] +
+		"&message=" + params["message"] +
+		"&orderId=" + params["orderId"] +
+		"&orderInfo=" + params["orderInfo"] +
+		"&orderType=" + params["orderType"] +
+		"&partnerCode=" + params["partnerCode"] +
+		"&payType=" + params["payType"] +
+		"&requestId=" + params["requestId"] +
+		"&responseTime=" + params["responseTime"] +
+		"&resultCode=" + params["resultCode"] +
+		"&transId=" + params["transId"]
+
+	if params["partnerCode"] != p.partnerCode || !hmac.Equal([]byte(p.sign(raw)), []byte(params["signature"])) {
+		return nil, fmt.Errorf("INVALID_SIGNATURE: chữ ký MoMo không hợp lệ")
+	}
+
+	amount, err := strconv.ParseInt(params["amount"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("INVALID_CALLBACK: số tiền không hợp lệ")
+	}
+
+	return &PaymentCallback{
+		Ref:     params["orderId"],
+		TransID: params["transId"],
+		Amount:  amount,
+		Success: params["resultCode"] == strconv.Itoa(momoResultSuccess),
+		Message: params["message"],
+	}, nil
+}
+
+// momoQueryResponse response tra cứu giao dịch
+type momoQueryResponse struct {
+	PartnerCode string `json:"partnerCode"`
+	OrderID     string `json:"orderId"`
+	RequestID   string `json:"requestId"`
+	Amount      int64  `json:"amount"`
+	TransID     int64  `json:"transId"`
+	PayType     string `json:"payType"`
+	ResultCode  int    `json:"resultCode"`
+	Message     string `json:"message"`
+}
+
+// QueryStatus tra cứu trạng thái giao dịch
+func (p *momoPaymentProvider) QueryStatus(payment models.OrderPayment) (*PaymentStatusResult, error) {
+	requestID, err := newOrderPaymentRef("Q" + payment.ProviderRef)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := "accessKey=" + p.accessKey +
+		"&orderId=" + payment.ProviderRef +
+		"&partnerCode=" + p.partnerCode +
+		"&requestId=" + requestID
+
+	var resp momoQueryResponse
+	if err := p.post("/v2/gateway/api/query", map[string]interface{}{
+		"partnerCode": p.partnerCode,
+		"requestId":   requestID,
+		"orderId":     payment.ProviderRef,
+		"lang":        "vi",
+		"signature":   p.sign(raw),
+	}, &resp); err != nil {
+		return nil, err
+	}
+
+	result := &PaymentStatusResult{
+		Amount:  resp.Amount,
+		Message: resp.Message,
+	}
+	switch resp.ResultCode {
+	case momoResultSuccess:
+		result.Status = OrderPaymentPaid
+		result.TransID = strconv.FormatInt(resp.TransID, 10)
+	case momoResultInitiated, momoResultProcessing, momoResultPending, momoResultAuthorized:
+		result.Status = OrderPaymentPending
+	default:
+		result.Status = OrderPaymentFailed
+	}
+	return result, nil
+}
+
+// momoRefundResponse response hoàn tiền
+type momoRefundResponse struct {
+	OrderID    string `json:"orderId"`
+	RequestID  string `json:"requestId"`
+	Amount     int64  `json:"amount"`
+	TransID    int64  `json:"transId"`
+	ResultCode int    `json:"resultCode"`
+	Message    string `json:"message"`
+}
+
+// Refund hoàn tiền (toàn phần hoặc một phần) theo transId của giao dịch gốc
+func (p *momoPaymentProvider) Refund(payment models.OrderPayment, req RefundRequest) (*RefundResult, error) {
+	if payment.ProviderTransID == nil {
+		return nil, fmt.Errorf("MISSING_TRANS_ID: giao dịch chưa có mã giao dịch MoMo")
+	}
+	transID, err := strconv.ParseInt(*payment.ProviderTransID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("MISSING_TRANS_ID: mã giao dịch MoMo không hợp lệ")
+	}
+
+	amount := strconv.FormatInt(req.Amount, 10)
+	raw := "accessKey=" + p.accessKey +
+		"&amount=" + amount +
+		"&description=" + req.Reason +
+		"&orderId=" + req.RefundRef +
+		"&partnerCode=" + p.partnerCode +
+		"&requestId=" + req.RefundRef +
+		"&transId=" + *payment.ProviderTransID
+
+	var resp momoRefundResponse
+	if err := p.post("/v2/gateway/api/refund", map[string]interface{}{
+		"partnerCode": p.partnerCode,
+		"orderId":     req.RefundRef,
+		"requestId":   req.RefundRef,
+		"amount":      req.Amount,
+		"transId":     transID,
+		"lang":        "vi",
+		"description": req.Reason,
+		"signature":   p.sign(raw),
+	}, &resp); err != nil {
+		return nil, err
+	}
+	if resp.ResultCode != momoResultSuccess {
+		return nil, fmt.Errorf("MoMo: %s (%d)", resp.Message, resp.ResultCode)
+	}
+
+	return &RefundResult{
+		Status:           RefundSucceeded,
+		ProviderRefundID: strconv.FormatInt(resp.TransID, 10),
+		Message:          resp.Message,
+	}, nil
+}
+
+// sign HMAC-SHA256 hex theo chuỗi rawSignature của MoMo
+func (p *momoPaymentProvider) sign(raw string) string {
+	mac := hmac.New(sha256.New, []byte(p.secretKey))
+	mac.Write([]byte(raw))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// post gửi request JSON tới MoMo
+func (p *momoPaymentProvider) post(path string, body interface{}, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Post(p.endpoint+path, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("PROVIDER_ERROR: không kết nối được MoMo: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("PROVIDER_ERROR: MoMo trả về dữ liệu không hợp lệ (HTTP %d)", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,796 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"go-api/config"
+	"go-api/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ===============================
+// PAYMENT PROVIDER INTERFACE
+// ===============================
+
+// Cổng thanh toán
+const (
+	PaymentProviderSepay = "sepay" // Chuyển khoản VietQR, xác nhận qua webhook SePay
+	PaymentProviderMomo  = "momo"
+	PaymentProviderVNPay = "vnpay"
+	PaymentProviderFake  = "fake" // Giả lập cho phát triển / kiểm thử
+)
+
+// Trạng thái thanh toán qua cổng
+const (
+	OrderPaymentPending           = "pending"
+	OrderPaymentPaid              = "paid"
+	OrderPaymentFailed            = "failed"
+	OrderPaymentCancelled         = "cancelled"
+	OrderPaymentRefunded          = "refunded"
+	OrderPaymentPartiallyRefunded = "partially_refunded"
+)
+
+// Trạng thái hoàn tiền
+const (
+	RefundPending   = "pending"
+	RefundSucceeded = "succeeded"
+	RefundFailed    = "failed"
+	RefundManual    = "manual" // Cổng không hỗ trợ hoàn tự động (chuyển khoản, tiền mặt): nhân viên tự hoàn cho khách
+)
+
+// OrderPaymentTTL thời gian hiệu lực của một lần thanh toán
+const OrderPaymentTTL = 15 * time.Minute
+
+// PaymentRequest thông tin tạo thanh toán gửi sang cổng
+type PaymentRequest struct {
+	Ref         string // Mã giao dịch phía mình, duy nhất theo cổng
+	OrderID     uint
+	OrderNumber string
+	Amount      int64 // VND
+	OrderInfo   string
+	ReturnURL   string // Trang kết quả cho khách sau khi thanh toán
+	NotifyURL   string // URL nhận IPN
+	ClientIP    string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// PaymentResult kết quả tạo thanh toán
+type PaymentResult struct {
+	Ref      string        // Cổng có thể dùng mã riêng (SePay dùng mã chuyển khoản của đơn)
+	PayURL   string        // Trang thanh toán của cổng
+	Deeplink string        // Mở thẳng ứng dụng ví (MoMo)
+	QR       *QRCodeResult // Chuyển khoản VietQR
+}
+
+// PaymentCallback nội dung IPN đã xác thực chữ ký
+type PaymentCallback struct {
+	Ref     string
+	TransID string
+	Amount  int64
+	Success bool
+	Message string
+}
+
+// PaymentStatusResult kết quả tra cứu trạng thái giao dịch trên cổng
+type PaymentStatusResult struct {
+	Status  string // pending, paid, failed
+	TransID string
+	Amount  int64
+	Message string
+}
+
+// RefundRequest yêu cầu hoàn tiền gửi sang cổng
+type RefundRequest struct {
+	RefundRef string // Mã yêu cầu hoàn tiền, duy nhất
+	Amount    int64
+	Reason    string
+	ClientIP  string
+	CreatedBy string
+}
+
+// RefundResult kết quả hoàn tiền
+type RefundResult struct {
+	Status           string // succeeded, pending, manual
+	ProviderRefundID string
+	Message          string
+}
+
+// PaymentProvider cổng thanh toán: tạo thanh toán, xác thực IPN, tra cứu trạng thái, hoàn tiền
+type PaymentProvider interface {
+	Name() string
+	CreatePayment(req PaymentRequest) (*PaymentResult, error)
+	VerifyCallback(params map[string]string) (*PaymentCallback, error)
+	QueryStatus(payment models.OrderPayment) (*PaymentStatusResult, error)
+	Refund(payment models.OrderPayment, req RefundRequest) (*RefundResult, error)
+}
+
+// PaymentProviderFactory tạo cổng thanh toán với tài khoản merchant của nhà hàng
+type PaymentProviderFactory func(settings models.PaymentSetting) (PaymentProvider, error)
+
+// PaymentCallbackRefFunc lấy mã giao dịch phía mình từ tham số IPN (trước khi xác thực chữ ký)
+type PaymentCallbackRefFunc func(params map[string]string) string
+
+type paymentProviderEntry struct {
+	callbackRef PaymentCallbackRefFunc
+	factory     PaymentProviderFactory
+}
+
+var paymentProviders = map[string]paymentProviderEntry{}
+
+// RegisterPaymentProvider đăng ký cổng thanh toán
+func RegisterPaymentProvider(name string, callbackRef PaymentCallbackRefFunc, factory PaymentProviderFactory) {
+	paymentProviders[name] = paymentProviderEntry{callbackRef: callbackRef, factory: factory}
+}
+
+// callbackParam mã giao dịch nằm nguyên trong một tham số IPN
+func callbackParam(key string) PaymentCallbackRefFunc {
+	return func(params map[string]string) string {
+		return params[key]
+	}
+}
+
+func init() {
+	RegisterPaymentProvider(PaymentProviderSepay, sepayCallbackRef, newSepayPaymentProvider)
+	RegisterPaymentProvider(PaymentProviderMomo, callbackParam("orderId"), newMomoPaymentProvider)
+	RegisterPaymentProvider(PaymentProviderVNPay, callbackParam("vnp_TxnRef"), newVNPayPaymentProvider)
+	RegisterPaymentProvider(PaymentProviderFake, callbackParam("ref"), newFakePaymentProvider)
+}
+
+// NewPaymentProvider tạo cổng thanh toán theo tên với cấu hình của nhà hàng
+func NewPaymentProvider(name string, settings models.PaymentSetting) (PaymentProvider, error) {
+	entry, ok := paymentProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("PROVIDER_NOT_SUPPORTED: cổng thanh toán %s không được hỗ trợ", name)
+	}
+	return entry.factory(settings)
+}
+
+// PaymentProviderForMethod cổng xử lý phương thức thanh toán của đơn (qr = chuyển khoản SePay)
+func PaymentProviderForMethod(method string) (string, bool) {
+	switch method {
+	case "qr":
+		return PaymentProviderSepay, true
+	case PaymentProviderMomo, PaymentProviderVNPay:
+		return method, true
+	case PaymentProviderFake:
+		return method, config.PaymentFakeProviderEnabled()
+	}
+	return "", false
+}
+
+// paymentMethodOf phương thức thanh toán lưu trên đơn theo cổng
+func paymentMethodOf(provider string) string {
+	if provider == PaymentProviderSepay {
+		return "qr"
+	}
+	return provider
+}
+
+// ===============================
+// ORDER PAYMENT FLOW
+// ===============================
+
+// OrderPaymentStart kết quả khởi tạo thanh toán đơn hàng
+type OrderPaymentStart struct {
+	Payment  models.OrderPayment
+	PayURL   string
+	Deeplink string
+	QR       *QRCodeResult
+}
+
+// StartOrderPayment tạo thanh toán cho đơn qua cổng tương ứng với phương thức (qr, momo, vnpay)
+func StartOrderPayment(db *gorm.DB, orderID uint, method, clientIP string) (*OrderPaymentStart, error) {
+	providerName, ok := PaymentProviderForMethod(method)
+	if !ok {
+		return nil, fmt.Errorf("INVALID_PAYMENT_METHOD: phương thức thanh toán không hỗ trợ thanh toán online")
+	}
+
+	var order models.Order
+	if err := db.Preload("Restaurant").First(&order, orderID).Error; err != nil {
+		return nil, fmt.Errorf("ORDER_NOT_FOUND: không tìm thấy đơn hàng")
+	}
+	if order.PaymentStatus == "paid" {
+		return nil, fmt.Errorf("ALREADY_PAID: đơn hàng đã được thanh toán")
+	}
+	if order.Status == "cancelled" || order.Status == "merged" {
+		return nil, fmt.Errorf("ORDER_CLOSED: đơn hàng đã đóng")
+	}
+
+	var settings models.PaymentSetting
+	if err := db.Where("restaurant_id = ?", order.RestaurantID).First(&settings).Error; err != nil {
+		return nil, fmt.Errorf("NO_PAYMENT_SETTINGS: nhà hàng chưa cấu hình thanh toán")
+	}
+	if (providerName == PaymentProviderMomo && !settings.AcceptMomo) || (providerName == PaymentProviderVNPay && !settings.AcceptVNPay) {
+		return nil, fmt.Errorf("PAYMENT_METHOD_DISABLED: nhà hàng chưa nhận thanh toán qua %s", providerName)
+	}
+
+	provider, err := NewPaymentProvider(providerName, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := newOrderPaymentRef(order.OrderNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Truncate(time.Second)
+	expiresAt := now.Add(OrderPaymentTTL)
+	returnURL := config.FrontendBaseURL() + "/order/" + fmt.Sprint(order.ID)
+	if order.Restaurant != nil {
+		returnURL = config.FrontendBaseURL() + "/" + order.Restaurant.Slug + "/order/" + fmt.Sprint(order.ID)
+	}
+
+	result, err := provider.CreatePayment(PaymentRequest{
+		Ref:         ref,
+		OrderID:     order.ID,
+		OrderNumber: order.OrderNumber,
+		Amount:      vndAmount(order.TotalAmount),
+		OrderInfo:   "Thanh toan don " + order.OrderNumber,
+		ReturnURL:   returnURL + "?payment=" + providerName,
+		NotifyURL:   config.APIBaseURL() + "/api/v1/webhooks/" + providerName,
+		ClientIP:    clientIP,
+		CreatedAt:   now,
+		ExpiresAt:   expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Ref != "" {
+		ref = result.Ref
+	}
+
+	payment := models.OrderPayment{
+		OrderID:      order.ID,
+		RestaurantID: order.RestaurantID,
+		Provider:     providerName,
+		ProviderRef:  ref,
+		Amount:       order.TotalAmount,
+		Status:       OrderPaymentPending,
+		ExpiresAt:    &expiresAt,
+		CreatedAt:    now,
+	}
+	if result.PayURL != "" {
+		payment.PayURL = &result.PayURL
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Lần thanh toán cũ chưa hoàn tất của đơn không còn hiệu lực
+		if err := tx.Model(&models.OrderPayment{}).
+			Where("order_id = ? AND status = ? AND NOT (provider = ? AND provider_ref = ?)", order.ID, OrderPaymentPending, providerName, ref).
+			Update("status", OrderPaymentCancelled).Error; err != nil {
+			return err
+		}
+
+		// SePay dùng lại mã chuyển khoản của đơn: cập nhật bản ghi cũ nếu có
+		var existing models.OrderPayment
+		if err := tx.Where("provider = ? AND provider_ref = ?", providerName, ref).First(&existing).Error; err == nil {
+			payment.ID = existing.ID
+			if err := tx.Model(&existing).Updates(map[string]interface{}{
+				"amount":         payment.Amount,
+				"status":         OrderPaymentPending,
+				"pay_url":        payment.PayURL,
+				"expires_at":     expiresAt,
+				"failure_reason": nil,
+			}).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Create(&payment).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&order).Updates(map[string]interface{}{
+			"payment_method":     paymentMethodOf(providerName),
+			"payment_status":     "pending",
+			"payment_expires_at": expiresAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &OrderPaymentStart{
+		Payment:  payment,
+		PayURL:   result.PayURL,
+		Deeplink: result.Deeplink,
+		QR:       result.QR,
+	}, nil
+}
+
+// HandlePaymentCallback xác thực IPN của cổng và cập nhật thanh toán.
+// Trả về lỗi có mã: PAYMENT_NOT_FOUND, INVALID_SIGNATURE, AMOUNT_MISMATCH, ALREADY_CONFIRMED
+func HandlePaymentCallback(db *gorm.DB, providerName string, params map[string]string) (*models.OrderPayment, error) {
+	entry, ok := paymentProviders[providerName]
+	if !ok {
+		return nil, fmt.Errorf("PROVIDER_NOT_SUPPORTED: cổng thanh toán %s không được hỗ trợ", providerName)
+	}
+
+	var payment models.OrderPayment
+	if err := db.Where("provider = ? AND provider_ref = ?", providerName, entry.callbackRef(params)).First(&payment).Error; err != nil {
+		return nil, fmt.Errorf("PAYMENT_NOT_FOUND: không tìm thấy giao dịch")
+	}
+
+	var settings models.PaymentSetting
+	db.Where("restaurant_id = ?", payment.RestaurantID).First(&settings)
+
+	provider, err := entry.factory(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	callback, err := provider.VerifyCallback(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if payment.Status != OrderPaymentPending && payment.Status != OrderPaymentFailed && payment.Status != OrderPaymentCancelled {
+		return &payment, fmt.Errorf("ALREADY_CONFIRMED: giao dịch đã được xử lý")
+	}
+	if callback.Amount != vndAmount(payment.Amount) {
+		return &payment, fmt.Errorf("AMOUNT_MISMATCH: số tiền không khớp, cần %d, nhận %d", vndAmount(payment.Amount), callback.Amount)
+	}
+
+	raw, _ := json.Marshal(params)
+	if !callback.Success {
+		if payment.Status == OrderPaymentPending {
+			failPendingOrderPayment(db, &payment, callback.Message, string(raw))
+		}
+		return &payment, nil
+	}
+
+	if err := completeProviderPayment(db, &payment, callback.TransID, string(raw)); err != nil {
+		return &payment, err
+	}
+	return &payment, nil
+}
+
+// RefreshOrderPayment tra cứu trạng thái trên cổng cho lần thanh toán đang chờ (khi khách quay về từ cổng)
+func RefreshOrderPayment(db *gorm.DB, payment *models.OrderPayment) error {
+	if payment.Status != OrderPaymentPending {
+		return nil
+	}
+
+	var settings models.PaymentSetting
+	db.Where("restaurant_id = ?", payment.RestaurantID).First(&settings)
+
+	provider, err := NewPaymentProvider(payment.Provider, settings)
+	if err != nil {
+		return err
+	}
+
+	status, err := provider.QueryStatus(*payment)
+	if err != nil {
+		return err
+	}
+
+	switch status.Status {
+	case OrderPaymentPaid:
+		if status.Amount != 0 && status.Amount != vndAmount(payment.Amount) {
+			return fmt.Errorf("AMOUNT_MISMATCH: số tiền không khớp, cần %d, nhận %d", vndAmount(payment.Amount), status.Amount)
+		}
+		return completeProviderPayment(db, payment, status.TransID, "")
+	case OrderPaymentFailed:
+		failPendingOrderPayment(db, payment, status.Message, "")
+	}
+	return nil
+}
+
+// LatestOrderPayment lần thanh toán qua cổng gần nhất của đơn
+func LatestOrderPayment(db *gorm.DB, orderID uint) (*models.OrderPayment, error) {
+	var payment models.OrderPayment
+	if err := db.Where("order_id = ?", orderID).Order("created_at DESC, id DESC").First(&payment).Error; err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// completeProviderPayment đánh dấu thanh toán thành công và đơn đã thanh toán (một lần duy nhất)
+func completeProviderPayment(db *gorm.DB, payment *models.OrderPayment, transID, raw string) error {
+	now := time.Now()
+	var order models.Order
+	var fromStatus string
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Khóa đơn trước: thanh toán tiền mặt / chuyển khoản / sửa món đồng thời chờ đến khi xong
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, payment.OrderID).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{
+			"status":         OrderPaymentPaid,
+			"paid_at":        now,
+			"failure_reason": nil,
+		}
+		if transID != "" {
+			updates["provider_trans_id"] = transID
+		}
+		if raw != "" {
+			updates["raw_callback"] = raw
+		}
+		result := tx.Model(&models.OrderPayment{}).
+			Where("id = ? AND status IN ?", payment.ID, []string{OrderPaymentPending, OrderPaymentFailed, OrderPaymentCancelled}).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("ALREADY_CONFIRMED: giao dịch đã được xử lý")
+		}
+
+		if order.PaymentStatus == "paid" {
+			// Đơn đã thu bằng cách khác (tiền mặt, chuyển khoản): giữ giao dịch để hoàn tiền / đối soát
+			log.Printf("⚠️ Order %d already paid, provider payment %d needs refund or reconciliation", order.ID, payment.ID)
+			return nil
+		}
+		// Tổng đơn tăng sau khi khách bắt đầu thanh toán (thêm / sửa / gộp món): số tiền đã trả không đủ
+		if vndAmount(payment.Amount) < vndAmount(order.TotalAmount) {
+			return fmt.Errorf("AMOUNT_MISMATCH: số tiền không khớp, đơn hiện cần %d, đã trả %d", vndAmount(order.TotalAmount), vndAmount(payment.Amount))
+		}
+
+		var err error
+		fromStatus, err = markOrderPaid(tx, &order, paymentMethodOf(payment.Provider), now)
+		if err != nil {
+			return err
+		}
+
+		transaction := models.PaymentTransaction{
+			TransactionType: "order",
+			ReferenceID:     order.ID,
+			ReferenceCode:   payment.ProviderRef,
+			Gateway:         &payment.Provider,
+			TransferType:    stringPtr("in"),
+			TransferAmount:  payment.Amount,
+			Status:          "completed",
+			VerifiedAt:      &now,
+		}
+		if transID != "" {
+			transaction.ReferenceNumber = &transID
+		}
+		if raw != "" {
+			transaction.RawWebhookData = &raw
+		}
+		return tx.Create(&transaction).Error
+	})
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "AMOUNT_MISMATCH") {
+			// Tiền đã trừ trên cổng nhưng không đủ cho đơn: nhân viên hoàn tiền hoặc thu thêm
+			log.Printf("⚠️ Provider payment %d for order %d is short: %v", payment.ID, payment.OrderID, err)
+			db.Model(&models.OrderPayment{}).Where("id = ?", payment.ID).Update("failure_reason", err.Error())
+		}
+		return err
+	}
+
+	payment.Status = OrderPaymentPaid
+	payment.PaidAt = &now
+	if transID != "" {
+		payment.ProviderTransID = &transID
+	}
+
+	if fromStatus != "" {
+		log.Printf("✅ Order payment completed via %s: OrderID=%d, Ref=%s", payment.Provider, order.ID, payment.ProviderRef)
+		publishOrderPaid(order, fromStatus)
+	}
+	return nil
+}
+
+// CancelPendingOrderPayments hủy các lần thanh toán qua cổng đang chờ khi tổng tiền đơn thay đổi, khách tạo lại theo số tiền mới.
+// SePay không bị hủy: mã chuyển khoản được giữ và số tiền được kiểm tra khi tiền về
+func CancelPendingOrderPayments(tx *gorm.DB, orderIDs ...uint) error {
+	return tx.Model(&models.OrderPayment{}).
+		Where("order_id IN ? AND status = ? AND provider <> ?", orderIDs, OrderPaymentPending, PaymentProviderSepay).
+		Updates(map[string]interface{}{
+			"status":         OrderPaymentCancelled,
+			"failure_reason": "Tổng tiền đơn đã thay đổi",
+		}).Error
+}
+
+// failPendingOrderPayment ghi nhận thanh toán thất bại, đơn quay về chưa thanh toán để khách thử lại
+func failPendingOrderPayment(db *gorm.DB, payment *models.OrderPayment, reason, raw string) {
+	updates := map[string]interface{}{
+		"status":         OrderPaymentFailed,
+		"failure_reason": reason,
+	}
+	if raw != "" {
+		updates["raw_callback"] = raw
+	}
+	db.Model(&models.OrderPayment{}).Where("id = ? AND status = ?", payment.ID, OrderPaymentPending).Updates(updates)
+	db.Model(&models.Order{}).
+		Where("id = ? AND payment_status = ?", payment.OrderID, "pending").
+		Update("payment_status", "unpaid")
+
+	payment.Status = OrderPaymentFailed
+	payment.FailureReason = &reason
+}
+
+// markOrderPaid cập nhật đơn đã thanh toán; đơn mang về / giao hàng trả trước được tự xác nhận để bếp làm luôn.
+// Tiền về sau khi ngày đã chốt sổ được ghi nhận vào ngày kinh doanh tiếp theo chưa chốt.
+// Trả về trạng thái đơn trước khi cập nhật
+func markOrderPaid(tx *gorm.DB, order *models.Order, paymentMethod string, paidAt time.Time) (string, error) {
+	fromStatus := order.Status
+	paidAt = NextOpenBusinessTime(tx, order.RestaurantID, paidAt)
+	updates := map[string]interface{}{
+		"payment_status": "paid",
+		"payment_method": paymentMethod,
+		"paid_at":        paidAt,
+	}
+
+	prepaidOffPremise := order.OrderType == "takeaway" || order.OrderType == "delivery"
+	if prepaidOffPremise && order.Status == "pending" {
+		updates["status"] = "confirmed"
+	}
+
+	// Chỉ một luồng được ghi nhận thanh toán (tiền mặt, chuyển khoản, cổng, gán thủ công có thể chạy đồng thời)
+	result := tx.Model(&models.Order{}).Where("id = ? AND payment_status <> ?", order.ID, "paid").Updates(updates)
+	if result.Error != nil {
+		return fromStatus, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fromStatus, fmt.Errorf("ALREADY_PAID: Đơn hàng đã được thanh toán")
+	}
+
+	if prepaidOffPremise {
+		if err := tx.Model(&models.OrderItem{}).
+			Where("order_id = ? AND prep_status = ?", order.ID, "pending").
+			Update("prep_status", "confirmed").Error; err != nil {
+			return fromStatus, err
+		}
+	}
+
+	order.PaymentStatus = "paid"
+	order.PaymentMethod = &paymentMethod
+	order.PaidAt = &paidAt
+	if status, ok := updates["status"].(string); ok {
+		order.Status = status
+	}
+
+	if err := PostOrderPaymentLedger(tx, *order); err != nil {
+		return fromStatus, err
+	}
+	return fromStatus, nil
+}
+
+// publishOrderPaid phát sự kiện order.paid (và order.status_changed nếu đơn được tự xác nhận)
+func publishOrderPaid(order models.Order, fromStatus string) {
+	PublishOrderEvent(WebhookEventOrderPaid, order)
+	if fromStatus != order.Status {
+		PublishEvent(WebhookEventOrderStatusChanged, order.RestaurantID, map[string]interface{}{
+			"order_id":      order.ID,
+			"order_number":  order.OrderNumber,
+			"order_type":    order.OrderType,
+			"pickup_number": order.PickupNumber,
+			"from_status":   fromStatus,
+			"status":        order.Status,
+		})
+	}
+}
+
+// ===============================
+// REFUNDS
+// ===============================
+
+// RefundOrderPayment hoàn tiền cho đơn đã thanh toán. amount = 0 nghĩa là hoàn toàn bộ số tiền còn lại.
+// Đơn thanh toán qua MoMo / VNPay được hoàn qua cổng; chuyển khoản, tiền mặt được ghi nhận để nhân viên tự hoàn.
+// Hoàn qua cổng: khóa đơn và tạo bản ghi pending giữ chỗ số tiền trước khi gọi cổng, để hai yêu cầu đồng thời
+// không hoàn quá số đã thu và lần hoàn cổng đã thực hiện luôn có bản ghi
+func RefundOrderPayment(db *gorm.DB, orderID uint, amount float64, reason string, userID uint, clientIP string) (*models.PaymentRefund, error) {
+	var order models.Order
+	var payment *models.OrderPayment
+	var refund models.PaymentRefund
+	var paidAmount float64
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+			return fmt.Errorf("ORDER_NOT_FOUND: không tìm thấy đơn hàng")
+		}
+		if order.PaymentStatus != "paid" {
+			return fmt.Errorf("NOT_PAID: đơn hàng chưa thanh toán hoặc đã hoàn tiền")
+		}
+		if err := EnsureDayOpen(tx, order.RestaurantID, time.Now()); err != nil {
+			return err
+		}
+
+		var paid models.OrderPayment
+		if err := tx.Where("order_id = ? AND status IN ?", order.ID, []string{OrderPaymentPaid, OrderPaymentPartiallyRefunded}).
+			Order("paid_at DESC").First(&paid).Error; err == nil {
+			payment = &paid
+		}
+
+		// Số tiền còn có thể hoàn (tính cả các lần hoàn đang chờ cổng xử lý)
+		paidAmount = order.TotalAmount
+		if payment != nil {
+			paidAmount = payment.Amount
+		}
+		refunded, err := sumOrderRefunds(tx, order.ID, payment, RefundFailed)
+		if err != nil {
+			return err
+		}
+		remaining := paidAmount - refunded
+		if amount == 0 {
+			amount = remaining
+		}
+		amount = math.Round(amount)
+		if amount <= 0 || amount > remaining {
+			return fmt.Errorf("INVALID_AMOUNT: số tiền hoàn phải từ 1 đến %.0f", remaining)
+		}
+
+		refund = models.PaymentRefund{
+			OrderID:      order.ID,
+			RestaurantID: order.RestaurantID,
+			Amount:       amount,
+			Status:       RefundPending,
+			CreatedBy:    &userID,
+		}
+		if reason != "" {
+			refund.Reason = &reason
+		}
+
+		if payment != nil {
+			refund.Provider = payment.Provider
+			refund.OrderPaymentID = &payment.ID
+			return tx.Create(&refund).Error
+		}
+
+		// Thu tiền mặt / xác nhận tay: nhân viên hoàn trực tiếp cho khách, ghi nhận luôn
+		refund.Provider = "cash"
+		if order.PaymentMethod != nil && *order.PaymentMethod != "" {
+			refund.Provider = *order.PaymentMethod
+		}
+		refund.Status = RefundManual
+		if refund.Provider == "cash" {
+			if shift, _ := CurrentCashShift(tx, order.RestaurantID, userID); shift != nil {
+				refund.CashShiftID = &shift.ID
+			}
+		}
+		if err := tx.Create(&refund).Error; err != nil {
+			return err
+		}
+		return settleOrderRefund(tx, &order, nil, refund, paidAmount)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if payment != nil {
+		result, err := refundViaProvider(db, order, *payment, refund, reason, userID, clientIP)
+		if err != nil {
+			msg := err.Error()
+			refund.Status = RefundFailed
+			refund.ErrorMessage = &msg
+			db.Model(&refund).Updates(map[string]interface{}{"status": RefundFailed, "error_message": msg})
+			return &refund, fmt.Errorf("REFUND_FAILED: %s", msg)
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, order.ID).Error; err != nil {
+				return err
+			}
+			updates := map[string]interface{}{"status": result.Status}
+			if result.ProviderRefundID != "" {
+				updates["provider_refund_id"] = result.ProviderRefundID
+			}
+			if err := tx.Model(&refund).Updates(updates).Error; err != nil {
+				return err
+			}
+			refund.Status = result.Status
+			if result.ProviderRefundID != "" {
+				refund.ProviderRefundID = &result.ProviderRefundID
+			}
+			return settleOrderRefund(tx, &order, payment, refund, paidAmount)
+		})
+		if err != nil {
+			// Cổng đã hoàn tiền: bản ghi pending vẫn giữ số tiền, bút toán được bù bằng BackfillLedger
+			log.Printf("❌ Refund %d succeeded at %s (%s) but could not be recorded: %v", refund.ID, payment.Provider, result.ProviderRefundID, err)
+			return &refund, fmt.Errorf("REFUND_NOT_RECORDED: cổng đã hoàn tiền nhưng chưa lưu được kết quả (refund #%d)", refund.ID)
+		}
+	}
+
+	fullyRefunded := order.PaymentStatus == "refunded"
+	PublishEvent("order.refunded", order.RestaurantID, map[string]interface{}{
+		"order_id":      order.ID,
+		"order_number":  order.OrderNumber,
+		"refund_id":     refund.ID,
+		"amount":        refund.Amount,
+		"status":        refund.Status,
+		"full_refunded": fullyRefunded,
+	})
+
+	return &refund, nil
+}
+
+// refundViaProvider gọi cổng hoàn tiền cho bản ghi hoàn tiền đã giữ chỗ
+func refundViaProvider(db *gorm.DB, order models.Order, payment models.OrderPayment, refund models.PaymentRefund, reason string, userID uint, clientIP string) (*RefundResult, error) {
+	var settings models.PaymentSetting
+	db.Where("restaurant_id = ?", payment.RestaurantID).First(&settings)
+
+	provider, err := NewPaymentProvider(payment.Provider, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	refundRef, err := newOrderPaymentRef("RF" + order.OrderNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	return provider.Refund(payment, RefundRequest{
+		RefundRef: refundRef,
+		Amount:    vndAmount(refund.Amount),
+		Reason:    reason,
+		ClientIP:  clientIP,
+		CreatedBy: fmt.Sprint(userID),
+	})
+}
+
+// settleOrderRefund ghi sổ lần hoàn tiền đã hoàn tất và cập nhật trạng thái thanh toán / đơn.
+// Đơn chỉ chuyển refunded khi các lần hoàn đã hoàn tất đủ số tiền đã thu
+func settleOrderRefund(tx *gorm.DB, order *models.Order, payment *models.OrderPayment, refund models.PaymentRefund, paidAmount float64) error {
+	if err := PostRefundLedger(tx, refund, order.OrderNumber); err != nil {
+		return err
+	}
+
+	settled, err := sumOrderRefunds(tx, order.ID, payment, RefundFailed, RefundPending)
+	if err != nil {
+		return err
+	}
+	fullyRefunded := settled >= paidAmount
+
+	if payment != nil {
+		status := OrderPaymentPartiallyRefunded
+		if fullyRefunded {
+			status = OrderPaymentRefunded
+		}
+		if err := tx.Model(payment).Updates(map[string]interface{}{
+			"refunded_amount": gorm.Expr("refunded_amount + ?", refund.Amount),
+			"status":          status,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	if fullyRefunded {
+		if err := tx.Model(order).Update("payment_status", "refunded").Error; err != nil {
+			return err
+		}
+		order.PaymentStatus = "refunded"
+	}
+	return nil
+}
+
+// sumOrderRefunds tổng tiền hoàn của đơn (của lần thanh toán nếu payment != nil), bỏ qua các trạng thái excluded
+func sumOrderRefunds(tx *gorm.DB, orderID uint, payment *models.OrderPayment, excluded ...string) (float64, error) {
+	query := tx.Model(&models.PaymentRefund{}).Where("order_id = ? AND status NOT IN ?", orderID, excluded)
+	if payment != nil {
+		query = query.Where("order_payment_id = ?", payment.ID)
+	}
+	var total float64
+	err := query.Select("COALESCE(SUM(amount), 0)").Scan(&total).Error
+	return total, err
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// newOrderPaymentRef mã giao dịch gửi sang cổng: mã đơn (bỏ dấu -) + hậu tố ngẫu nhiên, chỉ gồm chữ và số
+func newOrderPaymentRef(orderNumber string) (string, error) {
+	buf := make([]byte, 3)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(orderNumber, "-", "") + strings.ToUpper(hex.EncodeToString(buf)), nil
+}
+
+// vndAmount số tiền VND nguyên gửi sang cổng
+func vndAmount(amount float64) int64 {
+	return int64(math.Round(amount))
+}
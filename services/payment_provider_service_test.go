@@ -0,0 +1,303 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"go-api/models"
+
+	"gorm.io/gorm"
+)
+
+// paidFakeOrder đơn mang về đã thanh toán qua cổng giả lập (tạo thanh toán + callback hợp lệ)
+func paidFakeOrder(t *testing.T, db *gorm.DB, total float64) (models.Order, models.OrderPayment) {
+	t.Helper()
+	t.Setenv("PAYMENT_FAKE_PROVIDER", "true")
+
+	order := createTestOrder(t, db, total)
+	start, err := StartOrderPayment(db, order.ID, PaymentProviderFake, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("StartOrderPayment: %v", err)
+	}
+
+	// Khách trả tiền trên cổng, cổng gửi IPN
+	SetFakePaymentStatus(start.Payment.ProviderRef, OrderPaymentPaid, "FAKE-TRANS-1")
+	params := SignFakePaymentCallback(start.Payment.ProviderRef, int64(total), OrderPaymentPaid, "FAKE-TRANS-1")
+	payment, err := HandlePaymentCallback(db, PaymentProviderFake, params)
+	if err != nil {
+		t.Fatalf("HandlePaymentCallback: %v", err)
+	}
+
+	db.First(&order, order.ID)
+	return order, *payment
+}
+
+func errorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	code, _, _ := strings.Cut(err.Error(), ": ")
+	return code
+}
+
+func TestFakeProviderCallbackMarksOrderPaid(t *testing.T) {
+	db := newTestDB(t)
+	order, payment := paidFakeOrder(t, db, 120000)
+
+	if payment.Status != OrderPaymentPaid {
+		t.Errorf("payment status = %q, want %q", payment.Status, OrderPaymentPaid)
+	}
+	if order.PaymentStatus != "paid" || order.PaidAt == nil {
+		t.Errorf("order payment_status = %q, paid_at = %v, want paid", order.PaymentStatus, order.PaidAt)
+	}
+	// Đơn mang về trả trước được tự xác nhận
+	if order.Status != "confirmed" {
+		t.Errorf("order status = %q, want confirmed", order.Status)
+	}
+
+	revenue, posted, err := OrderPostedRevenue(db, order.ID)
+	if err != nil || !posted || revenue != 120000 {
+		t.Errorf("posted revenue = %.0f (posted %v, err %v), want 120000", revenue, posted, err)
+	}
+
+	var transactions int64
+	db.Model(&models.PaymentTransaction{}).Where("reference_id = ? AND transaction_type = ?", order.ID, "order").Count(&transactions)
+	if transactions != 1 {
+		t.Errorf("payment transactions = %d, want 1", transactions)
+	}
+}
+
+func TestFakeProviderCallbackRejectsBadSignatureAndReplay(t *testing.T) {
+	db := newTestDB(t)
+	t.Setenv("PAYMENT_FAKE_PROVIDER", "true")
+
+	order := createTestOrder(t, db, 50000)
+	start, err := StartOrderPayment(db, order.ID, PaymentProviderFake, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("StartOrderPayment: %v", err)
+	}
+
+	forged := SignFakePaymentCallback(start.Payment.ProviderRef, 50000, OrderPaymentPaid, "T1")
+	forged["amount"] = "1000"
+	if _, err := HandlePaymentCallback(db, PaymentProviderFake, forged); errorCode(err) != "INVALID_SIGNATURE" {
+		t.Fatalf("forged callback error = %v, want INVALID_SIGNATURE", err)
+	}
+
+	short := SignFakePaymentCallback(start.Payment.ProviderRef, 1000, OrderPaymentPaid, "T1")
+	if _, err := HandlePaymentCallback(db, PaymentProviderFake, short); errorCode(err) != "AMOUNT_MISMATCH" {
+		t.Fatalf("wrong amount error = %v, want AMOUNT_MISMATCH", err)
+	}
+
+	valid := SignFakePaymentCallback(start.Payment.ProviderRef, 50000, OrderPaymentPaid, "T1")
+	if _, err := HandlePaymentCallback(db, PaymentProviderFake, valid); err != nil {
+		t.Fatalf("valid callback: %v", err)
+	}
+	if _, err := HandlePaymentCallback(db, PaymentProviderFake, valid); errorCode(err) != "ALREADY_CONFIRMED" {
+		t.Fatalf("replayed callback error = %v, want ALREADY_CONFIRMED", err)
+	}
+}
+
+func TestRefundOrderPaymentPartialThenFull(t *testing.T) {
+	db := newTestDB(t)
+	order, payment := paidFakeOrder(t, db, 100000)
+
+	refund, err := RefundOrderPayment(db, order.ID, 30000, "thiếu món", 1, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("partial refund: %v", err)
+	}
+	if refund.Status != RefundSucceeded || refund.ProviderRefundID == nil {
+		t.Errorf("refund status = %q, provider id = %v, want succeeded with id", refund.Status, refund.ProviderRefundID)
+	}
+	db.First(&payment, payment.ID)
+	if payment.Status != OrderPaymentPartiallyRefunded || payment.RefundedAmount != 30000 {
+		t.Errorf("payment = %q / %.0f, want partially_refunded / 30000", payment.Status, payment.RefundedAmount)
+	}
+
+	if _, err := RefundOrderPayment(db, order.ID, 80000, "", 1, "127.0.0.1"); errorCode(err) != "INVALID_AMOUNT" {
+		t.Fatalf("over-refund error = %v, want INVALID_AMOUNT", err)
+	}
+
+	// amount = 0: hoàn phần còn lại
+	refund, err = RefundOrderPayment(db, order.ID, 0, "", 1, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("full refund: %v", err)
+	}
+	if refund.Amount != 70000 {
+		t.Errorf("remaining refund = %.0f, want 70000", refund.Amount)
+	}
+	db.First(&order, order.ID)
+	if order.PaymentStatus != "refunded" {
+		t.Errorf("order payment_status = %q, want refunded", order.PaymentStatus)
+	}
+
+	violations, err := CheckLedgerInvariants(db, order.RestaurantID)
+	if err != nil {
+		t.Fatalf("CheckLedgerInvariants: %v", err)
+	}
+	if len(violations) > 0 {
+		t.Errorf("ledger violations after refunds: %+v", violations)
+	}
+}
+
+func TestRefundOrderPaymentCountsPendingReservations(t *testing.T) {
+	db := newTestDB(t)
+	order, payment := paidFakeOrder(t, db, 100000)
+
+	// Lần hoàn khác đang chờ cổng xử lý đã giữ 60.000
+	reserved := models.PaymentRefund{
+		OrderID:        order.ID,
+		RestaurantID:   order.RestaurantID,
+		OrderPaymentID: &payment.ID,
+		Provider:       PaymentProviderFake,
+		Amount:         60000,
+		Status:         RefundPending,
+	}
+	db.Create(&reserved)
+
+	if _, err := RefundOrderPayment(db, order.ID, 50000, "", 1, "127.0.0.1"); errorCode(err) != "INVALID_AMOUNT" {
+		t.Fatalf("refund over reserved amount error = %v, want INVALID_AMOUNT", err)
+	}
+	refund, err := RefundOrderPayment(db, order.ID, 0, "", 1, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("refund remaining: %v", err)
+	}
+	if refund.Amount != 40000 {
+		t.Errorf("refund amount = %.0f, want 40000", refund.Amount)
+	}
+
+	// Lần giữ chỗ chưa hoàn tất: đơn chưa được coi là hoàn toàn bộ
+	db.First(&order, order.ID)
+	if order.PaymentStatus != "paid" {
+		t.Errorf("order payment_status = %q, want paid while a refund is pending", order.PaymentStatus)
+	}
+}
+
+func TestRefundOrderPaymentProviderFailureReleasesReservation(t *testing.T) {
+	db := newTestDB(t)
+	order, payment := paidFakeOrder(t, db, 100000)
+
+	// Cổng từ chối hoàn tiền (giao dịch không còn trên cổng)
+	fakePaymentsMu.Lock()
+	delete(fakePayments, payment.ProviderRef)
+	fakePaymentsMu.Unlock()
+
+	refund, err := RefundOrderPayment(db, order.ID, 100000, "", 1, "127.0.0.1")
+	if errorCode(err) != "REFUND_FAILED" {
+		t.Fatalf("refund error = %v, want REFUND_FAILED", err)
+	}
+
+	var stored models.PaymentRefund
+	db.First(&stored, refund.ID)
+	if stored.Status != RefundFailed || stored.ErrorMessage == nil {
+		t.Errorf("stored refund = %q (error %v), want failed with message", stored.Status, stored.ErrorMessage)
+	}
+
+	db.First(&order, order.ID)
+	if order.PaymentStatus != "paid" {
+		t.Errorf("order payment_status = %q, want paid", order.PaymentStatus)
+	}
+	refunded, err := sumOrderRefunds(db, order.ID, &payment, RefundFailed)
+	if err != nil || refunded != 0 {
+		t.Errorf("reserved amount = %.0f (err %v), want 0 after failure", refunded, err)
+	}
+}
+
+func TestRefundOrderPaymentCashIsManual(t *testing.T) {
+	db := newTestDB(t)
+	order := createTestOrder(t, db, 80000)
+
+	var paid models.Order
+	db.First(&paid, order.ID)
+	if _, err := markOrderPaid(db, &paid, "cash", paid.CreatedAt); err != nil {
+		t.Fatalf("markOrderPaid: %v", err)
+	}
+
+	refund, err := RefundOrderPayment(db, order.ID, 0, "khách hủy", 1, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("cash refund: %v", err)
+	}
+	if refund.Status != RefundManual || refund.Provider != "cash" || refund.Amount != 80000 {
+		t.Errorf("refund = %s/%s/%.0f, want manual/cash/80000", refund.Status, refund.Provider, refund.Amount)
+	}
+	db.First(&order, order.ID)
+	if order.PaymentStatus != "refunded" {
+		t.Errorf("order payment_status = %q, want refunded", order.PaymentStatus)
+	}
+}
+
+func TestFakeProviderCallbackRejectsShortPaymentAfterTotalChange(t *testing.T) {
+	db := newTestDB(t)
+	t.Setenv("PAYMENT_FAKE_PROVIDER", "true")
+
+	order := createTestOrder(t, db, 100000)
+	start, err := StartOrderPayment(db, order.ID, PaymentProviderFake, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("StartOrderPayment: %v", err)
+	}
+
+	// Khách thêm món trong lúc đang trả tiền trên cổng
+	db.Model(&models.Order{}).Where("id = ?", order.ID).Update("total_amount", 150000)
+
+	SetFakePaymentStatus(start.Payment.ProviderRef, OrderPaymentPaid, "FAKE-TRANS-1")
+	params := SignFakePaymentCallback(start.Payment.ProviderRef, 100000, OrderPaymentPaid, "FAKE-TRANS-1")
+	if _, err := HandlePaymentCallback(db, PaymentProviderFake, params); errorCode(err) != "AMOUNT_MISMATCH" {
+		t.Fatalf("short callback error = %v, want AMOUNT_MISMATCH", err)
+	}
+
+	db.First(&order, order.ID)
+	if order.PaymentStatus == "paid" {
+		t.Errorf("order marked paid with 100000 of 150000")
+	}
+	var payment models.OrderPayment
+	db.First(&payment, start.Payment.ID)
+	if payment.Status == OrderPaymentPaid || payment.FailureReason == nil {
+		t.Errorf("payment = %q (reason %v), want unpaid with reason", payment.Status, payment.FailureReason)
+	}
+}
+
+func TestCancelPendingOrderPaymentsKeepsSepay(t *testing.T) {
+	db := newTestDB(t)
+	order := createTestOrder(t, db, 100000)
+
+	momo := models.OrderPayment{OrderID: order.ID, RestaurantID: order.RestaurantID, Provider: PaymentProviderFake,
+		ProviderRef: "FAKE-1", Amount: 100000, Status: OrderPaymentPending}
+	sepay := models.OrderPayment{OrderID: order.ID, RestaurantID: order.RestaurantID, Provider: PaymentProviderSepay,
+		ProviderRef: "ORD1", Amount: 100000, Status: OrderPaymentPending}
+	db.Create(&momo)
+	db.Create(&sepay)
+
+	if err := CancelPendingOrderPayments(db, order.ID); err != nil {
+		t.Fatalf("CancelPendingOrderPayments: %v", err)
+	}
+	db.First(&momo, momo.ID)
+	db.First(&sepay, sepay.ID)
+	if momo.Status != OrderPaymentCancelled {
+		t.Errorf("provider payment status = %q, want cancelled", momo.Status)
+	}
+	if sepay.Status != OrderPaymentPending {
+		t.Errorf("sepay payment status = %q, want pending", sepay.Status)
+	}
+}
+
+func TestMarkOrderPaidOnlyOnce(t *testing.T) {
+	db := newTestDB(t)
+	order := createTestOrder(t, db, 80000)
+
+	// Hai luồng cùng đọc đơn chưa thanh toán (tiền mặt + webhook chuyển khoản)
+	var first, second models.Order
+	db.First(&first, order.ID)
+	db.First(&second, order.ID)
+
+	if _, err := markOrderPaid(db, &first, "cash", first.CreatedAt); err != nil {
+		t.Fatalf("first markOrderPaid: %v", err)
+	}
+	if _, err := markOrderPaid(db, &second, "qr", second.CreatedAt); errorCode(err) != "ALREADY_PAID" {
+		t.Fatalf("second markOrderPaid error = %v, want ALREADY_PAID", err)
+	}
+
+	// Chuyển khoản đến sau khi đã thu tiền mặt: không ghi nhận lần hai
+	err := completeOrderTransfer(db, second, "ORD1", &SepayWebhookPayload{ID: 1, TransferAmount: 80000}, nil)
+	if errorCode(err) != "ALREADY_PAID" {
+		t.Fatalf("completeOrderTransfer error = %v, want ALREADY_PAID", err)
+	}
+}
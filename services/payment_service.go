@@ -11,6 +11,8 @@ import (
 	"go-api/utils"
 
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ===============================
@@ -233,6 +235,11 @@ func GetSubscriptionStatus(paymentCode string) (*models.PackageSubscription, err
 
 // CompleteSubscription hoàn thành đăng ký sau khi thanh toán
 func CompleteSubscription(subscriptionID uint, transactionData *SepayWebhookPayload) error {
+	return completeSubscription(subscriptionID, transactionData, nil)
+}
+
+// completeSubscription hoàn thành đăng ký; assigned != nil là giao dịch chưa khớp được gán thủ công (cập nhật thay vì tạo mới)
+func completeSubscription(subscriptionID uint, transactionData *SepayWebhookPayload, assigned *models.PaymentTransaction) error {
 	db := config.GetDB()
 
 	var subscription models.PackageSubscription
@@ -244,6 +251,11 @@ func CompleteSubscription(subscriptionID uint, transactionData *SepayWebhookPayl
 		return fmt.Errorf("ALREADY_PAID: Đăng ký đã được thanh toán")
 	}
 
+	// Nhà hàng đã có tài khoản nâng cấp gói
+	if subscription.RestaurantID != nil {
+		return completeUpgradeSubscription(db, subscription, transactionData, assigned)
+	}
+
 	// Bắt đầu transaction
 	tx := db.Begin()
 
@@ -328,16 +340,91 @@ func CompleteSubscription(subscriptionID uint, transactionData *SepayWebhookPayl
 		RawWebhookData:     stringPtr(string(rawData)),
 	}
 
-	if err := tx.Create(&transaction).Error; err != nil {
+	if err := saveTransferTransaction(tx, &transaction, assigned); err != nil {
 		tx.Rollback()
 		return fmt.Errorf("CREATE_TRANSACTION_ERROR: %v", err)
 	}
 
+	// Sổ cái của nhà hàng: phí gói dịch vụ
+	if err := PostPlatformFeeLedger(tx, restaurant.ID, subscription, now); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("LEDGER_ERROR: %v", err)
+	}
+
 	tx.Commit()
 
 	log.Printf("✅ Subscription completed: ID=%d, User=%d, Restaurant=%d",
 		subscription.ID, user.ID, restaurant.ID)
 
+	// Gửi email xác thực (đăng ký qua thanh toán chưa xác thực email)
+	if err := SendVerificationEmail(db, user, MailLocaleVI); err != nil {
+		log.Printf("❌ Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
+	return nil
+}
+
+// completeUpgradeSubscription đổi gói cho nhà hàng sau khi thanh toán nâng cấp
+func completeUpgradeSubscription(db *gorm.DB, subscription models.PackageSubscription, transactionData *SepayWebhookPayload, assigned *models.PaymentTransaction) error {
+	now := time.Now()
+	packageEndDate := now.AddDate(0, 1, 0)
+	if subscription.BillingCycle == "yearly" {
+		packageEndDate = now.AddDate(1, 0, 0)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Restaurant{}).Where("id = ?", *subscription.RestaurantID).Updates(map[string]interface{}{
+			"package_id":         subscription.PackageID,
+			"package_start_date": now,
+			"package_end_date":   packageEndDate,
+			"package_status":     "active",
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("NOT_FOUND: Không tìm thấy nhà hàng")
+		}
+
+		if err := tx.Model(&subscription).Updates(map[string]interface{}{
+			"payment_status": "paid",
+			"paid_at":        now,
+		}).Error; err != nil {
+			return err
+		}
+
+		rawData, _ := json.Marshal(transactionData)
+		transaction := models.PaymentTransaction{
+			TransactionType:    "package",
+			ReferenceID:        subscription.ID,
+			ReferenceCode:      subscription.PaymentCode,
+			SepayTransactionID: &transactionData.ID,
+			Gateway:            &transactionData.Gateway,
+			AccountNumber:      &transactionData.AccountNumber,
+			TransferType:       &transactionData.TransferType,
+			TransferAmount:     transactionData.TransferAmount,
+			Accumulated:        &transactionData.Accumulated,
+			Code:               transactionData.Code,
+			TransactionContent: &transactionData.TransactionContent,
+			ReferenceNumber:    &transactionData.ReferenceNumber,
+			Description:        &transactionData.Description,
+			Status:             "completed",
+			VerifiedAt:         &now,
+			RawWebhookData:     stringPtr(string(rawData)),
+		}
+		if err := saveTransferTransaction(tx, &transaction, assigned); err != nil {
+			return err
+		}
+
+		// Sổ cái của nhà hàng: phí gói dịch vụ
+		return PostPlatformFeeLedger(tx, *subscription.RestaurantID, subscription, now)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("✅ Package upgrade completed: Subscription=%d, Restaurant=%d, Package=%d",
+		subscription.ID, *subscription.RestaurantID, subscription.PackageID)
 	return nil
 }
 
@@ -396,12 +483,18 @@ func CreateOrderPaymentQR(orderID uint) (*QRCodeResult, error) {
 func CompleteOrderPayment(paymentCode string, transactionData *SepayWebhookPayload) error {
 	db := config.GetDB()
 
-	// Tìm order theo payment_code
+	// Tìm order theo payment_code (kể cả mã cũ không có ký tự kiểm tra)
 	var order models.Order
-	if err := db.Where("payment_code = ?", paymentCode).First(&order).Error; err != nil {
+	if err := db.Where("payment_code IN ?", PaymentCodeVariants(paymentCode)).First(&order).Error; err != nil {
 		return fmt.Errorf("ORDER_NOT_FOUND: Không tìm thấy đơn hàng với mã %s", paymentCode)
 	}
 
+	return completeOrderTransfer(db, order, *order.PaymentCode, transactionData, nil)
+}
+
+// completeOrderTransfer ghi nhận chuyển khoản cho đơn: đánh dấu đã thanh toán, cập nhật lần thanh toán SePay và lưu giao dịch.
+// assigned != nil là giao dịch chưa khớp được gán thủ công (cập nhật thay vì tạo mới)
+func completeOrderTransfer(db *gorm.DB, order models.Order, paymentCode string, transactionData *SepayWebhookPayload, assigned *models.PaymentTransaction) error {
 	if order.PaymentStatus == "paid" {
 		return fmt.Errorf("ALREADY_PAID: Đơn hàng đã được thanh toán")
 	}
@@ -413,18 +506,63 @@ func CompleteOrderPayment(paymentCode string, transactionData *SepayWebhookPaylo
 	}
 
 	now := time.Now()
-	paymentMethod := "qr"
+	var fromStatus string
 
-	// Cập nhật order
-	db.Model(&order).Updates(map[string]interface{}{
-		"payment_status": "paid",
-		"payment_method": paymentMethod,
-		"paid_at":        now,
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Khóa đơn rồi kiểm tra lại: thanh toán tiền mặt / cổng / sửa món đồng thời không lọt giữa lúc kiểm tra và lúc ghi
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, order.ID).Error; err != nil {
+			return err
+		}
+		if order.PaymentStatus == "paid" {
+			return fmt.Errorf("ALREADY_PAID: Đơn hàng đã được thanh toán")
+		}
+		if transactionData.TransferAmount < order.TotalAmount {
+			return fmt.Errorf("AMOUNT_MISMATCH: Số tiền không khớp. Cần %.0f, nhận %.0f",
+				order.TotalAmount, transactionData.TransferAmount)
+		}
+
+		// Cập nhật order
+		var err error
+		fromStatus, err = markOrderPaid(tx, &order, "qr", now)
+		if err != nil {
+			return err
+		}
+
+		// Chuyển dư: ghi phần dư để sổ cái khớp số tiền thực nhận
+		if err := PostOrderOverpaymentLedger(tx, order, transactionData.TransferAmount); err != nil {
+			return err
+		}
+
+		// Lần thanh toán SePay của đơn (nếu tạo qua cổng thanh toán)
+		if err := tx.Model(&models.OrderPayment{}).
+			Where("provider = ? AND provider_ref = ? AND status = ?", PaymentProviderSepay, paymentCode, OrderPaymentPending).
+			Updates(map[string]interface{}{
+				"status":            OrderPaymentPaid,
+				"paid_at":           now,
+				"provider_trans_id": fmt.Sprint(transactionData.ID),
+			}).Error; err != nil {
+			return err
+		}
+
+		// Lưu transaction record
+		return saveTransferTransaction(tx, orderTransferTransaction(order, paymentCode, transactionData, now), assigned)
 	})
+	if err != nil {
+		return err
+	}
 
-	// Lưu transaction record
+	log.Printf("✅ Order payment completed: OrderID=%d, Code=%s, Amount=%.0f",
+		order.ID, paymentCode, transactionData.TransferAmount)
+
+	publishOrderPaid(order, fromStatus)
+
+	return nil
+}
+
+// orderTransferTransaction bản ghi giao dịch chuyển khoản đã khớp vào đơn
+func orderTransferTransaction(order models.Order, paymentCode string, transactionData *SepayWebhookPayload, verifiedAt time.Time) *models.PaymentTransaction {
 	rawData, _ := json.Marshal(transactionData)
-	transaction := models.PaymentTransaction{
+	return &models.PaymentTransaction{
 		TransactionType:    "order",
 		ReferenceID:        order.ID,
 		ReferenceCode:      paymentCode,
@@ -439,16 +577,23 @@ func CompleteOrderPayment(paymentCode string, transactionData *SepayWebhookPaylo
 		ReferenceNumber:    &transactionData.ReferenceNumber,
 		Description:        &transactionData.Description,
 		Status:             "completed",
-		VerifiedAt:         &now,
+		VerifiedAt:         &verifiedAt,
 		RawWebhookData:     stringPtr(string(rawData)),
 	}
+}
 
-	db.Create(&transaction)
-
-	log.Printf("✅ Order payment completed: OrderID=%d, Code=%s, Amount=%.0f",
-		order.ID, paymentCode, transactionData.TransferAmount)
-
-	return nil
+// saveTransferTransaction lưu giao dịch đã khớp. Giao dịch gán thủ công đã có bản ghi (trạng thái assigned):
+// cập nhật đối tượng trên chính bản ghi đó để một lần chuyển khoản chỉ được tính một lần
+func saveTransferTransaction(tx *gorm.DB, transaction *models.PaymentTransaction, assigned *models.PaymentTransaction) error {
+	if assigned == nil {
+		return tx.Create(transaction).Error
+	}
+	return tx.Model(&models.PaymentTransaction{}).Where("id = ?", assigned.ID).Updates(map[string]interface{}{
+		"transaction_type": transaction.TransactionType,
+		"reference_id":     transaction.ReferenceID,
+		"reference_code":   transaction.ReferenceCode,
+		"verified_at":      transaction.VerifiedAt,
+	}).Error
 }
 
 // Helper function
@@ -0,0 +1,447 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"go-api/config"
+	"go-api/models"
+
+	"gorm.io/gorm"
+)
+
+// ===============================
+// PRINT JOB SERVICE
+// ===============================
+
+// Backend chạy trên cloud không gọi được máy in trong mạng LAN của nhà hàng, nên lệnh in được xếp hàng đợi:
+// print agent (cmd/printagent) chạy tại nhà hàng, xác thực bằng API key scope print.agent, long-poll lấy lệnh,
+// in ra thiết bị rồi báo kết quả. Lệnh lỗi được thử lại, hết lượt thì chuyển failed và báo lên dashboard
+
+// Vai trò máy in
+const (
+	PrinterRoleReceipt = "receipt" // Hóa đơn / phiếu tạm tính
+	PrinterRoleKitchen = "kitchen" // Phiếu bếp
+)
+
+// Định dạng dữ liệu lệnh in
+const (
+	PrintFormatESCPOS = "escpos"
+	PrintFormatPDF    = "pdf"
+)
+
+// Loại lệnh in
+const (
+	PrintJobBill          = "bill"
+	PrintJobKitchenTicket = "kitchen_ticket"
+	PrintJobTest          = "test"
+)
+
+// Trạng thái lệnh in
+const (
+	PrintJobPending  = "pending"
+	PrintJobPrinting = "printing" // Agent đã lấy, đang chờ báo kết quả
+	PrintJobRetrying = "retrying"
+	PrintJobPrinted  = "printed"
+	PrintJobFailed   = "failed" // Hết lượt thử lại, chờ in lại thủ công từ dashboard
+)
+
+const (
+	// PrintJobMaxAttempts số lần in tối đa trước khi chuyển failed
+	PrintJobMaxAttempts = 5
+	// PrintJobLease thời gian agent giữ lệnh; quá hạn chưa báo kết quả thì lệnh được lấy lại (tính là một lần lỗi)
+	PrintJobLease = 2 * time.Minute
+	// printJobBaseBackoff thời gian chờ sau lần lỗi đầu tiên, nhân đôi sau mỗi lần (10s, 20s, 40s... tối đa 5 phút)
+	printJobBaseBackoff = 10 * time.Second
+	printJobMaxBackoff  = 5 * time.Minute
+
+	// EventPrintJobCreated sự kiện có lệnh in mới (đánh thức agent đang long-poll)
+	EventPrintJobCreated = "print_job.created"
+)
+
+// IsValidPrinterRole kiểm tra vai trò máy in
+func IsValidPrinterRole(role string) bool {
+	return role == PrinterRoleReceipt || role == PrinterRoleKitchen
+}
+
+// IsValidPrintFormat kiểm tra định dạng lệnh in
+func IsValidPrintFormat(format string) bool {
+	return format == PrintFormatESCPOS || format == PrintFormatPDF
+}
+
+// PrintJobBackoff thời gian chờ trước lần in tiếp theo sau N lần lỗi
+func PrintJobBackoff(attempts int) time.Duration {
+	delay := printJobBaseBackoff
+	for i := 1; i < attempts && delay < printJobMaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, printJobMaxBackoff)
+}
+
+// RenderForPrinter render phiếu theo định dạng, khổ giấy và tùy chọn bỏ dấu của máy in
+func RenderForPrinter(printer models.Printer, docs []PrintDocument) ([]byte, error) {
+	opts := PrintOptions{Layout: printer.Layout, Transliterate: printer.Transliterate}
+	if printer.Format == PrintFormatPDF {
+		return RenderPrintPDF(docs, opts)
+	}
+	return RenderPrintESCPOS(docs, opts)
+}
+
+// ===============================
+// ENQUEUE
+// ===============================
+
+// EnqueuePrintJob render phiếu và xếp lệnh in cho máy in
+func EnqueuePrintJob(db *gorm.DB, printer models.Printer, kind string, orderID *uint, docs []PrintDocument) (*models.PrintJob, error) {
+	data, err := RenderForPrinter(printer, docs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := models.PrintJob{
+		RestaurantID:  printer.RestaurantID,
+		PrinterID:     printer.ID,
+		OrderID:       orderID,
+		Kind:          kind,
+		Format:        printer.Format,
+		Data:          data,
+		Status:        PrintJobPending,
+		NextAttemptAt: &now,
+	}
+	if err := db.Create(&job).Error; err != nil {
+		return nil, err
+	}
+
+	publishPrintJobCreated(job)
+	return &job, nil
+}
+
+// EnqueueOrderBill xếp lệnh in hóa đơn của đơn tới các máy in hóa đơn đang bật (trả về số lệnh đã tạo)
+func EnqueueOrderBill(db *gorm.DB, orderID uint) (int, error) {
+	order, err := loadOrderForPrint(db, orderID)
+	if err != nil {
+		return 0, err
+	}
+
+	printers, err := activePrinters(db, order.RestaurantID, PrinterRoleReceipt)
+	if err != nil || len(printers) == 0 {
+		return 0, err
+	}
+
+	doc := BuildOrderBill(db, &order, true)
+	for _, printer := range printers {
+		if _, err := EnqueuePrintJob(db, printer, PrintJobBill, &order.ID, []PrintDocument{doc}); err != nil {
+			return 0, err
+		}
+	}
+	return len(printers), nil
+}
+
+// EnqueueKitchenTickets xếp lệnh in phiếu bếp: mỗi máy in bếp nhận phiếu các khu vực nó phụ trách
+func EnqueueKitchenTickets(db *gorm.DB, orderID uint) (int, error) {
+	order, err := loadOrderForPrint(db, orderID)
+	if err != nil {
+		return 0, err
+	}
+
+	printers, err := activePrinters(db, order.RestaurantID, PrinterRoleKitchen)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, printer := range printers {
+		docs := BuildKitchenTickets(order, derefString(printer.Station))
+		if len(docs) == 0 {
+			continue
+		}
+		if _, err := EnqueuePrintJob(db, printer, PrintJobKitchenTicket, &order.ID, docs); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// EnqueueTestPage xếp lệnh in thử để kiểm tra kết nối agent / máy in
+func EnqueueTestPage(db *gorm.DB, printer models.Printer) (*models.PrintJob, error) {
+	var doc PrintDocument
+	doc.Add(PrintLine{Text: "IN THỬ", Align: PrintAlignCenter, Bold: true, Large: true})
+	doc.Add(PrintCenter(printer.Name))
+	doc.Add(PrintRule())
+	if printer.Role == PrinterRoleKitchen {
+		station := "Tất cả"
+		if printer.Station != nil {
+			station = PrepStationLabel(*printer.Station)
+		}
+		doc.Add(PrintPair("Phiếu bếp", station))
+	} else {
+		doc.Add(PrintPair("Hóa đơn", printer.Layout))
+	}
+	doc.Add(PrintPair("Thời gian", time.Now().Format("15:04 02/01/2006")))
+	doc.Add(PrintRule())
+	doc.Add(PrintCenter("Tiếng Việt: ăn uống ngon miệng"))
+	return EnqueuePrintJob(db, printer, PrintJobTest, nil, []PrintDocument{doc})
+}
+
+// BuildOrderBill dựng hóa đơn của đơn; withQR thì gán mã thanh toán ORD (nếu chưa có) để in VietQR cho đơn
+// chưa trả khi nhà hàng đã cấu hình tài khoản ngân hàng. Đơn cần preload Restaurant.PaymentSetting
+func BuildOrderBill(db *gorm.DB, order *models.Order, withQR bool) PrintDocument {
+	paymentCode := ""
+	if withQR && order.PaymentStatus != "paid" && order.Restaurant != nil && order.Restaurant.PaymentSetting != nil {
+		settings := order.Restaurant.PaymentSetting
+		if derefString(settings.BankCode) != "" && derefString(settings.AccountNumber) != "" {
+			paymentCode, _ = EnsureOrderPaymentCode(db, order)
+		}
+	}
+	return BuildOrderReceipt(*order, paymentCode)
+}
+
+func loadOrderForPrint(db *gorm.DB, orderID uint) (models.Order, error) {
+	var order models.Order
+	err := db.Preload("Table").
+		Preload("OrderItems").
+		Preload("Restaurant").
+		Preload("Restaurant.PaymentSetting").
+		First(&order, orderID).Error
+	return order, err
+}
+
+func activePrinters(db *gorm.DB, restaurantID uint, role string) ([]models.Printer, error) {
+	var printers []models.Printer
+	err := db.Where("restaurant_id = ? AND role = ? AND is_active = ?", restaurantID, role, true).
+		Order("id ASC").
+		Find(&printers).Error
+	return printers, err
+}
+
+func publishPrintJobCreated(job models.PrintJob) {
+	PublishEvent(EventPrintJobCreated, job.RestaurantID, map[string]interface{}{
+		"print_job_id": job.ID,
+		"printer_id":   job.PrinterID,
+		"order_id":     job.OrderID,
+		"kind":         job.Kind,
+	})
+}
+
+// ===============================
+// AGENT
+// ===============================
+
+// ClaimPrintJobs agent lấy các lệnh đến hạn của nhà hàng (lọc theo máy in nếu có) và giữ trong PrintJobLease
+// (apiKeyID = 0 khi gọi bằng tài khoản đăng nhập, VD chủ nhà hàng chạy agent thử)
+// Lệnh đang in mà quá hạn giữ (agent mất kết nối) được lấy lại, hết lượt thì chuyển failed
+func ClaimPrintJobs(db *gorm.DB, restaurantID, apiKeyID uint, printerIDs []uint, limit int) ([]models.PrintJob, error) {
+	now := time.Now()
+
+	query := db.Preload("Printer").
+		Where("restaurant_id = ? AND status IN ? AND next_attempt_at <= ?",
+			restaurantID, []string{PrintJobPending, PrintJobRetrying, PrintJobPrinting}, now)
+	if len(printerIDs) > 0 {
+		query = query.Where("printer_id IN ?", printerIDs)
+	}
+
+	var due []models.PrintJob
+	if err := query.Order("id ASC").Limit(limit).Find(&due).Error; err != nil {
+		return nil, err
+	}
+
+	claimed := make([]models.PrintJob, 0, len(due))
+	for _, job := range due {
+		if job.Status == PrintJobPrinting && job.Attempts >= PrintJobMaxAttempts {
+			failPrintJob(db, job, "Agent không báo kết quả in")
+			continue
+		}
+
+		lease := now.Add(PrintJobLease)
+		var claimedBy *uint
+		if apiKeyID != 0 {
+			claimedBy = &apiKeyID
+		}
+		updates := map[string]interface{}{
+			"status":          PrintJobPrinting,
+			"attempts":        job.Attempts + 1,
+			"next_attempt_at": lease,
+			"claimed_by":      claimedBy,
+		}
+		if job.Status == PrintJobPrinting {
+			updates["last_error"] = "Agent không báo kết quả in"
+		}
+
+		// Chỉ giữ được nếu chưa agent nào khác giữ (next_attempt_at chưa đổi)
+		result := db.Model(&models.PrintJob{}).
+			Where("id = ? AND next_attempt_at = ?", job.ID, job.NextAttemptAt).
+			Updates(updates)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		job.Status = PrintJobPrinting
+		job.Attempts++
+		job.NextAttemptAt = &lease
+		job.ClaimedBy = claimedBy
+		claimed = append(claimed, job)
+	}
+	return claimed, nil
+}
+
+// AckPrintJob agent báo kết quả in: thành công, hẹn in lại hoặc chuyển failed khi hết lượt
+func AckPrintJob(db *gorm.DB, restaurantID, jobID uint, success bool, errorMessage string) (*models.PrintJob, error) {
+	var job models.PrintJob
+	if err := db.Where("id = ? AND restaurant_id = ?", jobID, restaurantID).First(&job).Error; err != nil {
+		return nil, fmt.Errorf("PRINT_JOB_NOT_FOUND: Không tìm thấy lệnh in")
+	}
+	if job.Status != PrintJobPrinting {
+		return nil, fmt.Errorf("PRINT_JOB_NOT_CLAIMED: Lệnh in không ở trạng thái đang in")
+	}
+
+	now := time.Now()
+	if success {
+		if err := db.Model(&job).Updates(map[string]interface{}{
+			"status":          PrintJobPrinted,
+			"printed_at":      now,
+			"next_attempt_at": nil,
+			"last_error":      nil,
+		}).Error; err != nil {
+			return nil, err
+		}
+		job.Status = PrintJobPrinted
+		job.PrintedAt = &now
+		job.NextAttemptAt = nil
+		job.LastError = nil
+		return &job, nil
+	}
+
+	if errorMessage == "" {
+		errorMessage = "Lỗi không xác định"
+	}
+	if job.Attempts >= PrintJobMaxAttempts {
+		if err := failPrintJob(db, job, errorMessage); err != nil {
+			return nil, err
+		}
+		job.Status = PrintJobFailed
+		job.NextAttemptAt = nil
+		job.LastError = &errorMessage
+		return &job, nil
+	}
+
+	next := now.Add(PrintJobBackoff(job.Attempts))
+	if err := db.Model(&job).Updates(map[string]interface{}{
+		"status":          PrintJobRetrying,
+		"next_attempt_at": next,
+		"last_error":      errorMessage,
+	}).Error; err != nil {
+		return nil, err
+	}
+	job.Status = PrintJobRetrying
+	job.NextAttemptAt = &next
+	job.LastError = &errorMessage
+	return &job, nil
+}
+
+// RequeuePrintJob đưa lệnh (đã in hoặc failed) về hàng đợi để in lại ngay
+func RequeuePrintJob(db *gorm.DB, job *models.PrintJob) error {
+	now := time.Now()
+	if err := db.Model(job).Updates(map[string]interface{}{
+		"status":          PrintJobPending,
+		"attempts":        0,
+		"next_attempt_at": now,
+		"printed_at":      nil,
+	}).Error; err != nil {
+		return err
+	}
+	job.Status = PrintJobPending
+	job.Attempts = 0
+	job.NextAttemptAt = &now
+	job.PrintedAt = nil
+
+	publishPrintJobCreated(*job)
+	return nil
+}
+
+// failPrintJob chuyển lệnh sang failed và tạo thông báo trên dashboard (một lần, kể cả khi nhiều agent cùng xử lý)
+func failPrintJob(db *gorm.DB, job models.PrintJob, errorMessage string) error {
+	result := db.Model(&models.PrintJob{}).
+		Where("id = ? AND status = ?", job.ID, job.Status).
+		Updates(map[string]interface{}{
+			"status":          PrintJobFailed,
+			"next_attempt_at": nil,
+			"last_error":      errorMessage,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	log.Printf("⚠️ Print job %d (%s) failed after %d attempts: %s", job.ID, job.Kind, job.Attempts, errorMessage)
+
+	printerName := ""
+	if job.Printer != nil {
+		printerName = job.Printer.Name
+	} else {
+		db.Model(&models.Printer{}).Where("id = ?", job.PrinterID).Pluck("name", &printerName)
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"print_job_id": job.ID,
+		"printer_id":   job.PrinterID,
+		"order_id":     job.OrderID,
+		"kind":         job.Kind,
+	})
+	dataStr := string(data)
+	notification := models.Notification{
+		RestaurantID: job.RestaurantID,
+		Type:         "print_failed",
+		Title:        "In thất bại - " + printerName,
+		Message:      errorMessage,
+		Data:         &dataStr,
+	}
+	if err := db.Create(&notification).Error; err != nil {
+		log.Printf("❌ Failed to create print failure notification: %v", err)
+	}
+	return nil
+}
+
+// ===============================
+// TRIGGERS
+// ===============================
+
+// StartPrintJobTriggers đăng ký nhận sự kiện để tự xếp lệnh in: phiếu bếp khi đơn được xác nhận,
+// hóa đơn khi khách bấm "Yêu cầu thanh toán" trên trang gọi món
+func StartPrintJobTriggers() {
+	SubscribeEvents(func(e Event) {
+		switch {
+		case e.Type == WebhookEventOrderStatusChanged && e.Data["from_status"] == "pending" && e.Data["status"] == "confirmed":
+			orderID, ok := e.Data["order_id"].(uint)
+			if !ok {
+				return
+			}
+			// Không chặn request đang phát sự kiện
+			go func() {
+				if _, err := EnqueueKitchenTickets(config.GetDB(), orderID); err != nil {
+					log.Printf("❌ Failed to enqueue kitchen tickets for order %d: %v", orderID, err)
+				}
+			}()
+
+		case e.Type == "service_request.created" && e.Data["type"] == "request_bill":
+			tableID, ok := e.Data["table_id"].(uint)
+			if !ok {
+				return
+			}
+			go func() {
+				db := config.GetDB()
+				var order models.Order
+				if err := db.Where("table_id = ? AND status IN ? AND payment_status != ?",
+					tableID, []string{"pending", "confirmed", "serving"}, "paid").
+					Order("created_at DESC").
+					First(&order).Error; err != nil {
+					return
+				}
+				if _, err := EnqueueOrderBill(db, order.ID); err != nil {
+					log.Printf("❌ Failed to enqueue bill for order %d: %v", order.ID, err)
+				}
+			}()
+		}
+	})
+}
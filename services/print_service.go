@@ -0,0 +1,510 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"go-api/utils"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// ===============================
+// PRINT SERVICE
+// ===============================
+
+// Phiếu in (hóa đơn, phiếu bếp) dựng một lần dạng danh sách dòng rồi xuất ra PDF (A5 / cuộn 80mm)
+// hoặc lệnh ESC/POS cho máy in nhiệt. Chữ tiếng Việt in trên máy in nhiệt dạng ảnh (raster) vì phần lớn
+// máy không có bảng mã tiếng Việt; chọn Transliterate để in chữ không dấu bằng font của máy (nhanh, nét hơn)
+
+// Khổ in
+const (
+	PrintLayoutA5   = "a5"
+	PrintLayoutRoll = "80mm"
+)
+
+// Căn lề dòng in
+const (
+	PrintAlignLeft   = "left"
+	PrintAlignCenter = "center"
+)
+
+const (
+	escposDotsPerLine = 576 // Khổ 80mm, 203 dpi, vùng in 72mm
+	escposColumns     = 48  // Số ký tự mỗi dòng với font A (12x24)
+	escposQRSize      = 320 // Cạnh QR (dot)
+	escposRasterChunk = 256 // Số dòng điểm tối đa mỗi lệnh GS v 0
+)
+
+// PrintLine một dòng trên phiếu in
+type PrintLine struct {
+	Text  string
+	Right string // Cột bên phải căn phải (số tiền), in cùng dòng đầu của Text
+	Align string // left (mặc định), center
+	Bold  bool
+	Large bool   // Chữ cỡ lớn: tên nhà hàng, tổng tiền, số lượng trên phiếu bếp
+	Rule  bool   // Đường kẻ ngang
+	QR    string // Nội dung mã QR (in giữa dòng)
+}
+
+// PrintDocument một phiếu in (mỗi phiếu là một trang PDF / một lần cắt giấy)
+type PrintDocument struct {
+	Lines []PrintLine
+}
+
+// PrintOptions tùy chọn xuất phiếu in
+type PrintOptions struct {
+	Layout        string // a5, 80mm (ESC/POS luôn là 80mm)
+	Transliterate bool   // In chữ không dấu
+}
+
+// Add thêm dòng vào phiếu
+func (d *PrintDocument) Add(lines ...PrintLine) {
+	d.Lines = append(d.Lines, lines...)
+}
+
+// PrintRule dòng kẻ ngang
+func PrintRule() PrintLine {
+	return PrintLine{Rule: true}
+}
+
+// PrintPair dòng hai cột: nội dung bên trái, số tiền bên phải
+func PrintPair(left, right string) PrintLine {
+	return PrintLine{Text: left, Right: right}
+}
+
+// PrintCenter dòng căn giữa
+func PrintCenter(text string) PrintLine {
+	return PrintLine{Text: text, Align: PrintAlignCenter}
+}
+
+// FormatVND số tiền in trên phiếu, VD: 150000 -> "150.000"
+func FormatVND(amount float64) string {
+	n := vndAmount(amount)
+	sign := ""
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	digits := strconv.FormatInt(n, 10)
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + "." + digits[i:]
+	}
+	return sign + digits
+}
+
+// transliterateDocuments bản sao phiếu in đã bỏ dấu tiếng Việt
+func transliterateDocuments(docs []PrintDocument) []PrintDocument {
+	result := make([]PrintDocument, len(docs))
+	for i, doc := range docs {
+		lines := make([]PrintLine, len(doc.Lines))
+		for j, line := range doc.Lines {
+			line.Text = utils.RemoveVietnameseAccents(line.Text)
+			line.Right = utils.RemoveVietnameseAccents(line.Right)
+			lines[j] = line
+		}
+		result[i].Lines = lines
+	}
+	return result
+}
+
+// wrapPrintText ngắt dòng theo từ để vừa độ rộng maxWidth (đo bằng measure), từ quá dài bị cắt.
+// Khoảng trắng đầu dòng (thụt lề tùy chọn / ghi chú món) được giữ cho mọi dòng
+func wrapPrintText(text string, maxWidth int, measure func(string) int) []string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return []string{""}
+	}
+	indent := text[:len(text)-len(strings.TrimLeft(text, " "))]
+
+	var lines []string
+	current := ""
+	for _, word := range words {
+		candidate := indent + word
+		if current != "" {
+			candidate = current + " " + word
+		}
+		if measure(candidate) <= maxWidth {
+			current = candidate
+			continue
+		}
+		if current != "" {
+			lines = append(lines, current)
+		}
+		// Từ dài hơn cả dòng: cắt theo ký tự
+		for measure(word) > maxWidth {
+			cut := len(word)
+			for cut > 0 && measure(word[:cut]) > maxWidth {
+				_, size := utf8.DecodeLastRuneInString(word[:cut])
+				cut -= size
+			}
+			if cut == 0 {
+				_, cut = utf8.DecodeRuneInString(word)
+			}
+			lines = append(lines, word[:cut])
+			word = word[cut:]
+		}
+		current = indent + word
+	}
+	return append(lines, current)
+}
+
+// ===============================
+// PDF
+// ===============================
+
+type pdfPrintLayout struct {
+	pageWidth  float64
+	margin     float64
+	fontSize   float64
+	largeSize  float64
+	qrSize     float64
+	rollHeight bool // Khổ cuộn: chiều cao trang theo nội dung
+}
+
+func newPDFPrintLayout(layout string) pdfPrintLayout {
+	if layout == PrintLayoutRoll {
+		return pdfPrintLayout{pageWidth: 80, margin: 4, fontSize: 9, largeSize: 12, qrSize: 38, rollHeight: true}
+	}
+	return pdfPrintLayout{pageWidth: 148, margin: 10, fontSize: 10, largeSize: 14, qrSize: 42}
+}
+
+// RenderPrintPDF xuất các phiếu ra PDF, mỗi phiếu một trang
+func RenderPrintPDF(docs []PrintDocument, opts PrintOptions) ([]byte, error) {
+	if opts.Transliterate {
+		docs = transliterateDocuments(docs)
+	}
+	layout := newPDFPrintLayout(opts.Layout)
+
+	pdf := gofpdf.New("P", "mm", "A5", "")
+	pdf.SetMargins(layout.margin, layout.margin, layout.margin)
+	pdf.SetCellMargin(0)
+	pdf.SetAutoPageBreak(!layout.rollHeight, layout.margin)
+	pdf.AddUTF8FontFromBytes("DejaVu", "", qrLabelFontTTF)
+	pdf.AddUTF8FontFromBytes("DejaVu", "B", qrLabelFontTTF)
+	pdf.SetFont("DejaVu", "", layout.fontSize)
+	if pdf.Err() {
+		return nil, pdf.Error()
+	}
+
+	for i, doc := range docs {
+		if layout.rollHeight {
+			height := renderPDFLines(pdf, doc, layout, i, false) + 2*layout.margin
+			pdf.AddPageFormat("P", gofpdf.SizeType{Wd: layout.pageWidth, Ht: height})
+		} else {
+			pdf.AddPage()
+		}
+		renderPDFLines(pdf, doc, layout, i, true)
+
+		if pdf.Err() {
+			return nil, pdf.Error()
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderPDFLines vẽ (draw = true) hoặc chỉ đo chiều cao nội dung của phiếu
+func renderPDFLines(pdf *gofpdf.Fpdf, doc PrintDocument, layout pdfPrintLayout, docIndex int, draw bool) float64 {
+	contentWidth := layout.pageWidth - 2*layout.margin
+	height := 0.0
+
+	for j, line := range doc.Lines {
+		switch {
+		case line.Rule:
+			lineHeight := layout.fontSize * 0.3
+			if draw {
+				y := pdf.GetY() + lineHeight/2
+				pdf.SetDrawColor(120, 120, 120)
+				pdf.SetDashPattern([]float64{1, 1}, 0)
+				pdf.Line(layout.margin, y, layout.margin+contentWidth, y)
+				pdf.SetDashPattern([]float64{}, 0)
+				pdf.SetY(pdf.GetY() + lineHeight)
+			}
+			height += lineHeight
+
+		case line.QR != "":
+			lineHeight := layout.qrSize + 2
+			if draw {
+				pngBytes, err := qrcode.Encode(line.QR, qrcode.Medium, 512)
+				if err != nil {
+					pdf.SetError(err)
+					return height
+				}
+				imageName := fmt.Sprintf("print-qr-%d-%d", docIndex, j)
+				options := gofpdf.ImageOptions{ImageType: "PNG"}
+				pdf.RegisterImageOptionsReader(imageName, options, bytes.NewReader(pngBytes))
+				pdf.ImageOptions(imageName, layout.margin+(contentWidth-layout.qrSize)/2, pdf.GetY()+1, layout.qrSize, layout.qrSize, false, options, 0, "")
+				pdf.SetY(pdf.GetY() + lineHeight)
+			}
+			height += lineHeight
+
+		default:
+			size := layout.fontSize
+			if line.Large {
+				size = layout.largeSize
+			}
+			style := ""
+			if line.Bold {
+				style = "B"
+			}
+			pdf.SetFont("DejaVu", style, size)
+			lineHeight := size * 0.46
+
+			textWidth, rightWidth := contentWidth, 0.0
+			if line.Right != "" {
+				rightWidth = pdf.GetStringWidth(line.Right)
+				textWidth = contentWidth - rightWidth - 2
+			}
+			align := "L"
+			if line.Align == PrintAlignCenter {
+				align = "C"
+			}
+
+			rows := wrapPrintText(line.Text, int(textWidth*100), func(s string) int {
+				return int(pdf.GetStringWidth(s) * 100)
+			})
+			if draw {
+				for k, row := range rows {
+					y := pdf.GetY()
+					pdf.SetXY(layout.margin, y)
+					pdf.CellFormat(textWidth, lineHeight, row, "", 0, align, false, 0, "")
+					if k == 0 && line.Right != "" {
+						pdf.SetXY(layout.margin+contentWidth-rightWidth, y)
+						pdf.CellFormat(rightWidth, lineHeight, line.Right, "", 0, "R", false, 0, "")
+					}
+					pdf.SetXY(layout.margin, y+lineHeight)
+				}
+			}
+			height += lineHeight * float64(len(rows))
+		}
+	}
+	return height
+}
+
+// ===============================
+// ESC/POS
+// ===============================
+
+var (
+	escposInit       = []byte{0x1B, 0x40}                               // ESC @
+	escposCodePage   = []byte{0x1B, 0x74, 0x00}                         // ESC t 0 (PC437)
+	escposFeedAndCut = []byte{0x1B, 0x64, 0x04, 0x1D, 0x56, 0x42, 0x00} // ESC d 4, GS V B 0 (cắt một phần)
+)
+
+// RenderPrintESCPOS xuất các phiếu ra lệnh ESC/POS cho máy in nhiệt 80mm, cắt giấy sau mỗi phiếu
+func RenderPrintESCPOS(docs []PrintDocument, opts PrintOptions) ([]byte, error) {
+	if opts.Transliterate {
+		docs = transliterateDocuments(docs)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(escposInit)
+	buf.Write(escposCodePage)
+
+	var faces *escposFaces
+	if !opts.Transliterate {
+		var err error
+		if faces, err = newESCPOSFaces(); err != nil {
+			return nil, err
+		}
+		defer faces.Close()
+	}
+
+	for _, doc := range docs {
+		for _, line := range doc.Lines {
+			switch {
+			case line.Rule:
+				escposAlign(&buf, PrintAlignLeft)
+				buf.WriteString(strings.Repeat("-", escposColumns) + "\n")
+
+			case line.QR != "":
+				qr, err := qrcode.New(line.QR, qrcode.Medium)
+				if err != nil {
+					return nil, err
+				}
+				canvas := image.NewGray(image.Rect(0, 0, escposDotsPerLine, escposQRSize))
+				draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+				offset := image.Pt((escposDotsPerLine-escposQRSize)/2, 0)
+				draw.Draw(canvas, canvas.Bounds().Add(offset), qr.Image(escposQRSize), image.Point{}, draw.Src)
+				escposAlign(&buf, PrintAlignLeft)
+				writeESCPOSRaster(&buf, canvas)
+
+			case faces != nil:
+				writeESCPOSRasterText(&buf, faces, line)
+
+			default:
+				writeESCPOSText(&buf, line)
+			}
+		}
+		buf.Write(escposFeedAndCut)
+	}
+	return buf.Bytes(), nil
+}
+
+// escposAlign ESC a n: căn lề
+func escposAlign(buf *bytes.Buffer, align string) {
+	n := byte(0)
+	if align == PrintAlignCenter {
+		n = 1
+	}
+	buf.Write([]byte{0x1B, 0x61, n})
+}
+
+// writeESCPOSText in dòng bằng font của máy (chỉ ký tự ASCII)
+func writeESCPOSText(buf *bytes.Buffer, line PrintLine) {
+	columns := escposColumns
+	if line.Large {
+		columns /= 2
+		buf.Write([]byte{0x1D, 0x21, 0x11}) // GS ! : cao x2, rộng x2
+	}
+	if line.Bold {
+		buf.Write([]byte{0x1B, 0x45, 0x01}) // ESC E 1
+	}
+	escposAlign(buf, line.Align)
+
+	text, right := asciiOnly(line.Text), asciiOnly(line.Right)
+	textColumns := columns
+	if right != "" {
+		textColumns = columns - len(right) - 1
+	}
+	for i, row := range wrapPrintText(text, textColumns, func(s string) int { return len(s) }) {
+		if i == 0 && right != "" {
+			row += strings.Repeat(" ", max(1, columns-len(row)-len(right))) + right
+		}
+		buf.WriteString(row + "\n")
+	}
+
+	if line.Bold {
+		buf.Write([]byte{0x1B, 0x45, 0x00})
+	}
+	if line.Large {
+		buf.Write([]byte{0x1D, 0x21, 0x00})
+	}
+}
+
+// asciiOnly thay ký tự ngoài ASCII (máy in không có bảng mã) bằng dấu ?
+func asciiOnly(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if r > 126 || (r < 32 && r != '\t') {
+			r = '?'
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+type escposFaces struct {
+	normal font.Face
+	large  font.Face
+}
+
+func newESCPOSFaces() (*escposFaces, error) {
+	parsed, err := opentype.Parse(qrLabelFontTTF)
+	if err != nil {
+		return nil, err
+	}
+	normal, err := opentype.NewFace(parsed, &opentype.FaceOptions{Size: 22, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	large, err := opentype.NewFace(parsed, &opentype.FaceOptions{Size: 34, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		normal.Close()
+		return nil, err
+	}
+	return &escposFaces{normal: normal, large: large}, nil
+}
+
+func (f *escposFaces) Close() {
+	f.normal.Close()
+	f.large.Close()
+}
+
+// writeESCPOSRasterText vẽ dòng chữ tiếng Việt thành ảnh rồi in dạng raster
+func writeESCPOSRasterText(buf *bytes.Buffer, faces *escposFaces, line PrintLine) {
+	face := faces.normal
+	if line.Large {
+		face = faces.large
+	}
+	measure := func(s string) int {
+		return font.MeasureString(face, s).Ceil()
+	}
+
+	textWidth, rightWidth := escposDotsPerLine, 0
+	if line.Right != "" {
+		rightWidth = measure(line.Right)
+		textWidth = escposDotsPerLine - rightWidth - 12
+	}
+
+	metrics := face.Metrics()
+	rowHeight := (metrics.Ascent + metrics.Descent).Ceil() + 4
+	rows := wrapPrintText(line.Text, textWidth, measure)
+
+	canvas := image.NewGray(image.Rect(0, 0, escposDotsPerLine, rowHeight*len(rows)))
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+
+	drawText := func(text string, x, baseline int) {
+		drawer := &font.Drawer{Dst: canvas, Src: image.NewUniform(color.Black), Face: face}
+		drawer.Dot = fixed.P(x, baseline)
+		drawer.DrawString(text)
+		if line.Bold {
+			drawer.Dot = fixed.P(x+1, baseline)
+			drawer.DrawString(text)
+		}
+	}
+
+	for i, row := range rows {
+		baseline := i*rowHeight + 2 + metrics.Ascent.Ceil()
+		x := 0
+		if line.Align == PrintAlignCenter {
+			x = (textWidth - measure(row)) / 2
+		}
+		drawText(row, x, baseline)
+		if i == 0 && line.Right != "" {
+			drawText(line.Right, escposDotsPerLine-rightWidth, baseline)
+		}
+	}
+
+	escposAlign(buf, PrintAlignLeft)
+	writeESCPOSRaster(buf, canvas)
+}
+
+// writeESCPOSRaster in ảnh đen trắng bằng lệnh GS v 0, chia nhỏ theo chiều cao
+func writeESCPOSRaster(buf *bytes.Buffer, img *image.Gray) {
+	bounds := img.Bounds()
+	widthBytes := (bounds.Dx() + 7) / 8
+
+	for top := bounds.Min.Y; top < bounds.Max.Y; top += escposRasterChunk {
+		height := min(escposRasterChunk, bounds.Max.Y-top)
+		buf.Write([]byte{0x1D, 0x76, 0x30, 0x00,
+			byte(widthBytes), byte(widthBytes >> 8), byte(height), byte(height >> 8)})
+
+		for y := top; y < top+height; y++ {
+			for xb := 0; xb < widthBytes; xb++ {
+				var b byte
+				for bit := 0; bit < 8; bit++ {
+					x := bounds.Min.X + xb*8 + bit
+					if x < bounds.Max.X && img.GrayAt(x, y).Y < 128 {
+						b |= 0x80 >> bit
+					}
+				}
+				buf.WriteByte(b)
+			}
+		}
+	}
+}
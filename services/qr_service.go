@@ -102,75 +102,259 @@ func GenerateRestaurantQR(bankCode, accountNumber, accountName string, amount fl
 	})
 }
 
-// GeneratePaymentCode tạo mã thanh toán unique
-// Format cho đăng ký gói: PKG{subscriptionID}{timestamp}
-// Format cho đơn hàng: ORD{orderNumber} (không có dấu -)
+// ===============================
+// PAYMENT CODE
+// ===============================
+
+// Mã thanh toán trong nội dung chuyển khoản: tiền tố + số + 1 chữ cái kiểm tra
+//   - Đăng ký gói: PKG{subscriptionID}{check}, ví dụ PKG123K
+//   - Đơn hàng:   ORD{số đơn bỏ dấu -}{check}, ví dụ ORD-2026-0015 -> ORD20260015M
+//
+// Ký tự kiểm tra luôn là chữ nên vẫn biết mã kết thúc ở đâu khi ngân hàng xóa khoảng trắng
+// (ORD20260015MNGUYENVANA), và phát hiện gõ sai một chữ số hoặc đảo hai chữ số liền nhau.
+// Mã cũ không có ký tự kiểm tra (PKG123, ORD20260015) vẫn được nhận, xem PaymentCodeVariants.
+
+// Tiền tố mã thanh toán
+const (
+	PaymentCodePackage = "PKG"
+	PaymentCodeOrder   = "ORD"
+)
+
+// paymentCheckAlphabet 23 chữ cái (bỏ I, L, O dễ nhầm với 1, 0); 23 là số nguyên tố
+const paymentCheckAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ"
+
+// paymentCodeSeparators ký tự ngân hàng / khách hay chèn giữa các phần của mã
+const paymentCodeSeparators = " -._/:"
+
+// maxPaymentCodeDigits giới hạn số chữ số đọc sau tiền tố
+const maxPaymentCodeDigits = 16
+
+// PaymentCodeMatch một mã thanh toán tìm thấy trong nội dung chuyển khoản
+type PaymentCodeMatch struct {
+	Type     string `json:"type"`     // package, order
+	Code     string `json:"code"`     // Mã chuẩn, luôn kèm ký tự kiểm tra
+	Verified bool   `json:"verified"` // false = nội dung thiếu ký tự kiểm tra (mã cũ hoặc bị ngân hàng cắt)
+}
+
+// GeneratePackagePaymentCode tạo mã thanh toán cho đăng ký gói: PKG{subscriptionID}{check}
 func GeneratePackagePaymentCode(subscriptionID uint) string {
-	// Format: PKG + ID + random suffix
-	// Ví dụ: PKG123 (ngắn gọn để user dễ nhập)
-	return fmt.Sprintf("PKG%d", subscriptionID)
+	digits := fmt.Sprint(subscriptionID)
+	return PaymentCodePackage + digits + string(paymentCheckChar(PaymentCodePackage, digits))
 }
 
 // GenerateOrderPaymentCode tạo mã thanh toán cho đơn hàng
-// Input: ORD-2026-0015 -> Output: ORD20260015
+// Input: ORD-2026-0015 -> Output: ORD20260015 + ký tự kiểm tra
 func GenerateOrderPaymentCode(orderNumber string) string {
-	// Bỏ dấu -
-	code := strings.ReplaceAll(orderNumber, "-", "")
-	return code
+	digits := onlyDigits(orderNumber)
+	return PaymentCodeOrder + digits + string(paymentCheckChar(PaymentCodeOrder, digits))
 }
 
-// ParsePaymentCode phân tích mã thanh toán từ nội dung chuyển khoản
-// Trả về loại (package/order), ID/code, và amount (nếu có)
-func ParsePaymentCode(content string) (transactionType string, code string, found bool) {
-	// Chuẩn hóa: uppercase, bỏ khoảng trắng thừa
-	content = strings.ToUpper(strings.TrimSpace(content))
-
-	// Tìm pattern PKG hoặc ORD
-	if idx := strings.Index(content, "PKG"); idx != -1 {
-		// Lấy phần sau PKG
-		rest := content[idx+3:]
-		// Lấy số liên tiếp
-		code = extractNumbers(rest)
-		if code != "" {
-			return "package", "PKG" + code, true
+// paymentCheckChar ký tự kiểm tra: tổng có trọng số (theo vị trí từ phải sang) của tiền tố + số, mod 23.
+// Trọng số khác nhau giữa hai vị trí liền kề nên đảo hai chữ số cũng làm sai ký tự kiểm tra
+func paymentCheckChar(prefix, digits string) byte {
+	s := prefix + digits
+	sum := 0
+	for i := 0; i < len(s); i++ {
+		c := s[len(s)-1-i]
+		value := 0
+		switch {
+		case c >= '0' && c <= '9':
+			value = int(c - '0')
+		case c >= 'A' && c <= 'Z':
+			value = int(c-'A') + 10
 		}
+		sum += value * (i%22 + 1)
+	}
+	return paymentCheckAlphabet[sum%len(paymentCheckAlphabet)]
+}
+
+// PaymentCodeVariants các dạng của một mã để tra cứu: mã có ký tự kiểm tra và mã cũ không có
+func PaymentCodeVariants(code string) []string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) <= 3 {
+		return []string{code}
+	}
+	prefix, body := code[:3], code[3:]
+
+	if digits := onlyDigits(body); digits == body {
+		return []string{code + string(paymentCheckChar(prefix, digits)), code}
 	}
+	if digits := body[:len(body)-1]; digits != "" && onlyDigits(digits) == digits && body[len(body)-1] == paymentCheckChar(prefix, digits) {
+		return []string{code, prefix + digits}
+	}
+	return []string{code}
+}
 
-	if idx := strings.Index(content, "ORD"); idx != -1 {
-		// Lấy phần sau ORD
-		rest := content[idx+3:]
-		// Lấy số liên tiếp
-		code = extractAlphanumeric(rest)
-		if code != "" {
-			return "order", "ORD" + code, true
+// FindPaymentCodes tìm tất cả mã thanh toán trong nội dung chuyển khoản.
+// Chịu được các kiểu ngân hàng viết lại nội dung: thêm tên người gửi / mã giao dịch phía trước,
+// xóa hoặc chèn khoảng trắng, dấu chấm, gạch ngang, và cắt mất ký tự kiểm tra ở cuối
+func FindPaymentCodes(content string) []PaymentCodeMatch {
+	s := strings.ToUpper(content)
+
+	var matches []PaymentCodeMatch
+	seen := map[string]int{}
+	add := func(m PaymentCodeMatch) {
+		if i, ok := seen[m.Code]; ok {
+			matches[i].Verified = matches[i].Verified || m.Verified
+			return
 		}
+		seen[m.Code] = len(matches)
+		matches = append(matches, m)
 	}
 
-	return "", "", false
+	for _, prefix := range []string{PaymentCodePackage, PaymentCodeOrder} {
+		transactionType := "package"
+		if prefix == PaymentCodeOrder {
+			transactionType = "order"
+		}
+		for from := 0; ; {
+			idx := strings.Index(s[from:], prefix)
+			if idx == -1 {
+				break
+			}
+			start := from + idx + len(prefix)
+			from = start
+			if m, ok := readPaymentCode(s, start, prefix); ok {
+				m.Type = transactionType
+				add(m)
+			}
+		}
+	}
+	return matches
 }
 
-// extractNumbers lấy các ký tự số liên tiếp từ đầu string
-func extractNumbers(s string) string {
-	var result strings.Builder
-	for _, c := range s {
+// readPaymentCode đọc phần số + ký tự kiểm tra ngay sau tiền tố tại vị trí start
+func readPaymentCode(s string, start int, prefix string) (PaymentCodeMatch, bool) {
+	// Các chữ số sau tiền tố, cho phép dấu phân cách xen giữa (ORD 2026 0015 M)
+	var digits []byte
+	end := start // vị trí ngay sau chữ số cuối
+	i := skipPaymentCodeSeparators(s, start)
+	for i < len(s) && len(digits) < maxPaymentCodeDigits {
+		c := s[i]
 		if c >= '0' && c <= '9' {
-			result.WriteRune(c)
-		} else if result.Len() > 0 {
-			// Dừng khi gặp ký tự không phải số sau khi đã có số
+			digits = append(digits, c)
+			i++
+			end = i
+			continue
+		}
+		if strings.IndexByte(paymentCodeSeparators, c) == -1 {
+			break
+		}
+		next := skipPaymentCodeSeparators(s, i)
+		if next >= len(s) || s[next] < '0' || s[next] > '9' {
 			break
 		}
+		i = next
 	}
-	return result.String()
+	if len(digits) == 0 {
+		return PaymentCodeMatch{}, false
+	}
+
+	// Mã mới: chữ cái kiểm tra ngay sau phần số
+	if next := skipPaymentCodeSeparators(s, end); next < len(s) && s[next] == paymentCheckChar(prefix, string(digits)) {
+		return PaymentCodeMatch{Code: prefix + string(digits) + string(s[next]), Verified: true}, true
+	}
+
+	// Không có ký tự kiểm tra: chỉ nhận phần số liền nhau đúng dạng mã cũ
+	runStart := skipPaymentCodeSeparators(s, start)
+	run := onlyLeadingDigits(s[runStart:])
+	if runEnd := runStart + len(run); runEnd < len(s) && s[runEnd] >= 'A' && s[runEnd] <= 'Z' {
+		// Chữ cái dính liền nhưng sai ký tự kiểm tra: gõ nhầm số, không đoán
+		return PaymentCodeMatch{}, false
+	}
+	if !isLegacyPaymentDigits(prefix, run) {
+		return PaymentCodeMatch{}, false
+	}
+	return PaymentCodeMatch{Code: prefix + run + string(paymentCheckChar(prefix, run))}, true
+}
+
+// isLegacyPaymentDigits phần số của mã cũ: PKG{id}, ORD{năm}{số thứ tự >= 4 chữ số}
+func isLegacyPaymentDigits(prefix, digits string) bool {
+	switch prefix {
+	case PaymentCodePackage:
+		return len(digits) >= 1 && len(digits) <= 10 && digits[0] != '0'
+	case PaymentCodeOrder:
+		return len(digits) >= 8 && len(digits) <= 12 && strings.HasPrefix(digits, "20")
+	}
+	return false
+}
+
+// ResolvePaymentCode chọn mã duy nhất trong các mã tìm thấy: ưu tiên mã có ký tự kiểm tra hợp lệ.
+// Nhiều mã khác nhau cùng mức tin cậy thì trả lỗi MULTIPLE_CODES để nhân viên đối soát
+func ResolvePaymentCode(matches []PaymentCodeMatch) (PaymentCodeMatch, error) {
+	var verified, unverified []PaymentCodeMatch
+	for _, m := range matches {
+		if m.Verified {
+			verified = append(verified, m)
+		} else {
+			unverified = append(unverified, m)
+		}
+	}
+
+	candidates := verified
+	if len(candidates) == 0 {
+		candidates = unverified
+	}
+	switch len(candidates) {
+	case 0:
+		return PaymentCodeMatch{}, fmt.Errorf("NO_CODE: không tìm thấy mã thanh toán")
+	case 1:
+		return candidates[0], nil
+	}
+
+	codes := make([]string, len(candidates))
+	for i, m := range candidates {
+		codes[i] = m.Code
+	}
+	return PaymentCodeMatch{}, fmt.Errorf("MULTIPLE_CODES: nội dung có nhiều mã thanh toán (%s)", strings.Join(codes, ", "))
 }
 
-// extractAlphanumeric lấy các ký tự số liên tiếp (cho order code)
-func extractAlphanumeric(s string) string {
+// ParsePaymentCode phân tích mã thanh toán từ nội dung chuyển khoản
+// Trả về loại (package/order) và mã chuẩn; found = false khi không có mã hoặc có nhiều mã khác nhau
+func ParsePaymentCode(content string) (transactionType string, code string, found bool) {
+	match, err := ResolvePaymentCode(FindPaymentCodes(content))
+	if err != nil {
+		return "", "", false
+	}
+	return match.Type, match.Code, true
+}
+
+// ContentHasPaymentCode nội dung chuyển khoản có chứa mã thanh toán code (kể cả dạng cũ / bị viết lại)
+func ContentHasPaymentCode(content, code string) bool {
+	variants := PaymentCodeVariants(code)
+	for _, m := range FindPaymentCodes(content) {
+		for _, v := range variants {
+			if m.Code == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// skipPaymentCodeSeparators bỏ qua dấu phân cách từ vị trí i
+func skipPaymentCodeSeparators(s string, i int) int {
+	for i < len(s) && strings.IndexByte(paymentCodeSeparators, s[i]) != -1 {
+		i++
+	}
+	return i
+}
+
+// onlyLeadingDigits các chữ số liên tiếp ở đầu string
+func onlyLeadingDigits(s string) string {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return s[:n]
+}
+
+// onlyDigits giữ lại các chữ số
+func onlyDigits(s string) string {
 	var result strings.Builder
 	for _, c := range s {
 		if c >= '0' && c <= '9' {
 			result.WriteRune(c)
-		} else if result.Len() > 0 {
-			break
 		}
 	}
 	return result.String()
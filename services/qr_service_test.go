@@ -0,0 +1,82 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// Bộ mẫu nội dung chuyển khoản (testdata/payment_memos.json) cho bộ phân tích mã thanh toán.
+// Thêm mẫu thật (đã che dãy số dài) bằng: DATABASE_URL=postgres://... go run ./cmd/memocorpus
+const paymentMemoCorpus = "testdata/payment_memos.json"
+
+// memoSample một mẫu nội dung chuyển khoản
+type memoSample struct {
+	Memo     string `json:"memo"`
+	Type     string `json:"type,omitempty"`     // package, order; rỗng = không được nhận ra mã nào
+	Code     string `json:"code,omitempty"`     // Mã kỳ vọng (mã cũ và mã có ký tự kiểm tra coi là một)
+	Verified bool   `json:"verified,omitempty"` // Nội dung có ký tự kiểm tra hợp lệ
+	Gap      bool   `json:"gap,omitempty"`      // Mã do nhân viên gán tay: chưa nhận ra chỉ ghi log
+	Source   string `json:"source,omitempty"`   // synthetic, transaction:<id>
+}
+
+func TestPaymentMemoCorpus(t *testing.T) {
+	samples, err := loadMemoSamples(paymentMemoCorpus)
+	if err != nil {
+		t.Fatalf("read corpus: %v", err)
+	}
+
+	for i, sample := range samples {
+		t.Run(fmt.Sprintf("%d_%s", i, sample.Source), func(t *testing.T) {
+			match, err := ResolvePaymentCode(FindPaymentCodes(sample.Memo))
+			found := err == nil
+
+			if sample.Code == "" {
+				if found {
+					t.Errorf("%q: got %s %s, want no code", sample.Memo, match.Type, match.Code)
+				}
+				return
+			}
+
+			if !found || match.Type != sample.Type || !codeMatches(sample.Code, match.Code) {
+				if sample.Gap {
+					t.Logf("%q: got %s %s (%v), assigned %s %s", sample.Memo, match.Type, match.Code, err, sample.Type, sample.Code)
+					return
+				}
+				t.Fatalf("%q: got %s %s (%v), want %s %s", sample.Memo, match.Type, match.Code, err, sample.Type, sample.Code)
+			}
+
+			// Mã trả về luôn ở dạng chuẩn, ký tự kiểm tra đúng
+			prefix, digits := match.Code[:3], match.Code[3:len(match.Code)-1]
+			if match.Code[len(match.Code)-1] != paymentCheckChar(prefix, digits) {
+				t.Errorf("%q: %s has a wrong check character", sample.Memo, match.Code)
+			}
+			if match.Verified != sample.Verified {
+				t.Errorf("%q: verified = %v, want %v", sample.Memo, match.Verified, sample.Verified)
+			}
+		})
+	}
+}
+
+// codeMatches mã tìm được trùng mã kỳ vọng (mã cũ và mã có ký tự kiểm tra coi là một)
+func codeMatches(want, got string) bool {
+	for _, variant := range PaymentCodeVariants(want) {
+		if variant == got {
+			return true
+		}
+	}
+	return false
+}
+
+func loadMemoSamples(file string) ([]memoSample, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var samples []memoSample
+	if err := json.Unmarshal(data, &samples); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
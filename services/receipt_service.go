@@ -0,0 +1,263 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/models"
+
+	"gorm.io/gorm"
+)
+
+// ===============================
+// RECEIPT SERVICE
+// ===============================
+
+// Dựng nội dung hóa đơn thanh toán / phiếu bếp từ đơn hàng. Đơn cần preload Table, OrderItems, Restaurant
+// (và Restaurant.PaymentSetting để in QR thanh toán)
+
+// PrepStationLabel tên khu vực chế biến hiển thị cho nhân viên
+func PrepStationLabel(prepLocation string) string {
+	switch prepLocation {
+	case "kitchen":
+		return "Bếp"
+	case "bar":
+		return "Bar"
+	case "service":
+		return "Phục vụ"
+	default:
+		return prepLocation
+	}
+}
+
+// EnsureOrderPaymentCode gán mã thanh toán ORD cho đơn chưa có để in trên hóa đơn giấy (webhook SePay đối soát
+// theo mã này). Không đổi trạng thái / hạn thanh toán như khi khách bấm tạo QR
+func EnsureOrderPaymentCode(db *gorm.DB, order *models.Order) (string, error) {
+	if order.PaymentCode != nil && *order.PaymentCode != "" {
+		return *order.PaymentCode, nil
+	}
+	code := GenerateOrderPaymentCode(order.OrderNumber)
+	if err := db.Model(&models.Order{}).
+		Where("id = ? AND (payment_code IS NULL OR payment_code = '')", order.ID).
+		Update("payment_code", code).Error; err != nil {
+		return "", err
+	}
+	order.PaymentCode = &code
+	return code, nil
+}
+
+// BuildOrderReceipt hóa đơn thanh toán (hoặc phiếu tạm tính nếu chưa trả). paymentCode khác rỗng thì in VietQR
+// chuyển khoản đúng số tiền với nội dung là mã thanh toán
+func BuildOrderReceipt(order models.Order, paymentCode string) PrintDocument {
+	var doc PrintDocument
+
+	if order.Restaurant != nil {
+		doc.Add(PrintLine{Text: order.Restaurant.Name, Align: PrintAlignCenter, Bold: true, Large: true})
+		if address := derefString(order.Restaurant.Address); address != "" {
+			doc.Add(PrintCenter(address))
+		}
+		if phone := derefString(order.Restaurant.Phone); phone != "" {
+			doc.Add(PrintCenter("ĐT: " + phone))
+		}
+	}
+	doc.Add(PrintRule())
+
+	title := "PHIẾU TẠM TÍNH"
+	if order.PaymentStatus == "paid" {
+		title = "HÓA ĐƠN THANH TOÁN"
+	}
+	doc.Add(PrintLine{Text: title, Align: PrintAlignCenter, Bold: true, Large: true})
+	doc.Add(PrintCenter("Số: " + order.OrderNumber))
+	doc.Add(receiptOrderLines(order)...)
+	doc.Add(PrintLine{Text: "Giờ vào: " + order.CreatedAt.Local().Format("15:04 02/01/2006")})
+	if order.PaidAt != nil {
+		doc.Add(PrintLine{Text: "Thanh toán: " + order.PaidAt.Local().Format("15:04 02/01/2006")})
+	}
+	doc.Add(PrintRule())
+
+	for _, item := range order.OrderItems {
+		if item.PrepStatus == "cancelled" {
+			continue
+		}
+		doc.Add(PrintPair(fmt.Sprintf("%d x %s", item.Quantity, item.ItemName), FormatVND(item.LineTotal)))
+		if item.Quantity > 1 {
+			doc.Add(PrintLine{Text: "   @ " + FormatVND(item.ItemPrice)})
+		}
+		if options := formatSelectedOptions(item.SelectedOptions); options != "" {
+			doc.Add(PrintLine{Text: "   " + options})
+		}
+	}
+	doc.Add(PrintRule())
+
+	doc.Add(PrintPair("Tạm tính", FormatVND(order.Subtotal)))
+	if order.TaxAmount > 0 {
+		doc.Add(PrintPair("VAT ("+invoiceTaxRate(order)+")", FormatVND(order.TaxAmount)))
+	}
+	if order.ServiceCharge > 0 {
+		doc.Add(PrintPair("Phí phục vụ", FormatVND(order.ServiceCharge)))
+	}
+	if order.DeliveryFee > 0 {
+		doc.Add(PrintPair("Phí giao hàng", FormatVND(order.DeliveryFee)))
+	}
+	if order.DiscountAmount > 0 {
+		doc.Add(PrintPair("Giảm giá", "-"+FormatVND(order.DiscountAmount)))
+	}
+	doc.Add(PrintLine{Text: "TỔNG CỘNG", Right: FormatVND(order.TotalAmount), Bold: true, Large: true})
+	if order.PaymentStatus == "paid" {
+		doc.Add(PrintPair("Hình thức", invoicePaymentMethod(order.PaymentMethod)))
+	}
+
+	if paymentCode != "" && order.PaymentStatus != "paid" && order.Restaurant != nil && order.Restaurant.PaymentSetting != nil {
+		doc.Add(receiptPaymentQRLines(*order.Restaurant.PaymentSetting, order.TotalAmount, paymentCode)...)
+	}
+
+	doc.Add(PrintRule())
+	doc.Add(PrintCenter("Cảm ơn quý khách!"))
+	return doc
+}
+
+// receiptPaymentQRLines khối VietQR chuyển khoản (bỏ qua nếu ngân hàng chưa hỗ trợ)
+func receiptPaymentQRLines(settings models.PaymentSetting, amount float64, paymentCode string) []PrintLine {
+	bankCode, accountNumber := derefString(settings.BankCode), derefString(settings.AccountNumber)
+	payload, err := BuildVietQRPayload(bankCode, accountNumber, vndAmount(amount), paymentCode)
+	if err != nil {
+		return nil
+	}
+
+	bank := derefString(settings.BankName)
+	if bank == "" {
+		bank = strings.ToUpper(bankCode)
+	}
+	lines := []PrintLine{
+		PrintRule(),
+		PrintCenter("Quét mã để chuyển khoản"),
+		{QR: payload},
+		PrintCenter(bank + " - " + accountNumber),
+	}
+	if accountName := derefString(settings.AccountName); accountName != "" {
+		lines = append(lines, PrintCenter(accountName))
+	}
+	return append(lines, PrintLine{Text: "Nội dung: " + paymentCode, Align: PrintAlignCenter, Bold: true})
+}
+
+// BuildKitchenTickets phiếu bếp, mỗi khu vực chế biến (bếp, bar...) một phiếu. station khác rỗng thì chỉ in
+// khu vực đó. Món đã hủy hoặc đã phục vụ không in
+func BuildKitchenTickets(order models.Order, station string) []PrintDocument {
+	itemsByStation := make(map[string][]models.OrderItem)
+	var stations []string
+	for _, item := range order.OrderItems {
+		if item.PrepStatus == "cancelled" || item.PrepStatus == "served" {
+			continue
+		}
+		if station != "" && item.PrepLocation != station {
+			continue
+		}
+		if _, ok := itemsByStation[item.PrepLocation]; !ok {
+			stations = append(stations, item.PrepLocation)
+		}
+		itemsByStation[item.PrepLocation] = append(itemsByStation[item.PrepLocation], item)
+	}
+	sort.Strings(stations)
+
+	docs := make([]PrintDocument, 0, len(stations))
+	for _, location := range stations {
+		var doc PrintDocument
+		doc.Add(PrintLine{Text: strings.ToUpper(PrepStationLabel(location)), Align: PrintAlignCenter, Bold: true, Large: true})
+		doc.Add(PrintCenter("Đơn " + order.OrderNumber))
+		doc.Add(receiptOrderLines(order)...)
+		doc.Add(PrintLine{Text: "In lúc: " + time.Now().Format("15:04 02/01/2006")})
+		doc.Add(PrintRule())
+
+		for _, item := range itemsByStation[location] {
+			doc.Add(PrintLine{Text: fmt.Sprintf("%d x %s", item.Quantity, item.ItemName), Bold: true, Large: true})
+			if options := formatSelectedOptions(item.SelectedOptions); options != "" {
+				doc.Add(PrintLine{Text: "   " + options})
+			}
+			if notes := derefString(item.Notes); notes != "" {
+				doc.Add(PrintLine{Text: "   Ghi chú: " + notes, Bold: true})
+			}
+		}
+
+		if notes := derefString(order.Notes); notes != "" {
+			doc.Add(PrintRule())
+			doc.Add(PrintLine{Text: "Ghi chú đơn: " + notes, Bold: true})
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+// receiptOrderLines dòng bàn / số lấy món / địa chỉ giao theo loại đơn
+func receiptOrderLines(order models.Order) []PrintLine {
+	var lines []PrintLine
+	switch order.OrderType {
+	case "takeaway":
+		label := "MANG VỀ"
+		if order.PickupNumber != nil {
+			label += " - Số " + *order.PickupNumber
+		}
+		lines = append(lines, PrintLine{Text: label, Align: PrintAlignCenter, Bold: true, Large: true})
+		if order.PickupTime != nil {
+			lines = append(lines, PrintLine{Text: "Lấy lúc: " + order.PickupTime.Local().Format("15:04 02/01")})
+		}
+	case "delivery":
+		lines = append(lines, PrintLine{Text: "GIAO HÀNG", Align: PrintAlignCenter, Bold: true, Large: true})
+		if address := derefString(order.DeliveryAddress); address != "" {
+			lines = append(lines, PrintLine{Text: "Địa chỉ: " + address})
+		}
+	default:
+		if order.Table != nil {
+			name := derefString(order.Table.Name)
+			if name == "" {
+				name = "Bàn " + strconv.Itoa(order.Table.TableNumber)
+			}
+			lines = append(lines, PrintLine{Text: name, Align: PrintAlignCenter, Bold: true, Large: true})
+		}
+	}
+
+	customer := strings.TrimSpace(derefString(order.CustomerName) + " " + derefString(order.CustomerPhone))
+	if customer != "" && order.OrderType != "dine_in" {
+		lines = append(lines, PrintLine{Text: "Khách: " + customer})
+	}
+	return lines
+}
+
+// formatSelectedOptions tùy chọn món dạng "Size: Lớn, Đá: Ít" (JSON không phải object thì in nguyên)
+func formatSelectedOptions(raw *string) string {
+	if raw == nil {
+		return ""
+	}
+	value := strings.TrimSpace(*raw)
+	if value == "" || value == "{}" || value == "null" {
+		return ""
+	}
+
+	var options map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &options); err != nil {
+		return value
+	}
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		switch v := options[key].(type) {
+		case []interface{}:
+			values := make([]string, 0, len(v))
+			for _, item := range v {
+				values = append(values, fmt.Sprint(item))
+			}
+			parts = append(parts, key+": "+strings.Join(values, ", "))
+		default:
+			parts = append(parts, fmt.Sprintf("%s: %v", key, v))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
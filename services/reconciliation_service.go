@@ -0,0 +1,458 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"go-api/models"
+
+	"gorm.io/gorm"
+)
+
+// ===============================
+// UNMATCHED BANK TRANSFERS
+// ===============================
+
+// Trạng thái giao dịch chuyển khoản cần đối soát
+const (
+	TransactionUnmatched = "unmatched" // Nội dung không có mã PKG / ORD
+	TransactionAssigned  = "assigned"  // Nhân viên đã gán vào đơn / đăng ký
+	TransactionIgnored   = "ignored"   // Không thuộc đơn / đăng ký nào (chuyển nhầm, cá nhân...)
+)
+
+// Loại đối tượng có thể gán giao dịch
+const (
+	ReconcileTargetOrder   = "order"
+	ReconcileTargetPackage = "package"
+)
+
+// Khung tìm gợi ý quanh thời điểm chuyển khoản
+const (
+	ReconcileWindowBefore    = 48 * time.Hour // Đơn / đăng ký tạo trước giao dịch tối đa
+	ReconcileWindowAfter     = 2 * time.Hour  // Đơn / đăng ký tạo sau giao dịch tối đa (lệch giờ ngân hàng)
+	ReconcileAmountTolerance = 0.1            // Lệch số tiền tối đa 10%
+	reconcileMaxCodeDistance = 3              // Sai khác tối đa giữa mã và nội dung chuyển khoản
+	reconcileMaxCandidates   = 10             // Số gợi ý trả về
+	sepayTransactionDateFmt  = "2006-01-02 15:04:05"
+)
+
+// sepayLocation múi giờ của thời điểm giao dịch SePay
+var sepayLocation = time.FixedZone("GMT+7", 7*60*60)
+
+// ReconcileCandidate đơn / đăng ký có thể khớp với giao dịch
+type ReconcileCandidate struct {
+	Type         string    `json:"type"` // order, package
+	ID           uint      `json:"id"`
+	RestaurantID *uint     `json:"restaurant_id"`
+	Code         string    `json:"code"`  // Mã thanh toán (hoặc số đơn nếu đơn chưa tạo QR)
+	Label        string    `json:"label"` // Số đơn / tên nhà hàng
+	Amount       float64   `json:"amount"`
+	AmountDiff   float64   `json:"amount_diff"` // Tiền chuyển - tiền cần thanh toán
+	CreatedAt    time.Time `json:"created_at"`
+	MinutesApart int       `json:"minutes_apart"`
+	CodeDistance *int      `json:"code_distance"` // Sai khác giữa mã và nội dung chuyển khoản (nil = không giống)
+	Score        float64   `json:"score"`         // 0..1, cao hơn = khớp hơn
+}
+
+// ParseSepayTransactionDate thời điểm giao dịch SePay (giờ Việt Nam), nil nếu không đọc được
+func ParseSepayTransactionDate(s string) *time.Time {
+	t, err := time.ParseInLocation(sepayTransactionDateFmt, strings.TrimSpace(s), sepayLocation)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// TransferAccountRestaurantID nhà hàng sở hữu tài khoản nhận tiền (nil = tài khoản nền tảng / không rõ)
+func TransferAccountRestaurantID(db *gorm.DB, accountNumber string) *uint {
+	if accountNumber == "" {
+		return nil
+	}
+	var settings models.PaymentSetting
+	if err := db.Where("account_number = ?", accountNumber).First(&settings).Error; err != nil {
+		return nil
+	}
+	return &settings.RestaurantID
+}
+
+// transactionReceiverRestaurantID nhà hàng nhận tiền của giao dịch (nil = tài khoản nền tảng / không rõ).
+// Giao dịch lưu trước khi có restaurant_id được nhận diện theo số tài khoản
+func transactionReceiverRestaurantID(db *gorm.DB, transaction models.PaymentTransaction) *uint {
+	if transaction.RestaurantID != nil {
+		return transaction.RestaurantID
+	}
+	if transaction.AccountNumber == nil {
+		return nil
+	}
+	return TransferAccountRestaurantID(db, *transaction.AccountNumber)
+}
+
+// ReconcileTransactionsQuery giao dịch cần / đã đối soát theo trạng thái; restaurantID != nil chỉ lấy giao dịch vào tài khoản của nhà hàng
+func ReconcileTransactionsQuery(db *gorm.DB, restaurantID *uint, status string) *gorm.DB {
+	query := db.Model(&models.PaymentTransaction{}).Where("status = ?", status)
+	return scopeTransactionsToRestaurant(db, query, restaurantID)
+}
+
+// FindReconcileTransaction giao dịch cần đối soát theo ID trong phạm vi nhà hàng (nil = toàn hệ thống)
+func FindReconcileTransaction(db *gorm.DB, transactionID uint, restaurantID *uint) (*models.PaymentTransaction, error) {
+	var transaction models.PaymentTransaction
+	query := db.Model(&models.PaymentTransaction{}).
+		Where("id = ? AND status IN ?", transactionID, []string{TransactionUnmatched, TransactionAssigned, TransactionIgnored})
+	if err := scopeTransactionsToRestaurant(db, query, restaurantID).First(&transaction).Error; err != nil {
+		return nil, fmt.Errorf("TRANSACTION_NOT_FOUND: không tìm thấy giao dịch")
+	}
+	return &transaction, nil
+}
+
+// scopeTransactionsToRestaurant giới hạn giao dịch vào tài khoản nhận tiền của nhà hàng.
+// Giao dịch lưu trước khi có restaurant_id được nhận diện theo số tài khoản
+func scopeTransactionsToRestaurant(db *gorm.DB, query *gorm.DB, restaurantID *uint) *gorm.DB {
+	if restaurantID == nil {
+		return query
+	}
+	var settings models.PaymentSetting
+	if err := db.Where("restaurant_id = ?", *restaurantID).First(&settings).Error; err != nil || settings.AccountNumber == nil || *settings.AccountNumber == "" {
+		return query.Where("restaurant_id = ?", *restaurantID)
+	}
+	return query.Where("(restaurant_id = ? OR (restaurant_id IS NULL AND account_number = ?))", *restaurantID, *settings.AccountNumber)
+}
+
+// transferTime thời điểm chuyển khoản (theo ngân hàng nếu có)
+func transferTime(transaction models.PaymentTransaction) time.Time {
+	if transaction.TransactionDate != nil {
+		return *transaction.TransactionDate
+	}
+	return transaction.CreatedAt
+}
+
+// SuggestReconcileCandidates gợi ý đơn (và đăng ký gói khi includePackages) theo số tiền, thời gian và độ giống mã
+func SuggestReconcileCandidates(db *gorm.DB, transaction models.PaymentTransaction, restaurantID *uint, includePackages bool) []ReconcileCandidate {
+	at := transferTime(transaction)
+	from, to := at.Add(-ReconcileWindowBefore), at.Add(ReconcileWindowAfter)
+	minAmount := transaction.TransferAmount * (1 - ReconcileAmountTolerance)
+	maxAmount := transaction.TransferAmount * (1 + ReconcileAmountTolerance)
+
+	content := ""
+	if transaction.TransactionContent != nil {
+		content = *transaction.TransactionContent
+	}
+
+	candidates := []ReconcileCandidate{}
+
+	// Đơn chưa thanh toán của nhà hàng nhận tiền (chỉ các đơn này gán được)
+	receiver := transactionReceiverRestaurantID(db, transaction)
+	if receiver != nil && (restaurantID == nil || *restaurantID == *receiver) {
+		var orders []models.Order
+		db.Model(&models.Order{}).
+			Where("restaurant_id = ?", *receiver).
+			Where("payment_status IN ? AND status NOT IN ?", []string{"unpaid", "pending"}, []string{"cancelled", "merged"}).
+			Where("created_at BETWEEN ? AND ?", from, to).
+			Where("total_amount BETWEEN ? AND ?", minAmount, maxAmount).
+			Order("created_at DESC").Limit(50).
+			Find(&orders)
+		for _, order := range orders {
+			code := order.OrderNumber
+			if order.PaymentCode != nil && *order.PaymentCode != "" {
+				code = *order.PaymentCode
+			}
+			restaurant := order.RestaurantID
+			candidates = append(candidates, scoreReconcileCandidate(ReconcileCandidate{
+				Type:         ReconcileTargetOrder,
+				ID:           order.ID,
+				RestaurantID: &restaurant,
+				Code:         code,
+				Label:        order.OrderNumber,
+				Amount:       order.TotalAmount,
+				CreatedAt:    order.CreatedAt,
+			}, transaction.TransferAmount, at, content))
+		}
+	}
+
+	// Đăng ký / nâng cấp gói chờ thanh toán (chỉ tài khoản nền tảng)
+	if includePackages && receiver == nil {
+		var subscriptions []models.PackageSubscription
+		db.Where("payment_status = ?", "pending").
+			Where("created_at BETWEEN ? AND ?", from, to).
+			Where("amount BETWEEN ? AND ?", minAmount, maxAmount).
+			Order("created_at DESC").Limit(50).
+			Find(&subscriptions)
+		for _, subscription := range subscriptions {
+			candidates = append(candidates, scoreReconcileCandidate(ReconcileCandidate{
+				Type:         ReconcileTargetPackage,
+				ID:           subscription.ID,
+				RestaurantID: subscription.RestaurantID,
+				Code:         subscription.PaymentCode,
+				Label:        subscription.RestaurantName,
+				Amount:       subscription.Amount,
+				CreatedAt:    subscription.CreatedAt,
+			}, transaction.TransferAmount, at, content))
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	if len(candidates) > reconcileMaxCandidates {
+		candidates = candidates[:reconcileMaxCandidates]
+	}
+	return candidates
+}
+
+// scoreReconcileCandidate chấm điểm gợi ý: số tiền 50%, mã giống nội dung 30%, thời gian gần 20%
+func scoreReconcileCandidate(candidate ReconcileCandidate, transferAmount float64, at time.Time, content string) ReconcileCandidate {
+	candidate.AmountDiff = transferAmount - candidate.Amount
+	minutes := at.Sub(candidate.CreatedAt).Minutes()
+	candidate.MinutesApart = int(math.Round(minutes))
+
+	amountScore := 1.0
+	if transferAmount > 0 {
+		amountScore = math.Max(0, 1-math.Abs(candidate.AmountDiff)/(transferAmount*ReconcileAmountTolerance))
+	}
+
+	window := ReconcileWindowBefore.Minutes()
+	if minutes < 0 {
+		window = ReconcileWindowAfter.Minutes()
+	}
+	timeScore := math.Max(0, 1-math.Abs(minutes)/window)
+
+	codeScore := 0.0
+	if distance := fuzzyCodeDistance(content, candidate.Code); distance <= reconcileMaxCodeDistance {
+		candidate.CodeDistance = &distance
+		codeScore = 1 - float64(distance)/float64(reconcileMaxCodeDistance+1)
+	}
+
+	candidate.Score = math.Round((0.5*amountScore+0.3*codeScore+0.2*timeScore)*100) / 100
+	return candidate
+}
+
+// fuzzyCodeDistance khoảng cách sửa (Levenshtein) nhỏ nhất giữa mã và một đoạn bất kỳ trong nội dung chuyển khoản.
+// So sánh trên chữ / số viết hoa, bỏ khoảng trắng và ký tự đặc biệt
+func fuzzyCodeDistance(content, code string) int {
+	text := []rune(compactAlphanumeric(content))
+	pattern := []rune(compactAlphanumeric(code))
+	if len(pattern) == 0 {
+		return math.MaxInt32
+	}
+
+	// prev[j]: khoảng cách nhỏ nhất giữa pattern[:i] và đoạn kết thúc tại text[j-1]
+	prev := make([]int, len(text)+1)
+	curr := make([]int, len(text)+1)
+	for i := 1; i <= len(pattern); i++ {
+		curr[0] = i
+		for j := 1; j <= len(text); j++ {
+			cost := 1
+			if pattern[i-1] == text[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j-1]+cost, prev[j]+1, curr[j-1]+1)
+		}
+		prev, curr = curr, prev
+	}
+
+	best := len(pattern)
+	for _, d := range prev {
+		best = min(best, d)
+	}
+	return best
+}
+
+// compactAlphanumeric viết hoa, chỉ giữ chữ và số
+func compactAlphanumeric(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// AssignUnmatchedTransaction gán giao dịch không khớp mã vào đơn / đăng ký, chạy luồng hoàn tất thanh toán như webhook
+// và ghi lại người gán kèm ghi chú. restaurantID != nil chỉ cho gán vào đơn của nhà hàng đó
+func AssignUnmatchedTransaction(db *gorm.DB, transactionID uint, targetType string, targetID uint, restaurantID *uint, userID uint, note string) (*models.PaymentTransaction, error) {
+	transaction, err := FindReconcileTransaction(db, transactionID, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	if transaction.Status != TransactionUnmatched {
+		return nil, fmt.Errorf("ALREADY_RESOLVED: giao dịch đã được xử lý")
+	}
+
+	// Kiểm tra đối tượng trước khi giữ giao dịch
+	var order models.Order
+	var subscription models.PackageSubscription
+	referenceCode := ""
+	switch targetType {
+	case ReconcileTargetOrder:
+		if err := db.First(&order, targetID).Error; err != nil {
+			return nil, fmt.Errorf("ORDER_NOT_FOUND: không tìm thấy đơn hàng")
+		}
+		if restaurantID != nil && order.RestaurantID != *restaurantID {
+			return nil, fmt.Errorf("ORDER_NOT_FOUND: không tìm thấy đơn hàng")
+		}
+		// Tiền phải vào đúng tài khoản của nhà hàng có đơn (kể cả khi quản trị viên gán)
+		if receiver := transactionReceiverRestaurantID(db, *transaction); receiver == nil || *receiver != order.RestaurantID {
+			return nil, fmt.Errorf("ACCOUNT_MISMATCH: giao dịch không vào tài khoản của nhà hàng có đơn")
+		}
+		if order.PaymentStatus == "paid" || order.PaymentStatus == "refunded" {
+			return nil, fmt.Errorf("ALREADY_PAID: đơn hàng đã được thanh toán")
+		}
+		if transaction.TransferAmount < order.TotalAmount {
+			return nil, fmt.Errorf("AMOUNT_MISMATCH: số tiền không đủ, cần %.0f, nhận %.0f", order.TotalAmount, transaction.TransferAmount)
+		}
+		if err := EnsureDayOpen(db, order.RestaurantID, time.Now()); err != nil {
+			return nil, err
+		}
+		referenceCode = order.OrderNumber
+		if order.PaymentCode != nil && *order.PaymentCode != "" {
+			referenceCode = *order.PaymentCode
+		}
+	case ReconcileTargetPackage:
+		if restaurantID != nil {
+			return nil, fmt.Errorf("FORBIDDEN: chỉ quản trị viên được gán giao dịch vào đăng ký gói")
+		}
+		if err := db.First(&subscription, targetID).Error; err != nil {
+			return nil, fmt.Errorf("SUBSCRIPTION_NOT_FOUND: không tìm thấy đăng ký")
+		}
+		// Phí gói chỉ nhận qua tài khoản nền tảng
+		if transactionReceiverRestaurantID(db, *transaction) != nil {
+			return nil, fmt.Errorf("ACCOUNT_MISMATCH: giao dịch vào tài khoản của nhà hàng, không phải tài khoản nền tảng")
+		}
+		if subscription.PaymentStatus != "pending" {
+			return nil, fmt.Errorf("ALREADY_PAID: đăng ký không còn chờ thanh toán")
+		}
+		if transaction.TransferAmount < subscription.Amount {
+			return nil, fmt.Errorf("AMOUNT_MISMATCH: số tiền không đủ, cần %.0f, nhận %.0f", subscription.Amount, transaction.TransferAmount)
+		}
+		referenceCode = subscription.PaymentCode
+	default:
+		return nil, fmt.Errorf("INVALID_TARGET: loại phải là order hoặc package")
+	}
+
+	// Giữ giao dịch để hai người không gán cùng lúc
+	now := time.Now()
+	result := db.Model(&models.PaymentTransaction{}).
+		Where("id = ? AND status = ?", transaction.ID, TransactionUnmatched).
+		Updates(map[string]interface{}{"status": TransactionAssigned, "resolved_by": userID, "resolved_at": now})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("ALREADY_RESOLVED: giao dịch đã được xử lý")
+	}
+
+	payload := transactionPayload(*transaction)
+	switch targetType {
+	case ReconcileTargetOrder:
+		err = completeOrderTransfer(db, order, referenceCode, payload, transaction)
+	case ReconcileTargetPackage:
+		err = completeSubscription(subscription.ID, payload, transaction)
+	}
+	if err != nil {
+		db.Model(&models.PaymentTransaction{}).Where("id = ?", transaction.ID).Updates(map[string]interface{}{
+			"status":      TransactionUnmatched,
+			"resolved_by": nil,
+			"resolved_at": nil,
+		})
+		return nil, err
+	}
+
+	auditNote := fmt.Sprintf("Gán thủ công vào %s #%d (%s) bởi user %d", targetType, targetID, referenceCode, userID)
+	if note != "" {
+		auditNote += ": " + note
+	}
+	db.Model(transaction).Update("resolution_note", auditNote)
+	transaction.ResolutionNote = &auditNote
+	transaction.TransactionType = targetType
+	transaction.ReferenceID = targetID
+	transaction.ReferenceCode = referenceCode
+	transaction.VerifiedAt = &now
+	transaction.Status = TransactionAssigned
+	transaction.ResolvedBy = &userID
+	transaction.ResolvedAt = &now
+
+	return transaction, nil
+}
+
+// IgnoreUnmatchedTransaction đánh dấu giao dịch không thuộc đơn / đăng ký nào
+func IgnoreUnmatchedTransaction(db *gorm.DB, transactionID uint, restaurantID *uint, userID uint, note string) (*models.PaymentTransaction, error) {
+	transaction, err := FindReconcileTransaction(db, transactionID, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	auditNote := fmt.Sprintf("Bỏ qua bởi user %d: %s", userID, note)
+	result := db.Model(&models.PaymentTransaction{}).
+		Where("id = ? AND status = ?", transaction.ID, TransactionUnmatched).
+		Updates(map[string]interface{}{
+			"status":          TransactionIgnored,
+			"resolved_by":     userID,
+			"resolved_at":     now,
+			"resolution_note": auditNote,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("ALREADY_RESOLVED: giao dịch đã được xử lý")
+	}
+
+	transaction.Status = TransactionIgnored
+	transaction.ResolvedBy = &userID
+	transaction.ResolvedAt = &now
+	transaction.ResolutionNote = &auditNote
+	return transaction, nil
+}
+
+// transactionPayload dựng lại payload SePay từ giao dịch đã lưu để chạy luồng hoàn tất thanh toán
+func transactionPayload(transaction models.PaymentTransaction) *SepayWebhookPayload {
+	payload := &SepayWebhookPayload{
+		TransferAmount: transaction.TransferAmount,
+		Code:           transaction.Code,
+	}
+	if transaction.RawWebhookData != nil {
+		// Payload gốc từ webhook (tên trường SePay: content, referenceCode)
+		var raw struct {
+			TransactionDate string  `json:"transactionDate"`
+			SubAccount      *string `json:"subAccount"`
+			Content         string  `json:"content"`
+			ReferenceCode   string  `json:"referenceCode"`
+		}
+		if json.Unmarshal([]byte(*transaction.RawWebhookData), &raw) == nil {
+			payload.TransactionDate = raw.TransactionDate
+			payload.SubAccount = raw.SubAccount
+			payload.TransactionContent = raw.Content
+			payload.ReferenceNumber = raw.ReferenceCode
+		}
+	}
+	if transaction.SepayTransactionID != nil {
+		payload.ID = *transaction.SepayTransactionID
+	}
+	if transaction.Gateway != nil {
+		payload.Gateway = *transaction.Gateway
+	}
+	if transaction.AccountNumber != nil {
+		payload.AccountNumber = *transaction.AccountNumber
+	}
+	if transaction.TransferType != nil {
+		payload.TransferType = *transaction.TransferType
+	}
+	if transaction.Accumulated != nil {
+		payload.Accumulated = *transaction.Accumulated
+	}
+	if transaction.TransactionContent != nil {
+		payload.TransactionContent = *transaction.TransactionContent
+	}
+	if transaction.ReferenceNumber != nil {
+		payload.ReferenceNumber = *transaction.ReferenceNumber
+	}
+	if transaction.Description != nil {
+		payload.Description = *transaction.Description
+	}
+	return payload
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ===============================
+// REFRESH TOKEN SERVICE
+// ===============================
+
+// RefreshTokenTTL thời hạn refresh token (tính từ lần xoay gần nhất)
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// Lý do thu hồi refresh token
+const (
+	RevokeReasonRotated       = "rotated"
+	RevokeReasonLogout        = "logout"
+	RevokeReasonLogoutAll     = "logout_all"
+	RevokeReasonReuseDetected = "reuse_detected"
+	RevokeReasonStaffDisabled = "staff_disabled"
+	RevokeReasonPasswordReset = "password_reset"
+)
+
+// RefreshClient thông tin thiết bị tạo / dùng refresh token
+type RefreshClient struct {
+	UserAgent string
+	IPAddress string
+}
+
+// IssueRefreshToken tạo refresh token mới. familyID rỗng = phiên đăng nhập mới
+func IssueRefreshToken(tx *gorm.DB, userID uint, restaurantID *uint, familyID string, client RefreshClient) (string, *models.RefreshToken, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+
+	if familyID == "" {
+		familyID = uuid.NewString()
+	}
+
+	token := models.RefreshToken{
+		UserID:       userID,
+		RestaurantID: restaurantID,
+		FamilyID:     familyID,
+		TokenHash:    hashUserToken(raw),
+		ExpiresAt:    time.Now().Add(RefreshTokenTTL),
+	}
+	if client.UserAgent != "" {
+		ua := client.UserAgent
+		if len(ua) > 500 {
+			ua = ua[:500]
+		}
+		token.UserAgent = &ua
+	}
+	if client.IPAddress != "" {
+		token.IPAddress = &client.IPAddress
+	}
+
+	if err := tx.Create(&token).Error; err != nil {
+		return "", nil, err
+	}
+	return raw, &token, nil
+}
+
+// RotateRefreshToken đổi refresh token cũ lấy token mới trong cùng family.
+// Token đã xoay mà bị dùng lại => coi như bị lộ, thu hồi cả family.
+func RotateRefreshToken(db *gorm.DB, raw string, client RefreshClient) (string, *models.RefreshToken, error) {
+	var current models.RefreshToken
+	if err := db.Where("token_hash = ?", hashUserToken(raw)).First(&current).Error; err != nil {
+		return "", nil, fmt.Errorf("INVALID_REFRESH_TOKEN: refresh token không hợp lệ")
+	}
+
+	if current.RevokedAt != nil {
+		if current.RevokedReason != nil && *current.RevokedReason == RevokeReasonRotated {
+			revokeReusedFamily(db, current)
+			return "", nil, fmt.Errorf("REFRESH_TOKEN_REUSED: refresh token đã được sử dụng, phiên đăng nhập bị thu hồi")
+		}
+		return "", nil, fmt.Errorf("REFRESH_TOKEN_REVOKED: phiên đăng nhập đã kết thúc")
+	}
+
+	if time.Now().After(current.ExpiresAt) {
+		return "", nil, fmt.Errorf("REFRESH_TOKEN_EXPIRED: phiên đăng nhập đã hết hạn")
+	}
+
+	var newRaw string
+	var next *models.RefreshToken
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", current.ID).
+			Updates(map[string]interface{}{
+				"revoked_at":     now,
+				"revoked_reason": RevokeReasonRotated,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		// Hai request cùng dùng một token: request đến sau bị coi là dùng lại
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("REFRESH_TOKEN_REUSED: refresh token đã được sử dụng, phiên đăng nhập bị thu hồi")
+		}
+
+		var err error
+		newRaw, next, err = IssueRefreshToken(tx, current.UserID, current.RestaurantID, current.FamilyID, client)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).Where("id = ?", current.ID).Update("replaced_by_id", next.ID).Error
+	})
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "REFRESH_TOKEN_REUSED") {
+			revokeReusedFamily(db, current)
+		}
+		return "", nil, err
+	}
+
+	return newRaw, next, nil
+}
+
+// FindRefreshToken tìm refresh token theo token gốc (không kiểm tra trạng thái)
+func FindRefreshToken(db *gorm.DB, raw string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	if err := db.Where("token_hash = ?", hashUserToken(raw)).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RevokeRefreshFamily thu hồi toàn bộ token còn hiệu lực của một phiên đăng nhập
+func RevokeRefreshFamily(db *gorm.DB, familyID, reason string) (int64, error) {
+	result := db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Updates(map[string]interface{}{
+			"revoked_at":     time.Now(),
+			"revoked_reason": reason,
+		})
+	return result.RowsAffected, result.Error
+}
+
+// RevokeUserRefreshTokens thu hồi mọi phiên đăng nhập của user (đăng xuất tất cả thiết bị)
+func RevokeUserRefreshTokens(db *gorm.DB, userID uint, reason string) (int64, error) {
+	result := db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{
+			"revoked_at":     time.Now(),
+			"revoked_reason": reason,
+		})
+	return result.RowsAffected, result.Error
+}
+
+// revokeReusedFamily thu hồi cả family khi phát hiện token cũ bị dùng lại
+func revokeReusedFamily(db *gorm.DB, token models.RefreshToken) {
+	count, err := RevokeRefreshFamily(db, token.FamilyID, RevokeReasonReuseDetected)
+	if err != nil {
+		log.Printf("❌ Failed to revoke refresh token family %s: %v", token.FamilyID, err)
+		return
+	}
+	log.Printf("⚠️ Refresh token reuse detected: user %d, family %s, revoked %d token(s)", token.UserID, token.FamilyID, count)
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"go-api/config"
+	"go-api/models"
+
+	"gorm.io/gorm"
+)
+
+// ===============================
+// RESERVATION SERVICE
+// ===============================
+
+const (
+	// ReservationGraceMinutes khách đến trễ quá số phút này sẽ bị đánh dấu no_show
+	ReservationGraceMinutes = 15
+	// DefaultTurnoverMinutes thời gian quay vòng bàn mặc định khi chưa có dữ liệu lịch sử
+	DefaultTurnoverMinutes = 45
+)
+
+// ActiveReservationStatuses các trạng thái đặt bàn đang giữ chỗ
+// (lượt pending giữ tạm bàn được chọn lúc đặt cho đến khi được xác nhận hoặc hết hạn)
+var ActiveReservationStatuses = []string{"pending", "confirmed", "seated"}
+
+// FindReservationConflicts tìm các lượt đặt bàn bị trùng giờ trên cùng một bàn
+func FindReservationConflicts(db *gorm.DB, tableID uint, start, end time.Time, excludeID uint) ([]models.Reservation, error) {
+	var conflicts []models.Reservation
+	query := db.Where("table_id = ? AND status IN ?", tableID, ActiveReservationStatuses).
+		Where("reserved_at < ? AND reserved_at + (duration_minutes * INTERVAL '1 minute') > ?", end, start)
+	if excludeID > 0 {
+		query = query.Where("id <> ?", excludeID)
+	}
+	err := query.Order("reserved_at ASC").Find(&conflicts).Error
+	return conflicts, err
+}
+
+// FindAvailableTables tìm các bàn còn trống cho số khách và khung giờ yêu cầu
+// Kết quả sắp xếp theo sức chứa tăng dần (bàn vừa nhất đứng đầu)
+func FindAvailableTables(restaurant models.Restaurant, partySize int, start time.Time, durationMinutes int) ([]models.Table, error) {
+	db := config.GetDB()
+	end := start.Add(time.Duration(durationMinutes) * time.Minute)
+
+	var tables []models.Table
+	if err := db.Where("restaurant_id = ? AND is_active = ? AND capacity >= ?", restaurant.ID, true, partySize).
+		Order("capacity ASC, table_number ASC").
+		Find(&tables).Error; err != nil {
+		return nil, err
+	}
+
+	// Nếu khung giờ đã nằm trong thời gian giữ bàn, bàn đang có khách không thể nhận thêm
+	holdStart := start.Add(-time.Duration(restaurant.ReservationHoldMinutes) * time.Minute)
+	withinHold := !time.Now().Before(holdStart)
+
+	var available []models.Table
+	for _, t := range tables {
+		if withinHold && t.Status == "occupied" {
+			continue
+		}
+		conflicts, err := FindReservationConflicts(db, t.ID, start, end, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(conflicts) == 0 {
+			available = append(available, t)
+		}
+	}
+
+	return available, nil
+}
+
+// SyncReservationHolds giữ bàn cho các lượt đặt sắp tới, giải phóng lượt quá hạn và hủy lượt chưa xác nhận đã quá giờ
+func SyncReservationHolds() error {
+	db := config.GetDB()
+	now := time.Now()
+
+	// 1. Giữ bàn: lượt đã xác nhận, đã gán bàn, đã vào thời gian giữ bàn
+	var upcoming []models.Reservation
+	if err := db.Joins("JOIN restaurants ON restaurants.id = reservations.restaurant_id").
+		Where("reservations.status = ? AND reservations.table_id IS NOT NULL", "confirmed").
+		Where("reservations.reserved_at - (restaurants.reservation_hold_minutes * INTERVAL '1 minute') <= ?", now).
+		Where("reservations.reserved_at + (? * INTERVAL '1 minute') > ?", ReservationGraceMinutes, now).
+		Find(&upcoming).Error; err != nil {
+		return err
+	}
+
+	for _, r := range upcoming {
+		result := db.Model(&models.Table{}).
+			Where("id = ? AND status = ?", *r.TableID, "available").
+			Update("status", "reserved")
+		if result.RowsAffected > 0 {
+			log.Printf("🪑 Table %d held for reservation %s", *r.TableID, r.Code)
+		}
+	}
+
+	// 2. Quá giờ mà khách chưa đến -> no_show và trả bàn
+	var expired []models.Reservation
+	if err := db.Where("status = ? AND reserved_at + (? * INTERVAL '1 minute') <= ?", "confirmed", ReservationGraceMinutes, now).
+		Find(&expired).Error; err != nil {
+		return err
+	}
+
+	for _, r := range expired {
+		db.Model(&r).Update("status", "no_show")
+		if r.TableID != nil {
+			ReleaseReservedTable(db, *r.TableID)
+		}
+		log.Printf("⏰ Reservation %s marked as no_show", r.Code)
+	}
+
+	// 3. Đến giờ đặt mà nhà hàng chưa xác nhận -> hủy để trả chỗ giữ tạm
+	result := db.Model(&models.Reservation{}).
+		Where("status = ? AND reserved_at <= ?", "pending", now).
+		Updates(map[string]interface{}{
+			"status":        "cancelled",
+			"cancelled_at":  now,
+			"cancel_reason": "Nhà hàng chưa xác nhận trước giờ đặt",
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("⏰ %d pending reservation(s) expired", result.RowsAffected)
+	}
+
+	return nil
+}
+
+// ReleaseReservedTable trả bàn đang giữ về trạng thái trống
+// Chỉ áp dụng khi bàn đang ở trạng thái reserved và không còn lượt nào khác đang giữ
+func ReleaseReservedTable(db *gorm.DB, tableID uint) {
+	now := time.Now()
+
+	var stillHeld int64
+	db.Model(&models.Reservation{}).
+		Joins("JOIN restaurants ON restaurants.id = reservations.restaurant_id").
+		Where("reservations.table_id = ? AND reservations.status = ?", tableID, "confirmed").
+		Where("reservations.reserved_at - (restaurants.reservation_hold_minutes * INTERVAL '1 minute') <= ?", now).
+		Where("reservations.reserved_at + (? * INTERVAL '1 minute') > ?", ReservationGraceMinutes, now).
+		Count(&stillHeld)
+	if stillHeld > 0 {
+		return
+	}
+
+	db.Model(&models.Table{}).Where("id = ? AND status = ?", tableID, "reserved").Update("status", "available")
+}
+
+// StartReservationScheduler chạy định kỳ việc giữ bàn / giải phóng bàn
+func StartReservationScheduler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := SyncReservationHolds(); err != nil {
+				log.Printf("❌ Reservation scheduler error: %v", err)
+			}
+		}
+	}()
+}
+
+// ===============================
+// WAITLIST ESTIMATION
+// ===============================
+
+// WaitEstimate kết quả ước tính thời gian chờ
+type WaitEstimate struct {
+	WaitMinutes     int `json:"wait_minutes"`
+	PartiesAhead    int `json:"parties_ahead"`
+	TurnoverMinutes int `json:"turnover_minutes"`
+	SuitableTables  int `json:"suitable_tables"`
+}
+
+// AverageTurnoverMinutes thời gian quay vòng bàn trung bình (30 ngày gần nhất)
+// Tính từ lúc tạo đơn đến lúc hoàn thành, chỉ xét bàn đủ chỗ cho số khách
+func AverageTurnoverMinutes(restaurantID uint, partySize int) int {
+	var avg *float64
+	config.GetDB().Model(&models.Order{}).
+		Select("AVG(EXTRACT(EPOCH FROM (orders.completed_at - orders.created_at)) / 60)").
+		Joins("JOIN tables ON tables.id = orders.table_id").
+		Where("orders.restaurant_id = ? AND orders.status = ? AND orders.completed_at IS NOT NULL", restaurantID, "completed").
+		Where("orders.created_at >= ? AND tables.capacity >= ?", time.Now().AddDate(0, 0, -30), partySize).
+		Scan(&avg)
+
+	if avg == nil || *avg <= 0 {
+		return DefaultTurnoverMinutes
+	}
+	return int(*avg + 0.5)
+}
+
+// EstimateWaitMinutes ước tính thời gian chờ cho khách vãng lai
+// partiesAhead: số nhóm khách đang chờ phía trước
+func EstimateWaitMinutes(restaurantID uint, partySize int, partiesAhead int) (*WaitEstimate, error) {
+	db := config.GetDB()
+	turnover := AverageTurnoverMinutes(restaurantID, partySize)
+
+	var tables []models.Table
+	if err := db.Where("restaurant_id = ? AND is_active = ? AND capacity >= ?", restaurantID, true, partySize).
+		Find(&tables).Error; err != nil {
+		return nil, err
+	}
+
+	estimate := &WaitEstimate{
+		PartiesAhead:    partiesAhead,
+		TurnoverMinutes: turnover,
+		SuitableTables:  len(tables),
+	}
+	if len(tables) == 0 {
+		return estimate, nil
+	}
+
+	// Thời gian còn lại của từng bàn: bàn trống = 0, bàn có khách = turnover - thời gian đã ngồi
+	now := time.Now()
+	var remaining []int
+	for _, t := range tables {
+		switch t.Status {
+		case "available":
+			remaining = append(remaining, 0)
+		case "occupied":
+			var seatedSince *time.Time
+			db.Model(&models.Order{}).
+				Select("MIN(created_at)").
+				Where("table_id = ? AND status NOT IN ?", t.ID, []string{"completed", "cancelled"}).
+				Scan(&seatedSince)
+
+			left := turnover
+			if seatedSince != nil {
+				left = turnover - int(now.Sub(*seatedSince).Minutes())
+			}
+			if left < 5 {
+				left = 5
+			}
+			remaining = append(remaining, left)
+		default:
+			remaining = append(remaining, turnover)
+		}
+	}
+	sort.Ints(remaining)
+
+	// Nhóm thứ k được xếp vào bàn thứ (k mod n), sau k/n vòng quay bàn
+	round := partiesAhead / len(remaining)
+	slot := partiesAhead % len(remaining)
+	estimate.WaitMinutes = remaining[slot] + round*turnover
+
+	return estimate, nil
+}
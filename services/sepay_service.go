@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"go-api/config"
+	"go-api/models"
 )
 
 // SePay API Service
@@ -121,8 +123,8 @@ func (s *SepayService) FindTransactionByContent(accountNumber string, content st
 	}
 
 	for _, tx := range transactions {
-		// Kiểm tra nội dung chứa code và số tiền khớp
-		if containsIgnoreCase(tx.TransactionContent, content) && tx.TransferAmount == amount {
+		// Kiểm tra nội dung chứa code (kể cả khi ngân hàng viết lại nội dung) và số tiền khớp
+		if (containsIgnoreCase(tx.TransactionContent, content) || ContentHasPaymentCode(tx.TransactionContent, content)) && tx.TransferAmount == amount {
 			return &tx, nil
 		}
 	}
@@ -337,3 +339,84 @@ func equalIgnoreCase(a, b string) bool {
 	}
 	return true
 }
+
+// ===== SePay Payment Provider =====
+
+// sepayPaymentProvider chuyển khoản VietQR vào tài khoản nhà hàng, xác nhận qua webhook SePay
+type sepayPaymentProvider struct {
+	settings models.PaymentSetting
+}
+
+func newSepayPaymentProvider(settings models.PaymentSetting) (PaymentProvider, error) {
+	if settings.AccountNumber == nil || settings.BankCode == nil {
+		return nil, fmt.Errorf("NO_BANK_CONFIG: Nhà hàng chưa cấu hình tài khoản ngân hàng")
+	}
+	return &sepayPaymentProvider{settings: settings}, nil
+}
+
+// sepayCallbackRef mã thanh toán đơn nằm trong nội dung chuyển khoản
+func sepayCallbackRef(params map[string]string) string {
+	transactionType, code, found := ParsePaymentCode(params["content"])
+	if !found || transactionType != "order" {
+		return ""
+	}
+	return code
+}
+
+func (p *sepayPaymentProvider) Name() string {
+	return PaymentProviderSepay
+}
+
+// CreatePayment tạo QR chuyển khoản, mã tham chiếu là mã thanh toán của đơn
+func (p *sepayPaymentProvider) CreatePayment(req PaymentRequest) (*PaymentResult, error) {
+	qr, err := CreateOrderPaymentQR(req.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	return &PaymentResult{
+		Ref: GenerateOrderPaymentCode(req.OrderNumber),
+		QR:  qr,
+	}, nil
+}
+
+// VerifyCallback SePay không ký payload: webhook được nhận ở /webhooks/sepay và chỉ lấy giao dịch tiền vào
+func (p *sepayPaymentProvider) VerifyCallback(params map[string]string) (*PaymentCallback, error) {
+	ref := sepayCallbackRef(params)
+	if ref == "" {
+		return nil, fmt.Errorf("INVALID_CALLBACK: không tìm thấy mã thanh toán trong nội dung chuyển khoản")
+	}
+	amount, err := strconv.ParseFloat(params["transferAmount"], 64)
+	if err != nil {
+		return nil, fmt.Errorf("INVALID_CALLBACK: số tiền không hợp lệ")
+	}
+	return &PaymentCallback{
+		Ref:     ref,
+		TransID: params["id"],
+		Amount:  vndAmount(amount),
+		Success: params["transferType"] == "in",
+	}, nil
+}
+
+// QueryStatus tìm giao dịch chuyển khoản khớp nội dung và số tiền qua SePay API
+func (p *sepayPaymentProvider) QueryStatus(payment models.OrderPayment) (*PaymentStatusResult, error) {
+	tx, err := NewSepayService().FindTransactionByContent(*p.settings.AccountNumber, payment.ProviderRef, payment.Amount)
+	if err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		return &PaymentStatusResult{Status: OrderPaymentPending}, nil
+	}
+	return &PaymentStatusResult{
+		Status:  OrderPaymentPaid,
+		TransID: strconv.FormatInt(tx.ID, 10),
+		Amount:  vndAmount(tx.TransferAmount),
+	}, nil
+}
+
+// Refund chuyển khoản ngân hàng không hoàn tự động được: ghi nhận để nhân viên chuyển trả khách
+func (p *sepayPaymentProvider) Refund(payment models.OrderPayment, req RefundRequest) (*RefundResult, error) {
+	return &RefundResult{
+		Status:  RefundManual,
+		Message: "Chuyển khoản trả lại cho khách thủ công",
+	}, nil
+}
@@ -0,0 +1,328 @@
+package services
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/config"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/skip2/go-qrcode"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	_ "golang.org/x/image/webp"
+)
+
+// ===============================
+// TABLE QR SERVICE
+// ===============================
+
+// Font hỗ trợ tiếng Việt để in tên bàn lên QR (DejaVu Sans Condensed Bold)
+//
+//go:embed fonts/DejaVuSansCondensed-Bold.ttf
+var qrLabelFontTTF []byte
+
+const (
+	// DefaultTableQRSize kích thước ảnh QR mặc định (px)
+	DefaultTableQRSize = 512
+	// MinTableQRSize / MaxTableQRSize giới hạn kích thước ảnh QR
+	MinTableQRSize = 128
+	MaxTableQRSize = 2048
+
+	// Logo chiếm tối đa ~22% cạnh QR để vẫn quét được với mức sửa lỗi High (30%)
+	qrLogoRatio = 0.22
+)
+
+// TableQROptions thông tin để vẽ QR cho một bàn
+type TableQROptions struct {
+	URL   string      // Link gọi món của bàn
+	Label string      // Tên bàn in dưới QR (để trống = không in)
+	Logo  image.Image // Logo nhà hàng đặt giữa QR (nil = không có)
+	Size  int         // Cạnh QR (px)
+}
+
+// TableOrderURL tạo link gọi món tại bàn trỏ về frontend
+func TableOrderURL(slug string, tableNumber int) string {
+	return config.FrontendBaseURL() + "/" + slug + "/menu/" + strconv.Itoa(tableNumber)
+}
+
+// FetchLogoImage tải logo nhà hàng (png/jpeg/webp) để chèn vào QR
+func FetchLogoImage(logoURL string) (image.Image, error) {
+	if logoURL == "" {
+		return nil, fmt.Errorf("logo url is empty")
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(logoURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("logo download failed: status %d", resp.StatusCode)
+	}
+
+	img, _, err := image.Decode(resp.Body)
+	return img, err
+}
+
+// RenderTableQRImage vẽ QR (kèm logo ở giữa và tên bàn phía dưới) thành ảnh
+func RenderTableQRImage(opts TableQROptions) (image.Image, error) {
+	size := normalizeQRSize(opts.Size)
+
+	qr, err := qrcode.New(opts.URL, qrcode.High)
+	if err != nil {
+		return nil, err
+	}
+	qrImg := qr.Image(size)
+
+	labelHeight := 0
+	if opts.Label != "" {
+		labelHeight = size / 6
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, size, size+labelHeight))
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(canvas, image.Rect(0, 0, size, size), qrImg, qrImg.Bounds().Min, draw.Over)
+
+	if opts.Logo != nil {
+		drawQRLogo(canvas, opts.Logo, size)
+	}
+
+	if opts.Label != "" {
+		if err := drawQRLabel(canvas, opts.Label, size, labelHeight); err != nil {
+			return nil, err
+		}
+	}
+
+	return canvas, nil
+}
+
+// RenderTableQRPNG vẽ QR của bàn thành ảnh PNG
+func RenderTableQRPNG(opts TableQROptions) ([]byte, error) {
+	img, err := RenderTableQRImage(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderTableQRSVG vẽ QR của bàn thành SVG (logo nhúng bằng link, tên bàn dạng text)
+func RenderTableQRSVG(opts TableQROptions, logoURL string) (string, error) {
+	size := normalizeQRSize(opts.Size)
+
+	qr, err := qrcode.New(opts.URL, qrcode.High)
+	if err != nil {
+		return "", err
+	}
+	bitmap := qr.Bitmap()
+	modules := len(bitmap)
+	cell := float64(size) / float64(modules)
+
+	labelHeight := 0
+	if opts.Label != "" {
+		labelHeight = size / 6
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		size, size+labelHeight, size, size+labelHeight)
+	fmt.Fprintf(&sb, `<rect width="100%%" height="100%%" fill="#ffffff"/>`)
+
+	// Gom các module đen thành một path để file gọn
+	sb.WriteString(`<path fill="#000000" d="`)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&sb, "M%.2f %.2fh%.2fv%.2fh-%.2fz", float64(x)*cell, float64(y)*cell, cell, cell, cell)
+			}
+		}
+	}
+	sb.WriteString(`"/>`)
+
+	if logoURL != "" {
+		logoSize := float64(size) * qrLogoRatio
+		pad := logoSize * 0.08
+		pos := (float64(size) - logoSize) / 2
+		fmt.Fprintf(&sb, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="#ffffff"/>`,
+			pos-pad, pos-pad, logoSize+2*pad, logoSize+2*pad)
+		fmt.Fprintf(&sb, `<image x="%.2f" y="%.2f" width="%.2f" height="%.2f" preserveAspectRatio="xMidYMid meet" href="%s" xlink:href="%s"/>`,
+			pos, pos, logoSize, logoSize, html.EscapeString(logoURL), html.EscapeString(logoURL))
+	}
+
+	if opts.Label != "" {
+		fmt.Fprintf(&sb, `<text x="%d" y="%d" text-anchor="middle" dominant-baseline="middle" font-family="DejaVu Sans, Arial, sans-serif" font-weight="bold" font-size="%d">%s</text>`,
+			size/2, size+labelHeight/2, labelHeight/2, html.EscapeString(opts.Label))
+	}
+
+	sb.WriteString(`</svg>`)
+	return sb.String(), nil
+}
+
+// RenderTableQRSheetPDF xếp QR của nhiều bàn lên khổ A4 (3 cột x 4 hàng mỗi trang) để in và cắt
+func RenderTableQRSheetPDF(title string, tables []TableQROptions) ([]byte, error) {
+	const (
+		cols      = 3
+		rows      = 4
+		marginX   = 12.0
+		headerY   = 12.0
+		gridTop   = 24.0
+		cellW     = (210.0 - 2*marginX) / cols
+		cellH     = (297.0 - gridTop - 10.0) / rows
+		qrSizeMM  = 50.0
+		labelSize = 13.0
+	)
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.AddUTF8FontFromBytes("DejaVu", "B", qrLabelFontTTF)
+	if pdf.Err() {
+		return nil, pdf.Error()
+	}
+
+	for i, t := range tables {
+		pos := i % (cols * rows)
+		if pos == 0 {
+			pdf.AddPage()
+			pdf.SetFont("DejaVu", "B", 14)
+			pdf.SetXY(marginX, headerY)
+			pdf.CellFormat(210-2*marginX, 8, title, "", 0, "C", false, 0, "")
+		}
+
+		x := marginX + float64(pos%cols)*cellW
+		y := gridTop + float64(pos/cols)*cellH
+
+		// Khung cắt nét đứt
+		pdf.SetDrawColor(180, 180, 180)
+		pdf.SetDashPattern([]float64{1.5, 1.5}, 0)
+		pdf.Rect(x, y, cellW, cellH, "D")
+		pdf.SetDashPattern([]float64{}, 0)
+
+		// QR kèm logo (tên bàn in bằng font của PDF cho nét chữ sắc)
+		label := t.Label
+		t.Label = ""
+		pngBytes, err := RenderTableQRPNG(t)
+		if err != nil {
+			return nil, err
+		}
+		imageName := "table-qr-" + strconv.Itoa(i)
+		pdf.RegisterImageOptionsReader(imageName, gofpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(pngBytes))
+		pdf.ImageOptions(imageName, x+(cellW-qrSizeMM)/2, y+4, qrSizeMM, qrSizeMM, false, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+
+		pdf.SetFont("DejaVu", "B", labelSize)
+		pdf.SetXY(x, y+4+qrSizeMM+1)
+		pdf.CellFormat(cellW, 7, label, "", 0, "C", false, 0, "")
+
+		if pdf.Err() {
+			return nil, pdf.Error()
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ===============================
+// HELPER FUNCTIONS
+// ===============================
+
+// normalizeQRSize đưa kích thước QR về khoảng cho phép
+func normalizeQRSize(size int) int {
+	if size <= 0 {
+		return DefaultTableQRSize
+	}
+	if size < MinTableQRSize {
+		return MinTableQRSize
+	}
+	if size > MaxTableQRSize {
+		return MaxTableQRSize
+	}
+	return size
+}
+
+// drawQRLogo chèn logo (có nền trắng) vào giữa QR
+func drawQRLogo(canvas *image.RGBA, logo image.Image, qrSize int) {
+	logoSize := int(float64(qrSize) * qrLogoRatio)
+	pad := logoSize / 12
+
+	// Giữ tỉ lệ logo trong khung vuông
+	b := logo.Bounds()
+	w, h := logoSize, logoSize
+	if b.Dx() > b.Dy() {
+		h = logoSize * b.Dy() / b.Dx()
+	} else if b.Dy() > b.Dx() {
+		w = logoSize * b.Dx() / b.Dy()
+	}
+
+	cx, cy := qrSize/2, qrSize/2
+	bg := image.Rect(cx-logoSize/2-pad, cy-logoSize/2-pad, cx+logoSize/2+pad, cy+logoSize/2+pad)
+	draw.Draw(canvas, bg, image.White, image.Point{}, draw.Src)
+
+	dst := image.Rect(cx-w/2, cy-h/2, cx-w/2+w, cy-h/2+h)
+	xdraw.CatmullRom.Scale(canvas, dst, logo, b, xdraw.Over, nil)
+}
+
+// drawQRLabel in tên bàn căn giữa ở vùng phía dưới QR
+func drawQRLabel(canvas *image.RGBA, label string, qrSize, labelHeight int) error {
+	parsed, err := opentype.Parse(qrLabelFontTTF)
+	if err != nil {
+		return err
+	}
+
+	newFace := func(size float64) (font.Face, error) {
+		return opentype.NewFace(parsed, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	}
+
+	fontSize := float64(labelHeight) * 0.5
+	face, err := newFace(fontSize)
+	if err != nil {
+		return err
+	}
+
+	// Thu nhỏ chữ nếu tên bàn quá dài
+	width := font.MeasureString(face, label).Ceil()
+	maxWidth := qrSize * 9 / 10
+	if width > maxWidth {
+		face.Close()
+		if face, err = newFace(fontSize * float64(maxWidth) / float64(width)); err != nil {
+			return err
+		}
+		width = font.MeasureString(face, label).Ceil()
+	}
+	defer face.Close()
+
+	metrics := face.Metrics()
+	textHeight := (metrics.Ascent + metrics.Descent).Ceil()
+	baseline := qrSize + (labelHeight-textHeight)/2 + metrics.Ascent.Ceil()
+
+	drawer := &font.Drawer{
+		Dst:  canvas,
+		Src:  image.NewUniform(color.Black),
+		Face: face,
+		Dot:  fixed.P((qrSize-width)/2, baseline),
+	}
+	drawer.DrawString(label)
+	return nil
+}
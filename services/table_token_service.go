@@ -0,0 +1,40 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+
+	"go-api/config"
+	"go-api/models"
+)
+
+// ===============================
+// TABLE TOKEN SERVICE
+// ===============================
+
+// Token QR bàn = HMAC-SHA256(secret, "table:<restaurant_id>:<table_id>:<version>")
+// cắt 16 byte, mã hóa base64url. Đổi QR = tăng version nên token cũ tự mất hiệu lực.
+const tableTokenBytes = 16
+
+// TableQRToken tạo token ký cho bàn theo phiên bản hiện tại
+func TableQRToken(table models.Table) string {
+	mac := hmac.New(sha256.New, config.TableQRSecret())
+	fmt.Fprintf(mac, "table:%d:%d:%d", table.RestaurantID, table.ID, table.QRTokenVersion)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:tableTokenBytes])
+}
+
+// VerifyTableQRToken kiểm tra token khách gửi lên có khớp bàn không
+func VerifyTableQRToken(table models.Table, token string) bool {
+	if token == "" {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(TableQRToken(table)))
+}
+
+// TableQRURL link gọi món kèm token ký (nội dung in trên QR của bàn)
+func TableQRURL(slug string, table models.Table) string {
+	return TableOrderURL(slug, table.TableNumber) + "?t=" + url.QueryEscape(TableQRToken(table))
+}
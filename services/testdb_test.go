@@ -0,0 +1,87 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"go-api/config"
+	"go-api/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB database SQLite trong bộ nhớ, riêng cho từng test, đồng thời gán vào config.DB
+// cho các hàm dùng config.GetDB()
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared&_pragma=busy_timeout(5000)", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	// Một kết nối: các transaction chạy tuần tự như khi có khóa dòng
+	sqlDB.SetMaxOpenConns(1)
+
+	if err := db.AutoMigrate(
+		&models.User{},
+		&models.Package{},
+		&models.Restaurant{},
+		&models.PaymentSetting{},
+		&models.Order{},
+		&models.OrderItem{},
+		&models.PaymentTransaction{},
+		&models.WebhookEndpoint{},
+		&models.WebhookDelivery{},
+		&models.OrderPayment{},
+		&models.PaymentRefund{},
+		&models.LedgerAccount{},
+		&models.LedgerTransaction{},
+		&models.LedgerEntry{},
+		&models.CashShift{},
+		&models.DailyClosing{},
+	); err != nil {
+		t.Fatalf("migrate test db: %v", err)
+	}
+
+	previous := config.DB
+	config.DB = db
+	t.Cleanup(func() {
+		config.DB = previous
+		sqlDB.Close()
+	})
+	return db
+}
+
+// createTestOrder tạo nhà hàng (kèm cấu hình thanh toán) và một đơn chưa thanh toán
+func createTestOrder(t *testing.T, db *gorm.DB, total float64) models.Order {
+	t.Helper()
+
+	restaurant := models.Restaurant{Name: "Test", Slug: "test", Status: "active", PackageStatus: "active"}
+	if err := db.Create(&restaurant).Error; err != nil {
+		t.Fatalf("create restaurant: %v", err)
+	}
+	if err := db.Create(&models.PaymentSetting{RestaurantID: restaurant.ID}).Error; err != nil {
+		t.Fatalf("create payment setting: %v", err)
+	}
+
+	order := models.Order{
+		RestaurantID:  restaurant.ID,
+		OrderNumber:   "ORD-TEST-1",
+		OrderType:     "takeaway",
+		Status:        "pending",
+		PaymentStatus: "unpaid",
+		Subtotal:      total,
+		TotalAmount:   total,
+	}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	return order
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"go-api/models"
+
+	"gorm.io/gorm"
+)
+
+// ===============================
+// USER TOKEN SERVICE
+// ===============================
+
+// Loại token dùng một lần
+const (
+	UserTokenStaffInvite   = "staff_invite"
+	UserTokenPasswordReset = "password_reset"
+	UserTokenEmailVerify   = "email_verify"
+)
+
+// IssueUserToken tạo token ngẫu nhiên cho user, chỉ lưu hash vào DB và trả về token gốc để gửi qua link.
+// Các token cùng loại chưa dùng của user bị vô hiệu hóa.
+func IssueUserToken(tx *gorm.DB, userID uint, tokenType string, ttl time.Duration) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+
+	now := time.Now()
+	if err := tx.Model(&models.UserToken{}).
+		Where("user_id = ? AND type = ? AND used_at IS NULL", userID, tokenType).
+		Update("used_at", now).Error; err != nil {
+		return "", err
+	}
+
+	token := models.UserToken{
+		UserID:    userID,
+		Type:      tokenType,
+		TokenHash: hashUserToken(raw),
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := tx.Create(&token).Error; err != nil {
+		return "", err
+	}
+
+	return raw, nil
+}
+
+// ConsumeUserToken kiểm tra token gốc và đánh dấu đã dùng
+func ConsumeUserToken(tx *gorm.DB, tokenType, raw string) (*models.UserToken, error) {
+	var token models.UserToken
+	if err := tx.Where("token_hash = ? AND type = ?", hashUserToken(raw), tokenType).First(&token).Error; err != nil {
+		return nil, fmt.Errorf("INVALID_TOKEN: token không hợp lệ")
+	}
+
+	if token.UsedAt != nil {
+		return nil, fmt.Errorf("TOKEN_USED: token đã được sử dụng")
+	}
+	if time.Now().After(token.ExpiresAt) {
+		return nil, fmt.Errorf("TOKEN_EXPIRED: token đã hết hạn")
+	}
+
+	now := time.Now()
+	result := tx.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL", token.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("TOKEN_USED: token đã được sử dụng")
+	}
+	token.UsedAt = &now
+
+	return &token, nil
+}
+
+// hashUserToken băm token gốc (sha256 hex) để lưu DB
+func hashUserToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
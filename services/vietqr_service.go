@@ -3,6 +3,7 @@ package services
 import (
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
 )
 
@@ -109,3 +110,71 @@ func GetBankBin(bankCode string) (string, bool) {
 	bin, ok := BankBinMap[strings.ToUpper(bankCode)]
 	return bin, ok
 }
+
+// ===============================
+// VIETQR PAYLOAD (EMVCo / NAPAS)
+// ===============================
+
+// Nội dung QR theo chuẩn VietQR (EMVCo), dùng khi cần tự render QR (in trên hóa đơn giấy)
+// thay vì tải ảnh từ img.vietqr.io
+
+const (
+	vietQRNapasGUID    = "A000000727"
+	vietQRServiceToAcc = "QRIBFTTA" // Chuyển nhanh tới tài khoản
+)
+
+// BuildVietQRPayload nội dung QR chuyển khoản VietQR: ngân hàng, số tài khoản, số tiền (0 = khách tự nhập), nội dung
+func BuildVietQRPayload(bankCode, accountNumber string, amount int64, description string) (string, error) {
+	bankBin, ok := GetBankBin(bankCode)
+	if !ok {
+		return "", fmt.Errorf("unsupported bank code: %s", bankCode)
+	}
+	if accountNumber == "" {
+		return "", fmt.Errorf("account number is required")
+	}
+
+	beneficiary := emvField("00", bankBin) + emvField("01", accountNumber)
+	merchant := emvField("00", vietQRNapasGUID) + emvField("01", beneficiary) + emvField("02", vietQRServiceToAcc)
+
+	initMethod := "11" // QR tĩnh
+	if amount > 0 {
+		initMethod = "12" // QR động (có số tiền)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(emvField("00", "01"))
+	sb.WriteString(emvField("01", initMethod))
+	sb.WriteString(emvField("38", merchant))
+	sb.WriteString(emvField("53", "704")) // VND
+	if amount > 0 {
+		sb.WriteString(emvField("54", strconv.FormatInt(amount, 10)))
+	}
+	sb.WriteString(emvField("58", "VN"))
+	if description != "" {
+		sb.WriteString(emvField("62", emvField("08", description)))
+	}
+	sb.WriteString("6304")
+
+	return sb.String() + fmt.Sprintf("%04X", crc16CCITT(sb.String())), nil
+}
+
+// emvField một trường ID + độ dài (2 chữ số) + giá trị
+func emvField(id, value string) string {
+	return fmt.Sprintf("%s%02d%s", id, len(value), value)
+}
+
+// crc16CCITT CRC-16/CCITT-FALSE (poly 0x1021, khởi tạo 0xFFFF) theo chuẩn EMVCo
+func crc16CCITT(data string) uint16 {
+	crc := uint16(0xFFFF)
+	for i := 0; i < len(data); i++ {
+		crc ^= uint16(data[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/config"
+	"go-api/models"
+)
+
+// VNPay Payment Gateway (API 2.1.0)
+// Documentation: https://sandbox.vnpayment.vn/apis/docs/thanh-toan-pay/pay.html
+
+const (
+	vnpayVersion    = "2.1.0"
+	vnpayTimeLayout = "20060102150405"
+)
+
+// Mã VNPay
+const (
+	vnpayCodeSuccess  = "00"
+	vnpayCodeNotFound = "91" // querydr: không tìm thấy giao dịch (khách chưa thanh toán)
+	vnpayTxnPending   = "01"
+)
+
+// vnpayLocation VNPay dùng giờ GMT+7 cho mọi mốc thời gian
+var vnpayLocation = time.FixedZone("GMT+7", 7*60*60)
+
+// vnpayPaymentProvider cổng VNPay, ký HMAC-SHA512 bằng hash secret của merchant
+type vnpayPaymentProvider struct {
+	tmnCode    string
+	hashSecret string
+	paymentURL string
+	apiURL     string
+	client     *http.Client
+}
+
+func newVNPayPaymentProvider(settings models.PaymentSetting) (PaymentProvider, error) {
+	if settings.VNPayTmnCode == nil || settings.VNPayHashSecret == nil ||
+		*settings.VNPayTmnCode == "" || *settings.VNPayHashSecret == "" {
+		return nil, fmt.Errorf("VNPAY_NOT_CONFIGURED: nhà hàng chưa cấu hình tài khoản VNPay")
+	}
+	return &vnpayPaymentProvider{
+		tmnCode:    *settings.VNPayTmnCode,
+		hashSecret: *settings.VNPayHashSecret,
+		paymentURL: config.VNPayPaymentURL(),
+		apiURL:     config.VNPayAPIURL(),
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (p *vnpayPaymentProvider) Name() string {
+	return PaymentProviderVNPay
+}
+
+// CreatePayment tạo URL thanh toán VNPay (không gọi API, khách được chuyển thẳng tới cổng)
+func (p *vnpayPaymentProvider) CreatePayment(req PaymentRequest) (*PaymentResult, error) {
+	clientIP := req.ClientIP
+	if clientIP == "" {
+		clientIP = "127.0.0.1"
+	}
+
+	params := map[string]string{
+		"vnp_Version":    vnpayVersion,
+		"vnp_Command":    "pay",
+		"vnp_TmnCode":    p.tmnCode,
+		"vnp_Amount":     strconv.FormatInt(req.Amount*100, 10),
+		"vnp_CurrCode":   "VND",
+		"vnp_TxnRef":     req.Ref,
+		"vnp_OrderInfo":  req.OrderInfo,
+		"vnp_OrderType":  "other",
+		"vnp_Locale":     "vn",
+		"vnp_ReturnUrl":  req.ReturnURL,
+		"vnp_IpAddr":     clientIP,
+		"vnp_CreateDate": req.CreatedAt.In(vnpayLocation).Format(vnpayTimeLayout),
+		"vnp_ExpireDate": req.ExpiresAt.In(vnpayLocation).Format(vnpayTimeLayout),
+	}
+
+	query := vnpayQuery(params)
+	payURL := p.paymentURL + "?" + query + "&vnp_SecureHash=" + p.sign(query)
+
+	return &PaymentResult{Ref: req.Ref, PayURL: payURL}, nil
+}
+
+// VerifyCallback xác thực chữ ký IPN / return URL VNPay
+func (p *vnpayPaymentProvider) VerifyCallback(params map[string]string) (*PaymentCallback, error) {
+	fields := map[string]string{}
+	for key, value := range params {
+		if strings.HasPrefix(key, "vnp_") && key != "vnp_SecureHash" && key != "vnp_SecureHashType" {
+			fields[key] = value
+		}
+	}
+
+	expected := p.sign(vnpayQuery(fields))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(params["vnp_SecureHash"]))) {
+		return nil, fmt.Errorf("INVALID_SIGNATURE: chữ ký VNPay không hợp lệ")
+	}
+	if params["vnp_TmnCode"] != p.tmnCode {
+		return nil, fmt.Errorf("INVALID_SIGNATURE: mã website VNPay không khớp")
+	}
+
+	amount, err := strconv.ParseInt(params["vnp_Amount"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("INVALID_CALLBACK: số tiền không hợp lệ")
+	}
+
+	return &PaymentCallback{
+		Ref:     params["vnp_TxnRef"],
+		TransID: params["vnp_TransactionNo"],
+		Amount:  amount / 100,
+		Success: params["vnp_ResponseCode"] == vnpayCodeSuccess && params["vnp_TransactionStatus"] == vnpayCodeSuccess,
+		Message: "VNPay response code " + params["vnp_ResponseCode"],
+	}, nil
+}
+
+// QueryStatus tra cứu giao dịch (querydr)
+func (p *vnpayPaymentProvider) QueryStatus(payment models.OrderPayment) (*PaymentStatusResult, error) {
+	requestID, err := newOrderPaymentRef("Q")
+	if err != nil {
+		return nil, err
+	}
+
+	createDate := time.Now().In(vnpayLocation).Format(vnpayTimeLayout)
+	transactionDate := payment.CreatedAt.In(vnpayLocation).Format(vnpayTimeLayout)
+	orderInfo := "Truy van giao dich " + payment.ProviderRef
+	ipAddr := "127.0.0.1"
+
+	hashData := strings.Join([]string{
+		requestID, vnpayVersion, "querydr", p.tmnCode, payment.ProviderRef,
+		transactionDate, createDate, ipAddr, orderInfo,
+	}, "|")
+
+	resp, err := p.post(map[string]string{
+		"vnp_RequestId":       requestID,
+		"vnp_Version":         vnpayVersion,
+		"vnp_Command":         "querydr",
+		"vnp_TmnCode":         p.tmnCode,
+		"vnp_TxnRef":          payment.ProviderRef,
+		"vnp_OrderInfo":       orderInfo,
+		"vnp_TransactionDate": transactionDate,
+		"vnp_CreateDate":      createDate,
+		"vnp_IpAddr":          ipAddr,
+		"vnp_SecureHash":      p.sign(hashData),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp["vnp_ResponseCode"] {
+	case vnpayCodeSuccess:
+	case vnpayCodeNotFound:
+		return &PaymentStatusResult{Status: OrderPaymentPending}, nil
+	default:
+		return nil, fmt.Errorf("PROVIDER_ERROR: VNPay: %s (%s)", resp["vnp_Message"], resp["vnp_ResponseCode"])
+	}
+
+	// Chữ ký response: ResponseId|Command|ResponseCode|Message|TmnCode|TxnRef|Amount|BankCode|PayDate|TransactionNo|TransactionType|TransactionStatus|OrderInfo|PromotionCode|PromotionAmount
+	responseHash := strings.Join([]string{
+		resp["vnp_ResponseId"], resp["vnp_Command"], resp["vnp_ResponseCode"], resp["vnp_Message"],
+		resp["vnp_TmnCode"], resp["vnp_TxnRef"], resp["vnp_Amount"], resp["vnp_BankCode"],
+		resp["vnp_PayDate"], resp["vnp_TransactionNo"], resp["vnp_TransactionType"],
+		resp["vnp_TransactionStatus"], resp["vnp_OrderInfo"], resp["vnp_PromotionCode"], resp["vnp_PromotionAmount"],
+	}, "|")
+	if !hmac.Equal([]byte(p.sign(responseHash)), []byte(strings.ToLower(resp["vnp_SecureHash"]))) {
+		return nil, fmt.Errorf("INVALID_SIGNATURE: chữ ký phản hồi VNPay không hợp lệ")
+	}
+
+	amount, _ := strconv.ParseInt(resp["vnp_Amount"], 10, 64)
+	result := &PaymentStatusResult{
+		TransID: resp["vnp_TransactionNo"],
+		Amount:  amount / 100,
+		Message: resp["vnp_Message"],
+	}
+	switch resp["vnp_TransactionStatus"] {
+	case vnpayCodeSuccess:
+		result.Status = OrderPaymentPaid
+	case vnpayTxnPending:
+		result.Status = OrderPaymentPending
+	default:
+		result.Status = OrderPaymentFailed
+	}
+	return result, nil
+}
+
+// Refund hoàn tiền: 02 = toàn phần, 03 = một phần
+func (p *vnpayPaymentProvider) Refund(payment models.OrderPayment, req RefundRequest) (*RefundResult, error) {
+	transactionType := "03"
+	if payment.RefundedAmount == 0 && req.Amount == vndAmount(payment.Amount) {
+		transactionType = "02"
+	}
+
+	transactionNo := ""
+	if payment.ProviderTransID != nil {
+		transactionNo = *payment.ProviderTransID
+	}
+	clientIP := req.ClientIP
+	if clientIP == "" {
+		clientIP = "127.0.0.1"
+	}
+	amount := strconv.FormatInt(req.Amount*100, 10)
+	createDate := time.Now().In(vnpayLocation).Format(vnpayTimeLayout)
+	transactionDate := payment.CreatedAt.In(vnpayLocation).Format(vnpayTimeLayout)
+	orderInfo := "Hoan tien don " + payment.ProviderRef
+
+	hashData := strings.Join([]string{
+		req.RefundRef, vnpayVersion, "refund", p.tmnCode, transactionType, payment.ProviderRef,
+		amount, transactionNo, transactionDate, req.CreatedBy, createDate, clientIP, orderInfo,
+	}, "|")
+
+	resp, err := p.post(map[string]string{
+		"vnp_RequestId":       req.RefundRef,
+		"vnp_Version":         vnpayVersion,
+		"vnp_Command":         "refund",
+		"vnp_TmnCode":         p.tmnCode,
+		"vnp_TransactionType": transactionType,
+		"vnp_TxnRef":          payment.ProviderRef,
+		"vnp_Amount":          amount,
+		"vnp_TransactionNo":   transactionNo,
+		"vnp_TransactionDate": transactionDate,
+		"vnp_CreateBy":        req.CreatedBy,
+		"vnp_CreateDate":      createDate,
+		"vnp_IpAddr":          clientIP,
+		"vnp_OrderInfo":       orderInfo,
+		"vnp_SecureHash":      p.sign(hashData),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp["vnp_ResponseCode"] != vnpayCodeSuccess {
+		return nil, fmt.Errorf("VNPay: %s (%s)", resp["vnp_Message"], resp["vnp_ResponseCode"])
+	}
+
+	return &RefundResult{
+		Status:           RefundSucceeded,
+		ProviderRefundID: resp["vnp_TransactionNo"],
+		Message:          resp["vnp_Message"],
+	}, nil
+}
+
+// sign HMAC-SHA512 hex (chữ thường)
+func (p *vnpayPaymentProvider) sign(data string) string {
+	mac := hmac.New(sha512.New, []byte(p.hashSecret))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// post gọi merchant_webapi, response được chuẩn hóa thành map chuỗi
+func (p *vnpayPaymentProvider) post(body map[string]string) (map[string]string, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Post(p.apiURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("PROVIDER_ERROR: không kết nối được VNPay: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("PROVIDER_ERROR: VNPay trả về dữ liệu không hợp lệ (HTTP %d)", resp.StatusCode)
+	}
+
+	result := make(map[string]string, len(raw))
+	for key, value := range raw {
+		if value != nil {
+			result[key] = fmt.Sprint(value)
+		}
+	}
+	return result, nil
+}
+
+// vnpayQuery chuỗi tham số sắp xếp theo tên, mã hóa kiểu urlencode (dùng cả để ký lẫn làm query string)
+func vnpayQuery(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, url.QueryEscape(key)+"="+url.QueryEscape(params[key]))
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,434 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go-api/config"
+	"go-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ===============================
+// OUTBOUND WEBHOOK SERVICE
+// ===============================
+
+// Loại sự kiện có thể đăng ký webhook
+const (
+	WebhookEventOrderCreated       = "order.created"
+	WebhookEventOrderPaid          = "order.paid"
+	WebhookEventOrderStatusChanged = "order.status_changed"
+	WebhookEventMenuUpdated        = "menu.updated"
+	WebhookEventPing               = "webhook.ping" // Chỉ dùng khi bấm "gửi thử"
+)
+
+// WebhookEventTypes danh sách sự kiện nhà hàng có thể đăng ký
+var WebhookEventTypes = []string{
+	WebhookEventOrderCreated,
+	WebhookEventOrderPaid,
+	WebhookEventOrderStatusChanged,
+	WebhookEventMenuUpdated,
+}
+
+// Trạng thái một lần gửi webhook
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryRetrying  = "retrying"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryDead      = "dead" // Hết lượt thử lại, nằm trong danh sách dead-letter chờ gửi lại thủ công
+)
+
+const (
+	// WebhookMaxAttempts số lần gửi tối đa trước khi chuyển sang dead-letter
+	WebhookMaxAttempts = 10
+	// webhookBaseBackoff thời gian chờ sau lần lỗi đầu tiên, nhân đôi sau mỗi lần (30s, 1m, 2m... tối đa 6h)
+	webhookBaseBackoff = 30 * time.Second
+	webhookMaxBackoff  = 6 * time.Hour
+
+	webhookTimeout       = 10 * time.Second
+	webhookBatchSize     = 50
+	webhookWorkers       = 4
+	webhookResponseLimit = 2048
+)
+
+// WebhookPayload nội dung JSON gửi tới endpoint
+type WebhookPayload struct {
+	ID           string                 `json:"id"`
+	Type         string                 `json:"type"`
+	RestaurantID uint                   `json:"restaurant_id"`
+	CreatedAt    time.Time              `json:"created_at"`
+	Data         map[string]interface{} `json:"data"`
+}
+
+// IsValidWebhookEvent kiểm tra loại sự kiện có thể đăng ký
+func IsValidWebhookEvent(eventType string) bool {
+	for _, t := range WebhookEventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookEndpointEvents tách danh sách sự kiện đã đăng ký của endpoint
+func WebhookEndpointEvents(endpoint models.WebhookEndpoint) []string {
+	events := []string{}
+	for _, e := range strings.Split(endpoint.Events, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// GenerateWebhookSecret tạo khóa ký HMAC mới cho endpoint
+func GenerateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// SignWebhookPayload chữ ký header X-Webhook-Signature: "t=<unix>,v1=<hex HMAC-SHA256(secret, "<unix>.<body>")>".
+// Bên nhận tính lại HMAC với cùng secret và so khớp, đồng thời từ chối timestamp quá cũ để chặn gửi lại
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// ValidateWebhookURL kiểm tra URL nhận webhook (http/https, không trỏ vào mạng nội bộ)
+func ValidateWebhookURL(raw string) error {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("INVALID_URL: URL phải bắt đầu bằng http:// hoặc https://")
+	}
+	if config.WebhookAllowPrivateTargets() {
+		return nil
+	}
+	if u.Hostname() == "localhost" {
+		return fmt.Errorf("INVALID_URL: không thể gửi webhook tới địa chỉ nội bộ")
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && isPrivateWebhookIP(ip) {
+		return fmt.Errorf("INVALID_URL: không thể gửi webhook tới địa chỉ nội bộ")
+	}
+	return nil
+}
+
+// WebhookBackoff thời gian chờ trước lần gửi tiếp theo sau N lần lỗi
+func WebhookBackoff(attempts int) time.Duration {
+	delay := webhookBaseBackoff
+	for i := 1; i < attempts && delay < webhookMaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, webhookMaxBackoff)
+}
+
+// ===============================
+// DISPATCHER
+// ===============================
+
+var (
+	webhookWake   = make(chan struct{}, 1)
+	webhookClient = newWebhookHTTPClient()
+)
+
+// StartWebhookDispatcher đăng ký nhận sự kiện từ event bus để tạo lượt gửi webhook,
+// và chạy worker gửi các lượt đến hạn (kiểm tra định kỳ mỗi interval hoặc ngay khi có sự kiện mới)
+func StartWebhookDispatcher(interval time.Duration) {
+	SubscribeEvents(func(e Event) {
+		if !IsValidWebhookEvent(e.Type) {
+			return
+		}
+		// Không chặn request đang phát sự kiện
+		go func() {
+			if err := EnqueueWebhookEvent(config.GetDB(), e); err != nil {
+				log.Printf("❌ Failed to enqueue webhook event %s: %v", e.Type, err)
+			}
+		}()
+	})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-webhookWake:
+			}
+			ProcessDueWebhookDeliveries(config.GetDB())
+		}
+	}()
+}
+
+// wakeWebhookDispatcher báo worker có lượt gửi mới
+func wakeWebhookDispatcher() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// EnqueueWebhookEvent tạo lượt gửi cho mọi endpoint đang bật của nhà hàng có đăng ký sự kiện
+func EnqueueWebhookEvent(db *gorm.DB, e Event) error {
+	var endpoints []models.WebhookEndpoint
+	if err := db.Where("restaurant_id = ? AND is_active = ?", e.RestaurantID, true).Find(&endpoints).Error; err != nil {
+		return err
+	}
+
+	var matched []models.WebhookEndpoint
+	for _, endpoint := range endpoints {
+		for _, t := range WebhookEndpointEvents(endpoint) {
+			if t == e.Type {
+				matched = append(matched, endpoint)
+				break
+			}
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+
+	eventID := uuid.NewString()
+	body, err := json.Marshal(WebhookPayload{
+		ID:           eventID,
+		Type:         e.Type,
+		RestaurantID: e.RestaurantID,
+		CreatedAt:    e.CreatedAt,
+		Data:         e.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deliveries := make([]models.WebhookDelivery, 0, len(matched))
+	for _, endpoint := range matched {
+		deliveries = append(deliveries, models.WebhookDelivery{
+			EndpointID:    endpoint.ID,
+			RestaurantID:  e.RestaurantID,
+			EventID:       eventID,
+			EventType:     e.Type,
+			Payload:       string(body),
+			Status:        WebhookDeliveryPending,
+			NextAttemptAt: &now,
+		})
+	}
+	if err := db.Create(&deliveries).Error; err != nil {
+		return err
+	}
+
+	wakeWebhookDispatcher()
+	return nil
+}
+
+// ProcessDueWebhookDeliveries gửi các lượt đã đến hạn (mới tạo hoặc chờ thử lại)
+func ProcessDueWebhookDeliveries(db *gorm.DB) {
+	now := time.Now()
+
+	var due []models.WebhookDelivery
+	if err := db.Preload("Endpoint").
+		Where("status IN ? AND next_attempt_at <= ?", []string{WebhookDeliveryPending, WebhookDeliveryRetrying}, now).
+		Order("next_attempt_at ASC").
+		Limit(webhookBatchSize).
+		Find(&due).Error; err != nil {
+		log.Printf("❌ Webhook dispatcher error: %v", err)
+		return
+	}
+
+	sem := make(chan struct{}, webhookWorkers)
+	var wg sync.WaitGroup
+	for i := range due {
+		delivery := &due[i]
+
+		// Giữ chỗ lượt gửi (dời next_attempt_at) để instance khác không gửi trùng
+		lease := now.Add(3 * webhookTimeout)
+		claimed := db.Model(&models.WebhookDelivery{}).
+			Where("id = ? AND next_attempt_at = ?", delivery.ID, delivery.NextAttemptAt).
+			Update("next_attempt_at", lease)
+		if claimed.Error != nil || claimed.RowsAffected == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			attemptWebhookDelivery(db, delivery)
+		}()
+	}
+	wg.Wait()
+}
+
+// RequeueWebhookDelivery đưa lượt gửi (kể cả đã thành công hoặc dead-letter) về hàng đợi để gửi lại ngay
+func RequeueWebhookDelivery(db *gorm.DB, delivery *models.WebhookDelivery) error {
+	now := time.Now()
+	if err := db.Model(delivery).Updates(map[string]interface{}{
+		"status":          WebhookDeliveryPending,
+		"attempts":        0,
+		"next_attempt_at": now,
+		"delivered_at":    nil,
+	}).Error; err != nil {
+		return err
+	}
+	delivery.Status = WebhookDeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = &now
+	delivery.DeliveredAt = nil
+
+	wakeWebhookDispatcher()
+	return nil
+}
+
+// PingWebhookEndpoint gửi thử sự kiện webhook.ping (không lưu, không thử lại) và trả về kết quả
+func PingWebhookEndpoint(endpoint models.WebhookEndpoint) (int, string, error) {
+	body, err := json.Marshal(WebhookPayload{
+		ID:           uuid.NewString(),
+		Type:         WebhookEventPing,
+		RestaurantID: endpoint.RestaurantID,
+		CreatedAt:    time.Now(),
+		Data: map[string]interface{}{
+			"webhook_id": endpoint.ID,
+		},
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	return sendWebhook(endpoint, WebhookEventPing, "ping", body)
+}
+
+// attemptWebhookDelivery gửi một lượt và ghi kết quả: thành công, hẹn thử lại hoặc chuyển dead-letter
+func attemptWebhookDelivery(db *gorm.DB, delivery *models.WebhookDelivery) {
+	now := time.Now()
+	attempts := delivery.Attempts + 1
+
+	var status int
+	var body string
+	var err error
+	if delivery.Endpoint == nil || !delivery.Endpoint.IsActive {
+		err = fmt.Errorf("endpoint đã bị tắt hoặc xóa")
+		attempts = WebhookMaxAttempts
+	} else {
+		status, body, err = sendWebhook(*delivery.Endpoint, delivery.EventType, strconv.FormatUint(uint64(delivery.ID), 10), []byte(delivery.Payload))
+	}
+
+	updates := map[string]interface{}{
+		"attempts":        attempts,
+		"last_attempt_at": now,
+		"response_status": nil,
+		"response_body":   body,
+		"last_error":      nil,
+	}
+	if status != 0 {
+		updates["response_status"] = status
+	}
+
+	switch {
+	case err == nil:
+		updates["status"] = WebhookDeliverySucceeded
+		updates["delivered_at"] = now
+		updates["next_attempt_at"] = nil
+	case attempts >= WebhookMaxAttempts:
+		updates["status"] = WebhookDeliveryDead
+		updates["next_attempt_at"] = nil
+		updates["last_error"] = err.Error()
+		log.Printf("⚠️ Webhook delivery %d (%s) moved to dead-letter after %d attempts: %v",
+			delivery.ID, delivery.EventType, attempts, err)
+	default:
+		updates["status"] = WebhookDeliveryRetrying
+		updates["next_attempt_at"] = now.Add(WebhookBackoff(attempts))
+		updates["last_error"] = err.Error()
+	}
+
+	if err := db.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(updates).Error; err != nil {
+		log.Printf("❌ Failed to save webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// sendWebhook POST payload đã ký tới endpoint. Chỉ mã 2xx được coi là thành công
+func sendWebhook(endpoint models.WebhookEndpoint, eventType, deliveryID string, body []byte) (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "RestaurantManager-Webhook/1.0")
+	req.Header.Set("X-Webhook-Event", eventType)
+	req.Header.Set("X-Webhook-Delivery", deliveryID)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", SignWebhookPayload(endpoint.Secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(respBody), fmt.Errorf("endpoint trả về HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(respBody), nil
+}
+
+// newWebhookHTTPClient HTTP client gửi webhook: có timeout, không theo redirect,
+// chặn kết nối tới IP nội bộ sau khi phân giải DNS (trừ khi WEBHOOK_ALLOW_PRIVATE_TARGETS=true)
+func newWebhookHTTPClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			if config.WebhookAllowPrivateTargets() {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip != nil && isPrivateWebhookIP(ip) {
+				return fmt.Errorf("địa chỉ nội bộ %s không được phép", host)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// isPrivateWebhookIP IP loopback, mạng riêng, link-local...
+func isPrivateWebhookIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast()
+}
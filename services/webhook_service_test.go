@@ -0,0 +1,320 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-api/models"
+
+	"gorm.io/gorm"
+)
+
+// webhookReceiver endpoint nhận webhook cục bộ: trả mã lần lượt theo statuses (hết danh sách thì 200)
+type webhookReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) (*webhookReceiver, *httptest.Server) {
+	t.Helper()
+	receiver := &webhookReceiver{statuses: statuses}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		receiver.mu.Lock()
+		receiver.requests = append(receiver.requests, r)
+		receiver.bodies = append(receiver.bodies, body)
+		status := http.StatusOK
+		if len(receiver.statuses) > 0 {
+			status = receiver.statuses[0]
+			receiver.statuses = receiver.statuses[1:]
+		}
+		receiver.mu.Unlock()
+
+		w.WriteHeader(status)
+		w.Write([]byte(`{"received":true}`))
+	}))
+	t.Cleanup(server.Close)
+	return receiver, server
+}
+
+func (r *webhookReceiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+// queueTestWebhook tạo endpoint đăng ký order.paid và một lượt gửi đến hạn
+func queueTestWebhook(t *testing.T, db *gorm.DB, url string) (models.WebhookEndpoint, models.WebhookDelivery) {
+	t.Helper()
+
+	endpoint := models.WebhookEndpoint{
+		RestaurantID: 1,
+		URL:          url,
+		Events:       WebhookEventOrderPaid,
+		Secret:       "whsec_test",
+		IsActive:     true,
+	}
+	if err := db.Create(&endpoint).Error; err != nil {
+		t.Fatalf("create endpoint: %v", err)
+	}
+
+	err := EnqueueWebhookEvent(db, Event{
+		Type:         WebhookEventOrderPaid,
+		RestaurantID: 1,
+		Data:         map[string]interface{}{"order_id": 42},
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("EnqueueWebhookEvent: %v", err)
+	}
+
+	var delivery models.WebhookDelivery
+	if err := db.Where("endpoint_id = ?", endpoint.ID).First(&delivery).Error; err != nil {
+		t.Fatalf("delivery not queued: %v", err)
+	}
+	return endpoint, delivery
+}
+
+// makeWebhookDue cho lượt gửi đến hạn ngay (bỏ qua thời gian chờ thử lại)
+func makeWebhookDue(db *gorm.DB, delivery models.WebhookDelivery) {
+	db.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Update("next_attempt_at", time.Now().Add(-time.Second))
+}
+
+func reloadDelivery(t *testing.T, db *gorm.DB, id uint) models.WebhookDelivery {
+	t.Helper()
+	var delivery models.WebhookDelivery
+	if err := db.First(&delivery, id).Error; err != nil {
+		t.Fatalf("reload delivery: %v", err)
+	}
+	return delivery
+}
+
+func TestWebhookDeliverySignature(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "true")
+	db := newTestDB(t)
+	receiver, server := newWebhookReceiver(t)
+	endpoint, delivery := queueTestWebhook(t, db, server.URL)
+
+	ProcessDueWebhookDeliveries(db)
+
+	if receiver.count() != 1 {
+		t.Fatalf("receiver got %d requests, want 1", receiver.count())
+	}
+	req, body := receiver.requests[0], receiver.bodies[0]
+	if req.Header.Get("X-Webhook-Event") != WebhookEventOrderPaid {
+		t.Errorf("X-Webhook-Event = %q", req.Header.Get("X-Webhook-Event"))
+	}
+	if req.Header.Get("X-Webhook-Delivery") != strconv.FormatUint(uint64(delivery.ID), 10) {
+		t.Errorf("X-Webhook-Delivery = %q, want %d", req.Header.Get("X-Webhook-Delivery"), delivery.ID)
+	}
+
+	// Bên nhận tự tính HMAC-SHA256(secret, "<timestamp>.<body>")
+	timestamp := req.Header.Get("X-Webhook-Timestamp")
+	mac := hmac.New(sha256.New, []byte(endpoint.Secret))
+	mac.Write([]byte(timestamp + "." + string(body)))
+	want := "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+	if got := req.Header.Get("X-Webhook-Signature"); got != want {
+		t.Errorf("X-Webhook-Signature = %q, want %q", got, want)
+	}
+
+	// Chữ ký với secret khác hoặc body bị sửa không khớp
+	ts, _ := strconv.ParseInt(timestamp, 10, 64)
+	if SignWebhookPayload("whsec_other", ts, body) == want {
+		t.Error("signature does not depend on the secret")
+	}
+	if SignWebhookPayload(endpoint.Secret, ts, append(body, ' ')) == want {
+		t.Error("signature does not depend on the body")
+	}
+
+	delivery = reloadDelivery(t, db, delivery.ID)
+	if delivery.Status != WebhookDeliverySucceeded || delivery.Attempts != 1 || delivery.DeliveredAt == nil {
+		t.Errorf("delivery = %s / %d attempts, want succeeded after 1", delivery.Status, delivery.Attempts)
+	}
+}
+
+func TestWebhookDeliveryRetriesWithBackoffOn5xx(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "true")
+	db := newTestDB(t)
+	receiver, server := newWebhookReceiver(t, http.StatusInternalServerError, http.StatusBadGateway)
+	_, delivery := queueTestWebhook(t, db, server.URL)
+
+	before := time.Now()
+	ProcessDueWebhookDeliveries(db)
+
+	delivery = reloadDelivery(t, db, delivery.ID)
+	if delivery.Status != WebhookDeliveryRetrying || delivery.Attempts != 1 {
+		t.Fatalf("after 500: %s / %d attempts, want retrying / 1", delivery.Status, delivery.Attempts)
+	}
+	if delivery.ResponseStatus == nil || *delivery.ResponseStatus != http.StatusInternalServerError || delivery.LastError == nil {
+		t.Errorf("after 500: response status %v, last error %v", delivery.ResponseStatus, delivery.LastError)
+	}
+	if delivery.NextAttemptAt == nil || delivery.NextAttemptAt.Before(before.Add(WebhookBackoff(1))) {
+		t.Errorf("next attempt %v, want at least %s after the failure", delivery.NextAttemptAt, WebhookBackoff(1))
+	}
+
+	// Chưa đến hạn: không gửi lại
+	ProcessDueWebhookDeliveries(db)
+	if receiver.count() != 1 {
+		t.Fatalf("retried before backoff elapsed: %d requests", receiver.count())
+	}
+
+	makeWebhookDue(db, delivery)
+	before = time.Now()
+	ProcessDueWebhookDeliveries(db)
+	delivery = reloadDelivery(t, db, delivery.ID)
+	if delivery.Status != WebhookDeliveryRetrying || delivery.Attempts != 2 {
+		t.Fatalf("after 502: %s / %d attempts, want retrying / 2", delivery.Status, delivery.Attempts)
+	}
+	if delivery.NextAttemptAt.Before(before.Add(WebhookBackoff(2))) {
+		t.Errorf("second backoff shorter than %s", WebhookBackoff(2))
+	}
+
+	makeWebhookDue(db, delivery)
+	ProcessDueWebhookDeliveries(db)
+	delivery = reloadDelivery(t, db, delivery.ID)
+	if delivery.Status != WebhookDeliverySucceeded || delivery.Attempts != 3 || receiver.count() != 3 {
+		t.Errorf("after 200: %s / %d attempts / %d requests, want succeeded / 3 / 3", delivery.Status, delivery.Attempts, receiver.count())
+	}
+}
+
+func TestWebhookBackoffDoublesUpToMax(t *testing.T) {
+	if WebhookBackoff(1) != 30*time.Second || WebhookBackoff(2) != time.Minute || WebhookBackoff(3) != 2*time.Minute {
+		t.Errorf("backoff 1..3 = %s, %s, %s", WebhookBackoff(1), WebhookBackoff(2), WebhookBackoff(3))
+	}
+	if WebhookBackoff(50) != webhookMaxBackoff {
+		t.Errorf("backoff(50) = %s, want %s", WebhookBackoff(50), webhookMaxBackoff)
+	}
+}
+
+func TestWebhookDeliveryDeadLettersAfterMaxAttempts(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "true")
+	db := newTestDB(t)
+	statuses := make([]int, WebhookMaxAttempts)
+	for i := range statuses {
+		statuses[i] = http.StatusServiceUnavailable
+	}
+	receiver, server := newWebhookReceiver(t, statuses...)
+	_, delivery := queueTestWebhook(t, db, server.URL)
+
+	for i := 1; i <= WebhookMaxAttempts; i++ {
+		makeWebhookDue(db, delivery)
+		ProcessDueWebhookDeliveries(db)
+		delivery = reloadDelivery(t, db, delivery.ID)
+		if i < WebhookMaxAttempts && delivery.Status != WebhookDeliveryRetrying {
+			t.Fatalf("attempt %d: status %s, want retrying", i, delivery.Status)
+		}
+	}
+
+	if delivery.Status != WebhookDeliveryDead || delivery.Attempts != WebhookMaxAttempts || delivery.NextAttemptAt != nil {
+		t.Fatalf("after %d failures: %s / %d attempts / next %v, want dead", WebhookMaxAttempts, delivery.Status, delivery.Attempts, delivery.NextAttemptAt)
+	}
+
+	// Dead-letter không tự gửi lại nữa
+	ProcessDueWebhookDeliveries(db)
+	if receiver.count() != WebhookMaxAttempts {
+		t.Errorf("receiver got %d requests, want %d", receiver.count(), WebhookMaxAttempts)
+	}
+}
+
+func TestWebhookRedeliverDeadLetter(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "true")
+	db := newTestDB(t)
+	receiver, server := newWebhookReceiver(t, http.StatusInternalServerError)
+	_, delivery := queueTestWebhook(t, db, server.URL)
+
+	// Lần gửi cuối cùng còn lại thất bại -> dead-letter
+	db.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Update("attempts", WebhookMaxAttempts-1)
+	ProcessDueWebhookDeliveries(db)
+	delivery = reloadDelivery(t, db, delivery.ID)
+	if delivery.Status != WebhookDeliveryDead {
+		t.Fatalf("status %s, want dead", delivery.Status)
+	}
+
+	if err := RequeueWebhookDelivery(db, &delivery); err != nil {
+		t.Fatalf("RequeueWebhookDelivery: %v", err)
+	}
+	delivery = reloadDelivery(t, db, delivery.ID)
+	if delivery.Status != WebhookDeliveryPending || delivery.Attempts != 0 {
+		t.Fatalf("after requeue: %s / %d attempts, want pending / 0", delivery.Status, delivery.Attempts)
+	}
+
+	ProcessDueWebhookDeliveries(db)
+	delivery = reloadDelivery(t, db, delivery.ID)
+	if delivery.Status != WebhookDeliverySucceeded || delivery.Attempts != 1 || receiver.count() != 2 {
+		t.Errorf("after redeliver: %s / %d attempts / %d requests, want succeeded / 1 / 2", delivery.Status, delivery.Attempts, receiver.count())
+	}
+
+	// Cùng payload và event id như lần gửi đầu
+	if string(receiver.bodies[0]) != string(receiver.bodies[1]) {
+		t.Error("redelivered payload differs from the original")
+	}
+}
+
+func TestWebhookRejectsPrivateTargets(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "false")
+
+	for _, raw := range []string{
+		"http://localhost:8080/hook",
+		"http://127.0.0.1/hook",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.10/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"ftp://example.com/hook",
+		"not a url",
+	} {
+		if err := ValidateWebhookURL(raw); err == nil {
+			t.Errorf("ValidateWebhookURL(%q) accepted a private or invalid target", raw)
+		}
+	}
+	if err := ValidateWebhookURL("https://hooks.example.com/restaurant"); err != nil {
+		t.Errorf("public URL rejected: %v", err)
+	}
+
+	// URL đã lưu trỏ vào IP nội bộ: chặn ngay lúc kết nối
+	db := newTestDB(t)
+	receiver, server := newWebhookReceiver(t)
+	_, delivery := queueTestWebhook(t, db, server.URL)
+
+	ProcessDueWebhookDeliveries(db)
+	delivery = reloadDelivery(t, db, delivery.ID)
+	if receiver.count() != 0 {
+		t.Fatalf("private target received %d requests", receiver.count())
+	}
+	if delivery.Status != WebhookDeliveryRetrying || delivery.LastError == nil || !strings.Contains(*delivery.LastError, "nội bộ") {
+		t.Errorf("delivery = %s, last error %v, want retrying with private address error", delivery.Status, delivery.LastError)
+	}
+}
+
+func TestWebhookDoesNotFollowRedirects(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "true")
+	db := newTestDB(t)
+	target, targetServer := newWebhookReceiver(t)
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, targetServer.URL, http.StatusTemporaryRedirect)
+	}))
+	t.Cleanup(redirect.Close)
+
+	_, delivery := queueTestWebhook(t, db, redirect.URL)
+	ProcessDueWebhookDeliveries(db)
+
+	delivery = reloadDelivery(t, db, delivery.ID)
+	if target.count() != 0 {
+		t.Fatalf("redirect was followed: target got %d requests", target.count())
+	}
+	if delivery.Status != WebhookDeliveryRetrying || delivery.ResponseStatus == nil || *delivery.ResponseStatus != http.StatusTemporaryRedirect {
+		t.Errorf("delivery = %s, response %v, want retrying with HTTP 307", delivery.Status, delivery.ResponseStatus)
+	}
+}
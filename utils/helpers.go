@@ -20,7 +20,7 @@ func GenerateSlug(name string) string {
 	slug := strings.ToLower(name)
 
 	// Loại bỏ dấu tiếng Việt
-	slug = removeVietnameseAccents(slug)
+	slug = RemoveVietnameseAccents(slug)
 
 	// Thay thế các ký tự đặc biệt bằng dấu gạch ngang
 	reg := regexp.MustCompile(`[^a-z0-9]+`)
@@ -32,8 +32,8 @@ func GenerateSlug(name string) string {
 	return slug
 }
 
-// removeVietnameseAccents loại bỏ dấu tiếng Việt
-func removeVietnameseAccents(s string) string {
+// RemoveVietnameseAccents loại bỏ dấu tiếng Việt
+func RemoveVietnameseAccents(s string) string {
 	// Mapping cho các ký tự đặc biệt tiếng Việt
 	replacements := map[string]string{
 		"đ": "d", "Đ": "D",